@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"kubehelp/internal/llm"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	askPrompt         string
+	askLLMProvider    string
+	askModel          string
+	askModelFallback  bool
+	askNoSystemPrompt bool
+	askSystemPrompt   string
+	askOutput         string
+)
+
+var askCmd = &cobra.Command{
+	Use:   "ask",
+	Short: "Send an ad-hoc question to the configured LLM",
+	Long: `Ask sends a prompt to the configured LLM provider and prints the response.
+The prompt is taken from --prompt or read from stdin. No cluster access is
+needed; the provider, model and API key are configured as for diagnose.
+
+By default the Kubernetes troubleshooting system prompt is sent with the
+question; use --system-prompt to replace it or --no-system-prompt to send
+the prompt as-is. --temperature, --top-p and --max-output-tokens tune the
+sampling, e.g. --temperature 0 for repeatable answers in scripts.`,
+	Example: `  # Ask a follow-up question
+  kubehelp ask --prompt "Why would a pod stay in ContainerCreating?"
+
+  # Pipe a manifest or log excerpt
+  kubectl get deploy api -o yaml | kubehelp ask --llm gemini
+
+  # Use kubehelp as a plain multi-provider LLM CLI
+  echo "Summarize RFC 7231 in one sentence" | kubehelp ask --no-system-prompt
+
+  # Machine-readable output
+  kubehelp ask --prompt "What is a PodDisruptionBudget?" --output json | jq -r .response`,
+	Args: cobra.NoArgs,
+	RunE: runAsk,
+}
+
+// AskResult is the --output json shape of ask
+type AskResult struct {
+	Provider  string   `json:"provider"`
+	Fallbacks []string `json:"fallbacks,omitempty"`
+	Response  string   `json:"response"`
+	// Usage is the token usage and estimated cost per provider
+	Usage []llm.Usage `json:"usage,omitempty"`
+}
+
+func init() {
+	askCmd.Flags().StringVarP(&askPrompt, "prompt", "p", "", "Prompt to send (default: read from stdin)")
+	askCmd.Flags().StringVar(&askLLMProvider, "llm", "ollama", "LLM provider: openai, gemini, ollama, vertexai or another of \"kubehelp providers list\"; a comma-separated list falls back to the next provider when one fails")
+	askCmd.Flags().StringVar(&askModel, "model", "", "LLM model to use (default: provider-specific env var or built-in default)")
+	askCmd.Flags().BoolVar(&askModelFallback, "model-fallback", false, "Fall back to a known-good model if the configured model is not found")
+	askCmd.Flags().BoolVar(&askNoSystemPrompt, "no-system-prompt", false, "Send the prompt without the Kubernetes troubleshooting system prompt")
+	askCmd.Flags().StringVar(&askSystemPrompt, "system-prompt", "", "System prompt replacing the Kubernetes troubleshooting system prompt")
+	addGenerationFlags(askCmd.Flags())
+	askCmd.Flags().StringVarP(&askOutput, "output", "o", "text", "Output format: text or json")
+}
+
+func runAsk(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	if askOutput != "text" && askOutput != "json" {
+		return fmt.Errorf("invalid output format %q (expected text or json)", askOutput)
+	}
+	if askNoSystemPrompt && askSystemPrompt != "" {
+		return fmt.Errorf("--system-prompt and --no-system-prompt are mutually exclusive")
+	}
+	generation, err := generationSettings(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	prompt := askPrompt
+	if prompt == "" {
+		raw, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to read prompt from stdin: %w", err)
+		}
+		prompt = string(raw)
+	}
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return fmt.Errorf("no prompt given; use --prompt or pipe it on stdin")
+	}
+
+	provider, err := createProviders(askLLMProvider, providerOptions{
+		Model:         askModel,
+		ModelFallback: askModelFallback,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx = withGeneration(ctx, generation, askSystemPrompt)
+	if askNoSystemPrompt {
+		ctx = llm.WithSystemPrompt(ctx, "")
+	}
+
+	ctx, tracker := llm.WithUsageTracker(ctx)
+	response, err := provider.Analyze(ctx, prompt)
+	if err != nil {
+		return fmt.Errorf("LLM request failed: %w", err)
+	}
+	fallbacks := noteFallbacks(provider)
+	usage := tracker.Usage()
+
+	if askOutput == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(AskResult{Provider: provider.Name(), Fallbacks: fallbacks, Response: response, Usage: usage})
+	}
+	fmt.Println(response)
+	printUsage(usage)
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"kubehelp/internal/cache"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+
+	"k8s.io/client-go/util/homedir"
+)
+
+// analysisCacheDir is where analyses are cached across runs
+func analysisCacheDir() string {
+	return filepath.Join(homedir.HomeDir(), ".kubehelp", "cache")
+}
+
+// openAnalysisCache returns the analysis cache and the key of analyzing data
+// with the --llm providers, the flags shaping the prompt, the
+// --prompt-template, if any, and the generation settings, or a nil cache
+// when caching is disabled. A cache that cannot be opened is reported and
+// skipped.
+func openAnalysisCache(data *k8s.DiagnosticData, providers []string, promptTemplate *llm.PromptTemplate, generation llm.Generation) (*cache.Cache, string) {
+	if diagNoCache || diagCacheTTL <= 0 {
+		return nil, ""
+	}
+
+	// --model applies to the first provider only, like in createProviders
+	var models string
+	for i, name := range providers {
+		override := ""
+		if i == 0 {
+			override = diagModel
+		}
+		models += name + "/" + providerModel(name, override) + ","
+	}
+	options := []string{
+		"compact=" + strconv.FormatBool(diagCompact),
+		"detail-level=" + diagDetailLevel,
+		"max-prompt-tokens=" + strconv.Itoa(diagMaxPromptTokens),
+		"language=" + diagLanguage,
+		"structured=" + strconv.FormatBool(diagStructured),
+		"generation=" + generation.String(),
+		"system-prompt=" + diagSystemPrompt,
+	}
+	if promptTemplate != nil {
+		options = append(options, "prompt-template="+promptTemplate.Source())
+	}
+	key, err := cache.Key(data, diagLLMProvider, models, options...)
+	if err == nil {
+		var c *cache.Cache
+		if c, err = cache.New(analysisCacheDir(), diagCacheTTL); err == nil {
+			return c, key
+		}
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  Analysis cache disabled: %v\n\n", err)
+	return nil, ""
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"kubehelp/internal/anonymize"
+	"kubehelp/internal/llm"
+	"kubehelp/internal/redact"
+
+	"github.com/spf13/cobra"
+)
+
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "Diagnose a namespace, then ask follow-up questions",
+	Long: `Chat runs a diagnosis like diagnose and keeps the conversation open, so
+follow-up questions are answered with the collected data and the earlier
+answers as context. Type exit or press Ctrl-D to quit.
+
+Chat accepts every diagnose flag; diagnose --chat is equivalent. Questions
+are redacted and, with --anonymize, have known names replaced before they
+are sent, like the diagnostic data.`,
+	Example: `  # Diagnose, then ask about individual resources
+  kubehelp chat -n production
+  > why is pod api-7d8f9b pending?
+  > show me the events for that PVC
+
+  # Follow up on a diagnosis with logs
+  kubehelp diagnose -n staging --logs --chat`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		diagChat = true
+		return runDiagnose(cmd, args)
+	},
+}
+
+// chatSession is a conversation that starts with the diagnostic prompt and
+// its analysis, so every follow-up question is answered in that context
+type chatSession struct {
+	provider llm.Provider
+	messages []llm.Message
+	// anonymizer is nil unless --anonymize is set
+	anonymizer *anonymize.Anonymizer
+	redactor   *redact.Redactor
+}
+
+// run reads questions from in until EOF or "exit" and prints each reply.
+// A failed question is reported and dropped from the conversation.
+func (s *chatSession) run(ctx context.Context, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintln(os.Stderr, "\n💬 Ask a follow-up question (exit or Ctrl-D to quit)")
+	for {
+		fmt.Fprint(os.Stderr, "\n> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(os.Stderr)
+			return scanner.Err()
+		}
+		question := strings.TrimSpace(scanner.Text())
+		switch question {
+		case "":
+			continue
+		case "exit", "quit":
+			return nil
+		}
+
+		// Questions may name resources or paste secrets just like the data
+		question = s.redactor.String(question)
+		if s.anonymizer != nil {
+			question = s.anonymizer.Replace(question)
+		}
+
+		s.messages = append(s.messages, llm.Message{Role: llm.RoleUser, Content: question})
+		reply, err := s.provider.Chat(ctx, s.messages)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.messages = s.messages[:len(s.messages)-1]
+			fmt.Fprintf(os.Stderr, "⚠️  %v\n", err)
+			continue
+		}
+		s.messages = append(s.messages, llm.Message{Role: llm.RoleAssistant, Content: reply})
+		noteFallbacks(s.provider)
+
+		fmt.Println()
+		if s.anonymizer != nil {
+			fmt.Println(s.anonymizer.Restore(reply))
+		} else {
+			fmt.Println(reply)
+		}
+	}
+}
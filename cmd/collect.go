@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/redact"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var collectOutput string
+
+var collectCmd = &cobra.Command{
+	Use:   "collect",
+	Short: "Collect diagnostic data into a snapshot file without an LLM",
+	Long: `Collect gathers the same diagnostic data as diagnose and writes it as a
+versioned JSON snapshot instead of analyzing it, so data from an air-gapped
+cluster can be carried elsewhere and analyzed with "diagnose --from-file".
+
+Snapshots carry a schemaVersion; diagnose migrates older versions and
+rejects snapshots from a newer kubehelp. Secrets are redacted per --redact
+before the snapshot is written, as they would be before an analysis.
+Collect accepts the diagnose flags that apply to collection.`,
+	Example: `  # Export a namespace on a machine with cluster access
+  kubehelp collect -n payments --logs -o snapshot.json
+
+  # Analyze it on a machine with LLM access
+  kubehelp diagnose --from-file snapshot.json --llm gemini
+
+  # Stream the snapshot over ssh
+  kubehelp collect -n payments | ssh analyst kubehelp diagnose --from-file -
+
+  # Convert a support bundle into a snapshot
+  kubehelp collect -n payments --bundle must-gather.tar.gz -o snapshot.json`,
+	Args: cobra.NoArgs,
+	RunE: runCollect,
+}
+
+// collectFlags are the diagnose flags that apply to collection, besides
+// the kubectl connection flags
+var collectFlags = map[string]bool{
+	"all-namespaces":        true,
+	"namespace-concurrency": true,
+	"all-contexts":          true,
+	"workload":              true,
+	"selector":              true,
+	"quiet":                 true,
+	"logs":                  true,
+	"log-lines":             true,
+	"log-concurrency":       true,
+	"log-keywords":          true,
+	"env":                   true,
+	"env-allow":             true,
+	"env-deny":              true,
+	"nodes":                 true,
+	"custom-resource":       true,
+	"probe-connectivity":    true,
+	"probe-image":           true,
+	"cluster-domain":        true,
+	"events-since":          true,
+	"include-spec":          true,
+	"best-practices":        true,
+	"bundle":                true,
+	"redact":                true,
+	"redact-pattern":        true,
+	"k8s-timeout":           true,
+	"timeout":               true,
+	"no-preflight":          true,
+}
+
+func init() {
+	collectCmd.Flags().StringVarP(&collectOutput, "output", "o", k8s.StdioPath, `File to write the snapshot to ("-": stdout)`)
+}
+
+// addCollectFlags adds the kubectl connection flags and the collection
+// flags of diagnose to collect
+func addCollectFlags() {
+	kube := pflag.NewFlagSet("kube", pflag.ContinueOnError)
+	kubeFlags.AddFlags(kube)
+	diagnoseCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if collectFlags[f.Name] || kube.Lookup(f.Name) != nil {
+			collectCmd.Flags().AddFlag(f)
+		}
+	})
+}
+
+func runCollect(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if diagTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, diagTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := collect(ctx)
+	return contextError(err, time.Since(start))
+}
+
+func collect(ctx context.Context) error {
+	resolveNamespace()
+	if _, err := labels.Parse(diagSelector); err != nil {
+		return fmt.Errorf("invalid --selector: %w", err)
+	}
+	if _, err := k8s.ParseCustomResources(diagCustomResources); err != nil {
+		return fmt.Errorf("invalid --custom-resource: %w", err)
+	}
+	if diagAllNamespaces && diagBundle != "" {
+		return fmt.Errorf("--all-namespaces requires live cluster access and cannot be combined with --bundle")
+	}
+	if diagProbeConnectivity && diagBundle != "" {
+		return fmt.Errorf("--probe-connectivity requires live cluster access and cannot be combined with --bundle")
+	}
+	if diagAllNamespaces && strings.Contains(diagNamespace, ",") {
+		return fmt.Errorf("--all-namespaces cannot be combined with a namespace list")
+	}
+	if diagBundle != "" && strings.Contains(diagNamespace, ",") {
+		return fmt.Errorf("--bundle reads a single namespace")
+	}
+	if diagAllContexts && diagContext != "" {
+		return fmt.Errorf("--all-contexts cannot be combined with --context")
+	}
+	contexts, err := kubeContexts()
+	if err != nil {
+		return err
+	}
+	if len(contexts) > 1 && diagBundle != "" {
+		return fmt.Errorf("multiple contexts require live cluster access and cannot be combined with --bundle")
+	}
+	redactLevel, err := redact.ParseLevel(diagRedact)
+	if err != nil {
+		return fmt.Errorf("invalid --redact: %w", err)
+	}
+	redactor, err := redact.New(redactLevel, diagRedactPatterns)
+	if err != nil {
+		return err
+	}
+
+	var data *k8s.DiagnosticData
+	if diagBundle != "" {
+		progressf("📦 Reading namespace '%s' from support bundle %s...\n", diagNamespace, diagBundle)
+		data, err = k8s.LoadBundle(diagBundle, diagNamespace, diagWorkloads, aggregatorOptions())
+		if err != nil {
+			return fmt.Errorf("failed to load support bundle: %w", err)
+		}
+	} else if data, err = collectDiagnostics(ctx, contexts); err != nil {
+		return err
+	}
+
+	var pods, events int
+	warnings := data.Warnings
+	for _, cluster := range data.ClusterData() {
+		pods += len(cluster.Pods)
+		events += len(cluster.Events)
+		if cluster != data {
+			warnings = append(warnings, cluster.Warnings...)
+		}
+	}
+	progressf("✅ Collected data: %d pods, %d events\n\n", pods, events)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n\n", w)
+	}
+
+	redacted, err := redactor.Apply(data)
+	if err != nil {
+		return err
+	}
+	if err := k8s.SaveDiagnosticData(collectOutput, redacted); err != nil {
+		return err
+	}
+	if collectOutput != k8s.StdioPath {
+		progressf("💾 Saved diagnostic data to %s (schema %s)\n", collectOutput, redacted.SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"kubehelp/internal/anonymize"
+	"kubehelp/internal/i18n"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+	"kubehelp/internal/redact"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare BASELINE TARGET",
+	Short: "Explain why one namespace or snapshot behaves differently from another",
+	Long: `Compare collects two namespaces, or loads snapshots saved with
+"diagnose --save", diffs their workloads, images, env vars, Services,
+NetworkPolicies, Warning events and findings, and asks the LLM which
+differences explain why the target misbehaves while the baseline works.
+
+Each side is a snapshot file when the path exists, else a namespace given as
+NAMESPACE or CONTEXT/NAMESPACE; without a context, --context or the current
+context is used. Pods are compared per workload, so differing pod names do
+not count as differences. Compare accepts the diagnose flags that apply to
+collection and analysis; with --llm none it prints the diff only.`,
+	Example: `  # Staging works, prod doesn't
+  kubehelp compare staging-eu/payments prod-eu/payments
+
+  # Two namespaces of the current context
+  kubehelp compare payments-blue payments-green --llm gemini
+
+  # A snapshot from before the incident against the live namespace
+  kubehelp compare before.json payments
+
+  # The structured diff only, as JSON
+  kubehelp compare before.json after.json --llm none -o json`,
+	Args: cobra.ExactArgs(2),
+	RunE: runCompare,
+}
+
+// CompareResult is the --output json|yaml shape of compare
+type CompareResult struct {
+	Provider  string   `json:"provider"`
+	Fallbacks []string `json:"fallbacks,omitempty"`
+	// Analysis is the markdown analysis, the rendered diff with --llm none
+	Analysis   string          `json:"analysis"`
+	Comparison *k8s.Comparison `json:"comparison"`
+	// Usage is the token usage and estimated cost per provider
+	Usage []llm.Usage `json:"usage,omitempty"`
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if diagTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, diagTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := compare(ctx, cmd, args[0], args[1])
+	return contextError(err, time.Since(start))
+}
+
+func compare(ctx context.Context, cmd *cobra.Command, baselineArg, targetArg string) error {
+	if err := applyProfile(cmd.Flags()); err != nil {
+		return err
+	}
+
+	if !slices.Contains(outputFormats, diagOutput) {
+		return fmt.Errorf("invalid output format %q (expected %s)", diagOutput, strings.Join(outputFormats, ", "))
+	}
+	switch {
+	case diagFromFile != "" || diagBundle != "":
+		return fmt.Errorf("compare takes snapshot files as arguments and cannot be combined with --from-file or --bundle")
+	case diagAllNamespaces || diagAllContexts || strings.Contains(diagContext, ",") || strings.Contains(diagNamespace, ","):
+		return fmt.Errorf("compare collects a single namespace and context per side; give them as CONTEXT/NAMESPACE")
+	case diagChat || diagShare || diagCreateIssue || diagEmitEvents || diagStructured || diagPromptTemplate != "":
+		return fmt.Errorf("--chat, --share, --create-issue, --emit-events, --structured and --prompt-template are not supported by compare")
+	}
+	if _, err := k8s.ParseCustomResources(diagCustomResources); err != nil {
+		return fmt.Errorf("invalid --custom-resource: %w", err)
+	}
+	ruleOnly := diagLLMProvider == providerNone
+	if !ruleOnly {
+		if _, err := parseProviders(diagLLMProvider); err != nil {
+			return err
+		}
+	}
+	detailLevel, err := llm.ParseDetailLevel(diagDetailLevel)
+	if err != nil {
+		return err
+	}
+	generation, err := generationSettings(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	ctx = withGeneration(ctx, generation, diagSystemPrompt)
+	redactLevel, err := redact.ParseLevel(diagRedact)
+	if err != nil {
+		return fmt.Errorf("invalid --redact: %w", err)
+	}
+	redactor, err := redact.New(redactLevel, diagRedactPatterns)
+	if err != nil {
+		return err
+	}
+
+	baseline, err := loadCompareSide(ctx, baselineArg)
+	if err != nil {
+		return err
+	}
+	target, err := loadCompareSide(ctx, targetArg)
+	if err != nil {
+		return err
+	}
+	for _, w := range append(append([]string{}, baseline.Warnings...), target.Warnings...) {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n\n", w)
+	}
+
+	return explainComparison(ctx, baseline, target, baselineArg, targetArg, redactor, detailLevel, comparisonKind{
+		diff:    k8s.Compare,
+		prompt:  llm.BuildComparePrompt,
+		compact: llm.BuildCompactComparePrompt,
+	})
+}
+
+// comparisonKind selects how explainComparison diffs two collections and
+// builds its verbose and compact prompts
+type comparisonKind struct {
+	diff    func(baseline, target *k8s.DiagnosticData, baselineLabel, targetLabel string) *k8s.Comparison
+	prompt  func(baseline, target *k8s.DiagnosticData, diff *k8s.Comparison, opts llm.PromptOptions) string
+	compact func(baseline, target *k8s.DiagnosticData, diff *k8s.Comparison) string
+}
+
+// explainComparison redacts and, with --anonymize, anonymizes both sides,
+// diffs them, asks the LLM about the differences unless --llm none and
+// writes the result. It is shared by compare and diff.
+func explainComparison(ctx context.Context, baseline, target *k8s.DiagnosticData, baselineLabel, targetLabel string,
+	redactor *redact.Redactor, detailLevel llm.DetailLevel, kind comparisonKind) error {
+	// Scrub secrets and replace resource names before anything leaves the
+	// machine. One anonymizer keeps the pseudonyms of both sides consistent.
+	var anonymizer *anonymize.Anonymizer
+	if diagAnonymize {
+		anonymizer = anonymize.New()
+	}
+	sides := []*k8s.DiagnosticData{baseline, target}
+	var err error
+	for i, data := range sides {
+		if sides[i], err = redactor.Apply(data); err != nil {
+			return err
+		}
+		if anonymizer != nil {
+			if sides[i], err = anonymizer.Apply(sides[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if anonymizer != nil {
+		printMapping(anonymizer.Mapping())
+	}
+
+	diff := kind.diff(sides[0], sides[1], baselineLabel, targetLabel)
+	progressf("🔀 %d differences, %d findings only in %s, %d only in %s\n\n",
+		len(diff.Differences), len(diff.NewFindings), targetLabel, len(diff.ResolvedFindings), baselineLabel)
+
+	var prompt string
+	if diagCompact {
+		prompt = kind.compact(sides[0], sides[1], diff)
+	} else {
+		prompt = kind.prompt(sides[0], sides[1], diff, llm.PromptOptions{DetailLevel: detailLevel})
+	}
+	prompt = llm.WithLanguage(prompt, diagLanguage)
+	if diagVerboseOutput != "" {
+		if err := os.WriteFile(diagVerboseOutput, []byte(prompt), 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", diagVerboseOutput, err)
+		}
+		progressf("📝 Wrote the comparison prompt to %s\n\n", diagVerboseOutput)
+	} else if diagVerbose {
+		fmt.Fprintln(os.Stderr, "=== Raw Comparison Data ===")
+		fmt.Fprintln(os.Stderr, prompt)
+		fmt.Fprintf(os.Stderr, "=== End Raw Data (~%d tokens) ===\n\n", llm.EstimateTokens(prompt))
+	}
+
+	result := CompareResult{Provider: providerNone, Comparison: diff}
+	if diagLLMProvider == providerNone {
+		progressf("📏 Skipping LLM analysis (--llm none)\n\n")
+		result.Analysis = llm.ComparisonReport(diff)
+	} else {
+		provider, err := createProviders(diagLLMProvider, providerOptions{
+			Model:          diagModel,
+			ModelFallback:  diagModelFallback,
+			MaxInputTokens: diagMaxTokens,
+			MaxCost:        diagMaxCost,
+			Force:          diagForce,
+		})
+		if err != nil {
+			return err
+		}
+
+		var tracker *llm.UsageTracker
+		ctx, tracker = llm.WithUsageTracker(ctx)
+		progressf("🤖 Comparing with %s...\n\n", providerLabel(provider))
+		analysis, err := provider.Analyze(ctx, prompt)
+		if err != nil {
+			var budgetErr *llm.BudgetExceededError
+			if errors.As(err, &budgetErr) {
+				return fmt.Errorf("%w; use --compact or --workload to shrink the prompt, or --force to send it anyway", err)
+			}
+			return fmt.Errorf("LLM analysis failed: %w", err)
+		}
+		result.Provider = provider.Name()
+		result.Fallbacks = noteFallbacks(provider)
+		result.Analysis = analysis
+		result.Usage = tracker.Usage()
+	}
+	if anonymizer != nil {
+		result.Analysis = anonymizer.Restore(result.Analysis)
+	}
+
+	msg := i18n.For(diagLanguage)
+	if diagOutput == outputText {
+		progressf("%s\n", msg.AnalysisBanner)
+	}
+	if err := writeCompareResult(os.Stdout, diagOutput, result); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if diagOutput == outputText {
+		progressf("%s\n", msg.EndAnalysisBanner)
+	}
+	printUsage(result.Usage)
+	return nil
+}
+
+// loadCompareSide loads one side of a comparison: the snapshot at arg when
+// the file exists, else the namespace arg names as NAMESPACE or
+// CONTEXT/NAMESPACE, collected live
+func loadCompareSide(ctx context.Context, arg string) (*k8s.DiagnosticData, error) {
+	if _, err := os.Stat(arg); err == nil {
+		data, err := k8s.LoadDiagnosticData(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(data.Clusters) > 0 {
+			return nil, fmt.Errorf("%s holds several clusters; compare one cluster at a time", arg)
+		}
+		progressf("📂 Loaded diagnostic data from %s (namespace '%s')\n", arg, data.Namespace)
+		return data, nil
+	}
+
+	// Namespaces cannot contain "/", while context names such as EKS ARNs can
+	var kubeContext string
+	namespace := arg
+	if i := strings.LastIndex(arg, "/"); i >= 0 {
+		kubeContext, namespace = arg[:i], arg[i+1:]
+	}
+	if namespace == "" || strings.HasSuffix(namespace, ".json") {
+		return nil, fmt.Errorf("%s is neither a snapshot file nor a namespace", arg)
+	}
+
+	progressf("🔍 Collecting diagnostic data from %s...\n", arg)
+	progress := newProgressLine()
+	var onProgress func(k8s.Progress)
+	if !diagQuiet {
+		onProgress = progress.update
+	}
+	data, err := collectCluster(ctx, kubeContext, namespace, onProgress)
+	progress.done()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", arg, err)
+	}
+	progressf("✅ Collected %s: %d pods, %d events\n\n", arg, len(data.Pods), len(data.Events))
+	return data, nil
+}
+
+// writeCompareResult writes result to w in format; text prints only the
+// analysis and markdown adds the structured diff
+func writeCompareResult(w io.Writer, format string, result CompareResult) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	case outputYAML:
+		out, err := yaml.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to encode result as YAML: %w", err)
+		}
+		_, err = w.Write(out)
+		return err
+	case outputMarkdown:
+		report := llm.ComparisonReport(result.Comparison)
+		if result.Provider != providerNone {
+			report += "\n\n## " + i18n.For(diagLanguage).Analysis + "\n\n" + strings.TrimSpace(result.Analysis)
+		}
+		_, err := fmt.Fprintln(w, report)
+		return err
+	}
+	_, err := fmt.Fprintln(w, result.Analysis)
+	return err
+}
@@ -2,23 +2,94 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"kubehelp/internal/analyzer"
+	"kubehelp/internal/anonymize"
+	"kubehelp/internal/cache"
+	"kubehelp/internal/config"
+	"kubehelp/internal/history"
+	"kubehelp/internal/i18n"
 	"kubehelp/internal/k8s"
 	"kubehelp/internal/llm"
+	"kubehelp/internal/redact"
+	"kubehelp/internal/share"
+	"kubehelp/internal/tracker"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 var (
-	diagNamespace   string
-	diagWorkloads   []string
-	diagVerbose     bool
-	diagLLMProvider string
-	diagKubeconfig  string
-	diagContext     string
+	diagNamespace            string
+	diagWorkloads            []string
+	diagVerbose              bool
+	diagLLMProvider          string
+	diagKubeconfig           string
+	diagContext              string
+	diagCompact              bool
+	diagPromptTemplate       string
+	diagModelFallback        bool
+	diagSave                 string
+	diagFromFile             string
+	diagLogs                 bool
+	diagLogConcurrency       int
+	diagLogLines             int64
+	diagSelector             string
+	diagBestPractices        bool
+	diagLogKeywords          []string
+	diagShare                bool
+	diagCreateIssue          bool
+	diagBundle               string
+	diagQuiet                bool
+	diagMaxTokens            int
+	diagSystemPrompt         string
+	diagMaxPromptTokens      int
+	diagMaxCost              float64
+	diagForce                bool
+	diagEmitEvents           bool
+	diagLanguage             string
+	diagAnonymize            bool
+	diagRedact               string
+	diagRedactPatterns       []string
+	diagDetailLevel          string
+	diagProfile              string
+	diagModel                string
+	diagTimeout              time.Duration
+	diagOllamaPreload        bool
+	diagK8sTimeout           time.Duration
+	diagVerboseOutput        string
+	diagEnv                  bool
+	diagEnvAllow             []string
+	diagEnvDeny              []string
+	diagAllNamespaces        bool
+	diagAllContexts          bool
+	diagNodes                bool
+	diagCustomResources      []string
+	diagProbeConnectivity    bool
+	diagProbeImage           string
+	diagClusterDomain        string
+	diagEventsSince          time.Duration
+	diagIncludeSpec          bool
+	diagChat                 bool
+	diagOutput               string
+	diagNamespaceConcurrency int
+	diagNoHistory            bool
+	diagStructured           bool
+	diagNoPreflight          bool
+	diagNoCache              bool
+	diagCacheTTL             time.Duration
 )
 
 var diagnoseCmd = &cobra.Command{
@@ -31,7 +102,7 @@ The command gathers pod status, container states, and recent events, then
 sends this information to an LLM for analysis.
 
 Environment variables:
-  KUBEHELP_LLM_PROVIDER - LLM provider (openai, gemini, ollama, vertexai)
+  KUBEHELP_LLM_PROVIDER - LLM provider (openai, gemini, ollama, vertexai, none)
   KUBEHELP_API_KEY      - API key for cloud LLM providers
   GEMINI_API_KEY        - Google Gemini API key
   GEMINI_MODEL          - Gemini model to use (default: gemini-pro)
@@ -40,6 +111,18 @@ Environment variables:
   VERTEX_AI_PROJECT_ID  - GCP project ID for Vertex AI
   VERTEX_AI_LOCATION    - Vertex AI location (default: us-central1)
   VERTEX_AI_MODEL       - Vertex AI model (default: gemini-pro)
+  VERTEX_AI_TEMPERATURE - Vertex AI sampling temperature (default: 0.7)
+  VERTEX_AI_MAX_OUTPUT_TOKENS - Vertex AI response length limit (default: 2048)
+  GEMINI_FALLBACK_MODELS - Fallback models for --model-fallback (also OPENAI_,
+                          VERTEX_AI_ and OLLAMA_FALLBACK_MODELS)
+  KUBEHELP_SHARE_BACKEND - Paste backend for --share: gist (default) or http
+  KUBEHELP_GIST_TOKEN   - GitHub token with gist scope (or GITHUB_TOKEN)
+  KUBEHELP_SHARE_URL    - Endpoint for the http share backend
+  KUBEHELP_CONFIG       - Config file with profiles (default: ~/.kubehelp/config.yaml)
+  KUBEHELP_PROFILE      - Default profile name
+  LLM_LANGUAGE          - Default language for the analysis (e.g. es, ja)
+  KUBEHELP_SERVER       - kubehelp server URL for --server
+  KUBEHELP_API_TOKEN    - Bearer token sent to the kubehelp server
   KUBECONFIG            - Path to kubeconfig file`,
 	Example: `  # Analyze entire namespace
   kubehelp diagnose -n production
@@ -47,6 +130,15 @@ Environment variables:
   # Focus on specific workloads
   kubehelp diagnose -n staging -w api-server,worker
 
+  # Select pods by label
+  kubehelp diagnose -n staging -l app=checkout
+
+  # Diagnose the whole cluster, 16 namespaces at a time
+  kubehelp diagnose -A --namespace-concurrency 16 --compact
+
+  # Compare a healthy cluster with a broken one
+  kubehelp diagnose -n payments --context prod-eu,prod-us
+
   # Use Ollama (local, no API key needed)
   kubehelp diagnose -n dev --llm ollama
 
@@ -56,118 +148,940 @@ Environment variables:
   # Use Google Vertex AI
   kubehelp diagnose -n prod --llm vertexai
 
+  # Rule-based analysis only, without an LLM
+  kubehelp diagnose -n prod --llm none
+
   # Use custom Ollama model
   OLLAMA_MODEL=mistral kubehelp diagnose -n prod
 
   # Show verbose diagnostic data
-  kubehelp diagnose -n prod --verbose`,
+  kubehelp diagnose -n prod --verbose
+
+  # Keep the raw prompt (or DiagnosticData JSON) next to the report
+  kubehelp diagnose -n prod --verbose-output prompt.md > report.md
+
+  # Use a token-minimal prompt for small local models (3B/7B, 4k context)
+  kubehelp diagnose -n dev --compact
+
+  # Save a snapshot and analyze it later (no cluster access needed)
+  kubehelp diagnose -n prod --save snapshot.json
+  kubehelp diagnose --from-file snapshot.json --llm gemini
+
+  # Write only the analysis to a file (progress goes to stderr)
+  kubehelp diagnose -n prod -q > report.md
+
+  # Store the analysis and raw data as a CI artifact
+  kubehelp diagnose -n prod -q -o json > kubehelp.json
+
+  # Refuse to send prompts over 20k tokens or $0.10 of input
+  kubehelp diagnose -n prod --llm openai --max-input-tokens 20000 --max-cost 0.10
+
+  # Confirm DNS and Service reachability from inside the namespace
+  kubehelp diagnose -n prod --probe-connectivity
+
+  # Record findings as events visible in "kubectl describe pod"
+  kubehelp diagnose -n prod --best-practices --emit-events
+
+  # Get the analysis in Spanish (diagnostic data stays in English)
+  kubehelp diagnose -n prod --language es
+
+  # Hide resource names from a cloud LLM (mapping printed locally)
+  kubehelp diagnose -n prod --llm gemini --anonymize
+
+  # Use the cluster and LLM settings of a named profile
+  kubehelp diagnose --profile prod -n payments
+
+  # Give up on slow clusters or local models after 5 minutes
+  kubehelp diagnose -n prod --timeout 5m
+
+  # Analyze a customer's must-gather without cluster credentials
+  kubehelp diagnose -n payments --bundle must-gather.tar.gz --logs
+
+  # Diagnose through a central kubehelp server, without cluster credentials
+  KUBEHELP_API_TOKEN=... kubehelp diagnose --server https://kubehelp.internal -n payments`,
 	RunE: runDiagnose,
 }
 
 func init() {
-	diagnoseCmd.Flags().StringVarP(&diagNamespace, "namespace", "n", "default", "Target namespace to diagnose")
-	diagnoseCmd.Flags().StringSliceVarP(&diagWorkloads, "workload", "w", []string{}, "Specific workloads to analyze (comma-separated)")
-	diagnoseCmd.Flags().BoolVar(&diagVerbose, "verbose", false, "Show raw diagnostic data before analysis")
-	diagnoseCmd.Flags().StringVar(&diagLLMProvider, "llm", "ollama", "LLM provider: openai, gemini, ollama, vertexai")
-	diagnoseCmd.Flags().StringVar(&diagKubeconfig, "kubeconfig", "", "Path to kubeconfig file (default: $KUBECONFIG or ~/.kube/config)")
-	diagnoseCmd.Flags().StringVar(&diagContext, "context", "", "Kubernetes context to use")
+	addKubeFlagsWithAPIServer(diagnoseCmd.Flags())
+	diagnoseCmd.Flags().Lookup("namespace").Usage = "Target namespace to diagnose, or a comma-separated list collected in parallel (default: the namespace of the kubeconfig context, else default)"
+	diagnoseCmd.Flags().Lookup("kubeconfig").Usage = "Path to kubeconfig file (default: $KUBECONFIG or ~/.kube/config)"
+	diagnoseCmd.Flags().Lookup("context").Usage = "Kubernetes context to use; a comma-separated list diagnoses several clusters in one run"
+	diagnoseCmd.Flags().BoolVarP(&diagAllNamespaces, "all-namespaces", "A", false, "Diagnose every namespace; namespaces that cannot be read are reported and skipped")
+	diagnoseCmd.Flags().IntVar(&diagNamespaceConcurrency, "namespace-concurrency", k8s.DefaultNamespaceConcurrency, "Maximum number of namespaces collected at once with --all-namespaces or a namespace list")
+	diagnoseCmd.Flags().StringSliceVarP(&diagWorkloads, "workload", "w", []string{}, "Specific workloads to analyze by name or kind/name, e.g. api,statefulset/db (comma-separated)")
+	diagnoseCmd.Flags().StringVarP(&diagSelector, "selector", "l", "", "Only diagnose pods matching this label selector, e.g. app=api,tier!=cache")
+	diagnoseCmd.Flags().BoolVar(&diagVerbose, "verbose", false, "Show raw diagnostic data before analysis (on stderr)")
+	diagnoseCmd.Flags().StringVar(&diagVerboseOutput, "verbose-output", "", "Write the raw prompt to this file instead of stderr, or the DiagnosticData JSON for a .json path (implies --verbose)")
+	diagnoseCmd.Flags().StringVarP(&diagOutput, "output", "o", outputText, "Output format: text, json, yaml (analysis plus DiagnosticData) or markdown (report with findings)")
+	diagnoseCmd.Flags().BoolVarP(&diagQuiet, "quiet", "q", false, "Suppress progress messages; print only the analysis")
+	diagnoseCmd.Flags().StringVar(&diagLLMProvider, "llm", "ollama", "LLM provider: openai, gemini, ollama, vertexai or another of \"kubehelp providers list\", or none for rule-based analysis only; a comma-separated list, e.g. openai,ollama, falls back to the next provider when one fails")
+	diagnoseCmd.Flags().StringVar(&diagProfile, "profile", os.Getenv("KUBEHELP_PROFILE"), "Named profile from the config file ($KUBEHELP_CONFIG or ~/.kubehelp/config.yaml); flags override its fields")
+	diagnoseCmd.Flags().StringVar(&diagModel, "model", "", "LLM model to use (default: provider-specific env var or built-in default)")
+	diagnoseCmd.Flags().BoolVar(&diagAllContexts, "all-contexts", false, "Diagnose the namespace in every kubeconfig context")
+	diagnoseCmd.Flags().StringVar(&diagLanguage, "language", llm.DefaultLanguage(), "Language for the analysis, e.g. es, ja, pt-BR (default: $LLM_LANGUAGE or English)")
+	diagnoseCmd.Flags().StringVar(&diagDetailLevel, "detail-level", string(llm.DetailIssuesOnly), "Container detail in the prompt: issues-only, all (include healthy pods) or minimal (summary and events only)")
+	diagnoseCmd.Flags().BoolVar(&diagStructured, "structured", false, "Ask the LLM for JSON issues with severity, root cause, remediation and kubectl commands; -o json|yaml include them as \"structured\"")
+	diagnoseCmd.Flags().BoolVar(&diagCompact, "compact", false, "Use a terse, token-minimal prompt for small-context models")
+	diagnoseCmd.Flags().StringVar(&diagPromptTemplate, "prompt-template", "", "Render the prompt from this Go text/template file over the diagnostic data instead of the built-in report (see kubehelp prompt-template)")
+	diagnoseCmd.Flags().StringVar(&diagSave, "save", "", "Save collected diagnostic data as JSON to this file")
+	diagnoseCmd.Flags().StringVar(&diagFromFile, "from-file", "", "Analyze diagnostic data saved with --save or kubehelp collect instead of querying the cluster (\"-\": stdin)")
+	diagnoseCmd.Flags().BoolVar(&diagLogs, "logs", false, "Include recent logs of unhealthy containers")
+	diagnoseCmd.Flags().Int64Var(&diagLogLines, "log-lines", 50, "Log lines kept per container with --logs")
+	diagnoseCmd.Flags().IntVar(&diagLogConcurrency, "log-concurrency", 5, "Maximum number of concurrent log requests")
+	diagnoseCmd.Flags().StringSliceVar(&diagLogKeywords, "log-keywords", nil, "Keywords marking relevant log lines kept when logs are truncated (default: error, exception, fatal, panic, ...)")
+	diagnoseCmd.Flags().BoolVar(&diagEnv, "env", false, "Include container env vars; values of secret-like names are redacted")
+	diagnoseCmd.Flags().StringSliceVar(&diagEnvAllow, "env-allow", nil, "Only include values of env vars matching these globs, e.g. LOG_*,*_URL (names are always included)")
+	diagnoseCmd.Flags().StringSliceVar(&diagEnvDeny, "env-deny", nil, "Redact values of env vars matching these globs (default: *SECRET*, *TOKEN*, *PASSWORD*, *_KEY, ...)")
+	diagnoseCmd.Flags().BoolVar(&diagNodes, "nodes", false, "Include node conditions, taints, requested vs allocatable resources and kubelet version skew (needs cluster-wide read access to nodes and pods)")
+	diagnoseCmd.Flags().StringSliceVar(&diagCustomResources, "custom-resource", nil, "Collect the status conditions of custom resources given as resource.version.group, e.g. applications.v1alpha1.argoproj.io,certificates.v1.cert-manager.io")
+	diagnoseCmd.Flags().BoolVar(&diagProbeConnectivity, "probe-connectivity", false, "Run a short-lived pod in namespaces with failures to look up and connect to their Services, confirming DNS and network causes (needs create and delete RBAC on pods)")
+	diagnoseCmd.Flags().StringVar(&diagProbeImage, "probe-image", k8s.DefaultProbeImage, "Image of the --probe-connectivity pod; it needs sh, nslookup and nc")
+	diagnoseCmd.Flags().StringVar(&diagClusterDomain, "cluster-domain", k8s.DefaultClusterDomain, "DNS domain of the cluster, used to look up Services with --probe-connectivity")
+	diagnoseCmd.Flags().DurationVar(&diagEventsSince, "events-since", k8s.DefaultEventsSince, "Collect warning events seen within this long, e.g. 6h; events older than the apiserver's --event-ttl (default 1h) are already gone")
+	diagnoseCmd.Flags().BoolVar(&diagIncludeSpec, "include-spec", false, "Include a summary of the specs of unhealthy pods: requests/limits, env var names, volumes, affinity, tolerations, service account and security context")
+	diagnoseCmd.Flags().BoolVar(&diagBestPractices, "best-practices", false, "Flag missing resource requests/limits, latest image tags and privileged/root containers")
+	diagnoseCmd.Flags().BoolVar(&diagAnonymize, "anonymize", false, "Replace namespace, pod, node, container and workload names with stable pseudonyms before analysis")
+	diagnoseCmd.Flags().StringVar(&diagRedact, "redact", "default", "Secret redaction before analysis: off, default (credential-like values) or strict (also all env values, emails and long keys)")
+	diagnoseCmd.Flags().StringArrayVar(&diagRedactPatterns, "redact-pattern", nil, "Additional regular expression whose matches are redacted before analysis (repeatable)")
+	diagnoseCmd.Flags().BoolVar(&diagShare, "share", false, "Upload the redacted report to the configured paste backend and print its URL")
+	diagnoseCmd.Flags().BoolVar(&diagCreateIssue, "create-issue", false, "File an issue with the severity, findings, analysis and redacted snapshot in the tracker configured by KUBEHELP_ISSUE_TRACKER (github, gitlab or jira)")
+	diagnoseCmd.Flags().BoolVar(&diagEmitEvents, "emit-events", false, "Record findings as Kubernetes Events on the affected pods (needs create RBAC on events)")
+	diagnoseCmd.Flags().StringVar(&diagBundle, "bundle", "", "Analyze a must-gather/support bundle directory or .tar(.gz) instead of the cluster")
+	diagnoseCmd.Flags().BoolVar(&diagModelFallback, "model-fallback", false, "Fall back to a known-good model if the configured model is not found")
+	diagnoseCmd.Flags().IntVar(&diagMaxTokens, "max-input-tokens", 0, "Refuse to call the LLM when the prompt exceeds this many estimated tokens (0: no limit)")
+	diagnoseCmd.Flags().IntVar(&diagMaxPromptTokens, "max-prompt-tokens", 0, "Shrink the prompt to about this many estimated tokens, summarizing healthy pods and trimming logs, events and low-severity findings first (0: no limit)")
+	diagnoseCmd.Flags().Float64Var(&diagMaxCost, "max-cost", 0, "Refuse to call the LLM when the estimated input cost exceeds this many USD (0: no limit)")
+	diagnoseCmd.Flags().BoolVar(&diagForce, "force", false, "Ignore --max-input-tokens and --max-cost")
+	addGenerationFlags(diagnoseCmd.Flags())
+	diagnoseCmd.Flags().StringVar(&diagSystemPrompt, "system-prompt", "", "System prompt replacing the built-in Kubernetes troubleshooting instructions")
+	diagnoseCmd.Flags().BoolVar(&diagOllamaPreload, "ollama-preload", false, "Load the Ollama model into memory while collecting data to avoid a cold start")
+	diagnoseCmd.Flags().DurationVar(&diagK8sTimeout, "k8s-timeout", k8s.DefaultAPITimeout, "Timeout for each Kubernetes API call, so a slow apiserver fails fast")
+	diagnoseCmd.Flags().DurationVar(&diagTimeout, "timeout", 0, "Abort the diagnosis after this long, e.g. 5m (0: no limit)")
+	diagnoseCmd.Flags().BoolVar(&diagChat, "chat", false, "Ask follow-up questions about the diagnosis interactively after the analysis")
+	diagnoseCmd.Flags().BoolVar(&diagNoPreflight, "no-preflight", false, "Do not check RBAC permissions before collecting (see kubehelp permissions)")
+	diagnoseCmd.Flags().BoolVar(&diagNoHistory, "no-history", false, "Do not record the diagnosis in the local history (see kubehelp history)")
+	diagnoseCmd.Flags().BoolVar(&diagNoCache, "no-cache", false, "Always call the LLM instead of reusing the cached analysis of unchanged diagnostic data")
+	diagnoseCmd.Flags().StringVar(&diagFailOn, "fail-on", failOnNone, "Exit with 2 when the run's severity is warning and 3 when critical, from this severity on: none, warning or critical (for CI gates)")
+	diagnoseCmd.Flags().StringVar(&diagServer, "server", os.Getenv("KUBEHELP_SERVER"), "Diagnose through the kubehelp server at this URL, which collects and analyzes with its own credentials (auth: $KUBEHELP_API_TOKEN; default: $KUBEHELP_SERVER)")
+	diagnoseCmd.Flags().DurationVar(&diagCacheTTL, "cache-ttl", cache.DefaultTTL, "How long analyses are cached in ~/.kubehelp/cache for unchanged diagnostic data (0: no caching)")
 }
 
 func runDiagnose(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	// Ctrl-C cancels in-flight cluster and LLM requests
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if diagTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, diagTimeout)
+		defer cancel()
+	}
 
-	// Create Kubernetes client
-	k8sClient, err := k8s.NewClient(diagKubeconfig, diagContext)
-	if err != nil {
-		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	start := time.Now()
+	if err := diagnose(ctx, cmd); err != nil {
+		return contextError(err, time.Since(start))
 	}
+	// Reaching --fail-on is a verdict, not a usage mistake
+	if err := failOnStatus(diagStatus); err != nil {
+		cmd.SilenceUsage = true
+		return err
+	}
+	return nil
+}
 
-	fmt.Printf("🔍 Collecting diagnostic data from namespace '%s'...\n", diagNamespace)
+// contextError replaces raw "context canceled"/"context deadline exceeded"
+// errors from deep in the stack with a message saying what happened
+func contextError(err error, elapsed time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case k8s.IsAPITimeout(err):
+		return fmt.Errorf("%w; the apiserver may be overloaded, retry or raise --k8s-timeout", err)
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("diagnosis cancelled")
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("diagnosis timed out after %s — try --timeout or a faster model: %w",
+			elapsed.Round(time.Second), err)
+	}
+	return err
+}
+
+func diagnose(ctx context.Context, cmd *cobra.Command) error {
+	start := time.Now()
+	diagStatus = analyzer.StatusOK
+	if err := validateFailOn(); err != nil {
+		return err
+	}
+	if diagServer != "" {
+		return diagnoseRemote(ctx, cmd)
+	}
+	if err := applyProfile(cmd.Flags()); err != nil {
+		return err
+	}
+	resolveNamespace()
 
-	// Create aggregator and collect data
-	aggregator := k8s.NewAggregator(k8sClient)
-	data, err := aggregator.CollectDiagnostics(ctx, diagNamespace, diagWorkloads)
+	if !slices.Contains(outputFormats, diagOutput) {
+		return fmt.Errorf("invalid output format %q (expected %s)", diagOutput, strings.Join(outputFormats, ", "))
+	}
+	if diagChat && diagOutput != outputText {
+		return fmt.Errorf("--chat requires --output text")
+	}
+	if diagChat && diagFromFile == k8s.StdioPath {
+		return fmt.Errorf("--chat reads questions from stdin and cannot be combined with --from-file -")
+	}
+	if _, err := labels.Parse(diagSelector); err != nil {
+		return fmt.Errorf("invalid --selector: %w", err)
+	}
+	if _, err := k8s.ParseCustomResources(diagCustomResources); err != nil {
+		return fmt.Errorf("invalid --custom-resource: %w", err)
+	}
+	if diagSelector != "" && diagFromFile != "" {
+		return fmt.Errorf("--selector applies at collection time and cannot be combined with --from-file")
+	}
+	if diagAllNamespaces && (diagFromFile != "" || diagBundle != "") {
+		return fmt.Errorf("--all-namespaces requires live cluster access and cannot be combined with --from-file or --bundle")
+	}
+	if diagAllNamespaces && strings.Contains(diagNamespace, ",") {
+		return fmt.Errorf("--all-namespaces cannot be combined with a namespace list")
+	}
+	if diagBundle != "" && strings.Contains(diagNamespace, ",") {
+		return fmt.Errorf("--bundle reads a single namespace")
+	}
+	if diagEmitEvents && (diagFromFile != "" || diagBundle != "") {
+		return fmt.Errorf("--emit-events requires live cluster access and cannot be combined with --from-file or --bundle")
+	}
+	if diagProbeConnectivity && (diagFromFile != "" || diagBundle != "") {
+		return fmt.Errorf("--probe-connectivity requires live cluster access and cannot be combined with --from-file or --bundle")
+	}
+	if diagAllContexts && diagContext != "" {
+		return fmt.Errorf("--all-contexts cannot be combined with --context")
+	}
+	contexts, err := kubeContexts()
+	if err != nil {
+		return err
+	}
+	if len(contexts) > 1 {
+		if diagFromFile != "" || diagBundle != "" {
+			return fmt.Errorf("multiple contexts require live cluster access and cannot be combined with --from-file or --bundle")
+		}
+		if diagEmitEvents {
+			return fmt.Errorf("--emit-events supports a single context")
+		}
+	}
+	// With --llm none, the rule-based diagnoses are the analysis
+	ruleOnly := diagLLMProvider == providerNone
+	var llmProviders []string
+	if ruleOnly {
+		if diagChat || diagStructured || diagShare {
+			return fmt.Errorf("--chat, --structured and --share need an LLM provider and cannot be combined with --llm none")
+		}
+	} else {
+		llmProviders, err = parseProviders(diagLLMProvider)
+		if err != nil {
+			return err
+		}
+	}
+	detailLevel, err := llm.ParseDetailLevel(diagDetailLevel)
+	if err != nil {
+		return err
+	}
+	generation, err := generationSettings(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	ctx = withGeneration(ctx, generation, diagSystemPrompt)
+	var promptTemplate *llm.PromptTemplate
+	if diagPromptTemplate != "" {
+		if diagCompact {
+			return fmt.Errorf("--prompt-template replaces the verbose prompt and cannot be combined with --compact")
+		}
+		if promptTemplate, err = llm.LoadPromptTemplate(diagPromptTemplate); err != nil {
+			return err
+		}
+	}
+	redactLevel, err := redact.ParseLevel(diagRedact)
+	if err != nil {
+		return fmt.Errorf("invalid --redact: %w", err)
+	}
+	redactor, err := redact.New(redactLevel, diagRedactPatterns)
 	if err != nil {
-		return fmt.Errorf("failed to collect diagnostics: %w", err)
+		return err
 	}
 
-	fmt.Printf("✅ Collected data: %d pods, %d events\n\n", len(data.Pods), len(data.Events))
+	if err := checkOllamaModel(ctx, llmProviders); err != nil {
+		return err
+	}
 
-	// Build diagnostic prompt
-	prompt := llm.BuildDiagnosticPrompt(data)
+	// Load the model while collecting so its cold start overlaps with the
+	// cluster queries instead of following them
+	var preload <-chan error
+	if diagOllamaPreload && slices.Contains(llmProviders, "ollama") {
+		preload = preloadOllama(ctx, diagModel)
+	}
 
-	// Show verbose output if requested
-	if diagVerbose {
-		fmt.Println("=== Raw Diagnostic Data ===")
-		fmt.Println(prompt)
-		fmt.Println("=== End Raw Data ===\n")
+	var data *k8s.DiagnosticData
+	if diagFromFile != "" {
+		// Offline analysis of a previously saved snapshot
+		loaded, err := k8s.LoadDiagnosticData(diagFromFile)
+		if err != nil {
+			return err
+		}
+		data = loaded
+		progressf("📂 Loaded diagnostic data from %s (namespace '%s')\n", diagFromFile, data.Namespace)
+	} else if diagBundle != "" {
+		// Offline analysis of a captured support bundle
+		progressf("📦 Reading namespace '%s' from support bundle %s...\n", diagNamespace, diagBundle)
+		loaded, err := k8s.LoadBundle(diagBundle, diagNamespace, diagWorkloads, aggregatorOptions())
+		if err != nil {
+			return fmt.Errorf("failed to load support bundle: %w", err)
+		}
+		data = loaded
+	} else {
+		collected, err := collectDiagnostics(ctx, contexts)
+		if err != nil {
+			return err
+		}
+		data = collected
+	}
+
+	var pods, events, findings int
+	warnings := data.Warnings
+	for _, cluster := range data.ClusterData() {
+		pods += len(cluster.Pods)
+		events += len(cluster.Events)
+		findings += len(cluster.Findings)
+		if cluster != data {
+			warnings = append(warnings, cluster.Warnings...)
+		}
+	}
+	progressf("✅ Collected data: %d pods, %d events\n", pods, events)
+	for _, ns := range data.Namespaces {
+		if ns.HasIssues() && ns.Skipped == "" {
+			progressf("   %s: %d of %d pods unhealthy, %d findings\n", ns.Name, ns.Unhealthy, ns.Pods, ns.Findings)
+		}
+	}
+	progressf("\n")
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n\n", w)
+	}
+	if findings > 0 {
+		progressf("📋 %d findings detected\n\n", findings)
+	}
+	diagnoses := analyzer.Analyze(data)
+	if len(diagnoses) > 0 {
+		progressf("🩺 %d known failure modes matched by rules\n\n", len(diagnoses))
+	}
+
+	if diagSave != "" {
+		if err := k8s.SaveDiagnosticData(diagSave, data); err != nil {
+			return err
+		}
+		progressf("💾 Saved diagnostic data to %s\n\n", diagSave)
 	}
 
-	// Get LLM provider configuration
-	apiKey := os.Getenv("KUBEHELP_API_KEY")
-	if apiKey == "" {
-		// Try provider-specific env vars
-		switch diagLLMProvider {
-		case "openai":
-			apiKey = os.Getenv("OPENAI_API_KEY")
-		case "anthropic":
-			apiKey = os.Getenv("ANTHROPIC_API_KEY")
-		case "gemini":
-			apiKey = os.Getenv("GEMINI_API_KEY")
+	// Scrub secrets and replace resource names before anything leaves the
+	// machine; the saved snapshot above keeps the original data
+	promptData, err := redactor.Apply(data)
+	if err != nil {
+		return err
+	}
+	var anonymizer *anonymize.Anonymizer
+	if diagAnonymize {
+		anonymizer = anonymize.New()
+		anonymized, err := anonymizer.Apply(promptData)
+		if err != nil {
+			return err
+		}
+		promptData = anonymized
+		printMapping(anonymizer.Mapping())
+	}
+
+	// Build diagnostic prompt, shrunk to --max-prompt-tokens for huge
+	// namespaces
+	var templateErr error
+	prompt, truncation, err := llm.FitPrompt(promptData, diagMaxPromptTokens, func(d *k8s.DiagnosticData) string {
+		switch {
+		case diagCompact:
+			return llm.BuildCompactPrompt(d)
+		case promptTemplate != nil:
+			built, err := promptTemplate.Build(d, llm.PromptOptions{DetailLevel: detailLevel})
+			if err != nil && templateErr == nil {
+				templateErr = err
+			}
+			return built
+		}
+		return llm.BuildDiagnosticPromptWithOptions(d, llm.PromptOptions{DetailLevel: detailLevel})
+	})
+	if err == nil {
+		err = templateErr
+	}
+	if err != nil {
+		return err
+	}
+	if truncation.Truncated() {
+		progressf("✂️  Shrunk the prompt from ~%d to ~%d tokens, leaving out:\n", truncation.OriginalTokens, truncation.Tokens)
+		for _, o := range truncation.Omitted {
+			progressf("   - %s\n", o)
 		}
+		progressf("\n")
+	}
+	if truncation.Tokens > diagMaxPromptTokens && diagMaxPromptTokens > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️  The prompt is still ~%d tokens, above --max-prompt-tokens %d; narrow it with --workload or --selector\n\n",
+			truncation.Tokens, diagMaxPromptTokens)
 	}
+	// Lead with the rule-based diagnoses so the model confirms or refutes
+	// them instead of rediscovering them
+	prompt = llm.WithLanguage(analyzer.Preamble(analyzer.Analyze(promptData))+prompt, diagLanguage)
 
-	// API key not required for Ollama (local) or VertexAI (uses ADC)
-	if apiKey == "" && diagLLMProvider != "ollama" && diagLLMProvider != "vertexai" {
-		return fmt.Errorf("API key not found. Set KUBEHELP_API_KEY or %s_API_KEY environment variable",
-			strings.ToUpper(diagLLMProvider))
+	// Show verbose output if requested
+	if diagVerboseOutput != "" {
+		if err := writeVerboseOutput(diagVerboseOutput, promptData, prompt); err != nil {
+			return err
+		}
+		progressf("📝 Wrote raw diagnostic data to %s\n\n", diagVerboseOutput)
+	} else if diagVerbose {
+		fmt.Fprintln(os.Stderr, "=== Raw Diagnostic Data ===")
+		fmt.Fprintln(os.Stderr, prompt)
+		fmt.Fprintf(os.Stderr, "=== End Raw Data (~%d tokens) ===\n\n", llm.EstimateTokens(prompt))
 	}
 
-	// Create LLM provider
 	var provider llm.Provider
-	switch diagLLMProvider {
-	case "openai":
-		provider = llm.NewOpenAIProvider(apiKey, "gpt-4")
-	case "gemini":
-		// Get model from env or use default
-		model := os.Getenv("GEMINI_MODEL")
-		if model == "" {
-			model = "gemini-pro" // default model
-		}
-		provider = llm.NewGeminiProvider(apiKey, model)
-	case "ollama":
-		// Get model and base URL from env or use defaults
-		model := os.Getenv("OLLAMA_MODEL")
-		if model == "" {
-			model = "mistral" // default model
-		}
-		baseURL := os.Getenv("OLLAMA_BASE_URL")
-		if baseURL == "" {
-			baseURL = "http://localhost:11434" // default Ollama URL
-		}
-		provider = llm.NewOllamaProvider(model, baseURL)
-	case "vertexai":
-		vertexProvider, err := llm.NewVertexAIProviderFromEnv()
+	var analysis string
+	var structured *llm.StructuredAnalysis
+	var fallbacks []string
+	var usage []llm.Usage
+	var cached bool
+	providerName := providerNone
+	if ruleOnly {
+		progressf("📏 Skipping LLM analysis (--llm none)\n\n")
+		analysis = analyzer.Report(diagnoses)
+	} else {
+		// Create LLM provider
+		provider, err = createProviders(diagLLMProvider, providerOptions{
+			Model:          diagModel,
+			ModelFallback:  diagModelFallback,
+			MaxInputTokens: diagMaxTokens,
+			MaxCost:        diagMaxCost,
+			Force:          diagForce,
+		})
+		if err != nil {
+			return err
+		}
+
+		if preload != nil {
+			if err := <-preload; err != nil {
+				var notPulled *llm.ModelNotPulledError
+				if errors.As(err, &notPulled) && !diagModelFallback && len(llmProviders) == 1 {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "⚠️  Ollama preload failed: %v\n\n", err)
+			}
+		}
+
+		// Record the tokens each provider reports, including follow-up
+		// questions in --chat
+		var tracker *llm.UsageTracker
+		ctx, tracker = llm.WithUsageTracker(ctx)
+
+		// Reuse the analysis of unchanged diagnostic data within --cache-ttl
+		analysisCache, cacheKey := openAnalysisCache(promptData, llmProviders, promptTemplate, generation)
+		var entry cache.Entry
+		if analysisCache != nil {
+			entry, cached = analysisCache.Get(cacheKey)
+		}
+		if cached {
+			progressf("♻️  Reusing the %s analysis cached %s ago (--no-cache to run it again)\n\n",
+				entry.Provider, time.Since(entry.CreatedAt).Round(time.Second))
+			analysis, structured, providerName = entry.Analysis, entry.Structured, entry.Provider
+		} else {
+			progressf("🤖 Analyzing with %s...\n\n", providerLabel(provider))
+
+			// Get analysis from LLM, as JSON issues with --structured, rendered as
+			// markdown for the text and markdown outputs
+			if diagStructured {
+				structured, _, err = llm.AnalyzeStructured(ctx, provider, prompt)
+				if structured != nil {
+					analysis = structured.Markdown()
+				}
+			} else {
+				analysis, err = provider.Analyze(ctx, prompt)
+			}
+			if err != nil {
+				var budgetErr *llm.BudgetExceededError
+				if errors.As(err, &budgetErr) {
+					return fmt.Errorf("%w; use --compact or --workload to shrink the prompt, or --force to send it anyway", err)
+				}
+				return fmt.Errorf("LLM analysis failed: %w", err)
+			}
+			fallbacks = noteFallbacks(provider)
+			providerName = provider.Name()
+			usage = tracker.Usage()
+
+			if analysisCache != nil {
+				if err := analysisCache.Put(cacheKey, cache.Entry{Provider: providerName, Analysis: analysis, Structured: structured}); err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  Failed to cache the analysis: %v\n\n", err)
+				}
+			}
+		}
+	}
+
+	// Display results; only the analysis itself, or the structured result
+	// for --output, goes to stdout so that redirected output is a clean
+	// report. Anonymized names are mapped back for local display.
+	result := DiagnoseResult{Provider: providerName, Fallbacks: fallbacks, Analysis: analysis, Structured: structured, PreAnalysis: diagnoses, Usage: usage, Cached: cached, Data: data}
+	if anonymizer != nil {
+		result.Analysis = anonymizer.Restore(analysis)
+		if structured != nil {
+			result.Structured = restoreStructured(anonymizer, structured)
+		}
+	}
+	result.Severity = resultStatus(result)
+	diagStatus = result.Severity
+	msg := i18n.For(diagLanguage)
+	if diagOutput == outputText {
+		progressf("%s\n", msg.AnalysisBanner)
+	}
+	if err := writeDiagnoseResult(os.Stdout, diagOutput, result); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if diagOutput == outputText {
+		progressf("%s\n", msg.EndAnalysisBanner)
+	}
+	progressf("🚦 %s: %s\n", msg.Severity, statusLabel(result.Severity))
+	printUsage(usage)
+
+	if !diagNoHistory {
+		recordDiagnosis(cmd.Flags(), history.Record{
+			Namespace:      data.Namespace,
+			Workloads:      data.Workloads,
+			Context:        data.ContextName,
+			Provider:       providerName,
+			Analysis:       result.Analysis,
+			DurationMs:     time.Since(start).Milliseconds(),
+			DiagnosticData: data,
+		})
+	}
+
+	// Event failures, including missing RBAC, only produce a warning
+	if diagEmitEvents {
+		if err := emitFindingEvents(ctx, data); err != nil {
+			fmt.Fprintf(os.Stderr, "\n⚠️  Skipped emitting events: %v\n", err)
+		}
+	}
+
+	// Upload failures are reported but never discard the local output
+	if diagShare {
+		url, err := shareReport(ctx, promptData, prompt, analysis, providerName)
 		if err != nil {
-			return fmt.Errorf("failed to create Vertex AI provider: %w", err)
+			fmt.Fprintf(os.Stderr, "\n⚠️  Failed to share report: %v\n", err)
+		} else {
+			// Always shown: the URL is what --share was asked for
+			fmt.Fprintf(os.Stderr, "\n🔗 Shared report: %s\n", url)
 		}
-		provider = vertexProvider
+	}
+
+	// Like --share, a failed issue never discards the local output
+	if diagCreateIssue {
+		url, err := createIssue(ctx, promptData, analysis, providerName, result.Severity)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\n⚠️  Failed to create issue: %v\n", err)
+		}
+		if url != "" {
+			fmt.Fprintf(os.Stderr, "\n🧾 Created issue: %s\n", url)
+		}
+	}
+
+	if diagChat {
+		session := &chatSession{
+			provider:   provider,
+			messages:   []llm.Message{{Role: llm.RoleUser, Content: prompt}, {Role: llm.RoleAssistant, Content: analysis}},
+			anonymizer: anonymizer,
+			redactor:   redactor,
+		}
+		return session.run(ctx, cmd.InOrStdin())
+	}
+
+	return nil
+}
+
+// restoreStructured maps anonymized names in a structured analysis back to
+// the real ones
+func restoreStructured(anonymizer *anonymize.Anonymizer, analysis *llm.StructuredAnalysis) *llm.StructuredAnalysis {
+	restored := *analysis
+	restored.Summary = anonymizer.Restore(analysis.Summary)
+	restored.Issues = make([]llm.Issue, len(analysis.Issues))
+	for i, issue := range analysis.Issues {
+		issue.Title = anonymizer.Restore(issue.Title)
+		issue.Resource = anonymizer.Restore(issue.Resource)
+		issue.RootCause = anonymizer.Restore(issue.RootCause)
+		issue.Remediation = restoreAll(anonymizer, issue.Remediation)
+		issue.KubectlCommands = restoreAll(anonymizer, issue.KubectlCommands)
+		restored.Issues[i] = issue
+	}
+	return &restored
+}
+
+func restoreAll(anonymizer *anonymize.Anonymizer, texts []string) []string {
+	out := make([]string, len(texts))
+	for i, text := range texts {
+		out[i] = anonymizer.Restore(text)
+	}
+	return out
+}
+
+// progressf writes an informational message to stderr unless --quiet is set.
+// Keeping progress off stdout lets "diagnose > report.md" capture only the
+// analysis.
+func progressf(format string, args ...interface{}) {
+	if diagQuiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// printMapping shows the pseudonyms used by --anonymize so that the
+// analysis can be related back to real resources
+func printMapping(entries []anonymize.Entry) {
+	fmt.Fprintln(os.Stderr, "🕶️  Anonymized names (kept locally, not sent to the LLM):")
+	for _, e := range entries {
+		fmt.Fprintf(os.Stderr, "   %-12s %-20s %s\n", e.Kind, e.Pseudonym, e.Original)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// shareReport uploads the redacted prompt, analysis and diagnostic data to
+// the paste backend configured via KUBEHELP_SHARE_BACKEND
+func shareReport(ctx context.Context, data *k8s.DiagnosticData, prompt, analysis, providerName string) (string, error) {
+	uploader, err := share.NewUploaderFromEnv()
+	if err != nil {
+		return "", err
+	}
+
+	rawData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode diagnostic data: %w", err)
+	}
+
+	msg := i18n.For(diagLanguage)
+	title := fmt.Sprintf(msg.ReportTitle, data.Namespace)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# %s\n\n", title))
+	sb.WriteString(fmt.Sprintf("%s: %s | %s: %s | %s: %s\n\n",
+		msg.Context, data.ContextName, msg.Collected, data.CollectedAt.Format(time.RFC3339), msg.Provider, providerName))
+	sb.WriteString("## " + msg.Analysis + "\n\n")
+	sb.WriteString(analysis)
+	sb.WriteString("\n\n## " + msg.Prompt + "\n\n")
+	sb.WriteString(prompt)
+	sb.WriteString("\n## " + msg.Data + "\n\n```json\n")
+	sb.Write(rawData)
+	sb.WriteString("\n```\n")
+
+	progressf("\n📤 Uploading redacted report to %s...\n", uploader.Name())
+	return uploader.Upload(ctx, title, redact.String(sb.String()))
+}
+
+// createIssue files the redacted analysis and diagnostic data as an issue
+// in the tracker configured via KUBEHELP_ISSUE_TRACKER. The URL is also
+// returned when the issue was created but its snapshot failed to attach.
+func createIssue(ctx context.Context, data *k8s.DiagnosticData, analysis, providerName string, status analyzer.Status) (string, error) {
+	issues, err := tracker.NewFromEnv()
+	if err != nil {
+		return "", err
+	}
+	issue, err := tracker.NewIssue(tracker.Report{Data: data, Analysis: analysis, Provider: providerName, Status: status, Messages: i18n.For(diagLanguage)})
+	if err != nil {
+		return "", fmt.Errorf("failed to build issue: %w", err)
+	}
+	progressf("\n🧾 Filing issue in %s...\n", issues.Name())
+	return issues.Create(ctx, issue)
+}
+
+// writeVerboseOutput writes the prompt sent to the LLM to path, or the
+// structured diagnostic data behind it when path ends in .json
+func writeVerboseOutput(path string, data *k8s.DiagnosticData, prompt string) error {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return k8s.SaveDiagnosticData(path, data)
+	}
+	if err := os.WriteFile(path, []byte(prompt), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// emitFindingEvents records the detected findings as Kubernetes Events
+func emitFindingEvents(ctx context.Context, data *k8s.DiagnosticData) error {
+	if len(data.Findings) == 0 {
+		return nil
+	}
+	k8sClient, err := k8s.NewClientFromConfig(kubeClientConfig(""), diagK8sTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	// Cluster-wide findings carry their own namespace
+	byNamespace := make(map[string][]k8s.Finding)
+	var namespaces []string
+	for _, f := range data.Findings {
+		ns := f.Namespace
+		if ns == "" {
+			ns = data.Namespace
+		}
+		if _, ok := byNamespace[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+		byNamespace[ns] = append(byNamespace[ns], f)
+	}
+
+	var total k8s.EmitResult
+	for _, ns := range namespaces {
+		result, err := k8sClient.EmitFindingEvents(ctx, ns, byNamespace[ns], k8s.EmitOptions{})
+		total.Created += result.Created
+		total.Duplicates += result.Duplicates
+		total.Dropped += result.Dropped
+		if err != nil {
+			progressf("\n📣 Emitted %d events (%d already reported, %d over the per-run limit)\n",
+				total.Created, total.Duplicates, total.Dropped)
+			return err
+		}
+	}
+	progressf("\n📣 Emitted %d events (%d already reported, %d over the per-run limit)\n",
+		total.Created, total.Duplicates, total.Dropped)
+	return nil
+}
+
+// collectDiagnostics gathers diagnostic data from the live cluster
+func collectDiagnostics(ctx context.Context, contexts []string) (*k8s.DiagnosticData, error) {
+	if len(contexts) > 1 {
+		return collectClusters(ctx, contexts)
+	}
+	kubeContext := diagContext
+	if len(contexts) == 1 {
+		kubeContext = contexts[0]
+	}
+
+	if diagAllNamespaces {
+		progressf("🔍 Collecting diagnostic data from all namespaces (%d at a time)...\n", diagNamespaceConcurrency)
+	} else if namespaces := k8s.SplitNamespaces(diagNamespace); len(namespaces) > 1 {
+		progressf("🔍 Collecting diagnostic data from namespaces %s (%d at a time)...\n", strings.Join(namespaces, ", "), diagNamespaceConcurrency)
+	} else {
+		progressf("🔍 Collecting diagnostic data from namespace '%s'...\n", diagNamespace)
+	}
+
+	// Report each completed step
+	progress := newProgressLine()
+	var onProgress func(k8s.Progress)
+	if !diagQuiet {
+		onProgress = progress.update
+	}
+	data, err := collectCluster(ctx, kubeContext, diagNamespace, onProgress)
+	progress.done()
+	return data, err
+}
+
+// collectClusters collects every context concurrently and combines the
+// results into per-cluster sections. Clusters report when they finish
+// rather than through the live progress line, which they would share.
+func collectClusters(ctx context.Context, contexts []string) (*k8s.DiagnosticData, error) {
+	progressf("🔍 Collecting diagnostic data from %d clusters: %s...\n", len(contexts), strings.Join(contexts, ", "))
+	results := k8s.CollectClusters(ctx, contexts, func(ctx context.Context, kubeContext string) (*k8s.DiagnosticData, error) {
+		data, err := collectCluster(ctx, kubeContext, diagNamespace, nil)
+		if err != nil {
+			progressf("   ❌ %s: %v\n", kubeContext, err)
+			return nil, err
+		}
+		progressf("   ✓ %s: %d pods, %d events\n", kubeContext, len(data.Pods), len(data.Events))
+		return data, nil
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	progressf("\n")
+	return k8s.MergeClusterResults(results)
+}
+
+// collectCluster collects namespace, which may be a comma-separated list, or
+// all of them with --all-namespaces, from the cluster behind kubeContext
+// (empty: the current context)
+func collectCluster(ctx context.Context, kubeContext, namespace string, progress func(k8s.Progress)) (*k8s.DiagnosticData, error) {
+	k8sClient, err := k8s.NewClientFromConfig(kubeClientConfig(kubeContext), diagK8sTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	opts := aggregatorOptions()
+	opts.Progress = progress
+	aggregator := k8s.NewAggregatorWithOptions(k8sClient, opts)
+
+	// Fail before collecting anything when a required permission is missing
+	namespaces := k8s.SplitNamespaces(namespace)
+	if !diagNoPreflight {
+		preflightNamespaces := namespaces
+		if diagAllNamespaces {
+			preflightNamespaces = []string{""}
+		}
+		for _, ns := range preflightNamespaces {
+			if err := aggregator.Preflight(ctx, ns); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var data *k8s.DiagnosticData
+	switch {
+	case diagAllNamespaces:
+		data, err = aggregator.CollectAllNamespaces(ctx, diagWorkloads)
+	case len(namespaces) > 1:
+		data, err = aggregator.CollectNamespaceList(ctx, namespaces, diagWorkloads)
 	default:
-		return fmt.Errorf("unsupported LLM provider: %s (supported: openai, gemini, ollama, vertexai)", diagLLMProvider)
+		data, err = aggregator.CollectDiagnostics(ctx, namespace, diagWorkloads)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect diagnostics: %w", err)
 	}
+	return data, nil
+}
 
-	fmt.Printf("🤖 Analyzing with %s...\n\n", provider.Name())
+// kubeContexts returns the contexts selected with --context, which may be a
+// comma-separated list, or --all-contexts. It is empty for the current
+// context.
+func kubeContexts() ([]string, error) {
+	if diagAllContexts {
+		contexts, err := k8s.ListContexts(diagKubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		if len(contexts) == 0 {
+			return nil, fmt.Errorf("--all-contexts: no contexts found in kubeconfig")
+		}
+		return contexts, nil
+	}
 
-	// Get analysis from LLM
-	analysis, err := provider.Analyze(ctx, prompt)
+	var contexts []string
+	for _, name := range strings.Split(diagContext, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			contexts = append(contexts, name)
+		}
+	}
+	return contexts, nil
+}
+
+// applyProfile fills flags that were not given on the command line from the
+// profile selected with --profile, then validates the profile's context and
+// provider
+func applyProfile(flags *pflag.FlagSet) error {
+	if diagProfile == "" {
+		return nil
+	}
+
+	cfg, err := config.Load(config.DefaultPath())
+	if err != nil {
+		return err
+	}
+	profile, err := cfg.Profile(diagProfile)
 	if err != nil {
-		return fmt.Errorf("LLM analysis failed: %w", err)
+		return err
+	}
+	if profile.LLM != "" && profile.LLM != providerNone {
+		if _, err := parseProviders(profile.LLM); err != nil {
+			return fmt.Errorf("profile %q: %w", diagProfile, err)
+		}
 	}
 
-	// Display results
-	fmt.Println("=== AI Analysis ===")
-	fmt.Println(analysis)
-	fmt.Println("=== End Analysis ===")
+	values := map[string]string{
+		"kubeconfig":      profile.Kubeconfig,
+		"context":         profile.Context,
+		"namespace":       profile.Namespace,
+		"llm":             profile.LLM,
+		"model":           profile.Model,
+		"language":        profile.Language,
+		"detail-level":    profile.DetailLevel,
+		"prompt-template": profile.PromptTemplate,
+		"system-prompt":   profile.SystemPrompt,
+	}
+	if len(profile.CustomResources) > 0 {
+		values["custom-resource"] = strings.Join(profile.CustomResources, ",")
+	}
+	for flag, enabled := range map[string]bool{
+		"compact":        profile.Compact,
+		"logs":           profile.Logs,
+		"best-practices": profile.BestPractices,
+		"anonymize":      profile.Anonymize,
+		"model-fallback": profile.ModelFallback,
+	} {
+		if enabled {
+			values[flag] = "true"
+		}
+	}
+	if profile.MaxInputTokens > 0 {
+		values["max-input-tokens"] = strconv.Itoa(profile.MaxInputTokens)
+	}
+	if profile.MaxCost > 0 {
+		values["max-cost"] = strconv.FormatFloat(profile.MaxCost, 'f', -1, 64)
+	}
+	if profile.Temperature != nil {
+		values["temperature"] = strconv.FormatFloat(*profile.Temperature, 'f', -1, 64)
+	}
+	if profile.TopP != nil {
+		values["top-p"] = strconv.FormatFloat(*profile.TopP, 'f', -1, 64)
+	}
+	if profile.MaxOutputTokens > 0 {
+		values["max-output-tokens"] = strconv.Itoa(profile.MaxOutputTokens)
+	}
 
+	// Set marks flags as changed, so note this before applying values
+	contextFromProfile := profile.Context != "" && !flags.Changed("context")
+	for flag, value := range values {
+		if value == "" || flags.Changed(flag) {
+			continue
+		}
+		if err := flags.Set(flag, value); err != nil {
+			return fmt.Errorf("profile %q: invalid %s: %w", diagProfile, flag, err)
+		}
+	}
+
+	// Explicit environment variables win over profile values
+	for key, value := range profile.Env {
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+
+	if contextFromProfile {
+		exists, err := k8s.ContextExists(diagKubeconfig, diagContext)
+		if err != nil {
+			return fmt.Errorf("profile %q: %w", diagProfile, err)
+		}
+		if !exists {
+			return fmt.Errorf("profile %q: context %q not found in kubeconfig", diagProfile, diagContext)
+		}
+	}
+
+	progressf("👤 Using profile '%s'\n", diagProfile)
 	return nil
 }
+
+// aggregatorOptions maps command-line flags to collection options
+func aggregatorOptions() k8s.AggregatorOptions {
+	// Validated by the commands before collecting
+	customResources, _ := k8s.ParseCustomResources(diagCustomResources)
+	return k8s.AggregatorOptions{
+		CollectLogs:          diagLogs,
+		LogConcurrency:       diagLogConcurrency,
+		LogTailLines:         diagLogLines,
+		LogKeywords:          diagLogKeywords,
+		BestPractices:        diagBestPractices,
+		APITimeout:           diagK8sTimeout,
+		CollectEnv:           diagEnv,
+		EnvFilter:            k8s.EnvFilter{Allow: diagEnvAllow, Deny: diagEnvDeny},
+		NamespaceConcurrency: diagNamespaceConcurrency,
+		LabelSelector:        diagSelector,
+		CollectNodes:         diagNodes,
+		CustomResources:      customResources,
+		ProbeConnectivity:    diagProbeConnectivity,
+		ProbeImage:           diagProbeImage,
+		ClusterDomain:        diagClusterDomain,
+		EventsSince:          diagEventsSince,
+		IncludeSpec:          diagIncludeSpec,
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"kubehelp/internal/analyzer"
+	"kubehelp/internal/history"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+	"kubehelp/internal/redact"
+
+	"github.com/spf13/cobra"
+)
+
+// diffPageSize is the number of history records read at a time while looking
+// for the diagnosis to diff with
+const diffPageSize = 50
+
+var diffSince string
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Explain what changed in a namespace since an earlier diagnosis",
+	Long: `Diff collects a namespace, compares it with the diagnostic data of an
+earlier diagnosis from the local history and asks the LLM which changes
+(new Warning events, images, replicas, env vars, pods moving to other nodes,
+new findings) explain the current state.
+
+By default the earlier diagnosis is the newest healthy one of the same
+namespace and context: no unhealthy pods and no high or critical findings.
+--since selects it instead, as a history ID or as a duration such as 2h,
+meaning the newest diagnosis at least that old. Diff accepts the diagnose
+flags that apply to collection and analysis; with --llm none it prints the
+changes only.`,
+	Example: `  # What changed since payments last looked healthy
+  kubehelp diff -n payments
+
+  # Changes since a specific diagnosis
+  kubehelp diff -n payments --since 20240501T101500-3f2a9c1e
+
+  # Changes over the last day, without the LLM
+  kubehelp diff -n payments --since 24h --llm none`,
+	Args: cobra.NoArgs,
+	RunE: runDiff,
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffSince, "since", "", "Diff with this history ID, or with the newest diagnosis at least this old, e.g. 2h (default: the last healthy diagnosis)")
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if diagTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, diagTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := diff(ctx, cmd)
+	return contextError(err, time.Since(start))
+}
+
+func diff(ctx context.Context, cmd *cobra.Command) error {
+	if err := applyProfile(cmd.Flags()); err != nil {
+		return err
+	}
+	resolveNamespace()
+
+	if !slices.Contains(outputFormats, diagOutput) {
+		return fmt.Errorf("invalid output format %q (expected %s)", diagOutput, strings.Join(outputFormats, ", "))
+	}
+	switch {
+	case diagFromFile != "" || diagBundle != "":
+		return fmt.Errorf("diff collects the namespace live and cannot be combined with --from-file or --bundle; use compare for snapshots")
+	case diagAllNamespaces || diagAllContexts || strings.Contains(diagContext, ",") || strings.Contains(diagNamespace, ","):
+		return fmt.Errorf("diff collects a single namespace and context")
+	case diagChat || diagShare || diagCreateIssue || diagEmitEvents || diagStructured || diagPromptTemplate != "":
+		return fmt.Errorf("--chat, --share, --create-issue, --emit-events, --structured and --prompt-template are not supported by diff")
+	}
+	if _, err := k8s.ParseCustomResources(diagCustomResources); err != nil {
+		return fmt.Errorf("invalid --custom-resource: %w", err)
+	}
+	if diagLLMProvider != providerNone {
+		if _, err := parseProviders(diagLLMProvider); err != nil {
+			return err
+		}
+	}
+	detailLevel, err := llm.ParseDetailLevel(diagDetailLevel)
+	if err != nil {
+		return err
+	}
+	generation, err := generationSettings(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	ctx = withGeneration(ctx, generation, diagSystemPrompt)
+	redactLevel, err := redact.ParseLevel(diagRedact)
+	if err != nil {
+		return fmt.Errorf("invalid --redact: %w", err)
+	}
+	redactor, err := redact.New(redactLevel, diagRedactPatterns)
+	if err != nil {
+		return err
+	}
+	store, err := openHistory()
+	if err != nil {
+		return err
+	}
+
+	progressf("🔍 Collecting diagnostic data from namespace '%s'...\n", diagNamespace)
+	progress := newProgressLine()
+	var onProgress func(k8s.Progress)
+	if !diagQuiet {
+		onProgress = progress.update
+	}
+	current, err := collectCluster(ctx, diagContext, diagNamespace, onProgress)
+	progress.done()
+	if err != nil {
+		return err
+	}
+	progressf("✅ Collected %d pods, %d events\n\n", len(current.Pods), len(current.Events))
+
+	record, err := findEarlierDiagnosis(store, current, diffSince, time.Now())
+	if err != nil {
+		return err
+	}
+	progressf("🕰️  Diffing with diagnosis %s from %s (%s ago)\n\n", record.ID,
+		record.CreatedAt.Local().Format(time.RFC1123), time.Since(record.CreatedAt).Round(time.Minute))
+	for _, w := range current.Warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n\n", w)
+	}
+
+	return explainComparison(ctx, record.DiagnosticData, current, record.ID, "current", redactor, detailLevel, comparisonKind{
+		diff:    k8s.CompareOverTime,
+		prompt:  llm.BuildDiffPrompt,
+		compact: llm.BuildCompactDiffPrompt,
+	})
+}
+
+// findEarlierDiagnosis returns the history record to diff current with: the
+// one with ID since, the newest one at least since old when since is a
+// duration, else the newest healthy one. Only successful diagnoses of the
+// namespace and context of current with diagnostic data are considered.
+func findEarlierDiagnosis(store history.Store, current *k8s.DiagnosticData, since string, now time.Time) (*history.Record, error) {
+	age, err := time.ParseDuration(since)
+	if since != "" && err != nil {
+		record, err := store.Get(since)
+		if errors.Is(err, history.ErrNotFound) {
+			return nil, fmt.Errorf("--since %s is neither a duration nor the ID of a diagnosis in history", since)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.DiagnosticData == nil || record.Error != "" {
+			return nil, fmt.Errorf("diagnosis %s has no diagnostic data to diff with", since)
+		}
+		if len(record.DiagnosticData.Clusters) > 0 {
+			return nil, fmt.Errorf("diagnosis %s spans several clusters; diff one cluster at a time", since)
+		}
+		return record, nil
+	}
+
+	for offset := 0; ; offset += diffPageSize {
+		records, err := store.List(history.ListOptions{Namespace: current.Namespace, Limit: diffPageSize, Offset: offset})
+		if err != nil {
+			return nil, err
+		}
+		for i := range records {
+			record := &records[i]
+			data := record.DiagnosticData
+			switch {
+			case record.Error != "" || data == nil || len(data.Clusters) > 0:
+				continue
+			case record.Context != "" && current.ContextName != "" && record.Context != current.ContextName:
+				continue
+			}
+			if since != "" {
+				if now.Sub(record.CreatedAt) >= age {
+					return record, nil
+				}
+			} else if healthy(data) {
+				return record, nil
+			}
+		}
+		if len(records) < diffPageSize {
+			break
+		}
+	}
+
+	if since != "" {
+		return nil, fmt.Errorf("no diagnosis of namespace '%s' older than %s in history", current.Namespace, since)
+	}
+	return nil, fmt.Errorf("no healthy diagnosis of namespace '%s' in history; give one with --since", current.Namespace)
+}
+
+// healthy reports whether a diagnosis found no unhealthy pods and no high or
+// critical findings
+func healthy(data *k8s.DiagnosticData) bool {
+	severities := make([]k8s.Severity, 0, len(data.Findings))
+	for _, f := range data.Findings {
+		severities = append(severities, f.Severity)
+	}
+	if analyzer.Assess(severities...) == analyzer.StatusCritical {
+		return false
+	}
+	for _, pod := range data.Pods {
+		if pod.Unhealthy() {
+			return false
+		}
+	}
+	return true
+}
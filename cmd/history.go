@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kubehelp/internal/history"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/util/homedir"
+)
+
+var (
+	histNamespace string
+	histLimit     int
+	histOffset    int
+	histOutput    string
+	histServer    string
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past diagnoses and their analyses",
+	Long: `History lists past diagnoses, newest first, so an analysis can be compared
+with what was said the last time something broke.
+
+Every "kubehelp diagnose" run is recorded in ~/.kubehelp/history.db unless
+--no-history is set. With --server, the history of a kubehelp server is
+listed instead, authenticated with $KUBEHELP_API_TOKEN if set.
+
+Environment variables:
+  HISTORY_BACKEND      - Store: sqlite (default), postgres, memory or file
+  HISTORY_SQLITE_PATH  - SQLite database (default: ~/.kubehelp/history.db)
+  HISTORY_POSTGRES_DSN - Connection string for the postgres backend
+  KUBEHELP_SERVER      - Default for --server
+  KUBEHELP_API_TOKEN   - Bearer token for --server`,
+	Example: `  # Recent diagnoses
+  kubehelp history
+
+  # Diagnoses of one namespace
+  kubehelp history -n payments --limit 5
+
+  # Show a past analysis with its findings
+  kubehelp history show 20240501T101500-3f2a9c1e
+
+  # List the diagnoses run through a shared server
+  kubehelp history --server https://kubehelp.example.com`,
+	Args: cobra.NoArgs,
+	RunE: runHistory,
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a past diagnosis",
+	Long: `Show prints the analysis of a past diagnosis, or with --output json the full
+record including the collected diagnostic data.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runHistoryShow,
+}
+
+func init() {
+	historyCmd.PersistentFlags().StringVar(&histServer, "server", os.Getenv("KUBEHELP_SERVER"), "URL of a kubehelp server whose history to read instead of the local one")
+	historyCmd.PersistentFlags().StringVarP(&histOutput, "output", "o", outputText, "Output format: text or json")
+	historyCmd.Flags().StringVarP(&histNamespace, "namespace", "n", "", "Only list diagnoses of this namespace")
+	historyCmd.Flags().IntVar(&histLimit, "limit", 20, "Maximum number of diagnoses listed")
+	historyCmd.Flags().IntVar(&histOffset, "offset", 0, "Skip this many of the newest diagnoses")
+	historyCmd.AddCommand(historyShowCmd)
+}
+
+// defaultHistoryPath is the SQLite database the CLI records diagnoses in
+func defaultHistoryPath() string {
+	return filepath.Join(homedir.HomeDir(), ".kubehelp", "history.db")
+}
+
+// openHistory opens the local history store, creating the directory of the
+// default database on first use
+func openHistory() (history.Store, error) {
+	path := defaultHistoryPath()
+	if os.Getenv("HISTORY_BACKEND") == "" && os.Getenv("HISTORY_SQLITE_PATH") == "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create history directory: %w", err)
+		}
+	}
+	return history.NewStoreFromEnvWithDefault(path)
+}
+
+// recordDiagnosis saves a diagnose run to the local history, with the flags
+// it was run with, except --token, as its request. Failures only produce a
+// warning.
+func recordDiagnosis(flags *pflag.FlagSet, record history.Record) {
+	settings := make(map[string]string)
+	flags.Visit(func(f *pflag.Flag) {
+		// Credentials given on the command line stay out of the history
+		if f.Name != "token" {
+			settings[f.Name] = f.Value.String()
+		}
+	})
+	if request, err := json.Marshal(settings); err == nil {
+		record.Request = request
+	}
+
+	store, err := openHistory()
+	if err == nil {
+		_, err = store.Save(record)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\n⚠️  Failed to record diagnosis in history: %v\n", err)
+	}
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	if histOutput != outputText && histOutput != outputJSON {
+		return fmt.Errorf("invalid output format %q (expected text or json)", histOutput)
+	}
+	if histLimit < 1 || histOffset < 0 {
+		return fmt.Errorf("--limit must be positive and --offset not negative")
+	}
+	opts := history.ListOptions{Namespace: histNamespace, Limit: histLimit, Offset: histOffset}
+
+	var records []history.Record
+	if histServer != "" {
+		query := url.Values{"limit": {strconv.Itoa(opts.Limit)}, "offset": {strconv.Itoa(opts.Offset)}}
+		if opts.Namespace != "" {
+			query.Set("namespace", opts.Namespace)
+		}
+		var resp struct {
+			Records []history.Record `json:"records"`
+		}
+		if err := getServerHistory(cmd.Context(), "/api/history?"+query.Encode(), &resp); err != nil {
+			return err
+		}
+		records = resp.Records
+	} else {
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		listed, err := store.List(opts)
+		if err != nil {
+			return err
+		}
+		for _, record := range listed {
+			records = append(records, record.Summary())
+		}
+	}
+
+	if histOutput == outputJSON {
+		return writeJSON(os.Stdout, records)
+	}
+	if len(records) == 0 {
+		fmt.Fprintln(os.Stderr, "No diagnoses recorded yet")
+		return nil
+	}
+	return writeHistoryTable(os.Stdout, records)
+}
+
+func runHistoryShow(cmd *cobra.Command, args []string) error {
+	if histOutput != outputText && histOutput != outputJSON {
+		return fmt.Errorf("invalid output format %q (expected text or json)", histOutput)
+	}
+
+	var record *history.Record
+	if histServer != "" {
+		record = &history.Record{}
+		if err := getServerHistory(cmd.Context(), "/api/history/"+url.PathEscape(args[0]), record); err != nil {
+			return err
+		}
+	} else {
+		store, err := openHistory()
+		if err != nil {
+			return err
+		}
+		record, err = store.Get(args[0])
+		if errors.Is(err, history.ErrNotFound) {
+			return fmt.Errorf("no diagnosis with ID %s in history", args[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if histOutput == outputJSON {
+		return writeJSON(os.Stdout, record)
+	}
+
+	// The metadata goes to stderr so that stdout is the analysis alone, as
+	// with diagnose
+	fmt.Fprintf(os.Stderr, "Diagnosis %s of namespace '%s' at %s with %s (%s)\n",
+		record.ID, record.Namespace, record.CreatedAt.Local().Format(time.RFC1123),
+		record.Provider, (time.Duration(record.DurationMs) * time.Millisecond).Round(time.Second))
+	if record.Error != "" {
+		return fmt.Errorf("diagnosis failed: %s", record.Error)
+	}
+	if data := record.DiagnosticData; data != nil && len(data.Findings) > 0 {
+		fmt.Fprintf(os.Stderr, "📋 %d findings detected\n", len(data.Findings))
+	}
+	fmt.Fprintln(os.Stderr)
+	_, err := fmt.Fprintln(os.Stdout, record.Analysis)
+	return err
+}
+
+// writeHistoryTable lists records with one line per diagnosis
+func writeHistoryTable(w io.Writer, records []history.Record) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCREATED\tNAMESPACE\tWORKLOADS\tPROVIDER\tDURATION\tSTATUS")
+	for _, r := range records {
+		workloads := strings.Join(r.Workloads, ",")
+		if workloads == "" {
+			workloads = "-"
+		}
+		status := "ok"
+		if r.Error != "" {
+			status = "failed"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.ID, r.CreatedAt.Local().Format("2006-01-02 15:04"), r.Namespace, workloads, r.Provider,
+			(time.Duration(r.DurationMs) * time.Millisecond).Round(time.Second), status)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// getServerHistory fetches path from the --server history API into v
+func getServerHistory(ctx context.Context, path string, v any) error {
+	req, err := newServerRequest(ctx, http.MethodGet, histServer, path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", histServer, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return serverError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode server response: %w", err)
+	}
+	return nil
+}
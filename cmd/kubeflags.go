@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeFlags are kubectl's standard connection flags (--kubeconfig, --context,
+// --namespace, --cluster, --user, --token, --as, ...), so that kubehelp
+// resolves clusters exactly like kubectl, also when run as a kubectl plugin.
+// --kubeconfig, --context and --namespace are bound to the diagnose flags.
+var kubeFlags = newKubeFlags()
+
+func newKubeFlags() *genericclioptions.ConfigFlags {
+	f := genericclioptions.NewConfigFlags(false)
+	f.KubeConfig = &diagKubeconfig
+	f.Context = &diagContext
+	f.Namespace = &diagNamespace
+	// --k8s-timeout limits requests, and nothing uses the discovery cache
+	f.Timeout = nil
+	f.CacheDir = nil
+	return f
+}
+
+// addKubeFlagsWithAPIServer adds the kubectl flags to flags, with kubectl's
+// --server/-s renamed to --api-server so that --server can name a kubehelp
+// server
+func addKubeFlagsWithAPIServer(flags *pflag.FlagSet) {
+	kube := pflag.NewFlagSet("kubectl", pflag.ContinueOnError)
+	kubeFlags.AddFlags(kube)
+	kube.VisitAll(func(f *pflag.Flag) {
+		if f.Name == "server" {
+			flags.StringVar(kubeFlags.APIServer, "api-server", "", f.Usage)
+			return
+		}
+		flags.AddFlag(f)
+	})
+}
+
+// kubeClientConfig returns the kubeconfig loader for kubeContext (empty:
+// --context) with the other kubectl flags applied as overrides
+func kubeClientConfig(kubeContext string) clientcmd.ClientConfig {
+	if kubeContext == "" {
+		kubeContext = diagContext
+	}
+	f := &genericclioptions.ConfigFlags{
+		KubeConfig:         kubeFlags.KubeConfig,
+		ClusterName:        kubeFlags.ClusterName,
+		AuthInfoName:       kubeFlags.AuthInfoName,
+		Context:            &kubeContext,
+		Namespace:          kubeFlags.Namespace,
+		APIServer:          kubeFlags.APIServer,
+		TLSServerName:      kubeFlags.TLSServerName,
+		Insecure:           kubeFlags.Insecure,
+		CertFile:           kubeFlags.CertFile,
+		KeyFile:            kubeFlags.KeyFile,
+		CAFile:             kubeFlags.CAFile,
+		BearerToken:        kubeFlags.BearerToken,
+		Impersonate:        kubeFlags.Impersonate,
+		ImpersonateUID:     kubeFlags.ImpersonateUID,
+		ImpersonateGroup:   kubeFlags.ImpersonateGroup,
+		DisableCompression: kubeFlags.DisableCompression,
+	}
+	return f.ToRawKubeConfigLoader()
+}
+
+// resolveNamespace defaults --namespace like kubectl: to the namespace of the
+// kubeconfig context, or inside a pod its own, else "default"
+func resolveNamespace() {
+	if diagNamespace != "" {
+		return
+	}
+	// The loader reads -n from diagNamespace, so resolve before setting it
+	ns, _, err := kubeClientConfig("").Namespace()
+	if err != nil || ns == "" {
+		ns = "default"
+	}
+	diagNamespace = ns
+}
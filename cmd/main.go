@@ -1,7 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kubehelp/internal/tracing"
 
 	"github.com/spf13/cobra"
 )
@@ -13,9 +21,68 @@ func main() {
 		Long:  `kubehelp assists with troubleshooting Kubernetes deployments via subcommands.`,
 	}
 
+	// kubectl runs kubectl-kubehelp on the PATH for "kubectl kubehelp", so
+	// help and usage show that invocation
+	if strings.HasPrefix(filepath.Base(os.Args[0]), "kubectl-") {
+		rootCmd.Use = "kubectl-kubehelp"
+		rootCmd.Annotations = map[string]string{cobra.CommandDisplayNameAnnotation: "kubectl kubehelp"}
+	}
+
 	rootCmd.AddCommand(diagnoseCmd)
+	rootCmd.AddCommand(askCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(providersCmd)
+	rootCmd.AddCommand(modelsCmd)
+	rootCmd.AddCommand(promptTemplateCmd)
+
+	// chat runs a diagnosis first, so it accepts every diagnose flag
+	chatCmd.Flags().AddFlagSet(diagnoseCmd.Flags())
+	rootCmd.AddCommand(chatCmd)
+
+	// watch runs diagnoses, so it accepts every diagnose flag as well
+	watchCmd.Flags().AddFlagSet(diagnoseCmd.Flags())
+	rootCmd.AddCommand(watchCmd)
+
+	// collect accepts the diagnose flags that apply to collection
+	addCollectFlags()
+	rootCmd.AddCommand(collectCmd)
+
+	// compare collects and analyzes like diagnose, for two namespaces
+	compareCmd.Flags().AddFlagSet(diagnoseCmd.Flags())
+	rootCmd.AddCommand(compareCmd)
+	// diff collects and analyzes like diagnose, against a history record
+	diffCmd.Flags().AddFlagSet(diagnoseCmd.Flags())
+	rootCmd.AddCommand(diffCmd)
 
-	if err := rootCmd.Execute(); err != nil {
+	// permissions checks what a diagnosis with the same flags needs
+	permissionsCmd.Flags().AddFlagSet(diagnoseCmd.Flags())
+	rootCmd.AddCommand(permissionsCmd)
+
+	// Trace the command when OTEL_EXPORTER_OTLP_ENDPOINT is set, with the
+	// collection steps and LLM calls as its children
+	shutdownTracing, err := tracing.Setup(context.Background(), "kubehelp")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Tracing disabled: %v\n", err)
+	}
+	name := rootCmd.Name()
+	if cmd, _, err := rootCmd.Find(os.Args[1:]); err == nil {
+		name = cmd.CommandPath()
+	}
+	ctx, span := tracing.Start(context.Background(), name)
+	err = rootCmd.ExecuteContext(ctx)
+	tracing.End(span, err)
+
+	// Flush the spans of short commands before exiting
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if shutdownErr := shutdownTracing(flushCtx); shutdownErr != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Failed to export traces: %v\n", shutdownErr)
+	}
+	cancel()
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+
+	"github.com/spf13/cobra"
+)
+
+var modelsOutput string
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List and pull the models of the Ollama server",
+	Long: `Models manages the models of the Ollama server at OLLAMA_BASE_URL
+(default http://localhost:11434), so that the model diagnose uses with
+--llm ollama, OLLAMA_MODEL (default mistral), is in place before diagnosing.`,
+	Args: cobra.NoArgs,
+}
+
+var modelsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the models pulled to the Ollama server",
+	Long: `List prints the models pulled to the Ollama server with their size,
+parameters and quantization, and marks the configured model. A configured
+model that is missing is reported on stderr.`,
+	Example: `  kubehelp models list
+  kubehelp models list -o json | jq -r '.[].name'`,
+	Args: cobra.NoArgs,
+	RunE: runModelsList,
+}
+
+var modelsPullCmd = &cobra.Command{
+	Use:   "pull [MODEL]",
+	Short: "Pull a model to the Ollama server, by default the configured one",
+	Long: `Pull downloads MODEL, by default the configured OLLAMA_MODEL, to the
+Ollama server and shows the download progress. Pulling a model that is
+already present only fetches updates.`,
+	Example: `  # Pull the model diagnose uses
+  kubehelp models pull
+
+  # Pull another model and use it
+  kubehelp models pull llama3.1:8b
+  kubehelp diagnose -n prod --model llama3.1:8b`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runModelsPull,
+}
+
+// ModelInfo is the --output json shape of models list
+type ModelInfo struct {
+	llm.OllamaModel
+	// Configured marks the model diagnose uses with --llm ollama
+	Configured bool `json:"configured,omitempty"`
+}
+
+func init() {
+	modelsListCmd.Flags().StringVarP(&modelsOutput, "output", "o", outputText, "Output format: text or json")
+	modelsCmd.AddCommand(modelsListCmd)
+	modelsCmd.AddCommand(modelsPullCmd)
+}
+
+func runModelsList(cmd *cobra.Command, args []string) error {
+	if modelsOutput != outputText && modelsOutput != outputJSON {
+		return fmt.Errorf("invalid output format %q (expected text or json)", modelsOutput)
+	}
+
+	provider := ollamaProvider("")
+	pulled, err := provider.ListModels(cmd.Context())
+	if err != nil {
+		return err
+	}
+	models := make([]ModelInfo, 0, len(pulled))
+	found := false
+	for _, m := range pulled {
+		configured := llm.SameOllamaModel(m.Name, provider.Model())
+		found = found || configured
+		models = append(models, ModelInfo{OllamaModel: m, Configured: configured})
+	}
+	if err := writeModels(os.Stdout, modelsOutput, models); err != nil {
+		return err
+	}
+	if !found {
+		fmt.Fprintf(os.Stderr, "\n⚠️  The configured model %s is not pulled; run \"kubehelp models pull\"\n", provider.Model())
+	}
+	return nil
+}
+
+// writeModels writes models to w as a table or JSON
+func writeModels(w io.Writer, format string, models []ModelInfo) error {
+	if format == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(models)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSIZE\tPARAMETERS\tQUANTIZATION\tMODIFIED\tCONFIGURED")
+	for _, m := range models {
+		configured := ""
+		if m.Configured {
+			configured = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", m.Name, k8s.FormatMemory(m.Size), dashIfEmpty(m.ParameterSize),
+			dashIfEmpty(m.Quantization), m.ModifiedAt.Local().Format(time.DateTime), configured)
+	}
+	return tw.Flush()
+}
+
+func runModelsPull(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	model := ""
+	if len(args) == 1 {
+		model = args[0]
+	}
+	provider := ollamaProvider(model)
+	fmt.Fprintf(os.Stderr, "⬇️  Pulling %s...\n", provider.Model())
+
+	progress := newProgressLine()
+	// Downloads report every few kilobytes; logs only get the completion
+	// of each layer
+	downloaded := make(map[string]bool)
+	err := provider.PullModel(ctx, func(p llm.PullProgress) {
+		if p.Total == 0 {
+			progress.show("   "+p.Status, true)
+			return
+		}
+		complete := p.Completed == p.Total && !downloaded[p.Digest]
+		if complete {
+			downloaded[p.Digest] = true
+		}
+		progress.show(fmt.Sprintf("   %s %d%% (%s/%s)", p.Status, p.Completed*100/p.Total,
+			k8s.FormatMemory(p.Completed), k8s.FormatMemory(p.Total)), complete)
+	})
+	progress.done()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✅ Pulled %s\n", provider.Model())
+	return nil
+}
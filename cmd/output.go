@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"kubehelp/internal/analyzer"
+	"kubehelp/internal/i18n"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats of diagnose
+const (
+	outputText     = "text"
+	outputJSON     = "json"
+	outputYAML     = "yaml"
+	outputMarkdown = "markdown"
+)
+
+var outputFormats = []string{outputText, outputJSON, outputYAML, outputMarkdown}
+
+// DiagnoseResult is the --output json|yaml shape of diagnose. Data is the
+// collected data as saved with --save, before redaction and anonymization.
+type DiagnoseResult struct {
+	Provider string `json:"provider"`
+	// Fallbacks are the failures of the providers of a --llm chain tried
+	// before Provider
+	Fallbacks []string `json:"fallbacks,omitempty"`
+	// Analysis is the markdown analysis, with --structured rendered from
+	// Structured
+	Analysis   string                  `json:"analysis"`
+	Structured *llm.StructuredAnalysis `json:"structured,omitempty"`
+	// PreAnalysis holds the rule-based diagnoses, which are the analysis
+	// itself with --llm none
+	PreAnalysis []analyzer.Diagnosis `json:"preAnalysis,omitempty"`
+	// Usage is the token usage and estimated cost per provider
+	Usage []llm.Usage `json:"usage,omitempty"`
+	// Cached is set when the analysis was reused from the analysis cache
+	Cached bool `json:"cached,omitempty"`
+	// Severity is the overall status of the run: ok, warning or critical
+	Severity analyzer.Status     `json:"severity"`
+	Data     *k8s.DiagnosticData `json:"diagnosticData"`
+}
+
+// writeDiagnoseResult writes result to w in format; text prints only the
+// analysis
+func writeDiagnoseResult(w io.Writer, format string, result DiagnoseResult) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	case outputYAML:
+		out, err := yaml.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to encode result as YAML: %w", err)
+		}
+		_, err = w.Write(out)
+		return err
+	case outputMarkdown:
+		_, err := io.WriteString(w, markdownReport(result))
+		return err
+	}
+	_, err := fmt.Fprintln(w, result.Analysis)
+	return err
+}
+
+// markdownReport renders the analysis with the collection metadata and
+// findings, suitable for a CI artifact or PR comment
+func markdownReport(result DiagnoseResult) string {
+	msg := i18n.For(diagLanguage)
+	data := result.Data
+	var sb strings.Builder
+	sb.WriteString("# " + fmt.Sprintf(msg.ReportTitle, data.Namespace) + "\n\n")
+
+	contexts := make([]string, 0, len(data.ClusterData()))
+	for _, cluster := range data.ClusterData() {
+		contexts = append(contexts, cluster.ContextName)
+	}
+	sb.WriteString(fmt.Sprintf("%s: %s | %s: %s | %s: %s | %s: %s\n\n",
+		msg.Context, strings.Join(contexts, ", "), msg.Collected, data.CollectedAt.Format(time.RFC3339),
+		msg.Provider, result.Provider, msg.Severity, result.Severity))
+
+	for _, f := range result.Fallbacks {
+		sb.WriteString("> ⚠️ " + fmt.Sprintf(msg.FellBack, f, result.Provider) + "\n\n")
+	}
+	if len(result.Usage) > 0 {
+		sb.WriteString(fmt.Sprintf("%s: %s\n\n", msg.LLMUsage, llm.TotalUsage(result.Usage)))
+	}
+
+	sb.WriteString("## " + msg.Analysis + "\n\n")
+	sb.WriteString(strings.TrimSpace(result.Analysis))
+	sb.WriteString("\n")
+
+	if len(result.PreAnalysis) > 0 && result.Provider != providerNone {
+		sb.WriteString("\n## " + msg.RuleBased + "\n\n")
+		for _, d := range result.PreAnalysis {
+			sb.WriteString(fmt.Sprintf("- **%s** `%s` %s: %s %s: %s\n", d.Severity, d.Rule, d.Resource(), d.Message, msg.SuggestedFix, d.Remediation))
+		}
+	}
+
+	var findings []k8s.Finding
+	warnings := data.Warnings
+	for _, cluster := range data.ClusterData() {
+		findings = append(findings, cluster.Findings...)
+		if cluster != data {
+			warnings = append(warnings, cluster.Warnings...)
+		}
+	}
+	if len(findings) > 0 {
+		sb.WriteString("\n## " + msg.Findings + "\n\n")
+		for _, f := range findings {
+			object := f.Object
+			if f.Namespace != "" {
+				object = f.Namespace + "/" + object
+			}
+			sb.WriteString(fmt.Sprintf("- **%s** `%s` %s: %s\n", f.Severity, f.Rule, object, f.Message))
+		}
+	}
+
+	if len(warnings) > 0 {
+		sb.WriteString("\n## " + msg.Warnings + "\n\n")
+		for _, w := range warnings {
+			sb.WriteString(fmt.Sprintf("- %s\n", w))
+		}
+	}
+	return sb.String()
+}
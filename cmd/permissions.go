@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"kubehelp/internal/k8s"
+
+	"github.com/spf13/cobra"
+)
+
+var permissionsCmd = &cobra.Command{
+	Use:   "permissions",
+	Short: "Check that your identity can read everything diagnose collects",
+	Long: `Permissions asks the apiserver, with SelfSubjectAccessReviews, whether the
+current identity may list pods, events, controllers, logs and the other
+resources diagnose reads, and prints what is missing with the RBAC rules
+that grant it.
+
+Required permissions make diagnose fail; without the others it skips what
+needs them with a warning. Permissions accepts every diagnose flag, so
+--logs, --nodes, --all-namespaces, --probe-connectivity and --emit-events add
+the permissions they need. It exits with an error when a required permission is missing.`,
+	Example: `  # Check access to a namespace
+  kubehelp permissions -n payments
+
+  # Include what --logs and --nodes need, for every kubeconfig context
+  kubehelp permissions -n payments --logs --nodes --all-contexts`,
+	Args: cobra.NoArgs,
+	RunE: runPermissions,
+}
+
+// permissionsReport is the --output json shape of permissions for one
+// context
+type permissionsReport struct {
+	Context string                `json:"context,omitempty"`
+	User    string                `json:"user,omitempty"`
+	Checks  []k8s.PermissionCheck `json:"checks"`
+}
+
+func runPermissions(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := applyProfile(cmd.Flags()); err != nil {
+		return err
+	}
+	resolveNamespace()
+	if diagFromFile != "" || diagBundle != "" {
+		return fmt.Errorf("permissions checks live cluster access and cannot be combined with --from-file or --bundle")
+	}
+	if diagOutput != outputText && diagOutput != outputJSON {
+		return fmt.Errorf("invalid output format %q (expected text or json)", diagOutput)
+	}
+	if _, err := k8s.ParseCustomResources(diagCustomResources); err != nil {
+		return fmt.Errorf("invalid --custom-resource: %w", err)
+	}
+	if diagAllContexts && diagContext != "" {
+		return fmt.Errorf("--all-contexts cannot be combined with --context")
+	}
+	contexts, err := kubeContexts()
+	if err != nil {
+		return err
+	}
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+
+	var reports []permissionsReport
+	missingRequired := 0
+	for _, kubeContext := range contexts {
+		report, err := checkPermissions(ctx, kubeContext)
+		if err != nil {
+			return err
+		}
+		for _, check := range report.Checks {
+			if check.Required && !check.Allowed {
+				missingRequired++
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	if diagOutput == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+	} else {
+		for i, report := range reports {
+			if i > 0 {
+				fmt.Println()
+			}
+			writePermissionsReport(os.Stdout, report)
+		}
+	}
+
+	if missingRequired > 0 {
+		return fmt.Errorf("%d required permission(s) missing", missingRequired)
+	}
+	return nil
+}
+
+// checkPermissions checks what a diagnosis with the current flags needs in
+// kubeContext (empty: the current context)
+func checkPermissions(ctx context.Context, kubeContext string) (permissionsReport, error) {
+	clientConfig := kubeClientConfig(kubeContext)
+	client, err := k8s.NewClientFromConfig(clientConfig, diagK8sTimeout)
+	if err != nil {
+		return permissionsReport{}, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	report := permissionsReport{Context: kubeContext}
+	if report.Context == "" {
+		if raw, err := clientConfig.RawConfig(); err == nil {
+			report.Context = raw.CurrentContext
+		}
+	}
+	// The user is informational; older clusters cannot report it
+	if user, err := client.Username(ctx); err == nil {
+		report.User = user
+	}
+
+	namespaces := k8s.SplitNamespaces(diagNamespace)
+	if diagAllNamespaces {
+		namespaces = []string{""}
+	}
+	// Each namespace of a list needs the same permissions; cluster-scoped
+	// ones are checked once
+	aggregator := k8s.NewAggregatorWithOptions(client, aggregatorOptions())
+	var perms []k8s.Permission
+	seen := make(map[k8s.Permission]bool)
+	for _, namespace := range namespaces {
+		for _, p := range aggregator.Permissions(namespace) {
+			if !seen[p] {
+				seen[p] = true
+				perms = append(perms, p)
+			}
+		}
+		if diagEmitEvents {
+			perms = append(perms, k8s.Permission{Verb: "create", Resource: "events", Namespace: namespace, Purpose: "--emit-events"})
+		}
+	}
+	report.Checks, err = client.CheckPermissions(ctx, perms)
+	if err != nil {
+		return permissionsReport{}, err
+	}
+	return report, nil
+}
+
+// writePermissionsReport prints each check and the RBAC rules granting the
+// missing permissions
+func writePermissionsReport(w io.Writer, report permissionsReport) {
+	who := report.User
+	if who == "" {
+		who = "the current user"
+	}
+	fmt.Fprintf(w, "🔐 Permissions of %s in context %s:\n\n", who, report.Context)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	var missing []k8s.PermissionCheck
+	missingRequired := 0
+	for _, check := range report.Checks {
+		mark := "✅"
+		if !check.Allowed {
+			missing = append(missing, check)
+			mark = "⚠️ "
+			if check.Required {
+				mark = "❌"
+				missingRequired++
+			}
+		}
+		purpose := check.Purpose
+		if check.Required {
+			purpose += " (required)"
+		}
+		fmt.Fprintf(tw, "  %s %s\t%s\n", mark, check.Permission, purpose)
+	}
+	tw.Flush()
+
+	if len(missing) == 0 {
+		fmt.Fprintln(w, "\n✅ Everything diagnose collects can be read")
+		return
+	}
+	if missingRequired > 0 {
+		fmt.Fprintf(w, "\n❌ %d required permission(s) missing; diagnose fails without them\n", missingRequired)
+	}
+	if optional := len(missing) - missingRequired; optional > 0 {
+		fmt.Fprintf(w, "\n⚠️  %d optional permission(s) missing; diagnose skips what needs them\n", optional)
+	}
+	fmt.Fprintf(w, "\nGrant them with these RBAC rules:\n\n%s", rbacRules(missing))
+}
+
+// rbacRules renders the rules granting the missing permissions, namespaced
+// ones for a Role and cluster-scoped or all-namespace ones for a ClusterRole.
+// Resources of the same API group and verb share a rule.
+func rbacRules(missing []k8s.PermissionCheck) string {
+	type rule struct {
+		group, verb string
+		resources   []string
+	}
+	var sb strings.Builder
+	for _, scope := range []struct {
+		kind    string
+		cluster bool
+	}{{"Role", false}, {"ClusterRole", true}} {
+		var rules []*rule
+		for _, check := range missing {
+			if (check.ClusterScoped || check.Namespace == "") != scope.cluster {
+				continue
+			}
+			resource := check.Resource
+			if check.Subresource != "" {
+				resource += "/" + check.Subresource
+			}
+			i := slices.IndexFunc(rules, func(r *rule) bool { return r.group == check.Group && r.verb == check.Verb })
+			if i < 0 {
+				rules = append(rules, &rule{group: check.Group, verb: check.Verb})
+				i = len(rules) - 1
+			}
+			if !slices.Contains(rules[i].resources, resource) {
+				rules[i].resources = append(rules[i].resources, resource)
+			}
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "# %s rules\n", scope.kind)
+		for _, r := range rules {
+			quoted := make([]string, len(r.resources))
+			for i, resource := range r.resources {
+				quoted[i] = strconv.Quote(resource)
+			}
+			fmt.Fprintf(&sb, "- apiGroups: [%q]\n  resources: [%s]\n  verbs: [%q]\n", r.group, strings.Join(quoted, ", "), r.verb)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
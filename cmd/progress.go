@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"kubehelp/internal/k8s"
+)
+
+// progressLine renders collection progress on stderr. On a terminal it
+// rewrites a single live line; otherwise it prints one line per completed
+// stage so logs stay readable.
+type progressLine struct {
+	mu     sync.Mutex
+	tty    bool
+	active bool
+}
+
+func newProgressLine() *progressLine {
+	info, err := os.Stderr.Stat()
+	return &progressLine{tty: err == nil && info.Mode()&os.ModeCharDevice != 0}
+}
+
+// update renders a progress report; it is safe for concurrent use
+func (p *progressLine) update(pr k8s.Progress) {
+	var msg string
+	switch {
+	case pr.Total > 0:
+		msg = fmt.Sprintf("fetched %s %d/%d", pr.Stage, pr.Count, pr.Total)
+	default:
+		msg = fmt.Sprintf("collected %d %s", pr.Count, pr.Stage)
+	}
+	p.show(fmt.Sprintf("   %s (%s)", msg, pr.Elapsed.Round(100*time.Millisecond)), pr.Total == 0 || pr.Count == pr.Total)
+}
+
+// show renders msg on the live line, or prints it when stderr is not a
+// terminal and the step is complete; it is safe for concurrent use
+func (p *progressLine) show(msg string, complete bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", msg)
+		p.active = true
+		return
+	}
+	if complete {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+// done terminates the live line
+func (p *progressLine) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active {
+		fmt.Fprintln(os.Stderr)
+		p.active = false
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"kubehelp/internal/llm"
+
+	"github.com/spf13/pflag"
+)
+
+// providerOptions configures createProvider
+type providerOptions struct {
+	// Model overrides the provider's configured model
+	Model string
+	// ModelFallback retries with known-good models when the model is not found
+	ModelFallback bool
+	// MaxInputTokens and MaxCost refuse oversized prompts unless Force is set
+	MaxInputTokens int
+	MaxCost        float64
+	Force          bool
+}
+
+// addGenerationFlags registers the sampling flags read by
+// generationSettings
+func addGenerationFlags(flags *pflag.FlagSet) {
+	flags.Float64("temperature", 0, "Sampling temperature from 0 (most deterministic) to 2 (default: provider default, 0.7 for openai, gemini and vertexai)")
+	flags.Float64("top-p", 0, "Sample only from the most likely tokens adding up to this probability (default: provider default)")
+	flags.Int("max-output-tokens", 0, "Limit the length of the LLM response to this many tokens (0: provider default)")
+}
+
+// generationSettings returns the --temperature, --top-p and
+// --max-output-tokens settings of flags. Flags that are not set keep the
+// provider defaults.
+func generationSettings(flags *pflag.FlagSet) (llm.Generation, error) {
+	var gen llm.Generation
+	if flags.Changed("temperature") {
+		temperature, _ := flags.GetFloat64("temperature")
+		gen.Temperature = &temperature
+	}
+	if flags.Changed("top-p") {
+		topP, _ := flags.GetFloat64("top-p")
+		gen.TopP = &topP
+	}
+	gen.MaxOutputTokens, _ = flags.GetInt("max-output-tokens")
+	if err := gen.Validate(); err != nil {
+		return llm.Generation{}, fmt.Errorf("invalid generation settings: %w", err)
+	}
+	return gen, nil
+}
+
+// withGeneration returns a context whose LLM requests use gen and, unless
+// systemPrompt is empty, systemPrompt instead of the default system prompt
+func withGeneration(ctx context.Context, gen llm.Generation, systemPrompt string) context.Context {
+	ctx = llm.WithGeneration(ctx, gen)
+	if systemPrompt != "" {
+		ctx = llm.WithSystemPrompt(ctx, systemPrompt)
+	}
+	return ctx
+}
+
+// providerNone selects rule-based analysis without an LLM in diagnose
+const providerNone = "none"
+
+// parseProviders splits a --llm value such as "openai,ollama" into the
+// provider names of a fallback chain
+func parseProviders(spec string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := llm.Lookup(name); !ok {
+			return nil, unsupportedProvider(name)
+		}
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("LLM provider %s is listed twice", name)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no LLM provider given")
+	}
+	return names, nil
+}
+
+// createProviders builds the providers of a --llm value. A comma-separated
+// list becomes a chain that falls back to the next provider when one fails;
+// the model override applies to the first provider only, the others use
+// their configured models.
+func createProviders(spec string, opts providerOptions) (llm.Provider, error) {
+	names, err := parseProviders(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 1 {
+		return createProvider(names[0], opts)
+	}
+
+	providers := make([]llm.Provider, 0, len(names))
+	for i, name := range names {
+		if i > 0 {
+			opts.Model = ""
+		}
+		provider, err := createProvider(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return llm.NewChainProvider(providers)
+}
+
+// noteFallbacks warns on stderr about the providers of a chain that failed
+// in its latest, successful call before the current one answered, and
+// returns the failures for the output
+func noteFallbacks(provider llm.Provider) []string {
+	chain, ok := provider.(*llm.ChainProvider)
+	if !ok {
+		return nil
+	}
+	var failures []string
+	for _, f := range chain.Failures() {
+		failures = append(failures, f.String())
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", f)
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(os.Stderr, "⚠️  Fell back to %s\n\n", chain.Name())
+	}
+	return failures
+}
+
+// printUsage reports the tokens and estimated cost of the LLM calls on
+// stderr after the output
+func printUsage(usage []llm.Usage) {
+	if len(usage) == 0 {
+		return
+	}
+	progressf("\n")
+	for _, u := range usage {
+		progressf("💰 %s\n", u)
+	}
+	if len(usage) > 1 {
+		progressf("💰 Total: %s\n", llm.TotalUsage(usage))
+	}
+}
+
+// providerLabel names a provider for progress output, listing the
+// fallbacks of a chain, e.g. "openai (fallback: ollama)"
+func providerLabel(provider llm.Provider) string {
+	chain, ok := provider.(*llm.ChainProvider)
+	if !ok {
+		return provider.Name()
+	}
+	names := chain.Names()
+	return fmt.Sprintf("%s (fallback: %s)", names[0], strings.Join(names[1:], ", "))
+}
+
+// createProvider builds the named LLM provider from its registered factory.
+// With ModelFallback set, the provider retries with known-good models when
+// the configured one is not found. Calls go through the provider's circuit
+// breaker and, unless Force is set, the provider enforces the token/cost
+// budget.
+func createProvider(name string, opts providerOptions) (llm.Provider, error) {
+	registered, ok := llm.Lookup(name)
+	if !ok {
+		return nil, unsupportedProvider(name)
+	}
+
+	// Trace each call, including those to fallback models
+	factory := llm.Traced(name, registered.New)
+
+	model := providerModel(name, opts.Model)
+	var provider llm.Provider
+	var err error
+	if opts.ModelFallback {
+		provider, err = llm.NewModelFallbackProvider(model, llm.FallbackModels(name), factory)
+	} else {
+		provider, err = factory(model)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Stop calling a provider that keeps failing, e.g. in watch mode
+	provider = llm.WithCircuitBreaker(provider, name)
+	if opts.Force {
+		return provider, nil
+	}
+
+	// Enforce the token/cost budget before anything is sent
+	return llm.WithBudget(provider, name, model, opts.MaxInputTokens, opts.MaxCost)
+}
+
+// unsupportedProvider is the error for a provider name nothing registered
+func unsupportedProvider(name string) error {
+	return fmt.Errorf("unsupported LLM provider: %s (supported: %s)", name, strings.Join(llm.Providers(), ", "))
+}
+
+// providerModel returns the model the named provider uses: override when
+// set, else the model from the provider's env var or the built-in default
+func providerModel(name, override string) string {
+	if override != "" {
+		return override
+	}
+	return llm.DefaultModel(name)
+}
+
+// ollamaProvider returns the provider of the Ollama server for model, or
+// for the configured model when model is empty
+func ollamaProvider(model string) *llm.OllamaProvider {
+	configured, baseURL := llm.OllamaEnvConfig()
+	if model == "" {
+		model = configured
+	}
+	return llm.NewOllamaProvider(model, baseURL)
+}
+
+// ollamaCheckTimeout bounds the model check of checkOllamaModel
+const ollamaCheckTimeout = 5 * time.Second
+
+// checkOllamaModel looks up the Ollama model of providers, if any, before
+// anything is collected. A missing model is an error when Ollama is the only
+// provider without --model-fallback, and a warning otherwise; an Ollama
+// server that cannot be reached is left for the analysis to report.
+func checkOllamaModel(ctx context.Context, providers []string) error {
+	i := slices.Index(providers, "ollama")
+	if i < 0 {
+		return nil
+	}
+	// --model applies to the first provider only
+	model := ""
+	if i == 0 {
+		model = diagModel
+	}
+	ctx, cancel := context.WithTimeout(ctx, ollamaCheckTimeout)
+	defer cancel()
+	err := ollamaProvider(model).CheckModel(ctx)
+	var notPulled *llm.ModelNotPulledError
+	switch {
+	case !errors.As(err, &notPulled):
+		return nil
+	case len(providers) == 1 && !diagModelFallback:
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  %v\n\n", err)
+	return nil
+}
+
+// preloadOllama starts loading the Ollama model in the background so it is
+// resident by the time the prompt is ready. The returned channel yields the
+// preload result once.
+func preloadOllama(ctx context.Context, modelOverride string) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- ollamaProvider(modelOverride).Preload(ctx)
+	}()
+	return done
+}
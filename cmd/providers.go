@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"kubehelp/internal/llm"
+
+	"github.com/spf13/cobra"
+)
+
+var providersOutput string
+
+var providersCmd = &cobra.Command{
+	Use:   "providers",
+	Short: "Show the available LLM providers",
+	Long: `Providers shows the LLM providers --llm accepts. Providers register
+themselves with llm.Register, so forks and plugins built into kubehelp show
+up here without changes to the commands.`,
+	Args: cobra.NoArgs,
+}
+
+var providersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available LLM providers with their default models",
+	Long: `List prints each registered LLM provider with the model it uses without
+--model, as configured by its environment variables, and the fallback models
+of --model-fallback.`,
+	Example: `  kubehelp providers list
+  kubehelp providers list -o json`,
+	Args: cobra.NoArgs,
+	RunE: runProvidersList,
+}
+
+// ProviderInfo is the --output json shape of providers list
+type ProviderInfo struct {
+	Name           string   `json:"name"`
+	DefaultModel   string   `json:"defaultModel,omitempty"`
+	FallbackModels []string `json:"fallbackModels,omitempty"`
+	Description    string   `json:"description,omitempty"`
+}
+
+func init() {
+	providersListCmd.Flags().StringVarP(&providersOutput, "output", "o", outputText, "Output format: text or json")
+	providersCmd.AddCommand(providersListCmd)
+}
+
+func runProvidersList(cmd *cobra.Command, args []string) error {
+	if providersOutput != outputText && providersOutput != outputJSON {
+		return fmt.Errorf("invalid output format %q (expected text or json)", providersOutput)
+	}
+
+	var providers []ProviderInfo
+	for _, name := range llm.Providers() {
+		factory, _ := llm.Lookup(name)
+		providers = append(providers, ProviderInfo{
+			Name:           name,
+			DefaultModel:   llm.DefaultModel(name),
+			FallbackModels: llm.FallbackModels(name),
+			Description:    factory.Description,
+		})
+	}
+	return writeProviders(os.Stdout, providersOutput, providers)
+}
+
+// writeProviders writes providers to w as a table or JSON
+func writeProviders(w io.Writer, format string, providers []ProviderInfo) error {
+	if format == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(providers)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDEFAULT MODEL\tFALLBACK MODELS\tDESCRIPTION")
+	for _, p := range providers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Name, dashIfEmpty(p.DefaultModel),
+			dashIfEmpty(strings.Join(p.FallbackModels, ",")), dashIfEmpty(p.Description))
+	}
+	return tw.Flush()
+}
+
+// dashIfEmpty returns s, or "-" for an empty table cell
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
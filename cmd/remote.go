@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"kubehelp/internal/analyzer"
+	"kubehelp/internal/history"
+	"kubehelp/internal/i18n"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var diagServer string
+
+// remoteFlags are the diagnose flags a kubehelp server honors, besides
+// --server itself. Others would be silently ignored and are rejected, as is
+// --profile, whose kubeconfig settings are the server's business.
+var remoteFlags = map[string]bool{
+	"namespace":          true,
+	"all-namespaces":     true,
+	"workload":           true,
+	"selector":           true,
+	"context":            true,
+	"llm":                true,
+	"best-practices":     true,
+	"logs":               true,
+	"log-lines":          true,
+	"nodes":              true,
+	"custom-resource":    true,
+	"probe-connectivity": true,
+	"events-since":       true,
+	"include-spec":       true,
+	"compact":            true,
+	"language":           true,
+	"detail-level":       true,
+	"max-prompt-tokens":  true,
+	"temperature":        true,
+	"top-p":              true,
+	"max-output-tokens":  true,
+	"system-prompt":      true,
+	"structured":         true,
+	"no-cache":           true,
+	"output":             true,
+	"quiet":              true,
+	"timeout":            true,
+	"save":               true,
+	"no-history":         true,
+	"fail-on":            true,
+}
+
+// remoteDiagnoseRequest is the body of POST /api/diagnose/stream
+type remoteDiagnoseRequest struct {
+	Namespace         string   `json:"namespace,omitempty"`
+	AllNamespaces     bool     `json:"allNamespaces,omitempty"`
+	Workloads         []string `json:"workloads,omitempty"`
+	Selector          string   `json:"selector,omitempty"`
+	LLMProvider       string   `json:"llm,omitempty"`
+	Context           string   `json:"context,omitempty"`
+	BestPractices     bool     `json:"bestPractices,omitempty"`
+	Logs              bool     `json:"logs,omitempty"`
+	LogLines          int64    `json:"logLines,omitempty"`
+	Nodes             bool     `json:"nodes,omitempty"`
+	CustomResources   []string `json:"customResources,omitempty"`
+	ProbeConnectivity bool     `json:"probeConnectivity,omitempty"`
+	EventsSince       string   `json:"eventsSince,omitempty"`
+	IncludeSpec       bool     `json:"includeSpec,omitempty"`
+	Compact           bool     `json:"compact,omitempty"`
+	Language          string   `json:"language,omitempty"`
+	DetailLevel       string   `json:"detailLevel,omitempty"`
+	MaxPromptTokens   int      `json:"maxPromptTokens,omitempty"`
+	Structured        bool     `json:"structured,omitempty"`
+	NoCache           bool     `json:"noCache,omitempty"`
+	Temperature       *float64 `json:"temperature,omitempty"`
+	TopP              *float64 `json:"topP,omitempty"`
+	MaxOutputTokens   int      `json:"maxOutputTokens,omitempty"`
+	SystemPrompt      string   `json:"systemPrompt,omitempty"`
+}
+
+// remoteDiagnoseResponse is the "result" or "error" event of the stream
+type remoteDiagnoseResponse struct {
+	Analysis       string                  `json:"analysis"`
+	Structured     *llm.StructuredAnalysis `json:"structured,omitempty"`
+	DiagnosticData *k8s.DiagnosticData     `json:"diagnosticData,omitempty"`
+	Usage          []llm.Usage             `json:"usage,omitempty"`
+	Cached         bool                    `json:"cached,omitempty"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+// remoteProgress is the "progress" event of the stream
+type remoteProgress struct {
+	Stage     string `json:"stage"`
+	Count     int    `json:"count"`
+	Total     int    `json:"total"`
+	ElapsedMs int64  `json:"elapsedMs"`
+	Message   string `json:"message"`
+}
+
+// diagnoseRemote runs the diagnosis on the kubehelp server at --server,
+// which collects with its own credentials and analyzes with its own
+// providers, and prints the result like a local diagnosis
+func diagnoseRemote(ctx context.Context, cmd *cobra.Command) error {
+	start := time.Now()
+	var unsupported []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Name != "server" && !remoteFlags[f.Name] {
+			unsupported = append(unsupported, "--"+f.Name)
+		}
+	})
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("%s cannot be combined with --server, which collects and analyzes on the server", strings.Join(unsupported, ", "))
+	}
+	if diagLLMProvider == providerNone || strings.Contains(diagLLMProvider, ",") {
+		return fmt.Errorf("--server analyzes with a single provider of the server; --llm none and fallback lists are not supported")
+	}
+	if !slices.Contains(outputFormats, diagOutput) {
+		return fmt.Errorf("invalid output format %q (expected %s)", diagOutput, strings.Join(outputFormats, ", "))
+	}
+	if diagAllNamespaces && strings.Contains(diagNamespace, ",") {
+		return fmt.Errorf("--all-namespaces cannot be combined with a namespace list")
+	}
+	generation, err := generationSettings(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	// The server lists the namespaces itself with --all-namespaces
+	namespace, target := "", "all namespaces"
+	if !diagAllNamespaces {
+		resolveNamespace()
+		namespace, target = diagNamespace, "namespace '"+diagNamespace+"'"
+	}
+
+	body, err := json.Marshal(remoteDiagnoseRequest{
+		Namespace:         namespace,
+		AllNamespaces:     diagAllNamespaces,
+		Workloads:         diagWorkloads,
+		Selector:          diagSelector,
+		LLMProvider:       diagLLMProvider,
+		Context:           diagContext,
+		BestPractices:     diagBestPractices,
+		Logs:              diagLogs,
+		LogLines:          diagLogLines,
+		Nodes:             diagNodes,
+		CustomResources:   diagCustomResources,
+		ProbeConnectivity: diagProbeConnectivity,
+		EventsSince:       diagEventsSince.String(),
+		IncludeSpec:       diagIncludeSpec,
+		Compact:           diagCompact,
+		Language:          diagLanguage,
+		DetailLevel:       diagDetailLevel,
+		MaxPromptTokens:   diagMaxPromptTokens,
+		Structured:        diagStructured,
+		NoCache:           diagNoCache,
+		Temperature:       generation.Temperature,
+		TopP:              generation.TopP,
+		MaxOutputTokens:   generation.MaxOutputTokens,
+		SystemPrompt:      diagSystemPrompt,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := newServerRequest(ctx, http.MethodPost, diagServer, "/api/diagnose/stream", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	progressf("🌐 Diagnosing %s through %s...\n", target, diagServer)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", diagServer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return serverError(resp)
+	}
+
+	progress := newProgressLine()
+	result, err := readRemoteDiagnosis(resp.Body, func(p remoteProgress) {
+		switch {
+		case diagQuiet:
+		case p.Stage == "analysis":
+			// Sent once collection is done
+			progress.done()
+			progressf("🤖 Server is %s...\n", p.Message)
+		default:
+			progress.update(k8s.Progress{Stage: p.Stage, Count: p.Count, Total: p.Total, Elapsed: time.Duration(p.ElapsedMs) * time.Millisecond})
+		}
+	})
+	progress.done()
+	if err != nil {
+		return err
+	}
+	data := result.DiagnosticData
+	if data == nil {
+		return fmt.Errorf("server returned no diagnostic data")
+	}
+
+	progressf("✅ Collected data: %d pods, %d events\n\n", len(data.Pods), len(data.Events))
+	for _, w := range data.Warnings {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n\n", w)
+	}
+	if len(data.Findings) > 0 {
+		progressf("📋 %d findings detected\n\n", len(data.Findings))
+	}
+	if result.Cached {
+		progressf("♻️  The server reused a cached analysis (--no-cache to run it again)\n\n")
+	}
+	if diagSave != "" {
+		if err := k8s.SaveDiagnosticData(diagSave, data); err != nil {
+			return err
+		}
+		progressf("💾 Saved diagnostic data to %s\n\n", diagSave)
+	}
+
+	out := DiagnoseResult{
+		Provider:    diagLLMProvider,
+		Analysis:    result.Analysis,
+		Structured:  result.Structured,
+		PreAnalysis: analyzer.Analyze(data),
+		Usage:       result.Usage,
+		Cached:      result.Cached,
+		Data:        data,
+	}
+	out.Severity = resultStatus(out)
+	diagStatus = out.Severity
+	msg := i18n.For(diagLanguage)
+	if diagOutput == outputText {
+		progressf("%s\n", msg.AnalysisBanner)
+	}
+	if err := writeDiagnoseResult(os.Stdout, diagOutput, out); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if diagOutput == outputText {
+		progressf("%s\n", msg.EndAnalysisBanner)
+	}
+	progressf("🚦 %s: %s\n", msg.Severity, statusLabel(out.Severity))
+	printUsage(result.Usage)
+
+	if !diagNoHistory {
+		recordDiagnosis(cmd.Flags(), history.Record{
+			Namespace:      data.Namespace,
+			Workloads:      data.Workloads,
+			Context:        data.ContextName,
+			Provider:       diagLLMProvider,
+			Analysis:       out.Analysis,
+			DurationMs:     time.Since(start).Milliseconds(),
+			DiagnosticData: data,
+		})
+	}
+	return nil
+}
+
+// readRemoteDiagnosis reads the Server-Sent Events of a streamed diagnosis,
+// passing progress events to onProgress, until its result or error event
+func readRemoteDiagnosis(r io.Reader, onProgress func(remoteProgress)) (*remoteDiagnoseResponse, error) {
+	reader := bufio.NewReader(r)
+	var event string
+	var data []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && (len(line) == 0 || !errors.Is(err, io.EOF)) {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("server closed the stream before the result")
+			}
+			return nil, fmt.Errorf("failed to read the server's response: %w", err)
+		}
+		line = bytes.TrimRight(line, "\r\n")
+
+		switch {
+		case bytes.HasPrefix(line, []byte("event:")):
+			event = string(bytes.TrimSpace(line[len("event:"):]))
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimPrefix(line[len("data:"):], []byte(" "))...)
+		case len(line) == 0 && event != "":
+			// A blank line ends the event
+			switch event {
+			case "progress":
+				var p remoteProgress
+				if json.Unmarshal(data, &p) == nil {
+					onProgress(p)
+				}
+			case "result", "error":
+				var resp remoteDiagnoseResponse
+				if err := json.Unmarshal(data, &resp); err != nil {
+					return nil, fmt.Errorf("failed to decode server response: %w", err)
+				}
+				if resp.Error != "" {
+					return nil, fmt.Errorf("server diagnosis failed: %s", resp.Error)
+				}
+				return &resp, nil
+			}
+			event, data = "", nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("server closed the stream before the result")
+		}
+	}
+}
+
+// newServerRequest creates a request to path on the kubehelp server at
+// server, authenticated with $KUBEHELP_API_TOKEN if set
+func newServerRequest(ctx context.Context, method, server, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(server, "/")+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --server: %w", err)
+	}
+	if token := os.Getenv("KUBEHELP_API_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// serverError describes a failed response, with the server's error message
+// when it sent one
+func serverError(resp *http.Response) error {
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+		return fmt.Errorf("server returned %s: %s", resp.Status, apiErr.Error)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("server returned %s; set KUBEHELP_API_TOKEN", resp.Status)
+	}
+	return fmt.Errorf("server returned %s", resp.Status)
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kubehelp/internal/jobs"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxAlertDiagnoses bounds the diagnoses one alert notification starts;
+// Alertmanager groups may hold alerts from many namespaces
+const maxAlertDiagnoses = 5
+
+// maxIncidentNoteLength is the longest note PagerDuty and Opsgenie accept
+const maxIncidentNoteLength = 25000
+
+// Default API endpoints; Opsgenie's EU instance is https://api.eu.opsgenie.com
+const (
+	defaultPagerDutyURL = "https://api.pagerduty.com"
+	defaultOpsgenieURL  = "https://api.opsgenie.com"
+)
+
+// alertNamespaceLabels name the namespace of an alert, in order of
+// preference; exported_namespace is set when Prometheus renamed a
+// conflicting namespace label of kube-state-metrics
+var alertNamespaceLabels = []string{"namespace", "exported_namespace"}
+
+// alertWorkloadLabels map the workload labels of kube-state-metrics alerts
+// to the kind of workload they name
+var alertWorkloadLabels = []struct{ label, kind string }{
+	{"deployment", "deployment"},
+	{"statefulset", "statefulset"},
+	{"daemonset", "daemonset"},
+	{"job_name", "job"},
+}
+
+// AlertmanagerPayload is the body of an Alertmanager webhook notification
+// (version 4)
+type AlertmanagerPayload struct {
+	Version string `json:"version"`
+	// GroupKey identifies the alert group; Alertmanager derives the
+	// PagerDuty dedup key and Opsgenie alias of the group from it
+	GroupKey     string            `json:"groupKey"`
+	Status       string            `json:"status"`
+	Receiver     string            `json:"receiver"`
+	CommonLabels map[string]string `json:"commonLabels,omitempty"`
+	ExternalURL  string            `json:"externalURL,omitempty"`
+	Alerts       []Alert           `json:"alerts"`
+}
+
+// Alert is one alert of an Alertmanager notification
+type Alert struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
+}
+
+// GenericAlert is the body of /api/webhooks/generic: a diagnose request
+// whose namespace, workloads and context may come from alert labels
+// instead, and the incidents to add the analysis to
+type GenericAlert struct {
+	DiagnoseRequest
+	// Labels are mapped like Alertmanager alert labels to the namespace,
+	// workloads and context the request leaves unset
+	Labels map[string]string `json:"labels,omitempty"`
+	// PagerDutyIncident is the ID of a PagerDuty incident, e.g. "Q1ABC2DEF3GH4I"
+	PagerDutyIncident string `json:"pagerdutyIncident,omitempty"`
+	// OpsgenieAlias is the alias of an Opsgenie alert
+	OpsgenieAlias string `json:"opsgenieAlias,omitempty"`
+}
+
+// AlertWebhookResponse lists the diagnosis jobs an alert started, readable
+// from /api/jobs/{id}
+type AlertWebhookResponse struct {
+	Jobs []*jobs.Job `json:"jobs"`
+	// Ignored says why alerts were not diagnosed
+	Ignored []string `json:"ignored,omitempty"`
+}
+
+// incidentRef names the incident an analysis is added to
+type incidentRef struct {
+	// key is the PagerDuty dedup key and Opsgenie alias Alertmanager gives
+	// the incident of an alert group
+	key               string
+	pagerDutyIncident string
+	opsgenieAlias     string
+}
+
+// incidentTracker adds analyses to incidents of an incident management tool
+type incidentTracker interface {
+	// attach adds note to the incident of ref; refs without an incident of
+	// the tool are ignored
+	attach(ctx context.Context, ref incidentRef, note string) error
+	String() string
+}
+
+// alertWebhook starts diagnoses for alerts and adds their analyses to the
+// incidents the alerts opened
+type alertWebhook struct {
+	runner   *jobRunner
+	trackers []incidentTracker
+	// provider analyzes alert diagnoses (KUBEHELP_ALERT_LLM)
+	provider string
+	// contextLabel, when set, names the alert label holding the kubeconfig
+	// context to diagnose (KUBEHELP_ALERT_CONTEXT_LABEL)
+	contextLabel string
+}
+
+// newAlertWebhookFromEnv configures the alert webhooks. Analyses are added
+// to PagerDuty incidents with KUBEHELP_PAGERDUTY_TOKEN, a REST API key, and
+// KUBEHELP_PAGERDUTY_FROM, the email of the user the notes are added as,
+// and to Opsgenie alerts with KUBEHELP_OPSGENIE_API_KEY.
+// KUBEHELP_PAGERDUTY_URL and KUBEHELP_OPSGENIE_URL override the API
+// endpoints.
+func newAlertWebhookFromEnv(runner *jobRunner) (*alertWebhook, error) {
+	h := &alertWebhook{
+		runner:       runner,
+		provider:     getEnv("KUBEHELP_ALERT_LLM", defaultLLMProvider),
+		contextLabel: os.Getenv("KUBEHELP_ALERT_CONTEXT_LABEL"),
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if token := os.Getenv("KUBEHELP_PAGERDUTY_TOKEN"); token != "" {
+		from := os.Getenv("KUBEHELP_PAGERDUTY_FROM")
+		if from == "" {
+			return nil, fmt.Errorf("KUBEHELP_PAGERDUTY_FROM must be set with KUBEHELP_PAGERDUTY_TOKEN")
+		}
+		h.trackers = append(h.trackers, &pagerDuty{
+			url:    strings.TrimSuffix(getEnv("KUBEHELP_PAGERDUTY_URL", defaultPagerDutyURL), "/"),
+			token:  token,
+			from:   from,
+			client: client,
+		})
+	}
+	if key := os.Getenv("KUBEHELP_OPSGENIE_API_KEY"); key != "" {
+		h.trackers = append(h.trackers, &opsgenie{
+			url:    strings.TrimSuffix(getEnv("KUBEHELP_OPSGENIE_URL", defaultOpsgenieURL), "/"),
+			key:    key,
+			client: client,
+		})
+	}
+	return h, nil
+}
+
+// String lists the tools analyses are added to
+func (h *alertWebhook) String() string {
+	if len(h.trackers) == 0 {
+		return "none"
+	}
+	names := make([]string, len(h.trackers))
+	for i, t := range h.trackers {
+		names[i] = t.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// alertmanagerHandler diagnoses the namespaces of the firing alerts of an
+// Alertmanager notification, one job per context and namespace, and adds
+// each analysis to the incident Alertmanager opened for the group. It
+// responds before the diagnoses finish, so Alertmanager does not time out
+// and resend the notification.
+func (h *alertWebhook) alertmanagerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload AlertmanagerPayload
+	if err := decodeJSONBody(w, r, &payload, maxRequestBytes); err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp AlertWebhookResponse
+	requests := make(map[string]*DiagnoseRequest)
+	// wholeNamespace marks requests with an alert that names no workload
+	wholeNamespace := make(map[string]bool)
+	for _, alert := range payload.Alerts {
+		if alert.Status != "firing" {
+			continue
+		}
+		req := h.alertRequest(alert.Labels)
+		if req.Namespace == "" {
+			resp.Ignored = append(resp.Ignored, fmt.Sprintf("alert %s has no namespace label", alertName(alert.Labels)))
+			continue
+		}
+		key := req.Namespace
+		if req.Context != "" {
+			key = req.Context + "/" + req.Namespace
+		}
+		if existing, ok := requests[key]; ok {
+			existing.Workloads = append(existing.Workloads, req.Workloads...)
+		} else {
+			requests[key] = &req
+		}
+		if len(req.Workloads) == 0 {
+			wholeNamespace[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(requests))
+	for key := range requests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > maxAlertDiagnoses {
+		resp.Ignored = append(resp.Ignored, fmt.Sprintf("only the first %d of %d namespaces are diagnosed: skipped %s",
+			maxAlertDiagnoses, len(keys), strings.Join(keys[maxAlertDiagnoses:], ", ")))
+		keys = keys[:maxAlertDiagnoses]
+	}
+	if len(keys) == 0 {
+		if len(resp.Ignored) == 0 {
+			resp.Ignored = append(resp.Ignored, "no firing alerts")
+		}
+		respondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	ref := incidentRef{key: alertmanagerIncidentKey(payload.GroupKey)}
+	for _, key := range keys {
+		req := requests[key]
+		if wholeNamespace[key] {
+			req.Workloads = nil
+		} else {
+			req.Workloads = dedupe(req.Workloads)
+		}
+		job, err := h.start(r, *req, ref)
+		if err != nil {
+			resp.Ignored = append(resp.Ignored, fmt.Sprintf("namespace %s: %v", key, err))
+			continue
+		}
+		resp.Jobs = append(resp.Jobs, job)
+	}
+	log.Printf("🔔 Alertmanager notification from %s started %d diagnoses", payload.Receiver, len(resp.Jobs))
+	if len(resp.Jobs) == 0 {
+		respondWithJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, resp)
+}
+
+// genericHandler diagnoses a GenericAlert and adds the analysis to the
+// incidents it names
+func (h *alertWebhook) genericHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var alert GenericAlert
+	if err := decodeJSONBody(w, r, &alert, maxRequestBytes); err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := alert.DiagnoseRequest
+	mapped := h.alertRequest(alert.Labels)
+	if req.Namespace == "" && len(req.Namespaces) == 0 && !req.AllNamespaces {
+		req.Namespace = mapped.Namespace
+	}
+	if len(req.Workloads) == 0 {
+		req.Workloads = mapped.Workloads
+	}
+	if req.Context == "" {
+		req.Context = mapped.Context
+	}
+	if req.LLMProvider == "" {
+		req.LLMProvider = h.provider
+	}
+	if req.Namespace == "" && len(req.Namespaces) == 0 && !req.AllNamespaces {
+		respondWithError(w, "namespace or a namespace label is required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.start(r, req, incidentRef{pagerDutyIncident: alert.PagerDutyIncident, opsgenieAlias: alert.OpsgenieAlias})
+	if err != nil {
+		status := http.StatusInternalServerError
+		var msg *ErrorWithMessage
+		if errors.As(err, &msg) {
+			status = http.StatusBadRequest
+		}
+		respondWithError(w, err.Error(), status)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, AlertWebhookResponse{Jobs: []*jobs.Job{job}})
+}
+
+// alertRequest maps alert labels to the namespace, workload and context of
+// a diagnose request. Alert diagnoses include logs.
+func (h *alertWebhook) alertRequest(labels map[string]string) DiagnoseRequest {
+	req := DiagnoseRequest{LLMProvider: h.provider, Logs: true}
+	for _, label := range alertNamespaceLabels {
+		if ns := labels[label]; ns != "" {
+			req.Namespace = ns
+			break
+		}
+	}
+	for _, w := range alertWorkloadLabels {
+		if name := labels[w.label]; name != "" {
+			req.Workloads = append(req.Workloads, w.kind+"/"+name)
+		}
+	}
+	if h.contextLabel != "" {
+		req.Context = labels[h.contextLabel]
+	}
+	return req
+}
+
+// start validates req and runs it as a job whose outcome is added to the
+// incident of ref
+func (h *alertWebhook) start(r *http.Request, req DiagnoseRequest, ref incidentRef) (*jobs.Job, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	return h.runner.start(req, trace.SpanContextFromContext(r.Context()), func(ctx context.Context, resp *DiagnoseResponse, err error) {
+		note := incidentNote(req, resp, err)
+		for _, t := range h.trackers {
+			if err := t.attach(ctx, ref, note); err != nil {
+				log.Printf("⚠️  Failed to add the analysis of namespace %s to %s: %v", req.Namespace, t, err)
+			}
+		}
+	})
+}
+
+// incidentNote renders the outcome of an alert diagnosis as an incident
+// note, truncated to maxIncidentNoteLength
+func incidentNote(req DiagnoseRequest, resp *DiagnoseResponse, err error) string {
+	req.resolveNamespace()
+	target := "namespace " + req.Namespace
+	if len(req.Workloads) > 0 {
+		target += " (" + strings.Join(req.Workloads, ", ") + ")"
+	}
+	if req.Context != "" {
+		target += " in context " + req.Context
+	}
+	if err != nil {
+		return fmt.Sprintf("kubehelp could not diagnose %s: %v", target, err)
+	}
+
+	note := fmt.Sprintf("kubehelp analysis of %s:\n\n%s", target, resp.Analysis)
+	if runes := []rune(note); len(runes) > maxIncidentNoteLength {
+		const suffix = "\n\n… (truncated)"
+		note = string(runes[:maxIncidentNoteLength-len([]rune(suffix))]) + suffix
+	}
+	return note
+}
+
+// alertmanagerIncidentKey returns the dedup key and alias Alertmanager's
+// PagerDuty and Opsgenie integrations give the incident of a group: the
+// hex SHA-256 of its group key
+func alertmanagerIncidentKey(groupKey string) string {
+	if groupKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(groupKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// alertName returns the alertname label of an alert, for messages
+func alertName(labels map[string]string) string {
+	if name := labels["alertname"]; name != "" {
+		return name
+	}
+	return "without alertname"
+}
+
+// dedupe returns values without duplicates, keeping the first occurrence
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// pagerDuty adds notes to PagerDuty incidents through the REST API
+type pagerDuty struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+func (p *pagerDuty) String() string { return "PagerDuty" }
+
+// attach adds note to the incident of ref, looking up Alertmanager
+// incidents by their dedup key
+func (p *pagerDuty) attach(ctx context.Context, ref incidentRef, note string) error {
+	id := ref.pagerDutyIncident
+	if id == "" {
+		if ref.key == "" {
+			return nil
+		}
+		var found struct {
+			Incidents []struct {
+				ID string `json:"id"`
+			} `json:"incidents"`
+		}
+		query := url.Values{"incident_key": {ref.key}}
+		if err := p.do(ctx, http.MethodGet, "/incidents?"+query.Encode(), nil, &found); err != nil {
+			return err
+		}
+		if len(found.Incidents) == 0 {
+			return fmt.Errorf("no incident with key %s", ref.key)
+		}
+		id = found.Incidents[0].ID
+	}
+
+	body := map[string]any{"note": map[string]string{"content": note}}
+	if err := p.do(ctx, http.MethodPost, "/incidents/"+url.PathEscape(id)+"/notes", body, nil); err != nil {
+		return err
+	}
+	log.Printf("Added the analysis to PagerDuty incident %s", id)
+	return nil
+}
+
+// do sends a PagerDuty API request and decodes the response into out, if set
+func (p *pagerDuty) do(ctx context.Context, method, path string, body, out any) error {
+	req, err := newIncidentRequest(ctx, method, p.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token token="+p.token)
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+	req.Header.Set("From", p.from)
+	return doIncidentRequest(p.client, req, out)
+}
+
+// opsgenie adds notes to Opsgenie alerts through the Alert API
+type opsgenie struct {
+	url    string
+	key    string
+	client *http.Client
+}
+
+func (o *opsgenie) String() string { return "Opsgenie" }
+
+// attach adds note to the alert of ref, identified by its alias
+func (o *opsgenie) attach(ctx context.Context, ref incidentRef, note string) error {
+	alias := ref.opsgenieAlias
+	if alias == "" {
+		alias = ref.key
+	}
+	if alias == "" {
+		return nil
+	}
+
+	body := map[string]string{"note": note, "source": "kubehelp", "user": "kubehelp"}
+	req, err := newIncidentRequest(ctx, http.MethodPost, o.url+"/v2/alerts/"+url.PathEscape(alias)+"/notes?identifierType=alias", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "GenieKey "+o.key)
+	if err := doIncidentRequest(o.client, req, nil); err != nil {
+		return err
+	}
+	log.Printf("Added the analysis to Opsgenie alert %s", alias)
+	return nil
+}
+
+// newIncidentRequest creates an API request with body encoded as JSON
+func newIncidentRequest(ctx context.Context, method, target string, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// doIncidentRequest sends req and decodes the response into out, if set,
+// returning the start of the body of unsuccessful responses as the error
+func doIncidentRequest(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("invalid response from %s: %w", req.URL.Host, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// defaultGroupsClaim is the ID token claim listing the user's groups
+const defaultGroupsClaim = "groups"
+
+var (
+	errInvalidToken = errors.New("invalid or expired API token")
+	errNotInGroup   = errors.New("not in an allowed group")
+)
+
+// authenticator checks the bearer token of /api/* requests against static
+// API tokens and, when an issuer is configured, OIDC ID tokens. Without
+// either, authentication is disabled.
+type authenticator struct {
+	// tokens holds the SHA-256 of each static token, so lookups compare
+	// fixed-size digests in constant time
+	tokens   [][sha256.Size]byte
+	verifier *oidc.IDTokenVerifier
+	// allowedGroups, when set, restricts OIDC users to members of one of
+	// these groups, read from groupsClaim
+	allowedGroups []string
+	groupsClaim   string
+	// clientCerts accepts requests whose TLS client certificate the server
+	// verified against KUBEHELP_TLS_CLIENT_CA
+	clientCerts bool
+}
+
+// newAuthenticatorFromEnv configures authentication from
+// KUBEHELP_API_TOKENS (comma-separated), KUBEHELP_API_TOKENS_FILE (one token
+// per line, # comments) and KUBEHELP_OIDC_ISSUER with KUBEHELP_OIDC_AUDIENCE,
+// KUBEHELP_OIDC_ALLOWED_GROUPS and KUBEHELP_OIDC_GROUPS_CLAIM. OIDC discovery
+// runs at startup, so the issuer must be reachable.
+func newAuthenticatorFromEnv(ctx context.Context) (*authenticator, error) {
+	a := &authenticator{groupsClaim: getEnv("KUBEHELP_OIDC_GROUPS_CLAIM", defaultGroupsClaim)}
+
+	for _, token := range strings.Split(os.Getenv("KUBEHELP_API_TOKENS"), ",") {
+		a.addToken(token)
+	}
+	if path := os.Getenv("KUBEHELP_API_TOKENS_FILE"); path != "" {
+		if err := a.loadTokenFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if issuer := os.Getenv("KUBEHELP_OIDC_ISSUER"); issuer != "" {
+		audience := os.Getenv("KUBEHELP_OIDC_AUDIENCE")
+		if audience == "" {
+			return nil, fmt.Errorf("KUBEHELP_OIDC_AUDIENCE must be set with KUBEHELP_OIDC_ISSUER")
+		}
+		provider, err := oidc.NewProvider(ctx, issuer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover OIDC issuer %s: %w", issuer, err)
+		}
+		a.verifier = provider.Verifier(&oidc.Config{ClientID: audience})
+		for _, group := range strings.Split(os.Getenv("KUBEHELP_OIDC_ALLOWED_GROUPS"), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				a.allowedGroups = append(a.allowedGroups, group)
+			}
+		}
+	}
+	return a, nil
+}
+
+func (a *authenticator) addToken(token string) {
+	if token = strings.TrimSpace(token); token != "" {
+		a.tokens = append(a.tokens, sha256.Sum256([]byte(token)))
+	}
+}
+
+// loadTokenFile adds the tokens of a file, e.g. a mounted Secret, with one
+// token per line; blank lines and lines starting with # are skipped
+func (a *authenticator) loadTokenFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read API tokens file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		a.addToken(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read API tokens file: %w", err)
+	}
+	return nil
+}
+
+// enabled reports whether any authentication method is configured
+func (a *authenticator) enabled() bool {
+	return len(a.tokens) > 0 || a.verifier != nil || a.clientCerts
+}
+
+// String describes the configured methods for the startup log
+func (a *authenticator) String() string {
+	var methods []string
+	if len(a.tokens) > 0 {
+		methods = append(methods, fmt.Sprintf("%d static tokens", len(a.tokens)))
+	}
+	if a.verifier != nil {
+		method := "OIDC"
+		if len(a.allowedGroups) > 0 {
+			method += " (groups " + strings.Join(a.allowedGroups, ", ") + ")"
+		}
+		methods = append(methods, method)
+	}
+	if a.clientCerts {
+		methods = append(methods, "client certificates")
+	}
+	return strings.Join(methods, " and ")
+}
+
+// authenticate returns who the bearer token belongs to, "token" for static
+// tokens or the OIDC subject. It fails with errInvalidToken or, for OIDC
+// users outside the allowed groups, errNotInGroup.
+func (a *authenticator) authenticate(ctx context.Context, token string) (string, error) {
+	digest := sha256.Sum256([]byte(token))
+	for _, known := range a.tokens {
+		if subtle.ConstantTimeCompare(digest[:], known[:]) == 1 {
+			return "token", nil
+		}
+	}
+	if a.verifier == nil {
+		return "", errInvalidToken
+	}
+
+	idToken, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+	if len(a.allowedGroups) > 0 {
+		var claims map[string]any
+		if err := idToken.Claims(&claims); err != nil {
+			return "", fmt.Errorf("%w: %v", errInvalidToken, err)
+		}
+		if !slices.ContainsFunc(claimStrings(claims[a.groupsClaim]), func(g string) bool {
+			return slices.Contains(a.allowedGroups, g)
+		}) {
+			return "", fmt.Errorf("user %s is %w", idToken.Subject, errNotInGroup)
+		}
+	}
+	return idToken.Subject, nil
+}
+
+// claimStrings returns a string or list-of-strings claim as a slice
+func claimStrings(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// requireAuth rejects /api/* requests without a valid bearer token or
+// verified client certificate with 401 Unauthorized. The health check stays open for probes, and other paths,
+// such as the web UI and /metrics, are served unauthenticated.
+func (a *authenticator) requireAuth(next http.Handler) http.Handler {
+	if !a.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A certificate the handshake verified needs no token
+		if a.clientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			log.Printf("%s %s authenticated as client certificate %s", r.Method, r.URL.Path, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kubehelp"`)
+			respondWithNegotiatedError(w, r, "authentication required: send an API token as \"Authorization: Bearer <token>\"", http.StatusUnauthorized)
+			return
+		}
+
+		subject, err := a.authenticate(r.Context(), token)
+		if errors.Is(err, errNotInGroup) {
+			log.Printf("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			respondWithNegotiatedError(w, r, "forbidden: "+errNotInGroup.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			// Verification details stay in the log
+			log.Printf("Rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kubehelp", error="invalid_token"`)
+			respondWithNegotiatedError(w, r, errInvalidToken.Error(), http.StatusUnauthorized)
+			return
+		}
+		log.Printf("%s %s authenticated as %s", r.Method, r.URL.Path, subject)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerToken returns the token of the Authorization header. Browsers cannot
+// set headers on WebSockets, so a WebSocket handshake may instead offer the
+// token as a "base64url.bearer.kubehelp.<token>" subprotocol, base64url
+// encoded without padding as Kubernetes does for its API.
+func bearerToken(r *http.Request) (string, bool) {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok {
+		token = strings.TrimSpace(token)
+		return token, strings.EqualFold(scheme, "Bearer") && token != ""
+	}
+	for _, protocol := range webSocketProtocols(r) {
+		encoded, ok := strings.CutPrefix(protocol, wsBearerProtocolPrefix)
+		if !ok {
+			continue
+		}
+		token, err := base64.RawURLEncoding.DecodeString(encoded)
+		return string(token), err == nil && len(token) > 0
+	}
+	return "", false
+}
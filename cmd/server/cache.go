@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"kubehelp/internal/cache"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+)
+
+// analysisCache holds analyses of unchanged diagnostic data in memory, or is
+// nil when KUBEHELP_CACHE_TTL is 0
+var analysisCache *cache.Cache
+
+// newAnalysisCacheFromEnv creates the analysis cache with the TTL from
+// KUBEHELP_CACHE_TTL (default 10m)
+func newAnalysisCacheFromEnv() *cache.Cache {
+	ttl := cache.DefaultTTL
+	if value := getEnv("KUBEHELP_CACHE_TTL", ""); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("⚠️  Invalid KUBEHELP_CACHE_TTL %q, using %s", value, ttl)
+		} else {
+			ttl = parsed
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	c, _ := cache.New("", ttl)
+	return c
+}
+
+// analysisCacheKey returns the cache key of analyzing data with the named
+// provider, settings and KUBEHELP_PROMPT_TEMPLATE, if any, or "" when the
+// analysis is not to be cached
+func analysisCacheKey(data *k8s.DiagnosticData, providerName string, settings PromptSettings) string {
+	if analysisCache == nil || data == nil || settings.NoCache {
+		return ""
+	}
+	language := settings.Language
+	if language == "" {
+		language = llm.DefaultLanguage()
+	}
+	options := []string{
+		"compact=" + strconv.FormatBool(settings.Compact),
+		"detail-level=" + settings.DetailLevel,
+		"max-prompt-tokens=" + strconv.Itoa(settings.MaxPromptTokens),
+		"language=" + language,
+		"structured=" + strconv.FormatBool(settings.Structured),
+		"generation=" + settings.generation().String(),
+		"system-prompt=" + settings.SystemPrompt,
+	}
+	// The template replaces the built-in prompt, so analyses made with
+	// another one must not be served
+	if promptTemplate != nil {
+		options = append(options, "prompt-template="+promptTemplate.Source())
+	}
+	key, err := cache.Key(data, providerName, providerModel(providerName), options...)
+	if err != nil {
+		log.Printf("⚠️  Not caching the analysis: %v", err)
+		return ""
+	}
+	return key
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"kubehelp/internal/cache"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+)
+
+func TestAnalysisCacheKeyIncludesPromptTemplate(t *testing.T) {
+	c, err := cache.New("", time.Minute)
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	oldCache, oldTemplate := analysisCache, promptTemplate
+	analysisCache = c
+	t.Cleanup(func() { analysisCache, promptTemplate = oldCache, oldTemplate })
+
+	data := &k8s.DiagnosticData{Namespace: "default"}
+	key := func(text string) string {
+		t.Helper()
+		promptTemplate = nil
+		if text != "" {
+			if promptTemplate, err = llm.ParsePromptTemplate("custom", text); err != nil {
+				t.Fatalf("ParsePromptTemplate: %v", err)
+			}
+		}
+		return analysisCacheKey(data, "ollama", PromptSettings{})
+	}
+
+	builtin, first, second := key(""), key("Diagnose {{.Namespace}}"), key("Explain {{.Namespace}}")
+	if builtin == "" || first == "" || second == "" {
+		t.Fatal("analysis not cached")
+	}
+	if builtin == first || first == second {
+		t.Errorf("keys do not change with the template: built-in %s, first %s, second %s", builtin, first, second)
+	}
+	if again := key("Diagnose {{.Namespace}}"); again != first {
+		t.Errorf("key of the same template changed: %s, then %s", first, again)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Defaults of the CORS policy, which lets any origin call the API; clients
+// authenticate with a token, not cookies
+var (
+	defaultCORSOrigins = []string{"*"}
+	defaultCORSMethods = []string{"POST", "GET", "OPTIONS"}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "Prefer"}
+)
+
+// corsExposedHeaders are the response headers scripts may read: where an
+// async job is polled and when to retry a shed request
+const corsExposedHeaders = "Location, Retry-After"
+
+// cors is the CORS policy of the API and the WebSocket handshake
+var cors = &corsPolicy{origins: defaultCORSOrigins, methods: defaultCORSMethods, headers: defaultCORSHeaders}
+
+// corsPolicy decides which browser origins may call the server and with
+// which methods and headers
+type corsPolicy struct {
+	// disabled sends no CORS headers, so browsers only allow the web UI
+	// served by the server itself
+	disabled bool
+	// origins are exact origins such as "https://ops.example.com",
+	// wildcard subdomains such as "https://*.example.com", or "*" for any
+	origins []string
+	methods []string
+	headers []string
+	// maxAge is how long browsers may cache a preflight (0: browser default)
+	maxAge time.Duration
+}
+
+// corsFile is the file named by KUBEHELP_CORS_CONFIG:
+//
+//	origins:
+//	- https://ops.example.com
+//	- https://*.internal.example.com
+//	methods: [GET, POST, OPTIONS]
+//	headers: [Authorization, Content-Type, Prefer, X-Request-ID]
+//	maxAge: 10m
+//
+// or, for internal deployments, "disabled: true".
+type corsFile struct {
+	Disabled bool     `json:"disabled,omitempty"`
+	Origins  []string `json:"origins,omitempty"`
+	Methods  []string `json:"methods,omitempty"`
+	Headers  []string `json:"headers,omitempty"`
+	MaxAge   string   `json:"maxAge,omitempty"`
+}
+
+// newCORSPolicyFromEnv reads the policy from KUBEHELP_CORS_CONFIG, then
+// overrides it with the comma-separated KUBEHELP_CORS_ORIGINS ("none"
+// disables CORS), KUBEHELP_CORS_METHODS and KUBEHELP_CORS_HEADERS and with
+// KUBEHELP_CORS_MAX_AGE. Unset settings keep the defaults.
+func newCORSPolicyFromEnv() (*corsPolicy, error) {
+	var file corsFile
+	if path := os.Getenv("KUBEHELP_CORS_CONFIG"); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CORS config: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(raw, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse CORS config %s: %w", path, err)
+		}
+	}
+
+	p := &corsPolicy{
+		disabled: file.Disabled,
+		origins:  listFromEnv("KUBEHELP_CORS_ORIGINS", file.Origins, defaultCORSOrigins),
+		methods:  listFromEnv("KUBEHELP_CORS_METHODS", file.Methods, defaultCORSMethods),
+		headers:  listFromEnv("KUBEHELP_CORS_HEADERS", file.Headers, defaultCORSHeaders),
+	}
+	if len(p.origins) == 1 && strings.EqualFold(p.origins[0], "none") {
+		p.disabled, p.origins = true, nil
+	}
+	if maxAge := getEnv("KUBEHELP_CORS_MAX_AGE", file.MaxAge); maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid CORS max age %q", maxAge)
+		}
+		p.maxAge = d
+	}
+	for _, origin := range p.origins {
+		if origin != "*" && !validCORSOrigin(origin) {
+			return nil, fmt.Errorf("invalid CORS origin %q (expected scheme://host[:port], e.g. https://ops.example.com)", origin)
+		}
+	}
+	return p, nil
+}
+
+// listFromEnv returns the comma-separated values of the environment
+// variable key, else configured, else fallback
+func listFromEnv(key string, configured, fallback []string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) > 0 {
+		return values
+	}
+	if len(configured) > 0 {
+		return configured
+	}
+	return fallback
+}
+
+// validCORSOrigin reports whether origin is a scheme and host, where the
+// host may start with "*." for any subdomain
+func validCORSOrigin(origin string) bool {
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	return err == nil && u.Scheme != "" && u.Host != "" && (u.Path == "" || u.Path == "/") && u.RawQuery == ""
+}
+
+// allows reports whether requests from origin are allowed
+func (p *corsPolicy) allows(origin string) bool {
+	if p.disabled || origin == "" {
+		return false
+	}
+	origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+	for _, allowed := range p.origins {
+		allowed = strings.ToLower(strings.TrimSuffix(allowed, "/"))
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+			if host, ok := strings.CutPrefix(origin, scheme+"://"); ok && strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// anyOrigin reports whether every origin is allowed
+func (p *corsPolicy) anyOrigin() bool {
+	return !p.disabled && len(p.origins) == 1 && p.origins[0] == "*"
+}
+
+// allowsWebSocket reports whether a WebSocket handshake sent with the
+// Origin header origin is accepted: non-browser clients send none, and the
+// web UI connects from the server's own origin
+func (p *corsPolicy) allowsWebSocket(origin string, r *http.Request) bool {
+	if origin == "" || p.allows(origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// middleware adds the CORS headers for allowed origins and answers their
+// preflight requests; preflights from other origins get 403 Forbidden
+func (p *corsPolicy) middleware(next http.Handler) http.Handler {
+	if p.disabled {
+		return next
+	}
+	methods, headers := strings.Join(p.methods, ", "), strings.Join(p.headers, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		switch {
+		case p.anyOrigin():
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case p.allows(origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		default:
+			w.Header().Add("Vary", "Origin")
+			if r.Method == "OPTIONS" && origin != "" {
+				respondWithNegotiatedError(w, r, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", methods)
+		w.Header().Set("Access-Control-Allow-Headers", headers)
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		if p.maxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+		}
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// String describes the policy for the startup log
+func (p *corsPolicy) String() string {
+	if p.disabled {
+		return "disabled (same origin only)"
+	}
+	origins := "any origin"
+	if !p.anyOrigin() {
+		origins = "origins " + strings.Join(p.origins, ", ")
+	}
+	return fmt.Sprintf("%s, methods %s, headers %s", origins, strings.Join(p.methods, ", "), strings.Join(p.headers, ", "))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"kubehelp/internal/history"
+)
+
+// History listing page sizes
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// HistoryResponse is a page of past diagnoses, newest first, without their
+// diagnostic data
+type HistoryResponse struct {
+	Records []history.Record `json:"records"`
+}
+
+// historyHandler lists past diagnoses, optionally of one namespace
+// (?namespace=), paged with ?limit= and ?offset=
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := history.ListOptions{Namespace: query.Get("namespace"), Limit: defaultHistoryLimit}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			respondWithError(w, "limit must be between 1 and "+strconv.Itoa(maxHistoryLimit), http.StatusBadRequest)
+			return
+		}
+		opts.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			respondWithError(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		opts.Offset = offset
+	}
+
+	records, err := historyStore.List(opts)
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := HistoryResponse{Records: make([]history.Record, 0, len(records))}
+	for _, record := range records {
+		resp.Records = append(resp.Records, record.Summary())
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// historyRecordHandler returns a past diagnosis with its diagnostic data
+func historyRecordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	record, err := historyStore.Get(r.PathValue("id"))
+	if errors.Is(err, history.ErrNotFound) {
+		respondWithError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, record)
+}
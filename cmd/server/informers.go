@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kubehelp/internal/k8s"
+)
+
+// informerCaches holds the informer caches diagnoses read from instead of
+// listing, or is nil unless KUBEHELP_INFORMERS is true
+var informerCaches *informerPool
+
+// informerPool keeps one informer cache per kubeconfig context, started on
+// its first diagnosis and stopped with ctx
+type informerPool struct {
+	ctx    context.Context
+	resync time.Duration
+
+	mu     sync.Mutex
+	caches map[string]*k8s.InformerCache
+}
+
+// newInformerPoolFromEnv creates the informer caches when KUBEHELP_INFORMERS
+// is true, re-listing every KUBEHELP_INFORMER_RESYNC (default 10m)
+func newInformerPoolFromEnv(ctx context.Context) *informerPool {
+	if enabled, _ := strconv.ParseBool(getEnv("KUBEHELP_INFORMERS", "false")); !enabled {
+		return nil
+	}
+	resync := k8s.DefaultResync
+	if value := getEnv("KUBEHELP_INFORMER_RESYNC", ""); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("⚠️  Invalid KUBEHELP_INFORMER_RESYNC %q, using %s", value, resync)
+		} else {
+			resync = parsed
+		}
+	}
+	return &informerPool{ctx: ctx, resync: resync, caches: make(map[string]*k8s.InformerCache)}
+}
+
+// snapshot returns the informer cache of kubeContext ("": the current
+// context), starting it on first use. It returns nil, so that the diagnosis
+// lists from the API, when informers are disabled or cannot be started;
+// starting is retried by the next diagnosis.
+func (p *informerPool) snapshot(kubeContext string) k8s.Snapshot {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.caches[kubeContext]; ok {
+		return c
+	}
+
+	// Watch connections outlive any request timeout
+	client, err := k8s.NewClientWithTimeout("", kubeContext, 0)
+	if err != nil {
+		log.Printf("⚠️  Informer cache of context %q not started: %v", kubeContext, err)
+		return nil
+	}
+	c := k8s.NewInformerCache(client, p.resync)
+	skipped, err := c.Start(p.ctx)
+	if err != nil {
+		log.Printf("⚠️  Informer cache of context %q not started: %v", kubeContext, err)
+		return nil
+	}
+	if len(skipped) > 0 {
+		log.Printf("⚠️  Informer cache of context %q lists %s per diagnosis: not allowed to list and watch them in all namespaces", kubeContext, strings.Join(skipped, ", "))
+	}
+	log.Printf("🗂️  Informer cache of context %q started (resync %s)", kubeContext, p.resync)
+	p.caches[kubeContext] = c
+	return c
+}
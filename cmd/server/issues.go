@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	"kubehelp/internal/analyzer"
+	"kubehelp/internal/i18n"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+	"kubehelp/internal/tracker"
+)
+
+// issueFiler files the anomalies of scheduled scans as issues. A scan whose
+// anomalies are unchanged since its last issue files no new one, so a
+// lingering problem is not reported on every run.
+type issueFiler struct {
+	tracker tracker.Tracker
+	mu      sync.Mutex
+	// filed maps scan names to the anomalies of their last issue
+	filed map[string]string
+}
+
+// newIssueFilerFromEnv creates the filer of the tracker configured by
+// KUBEHELP_ISSUE_TRACKER
+func newIssueFilerFromEnv() (*issueFiler, error) {
+	t, err := tracker.NewFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return &issueFiler{tracker: t, filed: make(map[string]string)}, nil
+}
+
+// file creates an issue for the anomalies of scan and returns its URL, or
+// "" when the same anomalies were already filed
+func (f *issueFiler) file(ctx context.Context, scan scheduledScan, data *k8s.DiagnosticData, anomalies []string, analysis string, structured *llm.StructuredAnalysis) (string, error) {
+	fingerprint := strings.Join(slices.Sorted(slices.Values(anomalies)), "\n")
+	f.mu.Lock()
+	if f.filed[scan.Name] == fingerprint {
+		f.mu.Unlock()
+		return "", nil
+	}
+	f.mu.Unlock()
+
+	var severities []k8s.Severity
+	for _, cluster := range data.ClusterData() {
+		for _, finding := range cluster.Findings {
+			severities = append(severities, finding.Severity)
+		}
+	}
+	if structured != nil {
+		for _, issue := range structured.Issues {
+			severities = append(severities, issue.Severity)
+		}
+	}
+	issue, err := tracker.NewIssue(tracker.Report{
+		Data:     data,
+		Analysis: analysis,
+		Provider: scan.LLMProvider,
+		Status:   analyzer.Assess(severities...),
+		Messages: i18n.For(scan.Language),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to build issue: %w", err)
+	}
+	url, err := f.tracker.Create(ctx, issue)
+	if url != "" {
+		// Also when only the snapshot failed to attach: the issue exists
+		f.mu.Lock()
+		f.filed[scan.Name] = fingerprint
+		f.mu.Unlock()
+		log.Printf("🧾 Scheduled scan %s: filed %s issue %s", scan.Name, f.tracker.Name(), url)
+	}
+	return url, err
+}
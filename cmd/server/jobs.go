@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"kubehelp/internal/jobs"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// jobRunner runs diagnoses in the background for clients that cannot keep a
+// request open for the whole collect and analysis, e.g. behind load
+// balancers with short idle timeouts
+type jobRunner struct {
+	store jobs.Store
+	queue *workQueue
+	// ctx is cancelled when the server shuts down; running tracks the jobs
+	// to wait for
+	ctx     context.Context
+	running sync.WaitGroup
+}
+
+// newJobStoreFromEnv creates the in-memory job store, keeping finished jobs
+// for KUBEHELP_JOB_TTL
+func newJobStoreFromEnv() jobs.Store {
+	ttl, _ := time.ParseDuration(getEnv("KUBEHELP_JOB_TTL", ""))
+	return jobs.NewMemoryStore(ttl, 0)
+}
+
+// preferAsync reports whether the request asked for an asynchronous
+// response with "Prefer: respond-async" (RFC 7240)
+func preferAsync(r *http.Request) bool {
+	for _, value := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// async wraps the /api/diagnose handler. Requests preferring an asynchronous
+// response start a job and get 202 Accepted with the job and its URL in the
+// Location header; others are passed to next.
+func (j *jobRunner) async(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !preferAsync(r) {
+			next(w, r)
+			return
+		}
+
+		var req DiagnoseRequest
+		if err := decodeJSONBody(w, r, &req, maxRequestBytes); err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		acceptLanguage(r, &req.PromptSettings)
+		if err := req.validate(); err != nil {
+			respondWithError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		job, err := j.start(req, trace.SpanContextFromContext(r.Context()), nil)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Location", "/api/jobs/"+job.ID)
+		w.Header().Set("Preference-Applied", "respond-async")
+		respondWithJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// start creates a job running req in the background and returns it. done,
+// when set, is called with the outcome once the job has finished, before
+// the server counts the job as drained on shutdown.
+func (j *jobRunner) start(req DiagnoseRequest, started trace.SpanContext, done func(context.Context, *DiagnoseResponse, error)) (*jobs.Job, error) {
+	id, err := j.store.Create()
+	if err != nil {
+		return nil, err
+	}
+	job, err := j.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Started diagnosis job %s", id)
+	j.running.Add(1)
+	go func() {
+		defer j.running.Done()
+		resp, err := j.run(id, req, started)
+		if done != nil {
+			done(j.ctx, resp, err)
+		}
+	}()
+	return job, nil
+}
+
+// run waits for a queue slot, runs the diagnosis and records its outcome.
+// The job is detached from the request that started it, but not from the
+// server; its trace links to the request's span.
+func (j *jobRunner) run(id string, req DiagnoseRequest, started trace.SpanContext) (resp *DiagnoseResponse, err error) {
+	ctx, span := tracing.Tracer().Start(j.ctx, "diagnosis job",
+		trace.WithLinks(trace.Link{SpanContext: started}),
+		trace.WithAttributes(attribute.String("kubehelp.job.id", id)))
+	defer func() { tracing.End(span, err) }()
+
+	release, err := j.queue.acquire(ctx)
+	if err != nil {
+		j.finish(id, nil, err)
+		return nil, err
+	}
+	defer release()
+
+	j.update(id, func(job *jobs.Job) {
+		job.Status = jobs.StatusRunning
+		job.StartedAt = time.Now().UTC()
+	})
+	progress := func(p k8s.Progress) {
+		j.update(id, func(job *jobs.Job) { job.Stage = p.Stage })
+	}
+
+	resp, _, err = runDiagnosis(ctx, req, progress, nil)
+	j.finish(id, resp, err)
+	return resp, err
+}
+
+// wait waits for the running jobs to finish
+func (j *jobRunner) wait() {
+	j.running.Wait()
+}
+
+// finish records the result or error of a job
+func (j *jobRunner) finish(id string, resp *DiagnoseResponse, err error) {
+	j.update(id, func(job *jobs.Job) {
+		job.FinishedAt = time.Now().UTC()
+		if err != nil {
+			job.Status = jobs.StatusFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = jobs.StatusSucceeded
+		job.Analysis = resp.Analysis
+		job.DiagnosticData = resp.DiagnosticData
+	})
+	if err != nil {
+		log.Printf("Diagnosis job %s failed: %v", id, err)
+	} else {
+		log.Printf("Diagnosis job %s succeeded", id)
+	}
+}
+
+// update changes a job; failures are logged since the job runs detached
+func (j *jobRunner) update(id string, fn func(*jobs.Job)) {
+	if err := j.store.Update(id, fn); err != nil {
+		log.Printf("⚠️  Failed to update diagnosis job %s: %v", id, err)
+	}
+}
+
+// jobHandler returns the status, and once done the result, of a job
+func (j *jobRunner) jobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := j.store.Get(r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		respondWithError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
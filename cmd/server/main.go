@@ -3,27 +3,221 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"kubehelp/internal/analyzer"
+	"kubehelp/internal/cache"
+	"kubehelp/internal/history"
 	"kubehelp/internal/k8s"
 	"kubehelp/internal/llm"
+	"kubehelp/internal/redact"
+	"kubehelp/internal/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Request body size limits. Analyze requests may carry a full DiagnosticData
+// snapshot, so they get a larger allowance than collect/diagnose requests.
+const (
+	maxRequestBytes        = 1 << 20  // 1 MiB
+	maxAnalyzeRequestBytes = 10 << 20 // 10 MiB
+	maxPromptBytes         = 1 << 20  // 1 MiB
+	maxSnapshotPods        = 5000
+	maxSnapshotEvents      = 10000
+	maxLogLines            = 500
 )
 
+// statusClientClosedRequest is the non-standard (nginx) status for a request
+// the client abandoned before the response was ready
+const statusClientClosedRequest = 499
+
+// defaultLLMProvider analyzes requests that do not name a provider
+const defaultLLMProvider = "ollama"
+
+// diagnoseTimeout bounds a whole diagnosis (KUBEHELP_DIAGNOSE_TIMEOUT, 0: no limit)
+var diagnoseTimeout time.Duration
+
+// k8sTimeout bounds each Kubernetes API call (KUBEHELP_K8S_TIMEOUT)
+var k8sTimeout = k8s.DefaultAPITimeout
+
+// historyStore persists completed diagnoses (selected via HISTORY_BACKEND)
+var historyStore history.Store
+
+// redactor scrubs secrets from diagnostic data before prompts are built
+// (KUBEHELP_REDACT, KUBEHELP_REDACT_PATTERNS)
+var redactor *redact.Redactor
+
+// promptTemplate renders verbose prompts instead of the built-in report when
+// KUBEHELP_PROMPT_TEMPLATE names a template file
+var promptTemplate *llm.PromptTemplate
+
+// PromptSettings controls how the prompt is rendered. It is shared by
+// diagnose, collect and analyze requests.
+type PromptSettings struct {
+	Compact bool `json:"compact,omitempty"` // token-minimal prompt for small models
+	// Language requests the analysis in another language (default: the
+	// Accept-Language header, else $LLM_LANGUAGE)
+	Language string `json:"language,omitempty"`
+	// DetailLevel is "issues-only" (default), "all" or "minimal"
+	DetailLevel string `json:"detailLevel,omitempty"`
+	// MaxPromptTokens shrinks the prompt to about this many estimated
+	// tokens, summarizing healthy pods first (0: no limit)
+	MaxPromptTokens int `json:"maxPromptTokens,omitempty"`
+	// Structured asks the LLM for JSON issues, returned in the response's
+	// structured field; the analysis is then not streamed
+	Structured bool `json:"structured,omitempty"`
+	// NoCache always calls the LLM instead of reusing the cached analysis
+	// of unchanged diagnostic data
+	NoCache bool `json:"noCache,omitempty"`
+	// Temperature, TopP and MaxOutputTokens tune sampling; unset fields keep
+	// the provider defaults
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	// SystemPrompt replaces the built-in system prompt
+	SystemPrompt string `json:"systemPrompt,omitempty"`
+}
+
+// generation returns the sampling settings of p
+func (p PromptSettings) generation() llm.Generation {
+	return llm.Generation{Temperature: p.Temperature, TopP: p.TopP, MaxOutputTokens: p.MaxOutputTokens}
+}
+
+// validate rejects unknown detail levels and negative token budgets
+func (p PromptSettings) validate() error {
+	if _, err := llm.ParseDetailLevel(p.DetailLevel); err != nil {
+		return jsonError(err.Error())
+	}
+	if p.MaxPromptTokens < 0 {
+		return jsonError("maxPromptTokens must not be negative")
+	}
+	if err := p.generation().Validate(); err != nil {
+		return jsonError(err.Error())
+	}
+	return nil
+}
+
 type DiagnoseRequest struct {
-	Namespace   string   `json:"namespace"`
-	Workloads   []string `json:"workloads,omitempty"`
-	LLMProvider string   `json:"llm,omitempty"` // defaults to "ollama"
-	Context     string   `json:"context,omitempty"`
+	// Namespace may be a comma-separated list, like Namespaces, whose
+	// namespaces are collected in parallel and reported in sections
+	Namespace     string   `json:"namespace"`
+	Namespaces    []string `json:"namespaces,omitempty"`
+	AllNamespaces bool     `json:"allNamespaces,omitempty"`
+	Workloads     []string `json:"workloads,omitempty"`
+	Selector      string   `json:"selector,omitempty"` // label selector, e.g. "app=api"
+	LLMProvider   string   `json:"llm,omitempty"`      // defaults to "ollama"
+	Context       string   `json:"context,omitempty"`
+	// BestPractices adds findings for missing resources, latest tags and privileged/root containers
+	BestPractices bool `json:"bestPractices,omitempty"`
+	// Logs includes recent logs of unhealthy containers, LogLines per
+	// container (default 50)
+	Logs     bool  `json:"logs,omitempty"`
+	LogLines int64 `json:"logLines,omitempty"`
+	// Nodes adds the conditions, taints and capacity of the nodes behind
+	// the pods
+	Nodes bool `json:"nodes,omitempty"`
+	// CustomResources lists custom resources whose status conditions are
+	// collected, e.g. "certificates.v1.cert-manager.io"
+	CustomResources []string `json:"customResources,omitempty"`
+	// ProbeConnectivity runs a short-lived pod in namespaces with failures
+	// to look up and connect to their Services
+	ProbeConnectivity bool `json:"probeConnectivity,omitempty"`
+	// EventsSince is how far back warning events are collected, as a
+	// duration such as "6h" (default 1h)
+	EventsSince string `json:"eventsSince,omitempty"`
+	// IncludeSpec adds a summary of the specs of unhealthy pods
+	IncludeSpec bool `json:"includeSpec,omitempty"`
+	PromptSettings
+}
+
+// validate rejects conflicting namespaces, unknown detail levels, invalid
+// label selectors and event windows, and oversized log requests
+func (r DiagnoseRequest) validate() error {
+	if r.AllNamespaces && (r.Namespace != "" || len(r.Namespaces) > 0) {
+		return jsonError("allNamespaces cannot be combined with namespace or namespaces")
+	}
+	if r.Namespace != "" && len(r.Namespaces) > 0 {
+		return jsonError("set either namespace or namespaces")
+	}
+	if _, err := labels.Parse(r.Selector); err != nil {
+		return jsonError("invalid selector: " + err.Error())
+	}
+	if _, err := k8s.ParseCustomResources(r.CustomResources); err != nil {
+		return jsonError(err.Error())
+	}
+	if r.LogLines < 0 || r.LogLines > maxLogLines {
+		return jsonError(fmt.Sprintf("logLines must be between 0 and %d", maxLogLines))
+	}
+	if r.EventsSince != "" {
+		if d, err := time.ParseDuration(r.EventsSince); err != nil || d <= 0 {
+			return jsonError(fmt.Sprintf("eventsSince must be a positive duration such as 6h, got %q", r.EventsSince))
+		}
+	}
+	return r.PromptSettings.validate()
+}
+
+// resolveNamespace folds Namespaces and AllNamespaces into Namespace, which
+// then names what the request collects: "*" (k8s.AllNamespaces) for all
+// namespaces, a comma-separated list or a single namespace, by default
+// "default"
+func (r *DiagnoseRequest) resolveNamespace() {
+	switch {
+	case r.AllNamespaces:
+		r.Namespace = k8s.AllNamespaces
+	case len(r.Namespaces) > 0:
+		r.Namespace = strings.Join(k8s.SplitNamespaces(strings.Join(r.Namespaces, ",")), ",")
+	default:
+		r.Namespace = strings.Join(k8s.SplitNamespaces(r.Namespace), ",")
+	}
+	if r.Namespace == "" {
+		r.Namespace = "default"
+	}
+	r.Namespaces, r.AllNamespaces = nil, false
 }
 
 type DiagnoseResponse struct {
-	Analysis       string              `json:"analysis"`
+	// Analysis is markdown, with structured requests rendered from Structured
+	Analysis       string                  `json:"analysis"`
+	Structured     *llm.StructuredAnalysis `json:"structured,omitempty"`
+	DiagnosticData *k8s.DiagnosticData     `json:"diagnosticData,omitempty"`
+	// Usage is the token usage and estimated cost per provider
+	Usage []llm.Usage `json:"usage,omitempty"`
+	// Cached is set when the analysis was reused from the analysis cache
+	Cached bool   `json:"cached,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CollectResponse is returned by /api/collect: the collected data and the
+// prompt that would be sent to the LLM, without running any analysis
+type CollectResponse struct {
 	DiagnosticData *k8s.DiagnosticData `json:"diagnosticData,omitempty"`
+	Prompt         string              `json:"prompt,omitempty"`
 	Error          string              `json:"error,omitempty"`
 }
 
+// AnalyzeRequest runs LLM analysis on previously collected data. Either
+// DiagnosticData or Prompt must be set; an explicit Prompt takes precedence.
+type AnalyzeRequest struct {
+	DiagnosticData *k8s.DiagnosticData `json:"diagnosticData,omitempty"`
+	Prompt         string              `json:"prompt,omitempty"`
+	LLMProvider    string              `json:"llm,omitempty"` // defaults to "ollama"
+	PromptSettings
+}
+
 type HealthResponse struct {
 	Status  string `json:"status"`
 	Version string `json:"version"`
@@ -34,99 +228,529 @@ func diagnoseHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if negotiateMediaType(r.Header.Get("Accept")) == mediaEventStream {
+		diagnoseStreamHandler(w, r)
+		return
+	}
 
 	var req DiagnoseRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondWithError(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeJSONBody(w, r, &req, maxRequestBytes); err != nil {
+		respondWithNegotiatedError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	acceptLanguage(r, &req.PromptSettings)
+	if err := req.validate(); err != nil {
+		respondWithNegotiatedError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Set defaults
-	if req.Namespace == "" {
-		req.Namespace = "default"
+	resp, status, err := runDiagnosis(r.Context(), req, nil, nil)
+	if err != nil {
+		setRetryAfter(w, err)
+		respondWithNegotiatedError(w, r, err.Error(), status)
+		return
 	}
+
+	// Send successful response
+	respondWithDiagnosis(w, r, resp)
+}
+
+// runDiagnosis collects data, analyzes it and records the result in history.
+// progress, when set, receives collection progress and onChunk, when set,
+// receives the analysis as it is generated. The returned status code is
+// meant for the HTTP response when err is non-nil.
+func runDiagnosis(ctx context.Context, req DiagnoseRequest, progress k8s.ProgressFunc, onChunk func(string)) (*DiagnoseResponse, int, error) {
+	// Set defaults
+	req.resolveNamespace()
 	if req.LLMProvider == "" {
-		req.LLMProvider = "ollama"
+		req.LLMProvider = defaultLLMProvider
 	}
 
 	log.Printf("Diagnosing namespace: %s, workloads: %v, llm: %s", req.Namespace, req.Workloads, req.LLMProvider)
+	start := time.Now()
+	if diagnoseTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, diagnoseTimeout)
+		defer cancel()
+	}
+
+	record := history.Record{
+		Namespace: req.Namespace,
+		Workloads: req.Workloads,
+		Context:   req.Context,
+		Provider:  req.LLMProvider,
+		Request:   requestJSON(req),
+	}
 
-	// Create K8s client
-	client, err := k8s.NewClient("", req.Context)
+	data, err := collectDiagnostics(ctx, req, progress)
 	if err != nil {
-		respondWithError(w, "Failed to create Kubernetes client: "+err.Error(), http.StatusInternalServerError)
-		return
+		status := contextStatus(err, http.StatusInternalServerError)
+		err = contextError(err, time.Since(start))
+		saveFailure(record, start, status, err)
+		return nil, status, err
 	}
+	record.DiagnosticData = data
 
-	// Collect diagnostics
-	aggregator := k8s.NewAggregator(client)
-	data, err := aggregator.CollectDiagnostics(context.Background(), req.Namespace, req.Workloads)
+	prompt, err := buildPrompt(data, req.PromptSettings)
 	if err != nil {
-		respondWithError(w, "Failed to collect diagnostics: "+err.Error(), http.StatusInternalServerError)
+		return nil, http.StatusInternalServerError, err
+	}
+	if progress != nil {
+		progress(k8s.Progress{Stage: stageAnalysis, Elapsed: time.Since(start)})
+	}
+	cacheKey := analysisCacheKey(data, req.LLMProvider, req.PromptSettings)
+	resp, status, err := analyzePrompt(ctx, req.LLMProvider, prompt, cacheKey, req.PromptSettings, onChunk)
+	if err != nil {
+		status = contextStatus(err, status)
+		err = contextError(err, time.Since(start))
+		saveFailure(record, start, status, err)
+		return nil, status, err
+	}
+
+	record.Analysis = resp.Analysis
+	record.DurationMs = time.Since(start).Milliseconds()
+	saveHistory(record)
+
+	resp.DiagnosticData = data
+	return resp, http.StatusOK, nil
+}
+
+// contextStatus maps a cancelled diagnosis to 499 and a timed-out one to
+// 504; other errors keep the given status
+func contextStatus(err error, status int) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded) || k8s.IsAPITimeout(err):
+		return http.StatusGatewayTimeout
+	}
+	return status
+}
+
+// contextError replaces raw context errors with a message saying whether
+// the diagnosis was cancelled or timed out
+func contextError(err error, elapsed time.Duration) error {
+	if k8s.IsAPITimeout(err) {
+		return err
+	}
+	switch contextStatus(err, 0) {
+	case statusClientClosedRequest:
+		log.Printf("Diagnosis cancelled by client after %s", elapsed.Round(time.Millisecond))
+		return jsonError("diagnosis cancelled")
+	case http.StatusGatewayTimeout:
+		return jsonError(fmt.Sprintf("diagnosis timed out after %s — try a faster model or raise KUBEHELP_DIAGNOSE_TIMEOUT", elapsed.Round(time.Second)))
+	}
+	return err
+}
+
+// collectHandler collects diagnostic data and builds the prompt without
+// calling an LLM, so the UI can show data before the user pays for analysis
+func collectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	log.Printf("Collected data: %d pods, %d events", len(data.Pods), len(data.Events))
+	var req DiagnoseRequest
+	if err := decodeJSONBody(w, r, &req, maxRequestBytes); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, CollectResponse{Error: err.Error()})
+		return
+	}
+	acceptLanguage(r, &req.PromptSettings)
+	if err := req.validate(); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, CollectResponse{Error: err.Error()})
+		return
+	}
+	req.resolveNamespace()
 
-	// Build prompt
-	prompt := llm.BuildDiagnosticPrompt(data)
+	log.Printf("Collecting namespace: %s, workloads: %v", req.Namespace, req.Workloads)
 
-	// Get LLM provider
-	provider, err := createLLMProvider(req.LLMProvider)
+	start := time.Now()
+	data, err := collectDiagnostics(r.Context(), req, nil)
 	if err != nil {
+		status := contextStatus(err, http.StatusInternalServerError)
+		respondWithJSON(w, status, CollectResponse{Error: contextError(err, time.Since(start)).Error()})
+		return
+	}
+
+	prompt, err := buildPrompt(data, req.PromptSettings)
+	if err != nil {
+		respondWithJSON(w, http.StatusInternalServerError, CollectResponse{Error: err.Error()})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, CollectResponse{
+		DiagnosticData: data,
+		Prompt:         prompt,
+	})
+}
+
+// analyzeHandler runs LLM analysis on data returned by a previous collect call
+func analyzeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AnalyzeRequest
+	if err := decodeJSONBody(w, r, &req, maxAnalyzeRequestBytes); err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	acceptLanguage(r, &req.PromptSettings)
+	if err := validateAnalyzeRequest(&req); err != nil {
 		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.LLMProvider == "" {
+		req.LLMProvider = defaultLLMProvider
+	}
 
-	log.Printf("Analyzing with %s...", provider.Name())
+	// Client-supplied prompts are scrubbed too; they may have been built
+	// from unredacted data. Only prompts built here are cached.
+	prompt := redactor.String(req.Prompt)
+	var cacheKey string
+	if prompt == "" {
+		built, err := buildPrompt(req.DiagnosticData, req.PromptSettings)
+		if err != nil {
+			respondWithError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		prompt = built
+		cacheKey = analysisCacheKey(req.DiagnosticData, req.LLMProvider, req.PromptSettings)
+	}
 
-	// Get analysis from LLM
-	analysis, err := provider.Analyze(context.Background(), prompt)
+	start := time.Now()
+	resp, status, err := analyzePrompt(r.Context(), req.LLMProvider, prompt, cacheKey, req.PromptSettings, nil)
 	if err != nil {
-		respondWithError(w, "LLM analysis failed: "+err.Error(), http.StatusInternalServerError)
+		setRetryAfter(w, err)
+		respondWithError(w, contextError(err, time.Since(start)).Error(), contextStatus(err, status))
 		return
 	}
 
-	// Send successful response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(DiagnoseResponse{
-		Analysis:       analysis,
-		DiagnosticData: data,
+	if data := req.DiagnosticData; data != nil {
+		// The snapshot is stored on its own; the prompt may be large
+		settings := req
+		settings.DiagnosticData = nil
+		settings.Prompt = ""
+		saveHistory(history.Record{
+			Namespace:      data.Namespace,
+			Workloads:      data.Workloads,
+			Context:        data.ContextName,
+			Provider:       req.LLMProvider,
+			Analysis:       resp.Analysis,
+			DurationMs:     time.Since(start).Milliseconds(),
+			DiagnosticData: data,
+			Request:        requestJSON(settings),
+		})
+	}
+
+	resp.DiagnosticData = req.DiagnosticData
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// validateAnalyzeRequest checks that a posted snapshot or prompt is usable
+// and within the server's size limits
+func validateAnalyzeRequest(req *AnalyzeRequest) error {
+	if req.DiagnosticData == nil && strings.TrimSpace(req.Prompt) == "" {
+		return jsonError("Either diagnosticData or prompt is required")
+	}
+	if len(req.Prompt) > maxPromptBytes {
+		return jsonError(fmt.Sprintf("Prompt exceeds maximum size of %d bytes", maxPromptBytes))
+	}
+	if err := req.PromptSettings.validate(); err != nil {
+		return err
+	}
+	if data := req.DiagnosticData; data != nil {
+		if data.Namespace == "" {
+			return jsonError("diagnosticData.namespace is required")
+		}
+		if err := k8s.MigrateDiagnosticData(data); err != nil {
+			return jsonError(err.Error())
+		}
+		if len(data.Pods) > maxSnapshotPods {
+			return jsonError(fmt.Sprintf("diagnosticData has %d pods (max %d)", len(data.Pods), maxSnapshotPods))
+		}
+		if len(data.Events) > maxSnapshotEvents {
+			return jsonError(fmt.Sprintf("diagnosticData has %d events (max %d)", len(data.Events), maxSnapshotEvents))
+		}
+		for i, pod := range data.Pods {
+			if pod.Name == "" {
+				return jsonError(fmt.Sprintf("diagnosticData.pods[%d].name is required", i))
+			}
+		}
+	}
+	return nil
+}
+
+// collectDiagnostics creates a Kubernetes client for the requested context
+// and collects diagnostic data for the namespace
+func collectDiagnostics(ctx context.Context, req DiagnoseRequest, progress k8s.ProgressFunc) (*k8s.DiagnosticData, error) {
+	client, err := k8s.NewClientWithTimeout("", req.Context, k8sTimeout)
+	if err != nil {
+		return nil, jsonError("Failed to create Kubernetes client: " + err.Error())
+	}
+
+	// Validated with the request
+	customResources, _ := k8s.ParseCustomResources(req.CustomResources)
+	eventsSince, _ := time.ParseDuration(req.EventsSince)
+	aggregator := k8s.NewAggregatorWithOptions(client, k8s.AggregatorOptions{
+		BestPractices:     req.BestPractices,
+		CollectLogs:       req.Logs,
+		LogTailLines:      req.LogLines,
+		LabelSelector:     req.Selector,
+		CollectNodes:      req.Nodes,
+		Progress:          progress,
+		APITimeout:        k8sTimeout,
+		CustomResources:   customResources,
+		ProbeConnectivity: req.ProbeConnectivity,
+		ProbeImage:        getEnv("KUBEHELP_PROBE_IMAGE", ""),
+		ClusterDomain:     getEnv("KUBEHELP_CLUSTER_DOMAIN", ""),
+		EventsSince:       eventsSince,
+		IncludeSpec:       req.IncludeSpec,
+		Snapshot:          informerCaches.snapshot(req.Context),
 	})
+	var data *k8s.DiagnosticData
+	switch namespaces := k8s.SplitNamespaces(req.Namespace); {
+	case req.Namespace == k8s.AllNamespaces:
+		data, err = aggregator.CollectAllNamespaces(ctx, req.Workloads)
+	case len(namespaces) > 1:
+		data, err = aggregator.CollectNamespaceList(ctx, namespaces, req.Workloads)
+	default:
+		data, err = aggregator.CollectDiagnostics(ctx, req.Namespace, req.Workloads)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to collect diagnostics: %w", err)
+	}
+
+	log.Printf("Collected data: %d pods, %d events, %d logs", len(data.Pods), len(data.Events), len(data.Logs))
+	return data, nil
 }
 
-func createLLMProvider(providerName string) (llm.Provider, error) {
-	switch providerName {
-	case "ollama":
-		model := getEnv("OLLAMA_MODEL", "mistral")
-		baseURL := getEnv("OLLAMA_BASE_URL", "http://localhost:11434")
-		return llm.NewOllamaProvider(model, baseURL), nil
+// buildPrompt redacts secrets from data and renders the diagnostic prompt in
+// verbose form, from KUBEHELP_PROMPT_TEMPLATE if set, or compact form after
+// the rule-based diagnoses, shrunk to the token budget if one is set, asking
+// for the analysis in the requested language (or $LLM_LANGUAGE). Settings
+// must have been validated.
+func buildPrompt(data *k8s.DiagnosticData, settings PromptSettings) (string, error) {
+	data, err := redactor.Apply(data)
+	if err != nil {
+		return "", err
+	}
+	language := settings.Language
+	if language == "" {
+		language = llm.DefaultLanguage()
+	}
+	detail, _ := llm.ParseDetailLevel(settings.DetailLevel)
+	var templateErr error
+	prompt, truncation, err := llm.FitPrompt(data, settings.MaxPromptTokens, func(d *k8s.DiagnosticData) string {
+		switch {
+		case settings.Compact:
+			return llm.BuildCompactPrompt(d)
+		case promptTemplate != nil:
+			built, err := promptTemplate.Build(d, llm.PromptOptions{DetailLevel: detail})
+			if err != nil && templateErr == nil {
+				templateErr = err
+			}
+			return built
+		}
+		return llm.BuildDiagnosticPromptWithOptions(d, llm.PromptOptions{DetailLevel: detail})
+	})
+	if err == nil {
+		err = templateErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if truncation.Truncated() {
+		log.Printf("Shrunk prompt from ~%d to ~%d tokens, leaving out: %s",
+			truncation.OriginalTokens, truncation.Tokens, strings.Join(truncation.Omitted, "; "))
+	}
+	// Lead with the rule-based diagnoses to guide the model
+	return llm.WithLanguage(analyzer.Preamble(analyzer.Analyze(data))+prompt, language), nil
+}
+
+// analyzePrompt sends the prompt to the named provider with the sampling
+// settings and system prompt of settings, streaming the response to onChunk
+// when it is set. A structured analysis is requested as JSON and not
+// streamed; the returned analysis is then its markdown rendering. The
+// response carries the token usage, which is also added to the
+// per-provider metrics. With a cacheKey, a cached analysis is returned
+// without calling the provider, in a single chunk when streaming, and a new
+// one is cached. The returned status code is meant for the HTTP response
+// when err is non-nil.
+func analyzePrompt(ctx context.Context, providerName, prompt, cacheKey string, settings PromptSettings, onChunk func(string)) (*DiagnoseResponse, int, error) {
+	provider, err := createLLMProvider(providerName)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
 
-	case "gemini":
-		apiKey := getEnv("GEMINI_API_KEY", "")
-		if apiKey == "" {
-			return nil, jsonError("GEMINI_API_KEY environment variable not set")
+	if cacheKey != "" {
+		if entry, ok := analysisCache.Get(cacheKey); ok {
+			serverMetrics.cacheHits.Add(1)
+			log.Printf("Reusing the %s analysis cached at %s", entry.Provider, entry.CreatedAt.Format(time.RFC3339))
+			if onChunk != nil {
+				onChunk(entry.Analysis)
+			}
+			return &DiagnoseResponse{Analysis: entry.Analysis, Structured: entry.Structured, Cached: true}, http.StatusOK, nil
+		}
+		serverMetrics.cacheMisses.Add(1)
+	}
+
+	// Wait for an LLM slot so bursts of diagnoses do not fan out unbounded
+	// requests to the backend
+	release, err := llmQueue.acquire(ctx)
+	if err != nil {
+		if llmQueue.busy(err) {
+			return nil, http.StatusServiceUnavailable, err
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	defer release()
+
+	log.Printf("Analyzing with %s...", provider.Name())
+
+	// Tokens are spent even when the analysis then fails, e.g. on an
+	// invalid structured response
+	ctx, tracker := llm.WithUsageTracker(ctx)
+	defer func() { serverMetrics.addUsage(tracker.Usage()) }()
+	ctx = llm.WithGeneration(ctx, settings.generation())
+	if settings.SystemPrompt != "" {
+		ctx = llm.WithSystemPrompt(ctx, settings.SystemPrompt)
+	}
+
+	var analysis string
+	var result *llm.StructuredAnalysis
+	switch {
+	case settings.Structured:
+		result, _, err = llm.AnalyzeStructured(ctx, provider, prompt)
+		if result != nil {
+			analysis = result.Markdown()
+		}
+	case onChunk != nil:
+		analysis, err = llm.StreamAnalysis(ctx, provider, prompt, onChunk)
+	default:
+		analysis, err = provider.Analyze(ctx, prompt)
+	}
+	if err != nil {
+		var budgetErr *llm.BudgetExceededError
+		if errors.As(err, &budgetErr) {
+			return nil, http.StatusRequestEntityTooLarge, jsonError(err.Error() + "; retry with compact or a narrower workload selection")
 		}
-		model := getEnv("GEMINI_MODEL", "gemini-pro")
-		return llm.NewGeminiProvider(apiKey, model), nil
+		var circuitErr *llm.CircuitOpenError
+		if errors.As(err, &circuitErr) {
+			return nil, http.StatusServiceUnavailable, err
+		}
+		var schemaErr *llm.SchemaError
+		if errors.As(err, &schemaErr) {
+			return nil, http.StatusBadGateway, fmt.Errorf("LLM returned an invalid structured analysis: %w", err)
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("LLM analysis failed: %w", err)
+	}
+	usage := tracker.Usage()
+	if len(usage) > 0 {
+		log.Printf("LLM usage: %s", llm.TotalUsage(usage))
+	}
+	if cacheKey != "" {
+		if err := analysisCache.Put(cacheKey, cache.Entry{Provider: provider.Name(), Analysis: analysis, Structured: result}); err != nil {
+			log.Printf("⚠️  Failed to cache the analysis: %v", err)
+		}
+	}
+	return &DiagnoseResponse{Analysis: analysis, Structured: result, Usage: usage}, http.StatusOK, nil
+}
+
+// saveHistory records a diagnosis and returns its ID, or "" when history is
+// disabled or saving failed; failures are logged but never fail the request
+func saveHistory(record history.Record) string {
+	if historyStore == nil {
+		return ""
+	}
+	id, err := historyStore.Save(record)
+	if err != nil {
+		log.Printf("⚠️  Failed to save diagnosis history: %v", err)
+		return ""
+	}
+	log.Printf("Saved diagnosis history record %s", id)
+	return id
+}
+
+// saveFailure records a failed diagnosis with its error. Diagnoses the
+// client cancelled or the LLM queue turned away are not worth keeping.
+func saveFailure(record history.Record, start time.Time, status int, err error) {
+	if status == statusClientClosedRequest || llmQueue.busy(err) {
+		return
+	}
+	record.Error = err.Error()
+	record.DurationMs = time.Since(start).Milliseconds()
+	saveHistory(record)
+}
 
-	case "openai":
-		apiKey := getEnv("OPENAI_API_KEY", "")
-		if apiKey == "" {
-			return nil, jsonError("OPENAI_API_KEY environment variable not set")
+// requestJSON encodes the settings a diagnosis was requested with for its
+// history record
+func requestJSON(req any) json.RawMessage {
+	content, err := json.Marshal(req)
+	if err != nil {
+		return nil
+	}
+	return content
+}
+
+// decodeJSONBody decodes a size-limited JSON request body into v
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}, maxBytes int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return jsonError(fmt.Sprintf("Request body exceeds maximum size of %d bytes", maxBytes))
 		}
-		return llm.NewOpenAIProvider(apiKey, "gpt-4"), nil
+		return jsonError("Invalid request body")
+	}
+	return nil
+}
 
-	case "vertexai":
-		vertexProvider, err := llm.NewVertexAIProviderFromEnv()
+func createLLMProvider(providerName string) (llm.Provider, error) {
+	registered, ok := llm.Lookup(providerName)
+	if !ok {
+		return nil, jsonError("Unsupported LLM provider: " + providerName + " (supported: " + strings.Join(llm.Providers(), ", ") + ")")
+	}
+	model := providerModel(providerName)
+
+	// Configuration errors such as missing API keys are safe to return;
+	// each call is traced, including those to fallback models
+	factory := llm.Traced(providerName, func(model string) (llm.Provider, error) {
+		provider, err := registered.New(model)
 		if err != nil {
-			return nil, jsonError("Failed to create Vertex AI provider: " + err.Error())
+			return nil, jsonError(err.Error())
 		}
-		return vertexProvider, nil
+		return provider, nil
+	})
 
-	default:
-		return nil, jsonError("Unsupported LLM provider: " + providerName + " (supported: ollama, gemini, openai, vertexai)")
+	var provider llm.Provider
+	var err error
+	if getEnv("KUBEHELP_MODEL_FALLBACK", "") == "true" {
+		provider, err = llm.NewModelFallbackProvider(model, llm.FallbackModels(providerName), factory)
+	} else {
+		provider, err = factory(model)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Stop calling a provider that keeps failing for a cooldown
+	provider = llm.WithCircuitBreaker(provider, providerName)
+
+	// Optional per-request token/cost guardrail
+	maxTokens, _ := strconv.Atoi(getEnv("KUBEHELP_MAX_INPUT_TOKENS", "0"))
+	maxCost, _ := strconv.ParseFloat(getEnv("KUBEHELP_MAX_COST", "0"), 64)
+	provider, err = llm.WithBudget(provider, providerName, model, maxTokens, maxCost)
+	if err != nil {
+		return nil, jsonError(err.Error())
 	}
+	return provider, nil
+}
+
+// providerModel returns the model the named provider uses, from its env var
+// or the built-in default
+func providerModel(providerName string) string {
+	return llm.DefaultModel(providerName)
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -138,13 +762,17 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func respondWithError(w http.ResponseWriter, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(DiagnoseResponse{
+	respondWithJSON(w, statusCode, DiagnoseResponse{
 		Error: message,
 	})
 }
 
+func respondWithJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
 func jsonError(message string) error {
 	return &ErrorWithMessage{message}
 }
@@ -157,6 +785,23 @@ func (e *ErrorWithMessage) Error() string {
 	return e.message
 }
 
+// newRedactorFromEnv configures redaction from KUBEHELP_REDACT (off, default
+// or strict) and KUBEHELP_REDACT_PATTERNS, a comma-separated list of extra
+// regular expressions
+func newRedactorFromEnv() (*redact.Redactor, error) {
+	level, err := redact.ParseLevel(os.Getenv("KUBEHELP_REDACT"))
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(os.Getenv("KUBEHELP_REDACT_PATTERNS"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return redact.New(level, patterns)
+}
+
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -171,18 +816,30 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// tracingMiddleware records each request as a span, continuing the trace of
+// a caller that sends a traceparent header. Health checks and metric scrapes
+// are not traced.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "kubehelp-server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.URL.Path != "/api/health" && r.URL.Path != "/metrics"
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// traceRoutes names request spans after the route mux matched, e.g.
+// "GET /api/jobs/{id}", which the middlewares around it cannot see
+func traceRoutes(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		if r.Pattern != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + r.Pattern)
+			span.SetAttributes(attribute.String("http.route", r.Pattern))
 		}
-
-		next.ServeHTTP(w, r)
 	})
 }
 
@@ -198,32 +855,198 @@ func securityHeadersMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
 		// Prevent XSS in older browsers
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
+		// Keep browsers on HTTPS once served over it
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		}
 
 		next.ServeHTTP(w, r)
 	})
 }
 
 func main() {
+	webDir := flag.String("web-dir", os.Getenv("KUBEHELP_WEB_DIR"), "Serve the web UI from this directory instead of the embedded copy, for UI development")
+	tlsCert := flag.String("tls-cert", os.Getenv("KUBEHELP_TLS_CERT"), "Serve HTTPS with this PEM certificate (chain), reloaded when the file changes")
+	tlsKey := flag.String("tls-key", os.Getenv("KUBEHELP_TLS_KEY"), "PEM private key of --tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", os.Getenv("KUBEHELP_TLS_CLIENT_CA"), "Verify client certificates against this PEM CA bundle; verified clients need no API token")
+	tlsClientAuth := flag.String("tls-client-auth", getEnv("KUBEHELP_TLS_CLIENT_AUTH", "require"), "With --tls-client-ca, require client certificates (require) or verify them when given (optional)")
+	flag.Parse()
+
+	// Export traces when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := tracing.Setup(context.Background(), "kubehelp-server")
+	if err != nil {
+		log.Fatalf("Failed to configure tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	store, err := history.NewStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize history store: %v", err)
+	}
+	historyStore = store
+
+	// Bound concurrent diagnoses so load spikes cannot exhaust memory or
+	// apiserver/LLM quotas
+	queue := newWorkQueueFromEnv()
+	llmQueue = newLLMQueueFromEnv()
+	limiter := newRateLimiterFromEnv()
+	diagnoseTimeout, _ = time.ParseDuration(getEnv("KUBEHELP_DIAGNOSE_TIMEOUT", "0"))
+	analysisCache = newAnalysisCacheFromEnv()
+	if timeout, err := time.ParseDuration(getEnv("KUBEHELP_K8S_TIMEOUT", "")); err == nil && timeout > 0 {
+		k8sTimeout = timeout
+	}
+	redactor, err = newRedactorFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure redaction: %v", err)
+	}
+	if path := os.Getenv("KUBEHELP_PROMPT_TEMPLATE"); path != "" {
+		if promptTemplate, err = llm.LoadPromptTemplate(path); err != nil {
+			log.Fatalf("Failed to load the prompt template: %v", err)
+		}
+	}
+
+	if cors, err = newCORSPolicyFromEnv(); err != nil {
+		log.Fatalf("Failed to configure CORS: %v", err)
+	}
+	certs, err := newServerTLS(*tlsCert, *tlsKey, *tlsClientCA, *tlsClientAuth)
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
+	auth, err := newAuthenticatorFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	auth.clientCerts = certs.clientCerts()
+
+	// Requests, async jobs and scheduled scans run under work, which is
+	// cancelled when the shutdown grace period runs out
+	work, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	// With KUBEHELP_INFORMERS, diagnoses read the watched resources from
+	// memory; the cache of the current context is filled up front
+	informerCaches = newInformerPoolFromEnv(work)
+	informerCaches.snapshot("")
+
+	// Diagnoses started with "Prefer: respond-async" run as background jobs
+	runner := &jobRunner{store: newJobStoreFromEnv(), queue: queue, ctx: work}
+
+	// Alertmanager and generic alert webhooks start jobs through runner
+	alerts, err := newAlertWebhookFromEnv(runner)
+	if err != nil {
+		log.Fatalf("Failed to configure alert webhooks: %v", err)
+	}
+
 	mux := http.NewServeMux()
 
 	// API endpoints
-	mux.HandleFunc("/api/diagnose", diagnoseHandler)
+	mux.HandleFunc("/api/diagnose", limiter.limit(runner.async(queue.limit(diagnoseHandler))))
+	mux.HandleFunc("/api/jobs/{id}", runner.jobHandler)
+	mux.HandleFunc("/api/diagnose/stream", limiter.limit(queue.limit(diagnoseStreamHandler)))
+	mux.HandleFunc("/api/diagnose/ws", limiter.limit(queue.limit(diagnoseWebSocketHandler.ServeHTTP)))
+	mux.HandleFunc("/api/collect", limiter.limit(queue.limit(collectHandler)))
+	mux.HandleFunc("/api/analyze", limiter.limit(queue.limit(analyzeHandler)))
+	mux.HandleFunc("/api/webhooks/alertmanager", limiter.limit(alerts.alertmanagerHandler))
+	mux.HandleFunc("/api/webhooks/generic", limiter.limit(alerts.genericHandler))
+	mux.HandleFunc("/api/history", historyHandler)
+	mux.HandleFunc("/api/history/{id}", historyRecordHandler)
 	mux.HandleFunc("/api/health", healthHandler)
+	mux.HandleFunc("/api/providers", limiter.limit(providersHandler))
+	mux.HandleFunc("/metrics", metricsHandler)
 
-	// Serve static web UI at root
-	mux.Handle("/", http.FileServer(http.Dir("./web")))
+	// Periodic scans of KUBEHELP_SCHEDULE / KUBEHELP_SCHEDULE_CONFIG
+	scans, err := newSchedulerFromEnv(queue)
+	if err != nil {
+		log.Fatalf("Failed to configure scheduled scans: %v", err)
+	}
+
+	// Serve the web UI at root, embedded unless --web-dir is set
+	ui, err := webHandler(*webDir)
+	if err != nil {
+		log.Fatalf("Failed to load the web UI: %v", err)
+	}
+	mux.Handle("/", ui)
 
 	// Wrap with middlewares (security headers applied first)
-	handler := loggingMiddleware(corsMiddleware(securityHeadersMiddleware(mux)))
+	handler := tracingMiddleware(loggingMiddleware(cors.middleware(securityHeadersMiddleware(auth.requireAuth(traceRoutes(mux))))))
 
 	port := getEnv("PORT", "8080")
+	timeouts := newServerTimeoutsFromEnv()
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       timeouts.read,
+		WriteTimeout:      timeouts.write,
+		IdleTimeout:       idleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return work },
+	}
+	scheme, wsScheme := "http", "ws"
+	if certs != nil {
+		srv.TLSConfig = certs.serverConfig()
+		scheme, wsScheme = "https", "wss"
+	}
 	log.Printf("🚀 kubehelp server starting on port %s", port)
 	log.Printf("📍 Endpoints:")
-	log.Printf("   Web UI:  http://localhost:%s/", port)
-	log.Printf("   POST     http://localhost:%s/api/diagnose - Run diagnosis", port)
-	log.Printf("   GET      http://localhost:%s/api/health - Health check", port)
+	log.Printf("   Web UI:  %s://localhost:%s/", scheme, port)
+	if *webDir != "" {
+		log.Printf("   Web UI files: %s (uncached)", *webDir)
+	}
+	log.Printf("   POST     %s://localhost:%s/api/diagnose - Run diagnosis", scheme, port)
+	log.Printf("   GET      %s://localhost:%s/api/jobs/{id} - Status of an async diagnosis", scheme, port)
+	log.Printf("   POST     %s://localhost:%s/api/diagnose/stream - Run diagnosis with SSE progress", scheme, port)
+	log.Printf("   GET      %s://localhost:%s/api/diagnose/ws - Run diagnosis with WebSocket progress", wsScheme, port)
+	log.Printf("   POST     %s://localhost:%s/api/collect - Collect data only", scheme, port)
+	log.Printf("   POST     %s://localhost:%s/api/analyze - Analyze collected data", scheme, port)
+	log.Printf("   POST     %s://localhost:%s/api/webhooks/alertmanager - Diagnose Alertmanager alerts", scheme, port)
+	log.Printf("   POST     %s://localhost:%s/api/webhooks/generic - Diagnose an alert", scheme, port)
+	log.Printf("   GET      %s://localhost:%s/api/history - Past diagnoses", scheme, port)
+	log.Printf("   GET      %s://localhost:%s/api/history/{id} - A past diagnosis with its data", scheme, port)
+	log.Printf("   GET      %s://localhost:%s/api/health - Health check", scheme, port)
+	log.Printf("   GET      %s://localhost:%s/api/providers - LLM provider health", scheme, port)
+	log.Printf("   GET      %s://localhost:%s/metrics - Prometheus metrics", scheme, port)
+	log.Printf("⚙️  Max in-flight diagnoses: %d (queue %d, wait %s)", cap(queue.slots), queue.maxQueued, queue.timeout)
+	log.Printf("⚙️  Max in-flight LLM calls: %d (queue %d, wait %s)", cap(llmQueue.slots), llmQueue.maxQueued, llmQueue.timeout)
+	log.Printf("⚙️  Rate limit: %s", limiter)
+	log.Printf("🔔 Alert analyses added to: %s", alerts)
+	if tracing.Enabled() {
+		log.Printf("🔭 Tracing: exporting spans over OTLP")
+	}
+	if auth.enabled() {
+		log.Printf("🔒 API authentication: %s", auth)
+	} else {
+		log.Printf("⚠️  API authentication is disabled; anyone who can reach the port can read the cluster and spend LLM tokens. Set KUBEHELP_API_TOKENS, KUBEHELP_OIDC_ISSUER or KUBEHELP_TLS_CLIENT_CA")
+	}
+	if certs != nil {
+		log.Printf("🔐 TLS: %s", certs)
+	}
+	log.Printf("🌐 CORS: %s", cors)
+	log.Printf("⚙️  Timeouts: read %s, write %s, shutdown %s", timeouts.read, timeouts.write, timeouts.shutdown)
+	if promptTemplate != nil {
+		log.Printf("📝 Prompt template: %s", os.Getenv("KUBEHELP_PROMPT_TEMPLATE"))
+	}
+	if scans != nil {
+		scans.start(work)
+	}
 
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
+	// Drain in-flight work on SIGTERM, as sent by Kubernetes before it
+	// kills the pod
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		if certs != nil {
+			// certs supplies the certificate through TLSConfig
+			errs <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errs <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
 		log.Fatal(err)
+	case <-ctx.Done():
 	}
+	stop()
+	shutdown(srv, timeouts.shutdown, cancelWork, runner, scans)
 }
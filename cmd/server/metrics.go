@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kubehelp/internal/llm"
+)
+
+// Reasons a request can be turned away by the work queue
+const (
+	rejectFull    = "full"
+	rejectTimeout = "timeout"
+)
+
+// metrics holds server counters exposed at /metrics in the Prometheus text
+// format. Counters are updated atomically; the per-provider LLM usage totals
+// are guarded by usageMu.
+type metrics struct {
+	// queue tracks the diagnosis work queue, llmQueue the LLM call queue
+	queue    queueMetrics
+	llmQueue queueMetrics
+
+	rateLimitedClient atomic.Int64
+	rateLimitedGlobal atomic.Int64
+
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+
+	usageMu sync.Mutex
+	usage   map[string]*providerUsage
+}
+
+// providerUsage holds the LLM usage totals of one provider
+type providerUsage struct {
+	promptTokens     int64
+	completionTokens int64
+	cost             float64
+}
+
+// queueMetrics holds the counters of one work queue
+type queueMetrics struct {
+	depth           atomic.Int64
+	inFlight        atomic.Int64
+	waitNanos       atomic.Int64
+	waitCount       atomic.Int64
+	rejectedFull    atomic.Int64
+	rejectedTimeout atomic.Int64
+}
+
+// serverMetrics is the process-wide metrics registry
+var serverMetrics = &metrics{}
+
+func (m *queueMetrics) setDepth(n int64) { m.depth.Store(n) }
+
+func (m *queueMetrics) addInFlight(delta int64) { m.inFlight.Add(delta) }
+
+func (m *queueMetrics) observeWait(d time.Duration) {
+	m.waitNanos.Add(int64(d))
+	m.waitCount.Add(1)
+}
+
+func (m *queueMetrics) rejected(reason string) {
+	switch reason {
+	case rejectFull:
+		m.rejectedFull.Add(1)
+	case rejectTimeout:
+		m.rejectedTimeout.Add(1)
+	}
+}
+
+func (m *metrics) rateLimited(scope string) {
+	switch scope {
+	case rateLimitClient:
+		m.rateLimitedClient.Add(1)
+	case rateLimitGlobal:
+		m.rateLimitedGlobal.Add(1)
+	}
+}
+
+// addUsage adds the token usage of an analysis to the per-provider totals.
+// Calls without a known price add no cost.
+func (m *metrics) addUsage(usages []llm.Usage) {
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	for _, u := range usages {
+		if m.usage == nil {
+			m.usage = make(map[string]*providerUsage)
+		}
+		total, ok := m.usage[u.Provider]
+		if !ok {
+			total = &providerUsage{}
+			m.usage[u.Provider] = total
+		}
+		total.promptTokens += int64(u.PromptTokens)
+		total.completionTokens += int64(u.CompletionTokens)
+		if u.Cost != nil {
+			total.cost += *u.Cost
+		}
+	}
+}
+
+// renderUsage writes the per-provider LLM usage totals
+func (m *metrics) renderUsage(sb *strings.Builder) {
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+
+	providers := make([]string, 0, len(m.usage))
+	for provider := range m.usage {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	sb.WriteString("# HELP kubehelp_llm_prompt_tokens_total Prompt tokens reported by LLM providers.\n")
+	sb.WriteString("# TYPE kubehelp_llm_prompt_tokens_total counter\n")
+	for _, provider := range providers {
+		sb.WriteString(fmt.Sprintf("kubehelp_llm_prompt_tokens_total{provider=%q} %d\n", provider, m.usage[provider].promptTokens))
+	}
+
+	sb.WriteString("# HELP kubehelp_llm_completion_tokens_total Completion tokens reported by LLM providers.\n")
+	sb.WriteString("# TYPE kubehelp_llm_completion_tokens_total counter\n")
+	for _, provider := range providers {
+		sb.WriteString(fmt.Sprintf("kubehelp_llm_completion_tokens_total{provider=%q} %d\n", provider, m.usage[provider].completionTokens))
+	}
+
+	sb.WriteString("# HELP kubehelp_llm_cost_usd_total Estimated LLM cost in USD, for models with a known price.\n")
+	sb.WriteString("# TYPE kubehelp_llm_cost_usd_total counter\n")
+	for _, provider := range providers {
+		sb.WriteString(fmt.Sprintf("kubehelp_llm_cost_usd_total{provider=%q} %g\n", provider, m.usage[provider].cost))
+	}
+}
+
+// render writes all metrics in the Prometheus text exposition format
+func (m *metrics) render() string {
+	var sb strings.Builder
+
+	sb.WriteString("# HELP kubehelp_queue_depth Diagnoses waiting for a free slot.\n")
+	sb.WriteString("# TYPE kubehelp_queue_depth gauge\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_queue_depth %d\n", m.queue.depth.Load()))
+
+	sb.WriteString("# HELP kubehelp_requests_in_flight Diagnoses currently running.\n")
+	sb.WriteString("# TYPE kubehelp_requests_in_flight gauge\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_requests_in_flight %d\n", m.queue.inFlight.Load()))
+
+	sb.WriteString("# HELP kubehelp_queue_wait_seconds Time spent waiting for a diagnosis slot.\n")
+	sb.WriteString("# TYPE kubehelp_queue_wait_seconds summary\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_queue_wait_seconds_sum %g\n", time.Duration(m.queue.waitNanos.Load()).Seconds()))
+	sb.WriteString(fmt.Sprintf("kubehelp_queue_wait_seconds_count %d\n", m.queue.waitCount.Load()))
+
+	sb.WriteString("# HELP kubehelp_queue_rejected_total Requests rejected with 503 by the work queue.\n")
+	sb.WriteString("# TYPE kubehelp_queue_rejected_total counter\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_queue_rejected_total{reason=%q} %d\n", rejectFull, m.queue.rejectedFull.Load()))
+	sb.WriteString(fmt.Sprintf("kubehelp_queue_rejected_total{reason=%q} %d\n", rejectTimeout, m.queue.rejectedTimeout.Load()))
+
+	sb.WriteString("# HELP kubehelp_llm_queue_depth LLM calls waiting for a free slot.\n")
+	sb.WriteString("# TYPE kubehelp_llm_queue_depth gauge\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_llm_queue_depth %d\n", m.llmQueue.depth.Load()))
+
+	sb.WriteString("# HELP kubehelp_llm_requests_in_flight LLM calls currently running.\n")
+	sb.WriteString("# TYPE kubehelp_llm_requests_in_flight gauge\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_llm_requests_in_flight %d\n", m.llmQueue.inFlight.Load()))
+
+	sb.WriteString("# HELP kubehelp_llm_queue_wait_seconds Time spent waiting for an LLM slot.\n")
+	sb.WriteString("# TYPE kubehelp_llm_queue_wait_seconds summary\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_llm_queue_wait_seconds_sum %g\n", time.Duration(m.llmQueue.waitNanos.Load()).Seconds()))
+	sb.WriteString(fmt.Sprintf("kubehelp_llm_queue_wait_seconds_count %d\n", m.llmQueue.waitCount.Load()))
+
+	sb.WriteString("# HELP kubehelp_llm_queue_rejected_total LLM calls rejected with 503 by the LLM queue.\n")
+	sb.WriteString("# TYPE kubehelp_llm_queue_rejected_total counter\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_llm_queue_rejected_total{reason=%q} %d\n", rejectFull, m.llmQueue.rejectedFull.Load()))
+	sb.WriteString(fmt.Sprintf("kubehelp_llm_queue_rejected_total{reason=%q} %d\n", rejectTimeout, m.llmQueue.rejectedTimeout.Load()))
+
+	sb.WriteString("# HELP kubehelp_rate_limited_total Requests rejected with 429 by the rate limiter.\n")
+	sb.WriteString("# TYPE kubehelp_rate_limited_total counter\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_rate_limited_total{scope=%q} %d\n", rateLimitClient, m.rateLimitedClient.Load()))
+	sb.WriteString(fmt.Sprintf("kubehelp_rate_limited_total{scope=%q} %d\n", rateLimitGlobal, m.rateLimitedGlobal.Load()))
+
+	sb.WriteString("# HELP kubehelp_analysis_cache_hits_total Analyses reused from the analysis cache.\n")
+	sb.WriteString("# TYPE kubehelp_analysis_cache_hits_total counter\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_analysis_cache_hits_total %d\n", m.cacheHits.Load()))
+
+	sb.WriteString("# HELP kubehelp_analysis_cache_misses_total Cacheable analyses sent to the LLM.\n")
+	sb.WriteString("# TYPE kubehelp_analysis_cache_misses_total counter\n")
+	sb.WriteString(fmt.Sprintf("kubehelp_analysis_cache_misses_total %d\n", m.cacheMisses.Load()))
+
+	m.renderUsage(&sb)
+
+	return sb.String()
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(serverMetrics.render()))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Response media types /api/diagnose can produce. JSON is the default and
+// canonical form; the text types carry only the analysis, for curl users and
+// simple dashboards. Event streams are served like /api/diagnose/stream.
+const (
+	mediaJSON        = "application/json"
+	mediaMarkdown    = "text/markdown"
+	mediaText        = "text/plain"
+	mediaEventStream = "text/event-stream"
+)
+
+// negotiateMediaType picks the response type for an Accept header. The
+// highest q-value wins; ties, wildcards and unknown types select JSON.
+func negotiateMediaType(accept string) string {
+	best, bestQ := mediaJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		switch mediaType {
+		case mediaJSON, "application/*", "*/*":
+			mediaType = mediaJSON
+		case mediaMarkdown, mediaText, mediaEventStream:
+		case "text/*":
+			mediaType = mediaMarkdown
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && mediaType == mediaJSON) {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// negotiateLanguage picks the language tag with the highest q-value of an
+// Accept-Language header, e.g. "ja" for "ja,en;q=0.8", or "" when it names
+// none besides the "*" wildcard
+func negotiateLanguage(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+// acceptLanguage defaults the analysis language of settings to the
+// preferred language of the request, so that browsers get analyses in their
+// user's language; a language in the request body takes precedence
+func acceptLanguage(r *http.Request, settings *PromptSettings) {
+	if settings.Language == "" {
+		settings.Language = negotiateLanguage(r.Header.Get("Accept-Language"))
+	}
+}
+
+// respondWithDiagnosis writes resp in the negotiated media type
+func respondWithDiagnosis(w http.ResponseWriter, r *http.Request, resp *DiagnoseResponse) {
+	w.Header().Add("Vary", "Accept")
+	mediaType := negotiateMediaType(r.Header.Get("Accept"))
+	if mediaType == mediaJSON {
+		w.Header().Set("Content-Type", mediaJSON)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	writeText(w, mediaType, http.StatusOK, resp.Analysis)
+}
+
+// respondWithNegotiatedError writes an error in the negotiated media type:
+// the usual {"error": ...} body for JSON, an "Error: ..." line otherwise
+func respondWithNegotiatedError(w http.ResponseWriter, r *http.Request, message string, statusCode int) {
+	w.Header().Add("Vary", "Accept")
+	mediaType := negotiateMediaType(r.Header.Get("Accept"))
+	if mediaType == mediaJSON {
+		respondWithError(w, message, statusCode)
+		return
+	}
+	writeText(w, mediaType, statusCode, "Error: "+message)
+}
+
+func writeText(w http.ResponseWriter, mediaType string, statusCode int, body string) {
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	fmt.Fprint(w, body)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"kubehelp/internal/llm"
+)
+
+// providerCheckTimeout bounds the health checks of /api/providers
+const providerCheckTimeout = 5 * time.Second
+
+// ProvidersResponse is returned by /api/providers
+type ProvidersResponse struct {
+	Providers []llm.ProviderHealth `json:"providers"`
+}
+
+// providersHandler checks every registered provider concurrently and
+// reports whether it is reachable, how long it took to answer and the state
+// of its circuit breaker. Providers without credentials are reported as
+// unconfigured rather than failing the request.
+func providersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), providerCheckTimeout)
+	defer cancel()
+
+	names := llm.Providers()
+	health := make([]llm.ProviderHealth, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health[i] = llm.CheckHealth(ctx, name)
+		}()
+	}
+	wg.Wait()
+	respondWithJSON(w, http.StatusOK, ProvidersResponse{Providers: health})
+}
+
+// setRetryAfter adds the Retry-After header when err means the LLM queue
+// turned the request away or the provider's circuit is open
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var open *llm.CircuitOpenError
+	if errors.As(err, &open) {
+		secs := int(time.Until(open.RetryAt).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		return
+	}
+	llmQueue.setRetryAfter(w, err)
+}
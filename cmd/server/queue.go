@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Work queue defaults, overridable via KUBEHELP_MAX_INFLIGHT,
+// KUBEHELP_MAX_QUEUE and KUBEHELP_QUEUE_TIMEOUT
+const (
+	defaultMaxInFlight  = 4
+	defaultMaxQueued    = 16
+	defaultQueueTimeout = 30 * time.Second
+)
+
+// LLM queue defaults, overridable via KUBEHELP_MAX_LLM_INFLIGHT,
+// KUBEHELP_MAX_LLM_QUEUE and KUBEHELP_LLM_QUEUE_TIMEOUT. LLM calls take
+// longer than collection, so they may wait longer.
+const (
+	defaultMaxLLMInFlight  = 2
+	defaultMaxLLMQueued    = 16
+	defaultLLMQueueTimeout = 2 * time.Minute
+)
+
+var (
+	errQueueFull       = errors.New("server busy: diagnosis queue is full")
+	errQueueTimeout    = errors.New("server busy: timed out waiting for a diagnosis slot")
+	errLLMQueueFull    = errors.New("server busy: LLM queue is full")
+	errLLMQueueTimeout = errors.New("server busy: timed out waiting for an LLM slot")
+)
+
+// llmQueue bounds concurrent LLM calls across all requests
+var llmQueue *workQueue
+
+// workQueue bounds the number of diagnoses, or LLM calls, running at once.
+// Requests beyond the limit wait for a slot up to a timeout; once maxQueued
+// requests are already waiting, new ones are rejected immediately.
+type workQueue struct {
+	slots     chan struct{}
+	maxQueued int64
+	timeout   time.Duration
+	queued    atomic.Int64
+
+	// errFull and errTimeout are returned when a request is turned away
+	errFull    error
+	errTimeout error
+	metrics    *queueMetrics
+}
+
+// newWorkQueue creates a queue allowing maxInFlight concurrent diagnoses
+func newWorkQueue(maxInFlight, maxQueued int, timeout time.Duration) *workQueue {
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+	if maxQueued < 0 {
+		maxQueued = 0
+	}
+	if timeout <= 0 {
+		timeout = defaultQueueTimeout
+	}
+	return &workQueue{
+		slots:      make(chan struct{}, maxInFlight),
+		maxQueued:  int64(maxQueued),
+		timeout:    timeout,
+		errFull:    errQueueFull,
+		errTimeout: errQueueTimeout,
+		metrics:    &serverMetrics.queue,
+	}
+}
+
+// newWorkQueueFromEnv creates a queue configured from the environment
+func newWorkQueueFromEnv() *workQueue {
+	maxInFlight, _ := strconv.Atoi(getEnv("KUBEHELP_MAX_INFLIGHT", ""))
+	maxQueued, err := strconv.Atoi(getEnv("KUBEHELP_MAX_QUEUE", ""))
+	if err != nil {
+		maxQueued = defaultMaxQueued
+	}
+	timeout, _ := time.ParseDuration(getEnv("KUBEHELP_QUEUE_TIMEOUT", ""))
+	return newWorkQueue(maxInFlight, maxQueued, timeout)
+}
+
+// newLLMQueueFromEnv creates the queue for LLM calls. Diagnoses hold their
+// work queue slot while collecting, so a lower LLM limit lets collection
+// proceed while the LLM backend is saturated.
+func newLLMQueueFromEnv() *workQueue {
+	// Apply the LLM defaults here, as newWorkQueue falls back to the
+	// diagnosis queue's
+	maxInFlight, err := strconv.Atoi(getEnv("KUBEHELP_MAX_LLM_INFLIGHT", ""))
+	if err != nil || maxInFlight <= 0 {
+		maxInFlight = defaultMaxLLMInFlight
+	}
+	maxQueued, err := strconv.Atoi(getEnv("KUBEHELP_MAX_LLM_QUEUE", ""))
+	if err != nil {
+		maxQueued = defaultMaxLLMQueued
+	}
+	timeout, err := time.ParseDuration(getEnv("KUBEHELP_LLM_QUEUE_TIMEOUT", ""))
+	if err != nil || timeout <= 0 {
+		timeout = defaultLLMQueueTimeout
+	}
+	q := newWorkQueue(maxInFlight, maxQueued, timeout)
+	q.errFull, q.errTimeout = errLLMQueueFull, errLLMQueueTimeout
+	q.metrics = &serverMetrics.llmQueue
+	return q
+}
+
+// acquire waits for a free slot. The returned release function must be
+// called once the work is done.
+func (q *workQueue) acquire(ctx context.Context) (func(), error) {
+	start := time.Now()
+
+	select {
+	case q.slots <- struct{}{}:
+		return q.started(start), nil
+	default:
+	}
+
+	if q.queued.Add(1) > q.maxQueued {
+		q.queued.Add(-1)
+		q.metrics.rejected(rejectFull)
+		return nil, q.errFull
+	}
+	q.metrics.setDepth(q.queued.Load())
+	defer func() {
+		q.metrics.setDepth(q.queued.Add(-1))
+	}()
+
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+
+	select {
+	case q.slots <- struct{}{}:
+		return q.started(start), nil
+	case <-timer.C:
+		q.metrics.rejected(rejectTimeout)
+		return nil, q.errTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// started records a granted slot and returns its release function
+func (q *workQueue) started(queuedAt time.Time) func() {
+	q.metrics.observeWait(time.Since(queuedAt))
+	q.metrics.addInFlight(1)
+	return func() {
+		q.metrics.addInFlight(-1)
+		<-q.slots
+	}
+}
+
+// busy reports whether err means the queue turned the request away
+func (q *workQueue) busy(err error) bool {
+	return errors.Is(err, q.errFull) || errors.Is(err, q.errTimeout)
+}
+
+// retryAfter is the Retry-After value, in seconds, sent with 503 responses
+func (q *workQueue) retryAfter() int {
+	secs := int(q.timeout / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
+
+// setRetryAfter adds the Retry-After header when err means the queue turned
+// the request away
+func (q *workQueue) setRetryAfter(w http.ResponseWriter, err error) {
+	if q.busy(err) {
+		w.Header().Set("Retry-After", strconv.Itoa(q.retryAfter()))
+	}
+}
+
+// limit wraps a handler so it only runs while holding a queue slot
+func (q *workQueue) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, err := q.acquire(r.Context())
+		if err != nil {
+			if q.busy(err) {
+				q.setRetryAfter(w, err)
+				respondWithNegotiatedError(w, r, err.Error(), http.StatusServiceUnavailable)
+			}
+			// Otherwise the client went away; there is nobody to answer
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingHandler holds its queue slot until a value is sent on unblock,
+// reporting on started once it runs
+type blockingHandler struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan struct{}, 16), unblock: make(chan struct{})}
+}
+
+func (h *blockingHandler) serve(w http.ResponseWriter, r *http.Request) {
+	h.started <- struct{}{}
+	<-h.unblock
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveAsync runs the request in the background and returns its recorder,
+// filled once done is closed
+func serveAsync(handler http.HandlerFunc) (*httptest.ResponseRecorder, chan struct{}) {
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler(rec, httptest.NewRequest("POST", "/api/diagnose", nil))
+	}()
+	return rec, done
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWorkQueueShedsLoad(t *testing.T) {
+	const maxInFlight, maxQueued = 2, 2
+	q := newWorkQueue(maxInFlight, maxQueued, time.Minute)
+	h := newBlockingHandler()
+	handler := q.limit(h.serve)
+
+	// Fill the slots, then the queue
+	var done []chan struct{}
+	for i := 0; i < maxInFlight; i++ {
+		_, d := serveAsync(handler)
+		done = append(done, d)
+		<-h.started
+	}
+	for i := 0; i < maxQueued; i++ {
+		_, d := serveAsync(handler)
+		done = append(done, d)
+	}
+	waitFor(t, "queued requests", func() bool { return q.queued.Load() == maxQueued })
+
+	// One more is turned away at once
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/api/diagnose", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if got, want := rec.Header().Get("Retry-After"), "60"; got != want {
+		t.Errorf("Retry-After = %q, want %q", got, want)
+	}
+	if !strings.Contains(rec.Body.String(), errQueueFull.Error()) {
+		t.Errorf("body = %q, want %q", rec.Body.String(), errQueueFull.Error())
+	}
+
+	// Each release hands the slot to a queued request
+	for i := 0; i < maxQueued; i++ {
+		h.unblock <- struct{}{}
+		select {
+		case <-h.started:
+		case <-time.After(time.Second):
+			t.Fatalf("queued request %d did not get a released slot", i+1)
+		}
+	}
+	if n := q.queued.Load(); n != 0 {
+		t.Errorf("queued = %d after the slots were released, want 0", n)
+	}
+	for i := 0; i < maxInFlight; i++ {
+		h.unblock <- struct{}{}
+	}
+	for _, d := range done {
+		<-d
+	}
+	if n := len(q.slots); n != 0 {
+		t.Errorf("%d slots still held after all requests finished", n)
+	}
+}
+
+func TestWorkQueueTimeout(t *testing.T) {
+	q := newWorkQueue(1, 1, 50*time.Millisecond)
+	h := newBlockingHandler()
+	handler := q.limit(h.serve)
+
+	_, done := serveAsync(handler)
+	<-h.started
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/api/diagnose", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("rejected after %s, before the queue timeout", waited)
+	}
+	if !strings.Contains(rec.Body.String(), errQueueTimeout.Error()) {
+		t.Errorf("body = %q, want %q", rec.Body.String(), errQueueTimeout.Error())
+	}
+	// Timeouts under a second still ask clients to wait a second
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+
+	h.unblock <- struct{}{}
+	<-done
+}
+
+func TestLLMQueueDefaults(t *testing.T) {
+	for _, value := range []string{"", "0", "-1", "many"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("KUBEHELP_MAX_LLM_INFLIGHT", value)
+			t.Setenv("KUBEHELP_LLM_QUEUE_TIMEOUT", value)
+			q := newLLMQueueFromEnv()
+			if n := cap(q.slots); n != defaultMaxLLMInFlight {
+				t.Errorf("slots = %d, want %d", n, defaultMaxLLMInFlight)
+			}
+			if q.timeout != defaultLLMQueueTimeout {
+				t.Errorf("timeout = %s, want %s", q.timeout, defaultLLMQueueTimeout)
+			}
+		})
+	}
+}
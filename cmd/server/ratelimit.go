@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Rate limit defaults, overridable via KUBEHELP_RATE_LIMIT,
+// KUBEHELP_RATE_BURST, KUBEHELP_GLOBAL_RATE_LIMIT and
+// KUBEHELP_GLOBAL_RATE_BURST. Limits are in requests per second; 0 disables
+// the limit.
+const (
+	defaultRateLimit       = 1
+	defaultRateBurst       = 10
+	defaultGlobalRateLimit = 10
+	defaultGlobalRateBurst = 50
+)
+
+// clientIdleTimeout is how long the limiter of an idle client is kept
+const clientIdleTimeout = 10 * time.Minute
+
+// Scopes of a rate limit rejection
+const (
+	rateLimitClient = "client"
+	rateLimitGlobal = "global"
+)
+
+// rateLimiter rejects requests beyond a token-bucket rate per client IP and
+// across all clients, so a reload storm from one browser cannot fan out
+// unbounded work to the apiserver and the LLM backend
+type rateLimiter struct {
+	clientRate  rate.Limit
+	clientBurst int
+	global      *rate.Limiter
+	// trustProxy takes the client IP from X-Forwarded-For, for servers
+	// behind a reverse proxy or ingress controller
+	trustProxy bool
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter creates a limiter allowing clientRate requests per second
+// per client IP and globalRate overall, each with a burst; a rate of 0
+// disables that limit
+func newRateLimiter(clientRate float64, clientBurst int, globalRate float64, globalBurst int, trustProxy bool) *rateLimiter {
+	l := &rateLimiter{
+		clientRate:  rate.Limit(clientRate),
+		clientBurst: max(clientBurst, 1),
+		trustProxy:  trustProxy,
+		clients:     make(map[string]*clientLimiter),
+	}
+	if globalRate > 0 {
+		l.global = rate.NewLimiter(rate.Limit(globalRate), max(globalBurst, 1))
+	}
+	return l
+}
+
+// newRateLimiterFromEnv creates a rate limiter configured from the
+// environment
+func newRateLimiterFromEnv() *rateLimiter {
+	clientRate := envFloat("KUBEHELP_RATE_LIMIT", defaultRateLimit)
+	clientBurst := envInt("KUBEHELP_RATE_BURST", defaultRateBurst)
+	globalRate := envFloat("KUBEHELP_GLOBAL_RATE_LIMIT", defaultGlobalRateLimit)
+	globalBurst := envInt("KUBEHELP_GLOBAL_RATE_BURST", defaultGlobalRateBurst)
+	trustProxy, _ := strconv.ParseBool(getEnv("KUBEHELP_TRUST_PROXY", "false"))
+	return newRateLimiter(clientRate, clientBurst, globalRate, globalBurst, trustProxy)
+}
+
+func envFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// allow takes a token for the client and a global one. When either limit is
+// exceeded no token is taken, and the wait until the next token and the
+// scope of the exceeded limit are returned.
+func (l *rateLimiter) allow(client string, now time.Time) (time.Duration, string) {
+	var clientRes *rate.Reservation
+	if l.clientRate > 0 {
+		clientRes = l.clientLimiter(client, now).ReserveN(now, 1)
+		if delay := clientRes.DelayFrom(now); delay > 0 {
+			clientRes.CancelAt(now)
+			return delay, rateLimitClient
+		}
+	}
+	if l.global != nil {
+		res := l.global.ReserveN(now, 1)
+		if delay := res.DelayFrom(now); delay > 0 {
+			res.CancelAt(now)
+			if clientRes != nil {
+				clientRes.CancelAt(now)
+			}
+			return delay, rateLimitGlobal
+		}
+	}
+	return 0, ""
+}
+
+// clientLimiter returns the limiter of a client, dropping the limiters of
+// clients idle for clientIdleTimeout at most once per timeout
+func (l *rateLimiter) clientLimiter(client string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > clientIdleTimeout {
+		for key, c := range l.clients {
+			if now.Sub(c.lastSeen) > clientIdleTimeout {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.clientRate, l.clientBurst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// String describes the limits for the startup log, e.g.
+// "1/s (burst 10) per client, 10/s (burst 50) overall"
+func (l *rateLimiter) String() string {
+	describe := func(limit rate.Limit, burst int) string {
+		if limit <= 0 {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%g/s (burst %d)", float64(limit), burst)
+	}
+	overall := describe(0, 0)
+	if l.global != nil {
+		overall = describe(l.global.Limit(), l.global.Burst())
+	}
+	return describe(l.clientRate, l.clientBurst) + " per client, " + overall + " overall"
+}
+
+// clientIP returns the IP a request came from: the address the nearest
+// proxy appended to X-Forwarded-For when proxies are trusted, otherwise the
+// connection's remote address
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	if l.trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limit wraps a handler so requests beyond the rate limits get 429 Too Many
+// Requests with a Retry-After header
+func (l *rateLimiter) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		delay, scope := l.allow(l.clientIP(r), time.Now())
+		if delay == 0 {
+			next(w, r)
+			return
+		}
+
+		serverMetrics.rateLimited(scope)
+		message := "rate limit exceeded: too many requests from this client"
+		if scope == rateLimitGlobal {
+			message = "rate limit exceeded: the server is receiving too many requests"
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		respondWithNegotiatedError(w, r, message, http.StatusTooManyRequests)
+	}
+}
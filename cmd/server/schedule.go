@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"kubehelp/internal/history"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+
+	"github.com/robfig/cron/v3"
+	"sigs.k8s.io/yaml"
+)
+
+// scheduledScan is a namespace the server diagnoses periodically. The LLM is
+// only called when collection finds anomalies.
+type scheduledScan struct {
+	// Name identifies the scan in logs and notifications (default: the
+	// namespace, prefixed with the context if set)
+	Name string `json:"name,omitempty"`
+	// Schedule is a standard five-field cron expression, e.g. "*/30 * * * *"
+	Schedule string `json:"schedule"`
+	DiagnoseRequest
+	// MinSeverity is the lowest finding severity counted as an anomaly
+	// (default medium); failing pods always count
+	MinSeverity k8s.Severity `json:"minSeverity,omitempty"`
+	// Webhook, when set, receives a ScanResult for scans that found
+	// anomalies or failed
+	Webhook string `json:"webhook,omitempty"`
+	// CreateIssue files scans that found anomalies as issues in the tracker
+	// configured by KUBEHELP_ISSUE_TRACKER, unless their anomalies are the
+	// same as in the scan's last issue
+	CreateIssue bool `json:"createIssue,omitempty"`
+}
+
+// scheduleFile is the file named by KUBEHELP_SCHEDULE_CONFIG:
+//
+//	scans:
+//	- schedule: "*/30 * * * *"
+//	  namespace: payments
+//	  context: prod
+//	  llm: openai,ollama
+//	  logs: true
+//	  minSeverity: high
+//	  webhook: https://hooks.example.com/kubehelp
+//	  createIssue: true
+type scheduleFile struct {
+	Scans []scheduledScan `json:"scans"`
+}
+
+// ScanResult is posted to the webhook of a scheduled scan
+type ScanResult struct {
+	Scan       string                  `json:"scan"`
+	Namespace  string                  `json:"namespace"`
+	Context    string                  `json:"context,omitempty"`
+	Anomalies  []string                `json:"anomalies,omitempty"`
+	Analysis   string                  `json:"analysis,omitempty"`
+	Structured *llm.StructuredAnalysis `json:"structured,omitempty"`
+	// HistoryID is the history record of the scan, readable from
+	// /api/history/{id}
+	HistoryID string `json:"historyId,omitempty"`
+	// IssueURL is the issue filed for the scan with createIssue
+	IssueURL string `json:"issueUrl,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// scheduler runs the scheduled scans; scans still running when they are due
+// again are skipped
+type scheduler struct {
+	cron   *cron.Cron
+	queue  *workQueue
+	scans  []scheduledScan
+	client *http.Client
+	// issues files the scans with createIssue; nil when none has it
+	issues *issueFiler
+	// ctx is cancelled when the server shuts down
+	ctx context.Context
+}
+
+// newSchedulerFromEnv loads the scans of KUBEHELP_SCHEDULE_CONFIG and, with
+// KUBEHELP_SCHEDULE, one scan per namespace in KUBEHELP_SCHEDULE_NAMESPACES
+// (default "default"). KUBEHELP_SCHEDULE_LLM, KUBEHELP_SCHEDULE_MIN_SEVERITY,
+// KUBEHELP_SCHEDULE_WEBHOOK and KUBEHELP_SCHEDULE_CREATE_ISSUE are the
+// defaults of every scan. Scans wait for a slot of queue like API diagnoses.
+// It returns nil when no scan is configured.
+func newSchedulerFromEnv(queue *workQueue) (*scheduler, error) {
+	var scans []scheduledScan
+	if path := os.Getenv("KUBEHELP_SCHEDULE_CONFIG"); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schedule config: %w", err)
+		}
+		var file scheduleFile
+		if err := yaml.UnmarshalStrict(raw, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse schedule config %s: %w", path, err)
+		}
+		scans = file.Scans
+	}
+	if schedule := os.Getenv("KUBEHELP_SCHEDULE"); schedule != "" {
+		for _, ns := range strings.Split(getEnv("KUBEHELP_SCHEDULE_NAMESPACES", "default"), ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				scans = append(scans, scheduledScan{Schedule: schedule, DiagnoseRequest: DiagnoseRequest{Namespace: ns}})
+			}
+		}
+	}
+	if len(scans) == 0 {
+		return nil, nil
+	}
+
+	s := &scheduler{
+		cron:   cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger))),
+		queue:  queue,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for i := range scans {
+		scan := &scans[i]
+		applyScanDefaults(scan)
+		if err := scan.validate(); err != nil {
+			return nil, fmt.Errorf("invalid scheduled scan %s: %w", scan.Name, err)
+		}
+		if scan.CreateIssue && s.issues == nil {
+			issues, err := newIssueFilerFromEnv()
+			if err != nil {
+				return nil, fmt.Errorf("scan %s sets createIssue: %w", scan.Name, err)
+			}
+			s.issues = issues
+		}
+		run := *scan
+		if _, err := s.cron.AddFunc(scan.Schedule, func() { s.run(run) }); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q of scan %s: %w", scan.Schedule, scan.Name, err)
+		}
+	}
+	s.scans = scans
+	return s, nil
+}
+
+// applyScanDefaults fills in the name, namespace and provider of a scan and
+// the settings shared through the environment
+func applyScanDefaults(scan *scheduledScan) {
+	// Conflicting namespaces are left for validate to report
+	if err := scan.DiagnoseRequest.validate(); err == nil {
+		scan.resolveNamespace()
+	}
+	if scan.LLMProvider == "" {
+		scan.LLMProvider = getEnv("KUBEHELP_SCHEDULE_LLM", defaultLLMProvider)
+	}
+	if scan.MinSeverity == "" {
+		scan.MinSeverity = k8s.Severity(getEnv("KUBEHELP_SCHEDULE_MIN_SEVERITY", string(k8s.SeverityMedium)))
+	}
+	if scan.Webhook == "" {
+		scan.Webhook = os.Getenv("KUBEHELP_SCHEDULE_WEBHOOK")
+	}
+	if !scan.CreateIssue {
+		scan.CreateIssue = os.Getenv("KUBEHELP_SCHEDULE_CREATE_ISSUE") == "true"
+	}
+	if scan.Name == "" {
+		scan.Name = scan.Namespace
+		if scan.Context != "" {
+			scan.Name = scan.Context + "/" + scan.Namespace
+		}
+	}
+}
+
+// validate rejects unknown severities and invalid diagnose settings
+func (s scheduledScan) validate() error {
+	if s.MinSeverity.Rank() == 0 {
+		return fmt.Errorf("minSeverity must be critical, high, medium or low")
+	}
+	return s.DiagnoseRequest.validate()
+}
+
+// start runs the scans on their schedules in the background until ctx is
+// cancelled
+func (s *scheduler) start(ctx context.Context) {
+	for _, scan := range s.scans {
+		log.Printf("⏰ Scheduled scan %s of namespace %s: %q, min severity %s", scan.Name, scan.Namespace, scan.Schedule, scan.MinSeverity)
+	}
+	s.ctx = ctx
+	s.cron.Start()
+}
+
+// stop stops scheduling scans; the returned channel is closed once the
+// running scans have finished
+func (s *scheduler) stop() <-chan struct{} {
+	return s.cron.Stop().Done()
+}
+
+// run collects the namespace of a scan and, when it finds anomalies,
+// analyzes them, records the result in history, files an issue and notifies
+// the webhook. Healthy scans are recorded without an analysis.
+func (s *scheduler) run(scan scheduledScan) {
+	ctx := s.ctx
+	if diagnoseTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, diagnoseTimeout)
+		defer cancel()
+	}
+	release, err := s.queue.acquire(ctx)
+	if err != nil {
+		log.Printf("Scheduled scan %s skipped: %v", scan.Name, err)
+		return
+	}
+	defer release()
+
+	start := time.Now()
+	result := ScanResult{Scan: scan.Name, Namespace: scan.Namespace, Context: scan.Context}
+	record := history.Record{
+		Namespace: scan.Namespace,
+		Workloads: scan.Workloads,
+		Context:   scan.Context,
+		Request:   requestJSON(scan),
+	}
+	fail := func(err error) {
+		err = contextError(err, time.Since(start))
+		log.Printf("Scheduled scan %s failed: %v", scan.Name, err)
+		record.Error = err.Error()
+		record.DurationMs = time.Since(start).Milliseconds()
+		result.Error = err.Error()
+		result.HistoryID = saveHistory(record)
+		s.notify(scan, result)
+	}
+
+	data, err := collectDiagnostics(ctx, scan.DiagnoseRequest, nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	record.DiagnosticData = data
+	result.Anomalies = data.Anomalies(scan.MinSeverity)
+	if len(result.Anomalies) == 0 {
+		log.Printf("Scheduled scan %s: no anomalies", scan.Name)
+		record.DurationMs = time.Since(start).Milliseconds()
+		saveHistory(record)
+		return
+	}
+
+	log.Printf("Scheduled scan %s: %d anomalies, analyzing with %s", scan.Name, len(result.Anomalies), scan.LLMProvider)
+	record.Provider = scan.LLMProvider
+	prompt, err := buildPrompt(data, scan.PromptSettings)
+	if err != nil {
+		fail(err)
+		return
+	}
+	resp, _, err := analyzePrompt(ctx, scan.LLMProvider, prompt, analysisCacheKey(data, scan.LLMProvider, scan.PromptSettings), scan.PromptSettings, nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	record.Analysis = resp.Analysis
+	record.DurationMs = time.Since(start).Milliseconds()
+	result.Analysis = resp.Analysis
+	result.Structured = resp.Structured
+	result.HistoryID = saveHistory(record)
+	// A failed issue is logged; the webhook is still notified
+	if scan.CreateIssue {
+		url, err := s.issues.file(ctx, scan, data, result.Anomalies, resp.Analysis, resp.Structured)
+		if err != nil {
+			log.Printf("⚠️  Failed to create issue for scan %s: %v", scan.Name, err)
+		}
+		result.IssueURL = url
+	}
+	s.notify(scan, result)
+}
+
+// notify posts result to the webhook of scan, if any; failures are logged
+func (s *scheduler) notify(scan scheduledScan, result ScanResult) {
+	if scan.Webhook == "" {
+		return
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("⚠️  Failed to encode result of scan %s: %v", scan.Name, err)
+		return
+	}
+	resp, err := s.client.Post(scan.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("⚠️  Failed to notify webhook of scan %s: %v", scan.Name, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		log.Printf("⚠️  Webhook of scan %s returned %s: %s", scan.Name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Connection timeouts. Reading headers and idling between requests are
+// bounded by constants; the others are configurable since request bodies
+// and diagnoses vary in size.
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+)
+
+// serverTimeouts bound reading a request, writing its response and
+// draining in-flight work on shutdown
+type serverTimeouts struct {
+	read     time.Duration
+	write    time.Duration
+	shutdown time.Duration
+}
+
+// newServerTimeoutsFromEnv reads KUBEHELP_READ_TIMEOUT (default 30s),
+// KUBEHELP_WRITE_TIMEOUT (default 10m) and KUBEHELP_SHUTDOWN_TIMEOUT
+// (default 30s). The write timeout covers a whole synchronous diagnosis, so
+// it is raised above KUBEHELP_DIAGNOSE_TIMEOUT when that is longer.
+func newServerTimeoutsFromEnv() serverTimeouts {
+	t := serverTimeouts{
+		read:     durationFromEnv("KUBEHELP_READ_TIMEOUT", 30*time.Second),
+		write:    durationFromEnv("KUBEHELP_WRITE_TIMEOUT", 10*time.Minute),
+		shutdown: durationFromEnv("KUBEHELP_SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+	if diagnoseTimeout > 0 && t.write <= diagnoseTimeout {
+		t.write = diagnoseTimeout + 30*time.Second
+		log.Printf("⚠️  Raised the write timeout to %s to outlast KUBEHELP_DIAGNOSE_TIMEOUT", t.write)
+	}
+	return t
+}
+
+// durationFromEnv parses the duration in the named variable, or returns
+// fallback when it is unset or not a positive duration
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(getEnv(name, "")); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// shutdown stops srv and the scheduler from taking new work and waits up to
+// grace for in-flight requests, WebSocket diagnoses, async jobs and scheduled
+// scans. Whatever is
+// still running then is cancelled through cancelWork, which the contexts of
+// requests, jobs and scans derive from.
+func shutdown(srv *http.Server, grace time.Duration, cancelWork context.CancelFunc, runner *jobRunner, scans *scheduler) {
+	log.Printf("🛑 Shutting down; waiting up to %s for in-flight diagnoses", grace)
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	stopCancel := context.AfterFunc(ctx, cancelWork)
+	defer stopCancel()
+
+	var scansDone <-chan struct{}
+	if scans != nil {
+		scansDone = scans.stop()
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  Cancelling requests still running after %s", grace)
+		srv.Close()
+	}
+	runner.wait()
+	openSockets.Wait()
+	if scansDone != nil {
+		<-scansDone
+	}
+	log.Printf("👋 Shutdown complete")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"kubehelp/internal/k8s"
+)
+
+// stageAnalysis is the progress stage reported once collection is done and
+// the LLM is called
+const stageAnalysis = "analysis"
+
+// ProgressEvent is sent as an SSE "progress" event after each collection step
+// and when the analysis starts
+type ProgressEvent struct {
+	Stage     string `json:"stage"`
+	Count     int    `json:"count"`
+	Total     int    `json:"total,omitempty"`
+	ElapsedMs int64  `json:"elapsedMs"`
+	// Message describes the step for display, e.g. "collected 42 pods" or
+	// "calling ollama"
+	Message string `json:"message"`
+}
+
+// newProgressEvent describes p for clients of a diagnosis analyzed by
+// provider
+func newProgressEvent(p k8s.Progress, provider string) ProgressEvent {
+	var msg string
+	switch {
+	case p.Stage == stageAnalysis:
+		msg = "calling " + provider
+	case p.Total > 0 && p.Count < p.Total:
+		msg = fmt.Sprintf("collecting %s (%d/%d)", p.Stage, p.Count, p.Total)
+	default:
+		msg = fmt.Sprintf("collected %d %s", p.Count, p.Stage)
+	}
+	return ProgressEvent{
+		Stage:     p.Stage,
+		Count:     p.Count,
+		Total:     p.Total,
+		ElapsedMs: p.Elapsed.Milliseconds(),
+		Message:   msg,
+	}
+}
+
+// ChunkEvent is sent as an SSE "chunk" event for each piece of the analysis
+// as the LLM generates it
+type ChunkEvent struct {
+	Text string `json:"text"`
+}
+
+// sseWriter serializes Server-Sent Events; progress is reported from
+// concurrent collectors, so writes are guarded by a mutex
+type sseWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// send writes a single event with a JSON payload and flushes it
+func (s *sseWriter) send(event string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+		event = "error"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	s.flusher.Flush()
+}
+
+// diagnoseStreamHandler runs a diagnosis like /api/diagnose but responds with
+// Server-Sent Events: "progress" after each collection step and before the
+// analysis, "chunk" for each
+// piece of the analysis as it is generated, then a single "result"
+// (DiagnoseResponse) or "error" event.
+func diagnoseStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DiagnoseRequest
+	if err := decodeJSONBody(w, r, &req, maxRequestBytes); err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	acceptLanguage(r, &req.PromptSettings)
+	if err := req.validate(); err != nil {
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// A stream sends progress as it goes, so it may run past the write
+	// timeout meant for buffered responses
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	stream := &sseWriter{w: w, flusher: flusher}
+
+	provider := cmp.Or(req.LLMProvider, defaultLLMProvider)
+	progress := func(p k8s.Progress) {
+		stream.send("progress", newProgressEvent(p, provider))
+	}
+
+	chunk := func(text string) {
+		stream.send("chunk", ChunkEvent{Text: text})
+	}
+
+	resp, _, err := runDiagnosis(r.Context(), req, progress, chunk)
+	if err != nil {
+		stream.send("error", DiagnoseResponse{Error: err.Error()})
+		return
+	}
+	stream.send("result", resp)
+}
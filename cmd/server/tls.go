@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsReloadInterval bounds how often handshakes check the certificate files
+// for changes, such as a cert-manager renewal of a mounted Secret
+const tlsReloadInterval = 10 * time.Second
+
+// serverTLS serves HTTPS with a certificate, and optionally a client CA,
+// read from files. The files are reloaded when they change, so rotated
+// certificates are picked up without a restart.
+type serverTLS struct {
+	certFile, keyFile string
+	// clientCAFile, when set, has client certificates verified against its
+	// CAs; clientAuth is tls.RequireAndVerifyClientCert or
+	// tls.VerifyClientCertIfGiven
+	clientCAFile string
+	clientAuth   tls.ClientAuthType
+
+	mu      sync.Mutex
+	config  *tls.Config
+	stamps  map[string]fileStamp
+	checked time.Time
+}
+
+// fileStamp identifies a version of a file; Kubernetes updates mounted
+// Secrets by swapping a symlink, which changes both
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// newServerTLS loads the certificate and key and, with clientCAFile, the
+// client CAs. clientAuth is "require" (default) or "optional", which lets
+// clients without a certificate connect, e.g. kubelet probes, and leaves
+// them to API authentication. It returns nil when no certificate is set.
+func newServerTLS(certFile, keyFile, clientCAFile, clientAuth string) (*serverTLS, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be set together")
+	}
+
+	t := &serverTLS{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	switch clientAuth {
+	case "", "require":
+		t.clientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		t.clientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("invalid client certificate mode %q (expected require or optional)", clientAuth)
+	}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// files returns the files the configuration is read from
+func (t *serverTLS) files() []string {
+	files := []string{t.certFile, t.keyFile}
+	if t.clientCAFile != "" {
+		files = append(files, t.clientCAFile)
+	}
+	return files
+}
+
+// reload reads the files into a new configuration; on error the current
+// one is kept
+func (t *serverTLS) reload() error {
+	stamps := make(map[string]fileStamp)
+	for _, file := range t.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS file: %w", err)
+		}
+		stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate %s: %w", t.certFile, err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		// The per-connection config replaces the server's, which net/http
+		// set up for HTTP/2
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if t.clientCAFile != "" {
+		pem, err := os.ReadFile(t.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates in client CA %s", t.clientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = t.clientAuth
+	}
+
+	t.config = config
+	t.stamps = stamps
+	t.checked = time.Now()
+	return nil
+}
+
+// changed reports whether any file differs from the loaded version. Files
+// that cannot be read count as unchanged, as during a Secret update.
+func (t *serverTLS) changed() bool {
+	for _, file := range t.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if (fileStamp{modTime: info.ModTime(), size: info.Size()}) != t.stamps[file] {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the configuration of a new connection, reloading the
+// files first when they changed since the last check
+func (t *serverTLS) current() *tls.Config {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if time.Since(t.checked) < tlsReloadInterval {
+		return t.config
+	}
+	t.checked = time.Now()
+	if t.changed() {
+		if err := t.reload(); err != nil {
+			log.Printf("⚠️  Keeping the current TLS certificate: %v", err)
+		} else {
+			log.Printf("🔐 Reloaded TLS certificate: %s", t)
+		}
+	}
+	return t.config
+}
+
+// serverConfig returns the config of the http.Server, which hands each
+// connection the current configuration
+func (t *serverTLS) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return t.current(), nil
+		},
+	}
+}
+
+// clientCerts reports whether client certificates are verified and so
+// authenticate API requests
+func (t *serverTLS) clientCerts() bool {
+	return t != nil && t.clientCAFile != ""
+}
+
+// String describes the certificate and client authentication for logs
+func (t *serverTLS) String() string {
+	var sb strings.Builder
+	sb.WriteString(t.certFile)
+	if leaf := t.config.Certificates[0].Leaf; leaf != nil {
+		sb.WriteString(fmt.Sprintf(" (%s, expires %s)", leaf.Subject.CommonName, leaf.NotAfter.Format(time.DateOnly)))
+	}
+	if t.clientCAFile != "" {
+		mode := "required"
+		if t.clientAuth == tls.VerifyClientCertIfGiven {
+			mode = "optional"
+		}
+		sb.WriteString(fmt.Sprintf(", client certificates %s (CA %s)", mode, t.clientCAFile))
+	}
+	return sb.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"kubehelp/web"
+)
+
+// Cache policies of the web UI. Pages are revalidated on every load so a
+// new server version is picked up at once; other assets may be cached.
+const (
+	cachePage  = "no-cache"
+	cacheAsset = "public, max-age=86400"
+	// cacheDev disables caching of files served from --web-dir while they
+	// are being edited
+	cacheDev = "no-store"
+)
+
+// webHandler serves the UI embedded in the binary, or the files in dir when
+// it is set, for developing the UI without rebuilding the server
+func webHandler(dir string) (http.Handler, error) {
+	if dir != "" {
+		files := http.FileServer(http.Dir(dir))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", cacheDev)
+			files.ServeHTTP(w, r)
+		}), nil
+	}
+
+	// Embedded files have no modification time, so revalidation relies on
+	// content hashes computed once at startup
+	etags, err := embeddedETags(web.Files)
+	if err != nil {
+		return nil, err
+	}
+	files := http.FileServer(http.FS(web.Files))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		if etag, ok := etags[name]; ok {
+			w.Header().Set("ETag", etag)
+		}
+		if strings.HasSuffix(name, ".html") {
+			w.Header().Set("Cache-Control", cachePage)
+		} else {
+			w.Header().Set("Cache-Control", cacheAsset)
+		}
+		files.ServeHTTP(w, r)
+	}), nil
+}
+
+// embeddedETags returns a strong ETag for every file in fsys, keyed by path
+func embeddedETags(fsys fs.FS) (map[string]string, error) {
+	etags := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		etags[name] = `"` + hex.EncodeToString(sum[:8]) + `"`
+		return nil
+	})
+	return etags, err
+}
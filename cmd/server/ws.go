@@ -0,0 +1,141 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"kubehelp/internal/k8s"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// wsProtocol is the subprotocol of /api/diagnose/ws, which clients
+	// offering subprotocols, such as a bearer token, must include
+	wsProtocol = "kubehelp.v1"
+	// wsBearerProtocolPrefix marks a subprotocol carrying an API token
+	wsBearerProtocolPrefix = "base64url.bearer.kubehelp."
+)
+
+// openSockets tracks running WebSocket diagnoses. Their connections are
+// hijacked, so http.Server.Shutdown does not wait for them.
+var openSockets sync.WaitGroup
+
+// WSMessage is a message of /api/diagnose/ws. Its events and data are those
+// of the SSE stream: "progress" (ProgressEvent), "chunk" (ChunkEvent), then
+// "result" (DiagnoseResponse) or "error" ({"error": "..."}).
+type WSMessage struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// wsWriter serializes messages; progress is reported from concurrent
+// collectors, so sends are guarded by a mutex
+type wsWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+// send writes a single message; failures mean the client is gone, which the
+// reader notices
+func (s *wsWriter) send(event string, payload any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = websocket.JSON.Send(s.conn, WSMessage{Event: event, Data: payload})
+}
+
+// diagnoseWebSocketHandler runs a diagnosis over a WebSocket, for clients
+// such as the web UI that show live progress. The client sends the
+// DiagnoseRequest as the first message; the server answers with the events
+// of /api/diagnose/stream as WSMessages and closes the connection. Closing
+// it early cancels the diagnosis.
+var diagnoseWebSocketHandler = websocket.Server{
+	// Browsers connect from the server's own origin or one the CORS policy
+	// allows; other clients send no Origin
+	Handshake: func(config *websocket.Config, r *http.Request) error {
+		if origin := r.Header.Get("Origin"); !cors.allowsWebSocket(origin, r) {
+			return fmt.Errorf("origin %s not allowed", origin)
+		}
+		offered := config.Protocol
+		config.Protocol = nil
+		for _, protocol := range offered {
+			if protocol == wsProtocol {
+				config.Protocol = []string{wsProtocol}
+			}
+		}
+		if len(offered) > 0 && config.Protocol == nil {
+			return fmt.Errorf("subprotocol %s required", wsProtocol)
+		}
+		return nil
+	},
+	Handler: serveDiagnoseWebSocket,
+}
+
+func serveDiagnoseWebSocket(conn *websocket.Conn) {
+	openSockets.Add(1)
+	defer openSockets.Done()
+	defer conn.Close()
+
+	// The server's read and write timeouts are meant for HTTP requests: the
+	// request must arrive promptly, then the connection stays open for the
+	// whole diagnosis
+	_ = conn.SetDeadline(time.Now().Add(readHeaderTimeout))
+	conn.MaxPayloadBytes = maxRequestBytes
+	stream := &wsWriter{conn: conn}
+
+	var req DiagnoseRequest
+	if err := websocket.JSON.Receive(conn, &req); err != nil {
+		stream.send("error", DiagnoseResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+	acceptLanguage(conn.Request(), &req.PromptSettings)
+	if err := req.validate(); err != nil {
+		stream.send("error", DiagnoseResponse{Error: err.Error()})
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	// The client sends nothing more, so a failed read means it went away
+	ctx, cancel := context.WithCancel(conn.Request().Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		var discard []byte
+		for websocket.Message.Receive(conn, &discard) == nil {
+		}
+	}()
+
+	provider := cmp.Or(req.LLMProvider, defaultLLMProvider)
+	progress := func(p k8s.Progress) {
+		stream.send("progress", newProgressEvent(p, provider))
+	}
+	chunk := func(text string) {
+		stream.send("chunk", ChunkEvent{Text: text})
+	}
+
+	resp, _, err := runDiagnosis(ctx, req, progress, chunk)
+	if err != nil {
+		stream.send("error", DiagnoseResponse{Error: err.Error()})
+		return
+	}
+	stream.send("result", resp)
+}
+
+// webSocketProtocols returns the subprotocols offered by a WebSocket
+// handshake
+func webSocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return protocols
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+
+	"kubehelp/internal/analyzer"
+	"kubehelp/internal/k8s"
+)
+
+// Exit codes of diagnose --fail-on; other errors exit with 1
+const (
+	exitWarning  = 2
+	exitCritical = 3
+)
+
+// Values of --fail-on
+const (
+	failOnNone     = "none"
+	failOnWarning  = string(analyzer.StatusWarning)
+	failOnCritical = string(analyzer.StatusCritical)
+)
+
+var diagFailOn string
+
+// diagStatus is the status of the last diagnosis, checked against --fail-on
+// once it completes
+var diagStatus analyzer.Status
+
+// exitCodeError makes the process exit with code instead of 1
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// validateFailOn checks the --fail-on value
+func validateFailOn() error {
+	switch diagFailOn {
+	case failOnNone, failOnWarning, failOnCritical:
+		return nil
+	}
+	return fmt.Errorf("invalid --fail-on %q (expected none, warning or critical)", diagFailOn)
+}
+
+// resultStatus assesses a diagnosis from its rule-based diagnoses, the
+// findings of the collected data and the issues of a --structured analysis
+func resultStatus(result DiagnoseResult) analyzer.Status {
+	var severities []k8s.Severity
+	for _, d := range result.PreAnalysis {
+		severities = append(severities, d.Severity)
+	}
+	if result.Data != nil {
+		for _, cluster := range result.Data.ClusterData() {
+			for _, f := range cluster.Findings {
+				severities = append(severities, f.Severity)
+			}
+		}
+	}
+	if result.Structured != nil {
+		for _, issue := range result.Structured.Issues {
+			severities = append(severities, issue.Severity)
+		}
+	}
+	return analyzer.Assess(severities...)
+}
+
+// statusLabel renders a status for the terminal
+func statusLabel(status analyzer.Status) string {
+	switch status {
+	case analyzer.StatusCritical:
+		return "🔴 critical"
+	case analyzer.StatusWarning:
+		return "🟡 warning"
+	}
+	return "🟢 ok"
+}
+
+// failOnStatus returns the error that ends diagnose with the exit code of
+// status when it reaches the --fail-on threshold, else nil
+func failOnStatus(status analyzer.Status) error {
+	if diagFailOn == failOnNone || status.Rank() < analyzer.Status(diagFailOn).Rank() {
+		return nil
+	}
+	code := exitWarning
+	if status == analyzer.StatusCritical {
+		code = exitCritical
+	}
+	return &exitCodeError{code: code, err: fmt.Errorf("diagnosis severity is %s (--fail-on %s)", status, diagFailOn)}
+}
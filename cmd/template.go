@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"kubehelp/internal/llm"
+
+	"github.com/spf13/cobra"
+)
+
+var promptTemplateCmd = &cobra.Command{
+	Use:   "prompt-template",
+	Short: "Print the built-in prompt template, to customize with --prompt-template",
+	Long: `Prompt-template prints the Go text/template the diagnose prompt is rendered
+from. Save it, adapt it to your runbook structure and pass the file to
+--prompt-template, the promptTemplate field of a profile or, for the server,
+KUBEHELP_PROMPT_TEMPLATE.
+
+The template is executed on the DiagnosticData (see "diagnose -o json" for
+its fields). Besides the text/template builtins it can call:
+
+  sections DATA         the report sections of the built-in prompt (pods,
+                        events, logs, findings, ...) at --detail-level
+  compactSections DATA  the same sections in the terse --compact form
+  warnings LIST         the "Collection Warnings" section
+  clusterNames DATA     the contexts of a multi-cluster collection
+  namespaceLabel NS     the namespace, or "all namespaces" for -A
+  rfc3339 TIME          a time in RFC 3339 format
+  join LIST SEP         the elements of LIST separated by SEP
+  truncate S N          S cut to N characters
+  lower S, upper S      S in lower or upper case
+  json VALUE            VALUE as indented JSON
+
+The rule-based diagnoses and the --language instruction are added to the
+rendered prompt as they are to the built-in one.`,
+	Example: `  # Start from the built-in template
+  kubehelp prompt-template > runbook.tmpl
+  kubehelp diagnose -n payments --prompt-template runbook.tmpl`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := fmt.Fprint(os.Stdout, llm.DefaultPromptTemplate)
+		return err
+	},
+}
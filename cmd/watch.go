@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"kubehelp/internal/k8s"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchDebounce time.Duration
+	watchCooldown time.Duration
+	watchReasons  []string
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Diagnose a namespace automatically when pods start failing",
+	Long: `Watch follows the pods and Warning events of a namespace and runs a fresh
+diagnosis when a container enters CrashLoopBackOff, ImagePullBackOff or
+ErrImagePull, or is OOMKilled. Pods already failing when the watch starts
+trigger a diagnosis right away.
+
+Failures seen within --debounce of the first one are diagnosed together, and
+diagnoses are at least --cooldown apart, so a crash loop does not call the
+LLM on every restart. Watch accepts every diagnose flag for the diagnoses it
+runs and keeps going until interrupted; a failed diagnosis is reported and
+the watch continues.`,
+	Example: `  # Watch a namespace with a local model
+  kubehelp watch -n production
+
+  # Watch one workload, diagnosing at most every 30 minutes
+  kubehelp watch -n staging -w api-server --cooldown 30m
+
+  # Only react to OOM kills, with logs in the diagnosis
+  kubehelp watch -n batch --on OOMKilled --logs`,
+	Args: cobra.NoArgs,
+	RunE: runWatch,
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 30*time.Second, "Wait this long after the first failure so related failures are diagnosed together")
+	watchCmd.Flags().DurationVar(&watchCooldown, "cooldown", 10*time.Minute, "Minimum time between two diagnoses")
+	watchCmd.Flags().StringSliceVar(&watchReasons, "on", k8s.DefaultWatchReasons, "Container states that trigger a diagnosis")
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := applyProfile(cmd.Flags()); err != nil {
+		return err
+	}
+	resolveNamespace()
+	switch {
+	case diagFromFile != "" || diagBundle != "":
+		return fmt.Errorf("watch requires live cluster access and cannot be combined with --from-file or --bundle")
+	case diagAllNamespaces || diagAllContexts || strings.Contains(diagContext, ",") || strings.Contains(diagNamespace, ","):
+		return fmt.Errorf("watch supports a single namespace and context")
+	case diagChat:
+		return fmt.Errorf("watch cannot be combined with --chat")
+	case watchDebounce < 0 || watchCooldown < 0:
+		return fmt.Errorf("--debounce and --cooldown must not be negative")
+	}
+
+	// Watch connections are long-lived, so this client has no request
+	// timeout; the diagnoses create their own clients with --k8s-timeout
+	client, err := k8s.NewClientFromConfig(kubeClientConfig(""), 0)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	triggers := make(chan k8s.Trigger, 100)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- client.Watch(ctx, diagNamespace, k8s.WatchOptions{
+			LabelSelector: diagSelector,
+			Workloads:     diagWorkloads,
+			Reasons:       watchReasons,
+			OnWarning: func(w string) {
+				fmt.Fprintf(os.Stderr, "⚠️  %s\n\n", w)
+			},
+		}, func(t k8s.Trigger) {
+			// Failures beyond the buffer are covered by the pending diagnosis
+			select {
+			case triggers <- t:
+			default:
+			}
+		})
+	}()
+	fmt.Fprintf(os.Stderr, "👀 Watching namespace '%s' for %s (debounce %s, cooldown %s); Ctrl-C to stop\n\n",
+		diagNamespace, strings.Join(watchReasons, ", "), watchDebounce, watchCooldown)
+
+	var pending []k8s.Trigger
+	var fire <-chan time.Time
+	var lastRun time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr, "\n👋 Stopped watching")
+			return nil
+		case err := <-watchErr:
+			return err
+		case t := <-triggers:
+			fmt.Fprintf(os.Stderr, "🚨 %s %s: %s\n", t.Object, t.Reason, t.Message)
+			pending = append(pending, t)
+			if fire == nil {
+				wait := watchDebounce
+				if remaining := watchCooldown - time.Since(lastRun); !lastRun.IsZero() && remaining > wait {
+					wait = remaining
+					fmt.Fprintf(os.Stderr, "⏳ Cooling down, next diagnosis in %s\n", wait.Round(time.Second))
+				}
+				fire = time.After(wait)
+			}
+		case <-fire:
+			fire = nil
+			fmt.Fprintf(os.Stderr, "\n🔁 %s: diagnosing %d new failures\n\n", time.Now().Format(time.TimeOnly), len(pending))
+			pending = nil
+			if err := runWatchDiagnosis(ctx, cmd); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "\n❌ Diagnosis failed: %v\n", err)
+			}
+			lastRun = time.Now()
+			fmt.Fprintf(os.Stderr, "\n👀 Watching namespace '%s'\n\n", diagNamespace)
+		}
+	}
+}
+
+// runWatchDiagnosis runs one diagnosis, limited to --timeout
+func runWatchDiagnosis(ctx context.Context, cmd *cobra.Command) error {
+	if diagTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, diagTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	return contextError(diagnose(ctx, cmd), time.Since(start))
+}
@@ -0,0 +1,605 @@
+// Package analyzer runs deterministic checks over collected diagnostic data.
+// Its diagnoses name well-known failure modes with a suggested fix, so they
+// are useful without an LLM and, prepended to the prompt, steer the model
+// towards the right root cause.
+package analyzer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"kubehelp/internal/k8s"
+)
+
+// Diagnosis is a rule-based conclusion about a resource with a suggested fix
+type Diagnosis struct {
+	k8s.Finding
+	// Cluster is the context of the cluster in a multi-cluster collection
+	Cluster     string `json:"cluster,omitempty"`
+	Remediation string `json:"remediation"`
+}
+
+// rule inspects the data of a single cluster
+type rule func(data *k8s.DiagnosticData) []Diagnosis
+
+// rules run in order; each covers one failure mode
+var rules = []rule{
+	checkCrashLoops,
+	checkImagePulls,
+	checkOOMKills,
+	checkPending,
+	checkPlacement,
+	checkProbes,
+}
+
+// Analyze runs every rule over data, per cluster for a multi-cluster
+// collection, and returns the diagnoses ordered by severity
+func Analyze(data *k8s.DiagnosticData) []Diagnosis {
+	var diagnoses []Diagnosis
+	for _, cluster := range data.ClusterData() {
+		for _, r := range rules {
+			for _, d := range r(cluster) {
+				if len(data.Clusters) > 0 {
+					d.Cluster = cluster.ContextName
+				}
+				diagnoses = append(diagnoses, d)
+			}
+		}
+	}
+	sortDiagnoses(diagnoses)
+	return diagnoses
+}
+
+// sortDiagnoses orders diagnoses by descending severity, then by resource
+func sortDiagnoses(diagnoses []Diagnosis) {
+	sort.SliceStable(diagnoses, func(i, j int) bool {
+		if ri, rj := diagnoses[i].Severity.Rank(), diagnoses[j].Severity.Rank(); ri != rj {
+			return ri > rj
+		}
+		return diagnoses[i].Resource() < diagnoses[j].Resource()
+	})
+}
+
+// Resource returns the diagnosed object qualified by namespace and cluster
+func (d Diagnosis) Resource() string {
+	object := k8s.Qualify(d.Namespace, d.Object)
+	if d.Cluster != "" {
+		object = d.Cluster + ": " + object
+	}
+	return object
+}
+
+// Preamble renders diagnoses as a prompt section that comes before the
+// diagnostic report, or "" when there are none
+func Preamble(diagnoses []Diagnosis) string {
+	if len(diagnoses) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("# Rule-Based Pre-Analysis\n\n")
+	sb.WriteString("Deterministic checks matched these known failure modes. Confirm or refute each against the data below, ")
+	sb.WriteString("and explain anything they do not cover:\n\n")
+	for _, d := range diagnoses {
+		sb.WriteString(fmt.Sprintf("- [%s] %s (%s): %s Suggested fix: %s\n", d.Severity, d.Resource(), d.Rule, d.Message, d.Remediation))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Report renders diagnoses as the markdown analysis of a run without an LLM
+func Report(diagnoses []Diagnosis) string {
+	var sb strings.Builder
+	sb.WriteString("## Rule-Based Analysis\n\n")
+	if len(diagnoses) == 0 {
+		sb.WriteString("No known failure modes detected. Run with an LLM provider for a full analysis.\n")
+		return sb.String()
+	}
+	for _, d := range diagnoses {
+		sb.WriteString(fmt.Sprintf("### [%s] %s\n\n", d.Severity, d.Resource()))
+		sb.WriteString(fmt.Sprintf("**%s:** %s\n\n", d.Rule, d.Message))
+		sb.WriteString(fmt.Sprintf("**Suggested fix:** %s\n\n", d.Remediation))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// checkCrashLoops flags containers, including init containers, in
+// CrashLoopBackOff with the exit code of the last crash
+func checkCrashLoops(data *k8s.DiagnosticData) []Diagnosis {
+	var diagnoses []Diagnosis
+	for _, pod := range data.Pods {
+		for _, cs := range pod.AllContainerStatuses() {
+			if cs.Reason != "CrashLoopBackOff" {
+				continue
+			}
+			message := fmt.Sprintf("container is in CrashLoopBackOff after %d restarts", cs.RestartCount)
+			if pod.IsInitContainer(cs.Name) && !cs.Sidecar {
+				message = fmt.Sprintf("init container is in CrashLoopBackOff after %d restarts, so the app containers cannot start", cs.RestartCount)
+			}
+			remediation := fmt.Sprintf("Read the crash output with kubectl logs %s -c %s --previous and fix the failing command, config or dependency.", pod.Name, cs.Name)
+			if t := cs.LastTermination; t != nil {
+				message += fmt.Sprintf("; the last instance exited with code %d", t.ExitCode)
+				if t.Reason != "" {
+					message += fmt.Sprintf(" (%s)", t.Reason)
+				}
+				if hint := exitCodeHint(t.ExitCode); hint != "" {
+					remediation += " " + hint
+				}
+			}
+			if t := cs.LastTermination; t != nil && t.Reason == "OOMKilled" {
+				// checkOOMKills explains the memory limit
+				remediation = fmt.Sprintf("The container is killed for exceeding its memory limit; see the oom-killed diagnosis for %s.", pod.Name)
+			}
+			diagnoses = append(diagnoses, diagnosis(pod, cs.Name, "crash-loop", k8s.SeverityCritical, message+".", remediation))
+		}
+	}
+	return diagnoses
+}
+
+// exitCodeHint explains common container exit codes
+func exitCodeHint(code int32) string {
+	switch code {
+	case 1:
+		return "Exit code 1 is an application error; the log usually names it."
+	case 126, 127:
+		return "Exit codes 126/127 mean the entrypoint is not executable or not found; check command, args and the image."
+	case 137:
+		return "Exit code 137 is SIGKILL, usually an OOM kill or a failed liveness probe."
+	case 139:
+		return "Exit code 139 is a segmentation fault in the application or a native library."
+	case 143:
+		return "Exit code 143 is SIGTERM; check whether a liveness probe or preStop hook stops the container."
+	}
+	return ""
+}
+
+// checkImagePulls flags containers whose image cannot be pulled, explaining
+// the failure from the kubelet's pull events with a hint for the registry
+func checkImagePulls(data *k8s.DiagnosticData) []Diagnosis {
+	var diagnoses []Diagnosis
+	for _, pod := range data.Pods {
+		for _, cs := range pod.AllContainerStatuses() {
+			if !k8s.IsImagePullFailure(cs.Reason) {
+				continue
+			}
+			detail := pullFailure(data.Events, pod, cs)
+			message := fmt.Sprintf("image %q cannot be pulled (%s)", cs.Image, cs.Reason)
+			if detail != "" {
+				message += ": " + detail
+			}
+			remediation := pullRemediation(cs.Reason, detail, cs.ImagePull) + " " + registryHint(cs.Image)
+			diagnoses = append(diagnoses, diagnosis(pod, cs.Name, "image-pull", k8s.SeverityCritical, message, strings.TrimSpace(remediation)))
+		}
+	}
+	return diagnoses
+}
+
+// pullFailure returns the latest kubelet "Failed" event message for the
+// container's image, which carries the registry's error that the
+// ImagePullBackOff status message omits
+func pullFailure(events []k8s.EventInfo, pod k8s.PodInfo, cs k8s.ContainerStatus) string {
+	var latest *k8s.EventInfo
+	for i := range events {
+		e := &events[i]
+		if e.Reason != "Failed" || e.InvolvedObject != "Pod/"+pod.Name || e.Namespace != pod.Namespace {
+			continue
+		}
+		if !strings.Contains(e.Message, "pull") || (cs.Image != "" && !strings.Contains(e.Message, cs.Image)) {
+			continue
+		}
+		if latest == nil || e.LastTimestamp.After(latest.LastTimestamp) {
+			latest = e
+		}
+	}
+	if latest != nil {
+		return latest.Message
+	}
+	if cs.Reason != "ImagePullBackOff" {
+		return cs.Message
+	}
+	return ""
+}
+
+// pullRemediation suggests a fix for the registry error in detail, told
+// apart by the collected pull secrets when the registry rejects the pull
+func pullRemediation(reason, detail string, pull *k8s.ImagePullInfo) string {
+	lower := strings.ToLower(detail)
+	switch {
+	case reason == "InvalidImageName":
+		return "Fix the image reference; it must be [registry/]repository[:tag|@digest] in lowercase."
+	case reason == "ErrImageNeverPull":
+		return "The pod uses imagePullPolicy: Never but the image is not on the node; preload it or change the pull policy."
+	case containsAny(lower, "manifest unknown", "not found", "no such manifest"):
+		if pull != nil && pull.Digest == "" {
+			return fmt.Sprintf("Tag %q does not exist in %s/%s; check the image name for typos and that the tag was pushed.", pull.Tag, pull.Registry, pull.Repository)
+		}
+		return "The tag or digest does not exist in the repository; check the image name and that the tag was pushed."
+	case containsAny(lower, "unauthorized", "pull access denied", "authentication required", "forbidden", "denied"):
+		if pull != nil {
+			return credentialsRemediation(pull)
+		}
+		return "The registry rejected the credentials; add or fix imagePullSecrets on the pod or its service account."
+	case containsAny(lower, "toomanyrequests", "rate limit"):
+		return "The registry is rate limiting pulls; authenticate with imagePullSecrets or mirror the image."
+	case containsAny(lower, "no such host", "i/o timeout", "connection refused", "dial tcp", "tls", "x509"):
+		return "The node cannot reach the registry; check DNS, egress firewall rules, proxies and the registry's certificate."
+	}
+	return "Run kubectl describe pod to read the pull error, then verify the image exists and the node can authenticate to the registry."
+}
+
+// credentialsRemediation tells a missing pull secret from one for another
+// registry and from credentials the registry no longer accepts
+func credentialsRemediation(pull *k8s.ImagePullInfo) string {
+	var missing, matching, others, unused []string
+	var registries []string
+	unreadable := false
+	var stale *k8s.PullSecretInfo
+	for i, secret := range pull.PullSecrets {
+		switch {
+		case secret.Source != "pod":
+			unused = append(unused, secret.Name)
+		case secret.Missing:
+			missing = append(missing, secret.Name)
+		case secret.Unreadable:
+			unreadable = true
+		case secret.MatchesRegistry:
+			matching = append(matching, secret.Name)
+			if strings.Contains(pull.Registry, ".dkr.ecr.") && !secret.UpdatedAt.IsZero() && time.Since(secret.UpdatedAt) > ecrTokenLifetime {
+				stale = &pull.PullSecrets[i]
+			}
+		default:
+			others = append(others, secret.Name)
+			registries = append(registries, secret.Registries...)
+		}
+	}
+
+	switch {
+	case len(missing) > 0:
+		return fmt.Sprintf("The pod's pull secret %s does not exist; create it with kubectl create secret docker-registry for %s.", strings.Join(missing, ", "), pull.Registry)
+	case stale != nil:
+		return fmt.Sprintf("Pull secret %s was last updated %s ago, past the 12-hour lifetime of ECR tokens; refresh it on a schedule or let nodes authenticate with their IAM role.", stale.Name, time.Since(stale.UpdatedAt).Round(time.Minute))
+	case len(matching) > 0:
+		return fmt.Sprintf("Pull secret %s has credentials for %s but the registry rejects them; they have likely expired or been revoked, or lack access to %s. Refresh the secret.", strings.Join(matching, ", "), pull.Registry, pull.Repository)
+	case len(others) > 0:
+		return fmt.Sprintf("Pull secret %s holds credentials for %s, not %s; add credentials for %s or fix the registry host in the image.", strings.Join(others, ", "), strings.Join(registries, ", "), pull.Registry, pull.Registry)
+	case len(unused) > 0:
+		return fmt.Sprintf("Pull secret %s was added to the service account after the pod was created; recreate the pod to use it.", strings.Join(unused, ", "))
+	case unreadable:
+		return "The registry rejected the credentials; check that the pod's imagePullSecrets hold valid credentials for " + pull.Registry + "."
+	}
+	return fmt.Sprintf("Neither the pod nor its service account has imagePullSecrets; create a docker-registry secret for %s and reference it.", pull.Registry)
+}
+
+// ecrTokenLifetime is how long ECR authorization tokens, and so pull
+// secrets made from them, stay valid
+const ecrTokenLifetime = 12 * time.Hour
+
+// registryHint names the registry of an image and how nodes authenticate to it
+func registryHint(image string) string {
+	registry := k8s.ImageRegistry(image)
+	switch {
+	case strings.Contains(registry, ".dkr.ecr."):
+		return fmt.Sprintf("For ECR (%s), the node IAM role needs ecr:GetAuthorizationToken and ecr:BatchGetImage, and pull secrets expire after 12 hours.", registry)
+	case registry == "gcr.io" || strings.HasSuffix(registry, ".gcr.io") || strings.HasSuffix(registry, "-docker.pkg.dev"):
+		return fmt.Sprintf("For %s, grant the node service account roles/artifactregistry.reader on the project that hosts the image.", registry)
+	case strings.HasSuffix(registry, ".azurecr.io"):
+		return fmt.Sprintf("For ACR (%s), attach the registry to the cluster (az aks update --attach-acr) or add a pull secret.", registry)
+	case registry == "ghcr.io":
+		return "For ghcr.io, private packages need a pull secret with a token that has the read:packages scope."
+	case registry == "quay.io":
+		return "For quay.io, private repositories need a robot account pull secret."
+	case registry == "docker.io":
+		return "For Docker Hub, anonymous pulls are rate limited and private repositories need a pull secret."
+	}
+	return fmt.Sprintf("Check that nodes can reach and authenticate to %s.", registry)
+}
+
+// checkOOMKills flags containers whose current or previous instance was
+// killed for exceeding its memory limit, or with SIGKILL (exit code 137),
+// suggesting a new limit from the old one and the current usage
+func checkOOMKills(data *k8s.DiagnosticData) []Diagnosis {
+	var diagnoses []Diagnosis
+	for _, pod := range data.Pods {
+		for _, cs := range pod.AllContainerStatuses() {
+			t := cs.MemoryKill()
+			if t == nil {
+				continue
+			}
+			message := "container was OOMKilled for exceeding its memory limit"
+			severity := k8s.SeverityHigh
+			if !t.OOMKilled() {
+				message = "container was killed with SIGKILL (exit code 137), most likely by the kernel OOM killer or a failed liveness probe"
+				severity = k8s.SeverityMedium
+			}
+			request, limit, used := memoryOf(cs)
+			if limit > 0 {
+				message += fmt.Sprintf("; its limit is %s", k8s.FormatMemory(limit))
+			} else if t.OOMKilled() {
+				message += "; it has no memory limit, so the node ran out of memory"
+			} else {
+				message += "; it has no memory limit"
+			}
+			if cs.Usage != nil {
+				message += fmt.Sprintf(", current usage %s", k8s.FormatMemory(used))
+			}
+			if !t.StartedAt.IsZero() && !t.FinishedAt.IsZero() {
+				message += fmt.Sprintf(", killed after running %s", t.FinishedAt.Sub(t.StartedAt).Round(time.Second))
+			}
+			if cs.RestartCount > 1 {
+				severity = k8s.SeverityCritical
+				message += fmt.Sprintf(", %d restarts so far", cs.RestartCount)
+			}
+			diagnoses = append(diagnoses, diagnosis(pod, cs.Name, "oom-killed", severity, message+".", memoryRemediation(pod, cs.Name, request, limit, used)))
+		}
+	}
+	return diagnoses
+}
+
+// memoryOf returns the memory request, limit and current usage of a
+// container; usage is 0 without metrics-server
+func memoryOf(cs k8s.ContainerStatus) (request, limit, used int64) {
+	if r := cs.Resources; r != nil {
+		request, limit = r.MemoryRequest, r.MemoryLimit
+	}
+	if u := cs.Usage; u != nil {
+		used = u.Memory
+		if limit == 0 {
+			request, limit = u.MemoryRequest, u.MemoryLimit
+		}
+	}
+	return request, limit, used
+}
+
+// Suggested memory limits are 1.5 times the larger of the old limit and the
+// current usage, rounded up to a multiple of memoryStep
+const (
+	memoryHeadroom = 1.5
+	memoryStep     = 64 << 20
+)
+
+// memoryRemediation suggests a concrete memory limit, with the request set
+// to match so the scheduler reserves it, and the command applying both
+func memoryRemediation(pod k8s.PodInfo, container string, request, limit, used int64) string {
+	base := max(limit, used, request)
+	if base == 0 {
+		return "Set a memory request and limit above the container's peak usage, measured with kubectl top pod, or reduce the application's memory use, e.g. heap size or cache limits."
+	}
+	suggested := roundUp(int64(float64(base)*memoryHeadroom), memoryStep)
+	quantity := memoryQuantity(suggested)
+
+	var remediation string
+	if limit > 0 {
+		remediation = fmt.Sprintf("Raise the memory limit from %s to %s", memoryQuantity(limit), quantity)
+	} else {
+		remediation = fmt.Sprintf("Set a memory limit of %s", quantity)
+	}
+	remediation += " and the request to match, so the scheduler reserves the memory"
+	if request > 0 && request != limit {
+		remediation += fmt.Sprintf(" (now %s)", memoryQuantity(request))
+	}
+	remediation += "."
+	if kind, name, ok := strings.Cut(pod.Owner, "/"); ok {
+		namespace := ""
+		if pod.Namespace != "" {
+			namespace = " -n " + pod.Namespace
+		}
+		remediation += fmt.Sprintf(" For example: kubectl set resources %s/%s%s -c %s --limits=memory=%s --requests=memory=%s.",
+			strings.ToLower(kind), name, namespace, container, quantity, quantity)
+	}
+	return remediation + " If usage keeps growing until the kill, look for a leak or cap the heap, e.g. -XX:MaxRAMPercentage or GOMEMLIMIT, instead."
+}
+
+// roundUp rounds n up to a multiple of step
+func roundUp(n, step int64) int64 {
+	return (n + step - 1) / step * step
+}
+
+// memoryQuantity renders bytes as a Kubernetes quantity, in Gi when whole
+func memoryQuantity(bytes int64) string {
+	const mi, gi = 1 << 20, 1 << 30
+	if bytes%gi == 0 {
+		return fmt.Sprintf("%dGi", bytes/gi)
+	}
+	return fmt.Sprintf("%dMi", (bytes+mi-1)/mi)
+}
+
+// Parts of the scheduler's "0/3 nodes are available: ..." message
+var (
+	taintPattern        = regexp.MustCompile(`had (?:untolerated )?taint \{([^}]*)\}`)
+	insufficientPattern = regexp.MustCompile(`Insufficient ([\w./-]+)`)
+)
+
+// checkPending flags pods the scheduler cannot place because of taints or
+// insufficient resources, from the PodScheduled condition
+func checkPending(data *k8s.DiagnosticData) []Diagnosis {
+	var diagnoses []Diagnosis
+	for _, pod := range data.Pods {
+		if pod.Phase != "Pending" {
+			continue
+		}
+		reason := unschedulableMessage(pod)
+		if reason == "" {
+			continue
+		}
+		reason = strings.TrimSuffix(strings.TrimSpace(reason), ".")
+
+		if taints := uniqueMatches(taintPattern, reason); len(taints) > 0 {
+			diagnoses = append(diagnoses, diagnosis(pod, "", "pending-taint", k8s.SeverityHigh,
+				fmt.Sprintf("pod cannot be scheduled on nodes with taints it does not tolerate (%s): %s.", strings.Join(taints, "; "), reason),
+				"Add matching tolerations to the pod spec if it belongs on those nodes, or remove the taint with kubectl taint nodes <node> <key>- ; also check nodeSelector and affinity."))
+		}
+		if resources := uniqueMatches(insufficientPattern, reason); len(resources) > 0 {
+			diagnoses = append(diagnoses, diagnosis(pod, "", "pending-insufficient-resources", k8s.SeverityHigh,
+				fmt.Sprintf("no node has enough free %s for the pod's requests: %s.", strings.Join(resources, " and "), reason),
+				"Lower the pod's resource requests, free capacity by scaling down other workloads, or add nodes (check that cluster-autoscaler can scale the node group)."))
+		}
+	}
+	return diagnoses
+}
+
+// checkPlacement flags Pending pods whose node selector or required node
+// affinity no node satisfies, from the scheduling matrix, naming the node
+// closest to fitting
+func checkPlacement(data *k8s.DiagnosticData) []Diagnosis {
+	var diagnoses []Diagnosis
+	for _, m := range data.Scheduling {
+		if m.TotalNodes == 0 || m.Fitting > 0 {
+			continue
+		}
+		pod := k8s.PodInfo{Name: m.Pod, Namespace: m.Namespace}
+		closest := ""
+		if len(m.Nodes) > 0 {
+			closest = m.Nodes[0].Node
+		}
+		if m.Blockers["selector"] == m.TotalNodes {
+			diagnoses = append(diagnoses, diagnosis(pod, "", "pending-node-selector", k8s.SeverityHigh,
+				fmt.Sprintf("no node has the labels of the pod's nodeSelector %s.", strings.Join(m.NodeSelector, ", ")),
+				fmt.Sprintf("Fix the nodeSelector in the workload spec, or label the intended nodes with kubectl label nodes %s <key>=<value> (see kubectl get nodes --show-labels).", orPlaceholder(closest, "<node>"))))
+		}
+		if m.Blockers["affinity"] == m.TotalNodes {
+			diagnoses = append(diagnoses, diagnosis(pod, "", "pending-node-affinity", k8s.SeverityHigh,
+				fmt.Sprintf("no node matches the pod's required node affinity %s.", strings.Join(m.Affinity, " OR ")),
+				"Relax requiredDuringSchedulingIgnoredDuringExecution, move the rule to preferredDuringScheduling, or add nodes with the required labels (for example in the required zone)."))
+		}
+	}
+	return diagnoses
+}
+
+// orPlaceholder returns s, or placeholder when s is empty
+func orPlaceholder(s, placeholder string) string {
+	if s == "" {
+		return placeholder
+	}
+	return s
+}
+
+// unschedulableMessage returns the PodScheduled=False message of a pod
+func unschedulableMessage(pod k8s.PodInfo) string {
+	for _, cond := range pod.Conditions {
+		if cond.Type == "PodScheduled" && cond.Status == "False" {
+			return cond.Message
+		}
+	}
+	return ""
+}
+
+// uniqueMatches returns the distinct first capture groups of pattern in s
+func uniqueMatches(pattern *regexp.Regexp, s string) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, m := range pattern.FindAllStringSubmatch(s, -1) {
+		if value := strings.TrimSpace(m[1]); !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Probe kinds named by kubelet "Unhealthy" events
+var probeKinds = []string{k8s.ProbeLiveness, k8s.ProbeReadiness, k8s.ProbeStartup}
+
+// checkProbes flags pods with failing liveness, readiness or startup probes
+// from kubelet "Unhealthy" events, quoting the probe spec when collected
+func checkProbes(data *k8s.DiagnosticData) []Diagnosis {
+	pods := make(map[string]k8s.PodInfo, len(data.Pods))
+	for _, pod := range data.Pods {
+		pods[k8s.Qualify(pod.Namespace, pod.Name)] = pod
+	}
+
+	var diagnoses []Diagnosis
+	seen := make(map[string]bool)
+	for _, e := range data.Events {
+		if e.Reason != "Unhealthy" || !strings.HasPrefix(e.InvolvedObject, "Pod/") {
+			continue
+		}
+		kind := ""
+		for _, k := range probeKinds {
+			if strings.HasPrefix(e.Message, k+" probe failed") {
+				kind = k
+				break
+			}
+		}
+		name := strings.TrimPrefix(e.InvolvedObject, "Pod/")
+		key := k8s.Qualify(e.Namespace, name) + "/" + kind
+		if kind == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		pod, ok := pods[k8s.Qualify(e.Namespace, name)]
+		if !ok {
+			pod = k8s.PodInfo{Name: name, Namespace: e.Namespace}
+		}
+		severity, remediation := probeRemediation(kind)
+		message := fmt.Sprintf("%s probe failed %d times: %s", strings.ToLower(kind), max(e.Count, 1), strings.TrimSpace(e.Message))
+		container := ""
+		if cs, probe, ok := failingProbe(pod, kind); ok {
+			container = cs.Name
+			message += fmt.Sprintf(" (probe: %s", probe.Spec())
+			if len(cs.Ports) > 0 {
+				message += "; container ports: " + strings.Join(cs.Ports, ", ")
+			}
+			message += ")"
+			if probe.Problem != "" {
+				remediation = fmt.Sprintf("The %s; point the probe at the port the application listens on. %s", probe.Problem, remediation)
+			}
+		}
+		diagnoses = append(diagnoses, diagnosis(pod, container, strings.ToLower(kind)+"-probe-failed", severity, message, remediation))
+	}
+	return diagnoses
+}
+
+// failingProbe returns the container whose probe of kind the kubelet reported
+// failing, with its spec
+func failingProbe(pod k8s.PodInfo, kind string) (k8s.ContainerStatus, k8s.ProbeInfo, bool) {
+	for _, cs := range pod.AllContainerStatuses() {
+		for _, probe := range cs.Probes {
+			if probe.Kind == kind && probe.Failures > 0 {
+				return cs, probe, true
+			}
+		}
+	}
+	return k8s.ContainerStatus{}, k8s.ProbeInfo{}, false
+}
+
+// probeRemediation returns how severe a failing probe of kind is and how to fix it
+func probeRemediation(kind string) (k8s.Severity, string) {
+	switch kind {
+	case k8s.ProbeLiveness:
+		return k8s.SeverityHigh, "The kubelet restarts the container on each failure; check that the probe's port and path match the application, and raise initialDelaySeconds, timeoutSeconds or failureThreshold if it is merely slow."
+	case k8s.ProbeStartup:
+		return k8s.SeverityHigh, "The container is killed before it finishes starting; raise failureThreshold × periodSeconds above the real startup time or fix what delays startup."
+	}
+	return k8s.SeverityMedium, "The pod is removed from Service endpoints while failing; check the probe's port and path and the dependencies the readiness endpoint checks."
+}
+
+// diagnosis builds a Diagnosis for a pod or one of its containers
+func diagnosis(pod k8s.PodInfo, container, rule string, severity k8s.Severity, message, remediation string) Diagnosis {
+	object := "Pod/" + pod.Name
+	if container != "" {
+		object += "/" + container
+	}
+	return Diagnosis{
+		Finding: k8s.Finding{
+			Rule:      rule,
+			Severity:  severity,
+			Object:    object,
+			Message:   message,
+			Namespace: pod.Namespace,
+		},
+		Remediation: remediation,
+	}
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package analyzer
+
+import "kubehelp/internal/k8s"
+
+// Status is the overall severity of a diagnosis run, for gating CI/CD
+// pipelines and post-deploy checks on it
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusWarning  Status = "warning"
+	StatusCritical Status = "critical"
+)
+
+// Rank orders statuses from ok (0) to critical (2)
+func (s Status) Rank() int {
+	switch s {
+	case StatusWarning:
+		return 1
+	case StatusCritical:
+		return 2
+	}
+	return 0
+}
+
+// StatusOf returns the status a single issue of the given severity puts a
+// run in: critical and high issues break workloads, medium ones are
+// warnings and low ones, such as best-practice findings, leave it ok
+func StatusOf(severity k8s.Severity) Status {
+	switch severity {
+	case k8s.SeverityCritical, k8s.SeverityHigh:
+		return StatusCritical
+	case k8s.SeverityMedium:
+		return StatusWarning
+	}
+	return StatusOK
+}
+
+// Assess returns the status of a run with issues of the given severities,
+// that of the most severe one
+func Assess(severities ...k8s.Severity) Status {
+	status := StatusOK
+	for _, severity := range severities {
+		if s := StatusOf(severity); s.Rank() > status.Rank() {
+			status = s
+		}
+	}
+	return status
+}
@@ -0,0 +1,581 @@
+// Package anonymize replaces resource names in diagnostic data with stable
+// pseudonyms so reports can be sent to an external LLM without leaking
+// product or customer identifiers.
+package anonymize
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"kubehelp/internal/k8s"
+)
+
+// Entry maps an original name to its pseudonym
+type Entry struct {
+	Kind      string `json:"kind"`
+	Original  string `json:"original"`
+	Pseudonym string `json:"pseudonym"`
+}
+
+// Anonymizer assigns pseudonyms such as "pod-1" or "ns-1". The same name
+// always maps to the same pseudonym, so the LLM can still correlate a pod
+// across the summary, container details, events and logs.
+type Anonymizer struct {
+	byKind   map[string]map[string]string
+	counters map[string]int
+	entries  []Entry
+	// text maps every original to one pseudonym for free-text substitution
+	text map[string]string
+}
+
+// New creates an empty Anonymizer
+func New() *Anonymizer {
+	return &Anonymizer{
+		byKind:   make(map[string]map[string]string),
+		counters: make(map[string]int),
+		text:     make(map[string]string),
+	}
+}
+
+// prefixes shortens common kinds in pseudonyms
+var prefixes = map[string]string{
+	"namespace":             "ns",
+	"context":               "cluster",
+	"persistentvolumeclaim": "pvc",
+	"persistentvolume":      "pv",
+	"helmrelease":           "release",
+}
+
+// Name returns the pseudonym for an original name of the given kind,
+// assigning the next free one on first use
+func (a *Anonymizer) Name(kind, original string) string {
+	if original == "" {
+		return ""
+	}
+	kind = strings.ToLower(kind)
+	names, ok := a.byKind[kind]
+	if !ok {
+		names = make(map[string]string)
+		a.byKind[kind] = names
+	}
+	if pseudonym, ok := names[original]; ok {
+		return pseudonym
+	}
+
+	prefix := prefixes[kind]
+	if prefix == "" {
+		prefix = kind
+	}
+	a.counters[kind]++
+	pseudonym := fmt.Sprintf("%s-%d", prefix, a.counters[kind])
+	names[original] = pseudonym
+	a.entries = append(a.entries, Entry{Kind: kind, Original: original, Pseudonym: pseudonym})
+	if _, ok := a.text[original]; !ok {
+		a.text[original] = pseudonym
+	}
+	return pseudonym
+}
+
+// Mapping returns all assigned pseudonyms in assignment order
+func (a *Anonymizer) Mapping() []Entry {
+	return append([]Entry(nil), a.entries...)
+}
+
+// Apply returns an anonymized copy of data; the original is not modified.
+// Structured name fields are replaced first, then every known name is
+// replaced in messages, log lines and findings.
+func (a *Anonymizer) Apply(data *k8s.DiagnosticData) (*k8s.DiagnosticData, error) {
+	out, err := deepCopy(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clusters share one set of pseudonyms, so the LLM can match a
+	// workload across clusters
+	for i := range out.Clusters {
+		cluster, err := a.Apply(&out.Clusters[i])
+		if err != nil {
+			return nil, err
+		}
+		out.Clusters[i] = *cluster
+	}
+
+	out.ContextName = a.Name("context", out.ContextName)
+	if out.Namespace != k8s.AllNamespaces {
+		namespaces := k8s.SplitNamespaces(out.Namespace)
+		for i := range namespaces {
+			namespaces[i] = a.Name("namespace", namespaces[i])
+		}
+		out.Namespace = strings.Join(namespaces, ",")
+	}
+	for i := range out.Namespaces {
+		out.Namespaces[i].Name = a.Name("namespace", out.Namespaces[i].Name)
+	}
+	for i := range out.Workloads {
+		out.Workloads[i] = a.Name("workload", out.Workloads[i])
+	}
+	for i := range out.Pods {
+		pod := &out.Pods[i]
+		pod.Name = a.Name("pod", pod.Name)
+		pod.Namespace = a.Name("namespace", pod.Namespace)
+		pod.NodeName = a.Name("node", pod.NodeName)
+		pod.Owner = a.objectRef(pod.Owner)
+		if pod.Spec != nil {
+			for j := range pod.Spec.Containers {
+				pod.Spec.Containers[j].Name = a.Name("container", pod.Spec.Containers[j].Name)
+			}
+		}
+		for _, statuses := range [][]k8s.ContainerStatus{pod.ContainerStatuses, pod.InitContainerStatuses, pod.EphemeralContainerStatuses} {
+			for j := range statuses {
+				statuses[j].Name = a.Name("container", statuses[j].Name)
+				if p := statuses[j].ImagePull; p != nil {
+					for k := range p.PullSecrets {
+						secret := &p.PullSecrets[k]
+						secret.Name = a.Name("Secret", secret.Name)
+						secret.Source = a.objectRef(secret.Source)
+					}
+					for k := range p.Events {
+						p.Events[k].Node = a.Name("node", p.Events[k].Node)
+					}
+				}
+			}
+		}
+	}
+	for i := range out.Controllers {
+		c := &out.Controllers[i]
+		c.Name = a.Name(c.Kind, c.Name)
+		c.Namespace = a.Name("namespace", c.Namespace)
+		c.Owner = a.objectRef(c.Owner)
+		c.CurrentRevision = a.Name("revision", c.CurrentRevision)
+		c.UpdateRevision = a.Name("revision", c.UpdateRevision)
+		c.HelmRelease = a.Name("HelmRelease", c.HelmRelease)
+	}
+	for i := range out.HelmReleases {
+		r := &out.HelmReleases[i]
+		r.Name = a.Name("HelmRelease", r.Name)
+		r.Namespace = a.Name("namespace", r.Namespace)
+		for j := range r.Controllers {
+			r.Controllers[j] = a.objectRef(r.Controllers[j])
+		}
+	}
+	for i := range out.Nodes {
+		out.Nodes[i].Name = a.Name("node", out.Nodes[i].Name)
+	}
+	for i := range out.Identities {
+		id := &out.Identities[i]
+		id.Namespace = a.Name("namespace", id.Namespace)
+		for j := range id.Pods {
+			id.Pods[j] = a.Name("pod", id.Pods[j])
+		}
+	}
+	for i := range out.Scheduling {
+		m := &out.Scheduling[i]
+		m.Pod = a.Name("pod", m.Pod)
+		m.Namespace = a.Name("namespace", m.Namespace)
+		m.Owner = a.objectRef(m.Owner)
+		for j := range m.Nodes {
+			m.Nodes[j].Node = a.Name("node", m.Nodes[j].Node)
+		}
+	}
+	for i := range out.VolumeClaims {
+		c := &out.VolumeClaims[i]
+		c.Name = a.Name("PersistentVolumeClaim", c.Name)
+		c.Namespace = a.Name("namespace", c.Namespace)
+		c.VolumeName = a.Name("PersistentVolume", c.VolumeName)
+		if c.Volume != nil {
+			c.Volume.Name = a.Name("PersistentVolume", c.Volume.Name)
+		}
+		for j := range c.Pods {
+			c.Pods[j] = a.Name("pod", c.Pods[j])
+		}
+	}
+	for i := range out.Services {
+		out.Services[i].Name = a.Name("Service", out.Services[i].Name)
+		out.Services[i].Namespace = a.Name("namespace", out.Services[i].Namespace)
+	}
+	for i := range out.Connectivity {
+		check := &out.Connectivity[i]
+		if check.Service != "" {
+			check.Target = a.serviceHost(check.Target)
+		}
+		check.Service = a.Name("Service", check.Service)
+		check.Namespace = a.Name("namespace", check.Namespace)
+	}
+	for i := range out.NetworkPolicies {
+		np := &out.NetworkPolicies[i]
+		np.Name = a.Name("NetworkPolicy", np.Name)
+		np.Namespace = a.Name("namespace", np.Namespace)
+		for j := range np.SelectedPods {
+			np.SelectedPods[j] = a.Name("pod", np.SelectedPods[j])
+		}
+	}
+	for i := range out.Ingresses {
+		ing := &out.Ingresses[i]
+		ing.Name = a.Name("Ingress", ing.Name)
+		ing.Namespace = a.Name("namespace", ing.Namespace)
+		for j := range ing.Rules {
+			ing.Rules[j].Host = a.Name("host", ing.Rules[j].Host)
+			ing.Rules[j].Service = a.Name("Service", ing.Rules[j].Service)
+		}
+		for j := range ing.TLSSecrets {
+			ing.TLSSecrets[j] = a.Name("Secret", ing.TLSSecrets[j])
+		}
+	}
+	for i := range out.HTTPRoutes {
+		route := &out.HTTPRoutes[i]
+		route.Name = a.Name("HTTPRoute", route.Name)
+		route.Namespace = a.Name("namespace", route.Namespace)
+		for j := range route.Hostnames {
+			route.Hostnames[j] = a.Name("host", route.Hostnames[j])
+		}
+		for j := range route.Parents {
+			route.Parents[j] = a.parentRef(route.Parents[j])
+		}
+		for j := range route.Backends {
+			b := &route.Backends[j]
+			b.Name = a.Name(b.Kind, b.Name)
+			b.Namespace = a.Name("namespace", b.Namespace)
+		}
+		for j := range route.Conditions {
+			route.Conditions[j].Parent = a.parentRef(route.Conditions[j].Parent)
+		}
+	}
+	for i := range out.ResourceQuotas {
+		out.ResourceQuotas[i].Name = a.Name("ResourceQuota", out.ResourceQuotas[i].Name)
+		out.ResourceQuotas[i].Namespace = a.Name("namespace", out.ResourceQuotas[i].Namespace)
+	}
+	for i := range out.LimitRanges {
+		out.LimitRanges[i].Name = a.Name("LimitRange", out.LimitRanges[i].Name)
+		out.LimitRanges[i].Namespace = a.Name("namespace", out.LimitRanges[i].Namespace)
+	}
+	for i := range out.CustomResources {
+		out.CustomResources[i].Name = a.Name(out.CustomResources[i].Kind, out.CustomResources[i].Name)
+		out.CustomResources[i].Namespace = a.Name("namespace", out.CustomResources[i].Namespace)
+	}
+	for i := range out.Logs {
+		out.Logs[i].Pod = a.Name("pod", out.Logs[i].Pod)
+		out.Logs[i].Namespace = a.Name("namespace", out.Logs[i].Namespace)
+		out.Logs[i].Container = a.Name("container", out.Logs[i].Container)
+	}
+	for i := range out.Events {
+		out.Events[i].InvolvedObject = a.objectRef(out.Events[i].InvolvedObject)
+		out.Events[i].Namespace = a.Name("namespace", out.Events[i].Namespace)
+	}
+	for i := range out.Findings {
+		out.Findings[i].Object = a.objectRef(out.Findings[i].Object)
+		out.Findings[i].Namespace = a.Name("namespace", out.Findings[i].Namespace)
+	}
+
+	// Free text may mention any of the names collected above
+	replacer := newReplacer(a.text)
+	for i := range out.Pods {
+		pod := &out.Pods[i]
+		pod.Message = replacer.replace(pod.Message)
+		for _, statuses := range [][]k8s.ContainerStatus{pod.ContainerStatuses, pod.InitContainerStatuses, pod.EphemeralContainerStatuses} {
+			for j := range statuses {
+				cs := &statuses[j]
+				cs.Message = replacer.replace(cs.Message)
+				cs.Image = replacer.replace(cs.Image)
+				if p := cs.ImagePull; p != nil {
+					p.Repository = replacer.replace(p.Repository)
+					for k := range p.Events {
+						p.Events[k].Message = replacer.replace(p.Events[k].Message)
+					}
+				}
+				for k := range cs.Probes {
+					cs.Probes[k].Handler = replacer.replace(cs.Probes[k].Handler)
+					cs.Probes[k].LastFailure = replacer.replace(cs.Probes[k].LastFailure)
+				}
+				for k := range cs.Env {
+					cs.Env[k].Value = replacer.replace(cs.Env[k].Value)
+				}
+			}
+		}
+		for j := range pod.Conditions {
+			pod.Conditions[j].Message = replacer.replace(pod.Conditions[j].Message)
+		}
+		for j := range pod.ReadinessGates {
+			pod.ReadinessGates[j].Message = replacer.replace(pod.ReadinessGates[j].Message)
+		}
+		if spec := pod.Spec; spec != nil {
+			spec.ServiceAccount = replacer.replace(spec.ServiceAccount)
+			for _, values := range [][]string{spec.NodeSelector, spec.Affinity, spec.TopologySpread, spec.Volumes} {
+				for j := range values {
+					values[j] = replacer.replace(values[j])
+				}
+			}
+			for j := range spec.Containers {
+				c := &spec.Containers[j]
+				for _, values := range [][]string{c.EnvFrom, c.VolumeMounts} {
+					for k := range values {
+						values[k] = replacer.replace(values[k])
+					}
+				}
+			}
+		}
+	}
+	for i := range out.Namespaces {
+		out.Namespaces[i].Skipped = replacer.replace(out.Namespaces[i].Skipped)
+	}
+	for i := range out.Controllers {
+		for j := range out.Controllers[i].Conditions {
+			cond := &out.Controllers[i].Conditions[j]
+			cond.Message = replacer.replace(cond.Message)
+		}
+	}
+	for i := range out.HelmReleases {
+		for j := range out.HelmReleases[i].Revisions {
+			rev := &out.HelmReleases[i].Revisions[j]
+			rev.Chart = replacer.replace(rev.Chart)
+			rev.Description = replacer.replace(rev.Description)
+		}
+	}
+	for i := range out.Nodes {
+		for j := range out.Nodes[i].Conditions {
+			cond := &out.Nodes[i].Conditions[j]
+			cond.Message = replacer.replace(cond.Message)
+		}
+		for j := range out.Nodes[i].Taints {
+			out.Nodes[i].Taints[j] = replacer.replace(out.Nodes[i].Taints[j])
+		}
+	}
+	for i := range out.Identities {
+		id := &out.Identities[i]
+		id.ServiceAccount = replacer.replace(id.ServiceAccount)
+		id.Identity = replacer.replace(id.Identity)
+		for _, values := range [][]string{id.Problems, id.Evidence} {
+			for j := range values {
+				values[j] = replacer.replace(values[j])
+			}
+		}
+	}
+	for i := range out.Scheduling {
+		m := &out.Scheduling[i]
+		m.Reason = replacer.replace(m.Reason)
+		for _, values := range [][]string{m.NodeSelector, m.Affinity, m.Tolerations} {
+			for j := range values {
+				values[j] = replacer.replace(values[j])
+			}
+		}
+		for j := range m.Nodes {
+			for check, why := range m.Nodes[j].Failed {
+				m.Nodes[j].Failed[check] = replacer.replace(why)
+			}
+		}
+	}
+	for i := range out.VolumeClaims {
+		c := &out.VolumeClaims[i]
+		for j := range c.Events {
+			c.Events[j] = replacer.replace(c.Events[j])
+		}
+		if c.Volume != nil {
+			c.Volume.Message = replacer.replace(c.Volume.Message)
+		}
+	}
+	for i := range out.Services {
+		out.Services[i].Selector = replacer.replace(out.Services[i].Selector)
+	}
+	for i := range out.Connectivity {
+		out.Connectivity[i].Error = replacer.replace(out.Connectivity[i].Error)
+	}
+	for i := range out.NetworkPolicies {
+		np := &out.NetworkPolicies[i]
+		np.PodSelector = replacer.replace(np.PodSelector)
+		for j := range np.Ingress {
+			np.Ingress[j] = replacer.replace(np.Ingress[j])
+		}
+		for j := range np.Egress {
+			np.Egress[j] = replacer.replace(np.Egress[j])
+		}
+	}
+	for i := range out.Ingresses {
+		for j := range out.Ingresses[i].Problems {
+			out.Ingresses[i].Problems[j] = replacer.replace(out.Ingresses[i].Problems[j])
+		}
+	}
+	for i := range out.HTTPRoutes {
+		route := &out.HTTPRoutes[i]
+		for j := range route.Conditions {
+			route.Conditions[j].Message = replacer.replace(route.Conditions[j].Message)
+		}
+		for j := range route.Problems {
+			route.Problems[j] = replacer.replace(route.Problems[j])
+		}
+	}
+	for i := range out.CustomResources {
+		for j := range out.CustomResources[i].Conditions {
+			cond := &out.CustomResources[i].Conditions[j]
+			cond.Message = replacer.replace(cond.Message)
+		}
+	}
+	for i := range out.Events {
+		out.Events[i].Message = replacer.replace(out.Events[i].Message)
+	}
+	for i := range out.Logs {
+		out.Logs[i].Note = replacer.replace(out.Logs[i].Note)
+		for j := range out.Logs[i].Lines {
+			out.Logs[i].Lines[j] = replacer.replace(out.Logs[i].Lines[j])
+		}
+	}
+	for i := range out.Findings {
+		out.Findings[i].Message = replacer.replace(out.Findings[i].Message)
+	}
+	for i := range out.Warnings {
+		out.Warnings[i] = replacer.replace(out.Warnings[i])
+	}
+
+	return out, nil
+}
+
+// Replace replaces the original names known so far in text, such as a
+// follow-up question, with their pseudonyms
+func (a *Anonymizer) Replace(text string) string {
+	return newReplacer(a.text).replace(text)
+}
+
+// Restore replaces pseudonyms in text, such as the LLM's analysis, with the
+// original names
+func (a *Anonymizer) Restore(text string) string {
+	reverse := make(map[string]string, len(a.entries))
+	for _, e := range a.entries {
+		reverse[e.Pseudonym] = e.Original
+	}
+	return newReplacer(reverse).replace(text)
+}
+
+// objectRef anonymizes "Kind/name" and "Kind/name/container" references
+func (a *Anonymizer) objectRef(ref string) string {
+	parts := strings.SplitN(ref, "/", 3)
+	if len(parts) < 2 {
+		return ref
+	}
+	parts[1] = a.Name(parts[0], parts[1])
+	if len(parts) == 3 {
+		parts[2] = a.Name("container", parts[2])
+	}
+	return strings.Join(parts, "/")
+}
+
+// serviceHost anonymizes the Service and namespace of a Service DNS name
+// such as "api.payments.svc.cluster.local" or "api.payments.svc.cluster.local:80".
+// The whole host is also replaced in messages, whose dotted names the
+// replacer would not match name by name.
+func (a *Anonymizer) serviceHost(target string) string {
+	host, port, hasPort := strings.Cut(target, ":")
+	labels := strings.SplitN(host, ".", 3)
+	if len(labels) < 3 || !strings.HasPrefix(labels[2], "svc") {
+		return target
+	}
+	labels[0] = a.Name("Service", labels[0])
+	labels[1] = a.Name("namespace", labels[1])
+	anonymized := strings.Join(labels, ".")
+	a.text[host] = anonymized
+	if hasPort {
+		anonymized += ":" + port
+	}
+	return anonymized
+}
+
+// parentRef anonymizes a route parent such as "Gateway/infra/public#https",
+// keeping the kind and listener section
+func (a *Anonymizer) parentRef(ref string) string {
+	parts := strings.SplitN(ref, "/", 3)
+	if len(parts) < 3 {
+		return ref
+	}
+	name, section, hasSection := strings.Cut(parts[2], "#")
+	parts[1] = a.Name("namespace", parts[1])
+	parts[2] = a.Name(parts[0], name)
+	if hasSection {
+		parts[2] += "#" + section
+	}
+	return strings.Join(parts, "/")
+}
+
+func deepCopy(data *k8s.DiagnosticData) (*k8s.DiagnosticData, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy diagnostic data: %w", err)
+	}
+	var out k8s.DiagnosticData
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("failed to copy diagnostic data: %w", err)
+	}
+	return &out, nil
+}
+
+// replacer substitutes whole names only: a match must not be preceded or
+// followed by a character that can be part of a Kubernetes name, so "api"
+// is not replaced inside "rapid" or "api-server"
+type replacer struct {
+	// byFirst indexes names by their first byte, longest first
+	byFirst map[byte][]string
+	mapping map[string]string
+}
+
+func newReplacer(mapping map[string]string) *replacer {
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	// Longest first so "api-server" wins over "api"
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+
+	byFirst := make(map[byte][]string)
+	for _, name := range names {
+		byFirst[name[0]] = append(byFirst[name[0]], name)
+	}
+	return &replacer{byFirst: byFirst, mapping: mapping}
+}
+
+func (r *replacer) replace(s string) string {
+	if s == "" || len(r.byFirst) == 0 {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if i == 0 || !isNameChar(s[i-1]) {
+			if name, ok := r.matchAt(s, i); ok {
+				sb.WriteString(r.mapping[name])
+				i += len(name)
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+		i++
+	}
+	return sb.String()
+}
+
+func (r *replacer) matchAt(s string, i int) (string, bool) {
+	for _, name := range r.byFirst[s[i]] {
+		if strings.HasPrefix(s[i:], name) && endsName(s, i+len(name)) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// endsName reports whether a name may end at position end of s. A trailing
+// period followed by a non-name character is sentence punctuation.
+func endsName(s string, end int) bool {
+	if end == len(s) || !isNameChar(s[end]) {
+		return true
+	}
+	return s[end] == '.' && (end+1 == len(s) || !isNameChar(s[end+1]))
+}
+
+// isNameChar reports whether c can appear in a DNS-1123 name. Underscores
+// are excluded because kubelet joins names with them, e.g. "pod_namespace".
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.'
+}
@@ -0,0 +1,211 @@
+// Package cache stores LLM analyses by a hash of the diagnostic data they
+// were made from, so repeated runs on an unchanged namespace do not call the
+// LLM again.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+)
+
+// DefaultTTL is how long a cached analysis is reused
+const DefaultTTL = 10 * time.Minute
+
+// maxMemoryEntries bounds an in-memory cache; the oldest entries are dropped
+// first
+const maxMemoryEntries = 1000
+
+// Entry is a cached analysis
+type Entry struct {
+	Provider   string                  `json:"provider"`
+	Analysis   string                  `json:"analysis"`
+	Structured *llm.StructuredAnalysis `json:"structured,omitempty"`
+	CreatedAt  time.Time               `json:"createdAt"`
+}
+
+// Cache holds analyses for a TTL, in memory or, with a directory, as one
+// JSON file per key so they survive across CLI runs. It is safe for
+// concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	dir     string
+	ttl     time.Duration
+	entries map[string]Entry
+}
+
+// New creates a cache whose entries expire after ttl. Entries are kept in
+// memory when dir is empty, else in dir, which is created if needed.
+func New(dir string, ttl time.Duration) (*Cache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+		}
+	}
+	return &Cache{dir: dir, ttl: ttl, entries: make(map[string]Entry)}, nil
+}
+
+// Key returns the cache key of an analysis of data with the given provider,
+// model and prompt options. Fields that change on every collection of an
+// unchanged namespace, such as pod ages and current resource usage, are
+// left out so the key only changes with the namespace's state.
+func Key(data *k8s.DiagnosticData, provider, model string, options ...string) (string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash diagnostic data: %w", err)
+	}
+	var stable k8s.DiagnosticData
+	if err := json.Unmarshal(raw, &stable); err != nil {
+		return "", fmt.Errorf("failed to hash diagnostic data: %w", err)
+	}
+	normalize(&stable)
+	if raw, err = json.Marshal(&stable); err != nil {
+		return "", fmt.Errorf("failed to hash diagnostic data: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write(raw)
+	for _, part := range append([]string{provider, model}, options...) {
+		// Separate the parts so that ("ab", "c") and ("a", "bc") differ
+		fmt.Fprintf(h, "\x00%s", part)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normalize clears the volatile fields of data
+func normalize(data *k8s.DiagnosticData) {
+	data.CollectedAt = time.Time{}
+	data.ClockSkew = 0
+	for i := range data.Pods {
+		pod := &data.Pods[i]
+		pod.Age = 0
+		for _, statuses := range [][]k8s.ContainerStatus{pod.ContainerStatuses, pod.InitContainerStatuses, pod.EphemeralContainerStatuses} {
+			for j := range statuses {
+				statuses[j].Usage = nil
+			}
+		}
+	}
+	for i := range data.Nodes {
+		data.Nodes[i].UsedCPU = 0
+		data.Nodes[i].UsedMemory = 0
+	}
+	for i := range data.Clusters {
+		normalize(&data.Clusters[i])
+	}
+}
+
+// Get returns the entry for key unless it is missing or expired
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dir == "" {
+		entry, ok := c.entries[key]
+		if !ok || c.expired(entry) {
+			delete(c.entries, key)
+			return Entry{}, false
+		}
+		return entry, true
+	}
+
+	content, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return Entry{}, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(content, &entry); err != nil || c.expired(entry) {
+		os.Remove(c.path(key))
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Put stores the entry under key, stamped with the current time, and drops
+// expired entries
+func (c *Cache) Put(key string, entry Entry) error {
+	entry.CreatedAt = time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dir == "" {
+		c.entries[key] = entry
+		c.pruneMemory()
+		return nil
+	}
+
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	// Write to a temp file first so readers never see a partial entry
+	path := c.path(key)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return c.pruneDir()
+}
+
+func (c *Cache) expired(entry Entry) bool {
+	return time.Since(entry.CreatedAt) > c.ttl
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// pruneMemory drops expired entries, then the oldest ones beyond
+// maxMemoryEntries
+func (c *Cache) pruneMemory() {
+	for key, entry := range c.entries {
+		if c.expired(entry) {
+			delete(c.entries, key)
+		}
+	}
+	for len(c.entries) > maxMemoryEntries {
+		var oldest string
+		for key, entry := range c.entries {
+			if oldest == "" || entry.CreatedAt.Before(c.entries[oldest].CreatedAt) {
+				oldest = key
+			}
+		}
+		delete(c.entries, oldest)
+	}
+}
+
+// pruneDir removes the files of expired entries, judged by their
+// modification time, which is when they were written
+func (c *Cache) pruneDir() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	var errs []error
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil || time.Since(info.ModTime()) <= c.ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,131 @@
+// Package config loads the kubehelp configuration file, which holds named
+// profiles bundling a cluster context with an LLM setup.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the kubehelp configuration file:
+//
+//	profiles:
+//	  dev:
+//	    context: kind-dev
+//	    llm: ollama
+//	    model: llama3.1:8b
+//	    env:
+//	      OLLAMA_BASE_URL: http://ollama.internal:11434
+//	  prod:
+//	    kubeconfig: ~/.kube/prod
+//	    context: prod-eks
+//	    namespace: payments
+//	    llm: vertexai
+//	    model: gemini-2.5-flash
+//	    temperature: 0
+//	    bestPractices: true
+//	    customResources:
+//	    - applications.v1alpha1.argoproj.io
+type Config struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Profile bundles the settings for one cluster/LLM combination. Empty
+// fields leave the corresponding flag default untouched.
+type Profile struct {
+	Kubeconfig  string `json:"kubeconfig,omitempty"`
+	Context     string `json:"context,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	LLM         string `json:"llm,omitempty"`
+	Model       string `json:"model,omitempty"`
+	Language    string `json:"language,omitempty"`
+	DetailLevel string `json:"detailLevel,omitempty"`
+	// PromptTemplate is a prompt template file, e.g. the team's runbook
+	// structure (see kubehelp prompt-template)
+	PromptTemplate string  `json:"promptTemplate,omitempty"`
+	Compact        bool    `json:"compact,omitempty"`
+	Logs           bool    `json:"logs,omitempty"`
+	BestPractices  bool    `json:"bestPractices,omitempty"`
+	Anonymize      bool    `json:"anonymize,omitempty"`
+	ModelFallback  bool    `json:"modelFallback,omitempty"`
+	MaxInputTokens int     `json:"maxInputTokens,omitempty"`
+	MaxCost        float64 `json:"maxCost,omitempty"`
+	// Temperature and TopP tune sampling; nil keeps the provider default so
+	// that 0 can be set explicitly
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	// SystemPrompt replaces the built-in system prompt
+	SystemPrompt string `json:"systemPrompt,omitempty"`
+	// CustomResources lists custom resources to collect, e.g.
+	// applications.v1alpha1.argoproj.io
+	CustomResources []string `json:"customResources,omitempty"`
+	// Env sets provider environment variables such as OLLAMA_BASE_URL or
+	// VERTEX_AI_PROJECT_ID that are not already set
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// ErrNotFound is returned when no configuration file exists
+var ErrNotFound = errors.New("config file not found")
+
+// DefaultPath returns $KUBEHELP_CONFIG or ~/.kubehelp/config.yaml
+func DefaultPath() string {
+	if path := os.Getenv("KUBEHELP_CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(homedir.HomeDir(), ".kubehelp", "config.yaml")
+}
+
+// Load reads and parses a configuration file
+func Load(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Profile returns the named profile with ~ expanded in paths
+func (c *Config) Profile(name string) (Profile, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	profile.Kubeconfig = expandHome(profile.Kubeconfig)
+	return profile, nil
+}
+
+// ProfileNames returns the configured profile names in sorted order
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func expandHome(path string) string {
+	if path == "~" {
+		return homedir.HomeDir()
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(homedir.HomeDir(), rest)
+	}
+	return path
+}
@@ -0,0 +1,133 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileStore persists each record as a JSON file in a directory
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileStore creates a file-backed store, creating dir if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history directory %s: %w", dir, err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Save writes the record to <dir>/<id>.json
+func (s *FileStore) Save(record Record) (string, error) {
+	if err := prepare(&record); err != nil {
+		return "", err
+	}
+	if !validID(record.ID) {
+		return "", fmt.Errorf("invalid record ID %q", record.ID)
+	}
+
+	content, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write to a temp file first so readers never see a partial record
+	path := s.path(record.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write history record: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to write history record: %w", err)
+	}
+	return record.ID, nil
+}
+
+// Get reads the record with the given ID
+func (s *FileStore) Get(id string) (*Record, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+
+	content, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history record: %w", err)
+	}
+
+	var record Record
+	if err := json.Unmarshal(content, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode history record %s: %w", id, err)
+	}
+	return &record, nil
+}
+
+// List returns the matching records newest first. Record IDs sort by
+// creation time, so without a filter only the requested page is read from
+// disk.
+func (s *FileStore) List(opts ListOptions) ([]Record, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	var ids []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasSuffix(name, ".json") {
+			ids = append(ids, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	filtered := opts.Namespace != ""
+	var records []Record
+	skipped := 0
+	for _, id := range ids {
+		if opts.Limit > 0 && len(records) == opts.Limit {
+			break
+		}
+		if !filtered && skipped < opts.Offset {
+			// Skip without reading the record
+			skipped++
+			continue
+		}
+		record, err := s.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			continue // removed concurrently
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !opts.matches(*record) {
+			continue
+		}
+		if skipped < opts.Offset {
+			skipped++
+			continue
+		}
+		records = append(records, *record)
+	}
+	return records, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// validID guards against path traversal through record IDs
+func validID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
@@ -0,0 +1,64 @@
+package history
+
+import "sync"
+
+// MemoryStore keeps the most recent records in memory. History is lost on restart.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	records    []Record // oldest first
+	maxRecords int
+}
+
+// NewMemoryStore creates an in-memory store retaining at most maxRecords
+func NewMemoryStore(maxRecords int) *MemoryStore {
+	return &MemoryStore{maxRecords: maxRecords}
+}
+
+// Save stores the record, replacing one with the same ID and evicting the
+// oldest one when full
+func (s *MemoryStore) Save(record Record) (string, error) {
+	if err := prepare(&record); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.records {
+		if s.records[i].ID == record.ID {
+			s.records[i] = record
+			return record.ID, nil
+		}
+	}
+	s.records = append(s.records, record)
+	if s.maxRecords > 0 && len(s.records) > s.maxRecords {
+		s.records = s.records[len(s.records)-s.maxRecords:]
+	}
+	return record.ID, nil
+}
+
+// Get returns the record with the given ID
+func (s *MemoryStore) Get(id string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := range s.records {
+		if s.records[i].ID == id {
+			record := s.records[i]
+			return &record, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// List returns the matching records newest first
+func (s *MemoryStore) List(opts ListOptions) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]Record, len(s.records))
+	for i, r := range s.records {
+		records[len(s.records)-1-i] = r
+	}
+	return page(records, opts), nil
+}
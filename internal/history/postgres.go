@@ -0,0 +1,96 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" database/sql driver
+)
+
+// PostgresStore persists records in a PostgreSQL database, so several
+// server replicas can share one history
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore connects to the database at dsn, e.g.
+// "postgres://kubehelp:secret@db:5432/kubehelp", and creates the history
+// table if needed
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS history (
+		id         TEXT PRIMARY KEY,
+		created_at BIGINT NOT NULL,
+		namespace  TEXT NOT NULL,
+		provider   TEXT NOT NULL,
+		record     TEXT NOT NULL
+	)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS history_created_at ON history (created_at)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+
+	return &PostgresStore{db: db}, nil
+}
+
+// Save inserts or replaces the record
+func (s *PostgresStore) Save(record Record) (string, error) {
+	if err := prepare(&record); err != nil {
+		return "", err
+	}
+
+	content, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	_, err = s.db.Exec(`INSERT INTO history (id, created_at, namespace, provider, record) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET created_at = $2, namespace = $3, provider = $4, record = $5`,
+		record.ID, record.CreatedAt.UnixNano(), record.Namespace, record.Provider, string(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to save history record: %w", err)
+	}
+	return record.ID, nil
+}
+
+// Get returns the record with the given ID
+func (s *PostgresStore) Get(id string) (*Record, error) {
+	var content string
+	err := s.db.QueryRow(`SELECT record FROM history WHERE id = $1`, id).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history record: %w", err)
+	}
+	return decodeRecord(content)
+}
+
+// List returns the matching records newest first
+func (s *PostgresStore) List(opts ListOptions) ([]Record, error) {
+	var limit any // NULL: no limit
+	if opts.Limit > 0 {
+		limit = opts.Limit
+	}
+
+	rows, err := s.db.Query(`SELECT record FROM history WHERE ($1::text = '' OR namespace = $1::text) ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`,
+		opts.Namespace, limit, max(opts.Offset, 0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history records: %w", err)
+	}
+	return scanRecords(rows)
+}
+
+// Close closes the underlying database
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
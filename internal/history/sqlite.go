@@ -0,0 +1,121 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	_ "modernc.org/sqlite" // pure-Go SQLite driver
+)
+
+// SQLiteStore persists records in a SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the SQLite database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database %s: %w", path, err)
+	}
+	// SQLite allows a single writer; serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS history (
+		id         TEXT PRIMARY KEY,
+		created_at INTEGER NOT NULL,
+		namespace  TEXT NOT NULL,
+		provider   TEXT NOT NULL,
+		record     TEXT NOT NULL
+	)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS history_created_at ON history (created_at)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Save inserts or replaces the record
+func (s *SQLiteStore) Save(record Record) (string, error) {
+	if err := prepare(&record); err != nil {
+		return "", err
+	}
+
+	content, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode history record: %w", err)
+	}
+
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO history (id, created_at, namespace, provider, record) VALUES (?, ?, ?, ?, ?)`,
+		record.ID, record.CreatedAt.UnixNano(), record.Namespace, record.Provider, string(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to save history record: %w", err)
+	}
+	return record.ID, nil
+}
+
+// Get returns the record with the given ID
+func (s *SQLiteStore) Get(id string) (*Record, error) {
+	var content string
+	err := s.db.QueryRow(`SELECT record FROM history WHERE id = ?`, id).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history record: %w", err)
+	}
+	return decodeRecord(content)
+}
+
+// List returns the matching records newest first
+func (s *SQLiteStore) List(opts ListOptions) ([]Record, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+
+	rows, err := s.db.Query(`SELECT record FROM history WHERE (? = '' OR namespace = ?) ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		opts.Namespace, opts.Namespace, limit, max(opts.Offset, 0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history records: %w", err)
+	}
+	return scanRecords(rows)
+}
+
+// Close closes the underlying database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// scanRecords decodes the record column of every row and closes rows
+func scanRecords(rows *sql.Rows) ([]Record, error) {
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, fmt.Errorf("failed to read history record: %w", err)
+		}
+		record, err := decodeRecord(content)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	return records, rows.Err()
+}
+
+func decodeRecord(content string) (*Record, error) {
+	var record Record
+	if err := json.Unmarshal([]byte(content), &record); err != nil {
+		return nil, fmt.Errorf("failed to decode history record: %w", err)
+	}
+	return &record, nil
+}
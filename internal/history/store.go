@@ -0,0 +1,161 @@
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"kubehelp/internal/k8s"
+)
+
+// ErrNotFound is returned by Get when no record has the requested ID
+var ErrNotFound = errors.New("history record not found")
+
+// Record is a single persisted diagnosis. It is serialized as JSON by the
+// file and SQLite backends, so fields must stay backwards compatible.
+type Record struct {
+	ID             string              `json:"id"`
+	CreatedAt      time.Time           `json:"createdAt"`
+	Namespace      string              `json:"namespace"`
+	Workloads      []string            `json:"workloads,omitempty"`
+	Context        string              `json:"context,omitempty"`
+	Provider       string              `json:"provider"`
+	Analysis       string              `json:"analysis,omitempty"`
+	DurationMs     int64               `json:"durationMs"`
+	Error          string              `json:"error,omitempty"`
+	DiagnosticData *k8s.DiagnosticData `json:"diagnosticData,omitempty"`
+	// Request holds the settings the diagnosis was requested with, e.g. the
+	// server request body without any posted snapshot
+	Request json.RawMessage `json:"request,omitempty"`
+}
+
+// Summary returns the record without its DiagnosticData snapshot, for
+// listings
+func (r Record) Summary() Record {
+	r.DiagnosticData = nil
+	return r
+}
+
+// ListOptions selects and pages the records returned by List
+type ListOptions struct {
+	// Namespace, when set, keeps only diagnoses of that namespace
+	Namespace string
+	// Limit is the maximum number of records (0: no limit)
+	Limit int
+	// Offset skips the newest records
+	Offset int
+}
+
+// matches reports whether the record passes the filters of opts
+func (o ListOptions) matches(record Record) bool {
+	return o.Namespace == "" || record.Namespace == o.Namespace
+}
+
+// Store persists diagnosis records
+type Store interface {
+	// Save stores the record and returns its ID. A new ID is assigned when
+	// record.ID is empty; a record with the ID of a stored one replaces it.
+	Save(record Record) (string, error)
+	// Get returns the record with the given ID or ErrNotFound
+	Get(id string) (*Record, error)
+	// List returns the records matching opts newest first, skipping
+	// opts.Offset and returning at most opts.Limit
+	List(opts ListOptions) ([]Record, error)
+}
+
+// DefaultSQLitePath is the database of the sqlite backend when
+// HISTORY_SQLITE_PATH is not set
+const DefaultSQLitePath = "kubehelp-history.db"
+
+// NewStoreFromEnv creates the store selected by HISTORY_BACKEND: "sqlite"
+// (default, HISTORY_SQLITE_PATH), "postgres" (HISTORY_POSTGRES_DSN),
+// "memory" or "file" (HISTORY_DIR)
+func NewStoreFromEnv() (Store, error) {
+	return NewStoreFromEnvWithDefault(DefaultSQLitePath)
+}
+
+// NewStoreFromEnvWithDefault is like NewStoreFromEnv with another default
+// SQLite database, e.g. one in the user's home directory for the CLI
+func NewStoreFromEnvWithDefault(sqlitePath string) (Store, error) {
+	switch backend := os.Getenv("HISTORY_BACKEND"); backend {
+	case "", "sqlite":
+		return NewSQLiteStore(getEnv("HISTORY_SQLITE_PATH", sqlitePath))
+	case "postgres":
+		dsn := os.Getenv("HISTORY_POSTGRES_DSN")
+		if dsn == "" {
+			return nil, fmt.Errorf("HISTORY_POSTGRES_DSN must be set for the postgres history backend")
+		}
+		return NewPostgresStore(dsn)
+	case "memory":
+		maxRecords := 1000
+		if v := os.Getenv("HISTORY_MAX_RECORDS"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid HISTORY_MAX_RECORDS %q", v)
+			}
+			maxRecords = n
+		}
+		return NewMemoryStore(maxRecords), nil
+	case "file":
+		return NewFileStore(getEnv("HISTORY_DIR", "history"))
+	default:
+		return nil, fmt.Errorf("unsupported HISTORY_BACKEND %q (supported: sqlite, postgres, memory, file)", backend)
+	}
+}
+
+// prepare fills in the ID and creation time of a record being saved
+func prepare(record *Record) error {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC()
+	}
+	if record.ID == "" {
+		id, err := newID(record.CreatedAt)
+		if err != nil {
+			return err
+		}
+		record.ID = id
+	}
+	return nil
+}
+
+// newID returns a time-sortable, random record ID
+func newID(t time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate record ID: %w", err)
+	}
+	return t.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b), nil
+}
+
+// page filters records already sorted newest first and applies the limit
+// and offset of opts
+func page(records []Record, opts ListOptions) []Record {
+	var matched []Record
+	skipped := 0
+	for _, r := range records {
+		if !opts.matches(r) {
+			continue
+		}
+		if skipped < opts.Offset {
+			skipped++
+			continue
+		}
+		if opts.Limit > 0 && len(matched) == opts.Limit {
+			break
+		}
+		matched = append(matched, r)
+	}
+	return matched
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,150 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// stores returns a fresh instance of each backend that runs without a
+// server; every backend must pass the Store contract tests
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	file, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	sqlite, err := NewSQLiteStore(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]Store{
+		"memory": NewMemoryStore(100),
+		"file":   file,
+		"sqlite": sqlite,
+	}
+}
+
+// seed saves records a1, b1, a2, b2, a3 of namespaces a and b, oldest first
+func seed(t *testing.T, store Store) {
+	t.Helper()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i, name := range []string{"a1", "b1", "a2", "b2", "a3"} {
+		record := Record{
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+			Namespace: name[:1],
+			Provider:  "ollama",
+			Analysis:  name,
+		}
+		if _, err := store.Save(record); err != nil {
+			t.Fatalf("Save %s: %v", name, err)
+		}
+	}
+}
+
+func analyses(records []Record) []string {
+	names := make([]string, len(records))
+	for i, r := range records {
+		names[i] = r.Analysis
+	}
+	return names
+}
+
+func TestStoreList(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"all newest first", ListOptions{}, []string{"a3", "b2", "a2", "b1", "a1"}},
+		{"limit", ListOptions{Limit: 2}, []string{"a3", "b2"}},
+		{"offset", ListOptions{Offset: 3}, []string{"b1", "a1"}},
+		{"limit and offset", ListOptions{Limit: 2, Offset: 1}, []string{"b2", "a2"}},
+		{"offset past the end", ListOptions{Offset: 5}, []string{}},
+		{"namespace", ListOptions{Namespace: "a"}, []string{"a3", "a2", "a1"}},
+		{"namespace with limit and offset", ListOptions{Namespace: "a", Limit: 1, Offset: 1}, []string{"a2"}},
+		{"unknown namespace", ListOptions{Namespace: "c"}, []string{}},
+	}
+	for backend, store := range stores(t) {
+		seed(t, store)
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				records, err := store.List(tt.opts)
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				if got := analyses(records); !slices.Equal(got, tt.want) {
+					t.Errorf("List(%+v) = %v, want %v", tt.opts, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestStoreSaveGet(t *testing.T) {
+	for backend, store := range stores(t) {
+		t.Run(backend, func(t *testing.T) {
+			id, err := store.Save(Record{Namespace: "prod", Provider: "openai", Analysis: "OOMKilled", DurationMs: 1200})
+			if err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if id == "" {
+				t.Fatal("Save returned an empty ID")
+			}
+			record, err := store.Get(id)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if record.ID != id || record.Namespace != "prod" || record.Analysis != "OOMKilled" || record.DurationMs != 1200 {
+				t.Errorf("Get = %+v", record)
+			}
+			if record.CreatedAt.IsZero() {
+				t.Error("Save did not set CreatedAt")
+			}
+
+			// Saving with an existing ID replaces the record
+			record.Analysis = "fixed"
+			if _, err := store.Save(*record); err != nil {
+				t.Fatalf("Save with ID: %v", err)
+			}
+			if record, err = store.Get(id); err != nil || record.Analysis != "fixed" {
+				t.Errorf("Get after replace = %+v, %v", record, err)
+			}
+		})
+	}
+}
+
+func TestStoreGetNotFound(t *testing.T) {
+	for backend, store := range stores(t) {
+		t.Run(backend, func(t *testing.T) {
+			if _, err := store.Get("20240501T100000-deadbeef"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get of a missing ID = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFileStoreRejectsPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(filepath.Join(dir, "history"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	for _, id := range []string{"../secret", "..", "a/b", `a\b`, "/etc/passwd", "record.json"} {
+		if validID(id) {
+			t.Errorf("validID(%q) = true", id)
+		}
+		if _, err := store.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want ErrNotFound", id, err)
+		}
+		if _, err := store.Save(Record{ID: id, Namespace: "default"}); err == nil {
+			t.Errorf("Save with ID %q succeeded", id)
+		}
+	}
+	if !validID("20240501T100000-deadbeef") {
+		t.Error("validID rejects a generated ID")
+	}
+}
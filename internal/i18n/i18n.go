@@ -0,0 +1,228 @@
+// Package i18n localizes the headers and labels kubehelp writes around an
+// analysis, so reports read in the language the analysis was requested in.
+// The analysis itself is localized by the LLM (see llm.WithLanguage).
+package i18n
+
+import "strings"
+
+// Messages are the localized strings of reports. Formats take the same
+// arguments as their English version.
+type Messages struct {
+	// Name is the English name of the language, e.g. "German"
+	Name string
+
+	AnalysisBanner    string // banner before the analysis on the terminal
+	EndAnalysisBanner string // banner after it
+	Severity          string // label of the run's severity
+	ReportTitle       string // format with the namespace
+	Context           string
+	Collected         string
+	Provider          string
+	LLMUsage          string
+	FellBack          string // format with the failure and the provider used instead
+	Analysis          string
+	RuleBased         string // section of the rule-based diagnoses
+	SuggestedFix      string
+	Findings          string
+	Warnings          string
+	Prompt            string // section of the prompt in shared reports
+	Data              string // section of the diagnostic data in shared reports
+}
+
+// English is used for English and for languages without a translation
+var English = Messages{
+	Name:              "English",
+	AnalysisBanner:    "=== AI Analysis ===",
+	EndAnalysisBanner: "=== End Analysis ===",
+	Severity:          "Severity",
+	ReportTitle:       "kubehelp report: namespace %s",
+	Context:           "Context",
+	Collected:         "Collected",
+	Provider:          "Provider",
+	LLMUsage:          "LLM usage",
+	FellBack:          "%s; fell back to %s",
+	Analysis:          "Analysis",
+	RuleBased:         "Rule-Based Diagnoses",
+	SuggestedFix:      "Suggested fix",
+	Findings:          "Findings",
+	Warnings:          "Warnings",
+	Prompt:            "Diagnostic Prompt",
+	Data:              "Diagnostic Data",
+}
+
+// catalog maps ISO 639-1 codes to their translations
+var catalog = map[string]Messages{
+	"en": English,
+	"de": {
+		Name:              "German",
+		AnalysisBanner:    "=== KI-Analyse ===",
+		EndAnalysisBanner: "=== Ende der Analyse ===",
+		Severity:          "Schweregrad",
+		ReportTitle:       "kubehelp-Bericht: Namespace %s",
+		Context:           "Kontext",
+		Collected:         "Erfasst",
+		Provider:          "Anbieter",
+		LLMUsage:          "LLM-Nutzung",
+		FellBack:          "%s; ausgewichen auf %s",
+		Analysis:          "Analyse",
+		RuleBased:         "Regelbasierte Diagnosen",
+		SuggestedFix:      "Lösungsvorschlag",
+		Findings:          "Befunde",
+		Warnings:          "Warnungen",
+		Prompt:            "Diagnose-Prompt",
+		Data:              "Diagnosedaten",
+	},
+	"es": {
+		Name:              "Spanish",
+		AnalysisBanner:    "=== Análisis de IA ===",
+		EndAnalysisBanner: "=== Fin del análisis ===",
+		Severity:          "Gravedad",
+		ReportTitle:       "Informe de kubehelp: namespace %s",
+		Context:           "Contexto",
+		Collected:         "Recopilado",
+		Provider:          "Proveedor",
+		LLMUsage:          "Uso del LLM",
+		FellBack:          "%s; se recurrió a %s",
+		Analysis:          "Análisis",
+		RuleBased:         "Diagnósticos basados en reglas",
+		SuggestedFix:      "Solución sugerida",
+		Findings:          "Hallazgos",
+		Warnings:          "Advertencias",
+		Prompt:            "Prompt de diagnóstico",
+		Data:              "Datos de diagnóstico",
+	},
+	"fr": {
+		Name:              "French",
+		AnalysisBanner:    "=== Analyse IA ===",
+		EndAnalysisBanner: "=== Fin de l'analyse ===",
+		Severity:          "Gravité",
+		ReportTitle:       "Rapport kubehelp : namespace %s",
+		Context:           "Contexte",
+		Collected:         "Collecté",
+		Provider:          "Fournisseur",
+		LLMUsage:          "Utilisation du LLM",
+		FellBack:          "%s ; repli sur %s",
+		Analysis:          "Analyse",
+		RuleBased:         "Diagnostics basés sur des règles",
+		SuggestedFix:      "Correctif suggéré",
+		Findings:          "Constats",
+		Warnings:          "Avertissements",
+		Prompt:            "Prompt de diagnostic",
+		Data:              "Données de diagnostic",
+	},
+	"it": {
+		Name:              "Italian",
+		AnalysisBanner:    "=== Analisi IA ===",
+		EndAnalysisBanner: "=== Fine dell'analisi ===",
+		Severity:          "Gravità",
+		ReportTitle:       "Report kubehelp: namespace %s",
+		Context:           "Contesto",
+		Collected:         "Raccolto",
+		Provider:          "Provider",
+		LLMUsage:          "Utilizzo LLM",
+		FellBack:          "%s; ripiego su %s",
+		Analysis:          "Analisi",
+		RuleBased:         "Diagnosi basate su regole",
+		SuggestedFix:      "Correzione suggerita",
+		Findings:          "Rilevamenti",
+		Warnings:          "Avvisi",
+		Prompt:            "Prompt diagnostico",
+		Data:              "Dati diagnostici",
+	},
+	"pt": {
+		Name:              "Portuguese",
+		AnalysisBanner:    "=== Análise de IA ===",
+		EndAnalysisBanner: "=== Fim da análise ===",
+		Severity:          "Gravidade",
+		ReportTitle:       "Relatório do kubehelp: namespace %s",
+		Context:           "Contexto",
+		Collected:         "Coletado",
+		Provider:          "Provedor",
+		LLMUsage:          "Uso do LLM",
+		FellBack:          "%s; recorreu a %s",
+		Analysis:          "Análise",
+		RuleBased:         "Diagnósticos baseados em regras",
+		SuggestedFix:      "Correção sugerida",
+		Findings:          "Constatações",
+		Warnings:          "Avisos",
+		Prompt:            "Prompt de diagnóstico",
+		Data:              "Dados de diagnóstico",
+	},
+	"ja": {
+		Name:              "Japanese",
+		AnalysisBanner:    "=== AI 分析 ===",
+		EndAnalysisBanner: "=== 分析終了 ===",
+		Severity:          "重大度",
+		ReportTitle:       "kubehelp レポート: Namespace %s",
+		Context:           "コンテキスト",
+		Collected:         "収集日時",
+		Provider:          "プロバイダー",
+		LLMUsage:          "LLM 使用量",
+		FellBack:          "%s。%s にフォールバックしました",
+		Analysis:          "分析",
+		RuleBased:         "ルールベースの診断",
+		SuggestedFix:      "推奨される修正",
+		Findings:          "検出事項",
+		Warnings:          "警告",
+		Prompt:            "診断プロンプト",
+		Data:              "診断データ",
+	},
+	"ko": {
+		Name:              "Korean",
+		AnalysisBanner:    "=== AI 분석 ===",
+		EndAnalysisBanner: "=== 분석 끝 ===",
+		Severity:          "심각도",
+		ReportTitle:       "kubehelp 보고서: 네임스페이스 %s",
+		Context:           "컨텍스트",
+		Collected:         "수집 시각",
+		Provider:          "공급자",
+		LLMUsage:          "LLM 사용량",
+		FellBack:          "%s; %s(으)로 대체함",
+		Analysis:          "분석",
+		RuleBased:         "규칙 기반 진단",
+		SuggestedFix:      "권장 수정",
+		Findings:          "발견 사항",
+		Warnings:          "경고",
+		Prompt:            "진단 프롬프트",
+		Data:              "진단 데이터",
+	},
+	"zh": {
+		Name:              "Chinese (Simplified)",
+		AnalysisBanner:    "=== AI 分析 ===",
+		EndAnalysisBanner: "=== 分析结束 ===",
+		Severity:          "严重程度",
+		ReportTitle:       "kubehelp 报告：命名空间 %s",
+		Context:           "上下文",
+		Collected:         "采集时间",
+		Provider:          "提供方",
+		LLMUsage:          "LLM 用量",
+		FellBack:          "%s；已回退到 %s",
+		Analysis:          "分析",
+		RuleBased:         "基于规则的诊断",
+		SuggestedFix:      "建议的修复",
+		Findings:          "发现",
+		Warnings:          "警告",
+		Prompt:            "诊断提示词",
+		Data:              "诊断数据",
+	},
+}
+
+// For returns the messages of lang, a language code such as "ja" or "pt-BR"
+// or an English language name such as "German", falling back to English
+func For(lang string) Messages {
+	code := strings.ToLower(strings.TrimSpace(lang))
+	if m, ok := catalog[code]; ok {
+		return m
+	}
+	if base, _, found := strings.Cut(strings.ReplaceAll(code, "_", "-"), "-"); found {
+		if m, ok := catalog[base]; ok {
+			return m
+		}
+	}
+	for _, m := range catalog {
+		if strings.EqualFold(m.Name, strings.TrimSpace(lang)) {
+			return m
+		}
+	}
+	return English
+}
@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults of the in-memory store
+const (
+	DefaultTTL     = time.Hour
+	DefaultMaxJobs = 1000
+)
+
+// MemoryStore keeps jobs in memory. Finished jobs are dropped after the TTL
+// and jobs are lost on restart, so clients must poll the replica that
+// accepted the job.
+type MemoryStore struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	order   []string // job IDs, oldest first
+	ttl     time.Duration
+	maxJobs int
+}
+
+// NewMemoryStore creates an in-memory store keeping finished jobs for ttl
+// (default DefaultTTL) and at most maxJobs jobs (default DefaultMaxJobs)
+func NewMemoryStore(ttl time.Duration, maxJobs int) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if maxJobs <= 0 {
+		maxJobs = DefaultMaxJobs
+	}
+	return &MemoryStore{
+		jobs:    make(map[string]*Job),
+		ttl:     ttl,
+		maxJobs: maxJobs,
+	}
+}
+
+// Create stores a new pending job, first dropping expired jobs and, when
+// full, the oldest finished ones
+func (s *MemoryStore) Create() (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+	s.jobs[id] = &Job{ID: id, Status: StatusPending, CreatedAt: time.Now().UTC()}
+	s.order = append(s.order, id)
+	return id, nil
+}
+
+// Update applies fn to the job with the given ID
+func (s *MemoryStore) Update(id string, fn func(*Job)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(job)
+	return nil
+}
+
+// Get returns a copy of the job with the given ID
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || s.expired(job, time.Now()) {
+		return nil, ErrNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// expire removes finished jobs older than the TTL, then the oldest finished
+// jobs while the store is full. Running jobs are never removed.
+func (s *MemoryStore) expire(now time.Time) {
+	excess := len(s.jobs) + 1 - s.maxJobs
+	kept := s.order[:0]
+	for _, id := range s.order {
+		job := s.jobs[id]
+		if s.expired(job, now) || (excess > 0 && job.Status.Done()) {
+			delete(s.jobs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.order = kept
+}
+
+func (s *MemoryStore) expired(job *Job, now time.Time) bool {
+	return job.Status.Done() && now.Sub(job.FinishedAt) > s.ttl
+}
@@ -0,0 +1,69 @@
+// Package jobs tracks diagnoses that run in the background after the HTTP
+// request that started them has returned.
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"kubehelp/internal/k8s"
+)
+
+// ErrNotFound is returned when no job has the requested ID, including jobs
+// that have expired
+var ErrNotFound = errors.New("job not found")
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Done reports whether the job has finished, successfully or not
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+// Job is a background diagnosis and, once done, its result
+type Job struct {
+	ID     string `json:"id"`
+	Status Status `json:"status"`
+	// Stage is the last completed collection step while running, e.g.
+	// "events", or "analysis" once the LLM is called
+	Stage      string    `json:"stage,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	StartedAt  time.Time `json:"startedAt,omitzero"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	// Analysis and DiagnosticData are set when the job succeeded
+	Analysis       string              `json:"analysis,omitempty"`
+	DiagnosticData *k8s.DiagnosticData `json:"diagnosticData,omitempty"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// Store keeps track of jobs. Implementations must be safe for concurrent
+// use; a shared store lets any server replica answer status requests.
+type Store interface {
+	// Create stores a new pending job and returns its ID
+	Create() (string, error)
+	// Update applies fn to the job with the given ID or returns ErrNotFound
+	Update(id string, fn func(*Job)) error
+	// Get returns a copy of the job with the given ID or ErrNotFound
+	Get(id string) (*Job, error)
+}
+
+// newID returns a random job ID. Job results hold cluster data, so IDs are
+// long enough that they cannot be guessed.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
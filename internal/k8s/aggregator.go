@@ -3,33 +3,114 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"kubehelp/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // DiagnosticData holds aggregated Kubernetes diagnostic information
 type DiagnosticData struct {
-	Namespace   string      `json:"namespace,omitempty"`
-	Workloads   []string    `json:"workloads,omitempty"`
-	Pods        []PodInfo   `json:"pods,omitempty"`
-	Events      []EventInfo `json:"events,omitempty"`
-	CollectedAt time.Time   `json:"collectedAt"`
-	ContextName string      `json:"contextName,omitempty"`
+	SchemaVersion string         `json:"schemaVersion,omitempty"`
+	Namespace     string         `json:"namespace,omitempty"`
+	Workloads     []string       `json:"workloads,omitempty"`
+	Pods          []PodInfo      `json:"pods,omitempty"`
+	Events        []EventInfo    `json:"events,omitempty"`
+	Logs          []ContainerLog `json:"logs,omitempty"`
+	Findings      []Finding      `json:"findings,omitempty"`
+	CollectedAt   time.Time      `json:"collectedAt"`
+	ContextName   string         `json:"contextName,omitempty"`
+	// ClockSkew is the cluster clock minus the local clock, set when it
+	// exceeds ClockSkewThreshold
+	ClockSkew time.Duration `json:"clockSkew,omitempty"`
+	// EventsSince is how far back Events were collected
+	EventsSince time.Duration `json:"eventsSince,omitempty"`
+	// Warnings describe collection problems that may make the data misleading
+	Warnings []string `json:"warnings,omitempty"`
+	// Omitted summarizes data left out of the prompt to fit its token
+	// budget; it is only set on the copy the prompt is built from
+	Omitted []string `json:"omitted,omitempty"`
+	// Controllers holds Deployment, ReplicaSet, StatefulSet and DaemonSet
+	// status for diagnosing stuck rollouts
+	Controllers []ControllerStatus `json:"controllers,omitempty"`
+	// HelmReleases holds the history of the Helm releases that installed
+	// the collected controllers
+	HelmReleases []HelmRelease `json:"helmReleases,omitempty"`
+	// Nodes holds the nodes relevant to the collected pods when node
+	// collection is enabled
+	Nodes []NodeInfo `json:"nodes,omitempty"`
+	// Identities holds the cloud identities of the ServiceAccounts of
+	// unhealthy pods
+	Identities []IdentityInfo `json:"identities,omitempty"`
+	// Scheduling checks the Pending pods the scheduler rejected against
+	// every node
+	Scheduling []SchedulingMatrix `json:"scheduling,omitempty"`
+	// VolumeClaims holds the PersistentVolumeClaims used by the collected
+	// pods, or all claims in the namespace when pods are not filtered
+	VolumeClaims []VolumeClaimInfo `json:"volumeClaims,omitempty"`
+	// Services holds the selector-based Services of the namespace with
+	// their endpoint counts, limited like Controllers when pods are filtered
+	Services []ServiceInfo `json:"services,omitempty"`
+	// NetworkPolicies holds the NetworkPolicies selecting the collected pods
+	NetworkPolicies []NetworkPolicyInfo `json:"networkPolicies,omitempty"`
+	// Connectivity holds the DNS lookups and TCP connections made from a
+	// probe pod when AggregatorOptions.ProbeConnectivity is set
+	Connectivity []ConnectivityCheck `json:"connectivity,omitempty"`
+	// Ingresses and HTTPRoutes hold the frontend routing of the namespace,
+	// limited to objects routing to the collected Services when pods are
+	// filtered
+	Ingresses  []IngressInfo `json:"ingresses,omitempty"`
+	HTTPRoutes []RouteInfo   `json:"httpRoutes,omitempty"`
+	// ResourceQuotas and LimitRanges hold the namespace's quota usage and
+	// default and maximum container resources
+	ResourceQuotas []ResourceQuotaInfo `json:"resourceQuotas,omitempty"`
+	LimitRanges    []LimitRangeInfo    `json:"limitRanges,omitempty"`
+	// CustomResources holds the status of the custom resources configured
+	// with AggregatorOptions.CustomResources
+	CustomResources []CustomResourceInfo `json:"customResources,omitempty"`
+	// Namespaces summarizes each namespace of a multi-namespace or
+	// cluster-wide collection, including those that were skipped
+	Namespaces []NamespaceSummary `json:"namespaces,omitempty"`
+	// Clusters holds the per-cluster data of a multi-cluster collection,
+	// each with its ContextName; the other fields are then left empty
+	// except Namespace, Workloads and Warnings
+	Clusters []DiagnosticData `json:"clusters,omitempty"`
 }
 
 // PodInfo contains relevant pod diagnostic information
 type PodInfo struct {
-	Name              string            `json:"name"`
-	Phase             string            `json:"phase"`
-	Ready             string            `json:"ready"`
-	Restarts          int32             `json:"restarts"`
-	Age               time.Duration     `json:"age"`
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace,omitempty"` // set when collected cluster-wide
+	Owner     string        `json:"owner,omitempty"`     // managing workload, e.g. "Deployment/api"
+	Phase     string        `json:"phase"`
+	Ready     string        `json:"ready"`
+	Restarts  int32         `json:"restarts"`
+	Age       time.Duration `json:"age"`
+	// Reason and Message come from the pod status, e.g. "Evicted"
+	Reason            string            `json:"reason,omitempty"`
 	Message           string            `json:"message,omitempty"`
 	ContainerStatuses []ContainerStatus `json:"containerStatuses,omitempty"`
 	NodeName          string            `json:"nodeName,omitempty"`
 	Conditions        []PodCondition    `json:"conditions,omitempty"`
+	// ReadinessGates reports the status of conditions listed in
+	// spec.readinessGates; an unmet gate keeps a pod NotReady even when
+	// all of its containers are ready
+	ReadinessGates []ReadinessGateStatus `json:"readinessGates,omitempty"`
+	// InitContainerStatuses are in spec order; a pod stays in the Init
+	// state until each has completed, or started for sidecars
+	InitContainerStatuses []ContainerStatus `json:"initContainerStatuses,omitempty"`
+	// EphemeralContainerStatuses describe debug containers added with
+	// kubectl debug
+	EphemeralContainerStatuses []ContainerStatus `json:"ephemeralContainerStatuses,omitempty"`
+	// Spec summarizes the spec of unhealthy pods when spec collection is
+	// enabled
+	Spec *PodSpecSummary `json:"spec,omitempty"`
 }
 
 // ContainerStatus holds container-level diagnostic info
@@ -41,6 +122,38 @@ type ContainerStatus struct {
 	Reason       string `json:"reason,omitempty"`
 	Message      string `json:"message,omitempty"`
 	Image        string `json:"image,omitempty"`
+	// Ports and Probes come from the container spec of failing containers
+	Ports  []string    `json:"ports,omitempty"`
+	Probes []ProbeInfo `json:"probes,omitempty"`
+	// Sidecar marks an init container with restartPolicy Always, which
+	// keeps running alongside the app containers
+	Sidecar bool `json:"sidecar,omitempty"`
+	// Termination describes the current instance when State is Terminated
+	Termination *TerminationInfo `json:"termination,omitempty"`
+	// LastTermination describes the previous instance after a restart
+	LastTermination *TerminationInfo `json:"lastTermination,omitempty"`
+	// Env and EnvFrom come from the container spec when env collection is
+	// enabled; denied values are already redacted
+	Env     []EnvVar `json:"env,omitempty"`
+	EnvFrom []string `json:"envFrom,omitempty"`
+	// Usage is the current CPU and memory usage from metrics-server, when
+	// installed, with the container's requests and limits
+	Usage *ContainerUsage `json:"usage,omitempty"`
+	// Resources are the requests and limits of containers killed for
+	// memory, whose current or previous instance was OOMKilled or exited
+	// with code 137
+	Resources *ContainerResources `json:"resources,omitempty"`
+	// ImagePull details why the image cannot be pulled, for containers
+	// waiting with ErrImagePull, ImagePullBackOff and similar reasons
+	ImagePull *ImagePullInfo `json:"imagePull,omitempty"`
+}
+
+// TerminationInfo describes how a container instance terminated
+type TerminationInfo struct {
+	Reason     string    `json:"reason,omitempty"`
+	ExitCode   int32     `json:"exitCode"`
+	StartedAt  time.Time `json:"startedAt,omitempty"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
 }
 
 // PodCondition represents a pod condition
@@ -51,12 +164,28 @@ type PodCondition struct {
 	Message string `json:"message,omitempty"`
 }
 
+// ReadinessGateStatus describes a single pod readiness gate
+type ReadinessGateStatus struct {
+	ConditionType string `json:"conditionType"`
+	// Status is the gate condition status, or empty when the condition has
+	// not been reported on the pod yet
+	Status  string `json:"status,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Met reports whether the gate condition is True
+func (g ReadinessGateStatus) Met() bool {
+	return g.Status == string(corev1.ConditionTrue)
+}
+
 // EventInfo contains Kubernetes event information
 type EventInfo struct {
 	Type           string    `json:"type"`
 	Reason         string    `json:"reason"`
 	Message        string    `json:"message"`
 	InvolvedObject string    `json:"involvedObject,omitempty"`
+	Namespace      string    `json:"namespace,omitempty"` // set when collected cluster-wide
 	FirstTimestamp time.Time `json:"firstTimestamp,omitempty"`
 	LastTimestamp  time.Time `json:"lastTimestamp"`
 	Count          int32     `json:"count"`
@@ -65,23 +194,164 @@ type EventInfo struct {
 // Aggregator collects diagnostic data from Kubernetes
 type Aggregator struct {
 	client *Client
+	opts   AggregatorOptions
+}
+
+// AggregatorOptions configures optional collection behavior. Zero values
+// select the defaults.
+type AggregatorOptions struct {
+	// CollectLogs enables fetching recent logs for unhealthy containers
+	CollectLogs bool
+	// LogConcurrency bounds the number of concurrent log requests (default 5)
+	LogConcurrency int
+	// LogTailLines is the number of log lines fetched per container (default 50)
+	LogTailLines int64
+	// LogTimeout is the timeout for a single log request (default 10s)
+	LogTimeout time.Duration
+	// LogKeywords selects relevant lines when logs are truncated
+	// (default DefaultLogKeywords, matched case-insensitively)
+	LogKeywords []string
+	// BestPractices enables findings for missing resources, latest image
+	// tags and privileged/root containers
+	BestPractices bool
+	// Progress, when set, is called after each collection step
+	Progress ProgressFunc
+	// APITimeout bounds each Kubernetes API call other than log requests
+	// (default DefaultAPITimeout)
+	APITimeout time.Duration
+	// CollectEnv adds container env vars for config-error diagnosis;
+	// EnvFilter decides which values are kept
+	CollectEnv bool
+	EnvFilter  EnvFilter
+	// NamespaceConcurrency bounds how many namespaces CollectAllNamespaces and
+	// CollectNamespaceList collect at once (default DefaultNamespaceConcurrency)
+	NamespaceConcurrency int
+	// LabelSelector limits collection to pods matching it, e.g. "app=api,tier!=cache"
+	LabelSelector string
+	// CollectNodes adds node conditions, taints, requested vs allocatable
+	// resources and kubelet version skew. It needs cluster-wide read access
+	// to nodes and pods.
+	CollectNodes bool
+	// CustomResources lists custom resources, such as Argo CD Applications
+	// or cert-manager Certificates, whose status conditions are collected
+	CustomResources []schema.GroupVersionResource
+	// ProbeConnectivity launches a short-lived pod in namespaces with
+	// failures to look up and connect to their Services, confirming DNS and
+	// network root causes passive data cannot. It needs create and delete
+	// access to pods.
+	ProbeConnectivity bool
+	// ProbeImage is the probe pod's image, which needs sh, nslookup and nc
+	// (default DefaultProbeImage)
+	ProbeImage string
+	// ClusterDomain is the DNS suffix of Services (default
+	// DefaultClusterDomain)
+	ClusterDomain string
+	// EventsSince is how far back warning events are collected (default
+	// DefaultEventsSince)
+	EventsSince time.Duration
+	// IncludeSpec adds a summary of the spec of unhealthy pods: resources,
+	// env var names, volumes, scheduling constraints, service account and
+	// security context
+	IncludeSpec bool
+	// Snapshot, when set, serves the resources it holds instead of LIST
+	// requests, e.g. an InformerCache shared by the diagnoses of a server
+	Snapshot Snapshot
+}
+
+// Progress describes a completed collection step
+type Progress struct {
+	// Stage names the collector: "pods", "controllers", "helm releases",
+	// "nodes", "metrics", "events", "scheduling", "quotas", "storage",
+	// "services", "ingresses", "custom resources", "connectivity", "logs",
+	// "identities" or, when collecting cluster-wide, "namespaces"
+	Stage string
+	// Count is the number of items collected so far in this stage
+	Count int
+	// Total is the expected number of items, or 0 when unknown
+	Total int
+	// Elapsed is the time since collection started
+	Elapsed time.Duration
+}
+
+// ProgressFunc receives collection progress. Log progress is reported from
+// worker goroutines, so implementations must be safe for concurrent use.
+type ProgressFunc func(Progress)
+
+// startStep starts the trace span of a collection step, named after its
+// progress stage
+func startStep(ctx context.Context, stage string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "k8s.collect "+stage)
+}
+
+// report sends a progress update when a reporter is configured
+func (a *Aggregator) report(stage string, count, total int, start time.Time) {
+	if a.opts.Progress != nil {
+		a.opts.Progress(Progress{Stage: stage, Count: count, Total: total, Elapsed: time.Since(start)})
+	}
 }
 
 // NewAggregator creates a new diagnostic aggregator
 func NewAggregator(client *Client) *Aggregator {
+	return NewAggregatorWithOptions(client, AggregatorOptions{})
+}
+
+// NewAggregatorWithOptions creates a diagnostic aggregator with custom options
+func NewAggregatorWithOptions(client *Client, opts AggregatorOptions) *Aggregator {
+	if opts.LogConcurrency <= 0 {
+		opts.LogConcurrency = 5
+	}
+	if opts.LogTailLines <= 0 {
+		opts.LogTailLines = 50
+	}
+	if opts.LogTimeout <= 0 {
+		opts.LogTimeout = 10 * time.Second
+	}
+	if len(opts.LogKeywords) == 0 {
+		opts.LogKeywords = DefaultLogKeywords
+	}
+	if opts.APITimeout <= 0 {
+		opts.APITimeout = DefaultAPITimeout
+	}
+	if opts.NamespaceConcurrency <= 0 {
+		opts.NamespaceConcurrency = DefaultNamespaceConcurrency
+	}
+	if opts.ProbeImage == "" {
+		opts.ProbeImage = DefaultProbeImage
+	}
+	if opts.ClusterDomain == "" {
+		opts.ClusterDomain = DefaultClusterDomain
+	}
+	if opts.EventsSince <= 0 {
+		opts.EventsSince = DefaultEventsSince
+	}
 	return &Aggregator{
 		client: client,
+		opts:   opts,
 	}
 }
 
-// CollectDiagnostics gathers diagnostic data for a namespace and optional workloads
+// CollectDiagnostics gathers diagnostic data for a namespace and optional
+// workloads. The collection and each of its steps are traced as spans.
 func (a *Aggregator) CollectDiagnostics(ctx context.Context, namespace string, workloads []string) (*DiagnosticData, error) {
+	ctx, span := tracing.Start(ctx, "k8s.collect", attribute.String("k8s.namespace.name", namespace))
+	data, err := a.collectDiagnostics(ctx, namespace, workloads)
+	if err == nil {
+		span.SetAttributes(attribute.Int("kubehelp.pods", len(data.Pods)), attribute.Int("kubehelp.findings", len(data.Findings)))
+	}
+	tracing.End(span, err)
+	return data, err
+}
+
+func (a *Aggregator) collectDiagnostics(ctx context.Context, namespace string, workloads []string) (*DiagnosticData, error) {
 	data := &DiagnosticData{
-		Namespace:   namespace,
-		Workloads:   workloads,
-		CollectedAt: time.Now(),
+		SchemaVersion: CurrentSchemaVersion,
+		Namespace:     namespace,
+		Workloads:     workloads,
+		CollectedAt:   time.Now(),
 	}
 
+	start := time.Now()
+
 	// Get current context name
 	contextName, err := GetCurrentContext("")
 	if err == nil {
@@ -89,45 +359,221 @@ func (a *Aggregator) CollectDiagnostics(ctx context.Context, namespace string, w
 	}
 
 	// Collect pods
-	pods, err := a.collectPods(ctx, namespace, workloads)
+	stepCtx, step := startStep(ctx, "pods")
+	pods, err := a.collectPods(stepCtx, namespace, workloads)
+	tracing.End(step, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to collect pods: %w", err)
 	}
-	data.Pods = pods
+	a.addPods(data, pods)
+	a.report("pods", len(data.Pods), 0, start)
+
+	// Collect controller status
+	stepCtx, step = startStep(ctx, "controllers")
+	err = a.collectControllers(stepCtx, namespace, workloads, pods, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect controller status: %w", err)
+	}
+	a.report("controllers", len(data.Controllers), 0, start)
+
+	// Read the history of Helm releases behind the controllers, so a
+	// broken upgrade can be rolled back
+	stepCtx, step = startStep(ctx, "helm releases")
+	err = a.collectHelmReleases(stepCtx, namespace, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect Helm releases: %w", err)
+	}
+	a.report("helm releases", len(data.HelmReleases), 0, start)
+
+	// Check Secret and ConfigMap references behind CreateContainerConfigError
+	stepCtx, step = startStep(ctx, "config references")
+	err = a.checkReferences(stepCtx, namespace, pods, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check config references: %w", err)
+	}
+
+	// Collect the nodes behind scheduling failures and evictions
+	if a.opts.CollectNodes {
+		stepCtx, step := startStep(ctx, "nodes")
+		err = a.collectNodes(stepCtx, data)
+		tracing.End(step, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect nodes: %w", err)
+		}
+		a.report("nodes", len(data.Nodes), 0, start)
+	}
+
+	// Compare current usage with requests and limits when metrics-server
+	// is installed
+	stepCtx, step = startStep(ctx, "metrics")
+	metrics := a.collectMetrics(stepCtx, namespace, pods, data)
+	step.End()
+	a.report("metrics", metrics, 0, start)
 
 	// Collect events
-	events, err := a.collectEvents(ctx, namespace)
+	stepCtx, step = startStep(ctx, "events")
+	events, err := a.collectEvents(stepCtx, namespace, data)
+	tracing.End(step, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to collect events: %w", err)
 	}
-	data.Events = events
+	a.report("events", len(data.Events), 0, start)
+
+	// Check the pods the scheduler rejected against every node
+	stepCtx, step = startStep(ctx, "scheduling")
+	err = a.collectSchedulingMatrices(stepCtx, pods, events, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check scheduling: %w", err)
+	}
+	a.report("scheduling", len(data.Scheduling), 0, start)
+
+	// Check the image references, pull secrets and pull events of
+	// containers whose image cannot be pulled
+	stepCtx, step = startStep(ctx, "image pulls")
+	pulls, err := a.collectImagePulls(stepCtx, pods, events, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check image pulls: %w", err)
+	}
+	a.report("image pulls", pulls, 0, start)
+
+	// Collect quotas and limit ranges; pods they reject are never created
+	// and only show in their controllers' events
+	stepCtx, step = startStep(ctx, "quotas")
+	err = a.collectQuotas(stepCtx, namespace, workloads, events, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect resource quotas: %w", err)
+	}
+	a.report("quotas", len(data.ResourceQuotas)+len(data.LimitRanges), 0, start)
+
+	// Collect the PersistentVolumeClaims behind Pending pods and mount
+	// failures; claim events explain why provisioning or binding fails
+	stepCtx, step = startStep(ctx, "storage")
+	err = a.collectVolumeClaims(stepCtx, namespace, workloads, pods, events, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect volume claims: %w", err)
+	}
+	a.report("storage", len(data.VolumeClaims), 0, start)
+
+	// Check that Services select ready pods
+	stepCtx, step = startStep(ctx, "services")
+	err = a.collectServices(stepCtx, namespace, workloads, pods, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect services: %w", err)
+	}
+	a.report("services", len(data.Services), 0, start)
+
+	// Find the NetworkPolicies that cut the collected pods off
+	stepCtx, step = startStep(ctx, "network policies")
+	err = a.collectNetworkPolicies(stepCtx, namespace, pods, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect network policies: %w", err)
+	}
+	a.report("network policies", len(data.NetworkPolicies), 0, start)
+
+	// Check that Ingresses and Gateway API routes reach existing backends
+	stepCtx, step = startStep(ctx, "ingresses")
+	err = a.collectIngresses(stepCtx, namespace, workloads, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect ingresses: %w", err)
+	}
+	a.report("ingresses", len(data.Ingresses)+len(data.HTTPRoutes), 0, start)
+
+	// Collect the status of operator-managed custom resources
+	if len(a.opts.CustomResources) > 0 {
+		stepCtx, step := startStep(ctx, "custom resources")
+		err = a.collectCustomResources(stepCtx, namespace, data)
+		tracing.End(step, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect custom resources: %w", err)
+		}
+		a.report("custom resources", len(data.CustomResources), 0, start)
+	}
+
+	// Look up and connect to the Services from inside the namespace
+	if a.opts.ProbeConnectivity {
+		stepCtx, step := startStep(ctx, "connectivity")
+		checks, err := a.checkConnectivity(stepCtx, namespace, data)
+		tracing.End(step, err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check connectivity: %w", err)
+		}
+		a.report("connectivity", checks, 0, start)
+	}
+
+	// Collect logs for unhealthy containers; failures are recorded per
+	// container rather than aborting the run
+	if a.opts.CollectLogs {
+		stepCtx, step := startStep(ctx, "logs")
+		data.Logs = a.collectLogs(stepCtx, namespace, data.Pods, start)
+		step.SetAttributes(attribute.Int("kubehelp.logs", len(data.Logs)))
+		step.End()
+	}
+
+	// Check the cloud identities of the ServiceAccounts of unhealthy pods;
+	// credential errors in their logs point at the binding
+	stepCtx, step = startStep(ctx, "identities")
+	err = a.collectIdentities(stepCtx, pods, data)
+	tracing.End(step, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check service account identities: %w", err)
+	}
+	a.report("identities", len(data.Identities), 0, start)
+
+	SortFindings(data.Findings)
 
 	return data, nil
 }
 
-func (a *Aggregator) collectPods(ctx context.Context, namespace string, workloads []string) ([]PodInfo, error) {
-	listOpts := metav1.ListOptions{}
-
-	// If specific workloads are requested, filter by labels or names
-	if len(workloads) > 0 {
-		// For simplicity, we'll collect all and filter in memory
-		// In production, you'd want to use label selectors
+// addPods records pod information and pod-spec findings. It is shared by
+// live collection and offline sources such as support bundles.
+func (a *Aggregator) addPods(data *DiagnosticData, pods []corev1.Pod) {
+	for i := range pods {
+		data.Pods = append(data.Pods, a.extractPodInfo(&pods[i]))
 	}
+	data.Findings = append(data.Findings, checkRestarts(data.Pods)...)
+	data.Findings = append(data.Findings, checkEvictions(data.Pods)...)
+	data.Findings = append(data.Findings, checkImageDrift(data.Pods)...)
+
+	// Flag best-practice violations in pod specs
+	if a.opts.BestPractices {
+		for i := range pods {
+			data.Findings = append(data.Findings, checkBestPractices(&pods[i])...)
+		}
+	}
+}
 
-	podList, err := a.client.Clientset().CoreV1().Pods(namespace).List(ctx, listOpts)
+func (a *Aggregator) collectPods(ctx context.Context, namespace string, workloads []string) ([]corev1.Pod, error) {
+	listOpts := metav1.ListOptions{LabelSelector: a.opts.LabelSelector}
+
+	items, err := listCached(ctx, a, "pods", namespace, listOpts, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Pod, string, error) {
+		list, err := a.client.Clientset().CoreV1().Pods(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var pods []PodInfo
-	for _, pod := range podList.Items {
+	var pods []corev1.Pod
+	for _, pod := range items {
 		// Filter by workload if specified
 		if len(workloads) > 0 && !a.matchesWorkload(&pod, workloads) {
 			continue
 		}
 
-		podInfo := a.extractPodInfo(&pod)
-		pods = append(pods, podInfo)
+		pods = append(pods, pod)
 	}
 
 	return pods, nil
@@ -139,6 +585,9 @@ func (a *Aggregator) extractPodInfo(pod *corev1.Pod) PodInfo {
 		Phase:    string(pod.Status.Phase),
 		NodeName: pod.Spec.NodeName,
 		Age:      time.Since(pod.CreationTimestamp.Time),
+		Reason:   pod.Status.Reason,
+		Message:  pod.Status.Message,
+		Owner:    podOwner(pod),
 	}
 
 	// Calculate ready status
@@ -151,28 +600,21 @@ func (a *Aggregator) extractPodInfo(pod *corev1.Pod) PodInfo {
 			readyCount++
 		}
 		totalRestarts += cs.RestartCount
+		info.ContainerStatuses = append(info.ContainerStatuses, a.containerStatus(pod, cs))
+	}
 
-		containerStatus := ContainerStatus{
-			Name:         cs.Name,
-			Ready:        cs.Ready,
-			RestartCount: cs.RestartCount,
-			Image:        cs.Image,
-		}
-
-		// Extract state information
-		if cs.State.Running != nil {
-			containerStatus.State = "Running"
-		} else if cs.State.Waiting != nil {
-			containerStatus.State = "Waiting"
-			containerStatus.Reason = cs.State.Waiting.Reason
-			containerStatus.Message = cs.State.Waiting.Message
-		} else if cs.State.Terminated != nil {
-			containerStatus.State = "Terminated"
-			containerStatus.Reason = cs.State.Terminated.Reason
-			containerStatus.Message = cs.State.Terminated.Message
+	// Init container restarts count towards the pod's like in kubectl, so
+	// an Init:CrashLoopBackOff pod does not show 0 restarts
+	for _, cs := range pod.Status.InitContainerStatuses {
+		totalRestarts += cs.RestartCount
+		status := a.containerStatus(pod, cs)
+		if c := specContainer(pod, cs.Name); c != nil && c.RestartPolicy != nil {
+			status.Sidecar = *c.RestartPolicy == corev1.ContainerRestartPolicyAlways
 		}
-
-		info.ContainerStatuses = append(info.ContainerStatuses, containerStatus)
+		info.InitContainerStatuses = append(info.InitContainerStatuses, status)
+	}
+	for _, cs := range pod.Status.EphemeralContainerStatuses {
+		info.EphemeralContainerStatuses = append(info.EphemeralContainerStatuses, a.containerStatus(pod, cs))
 	}
 
 	info.Ready = fmt.Sprintf("%d/%d", readyCount, totalCount)
@@ -190,26 +632,151 @@ func (a *Aggregator) extractPodInfo(pod *corev1.Pod) PodInfo {
 		}
 	}
 
+	info.ReadinessGates = readinessGates(pod)
+
+	// The spec explains what the status cannot, e.g. a nodeSelector no
+	// node matches
+	if a.opts.IncludeSpec && info.Unhealthy() {
+		info.Spec = podSpecSummary(pod)
+	}
+
 	return info
 }
 
-func (a *Aggregator) collectEvents(ctx context.Context, namespace string) ([]EventInfo, error) {
-	listOpts := metav1.ListOptions{
-		// Get events from the last hour
-		FieldSelector: fmt.Sprintf("involvedObject.namespace=%s", namespace),
+// containerStatus converts the status of an app, init or ephemeral container
+func (a *Aggregator) containerStatus(pod *corev1.Pod, cs corev1.ContainerStatus) ContainerStatus {
+	status := ContainerStatus{
+		Name:         cs.Name,
+		Ready:        cs.Ready,
+		RestartCount: cs.RestartCount,
+		Image:        cs.Image,
 	}
 
-	eventList, err := a.client.Clientset().CoreV1().Events(namespace).List(ctx, listOpts)
+	// Extract state information
+	if cs.State.Running != nil {
+		status.State = "Running"
+	} else if cs.State.Waiting != nil {
+		status.State = "Waiting"
+		status.Reason = cs.State.Waiting.Reason
+		status.Message = cs.State.Waiting.Message
+	} else if cs.State.Terminated != nil {
+		status.State = "Terminated"
+		status.Reason = cs.State.Terminated.Reason
+		status.Message = cs.State.Terminated.Message
+		status.Termination = terminationInfo(cs.State.Terminated)
+	}
+	if cs.LastTerminationState.Terminated != nil {
+		status.LastTermination = terminationInfo(cs.LastTerminationState.Terminated)
+	}
+	if a.opts.CollectEnv {
+		if c := specContainer(pod, cs.Name); c != nil {
+			status.Env, status.EnvFrom = containerEnv(c, a.opts.EnvFilter)
+		}
+	}
+	// Probe settings explain containers that are not ready or restarted
+	// by failing probes
+	if !cs.Ready || cs.RestartCount > 0 || status.State != "Running" {
+		if c := specContainer(pod, cs.Name); c != nil {
+			status.Probes, status.Ports = containerProbes(c)
+		}
+	}
+	// Requests and limits size the memory of containers killed for it
+	if status.MemoryKill() != nil {
+		if c := specContainer(pod, cs.Name); c != nil {
+			status.Resources = containerResources(c)
+		}
+	}
+	return status
+}
+
+// specContainer returns the init or app container spec with the given name
+func specContainer(pod *corev1.Pod, name string) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == name {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == name {
+			return &pod.Spec.InitContainers[i]
+		}
+	}
+	return nil
+}
+
+// readinessGates resolves each spec.readinessGates entry against the pod's
+// status conditions
+func readinessGates(pod *corev1.Pod) []ReadinessGateStatus {
+	var gates []ReadinessGateStatus
+	for _, gate := range pod.Spec.ReadinessGates {
+		status := ReadinessGateStatus{ConditionType: string(gate.ConditionType)}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == gate.ConditionType {
+				status.Status = string(cond.Status)
+				status.Reason = cond.Reason
+				status.Message = cond.Message
+				break
+			}
+		}
+		gates = append(gates, status)
+	}
+	return gates
+}
+
+func terminationInfo(t *corev1.ContainerStateTerminated) *TerminationInfo {
+	return &TerminationInfo{
+		Reason:     t.Reason,
+		ExitCode:   t.ExitCode,
+		StartedAt:  t.StartedAt.Time,
+		FinishedAt: t.FinishedAt.Time,
+	}
+}
+
+// collectEvents records recent warning events and returns all events of the
+// namespace. The event window is measured against the cluster clock so a
+// skewed client clock does not silently drop or include everything.
+func (a *Aggregator) collectEvents(ctx context.Context, namespace string, data *DiagnosticData) ([]corev1.Event, error) {
+	items, err := a.listEvents(ctx, namespace)
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
+	window := a.opts.EventsSince
+	if skew := a.detectClockSkew(ctx, now, items); skew != 0 {
+		data.ClockSkew = skew
+		data.Warnings = append(data.Warnings, clockSkewWarning(skew))
+		now = now.Add(skew)
+		window += skew.Abs()
+	}
+
+	a.addEvents(data, items, now, window)
+	return items, nil
+}
+
+// addEvents records recent warning events and event-derived findings. It is
+// shared by live collection and offline sources such as support bundles;
+// data.Pods must already be populated.
+func (a *Aggregator) addEvents(data *DiagnosticData, items []corev1.Event, now time.Time, window time.Duration) {
+	data.EventsSince = a.opts.EventsSince
+	data.Events = a.filterEvents(items, now, window)
+
+	// Explain Pending pods using scheduler and cluster-autoscaler events
+	data.Findings = append(data.Findings, checkScheduling(data.Pods, items)...)
+	data.Findings = append(data.Findings, checkMountFailures(data.Pods, items)...)
+	data.Findings = append(data.Findings, correlateProbeFailures(data.Pods, items)...)
+}
+
+// filterEvents keeps warning and error events seen within window before now
+func (a *Aggregator) filterEvents(items []corev1.Event, now time.Time, window time.Duration) []EventInfo {
 	var events []EventInfo
-	cutoff := time.Now().Add(-1 * time.Hour)
+	cutoff := now.Add(-window)
 
-	for _, event := range eventList.Items {
-		// Filter recent events
-		if event.LastTimestamp.Time.Before(cutoff) {
+	for _, event := range items {
+		// Filter recent events; events.k8s.io events repeated in a series
+		// may only carry the time of their last occurrence there
+		last := eventTime(event)
+		if last.Before(cutoff) {
 			continue
 		}
 
@@ -218,25 +785,48 @@ func (a *Aggregator) collectEvents(ctx context.Context, namespace string) ([]Eve
 			continue
 		}
 
+		// Skip findings recorded by earlier runs with --emit-events
+		if event.ReportingController == ReportingController {
+			continue
+		}
+
 		events = append(events, EventInfo{
 			Type:           event.Type,
 			Reason:         event.Reason,
 			Message:        event.Message,
 			InvolvedObject: fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name),
 			FirstTimestamp: event.FirstTimestamp.Time,
-			LastTimestamp:  event.LastTimestamp.Time,
-			Count:          event.Count,
+			LastTimestamp:  last,
+			Count:          eventCount(event),
 		})
 	}
 
-	return events, nil
+	return events
 }
 
+// matchesWorkload reports whether the pod belongs to one of the workloads,
+// resolved through owner references (Pod → ReplicaSet → Deployment, Pod →
+// StatefulSet/DaemonSet/Job). Pods without an owner match by their own name.
 func (a *Aggregator) matchesWorkload(pod *corev1.Pod, workloads []string) bool {
-	// Check if pod name starts with any of the workload names
-	// This is a simple heuristic; in production, use owner references
+	owner := podOwner(pod)
+	if owner == "" {
+		owner = "Pod/" + pod.Name
+	}
+	return matchesAnyWorkload(owner, workloads)
+}
+
+// matchesAnyWorkload reports whether ref, e.g. "Deployment/api", is one of
+// the workloads. A workload is a name ("api") or a kind-qualified name
+// ("statefulset/db", kind matched case-insensitively); names match exactly,
+// so "api" does not select "api-gateway".
+func matchesAnyWorkload(ref string, workloads []string) bool {
+	kind, name, _ := strings.Cut(ref, "/")
 	for _, workload := range workloads {
-		if len(pod.Name) >= len(workload) && pod.Name[:len(workload)] == workload {
+		if k, n, ok := strings.Cut(workload, "/"); ok {
+			if strings.EqualFold(k, kind) && n == name {
+				return true
+			}
+		} else if workload == name {
 			return true
 		}
 	}
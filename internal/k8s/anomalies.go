@@ -0,0 +1,61 @@
+package k8s
+
+import (
+	"fmt"
+	"time"
+)
+
+// recentRestartWindow is how recently a container must have restarted for
+// the restart to count as an anomaly; older restarts stay in RestartCount
+// forever and would otherwise flag a healthy pod on every scan
+const recentRestartWindow = time.Hour
+
+// Anomalies lists what needs attention in the collected data: pods that are
+// not running, containers that are failing or restarted within the last
+// hour, and findings of at least minSeverity. It is empty for a healthy
+// namespace, so periodic scans can skip the LLM.
+func (d *DiagnosticData) Anomalies(minSeverity Severity) []string {
+	var anomalies []string
+	for _, cluster := range d.ClusterData() {
+		prefix := ""
+		if len(d.Clusters) > 0 {
+			prefix = cluster.ContextName + ": "
+		}
+		for _, pod := range cluster.Pods {
+			if reason := podAnomaly(pod, d.CollectedAt); reason != "" {
+				anomalies = append(anomalies, prefix+Qualify(pod.Namespace, "Pod/"+pod.Name)+": "+reason)
+			}
+		}
+		for _, f := range cluster.Findings {
+			if f.Severity.Rank() >= minSeverity.Rank() {
+				anomalies = append(anomalies, fmt.Sprintf("%s%s: %s finding %s", prefix, Qualify(f.Namespace, f.Object), f.Severity, f.Rule))
+			}
+		}
+	}
+	return anomalies
+}
+
+// podAnomaly names why a pod needs attention, or returns ""
+func podAnomaly(pod PodInfo, now time.Time) string {
+	if pod.Phase != "Running" && pod.Phase != "Succeeded" {
+		if status := pod.InitStatus(); status != "" {
+			return pod.Phase + " (" + status + ")"
+		}
+		if pod.Reason != "" {
+			return pod.Phase + " (" + pod.Reason + ")"
+		}
+		return pod.Phase
+	}
+	for _, cs := range pod.ContainerStatuses {
+		if cs.Reason != "" && cs.Reason != "Completed" {
+			return fmt.Sprintf("container %s %s", cs.Name, cs.Reason)
+		}
+		if pod.Phase == "Running" && !cs.Ready {
+			return fmt.Sprintf("container %s not ready", cs.Name)
+		}
+		if t := cs.LastTermination; t != nil && now.Sub(t.FinishedAt) < recentRestartWindow {
+			return fmt.Sprintf("container %s restarted after %s (exit %d)", cs.Name, t.Reason, t.ExitCode)
+		}
+	}
+	return ""
+}
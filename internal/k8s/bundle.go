@@ -0,0 +1,297 @@
+package k8s
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// maxBundleFileBytes bounds how much of a single bundle file is read
+const maxBundleFileBytes = 64 << 20
+
+// LoadBundle builds DiagnosticData for a namespace from a support bundle
+// (must-gather style) directory or .tar/.tar.gz archive, without cluster
+// access. The namespace directory may be nested anywhere in the bundle:
+//
+//	namespaces/<ns>/pods.yaml | pods.json | core/pods.yaml       PodList
+//	namespaces/<ns>/pods/<pod>/<pod>.yaml                         single Pod
+//	namespaces/<ns>/events.yaml | events.json | core/events.yaml EventList
+//	namespaces/<ns>/pods/<pod>/<container>/<container>/logs/current.log
+//	namespaces/<ns>/pods/<pod>/<container>/<container>/logs/previous.log
+//	namespaces/<ns>/logs/<pod>/<container>.log | <container>.previous.log
+//
+// Missing sections are tolerated; at least pods or events must be present.
+func LoadBundle(bundlePath, namespace string, workloads []string, opts AggregatorOptions) (*DiagnosticData, error) {
+	files, err := readBundle(bundlePath, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no data for namespace %q found in bundle %s (expected namespaces/%s/...)", namespace, bundlePath, namespace)
+	}
+
+	pods, err := bundlePods(files)
+	if err != nil {
+		return nil, err
+	}
+	events, err := bundleEvents(files)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 && len(events) == 0 {
+		return nil, fmt.Errorf("bundle %s has no pods or events for namespace %q", bundlePath, namespace)
+	}
+
+	a := NewAggregatorWithOptions(nil, opts)
+	data := &DiagnosticData{
+		SchemaVersion: CurrentSchemaVersion,
+		Namespace:     namespace,
+		Workloads:     workloads,
+		CollectedAt:   bundleTime(events, bundlePath),
+		ContextName:   "bundle:" + filepath.Base(bundlePath),
+	}
+
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector: %w", err)
+	}
+
+	var selected []corev1.Pod
+	for _, pod := range pods {
+		if len(workloads) > 0 && !a.matchesWorkload(&pod, workloads) {
+			continue
+		}
+		if !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		selected = append(selected, pod)
+	}
+	a.addPods(data, selected)
+
+	// The bundle is a point-in-time capture, so the event window is relative
+	// to the capture time rather than now
+	a.addEvents(data, events, data.CollectedAt, a.opts.EventsSince)
+
+	if opts.CollectLogs {
+		data.Logs = a.bundleLogs(files, data.Pods)
+	}
+
+	SortFindings(data.Findings)
+	return data, nil
+}
+
+// readBundle loads the files below namespaces/<namespace>/ keyed by their
+// path relative to that directory
+func readBundle(bundlePath, namespace string) (map[string][]byte, error) {
+	info, err := os.Stat(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	files := make(map[string][]byte)
+	add := func(name string, r io.Reader) error {
+		rel, ok := namespaceRelPath(name, namespace)
+		if !ok {
+			return nil
+		}
+		content, err := io.ReadAll(io.LimitReader(r, maxBundleFileBytes))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		files[rel] = content
+		return nil
+	}
+
+	if info.IsDir() {
+		err = filepath.WalkDir(bundlePath, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(bundlePath, p)
+			if _, ok := namespaceRelPath(filepath.ToSlash(rel), namespace); !ok {
+				return nil
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return add(filepath.ToSlash(rel), f)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle directory: %w", err)
+		}
+		return files, nil
+	}
+
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(bundlePath, ".gz") || strings.HasSuffix(bundlePath, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress bundle: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := add(hdr.Name, tr); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// namespaceRelPath returns the part of name below namespaces/<namespace>/
+func namespaceRelPath(name, namespace string) (string, bool) {
+	marker := "namespaces/" + namespace + "/"
+	name = "/" + strings.TrimPrefix(path.Clean("/"+name), "/")
+	i := strings.Index(name, "/"+marker)
+	if i < 0 {
+		return "", false
+	}
+	return name[i+len(marker)+1:], true
+}
+
+// bundlePods decodes pod lists and individual pod manifests, de-duplicated by name
+func bundlePods(files map[string][]byte) ([]corev1.Pod, error) {
+	byName := make(map[string]corev1.Pod)
+
+	for _, name := range []string{"pods.yaml", "pods.yml", "pods.json", "core/pods.yaml", "core/pods.json"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		var list corev1.PodList
+		if err := yaml.Unmarshal(content, &list); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		for _, pod := range list.Items {
+			byName[pod.Name] = pod
+		}
+	}
+
+	for name, content := range files {
+		parts := strings.Split(name, "/")
+		// pods/<pod>/<pod>.yaml
+		if len(parts) != 3 || parts[0] != "pods" || !isManifest(parts[2]) ||
+			strings.TrimSuffix(parts[2], path.Ext(parts[2])) != parts[1] {
+			continue
+		}
+		var pod corev1.Pod
+		if err := yaml.Unmarshal(content, &pod); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		if pod.Name != "" {
+			byName[pod.Name] = pod
+		}
+	}
+
+	pods := make([]corev1.Pod, 0, len(byName))
+	for _, pod := range byName {
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+// bundleEvents decodes the namespace event list, if present
+func bundleEvents(files map[string][]byte) ([]corev1.Event, error) {
+	for _, name := range []string{"events.yaml", "events.yml", "events.json", "core/events.yaml", "core/events.json"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		var list corev1.EventList
+		if err := yaml.Unmarshal(content, &list); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		return list.Items, nil
+	}
+	return nil, nil
+}
+
+// bundleLogs attaches captured logs for unhealthy containers
+func (a *Aggregator) bundleLogs(files map[string][]byte, pods []PodInfo) []ContainerLog {
+	var logs []ContainerLog
+	for _, target := range logTargets(pods) {
+		kind := "current"
+		if target.Previous {
+			kind = "previous"
+		}
+		candidates := []string{
+			fmt.Sprintf("pods/%s/%s/%s/logs/%s.log", target.Pod, target.Container, target.Container, kind),
+			fmt.Sprintf("logs/%s/%s.log", target.Pod, target.Container),
+		}
+		if target.Previous {
+			candidates[1] = fmt.Sprintf("logs/%s/%s.previous.log", target.Pod, target.Container)
+		}
+
+		target.Note = "logs not included in bundle"
+		for _, name := range candidates {
+			content, ok := files[name]
+			if !ok {
+				continue
+			}
+			target.Note = ""
+			text := strings.TrimRight(string(content), "\n")
+			if text == "" {
+				target.Note = "no log output"
+				break
+			}
+			target.Lines, target.Omitted = selectRelevantLines(strings.Split(text, "\n"), int(a.opts.LogTailLines), a.opts.LogKeywords)
+			break
+		}
+		logs = append(logs, target)
+	}
+	return logs
+}
+
+// bundleTime estimates when the bundle was captured: the latest event
+// timestamp, falling back to the bundle's modification time
+func bundleTime(events []corev1.Event, bundlePath string) time.Time {
+	if latest := newestEventTime(events); !latest.IsZero() {
+		return latest
+	}
+	if info, err := os.Stat(bundlePath); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+func isManifest(name string) bool {
+	switch path.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
@@ -1,82 +1,166 @@
 package k8s
 
 import (
+	"context"
 	"fmt"
-	"path/filepath"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
 // Client wraps Kubernetes client with common operations
 type Client struct {
 	clientset *kubernetes.Clientset
-	config    *rest.Config
+	// dynamic reads custom resources such as Gateway API routes
+	dynamic dynamic.Interface
+	config  *rest.Config
 }
 
 // NewClient creates a new Kubernetes client from kubeconfig
 func NewClient(kubeconfig string, context string) (*Client, error) {
+	return NewClientWithTimeout(kubeconfig, context, 0)
+}
+
+// NewClientWithTimeout creates a Kubernetes client whose HTTP requests are
+// limited to timeout (0: no limit), as a backstop for per-call contexts.
+// Inside a pod it falls back to the ServiceAccount (in-cluster) config when
+// no kubeconfig is available; KUBEHELP_IN_CLUSTER=true always uses it.
+func NewClientWithTimeout(kubeconfig string, context string, timeout time.Duration) (*Client, error) {
+	return NewClientFromConfig(kubeconfigLoader(kubeconfig, context), timeout)
+}
+
+// NewClientFromConfig creates a Kubernetes client from a kubeconfig loader,
+// e.g. one honoring kubectl's connection flags, with requests limited to
+// timeout (0: no limit). KUBEHELP_IN_CLUSTER=true uses the in-cluster config
+// instead.
+func NewClientFromConfig(clientConfig clientcmd.ClientConfig, timeout time.Duration) (*Client, error) {
 	var config *rest.Config
 	var err error
 
-	if kubeconfig == "" {
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
+	if inClusterForced() {
+		config, err = rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+		}
+	} else {
+		// The loader itself falls back to the in-cluster config inside a
+		// pod without a kubeconfig
+		config, err = clientConfig.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
 		}
 	}
-
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	loadingRules.ExplicitPath = kubeconfig
-
-	configOverrides := &clientcmd.ConfigOverrides{}
-	if context != "" {
-		configOverrides.CurrentContext = context
-	}
-
-	config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		loadingRules,
-		configOverrides,
-	).ClientConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
-	}
+	config.Timeout = timeout
+	// Trace each API request as a child of the collection step making it
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt)
+	})
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
 
 	return &Client{
 		clientset: clientset,
+		dynamic:   dynamicClient,
 		config:    config,
 	}, nil
 }
 
+// kubeconfigLoader loads context (default: the current context) from
+// kubeconfig, or like kubectl when it is empty: from the files in $KUBECONFIG,
+// merged, else ~/.kube/config
+func kubeconfigLoader(kubeconfig, context string) clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+
+	configOverrides := &clientcmd.ConfigOverrides{}
+	if context != "" {
+		configOverrides.CurrentContext = context
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+}
+
+// inClusterForced reports whether KUBEHELP_IN_CLUSTER requests the
+// in-cluster config regardless of any kubeconfig
+func inClusterForced() bool {
+	forced, _ := strconv.ParseBool(os.Getenv("KUBEHELP_IN_CLUSTER"))
+	return forced
+}
+
 // Clientset returns the underlying Kubernetes clientset
 func (c *Client) Clientset() *kubernetes.Clientset {
 	return c.clientset
 }
 
-// GetCurrentContext returns the current kubeconfig context name
-func GetCurrentContext(kubeconfig string) (string, error) {
-	if kubeconfig == "" {
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
-		}
+// Dynamic returns the client for resources without typed clients, e.g.
+// custom resources
+func (c *Client) Dynamic() dynamic.Interface {
+	return c.dynamic
+}
+
+// ServerTime returns the apiserver clock as reported by the Date header of a
+// /version request. The header has one-second resolution.
+func (c *Client) ServerTime(ctx context.Context) (time.Time, error) {
+	httpClient, err := rest.HTTPClientFor(c.config)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	host, _, err := rest.DefaultServerUrlFor(c.config)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to resolve server URL: %w", err)
 	}
 
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	loadingRules.ExplicitPath = kubeconfig
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host.JoinPath("version").String(), nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query server version: %w", err)
+	}
+	resp.Body.Close()
 
-	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		loadingRules,
-		&clientcmd.ConfigOverrides{},
-	).RawConfig()
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return time.Time{}, fmt.Errorf("server response has no Date header")
+	}
+	serverTime, err := http.ParseTime(date)
 	if err != nil {
-		return "", fmt.Errorf("failed to load kubeconfig: %w", err)
+		return time.Time{}, fmt.Errorf("failed to parse Date header %q: %w", date, err)
 	}
+	return serverTime, nil
+}
 
+// GetCurrentContext returns the current context of kubeconfig (default:
+// $KUBECONFIG or ~/.kube/config)
+func GetCurrentContext(kubeconfig string) (string, error) {
+	config, err := kubeconfigLoader(kubeconfig, "").RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
 	return config.CurrentContext, nil
 }
+
+// ContextExists reports whether the kubeconfig defines the named context
+func ContextExists(kubeconfig, context string) (bool, error) {
+	config, err := kubeconfigLoader(kubeconfig, "").RawConfig()
+	if err != nil {
+		return false, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	_, ok := config.Contexts[context]
+	return ok, nil
+}
@@ -0,0 +1,58 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ClockSkewThreshold is the clock difference between client and cluster
+// beyond which the event window is adjusted and a warning is reported
+const ClockSkewThreshold = 2 * time.Minute
+
+// detectClockSkew estimates the cluster clock minus the local clock. The
+// apiserver Date header is preferred; when it is unavailable, an event
+// timestamp lying in the local future also reveals a cluster clock running
+// ahead. Skew below ClockSkewThreshold is reported as zero.
+func (a *Aggregator) detectClockSkew(ctx context.Context, localNow time.Time, events []corev1.Event) time.Duration {
+	var skew time.Duration
+	var serverTime time.Time
+	err := a.apiCall(ctx, "querying server time", func(ctx context.Context) error {
+		var err error
+		serverTime, err = a.client.ServerTime(ctx)
+		return err
+	})
+	if err == nil {
+		skew = serverTime.Sub(time.Now())
+	} else if newest := newestEventTime(events); newest.After(localNow) {
+		skew = newest.Sub(localNow)
+	}
+
+	if skew.Abs() < ClockSkewThreshold {
+		return 0
+	}
+	return skew.Round(time.Second)
+}
+
+// clockSkewWarning describes the detected skew for the report
+func clockSkewWarning(skew time.Duration) string {
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	return fmt.Sprintf("cluster clock is %s %s the local clock; the event window was aligned to cluster time and widened by the skew",
+		skew.Abs(), direction)
+}
+
+// newestEventTime returns the time of the latest event
+func newestEventTime(events []corev1.Event) time.Time {
+	var newest time.Time
+	for _, e := range events {
+		if t := eventTime(e); t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
@@ -0,0 +1,94 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClusterResult is the outcome of collecting one kubeconfig context
+type ClusterResult struct {
+	Context string
+	Data    *DiagnosticData
+	Err     error
+}
+
+// ClusterCollector collects diagnostic data from the cluster behind a
+// kubeconfig context
+type ClusterCollector func(ctx context.Context, kubeContext string) (*DiagnosticData, error)
+
+// CollectClusters runs collect for every context concurrently. Results are
+// returned in the order of contexts.
+func CollectClusters(ctx context.Context, contexts []string, collect ClusterCollector) []ClusterResult {
+	results := make([]ClusterResult, len(contexts))
+	var wg sync.WaitGroup
+	for i, kubeContext := range contexts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := collect(ctx, kubeContext)
+			results[i] = ClusterResult{Context: kubeContext, Data: data, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// MergeClusterResults combines per-cluster data into one DiagnosticData whose
+// Clusters hold each cluster's data under its context name. Clusters that
+// fail are reported as warnings; an error is returned only if all fail.
+func MergeClusterResults(results []ClusterResult) (*DiagnosticData, error) {
+	merged := &DiagnosticData{
+		SchemaVersion: CurrentSchemaVersion,
+		CollectedAt:   time.Now(),
+	}
+
+	var lastErr error
+	for _, r := range results {
+		if r.Err != nil {
+			lastErr = r.Err
+			merged.Warnings = append(merged.Warnings, fmt.Sprintf("cluster %s was skipped: %v", r.Context, r.Err))
+			continue
+		}
+		data := *r.Data
+		data.ContextName = r.Context
+		merged.Namespace = data.Namespace
+		merged.Workloads = data.Workloads
+		merged.Clusters = append(merged.Clusters, data)
+	}
+	if len(merged.Clusters) == 0 && lastErr != nil {
+		return nil, fmt.Errorf("no cluster could be collected: %w", lastErr)
+	}
+	return merged, nil
+}
+
+// ClusterData returns the data of each cluster of a multi-cluster
+// collection, or d itself for a single cluster
+func (d *DiagnosticData) ClusterData() []*DiagnosticData {
+	if len(d.Clusters) == 0 {
+		return []*DiagnosticData{d}
+	}
+	clusters := make([]*DiagnosticData, len(d.Clusters))
+	for i := range d.Clusters {
+		clusters[i] = &d.Clusters[i]
+	}
+	return clusters
+}
+
+// ListContexts returns the names of all contexts in kubeconfig (default:
+// $KUBECONFIG or ~/.kube/config) in sorted order
+func ListContexts(kubeconfig string) ([]string, error) {
+	config, err := kubeconfigLoader(kubeconfig, "").RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
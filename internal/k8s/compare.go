@@ -0,0 +1,319 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Values of the "presence" field of a Difference
+const (
+	presencePresent = "present"
+	presenceMissing = "missing"
+)
+
+// Difference is one field in which the target of a comparison differs from
+// the baseline, e.g. Object "Deployment/api", Field "image app", Baseline
+// "api:1.4", Target "api:1.5". Field "presence" marks objects that exist on
+// one side only; their other fields are not compared.
+type Difference struct {
+	Object   string `json:"object"`
+	Field    string `json:"field"`
+	Baseline string `json:"baseline"`
+	Target   string `json:"target"`
+}
+
+// Comparison is the structured diff of two collections, typically a working
+// namespace (the baseline) and a broken one (the target)
+type Comparison struct {
+	// Baseline and Target name the compared collections, e.g.
+	// "staging/payments" or a snapshot file
+	Baseline    string       `json:"baseline"`
+	Target      string       `json:"target"`
+	Differences []Difference `json:"differences,omitempty"`
+	// NewFindings are only found in the target, ResolvedFindings only in
+	// the baseline. Findings on pods are matched by their workload, so pod
+	// name suffixes do not count as differences.
+	NewFindings      []Finding `json:"newFindings,omitempty"`
+	ResolvedFindings []Finding `json:"resolvedFindings,omitempty"`
+	// NewEvents are the Warning events of the target last seen after the
+	// baseline was collected; only set by CompareOverTime
+	NewEvents []EventInfo `json:"newEvents,omitempty"`
+}
+
+// Compare diffs the workloads, Services, NetworkPolicies, Warning events and
+// findings of two single-cluster collections. Pods are compared per
+// workload, since their names differ between namespaces.
+func Compare(baseline, target *DiagnosticData, baselineLabel, targetLabel string) *Comparison {
+	c := &Comparison{Baseline: baselineLabel, Target: targetLabel}
+
+	before, after := comparedFields(baseline), comparedFields(target)
+	objects := make(map[string]bool)
+	for object := range before {
+		objects[object] = true
+	}
+	for object := range after {
+		objects[object] = true
+	}
+	sorted := make([]string, 0, len(objects))
+	for object := range objects {
+		sorted = append(sorted, object)
+	}
+	sort.Strings(sorted)
+
+	for _, object := range sorted {
+		b, inBaseline := before[object]
+		t, inTarget := after[object]
+		switch {
+		case !inBaseline:
+			c.Differences = append(c.Differences, Difference{Object: object, Field: "presence", Baseline: presenceMissing, Target: presencePresent})
+			continue
+		case !inTarget:
+			c.Differences = append(c.Differences, Difference{Object: object, Field: "presence", Baseline: presencePresent, Target: presenceMissing})
+			continue
+		}
+
+		fields := make(map[string]bool)
+		for field := range b {
+			fields[field] = true
+		}
+		for field := range t {
+			fields[field] = true
+		}
+		names := make([]string, 0, len(fields))
+		for field := range fields {
+			names = append(names, field)
+		}
+		sort.Strings(names)
+		for _, field := range names {
+			if b[field] == t[field] {
+				continue
+			}
+			c.Differences = append(c.Differences, Difference{Object: object, Field: field, Baseline: orDash(b[field]), Target: orDash(t[field])})
+		}
+	}
+
+	c.NewFindings = findingsOnlyIn(target, baseline)
+	c.ResolvedFindings = findingsOnlyIn(baseline, target)
+	return c
+}
+
+// CompareOverTime diffs an earlier collection of a namespace with a later
+// one like Compare, adding the Warning events seen since the earlier one
+// and the workloads whose pods moved to other nodes
+func CompareOverTime(earlier, later *DiagnosticData, earlierLabel, laterLabel string) *Comparison {
+	c := Compare(earlier, later, earlierLabel, laterLabel)
+
+	before, after := workloadNodes(earlier), workloadNodes(later)
+	for object, nodes := range after {
+		if previous, ok := before[object]; ok && previous != nodes {
+			c.Differences = append(c.Differences, Difference{Object: object, Field: "nodes", Baseline: orDash(previous), Target: orDash(nodes)})
+		}
+	}
+	sort.SliceStable(c.Differences, func(i, j int) bool { return c.Differences[i].Object < c.Differences[j].Object })
+
+	for _, e := range later.Events {
+		if e.LastTimestamp.After(earlier.CollectedAt) {
+			c.NewEvents = append(c.NewEvents, e)
+		}
+	}
+	sort.Slice(c.NewEvents, func(i, j int) bool { return c.NewEvents[i].LastTimestamp.After(c.NewEvents[j].LastTimestamp) })
+	return c
+}
+
+// workloadNodes returns the nodes running the pods of each workload, e.g.
+// "node-a, node-b"
+func workloadNodes(data *DiagnosticData) map[string]string {
+	nodes := make(map[string]map[string]bool)
+	for _, pod := range data.Pods {
+		if pod.NodeName == "" {
+			continue
+		}
+		object := Qualify(pod.Namespace, workloadOf(pod))
+		if nodes[object] == nil {
+			nodes[object] = make(map[string]bool)
+		}
+		nodes[object][pod.NodeName] = true
+	}
+	joined := make(map[string]string, len(nodes))
+	for object, set := range nodes {
+		joined[object] = strings.Join(sortedKeys(set), ", ")
+	}
+	return joined
+}
+
+// comparedFields flattens data into object -> field -> value for Compare
+func comparedFields(data *DiagnosticData) map[string]map[string]string {
+	fields := make(map[string]map[string]string)
+	set := func(object, field, value string) {
+		if fields[object] == nil {
+			fields[object] = make(map[string]string)
+		}
+		if field != "" {
+			fields[object][field] = value
+		}
+	}
+
+	for _, c := range data.Controllers {
+		// A Deployment's ReplicaSets are named after its pod template hash
+		// and compared through the Deployment
+		if c.Owner != "" {
+			continue
+		}
+		object := Qualify(c.Namespace, c.Kind+"/"+c.Name)
+		set(object, "replicas", fmt.Sprintf("%d/%d ready", c.Ready, c.Desired))
+		if c.Paused {
+			set(object, "paused", "true")
+		}
+	}
+
+	type workload struct {
+		pods, ready int
+		restarts    int32
+		images      map[string]map[string]bool
+		states      map[string]bool
+	}
+	workloads := make(map[string]*workload)
+	for _, pod := range data.Pods {
+		object := Qualify(pod.Namespace, workloadOf(pod))
+		w := workloads[object]
+		if w == nil {
+			w = &workload{images: make(map[string]map[string]bool), states: make(map[string]bool)}
+			workloads[object] = w
+		}
+		w.pods++
+		if podReady(pod) {
+			w.ready++
+		}
+		w.restarts += pod.Restarts
+		if pod.Reason != "" {
+			w.states[pod.Reason] = true
+		} else if pod.Phase == "Pending" {
+			w.states["Pending"] = true
+		}
+		for _, cs := range pod.AllContainerStatuses() {
+			if cs.Image != "" {
+				if w.images[cs.Name] == nil {
+					w.images[cs.Name] = make(map[string]bool)
+				}
+				w.images[cs.Name][normalizeImage(cs.Image)] = true
+			}
+			if cs.State != "Running" && cs.Reason != "" && cs.Reason != "Completed" {
+				w.states[cs.Reason] = true
+			}
+			if cs.LastTermination != nil && cs.LastTermination.Reason == "OOMKilled" {
+				w.states["OOMKilled"] = true
+			}
+			for _, env := range cs.Env {
+				value := env.Value
+				if env.Source != "" {
+					value = "from " + env.Source
+				}
+				set(object, fmt.Sprintf("env %s %s", cs.Name, env.Name), value)
+			}
+		}
+	}
+	for object, w := range workloads {
+		set(object, "pods ready", fmt.Sprintf("%d/%d", w.ready, w.pods))
+		set(object, "restarts", fmt.Sprint(w.restarts))
+		set(object, "container states", strings.Join(sortedKeys(w.states), ", "))
+		for container, images := range w.images {
+			set(object, "image "+container, strings.Join(sortedKeys(images), ", "))
+		}
+	}
+
+	for _, svc := range data.Services {
+		object := Qualify(svc.Namespace, "Service/"+svc.Name)
+		set(object, "selector", svc.Selector)
+		set(object, "ports", strings.Join(svc.Ports, ", "))
+		set(object, "endpoints", fmt.Sprintf("%d ready, %d not ready", svc.ReadyEndpoints, svc.NotReadyEndpoints))
+	}
+	for _, np := range data.NetworkPolicies {
+		object := Qualify(np.Namespace, "NetworkPolicy/"+np.Name)
+		set(object, "pod selector", np.PodSelector)
+		set(object, "policy types", strings.Join(np.PolicyTypes, ", "))
+		set(object, "ingress", strings.Join(np.Ingress, "; "))
+		set(object, "egress", strings.Join(np.Egress, "; "))
+	}
+
+	// Warning event reasons, as the count of events with each reason; the
+	// object always exists so that reasons on one side show as differences
+	reasons := make(map[string]int32)
+	for _, e := range data.Events {
+		if e.Type == "Warning" {
+			reasons[e.Reason] += max(e.Count, 1)
+		}
+	}
+	set("Warning events", "", "")
+	for reason, count := range reasons {
+		set("Warning events", reason, fmt.Sprint(count))
+	}
+	return fields
+}
+
+// workloadOf returns the workload managing a pod, or the pod itself when it
+// is unmanaged
+func workloadOf(pod PodInfo) string {
+	if pod.Owner != "" {
+		return pod.Owner
+	}
+	return "Pod/" + pod.Name
+}
+
+// podReady reports whether all containers of the pod are ready, from its
+// "ready/total" column
+func podReady(pod PodInfo) bool {
+	ready, total, ok := strings.Cut(pod.Ready, "/")
+	return ok && ready == total && total != "0"
+}
+
+// findingsOnlyIn returns the findings of data without a match in other,
+// matched by rule and workload
+func findingsOnlyIn(data, other *DiagnosticData) []Finding {
+	seen := make(map[string]bool)
+	for _, f := range other.Findings {
+		seen[findingKey(other, f)] = true
+	}
+	var only []Finding
+	for _, f := range data.Findings {
+		if !seen[findingKey(data, f)] {
+			only = append(only, f)
+		}
+	}
+	return only
+}
+
+// findingKey identifies a finding across collections, replacing the pod in
+// objects such as "Pod/api-7d9f-x2k/app" with its workload
+func findingKey(data *DiagnosticData, f Finding) string {
+	object := f.Object
+	if rest, ok := strings.CutPrefix(object, "Pod/"); ok {
+		name, container, _ := strings.Cut(rest, "/")
+		for _, pod := range data.Pods {
+			if pod.Name == name && pod.Namespace == f.Namespace {
+				object = workloadOf(pod)
+				if container != "" {
+					object += "/" + container
+				}
+				break
+			}
+		}
+	}
+	return f.Rule + " " + Qualify(f.Namespace, object)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,430 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Connectivity check defaults
+const (
+	// DefaultProbeImage needs a shell, nslookup and nc, which busybox has
+	DefaultProbeImage = "busybox:1.36"
+	// DefaultClusterDomain is the DNS suffix of Services, e.g.
+	// "api.payments.svc.cluster.local"
+	DefaultClusterDomain = "cluster.local"
+	// probeTimeout bounds how long the probe pod may take to be scheduled,
+	// pull its image and run the checks
+	probeTimeout = 90 * time.Second
+	// maxProbeServices and maxProbePorts bound the checks of a namespace
+	maxProbeServices = 10
+	maxProbePorts    = 3
+)
+
+// Connectivity check kinds
+const (
+	CheckDNS = "dns"
+	CheckTCP = "tcp"
+)
+
+// ConnectivityCheck is the result of a DNS lookup or TCP connection made
+// from a short-lived probe pod in the namespace
+type ConnectivityCheck struct {
+	Kind string `json:"kind"`
+	// Target is the name looked up, or "host:port" for TCP checks
+	Target string `json:"target"`
+	// Service is the Service checked; it is empty for the cluster DNS check
+	Service   string `json:"service,omitempty"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	OK        bool   `json:"ok"`
+	// Addresses are the IPs a DNS lookup returned
+	Addresses []string `json:"addresses,omitempty"`
+	// Error is the lookup or connection error, e.g. "Connection refused"
+	Error string `json:"error,omitempty"`
+}
+
+// probeTarget is a check the probe pod runs
+type probeTarget struct {
+	kind    string
+	host    string
+	port    int32
+	service *ServiceInfo
+}
+
+func (t probeTarget) target() string {
+	if t.kind == CheckTCP {
+		return net.JoinHostPort(t.host, strconv.Itoa(int(t.port)))
+	}
+	return t.host
+}
+
+// checkConnectivity runs DNS lookups and TCP connections from a probe pod
+// in the namespace when it has unhealthy pods or failing Services. The pod
+// resolves the cluster's own API Service, to tell broken cluster DNS from a
+// broken Service, and each collected Service, failing ones first, by name
+// and on its TCP ports. It returns the number of checks run.
+//
+// The probe pod has no labels Services or NetworkPolicies select by
+// workload, but namespace-wide policies apply to it like to any pod. It runs
+// as an unprivileged user without a service account token and is deleted
+// once its output has been read.
+func (a *Aggregator) checkConnectivity(ctx context.Context, namespace string, data *DiagnosticData) (int, error) {
+	targets := a.probeTargets(namespace, data)
+	if len(targets) == 0 {
+		return 0, nil
+	}
+
+	output, err := a.runProbePod(ctx, namespace, probeScript(targets))
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("connectivity not checked: %v", err))
+		return 0, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, err
+		}
+		data.Warnings = append(data.Warnings, fmt.Sprintf("connectivity not checked: %v", err))
+		return 0, nil
+	}
+
+	outputs := parseProbeOutput(output)
+	checks := make([]ConnectivityCheck, len(targets))
+	for i, t := range targets {
+		if i < len(outputs) {
+			checks[i] = connectivityCheck(t, outputs[i])
+		} else {
+			checks[i] = ConnectivityCheck{Kind: t.kind, Target: t.target(), Error: "probe pod stopped before running the check"}
+			if t.service != nil {
+				checks[i].Service = t.service.Name
+			}
+		}
+	}
+	data.Connectivity = append(data.Connectivity, checks...)
+	data.Findings = append(data.Findings, checkConnectivityResults(namespace, targets, checks)...)
+	return len(checks), nil
+}
+
+// probeTargets lists the checks of the namespace, or nothing when all of its
+// pods and Services are healthy
+func (a *Aggregator) probeTargets(namespace string, data *DiagnosticData) []probeTarget {
+	failing := false
+	for _, pod := range data.Pods {
+		failing = failing || pod.Unhealthy()
+	}
+	services := make([]*ServiceInfo, len(data.Services))
+	for i := range data.Services {
+		services[i] = &data.Services[i]
+		failing = failing || data.Services[i].HasIssues()
+	}
+	if !failing {
+		return nil
+	}
+	sort.SliceStable(services, func(i, j int) bool { return services[i].HasIssues() && !services[j].HasIssues() })
+	if len(services) > maxProbeServices {
+		services = services[:maxProbeServices]
+	}
+
+	domain := a.opts.ClusterDomain
+	targets := []probeTarget{{kind: CheckDNS, host: "kubernetes.default.svc." + domain}}
+	for _, svc := range services {
+		host := fmt.Sprintf("%s.%s.svc.%s", svc.Name, namespace, domain)
+		targets = append(targets, probeTarget{kind: CheckDNS, host: host, service: svc})
+		for i, port := range tcpServicePorts(*svc) {
+			if i == maxProbePorts {
+				break
+			}
+			targets = append(targets, probeTarget{kind: CheckTCP, host: host, port: port, service: svc})
+		}
+	}
+	return targets
+}
+
+// tcpServicePorts returns the TCP port numbers of a Service from its
+// rendered ports, e.g. 80 from "80:30080->http/TCP"
+func tcpServicePorts(svc ServiceInfo) []int32 {
+	var ports []int32
+	for _, p := range svc.Ports {
+		port, rest, ok := strings.Cut(p, "->")
+		if !ok || !strings.HasSuffix(rest, "/TCP") {
+			continue
+		}
+		port, _, _ = strings.Cut(port, ":")
+		if n, err := strconv.ParseInt(port, 10, 32); err == nil {
+			ports = append(ports, int32(n))
+		}
+	}
+	return ports
+}
+
+// Markers delimiting the output of each check in the probe pod's log
+const (
+	probeBeginMarker = "@@kubehelp-check"
+	probeExitMarker  = "@@kubehelp-exit"
+)
+
+// probeScript is the shell script running the checks in order. Each check's
+// output is framed by markers so the log can be split back into results.
+func probeScript(targets []probeTarget) string {
+	var sb strings.Builder
+	for _, t := range targets {
+		sb.WriteString(fmt.Sprintf("echo %s\n", probeBeginMarker))
+		switch t.kind {
+		case CheckDNS:
+			sb.WriteString(fmt.Sprintf("nslookup '%s' 2>&1\n", t.host))
+		case CheckTCP:
+			sb.WriteString(fmt.Sprintf("nc -z -w 3 '%s' %d 2>&1\n", t.host, t.port))
+		}
+		sb.WriteString(fmt.Sprintf("echo %s $?\n", probeExitMarker))
+	}
+	return sb.String()
+}
+
+// probeOutput is the exit code and output lines of one check
+type probeOutput struct {
+	code  string
+	lines []string
+}
+
+// parseProbeOutput splits the probe pod's log into the outputs of the
+// checks, in script order
+func parseProbeOutput(output string) []probeOutput {
+	var outputs []probeOutput
+	var current *probeOutput
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == probeBeginMarker:
+			current = &probeOutput{}
+		case current == nil || line == "":
+		case strings.HasPrefix(line, probeExitMarker):
+			current.code = strings.TrimSpace(strings.TrimPrefix(line, probeExitMarker))
+			outputs = append(outputs, *current)
+			current = nil
+		default:
+			current.lines = append(current.lines, line)
+		}
+	}
+	return outputs
+}
+
+// connectivityCheck interprets the output of a check. Lookups list their
+// answers as "Address: <ip>" lines after a "Name:" line, the resolver's own
+// address coming first; one without answers failed whatever its exit code.
+func connectivityCheck(t probeTarget, out probeOutput) ConnectivityCheck {
+	check := ConnectivityCheck{Kind: t.kind, Target: t.target(), OK: out.code == "0"}
+	if t.service != nil {
+		check.Service = t.service.Name
+	}
+	if t.kind == CheckDNS {
+		answers := false
+		for _, l := range out.lines {
+			if strings.HasPrefix(l, "Name:") {
+				answers = true
+			} else if answers && strings.HasPrefix(l, "Address") {
+				if _, addr, ok := strings.Cut(l, ":"); ok {
+					check.Addresses = append(check.Addresses, strings.TrimSpace(addr))
+				}
+			}
+		}
+		check.OK = check.OK && len(check.Addresses) > 0
+	}
+	if !check.OK {
+		check.Error = probeError(out)
+	}
+	return check
+}
+
+// probeError picks the error message of a failed check: the last line
+// reporting a failure, else the exit code
+func probeError(out probeOutput) string {
+	for i := len(out.lines) - 1; i >= 0; i-- {
+		l := out.lines[i]
+		for _, prefix := range []string{"** ", ";; ", "nc: "} {
+			if strings.HasPrefix(l, prefix) {
+				return strings.TrimPrefix(l, prefix)
+			}
+		}
+	}
+	if out.code == "0" {
+		return "no address returned"
+	}
+	return "exit status " + out.code
+}
+
+// runProbePod runs script in a short-lived pod of the namespace and returns
+// its log. The pod is deleted even when the checks time out.
+func (a *Aggregator) runProbePod(ctx context.Context, namespace, script string) (string, error) {
+	pods := a.client.Clientset().CoreV1().Pods(namespace)
+	var pod *corev1.Pod
+	err := a.apiCall(ctx, "creating the probe pod", func(ctx context.Context) error {
+		var err error
+		pod, err = pods.Create(ctx, probePod(a.opts.ProbeImage, script), metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		// Clean up even when ctx was cancelled
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), a.opts.APITimeout)
+		defer cancel()
+		grace := int64(0)
+		pods.Delete(cleanupCtx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &grace})
+	}()
+
+	deadline := time.Now().Add(probeTimeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("probe pod %s did not finish within %s%s", pod.Name, probeTimeout, probePodWaiting(pod))
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+		err := a.apiCall(ctx, "getting the probe pod", func(ctx context.Context) error {
+			var err error
+			pod, err = pods.Get(ctx, pod.Name, metav1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var output []byte
+	err = a.apiCall(ctx, "reading the probe pod log", func(ctx context.Context) error {
+		var err error
+		output, err = pods.GetLogs(pod.Name, &corev1.PodLogOptions{Container: "probe"}).DoRaw(ctx)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+// probePodWaiting explains why a probe pod has not run, e.g. ": probe is
+// waiting: ImagePullBackOff"
+func probePodWaiting(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return fmt.Sprintf(": %s is waiting: %s", cs.Name, cs.State.Waiting.Reason)
+		}
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse {
+			return fmt.Sprintf(": not scheduled: %s", cond.Message)
+		}
+	}
+	return ""
+}
+
+// probePod is the spec of the probe pod. It satisfies the restricted Pod
+// Security Standard and sets requests and limits for namespaces whose
+// quotas require them.
+func probePod(image, script string) *corev1.Pod {
+	deadline := int64(probeTimeout / time.Second)
+	noToken := false
+	nonRoot := true
+	user := int64(65534)
+	noEscalation := false
+	readOnly := true
+	resources := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("50m"),
+		corev1.ResourceMemory: resource.MustParse("32Mi"),
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "kubehelp-probe-",
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "kubehelp-probe",
+				"app.kubernetes.io/managed-by": ReportingController,
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds:         &deadline,
+			AutomountServiceAccountToken:  &noToken,
+			TerminationGracePeriodSeconds: new(int64),
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   &nonRoot,
+				RunAsUser:      &user,
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			Containers: []corev1.Container{{
+				Name:    "probe",
+				Image:   image,
+				Command: []string{"sh", "-c", script},
+				SecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: &noEscalation,
+					ReadOnlyRootFilesystem:   &readOnly,
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+				Resources: corev1.ResourceRequirements{Requests: resources, Limits: resources},
+			}},
+		},
+	}
+}
+
+// checkConnectivityResults turns failed checks into findings. A failing
+// cluster DNS lookup explains every other failure, so only it is reported
+// then; connections to Services without ready endpoints are expected to
+// fail and already flagged by checkService.
+func checkConnectivityResults(namespace string, targets []probeTarget, checks []ConnectivityCheck) []Finding {
+	if len(checks) > 0 && !checks[0].OK {
+		return []Finding{{
+			Rule:     "cluster-dns-failed",
+			Severity: SeverityCritical,
+			Object:   "Namespace/" + namespace,
+			Message: fmt.Sprintf("a probe pod could not resolve %s (%s), so pods in the namespace cannot reach Services by name; check the CoreDNS pods and NetworkPolicies allowing egress to port 53",
+				checks[0].Target, checks[0].Error),
+		}}
+	}
+
+	var findings []Finding
+	unresolved := make(map[string]bool)
+	for i, check := range checks {
+		svc := targets[i].service
+		if check.OK || svc == nil {
+			continue
+		}
+		object := "Service/" + svc.Name
+		switch check.Kind {
+		case CheckDNS:
+			unresolved[svc.Name] = true
+			findings = append(findings, Finding{
+				Rule:     "service-dns-failed",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message: fmt.Sprintf("%s does not resolve from a probe pod (%s) although cluster DNS works; check that the Service exists in the namespace and CoreDNS is not serving stale data",
+					check.Target, check.Error),
+			})
+		case CheckTCP:
+			if unresolved[svc.Name] || svc.HasIssues() {
+				continue
+			}
+			findings = append(findings, Finding{
+				Rule:     "service-unreachable",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message: fmt.Sprintf("%s is not reachable from a probe pod (%s) although %d endpoints are ready; check that the targetPort matches the port the pods listen on and that NetworkPolicies allow the traffic",
+					check.Target, check.Error, svc.ReadyEndpoints),
+			})
+		}
+	}
+	return findings
+}
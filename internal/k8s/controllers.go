@@ -0,0 +1,330 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ControllerStatus summarizes the rollout state of a Deployment, ReplicaSet,
+// StatefulSet or DaemonSet. For DaemonSets replica counts are node counts.
+type ControllerStatus struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	Desired   int32  `json:"desired"`
+	Ready     int32  `json:"ready"`
+	// Updated counts replicas on the latest template; ReplicaSets have a
+	// single template and leave it unset
+	Updated   int32 `json:"updated,omitempty"`
+	Available int32 `json:"available"`
+	// Unscheduled and Misscheduled count DaemonSet nodes that should run a
+	// pod but do not, and nodes running one that should not
+	Unscheduled  int32 `json:"unscheduled,omitempty"`
+	Misscheduled int32 `json:"misscheduled,omitempty"`
+	// CurrentRevision and UpdateRevision differ while a StatefulSet rolls out
+	CurrentRevision string `json:"currentRevision,omitempty"`
+	UpdateRevision  string `json:"updateRevision,omitempty"`
+	Paused          bool   `json:"paused,omitempty"`
+	// Owner is set for ReplicaSets managed by a Deployment
+	Owner      string                `json:"owner,omitempty"`
+	Conditions []ControllerCondition `json:"conditions,omitempty"`
+	// HelmRelease names the Helm release that installed the controller
+	HelmRelease string `json:"helmRelease,omitempty"`
+}
+
+// ControllerCondition is a controller status condition such as a
+// Deployment's Progressing or Available
+type ControllerCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// HasIssues reports whether the controller has fewer ready or updated
+// replicas than desired, misplaced DaemonSet pods or a failing condition
+func (c ControllerStatus) HasIssues() bool {
+	if c.Ready < c.Desired || c.Unscheduled > 0 || c.Misscheduled > 0 {
+		return true
+	}
+	if c.Kind != "ReplicaSet" && c.Updated < c.Desired {
+		return true
+	}
+	if c.CurrentRevision != c.UpdateRevision {
+		return true
+	}
+	for _, cond := range c.Conditions {
+		if conditionFailing(cond) {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionFailing reports whether cond signals a problem: a False
+// Progressing/Available condition or a True ReplicaFailure
+func conditionFailing(cond ControllerCondition) bool {
+	if cond.Type == string(appsv1.DeploymentReplicaFailure) {
+		return cond.Status == string(corev1.ConditionTrue)
+	}
+	return cond.Status == string(corev1.ConditionFalse)
+}
+
+// collectControllers records the status of controllers. When pods are
+// filtered by workload or label selector, only the selected workloads and
+// the controllers owning the selected pods are kept. Missing RBAC for the
+// apps API group becomes a warning since pod data alone still allows a
+// diagnosis.
+func (a *Aggregator) collectControllers(ctx context.Context, namespace string, workloads []string, pods []corev1.Pod, data *DiagnosticData) error {
+	filtered := len(workloads) > 0 || a.opts.LabelSelector != ""
+	owners := make(map[string]bool)
+	for i := range pods {
+		owners[podOwner(&pods[i])] = true
+		if ref := metav1.GetControllerOf(&pods[i]); ref != nil {
+			owners[ref.Kind+"/"+ref.Name] = true
+		}
+	}
+
+	collectors := []func(context.Context, string) ([]ControllerStatus, error){
+		a.deploymentStatuses,
+		a.replicaSetStatuses,
+		a.statefulSetStatuses,
+		a.daemonSetStatuses,
+	}
+	for _, collect := range collectors {
+		statuses, err := collect(ctx, namespace)
+		if apierrors.IsForbidden(err) {
+			data.Warnings = append(data.Warnings, fmt.Sprintf("controller status not collected: %v", err))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			ref := status.Kind + "/" + status.Name
+			if !filtered || owners[ref] || owners[status.Owner] || matchesAnyWorkload(ref, workloads) {
+				data.Controllers = append(data.Controllers, status)
+			}
+		}
+	}
+	data.Findings = append(data.Findings, checkControllers(data.Controllers)...)
+	return nil
+}
+
+func (a *Aggregator) deploymentStatuses(ctx context.Context, namespace string) ([]ControllerStatus, error) {
+	items, err := listCached(ctx, a, "deployments", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+		list, err := a.client.Clientset().AppsV1().Deployments(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []ControllerStatus
+	for _, d := range items {
+		status := ControllerStatus{
+			Kind:        "Deployment",
+			Name:        d.Name,
+			Desired:     replicas(d.Spec.Replicas),
+			Ready:       d.Status.ReadyReplicas,
+			Updated:     d.Status.UpdatedReplicas,
+			Available:   d.Status.AvailableReplicas,
+			Paused:      d.Spec.Paused,
+			HelmRelease: helmReleaseName(&d.ObjectMeta),
+		}
+		for _, cond := range d.Status.Conditions {
+			status.Conditions = append(status.Conditions, ControllerCondition{
+				Type:    string(cond.Type),
+				Status:  string(cond.Status),
+				Reason:  cond.Reason,
+				Message: cond.Message,
+			})
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// replicaSetStatuses returns ReplicaSets that should run pods; scaled-down
+// revisions kept for rollback are skipped
+func (a *Aggregator) replicaSetStatuses(ctx context.Context, namespace string) ([]ControllerStatus, error) {
+	items, err := listCached(ctx, a, "replicasets", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]appsv1.ReplicaSet, string, error) {
+		list, err := a.client.Clientset().AppsV1().ReplicaSets(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []ControllerStatus
+	for _, rs := range items {
+		desired := replicas(rs.Spec.Replicas)
+		if desired == 0 {
+			continue
+		}
+		status := ControllerStatus{
+			Kind:      "ReplicaSet",
+			Name:      rs.Name,
+			Desired:   desired,
+			Ready:     rs.Status.ReadyReplicas,
+			Available: rs.Status.AvailableReplicas,
+		}
+		if ref := metav1.GetControllerOf(&rs); ref != nil {
+			status.Owner = ref.Kind + "/" + ref.Name
+		}
+		for _, cond := range rs.Status.Conditions {
+			status.Conditions = append(status.Conditions, ControllerCondition{
+				Type:    string(cond.Type),
+				Status:  string(cond.Status),
+				Reason:  cond.Reason,
+				Message: cond.Message,
+			})
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (a *Aggregator) statefulSetStatuses(ctx context.Context, namespace string) ([]ControllerStatus, error) {
+	items, err := listCached(ctx, a, "statefulsets", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]appsv1.StatefulSet, string, error) {
+		list, err := a.client.Clientset().AppsV1().StatefulSets(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []ControllerStatus
+	for _, s := range items {
+		status := ControllerStatus{
+			Kind:            "StatefulSet",
+			Name:            s.Name,
+			Desired:         replicas(s.Spec.Replicas),
+			Ready:           s.Status.ReadyReplicas,
+			Updated:         s.Status.UpdatedReplicas,
+			Available:       s.Status.AvailableReplicas,
+			CurrentRevision: s.Status.CurrentRevision,
+			UpdateRevision:  s.Status.UpdateRevision,
+			HelmRelease:     helmReleaseName(&s.ObjectMeta),
+		}
+		for _, cond := range s.Status.Conditions {
+			status.Conditions = append(status.Conditions, ControllerCondition{
+				Type:    string(cond.Type),
+				Status:  string(cond.Status),
+				Reason:  cond.Reason,
+				Message: cond.Message,
+			})
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (a *Aggregator) daemonSetStatuses(ctx context.Context, namespace string) ([]ControllerStatus, error) {
+	items, err := listCached(ctx, a, "daemonsets", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]appsv1.DaemonSet, string, error) {
+		list, err := a.client.Clientset().AppsV1().DaemonSets(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []ControllerStatus
+	for _, ds := range items {
+		status := ControllerStatus{
+			Kind:         "DaemonSet",
+			Name:         ds.Name,
+			Desired:      ds.Status.DesiredNumberScheduled,
+			Ready:        ds.Status.NumberReady,
+			Updated:      ds.Status.UpdatedNumberScheduled,
+			Available:    ds.Status.NumberAvailable,
+			Unscheduled:  ds.Status.DesiredNumberScheduled - ds.Status.CurrentNumberScheduled,
+			Misscheduled: ds.Status.NumberMisscheduled,
+			HelmRelease:  helmReleaseName(&ds.ObjectMeta),
+		}
+		for _, cond := range ds.Status.Conditions {
+			status.Conditions = append(status.Conditions, ControllerCondition{
+				Type:    string(cond.Type),
+				Status:  string(cond.Status),
+				Reason:  cond.Reason,
+				Message: cond.Message,
+			})
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// replicas returns the desired replica count; nil means the default of 1
+func replicas(n *int32) int32 {
+	if n == nil {
+		return 1
+	}
+	return *n
+}
+
+// checkControllers flags stuck rollouts, failing replicas and DaemonSet
+// pods that cannot be placed
+func checkControllers(controllers []ControllerStatus) []Finding {
+	var findings []Finding
+	for _, c := range controllers {
+		object := c.Kind + "/" + c.Name
+
+		for _, cond := range c.Conditions {
+			switch {
+			case cond.Type == string(appsv1.DeploymentProgressing) && cond.Reason == "ProgressDeadlineExceeded":
+				findings = append(findings, Finding{
+					Rule:     "rollout-stuck",
+					Severity: SeverityHigh,
+					Object:   object,
+					Message:  fmt.Sprintf("rollout exceeded its progress deadline with %d of %d replicas updated: %s", c.Updated, c.Desired, cond.Message),
+				})
+			case cond.Type == string(appsv1.DeploymentReplicaFailure) && cond.Status == string(corev1.ConditionTrue):
+				findings = append(findings, Finding{
+					Rule:     "replica-failure",
+					Severity: SeverityHigh,
+					Object:   object,
+					Message:  fmt.Sprintf("replicas cannot be created (%s): %s", cond.Reason, cond.Message),
+				})
+			}
+		}
+
+		// A Deployment already reports the replicas of its ReplicaSets
+		if c.Ready < c.Desired && !c.Paused && !strings.HasPrefix(c.Owner, "Deployment/") {
+			findings = append(findings, Finding{
+				Rule:     "replicas-unavailable",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message:  fmt.Sprintf("%d of %d desired replicas are ready", c.Ready, c.Desired),
+			})
+		}
+
+		if c.Unscheduled > 0 {
+			findings = append(findings, Finding{
+				Rule:     "daemonset-unscheduled",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message:  fmt.Sprintf("%d nodes should run a pod but have none scheduled; check taints, node selectors and resources", c.Unscheduled),
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,193 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CustomResourceInfo is the status of a custom resource managed by an
+// operator, such as an Argo CD Application or a cert-manager Certificate
+type CustomResourceInfo struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	// Resource is the resource the object was listed as, e.g.
+	// "certificates.v1.cert-manager.io"
+	Resource string `json:"resource"`
+	// Phase is .status.phase, for operators that report one
+	Phase      string                    `json:"phase,omitempty"`
+	Conditions []CustomResourceCondition `json:"conditions,omitempty"`
+}
+
+// CustomResourceCondition is an entry of .status.conditions
+type CustomResourceCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Failing reports whether the condition signals a problem: a False
+// condition such as Ready, or a True (or, as Argo CD reports them,
+// status-less) condition whose type names a failure such as Degraded,
+// Stalled or SyncError
+func (c CustomResourceCondition) Failing() bool {
+	if negativeConditionType(c.Type) {
+		return c.Status == "" || c.Status == "True"
+	}
+	return c.Status == "False"
+}
+
+// negativeConditionType reports whether a condition type describes a
+// failure rather than a healthy state
+func negativeConditionType(t string) bool {
+	switch t {
+	case "Degraded", "Stalled":
+		return true
+	}
+	for _, suffix := range []string{"Error", "Failed", "Failure"} {
+		if strings.HasSuffix(t, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasIssues reports whether a condition is failing or the phase is Failed
+// or Error
+func (r CustomResourceInfo) HasIssues() bool {
+	if r.Phase == "Failed" || r.Phase == "Error" {
+		return true
+	}
+	for _, c := range r.Conditions {
+		if c.Failing() {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCustomResource parses a resource in kubectl's resource.version.group
+// form, e.g. "applications.v1alpha1.argoproj.io"
+func ParseCustomResource(s string) (schema.GroupVersionResource, error) {
+	gvr, _ := schema.ParseResourceArg(strings.ToLower(strings.TrimSpace(s)))
+	if gvr == nil || gvr.Resource == "" || gvr.Version == "" || gvr.Group == "" {
+		return schema.GroupVersionResource{}, fmt.Errorf("invalid custom resource %q (expected resource.version.group, e.g. certificates.v1.cert-manager.io)", s)
+	}
+	return *gvr, nil
+}
+
+// ParseCustomResources parses a list of resources with ParseCustomResource
+func ParseCustomResources(list []string) ([]schema.GroupVersionResource, error) {
+	var gvrs []schema.GroupVersionResource
+	for _, s := range list {
+		gvr, err := ParseCustomResource(s)
+		if err != nil {
+			return nil, err
+		}
+		gvrs = append(gvrs, gvr)
+	}
+	return gvrs, nil
+}
+
+// customResourceName renders a resource in the form ParseCustomResource
+// accepts
+func customResourceName(gvr schema.GroupVersionResource) string {
+	return gvr.Resource + "." + gvr.Version + "." + gvr.Group
+}
+
+// collectCustomResources records the status conditions of the configured
+// custom resources in the namespace. Resources whose CRD is not installed
+// or that cannot be read become warnings.
+func (a *Aggregator) collectCustomResources(ctx context.Context, namespace string, data *DiagnosticData) error {
+	for _, gvr := range a.opts.CustomResources {
+		name := customResourceName(gvr)
+		items, err := listAll(ctx, a, gvr.Resource, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+			list, err := a.client.Dynamic().Resource(gvr).Namespace(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.GetContinue(), nil
+		})
+		switch {
+		case apierrors.IsNotFound(err):
+			data.Warnings = append(data.Warnings, fmt.Sprintf("custom resource %s not collected: not installed in the cluster or not namespaced", name))
+			continue
+		case apierrors.IsForbidden(err):
+			data.Warnings = append(data.Warnings, fmt.Sprintf("custom resource %s not collected: %v", name, err))
+			continue
+		case err != nil:
+			return fmt.Errorf("failed to list %s: %w", name, err)
+		}
+
+		for i := range items {
+			info := customResourceInfo(&items[i], name)
+			data.CustomResources = append(data.CustomResources, info)
+			data.Findings = append(data.Findings, customResourceFindings(info)...)
+		}
+	}
+	return nil
+}
+
+// customResourceInfo extracts the phase and conditions of a custom resource
+func customResourceInfo(obj *unstructured.Unstructured, resource string) CustomResourceInfo {
+	info := CustomResourceInfo{Kind: obj.GetKind(), Name: obj.GetName(), Resource: resource}
+	info.Phase, _, _ = unstructured.NestedString(obj.Object, "status", "phase")
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		info.Conditions = append(info.Conditions, CustomResourceCondition{
+			Type:    stringField(cond, "type"),
+			Status:  stringField(cond, "status"),
+			Reason:  stringField(cond, "reason"),
+			Message: stringField(cond, "message"),
+		})
+	}
+	return info
+}
+
+// customResourceFindings flags failing conditions and phases of a custom
+// resource
+func customResourceFindings(info CustomResourceInfo) []Finding {
+	object := info.Kind + "/" + info.Name
+	var findings []Finding
+	if info.Phase == "Failed" || info.Phase == "Error" {
+		findings = append(findings, Finding{
+			Rule:     "custom-resource-failed",
+			Severity: SeverityHigh,
+			Object:   object,
+			Message:  fmt.Sprintf("status.phase is %s", info.Phase),
+		})
+	}
+	for _, c := range info.Conditions {
+		if !c.Failing() {
+			continue
+		}
+		message := c.Type
+		if c.Status != "" {
+			message += "=" + c.Status
+		}
+		if c.Reason != "" {
+			message += " (" + c.Reason + ")"
+		}
+		if c.Message != "" {
+			message += ": " + c.Message
+		}
+		findings = append(findings, Finding{
+			Rule:     "custom-resource-not-ready",
+			Severity: SeverityMedium,
+			Object:   object,
+			Message:  message,
+		})
+	}
+	return findings
+}
@@ -0,0 +1,194 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"kubehelp/internal/textutil"
+
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// ReportingController identifies events created by kubehelp
+const ReportingController = "kubehelp"
+
+// ErrEventsForbidden is returned when the caller may not list or create events
+var ErrEventsForbidden = errors.New("not permitted to manage events.k8s.io events (needs list and create RBAC on events)")
+
+// ruleLabel is set on every event kubehelp creates to the rule of its finding
+const ruleLabel = "kubehelp.io/rule"
+
+// maxEventNoteBytes is the events.k8s.io limit for the note field
+const maxEventNoteBytes = 1024
+
+// EmitOptions bounds how many events a single run may create. Zero values
+// select the defaults.
+type EmitOptions struct {
+	// MaxEvents caps the events created per run (default 20)
+	MaxEvents int
+	// QPS and Burst rate-limit event creation (default 2 and 5)
+	QPS   float32
+	Burst int
+	// DedupeWindow skips findings already reported by kubehelp for the same
+	// object and reason within this window (default 1h)
+	DedupeWindow time.Duration
+}
+
+// EmitResult summarizes an EmitFindingEvents run
+type EmitResult struct {
+	Created    int
+	Duplicates int
+	Dropped    int
+}
+
+// EmitFindingEvents records findings as events.k8s.io/v1 Events attached to
+// the affected pod, or to the namespace when the object is not a pod, so that
+// "kubectl describe" shows what kubehelp flagged. Findings already reported
+// within the dedupe window are skipped and the total is capped by MaxEvents.
+func (c *Client) EmitFindingEvents(ctx context.Context, namespace string, findings []Finding, opts EmitOptions) (EmitResult, error) {
+	if opts.MaxEvents <= 0 {
+		opts.MaxEvents = 20
+	}
+	if opts.QPS <= 0 {
+		opts.QPS = 2
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = 5
+	}
+	if opts.DedupeWindow <= 0 {
+		opts.DedupeWindow = time.Hour
+	}
+
+	var result EmitResult
+	events := c.clientset.EventsV1().Events(namespace)
+
+	// Only kubehelp's own events carry the rule label, so deduplicating
+	// does not list every event of a busy namespace
+	existing, err := listAll(ctx, NewAggregator(c), "events", metav1.ListOptions{LabelSelector: ruleLabel},
+		func(ctx context.Context, listOpts metav1.ListOptions) ([]eventsv1.Event, string, error) {
+			list, err := events.List(ctx, listOpts)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		if apierrors.IsForbidden(err) {
+			return result, ErrEventsForbidden
+		}
+		return result, fmt.Errorf("failed to list events: %w", err)
+	}
+	seen := recentKubehelpEvents(existing, time.Now().Add(-opts.DedupeWindow))
+
+	instance, _ := os.Hostname()
+	limiter := flowcontrol.NewTokenBucketRateLimiter(opts.QPS, opts.Burst)
+	defer limiter.Stop()
+
+	for _, f := range findings {
+		regarding := findingReference(namespace, f.Object)
+		reason := findingReason(f.Severity)
+		key := eventKey(regarding, reason, f.Rule)
+		if seen[key] {
+			result.Duplicates++
+			continue
+		}
+		if result.Created >= opts.MaxEvents {
+			result.Dropped++
+			continue
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return result, err
+		}
+
+		event := &eventsv1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "kubehelp-",
+				Namespace:    namespace,
+				Labels:       map[string]string{ruleLabel: f.Rule},
+			},
+			EventTime:           metav1.NowMicro(),
+			ReportingController: ReportingController,
+			ReportingInstance:   instance,
+			Action:              "Diagnose",
+			Reason:              reason,
+			Type:                findingEventType(f.Severity),
+			Regarding:           regarding,
+			Note:                textutil.Truncate(fmt.Sprintf("[%s] %s: %s", f.Rule, f.Object, f.Message), maxEventNoteBytes),
+		}
+		if _, err := events.Create(ctx, event, metav1.CreateOptions{}); err != nil {
+			if apierrors.IsForbidden(err) {
+				return result, ErrEventsForbidden
+			}
+			return result, fmt.Errorf("failed to create event for %s: %w", f.Object, err)
+		}
+		seen[key] = true
+		result.Created++
+	}
+
+	return result, nil
+}
+
+// findingReference maps a finding object ("Pod/<name>/<container>") to the
+// event's regarding reference; other objects are attached to the namespace
+func findingReference(namespace, object string) corev1.ObjectReference {
+	parts := strings.SplitN(object, "/", 3)
+	if len(parts) >= 2 && parts[0] == "Pod" {
+		ref := corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  namespace,
+			Name:       parts[1],
+		}
+		if len(parts) == 3 {
+			ref.FieldPath = fmt.Sprintf("spec.containers{%s}", parts[2])
+		}
+		return ref
+	}
+	return corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Name:       namespace,
+	}
+}
+
+// findingReason maps severity to an event reason such as "KubehelpHighFinding"
+func findingReason(s Severity) string {
+	name := string(s)
+	if name == "" {
+		name = "unknown"
+	}
+	return "Kubehelp" + strings.ToUpper(name[:1]) + name[1:] + "Finding"
+}
+
+// findingEventType reports medium and more severe findings as warnings
+func findingEventType(s Severity) string {
+	if s.Rank() >= SeverityMedium.Rank() {
+		return corev1.EventTypeWarning
+	}
+	return corev1.EventTypeNormal
+}
+
+// recentKubehelpEvents indexes kubehelp events created after since
+func recentKubehelpEvents(items []eventsv1.Event, since time.Time) map[string]bool {
+	seen := make(map[string]bool)
+	for _, e := range items {
+		if e.ReportingController != ReportingController || e.EventTime.Time.Before(since) {
+			continue
+		}
+		seen[eventKey(e.Regarding, e.Reason, e.Labels[ruleLabel])] = true
+	}
+	return seen
+}
+
+func eventKey(ref corev1.ObjectReference, reason, rule string) string {
+	return strings.Join([]string{ref.Kind, ref.Name, ref.FieldPath, reason, rule}, "|")
+}
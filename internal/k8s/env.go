@@ -0,0 +1,117 @@
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"kubehelp/internal/textutil"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RedactedEnvValue replaces the value of env vars hidden by an EnvFilter
+const RedactedEnvValue = "[REDACTED]"
+
+// maxEnvValueLen truncates long literal values such as inline JSON configs
+const maxEnvValueLen = 200
+
+// DefaultEnvDenylist matches env var names whose values are never collected
+var DefaultEnvDenylist = []string{
+	"*SECRET*", "*TOKEN*", "*PASSWORD*", "*PASSWD*", "*_KEY", "*_KEY_*", "*APIKEY*",
+	"*CREDENTIAL*", "*PRIVATE*", "*DSN*", "*CONNECTION_STRING*",
+}
+
+// EnvVar is a container environment variable. Value is empty when the
+// variable comes from a reference (Source) and RedactedEnvValue when the
+// name is denied by the EnvFilter.
+type EnvVar struct {
+	Name   string `json:"name"`
+	Value  string `json:"value,omitempty"`
+	Source string `json:"source,omitempty"` // e.g. "secret db-creds/password"
+}
+
+// EnvFilter decides which env var values are collected. Names are always
+// collected. Patterns are shell globs matched case-insensitively against
+// the name, e.g. "*_TOKEN".
+type EnvFilter struct {
+	// Allow, when set, limits collected values to matching names
+	Allow []string
+	// Deny hides values of matching names even if they are allowed
+	// (default DefaultEnvDenylist)
+	Deny []string
+}
+
+// ShowValue reports whether the value of the named env var may be collected
+func (f EnvFilter) ShowValue(name string) bool {
+	deny := f.Deny
+	if deny == nil {
+		deny = DefaultEnvDenylist
+	}
+	if matchesAnyGlob(name, deny) {
+		return false
+	}
+	return len(f.Allow) == 0 || matchesAnyGlob(name, f.Allow)
+}
+
+func matchesAnyGlob(name string, patterns []string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// containerEnv collects a container's env vars and envFrom sources.
+// Values are filtered at collection time so denied values never reach
+// saved snapshots, history or the prompt.
+func containerEnv(c *corev1.Container, filter EnvFilter) ([]EnvVar, []string) {
+	var env []EnvVar
+	for _, e := range c.Env {
+		v := EnvVar{Name: e.Name}
+		switch {
+		case e.ValueFrom != nil:
+			v.Source = envSource(e.ValueFrom)
+		case !filter.ShowValue(e.Name):
+			v.Value = RedactedEnvValue
+		default:
+			v.Value = textutil.Truncate(e.Value, maxEnvValueLen)
+		}
+		env = append(env, v)
+	}
+
+	var from []string
+	for _, src := range c.EnvFrom {
+		var ref string
+		switch {
+		case src.ConfigMapRef != nil:
+			ref = "configmap " + src.ConfigMapRef.Name
+		case src.SecretRef != nil:
+			ref = "secret " + src.SecretRef.Name
+		default:
+			continue
+		}
+		if src.Prefix != "" {
+			ref += fmt.Sprintf(" (prefix %s)", src.Prefix)
+		}
+		from = append(from, ref)
+	}
+	return env, from
+}
+
+// envSource describes where a referenced value comes from, without its value
+func envSource(ref *corev1.EnvVarSource) string {
+	switch {
+	case ref.SecretKeyRef != nil:
+		return fmt.Sprintf("secret %s/%s", ref.SecretKeyRef.Name, ref.SecretKeyRef.Key)
+	case ref.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("configmap %s/%s", ref.ConfigMapKeyRef.Name, ref.ConfigMapKeyRef.Key)
+	case ref.FieldRef != nil:
+		return "field " + ref.FieldRef.FieldPath
+	case ref.ResourceFieldRef != nil:
+		return "resource " + ref.ResourceFieldRef.Resource
+	}
+	return "reference"
+}
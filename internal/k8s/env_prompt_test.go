@@ -0,0 +1,76 @@
+package k8s_test
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/llm"
+)
+
+// TestPromptOmitsDeniedEnvValues collects a crashing pod with env
+// collection on and checks that no denied value reaches the prompt
+func TestPromptOmitsDeniedEnvValues(t *testing.T) {
+	denied := map[string]string{
+		"DB_PASSWORD":   "hunter2-db",
+		"GITHUB_TOKEN":  "ghp-0123456789",
+		"SENTRY_DSN":    "https://abc@sentry.example.com/1",
+		"DATABASE_URL":  "postgres://app:s3cret@db:5432/app",
+		"STRIPE_KEY":    "sk_live_abcdef",
+		"api_secret_id": "lowercase-secret",
+	}
+	tests := []struct {
+		name   string
+		filter k8s.EnvFilter
+		shown  map[string]string
+	}{
+		{"default denylist", k8s.EnvFilter{}, map[string]string{"LOG_LEVEL": "debug", "DATABASE_URL": denied["DATABASE_URL"]}},
+		{"allow override", k8s.EnvFilter{Allow: []string{"LOG_*"}}, map[string]string{"LOG_LEVEL": "debug"}},
+		{"deny override", k8s.EnvFilter{Deny: []string{"*PASSWORD*", "*TOKEN*", "*DSN*", "*_URL", "*_KEY", "*SECRET*"}}, map[string]string{"LOG_LEVEL": "debug"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}}
+			for name, value := range denied {
+				env = append(env, corev1.EnvVar{Name: name, Value: value})
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "api-1", Namespace: "default"},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Env: env}}},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodRunning,
+					ContainerStatuses: []corev1.ContainerStatus{{
+						Name:         "app",
+						RestartCount: 5,
+						State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					}},
+				},
+			}
+			info := k8s.PodInfoOf(pod, k8s.AggregatorOptions{CollectEnv: true, EnvFilter: tt.filter})
+			prompt := llm.BuildDiagnosticPromptWithOptions(&k8s.DiagnosticData{Namespace: "default", Pods: []k8s.PodInfo{info}}, llm.PromptOptions{DetailLevel: llm.DetailAll})
+
+			if !strings.Contains(prompt, "- Env: ") {
+				t.Fatalf("prompt has no env line:\n%s", prompt)
+			}
+			for name, value := range denied {
+				if shown, ok := tt.shown[name]; ok && shown == value {
+					continue
+				}
+				if strings.Contains(prompt, value) {
+					t.Errorf("prompt contains the denied value of %s", name)
+				}
+				if !strings.Contains(prompt, name+"="+k8s.RedactedEnvValue) {
+					t.Errorf("prompt does not list %s as redacted", name)
+				}
+			}
+			for name, value := range tt.shown {
+				if !strings.Contains(prompt, name+"="+value) {
+					t.Errorf("prompt does not show the allowed value of %s", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package k8s
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestEnvFilterShowValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter EnvFilter
+		env    string
+		want   bool
+	}{
+		{"default denies passwords", EnvFilter{}, "DB_PASSWORD", false},
+		{"default denies tokens", EnvFilter{}, "GITHUB_TOKEN", false},
+		{"default denies secrets", EnvFilter{}, "AWS_SECRET_ACCESS_KEY", false},
+		{"default denies a _KEY suffix", EnvFilter{}, "STRIPE_KEY", false},
+		{"default denies a _KEY_ infix", EnvFilter{}, "SIGNING_KEY_ID", false},
+		{"default denies API keys", EnvFilter{}, "OPENAI_APIKEY", false},
+		{"default denies credentials", EnvFilter{}, "GOOGLE_APPLICATION_CREDENTIALS", false},
+		{"default denies private", EnvFilter{}, "TLS_PRIVATE_PEM", false},
+		{"default denies DSNs", EnvFilter{}, "SENTRY_DSN", false},
+		{"default denies connection strings", EnvFilter{}, "AZURE_STORAGE_CONNECTION_STRING", false},
+		{"default denies passwd", EnvFilter{}, "MYSQL_PASSWD", false},
+		{"default matches case-insensitively", EnvFilter{}, "db_password", false},
+		{"default shows other names", EnvFilter{}, "LOG_LEVEL", true},
+		{"default shows KEYCLOAK_URL", EnvFilter{}, "KEYCLOAK_URL", true},
+		{"allow limits values", EnvFilter{Allow: []string{"LOG_*"}}, "DATABASE_HOST", false},
+		{"allow shows matches", EnvFilter{Allow: []string{"LOG_*"}}, "LOG_LEVEL", true},
+		{"allow matches case-insensitively", EnvFilter{Allow: []string{"log_*"}}, "LOG_LEVEL", true},
+		{"default deny beats allow", EnvFilter{Allow: []string{"*"}}, "API_TOKEN", false},
+		{"custom deny replaces the default", EnvFilter{Deny: []string{"*_URL"}}, "API_TOKEN", true},
+		{"custom deny hides matches", EnvFilter{Deny: []string{"*_URL"}}, "DATABASE_URL", false},
+		{"custom deny beats allow", EnvFilter{Allow: []string{"DATABASE_*"}, Deny: []string{"*_URL"}}, "DATABASE_URL", false},
+		{"empty deny shows everything", EnvFilter{Deny: []string{}}, "DB_PASSWORD", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.ShowValue(tt.env); got != tt.want {
+				t.Errorf("ShowValue(%q) with %+v = %v, want %v", tt.env, tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerEnv(t *testing.T) {
+	c := &corev1.Container{
+		Env: []corev1.EnvVar{
+			{Name: "LOG_LEVEL", Value: "debug"},
+			{Name: "DB_PASSWORD", Value: "hunter2"},
+			{Name: "API_TOKEN", ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "api"}, Key: "token"},
+			}},
+			{Name: "POD_IP", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"}}},
+			{Name: "CONFIG_JSON", Value: strings.Repeat("x", maxEnvValueLen+50)},
+			// The cut before the ellipsis falls inside a three-byte rune
+			{Name: "GREETING_JSON", Value: `{"ja":"` + strings.Repeat("こんにちは", 20) + `"}`},
+		},
+		EnvFrom: []corev1.EnvFromSource{
+			{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app-config"}}},
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app-secrets"}}, Prefix: "APP_"},
+		},
+	}
+
+	env, from := containerEnv(c, EnvFilter{})
+	want := []EnvVar{
+		{Name: "LOG_LEVEL", Value: "debug"},
+		{Name: "DB_PASSWORD", Value: RedactedEnvValue},
+		{Name: "API_TOKEN", Source: "secret api/token"},
+		{Name: "POD_IP", Source: "field status.podIP"},
+		{Name: "CONFIG_JSON", Value: strings.Repeat("x", maxEnvValueLen-3) + "..."},
+		{Name: "GREETING_JSON", Value: `{"ja":"` + strings.Repeat("こんにちは", 12) + "こんに..."},
+	}
+	if !slices.Equal(env, want) {
+		t.Errorf("env = %+v, want %+v", env, want)
+	}
+	for _, v := range env {
+		if !utf8.ValidString(v.Value) || len(v.Value) > maxEnvValueLen {
+			t.Errorf("%s = %q is not valid UTF-8 of at most %d bytes", v.Name, v.Value, maxEnvValueLen)
+		}
+	}
+	if want := []string{"configmap app-config", "secret app-secrets (prefix APP_)"}; !slices.Equal(from, want) {
+		t.Errorf("envFrom = %v, want %v", from, want)
+	}
+
+	// An allowlist redacts every other literal value
+	env, _ = containerEnv(c, EnvFilter{Allow: []string{"CONFIG_*"}})
+	if env[0].Value != RedactedEnvValue {
+		t.Errorf("LOG_LEVEL = %q outside the allowlist, want %q", env[0].Value, RedactedEnvValue)
+	}
+	if env[2].Source != "secret api/token" {
+		t.Errorf("API_TOKEN source = %q, want the secret reference", env[2].Source)
+	}
+}
@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultEventsSince is how far back warning events are collected by
+// default. It matches the apiserver's default --event-ttl, so older events
+// are usually gone anyway.
+const DefaultEventsSince = time.Hour
+
+// listEvents lists the events of a namespace from the events.k8s.io/v1 API,
+// which carries series of repeated events, converted to core/v1 events so
+// the rules read one type. Clusters without that API (before 1.19) or
+// credentials only allowed to read core/v1 events fall back to the core API.
+func (a *Aggregator) listEvents(ctx context.Context, namespace string) ([]corev1.Event, error) {
+	// An informer cache holds either API's events
+	if events, ok := cachedList[corev1.Event](a, "events", namespace, ""); ok {
+		return events, nil
+	}
+	items, cached := cachedList[eventsv1.Event](a, "events.events.k8s.io", namespace, "")
+	if !cached {
+		var err error
+		items, err = listAll(ctx, a, "events", metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("regarding.namespace=%s", namespace),
+		}, func(ctx context.Context, opts metav1.ListOptions) ([]eventsv1.Event, string, error) {
+			list, err := a.client.Clientset().EventsV1().Events(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+		if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+			debugf("events.k8s.io/v1 not usable (%v), listing core/v1 events", err)
+			return listAll(ctx, a, "events", metav1.ListOptions{
+				FieldSelector: fmt.Sprintf("involvedObject.namespace=%s", namespace),
+			}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Event, string, error) {
+				list, err := a.client.Clientset().CoreV1().Events(namespace).List(ctx, opts)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	events := make([]corev1.Event, 0, len(items))
+	for i := range items {
+		events = append(events, coreEvent(&items[i]))
+	}
+	return events, nil
+}
+
+// coreEvent converts an events.k8s.io/v1 event to core/v1. Events reported
+// through the new API only set EventTime and, once repeated, a Series with
+// the count and last occurrence; these are folded into Count and the
+// timestamps the way the apiserver does for core/v1 clients, so a crash
+// loop counts all its occurrences rather than one.
+func coreEvent(e *eventsv1.Event) corev1.Event {
+	event := corev1.Event{
+		ObjectMeta:          e.ObjectMeta,
+		InvolvedObject:      e.Regarding,
+		Reason:              e.Reason,
+		Message:             e.Note,
+		Source:              e.DeprecatedSource,
+		FirstTimestamp:      e.DeprecatedFirstTimestamp,
+		LastTimestamp:       e.DeprecatedLastTimestamp,
+		Count:               e.DeprecatedCount,
+		Type:                e.Type,
+		EventTime:           e.EventTime,
+		Action:              e.Action,
+		Related:             e.Related,
+		ReportingController: e.ReportingController,
+		ReportingInstance:   e.ReportingInstance,
+	}
+	if e.Series != nil {
+		event.Series = &corev1.EventSeries{
+			Count:            e.Series.Count,
+			LastObservedTime: e.Series.LastObservedTime,
+		}
+		event.Count = max(event.Count, e.Series.Count)
+		if last := e.Series.LastObservedTime.Time; last.After(event.LastTimestamp.Time) {
+			event.LastTimestamp = metav1.NewTime(last)
+		}
+	}
+	if event.FirstTimestamp.IsZero() {
+		event.FirstTimestamp = metav1.NewTime(e.EventTime.Time)
+	}
+	if event.LastTimestamp.IsZero() {
+		event.LastTimestamp = metav1.NewTime(e.EventTime.Time)
+	}
+	if event.Count == 0 {
+		event.Count = 1
+	}
+	return event
+}
+
+// eventCount returns how often an event occurred, counting the occurrences
+// of its series
+func eventCount(e corev1.Event) int32 {
+	count := e.Count
+	if e.Series != nil {
+		count = max(count, e.Series.Count)
+	}
+	return max(count, 1)
+}
@@ -0,0 +1,114 @@
+package k8s
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// podReasonEvicted is the pod status reason set by the kubelet on eviction
+const podReasonEvicted = "Evicted"
+
+// Patterns for the eviction messages written by the kubelet
+var (
+	// "The node was low on resource: ephemeral-storage. Threshold quantity: 1Gi, available: 512Mi."
+	evictionNodeLowRe   = regexp.MustCompile(`low on resource: ([\w.-]+)\.`)
+	evictionThresholdRe = regexp.MustCompile(`Threshold quantity: ([^,]+), available: (\S+?)\.(?:\s|$)`)
+	// "Container app was using 2Gi, request is 0, has larger consumption of ephemeral-storage."
+	evictionContainerRe = regexp.MustCompile(`Container ([\w.-]+) was using ([^,]+), request is ([^,]+),`)
+	// "Pod ephemeral local storage usage exceeds the total limit of containers 1Gi."
+	evictionPodLimitRe = regexp.MustCompile(`exceeds the total limit of containers (\S+?)\.?(?:\s|$)`)
+	// "Container app exceeded its local ephemeral storage limit "1Gi"."
+	evictionContainerLimitRe = regexp.MustCompile(`Container ([\w.-]+) exceeded its local ephemeral storage limit "([^"]+)"`)
+	// "Usage of EmptyDir volume "data" exceeds the limit "1Gi"."
+	evictionEmptyDirRe = regexp.MustCompile(`EmptyDir volume "([^"]+)" exceeds the limit "([^"]+)"`)
+)
+
+// eviction is the cause of a pod eviction parsed from the status message
+type eviction struct {
+	Resource  string // e.g. "memory", "ephemeral-storage", "nodefs"
+	Cause     string // human-readable cause
+	Container string // container using the most of Resource, if reported
+}
+
+// checkEvictions flags pods evicted by the kubelet with the resource and
+// threshold that caused the eviction. Evicted pods linger in the Failed
+// phase; without the cause they read as unexplained failures.
+func checkEvictions(pods []PodInfo) []Finding {
+	var findings []Finding
+	for _, pod := range pods {
+		if pod.Reason != podReasonEvicted {
+			continue
+		}
+
+		ev := parseEviction(pod.Message)
+		object := "Pod/" + pod.Name
+		if ev.Container != "" {
+			object += "/" + ev.Container
+		}
+		message := "evicted: " + ev.Cause
+		if hint := evictionHint(ev.Resource); hint != "" {
+			message += "; " + hint
+		}
+
+		findings = append(findings, Finding{
+			Rule:     "pod-evicted",
+			Severity: SeverityMedium,
+			Object:   object,
+			Message:  message,
+		})
+	}
+	return findings
+}
+
+// parseEviction extracts the resource and threshold from a kubelet eviction
+// message, falling back to the message itself for unknown formats
+func parseEviction(message string) eviction {
+	var ev eviction
+
+	switch {
+	case evictionContainerLimitRe.MatchString(message):
+		m := evictionContainerLimitRe.FindStringSubmatch(message)
+		ev.Resource = "ephemeral-storage"
+		ev.Container = m[1]
+		ev.Cause = fmt.Sprintf("container %s exceeded its ephemeral-storage limit of %s", m[1], m[2])
+	case evictionEmptyDirRe.MatchString(message):
+		m := evictionEmptyDirRe.FindStringSubmatch(message)
+		ev.Resource = "ephemeral-storage"
+		ev.Cause = fmt.Sprintf("emptyDir volume %s exceeded its sizeLimit of %s", m[1], m[2])
+	case evictionPodLimitRe.MatchString(message):
+		m := evictionPodLimitRe.FindStringSubmatch(message)
+		ev.Resource = "ephemeral-storage"
+		ev.Cause = fmt.Sprintf("pod ephemeral-storage usage exceeded the containers' total limit of %s", m[1])
+	case evictionNodeLowRe.MatchString(message):
+		ev.Resource = evictionNodeLowRe.FindStringSubmatch(message)[1]
+		ev.Cause = fmt.Sprintf("node was low on %s", ev.Resource)
+		if m := evictionThresholdRe.FindStringSubmatch(message); m != nil {
+			ev.Cause += fmt.Sprintf(" (eviction threshold %s, available %s)", m[1], m[2])
+		}
+		if m := evictionContainerRe.FindStringSubmatch(message); m != nil {
+			ev.Container = m[1]
+			ev.Cause += fmt.Sprintf("; container %s was using %s with a request of %s", m[1], m[2], m[3])
+		}
+	default:
+		ev.Cause = strings.TrimSpace(message)
+		if ev.Cause == "" {
+			ev.Cause = "no eviction message recorded"
+		}
+	}
+
+	return ev
+}
+
+// evictionHint suggests where to look for the given evicted resource
+func evictionHint(resource string) string {
+	switch resource {
+	case "memory":
+		return "set the memory request close to actual usage so the pod is not the first evicted, or add node memory"
+	case "ephemeral-storage", "nodefs", "imagefs":
+		return "set ephemeral-storage requests/limits, reduce log, emptyDir and temp file usage, or add node disk"
+	case "pids":
+		return "check for process or thread leaks and set pod PID limits"
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckEvictions(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		object  string
+		want    []string
+	}{
+		{
+			name:    "node low on ephemeral-storage",
+			message: "The node was low on resource: ephemeral-storage. Threshold quantity: 1Gi, available: 512Mi. Container app was using 2Gi, request is 0, has larger consumption of ephemeral-storage.",
+			object:  "Pod/api-1/app",
+			want: []string{
+				"evicted: node was low on ephemeral-storage (eviction threshold 1Gi, available 512Mi)",
+				"container app was using 2Gi with a request of 0",
+				"set ephemeral-storage requests/limits",
+			},
+		},
+		{
+			name:    "node low on memory",
+			message: "The node was low on resource: memory. Threshold quantity: 100Mi, available: 82344Ki. Container worker was using 1532100Ki, request is 256Mi, has larger consumption of memory.",
+			object:  "Pod/api-1/worker",
+			want: []string{
+				"node was low on memory (eviction threshold 100Mi, available 82344Ki)",
+				"container worker was using 1532100Ki with a request of 256Mi",
+				"set the memory request close to actual usage",
+			},
+		},
+		{
+			name:    "node low on nodefs",
+			message: "The node was low on resource: nodefs. Threshold quantity: 10%, available: 4Gi.",
+			object:  "Pod/api-1",
+			want: []string{
+				"node was low on nodefs (eviction threshold 10%, available 4Gi)",
+				"add node disk",
+			},
+		},
+		{
+			name:    "container ephemeral-storage limit",
+			message: `Pod ephemeral local storage usage exceeds the total limit of containers 1Gi. Container app exceeded its local ephemeral storage limit "1Gi".`,
+			object:  "Pod/api-1/app",
+			want:    []string{"container app exceeded its ephemeral-storage limit of 1Gi"},
+		},
+		{
+			name:    "emptyDir sizeLimit",
+			message: `Usage of EmptyDir volume "cache" exceeds the limit "500Mi".`,
+			object:  "Pod/api-1",
+			want:    []string{"emptyDir volume cache exceeded its sizeLimit of 500Mi"},
+		},
+		{
+			name:    "pod ephemeral-storage limit",
+			message: "Pod ephemeral local storage usage exceeds the total limit of containers 2Gi.",
+			object:  "Pod/api-1",
+			want:    []string{"pod ephemeral-storage usage exceeded the containers' total limit of 2Gi"},
+		},
+		{
+			name:    "unknown message",
+			message: "Pod was evicted by a custom controller",
+			object:  "Pod/api-1",
+			want:    []string{"evicted: Pod was evicted by a custom controller"},
+		},
+		{
+			name:   "no message",
+			object: "Pod/api-1",
+			want:   []string{"evicted: no eviction message recorded"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pods := []PodInfo{{Name: "api-1", Phase: "Failed", Reason: podReasonEvicted, Message: tt.message}}
+			findings := checkEvictions(pods)
+			if len(findings) != 1 {
+				t.Fatalf("got %d findings, want 1: %+v", len(findings), findings)
+			}
+			f := findings[0]
+			if f.Rule != "pod-evicted" || f.Severity != SeverityMedium {
+				t.Errorf("rule/severity = %s/%s, want pod-evicted/%s", f.Rule, f.Severity, SeverityMedium)
+			}
+			if f.Object != tt.object {
+				t.Errorf("Object = %q, want %q", f.Object, tt.object)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(f.Message, want) {
+					t.Errorf("Message = %q, want it to contain %q", f.Message, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckEvictionsSkipsOtherPods(t *testing.T) {
+	pods := []PodInfo{
+		{Name: "running", Phase: "Running"},
+		{Name: "failed", Phase: "Failed", Reason: "Error", Message: "The node was low on resource: memory."},
+	}
+	if findings := checkEvictions(pods); len(findings) != 0 {
+		t.Errorf("got findings for pods that were not evicted: %+v", findings)
+	}
+}
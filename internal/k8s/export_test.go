@@ -0,0 +1,9 @@
+package k8s
+
+import corev1 "k8s.io/api/core/v1"
+
+// PodInfoOf converts pod as an aggregator with opts collects it
+func PodInfoOf(pod *corev1.Pod, opts AggregatorOptions) PodInfo {
+	a := &Aggregator{opts: opts}
+	return a.extractPodInfo(pod)
+}
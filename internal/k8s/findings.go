@@ -0,0 +1,147 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Severity ranks how urgent a finding is
+type Severity string
+
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// Rank orders severities from low (1) to critical (4); unknown values rank 0
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityLow:
+		return 1
+	case SeverityMedium:
+		return 2
+	case SeverityHigh:
+		return 3
+	case SeverityCritical:
+		return 4
+	}
+	return 0
+}
+
+// Finding is a deterministic observation about the collected resources
+type Finding struct {
+	Rule     string   `json:"rule"` // stable identifier, e.g. "missing-limits"
+	Severity Severity `json:"severity"`
+	Object   string   `json:"object"` // e.g. "Pod/api-7d8f9b/app"
+	Message  string   `json:"message"`
+	// Namespace is set when collected cluster-wide
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// SortFindings orders findings by descending severity, then by object
+func SortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if ri, rj := findings[i].Severity.Rank(), findings[j].Severity.Rank(); ri != rj {
+			return ri > rj
+		}
+		return findings[i].Object < findings[j].Object
+	})
+}
+
+// checkBestPractices flags containers without resource requests/limits,
+// using mutable image tags, or running privileged or as root
+func checkBestPractices(pod *corev1.Pod) []Finding {
+	var findings []Finding
+
+	for _, c := range pod.Spec.Containers {
+		object := fmt.Sprintf("Pod/%s/%s", pod.Name, c.Name)
+
+		if missing := missingResources(c.Resources.Limits); len(missing) > 0 {
+			findings = append(findings, Finding{
+				Rule:     "missing-limits",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message:  fmt.Sprintf("no %s limit set; an unbounded container can exhaust node resources and trigger OOM kills", strings.Join(missing, "/")),
+			})
+		}
+		if missing := missingResources(c.Resources.Requests); len(missing) > 0 {
+			findings = append(findings, Finding{
+				Rule:     "missing-requests",
+				Severity: SeverityLow,
+				Object:   object,
+				Message:  fmt.Sprintf("no %s request set; the scheduler cannot place the pod reliably", strings.Join(missing, "/")),
+			})
+		}
+
+		if tag := imageTag(c.Image); tag == "" || tag == "latest" {
+			findings = append(findings, Finding{
+				Rule:     "latest-image-tag",
+				Severity: SeverityLow,
+				Object:   object,
+				Message:  fmt.Sprintf("image %q uses a mutable tag; pin a version or digest for reproducible rollouts", c.Image),
+			})
+		}
+
+		if sc := c.SecurityContext; sc != nil && sc.Privileged != nil && *sc.Privileged {
+			findings = append(findings, Finding{
+				Rule:     "privileged-container",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message:  "container runs privileged with full access to the host",
+			})
+		}
+
+		if runsAsRoot(pod, &c) {
+			findings = append(findings, Finding{
+				Rule:     "runs-as-root",
+				Severity: SeverityLow,
+				Object:   object,
+				Message:  "container explicitly runs as UID 0 (root)",
+			})
+		}
+	}
+
+	return findings
+}
+
+// missingResources returns which of cpu/memory are absent from the list
+func missingResources(list corev1.ResourceList) []string {
+	var missing []string
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if _, ok := list[name]; !ok {
+			missing = append(missing, string(name))
+		}
+	}
+	return missing
+}
+
+// imageTag returns the tag of an image reference, or "" when it has none.
+// Digest-pinned images return the digest.
+func imageTag(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	// A colon after the last slash separates the tag; earlier colons are registry ports
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// runsAsRoot reports whether the container is explicitly configured to run
+// as UID 0, honoring the container-level override of the pod setting
+func runsAsRoot(pod *corev1.Pod, c *corev1.Container) bool {
+	if c.SecurityContext != nil && c.SecurityContext.RunAsUser != nil {
+		return *c.SecurityContext.RunAsUser == 0
+	}
+	if psc := pod.Spec.SecurityContext; psc != nil && psc.RunAsUser != nil {
+		return *psc.RunAsUser == 0
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+package k8s
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// Labels and annotations Helm 3 sets on the objects it installs
+const (
+	helmReleaseNameAnnotation = "meta.helm.sh/release-name"
+	helmManagedByLabel        = "app.kubernetes.io/managed-by"
+	helmInstanceLabel         = "app.kubernetes.io/instance"
+)
+
+// maxHelmRevisions bounds the revisions kept per release, like
+// "helm history --max"
+const maxHelmRevisions = 5
+
+// RecentHelmUpgradeWindow is how recently a release must have been
+// upgraded for broken controllers to be blamed on the upgrade
+const RecentHelmUpgradeWindow = 24 * time.Hour
+
+// Helm release statuses
+const (
+	HelmStatusDeployed   = "deployed"
+	HelmStatusSuperseded = "superseded"
+	HelmStatusFailed     = "failed"
+)
+
+// HelmRelease describes a Helm release managing collected controllers, read
+// from the release Secrets Helm stores its history in. Chart values and
+// manifests are never kept, as they may hold credentials.
+type HelmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	// Controllers lists the collected controllers the release manages, e.g.
+	// "Deployment/api"
+	Controllers []string `json:"controllers,omitempty"`
+	// Revisions holds the latest revisions, newest (the current one) first
+	Revisions []HelmRevision `json:"revisions"`
+}
+
+// HelmRevision is one entry of a release's history
+type HelmRevision struct {
+	Revision   int       `json:"revision"`
+	Status     string    `json:"status"`               // e.g. "deployed", "failed", "pending-upgrade"
+	Chart      string    `json:"chart"`                // name-version, e.g. "api-1.4.2"
+	AppVersion string    `json:"appVersion,omitempty"` // e.g. "2.3.0"
+	Updated    time.Time `json:"updated,omitempty"`
+	// Description is Helm's summary, e.g. "Upgrade complete" or the error
+	// of a failed upgrade
+	Description string `json:"description,omitempty"`
+}
+
+// Current returns the latest revision of the release
+func (r HelmRelease) Current() HelmRevision {
+	if len(r.Revisions) == 0 {
+		return HelmRevision{}
+	}
+	return r.Revisions[0]
+}
+
+// RollbackTarget returns the newest earlier revision that was successfully
+// deployed, the one "helm rollback" should return to
+func (r HelmRelease) RollbackTarget() (HelmRevision, bool) {
+	for _, rev := range r.Revisions[min(1, len(r.Revisions)):] {
+		if rev.Status == HelmStatusSuperseded || rev.Status == HelmStatusDeployed {
+			return rev, true
+		}
+	}
+	return HelmRevision{}, false
+}
+
+// HasIssues reports whether the current revision is not deployed, e.g.
+// failed or stuck pending
+func (r HelmRelease) HasIssues() bool {
+	return len(r.Revisions) > 0 && r.Current().Status != HelmStatusDeployed
+}
+
+// helmReleaseName returns the Helm release that installed an object, or ""
+func helmReleaseName(meta *metav1.ObjectMeta) string {
+	if name := meta.Annotations[helmReleaseNameAnnotation]; name != "" {
+		return name
+	}
+	if meta.Labels[helmManagedByLabel] == "Helm" {
+		return meta.Labels[helmInstanceLabel]
+	}
+	return ""
+}
+
+// collectHelmReleases reads the history of the Helm releases that installed
+// the collected controllers. Releases rendered with "helm template", as
+// GitOps tools do, carry the labels but have no release Secrets and are
+// skipped. Missing RBAC becomes a warning.
+func (a *Aggregator) collectHelmReleases(ctx context.Context, namespace string, data *DiagnosticData) error {
+	controllers := make(map[string][]string)
+	var names []string
+	for _, c := range data.Controllers {
+		if c.HelmRelease == "" {
+			continue
+		}
+		if _, ok := controllers[c.HelmRelease]; !ok {
+			names = append(names, c.HelmRelease)
+		}
+		controllers[c.HelmRelease] = append(controllers[c.HelmRelease], c.Kind+"/"+c.Name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	selector := fmt.Sprintf("owner=helm,name in (%s)", strings.Join(names, ","))
+	items, err := listAll(ctx, a, "secrets", metav1.ListOptions{LabelSelector: selector}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Secret, string, error) {
+		list, err := a.client.Clientset().CoreV1().Secrets(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("Helm release history not collected: %v", err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only the latest revisions of each release are decoded
+	sort.Slice(items, func(i, j int) bool {
+		return helmSecretVersion(&items[i]) > helmSecretVersion(&items[j])
+	})
+	releases := make(map[string]*HelmRelease)
+	for i := range items {
+		secret := &items[i]
+		name := secret.Labels["name"]
+		release, ok := releases[name]
+		if !ok {
+			release = &HelmRelease{Name: name, Controllers: controllers[name]}
+			releases[name] = release
+		}
+		if len(release.Revisions) == maxHelmRevisions {
+			continue
+		}
+		rev, err := decodeHelmRevision(secret.Data["release"])
+		if err != nil {
+			data.Warnings = append(data.Warnings, fmt.Sprintf("Helm release Secret %s not decoded: %v", secret.Name, err))
+			continue
+		}
+		release.Revisions = append(release.Revisions, rev)
+	}
+	for _, name := range names {
+		if release, ok := releases[name]; ok && len(release.Revisions) > 0 {
+			data.HelmReleases = append(data.HelmReleases, *release)
+		}
+	}
+	data.Findings = append(data.Findings, checkHelmReleases(data.HelmReleases, data.Controllers, namespace, data.CollectedAt)...)
+	return nil
+}
+
+// helmSecretVersion returns the revision a release Secret stores, from its
+// "version" label
+func helmSecretVersion(secret *corev1.Secret) int {
+	version, _ := strconv.Atoi(secret.Labels["version"])
+	return version
+}
+
+// helmReleaseRecord is the part of Helm's stored release that is kept
+type helmReleaseRecord struct {
+	Version int `json:"version"`
+	Info    struct {
+		// Helm writes an empty string for unset times, which time.Time
+		// cannot decode
+		LastDeployed string `json:"last_deployed"`
+		Status       string `json:"status"`
+		Description  string `json:"description"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+	} `json:"chart"`
+}
+
+// decodeHelmRevision decodes the "release" key of a Helm release Secret:
+// base64-encoded, usually gzipped JSON
+func decodeHelmRevision(encoded []byte) (HelmRevision, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return HelmRevision{}, fmt.Errorf("invalid base64: %w", err)
+	}
+	if bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return HelmRevision{}, fmt.Errorf("invalid gzip: %w", err)
+		}
+		defer zr.Close()
+		if raw, err = io.ReadAll(zr); err != nil {
+			return HelmRevision{}, fmt.Errorf("invalid gzip: %w", err)
+		}
+	}
+
+	var record helmReleaseRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return HelmRevision{}, fmt.Errorf("invalid release JSON: %w", err)
+	}
+	rev := HelmRevision{
+		Revision:    record.Version,
+		Status:      record.Info.Status,
+		Chart:       record.Chart.Metadata.Name + "-" + record.Chart.Metadata.Version,
+		AppVersion:  record.Chart.Metadata.AppVersion,
+		Description: record.Info.Description,
+	}
+	rev.Updated, _ = time.Parse(time.RFC3339Nano, record.Info.LastDeployed)
+	return rev, nil
+}
+
+// checkHelmReleases flags failed and stuck releases, and controllers broken
+// since a recent upgrade of their release, naming the revision to roll back
+// to
+func checkHelmReleases(releases []HelmRelease, controllers []ControllerStatus, namespace string, now time.Time) []Finding {
+	var findings []Finding
+	for _, r := range releases {
+		current := r.Current()
+		object := "HelmRelease/" + r.Name
+		rollback := ""
+		if target, ok := r.RollbackTarget(); ok {
+			rollback = fmt.Sprintf("; \"helm rollback %s %d -n %s\" restores revision %d (%s)", r.Name, target.Revision, namespace, target.Revision, target.Chart)
+		}
+
+		switch {
+		case current.Status == HelmStatusFailed:
+			findings = append(findings, Finding{
+				Rule:     "helm-release-failed",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  fmt.Sprintf("revision %d (%s) failed: %s%s", current.Revision, current.Chart, current.Description, rollback),
+			})
+			continue
+		case strings.HasPrefix(current.Status, "pending-"):
+			findings = append(findings, Finding{
+				Rule:     "helm-release-pending",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message: fmt.Sprintf("revision %d (%s) is stuck in %s; until it is rolled back, upgrades fail with \"another operation is in progress\"%s",
+					current.Revision, current.Chart, current.Status, rollback),
+			})
+			continue
+		}
+
+		if current.Revision <= 1 || current.Updated.IsZero() || now.Sub(current.Updated) > RecentHelmUpgradeWindow {
+			continue
+		}
+		var broken []string
+		for _, c := range controllers {
+			if c.HelmRelease == r.Name && c.HasIssues() {
+				broken = append(broken, c.Kind+"/"+c.Name)
+			}
+		}
+		if len(broken) == 0 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:     "helm-upgrade-broke-workload",
+			Severity: SeverityHigh,
+			Object:   object,
+			Message: fmt.Sprintf("%s unhealthy and revision %d (%s) was deployed %s ago%s",
+				strings.Join(broken, ", "), current.Revision, current.Chart, duration.HumanDuration(now.Sub(current.Updated)), rollback),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,340 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"kubehelp/internal/textutil"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Annotations and labels binding a ServiceAccount to a cloud identity
+const (
+	annotationIRSARole      = "eks.amazonaws.com/role-arn"
+	annotationGKEServiceAcc = "iam.gke.io/gcp-service-account"
+	annotationAzureClientID = "azure.workload.identity/client-id"
+	labelAzureUse           = "azure.workload.identity/use"
+	labelAADPodIdentity     = "aadpodidbinding"
+)
+
+// Cloud identity providers of an IdentityInfo
+const (
+	ProviderIRSA             = "aws-irsa"
+	ProviderEKSPodIdentity   = "aws-pod-identity"
+	ProviderGKEWorkloadID    = "gke-workload-identity"
+	ProviderAzureWorkloadID  = "azure-workload-identity"
+	ProviderAzurePodIdentity = "azure-pod-identity"
+)
+
+// maxIdentityEvidence bounds the credential error lines kept per
+// ServiceAccount
+const maxIdentityEvidence = 3
+
+// maxEvidenceLineLen truncates the log lines kept as evidence
+const maxEvidenceLineLen = 200
+
+var (
+	roleARNPattern         = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/\S+$`)
+	gcpServiceAccountEmail = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.iam\.gserviceaccount\.com$`)
+	azureClientIDPattern   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// credentialErrorPattern matches the errors cloud SDKs report when a
+	// workload has no credentials or its identity lacks a permission
+	credentialErrorPattern = regexp.MustCompile(`(?i)(AccessDenied|not authorized to perform|WebIdentityErr|InvalidIdentityToken|NoCredentialProviders|UnrecognizedClientException|no EC2 IMDS role found|failed to refresh cached credentials|could not find default credentials|PERMISSION_DENIED|iam\.serviceAccounts\.getAccessToken|Unable to generate access token|DefaultAzureCredential|ManagedIdentityCredential|WorkloadIdentityCredential|AADSTS\d+|AuthorizationFailed|AuthorizationPermissionMismatch)`)
+	// tokenPathPattern matches errors reading the Kubernetes service
+	// account token
+	tokenPathPattern = regexp.MustCompile(`/var/run/secrets/kubernetes\.io/serviceaccount`)
+)
+
+// IdentityInfo describes the cloud identity of a ServiceAccount used by
+// failing pods: the IRSA role, GKE or Azure workload identity it is bound
+// to, misconfigurations of that binding, and the credential errors the pods
+// report. Only ServiceAccounts with an identity, a problem or credential
+// errors are collected.
+type IdentityInfo struct {
+	ServiceAccount string   `json:"serviceAccount"`
+	Namespace      string   `json:"namespace,omitempty"`
+	Pods           []string `json:"pods"`
+	// Provider is one of the Provider constants, or empty when the pods use
+	// no workload identity and fall back to node credentials
+	Provider string `json:"provider,omitempty"`
+	// Identity is the IAM role ARN, Google service account email or Azure
+	// client ID
+	Identity string `json:"identity,omitempty"`
+	// TokenAutomountDisabled is set when the pods get no Kubernetes service
+	// account token
+	TokenAutomountDisabled bool     `json:"tokenAutomountDisabled,omitempty"`
+	Problems               []string `json:"problems,omitempty"`
+	// Evidence holds credential errors from container messages and logs
+	Evidence []string `json:"evidence,omitempty"`
+}
+
+// collectIdentities checks the ServiceAccounts of unhealthy pods for cloud
+// identity bindings and their misconfigurations. It runs after logs are
+// collected so their credential errors count as evidence. Missing RBAC for
+// reading ServiceAccounts becomes a warning.
+func (a *Aggregator) collectIdentities(ctx context.Context, pods []corev1.Pod, data *DiagnosticData) error {
+	// PodInfo.Namespace is only set when collecting cluster-wide
+	unhealthy := make(map[string]*PodInfo)
+	for i := range data.Pods {
+		if data.Pods[i].Unhealthy() {
+			unhealthy[Qualify(data.Pods[i].Namespace, data.Pods[i].Name)] = &data.Pods[i]
+		}
+	}
+
+	type account struct {
+		namespace, name string
+		pods            []*corev1.Pod
+	}
+	var accounts []*account
+	byName := make(map[string]*account)
+	for i := range pods {
+		pod := &pods[i]
+		if unhealthy[pod.Name] == nil && unhealthy[pod.Namespace+"/"+pod.Name] == nil {
+			continue
+		}
+		name := pod.Spec.ServiceAccountName
+		if name == "" {
+			name = "default"
+		}
+		key := pod.Namespace + "/" + name
+		if byName[key] == nil {
+			byName[key] = &account{namespace: pod.Namespace, name: name}
+			accounts = append(accounts, byName[key])
+		}
+		byName[key].pods = append(byName[key].pods, pod)
+	}
+
+	for _, acc := range accounts {
+		var sa *corev1.ServiceAccount
+		err := a.apiCall(ctx, "getting ServiceAccount "+acc.name, func(ctx context.Context) error {
+			var err error
+			sa, err = a.client.Clientset().CoreV1().ServiceAccounts(acc.namespace).Get(ctx, acc.name, metav1.GetOptions{})
+			return err
+		})
+		switch {
+		case apierrors.IsForbidden(err):
+			data.Warnings = append(data.Warnings, fmt.Sprintf("ServiceAccount cloud identities not checked: %v", err))
+			return nil
+		case apierrors.IsNotFound(err):
+			sa = &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: acc.name, Namespace: acc.namespace}}
+		case err != nil:
+			return err
+		}
+
+		var names, messages []string
+		for _, pod := range acc.pods {
+			names = append(names, pod.Name)
+			info := unhealthy[pod.Name]
+			if info == nil {
+				info = unhealthy[pod.Namespace+"/"+pod.Name]
+			}
+			messages = append(messages, podMessages(*info)...)
+			for _, l := range data.Logs {
+				if l.Pod == pod.Name && (l.Namespace == "" || l.Namespace == pod.Namespace) {
+					messages = append(messages, l.Lines...)
+				}
+			}
+		}
+
+		info := serviceAccountIdentity(sa, acc.pods, messages)
+		if info.Provider == "" && len(info.Problems) == 0 && len(info.Evidence) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		info.Pods = names
+		data.Identities = append(data.Identities, info)
+		data.Findings = append(data.Findings, checkIdentity(info)...)
+	}
+	return nil
+}
+
+// podMessages returns the status messages of a pod's containers, which
+// hold the termination message or last log lines of crashed containers
+func podMessages(pod PodInfo) []string {
+	messages := []string{pod.Message}
+	for _, statuses := range [][]ContainerStatus{pod.ContainerStatuses, pod.InitContainerStatuses} {
+		for _, cs := range statuses {
+			messages = append(messages, strings.Split(cs.Message, "\n")...)
+		}
+	}
+	return messages
+}
+
+// serviceAccountIdentity detects the cloud identity of a ServiceAccount
+// from its annotations and the pods using it, and checks that the pods
+// were mutated to use it. messages are searched for credential errors.
+func serviceAccountIdentity(sa *corev1.ServiceAccount, pods []*corev1.Pod, messages []string) IdentityInfo {
+	info := IdentityInfo{ServiceAccount: sa.Name, Namespace: sa.Namespace}
+	automount := true
+	if sa.AutomountServiceAccountToken != nil {
+		automount = *sa.AutomountServiceAccountToken
+	}
+	for _, pod := range pods {
+		if pod.Spec.AutomountServiceAccountToken != nil {
+			automount = *pod.Spec.AutomountServiceAccountToken
+		}
+	}
+	info.TokenAutomountDisabled = !automount
+
+	tokenMissing := false
+	for _, m := range messages {
+		if len(info.Evidence) == maxIdentityEvidence {
+			break
+		}
+		m = textutil.Truncate(strings.TrimSpace(m), maxEvidenceLineLen)
+		missingToken := !automount && tokenPathPattern.MatchString(m)
+		if m == "" || !(missingToken || credentialErrorPattern.MatchString(m)) || slices.Contains(info.Evidence, m) {
+			continue
+		}
+		info.Evidence = append(info.Evidence, m)
+		tokenMissing = tokenMissing || missingToken
+	}
+	if tokenMissing {
+		info.Problems = append(info.Problems, "automountServiceAccountToken is false but the app reads the service account token; set it to true or mount a projected token volume")
+	}
+
+	// The env of the first pod stands for all; pods of one ServiceAccount
+	// are usually replicas
+	pod := pods[0]
+	env := podEnv(pod)
+	roleARN := sa.Annotations[annotationIRSARole]
+	gsa := sa.Annotations[annotationGKEServiceAcc]
+	clientID := sa.Annotations[annotationAzureClientID]
+	azureUse := pod.Labels[labelAzureUse] == "true"
+
+	switch {
+	case roleARN != "":
+		info.Provider, info.Identity = ProviderIRSA, roleARN
+		if !roleARNPattern.MatchString(roleARN) {
+			info.Problems = append(info.Problems, fmt.Sprintf("annotation %s is not an IAM role ARN like arn:aws:iam::123456789012:role/name", annotationIRSARole))
+		}
+		switch podRole, ok := env["AWS_ROLE_ARN"]; {
+		case !ok:
+			info.Problems = append(info.Problems, "the pods have no AWS_ROLE_ARN or AWS_WEB_IDENTITY_TOKEN_FILE: they predate the annotation or the EKS Pod Identity Webhook did not mutate them; restart them and check the webhook")
+		case podRole != "" && podRole != roleARN:
+			info.Problems = append(info.Problems, fmt.Sprintf("the pods still assume %s; restart them to pick up the annotated role", podRole))
+		}
+		if _, ok := env["AWS_ACCESS_KEY_ID"]; ok {
+			info.Problems = append(info.Problems, "AWS_ACCESS_KEY_ID is set in the pods and takes precedence over the IRSA role in the AWS SDKs")
+		}
+	case env["AWS_CONTAINER_CREDENTIALS_FULL_URI"] != "" && strings.Contains(env["AWS_CONTAINER_CREDENTIALS_FULL_URI"], "169.254.170.23"):
+		info.Provider = ProviderEKSPodIdentity
+	case gsa != "":
+		info.Provider, info.Identity = ProviderGKEWorkloadID, gsa
+		if !gcpServiceAccountEmail.MatchString(gsa) {
+			info.Problems = append(info.Problems, fmt.Sprintf("annotation %s is not a Google service account email like name@project.iam.gserviceaccount.com", annotationGKEServiceAcc))
+		}
+		if pod.Spec.HostNetwork {
+			info.Problems = append(info.Problems, "the pods use hostNetwork, which GKE Workload Identity does not support; they get the node's credentials")
+		}
+		if _, ok := env["GOOGLE_APPLICATION_CREDENTIALS"]; ok {
+			info.Problems = append(info.Problems, "GOOGLE_APPLICATION_CREDENTIALS is set in the pods and takes precedence over Workload Identity")
+		}
+	case clientID != "" || azureUse:
+		info.Provider, info.Identity = ProviderAzureWorkloadID, clientID
+		if info.Identity == "" {
+			info.Identity = env["AZURE_CLIENT_ID"]
+		}
+		switch {
+		case !azureUse:
+			info.Problems = append(info.Problems, fmt.Sprintf("the ServiceAccount has %s but the pods lack the label %s=true, so the webhook injects no federated token", annotationAzureClientID, labelAzureUse))
+		case info.Identity == "":
+			info.Problems = append(info.Problems, fmt.Sprintf("the pods are labeled %s=true but neither the annotation %s nor AZURE_CLIENT_ID names the identity", labelAzureUse, annotationAzureClientID))
+		}
+		if azureUse {
+			if _, ok := env["AZURE_FEDERATED_TOKEN_FILE"]; !ok {
+				info.Problems = append(info.Problems, "the pods have no AZURE_FEDERATED_TOKEN_FILE: they predate the label or the Azure Workload Identity webhook did not mutate them; restart them and check the webhook")
+			}
+		}
+		if clientID != "" && !azureClientIDPattern.MatchString(clientID) {
+			info.Problems = append(info.Problems, fmt.Sprintf("annotation %s is not a client ID (GUID)", annotationAzureClientID))
+		}
+	case pod.Labels[labelAADPodIdentity] != "":
+		info.Provider, info.Identity = ProviderAzurePodIdentity, pod.Labels[labelAADPodIdentity]
+		info.Problems = append(info.Problems, "AAD Pod Identity is deprecated and its NMI pods must run on the node; migrate to Azure Workload Identity")
+	}
+	return info
+}
+
+// podEnv returns the literal env vars of the containers of a pod; values
+// set from Secrets or fields are empty
+func podEnv(pod *corev1.Pod) map[string]string {
+	env := make(map[string]string)
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			for _, e := range c.Env {
+				env[e.Name] = e.Value
+			}
+		}
+	}
+	return env
+}
+
+// identityHint tells where to look when an identity lacks a permission
+func identityHint(info IdentityInfo) string {
+	subject := fmt.Sprintf("system:serviceaccount:%s:%s", info.Namespace, info.ServiceAccount)
+	switch info.Provider {
+	case ProviderIRSA:
+		return fmt.Sprintf("check that the trust policy of %s allows sts:AssumeRoleWithWebIdentity for %s through the cluster's OIDC provider, and that its permission policies allow the denied action", info.Identity, subject)
+	case ProviderEKSPodIdentity:
+		return "check the EKS Pod Identity association of the ServiceAccount, that the eks-pod-identity-agent runs on the node, and the role's permission policies"
+	case ProviderGKEWorkloadID:
+		return fmt.Sprintf("check that %s grants roles/iam.workloadIdentityUser to serviceAccount:PROJECT_ID.svc.id.goog[%s/%s], that the node pool runs the GKE metadata server, and the roles of the Google service account", info.Identity, info.Namespace, info.ServiceAccount)
+	case ProviderAzureWorkloadID:
+		return fmt.Sprintf("check that the managed identity or app %s has a federated credential for subject %s with the cluster's OIDC issuer, and its role assignments", info.Identity, subject)
+	case ProviderAzurePodIdentity:
+		return "check the AzureIdentity and AzureIdentityBinding of the pod's aadpodidbinding label and the NMI pods"
+	}
+	return "the pods use no workload identity (IRSA, EKS Pod Identity, GKE or Azure Workload Identity) and fall back to the node's credentials; bind the ServiceAccount to a cloud identity with the needed permissions"
+}
+
+// checkIdentity flags misconfigured identity bindings and credential errors
+// of the pods of a ServiceAccount
+func checkIdentity(info IdentityInfo) []Finding {
+	object := "ServiceAccount/" + info.ServiceAccount
+	if len(info.Problems) > 0 {
+		return []Finding{{
+			Rule:     "workload-identity-misconfigured",
+			Severity: SeverityHigh,
+			Object:   object,
+			Message:  fmt.Sprintf("pods %s (%s): %s", formatNames(info.Pods), identityLabel(info), strings.Join(info.Problems, "; ")),
+		}}
+	}
+	if len(info.Evidence) > 0 {
+		return []Finding{{
+			Rule:     "cloud-credentials-error",
+			Severity: SeverityHigh,
+			Object:   object,
+			Message:  fmt.Sprintf("pods %s report credential errors (%s); %s", formatNames(info.Pods), info.Evidence[0], identityHint(info)),
+		}}
+	}
+	return nil
+}
+
+// identityLabel describes the cloud identity of a ServiceAccount, e.g.
+// "aws-irsa arn:aws:iam::123456789012:role/api"
+func identityLabel(info IdentityInfo) string {
+	switch {
+	case info.Provider == "":
+		return "no cloud identity"
+	case info.Identity == "":
+		return info.Provider
+	}
+	return info.Provider + " " + info.Identity
+}
+
+// formatNames lists up to three names, counting the rest
+func formatNames(names []string) string {
+	if len(names) <= 3 {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:3], ", "), len(names)-3)
+}
@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkImageDrift flags workloads whose replicas run different images for
+// the same container, which means a rollout is in progress or stuck
+func checkImageDrift(pods []PodInfo) []Finding {
+	// owner -> container -> image -> pod count
+	images := make(map[string]map[string]map[string]int)
+	for _, pod := range pods {
+		if pod.Owner == "" {
+			continue
+		}
+		for _, cs := range pod.ContainerStatuses {
+			if cs.Image == "" {
+				continue
+			}
+			if images[pod.Owner] == nil {
+				images[pod.Owner] = make(map[string]map[string]int)
+			}
+			if images[pod.Owner][cs.Name] == nil {
+				images[pod.Owner][cs.Name] = make(map[string]int)
+			}
+			images[pod.Owner][cs.Name][normalizeImage(cs.Image)]++
+		}
+	}
+
+	owners := make([]string, 0, len(images))
+	for owner := range images {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	var findings []Finding
+	for _, owner := range owners {
+		containers := make([]string, 0, len(images[owner]))
+		for name := range images[owner] {
+			containers = append(containers, name)
+		}
+		sort.Strings(containers)
+
+		for _, container := range containers {
+			counts := images[owner][container]
+			if len(counts) < 2 {
+				continue
+			}
+			findings = append(findings, Finding{
+				Rule:     "image-drift",
+				Severity: SeverityMedium,
+				Object:   owner + "/" + container,
+				Message: fmt.Sprintf("workload %s has %s — rollout in progress or stuck",
+					owner[strings.Index(owner, "/")+1:], describeImageCounts(counts)),
+			})
+		}
+	}
+	return findings
+}
+
+// describeImageCounts renders image counts most common first, e.g.
+// "2 pods on v1.3 and 1 pod on v1.2". Tags are shown alone when all images
+// share a repository.
+func describeImageCounts(counts map[string]int) string {
+	images := make([]string, 0, len(counts))
+	for image := range counts {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if counts[images[i]] != counts[images[j]] {
+			return counts[images[i]] > counts[images[j]]
+		}
+		return images[i] < images[j]
+	})
+
+	sameRepo := true
+	for _, image := range images[1:] {
+		if imageRepository(image) != imageRepository(images[0]) {
+			sameRepo = false
+		}
+	}
+
+	parts := make([]string, 0, len(images))
+	for _, image := range images {
+		label := image
+		if tag := imageTag(image); sameRepo && tag != "" {
+			label = tag
+		}
+		noun := "pods"
+		if counts[image] == 1 {
+			noun = "pod"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s on %s", counts[image], noun, label))
+	}
+
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+// normalizeImage drops the implicit Docker Hub registry so that "nginx:1.25"
+// from a pending pod's spec matches "docker.io/library/nginx:1.25" reported
+// by the runtime
+func normalizeImage(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	return strings.TrimPrefix(image, "library/")
+}
+
+// imageRepository returns image without its tag or digest
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i]
+	}
+	slash := strings.LastIndex(image, "/")
+	if i := strings.LastIndex(image, ":"); i > slash {
+		return image[:i]
+	}
+	return image
+}
@@ -0,0 +1,378 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxPullEvents bounds the pull events kept per container, newest first
+const maxPullEvents = 5
+
+// imagePullReasons are the waiting reasons of containers whose image cannot
+// be pulled
+var imagePullReasons = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// IsImagePullFailure reports whether a container waiting reason means its
+// image cannot be pulled
+func IsImagePullFailure(reason string) bool {
+	return imagePullReasons[reason]
+}
+
+// ImagePullInfo details a container whose image cannot be pulled, to tell a
+// typo in the reference from a missing pull secret or expired registry
+// credentials
+type ImagePullInfo struct {
+	// Registry, Repository, Tag and Digest are parsed from the image
+	// reference; references without a registry come from docker.io
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	// PullPolicy is the container's imagePullPolicy
+	PullPolicy string `json:"pullPolicy,omitempty"`
+	// PullSecrets are the pod's imagePullSecrets, then those its service
+	// account gained after the pod was created
+	PullSecrets []PullSecretInfo `json:"pullSecrets,omitempty"`
+	// Events are the kubelet's recent pull events for the image, newest
+	// first, with the node that reported them
+	Events []PullEvent `json:"events,omitempty"`
+}
+
+// PullSecretInfo describes an image pull secret without its credentials
+type PullSecretInfo struct {
+	Name string `json:"name"`
+	// Source is "pod" for spec.imagePullSecrets, or the service account
+	// whose secret the pod does not use until it is recreated
+	Source string `json:"source"`
+	// Missing is set when the secret does not exist
+	Missing bool `json:"missing,omitempty"`
+	// Unreadable is set when RBAC does not allow reading the secret
+	Unreadable bool   `json:"unreadable,omitempty"`
+	Type       string `json:"type,omitempty"`
+	// Registries are the registry hosts the secret has credentials for
+	Registries []string `json:"registries,omitempty"`
+	// MatchesRegistry is set when one of Registries is the image's registry
+	MatchesRegistry bool `json:"matchesRegistry"`
+	// UpdatedAt is the last write to the secret, to spot stale short-lived
+	// tokens such as ECR's, which expire after 12 hours
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+}
+
+// PullEvent is a kubelet event about pulling an image
+type PullEvent struct {
+	Reason        string    `json:"reason"`
+	Message       string    `json:"message"`
+	Node          string    `json:"node,omitempty"`
+	Count         int32     `json:"count,omitempty"`
+	LastTimestamp time.Time `json:"lastTimestamp"`
+}
+
+// ImageRegistry returns the registry host of an image reference;
+// references without one, e.g. "nginx:1.27", come from Docker Hub
+func ImageRegistry(image string) string {
+	first, _, ok := strings.Cut(image, "/")
+	if !ok || !(strings.ContainsAny(first, ".:") || first == "localhost") {
+		return "docker.io"
+	}
+	return normalizeRegistry(first)
+}
+
+// normalizeRegistry reduces a registry host or docker config key, e.g.
+// "https://index.docker.io/v1/", to its host, with Docker Hub's aliases
+// folded into docker.io
+func normalizeRegistry(registry string) string {
+	registry = strings.ToLower(registry)
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	registry, _, _ = strings.Cut(registry, "/")
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return "docker.io"
+	}
+	return registry
+}
+
+// parseImage splits an image reference into its registry, repository, tag
+// and digest. Without a tag or digest the runtime pulls "latest".
+func parseImage(image string) ImagePullInfo {
+	info := ImagePullInfo{Registry: ImageRegistry(image)}
+	rest := image
+	if first, after, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		rest = after
+	}
+	rest, info.Digest, _ = strings.Cut(rest, "@")
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		rest, info.Tag = rest[:i], rest[i+1:]
+	}
+	if info.Registry == "docker.io" && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+	info.Repository = rest
+	if info.Tag == "" && info.Digest == "" {
+		info.Tag = "latest"
+	}
+	return info
+}
+
+// collectImagePulls details the containers whose image cannot be pulled:
+// the parsed reference, the pull secrets available to the pod with the
+// registries they hold credentials for, and the kubelet's pull events.
+// Missing RBAC for reading Secrets or ServiceAccounts becomes a warning.
+func (a *Aggregator) collectImagePulls(ctx context.Context, pods []corev1.Pod, events []corev1.Event, data *DiagnosticData) (int, error) {
+	// PodInfo.Namespace is only set when collecting cluster-wide
+	specs := make(map[string]*corev1.Pod, 2*len(pods))
+	for i := range pods {
+		specs[pods[i].Name] = &pods[i]
+		specs[pods[i].Namespace+"/"+pods[i].Name] = &pods[i]
+	}
+
+	secrets := make(map[string]*PullSecretInfo)
+	serviceAccounts := make(map[string]*corev1.ServiceAccount)
+	forbidden := make(map[string]bool)
+	count := 0
+	for i := range data.Pods {
+		pod := &data.Pods[i]
+		key := pod.Name
+		if pod.Namespace != "" {
+			key = pod.Namespace + "/" + pod.Name
+		}
+		spec := specs[key]
+		if spec == nil {
+			continue
+		}
+		for _, statuses := range [][]ContainerStatus{pod.ContainerStatuses, pod.InitContainerStatuses, pod.EphemeralContainerStatuses} {
+			for j := range statuses {
+				cs := &statuses[j]
+				if !IsImagePullFailure(cs.Reason) {
+					continue
+				}
+				info := parseImage(cs.Image)
+				info.PullPolicy = string(containerPullPolicy(spec, cs.Name))
+				info.Events = pullEvents(events, spec, cs.Image)
+
+				pullSecrets, err := a.podPullSecrets(ctx, spec, secrets, serviceAccounts, forbidden, data)
+				if err != nil {
+					return count, err
+				}
+				for _, secret := range pullSecrets {
+					secret.MatchesRegistry = false
+					for _, registry := range secret.Registries {
+						if registry == info.Registry {
+							secret.MatchesRegistry = true
+						}
+					}
+					info.PullSecrets = append(info.PullSecrets, secret)
+				}
+				cs.ImagePull = &info
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// podPullSecrets returns the pull secrets of a pod, followed by those its
+// service account has but the pod lacks, reading each secret once
+func (a *Aggregator) podPullSecrets(ctx context.Context, pod *corev1.Pod, secrets map[string]*PullSecretInfo,
+	serviceAccounts map[string]*corev1.ServiceAccount, forbidden map[string]bool, data *DiagnosticData) ([]PullSecretInfo, error) {
+	type ref struct{ name, source string }
+	var refs []ref
+	used := make(map[string]bool)
+	for _, s := range pod.Spec.ImagePullSecrets {
+		refs = append(refs, ref{s.Name, "pod"})
+		used[s.Name] = true
+	}
+
+	namespace := pod.Namespace
+	saName := pod.Spec.ServiceAccountName
+	if saName == "" {
+		saName = "default"
+	}
+	sa, ok := serviceAccounts[namespace+"/"+saName]
+	if !ok && !forbidden["ServiceAccount"] {
+		err := a.apiCall(ctx, "getting ServiceAccount "+saName, func(ctx context.Context) error {
+			var err error
+			sa, err = a.client.Clientset().CoreV1().ServiceAccounts(namespace).Get(ctx, saName, metav1.GetOptions{})
+			return err
+		})
+		switch {
+		case apierrors.IsForbidden(err):
+			forbidden["ServiceAccount"] = true
+			data.Warnings = append(data.Warnings, fmt.Sprintf("ServiceAccount pull secrets not checked: %v", err))
+			sa = nil
+		case apierrors.IsNotFound(err):
+			sa = nil
+		case err != nil:
+			return nil, err
+		}
+		serviceAccounts[namespace+"/"+saName] = sa
+	}
+	if sa != nil {
+		for _, s := range sa.ImagePullSecrets {
+			if !used[s.Name] {
+				refs = append(refs, ref{s.Name, "ServiceAccount/" + saName})
+				used[s.Name] = true
+			}
+		}
+	}
+
+	var out []PullSecretInfo
+	for _, r := range refs {
+		secret, ok := secrets[namespace+"/"+r.name]
+		if !ok {
+			var err error
+			secret, err = a.pullSecret(ctx, namespace, r.name, forbidden, data)
+			if err != nil {
+				return nil, err
+			}
+			secrets[namespace+"/"+r.name] = secret
+		}
+		info := *secret
+		info.Source = r.source
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// pullSecret reads the registries a pull secret has credentials for
+func (a *Aggregator) pullSecret(ctx context.Context, namespace, name string, forbidden map[string]bool, data *DiagnosticData) (*PullSecretInfo, error) {
+	info := &PullSecretInfo{Name: name}
+	if forbidden["Secret"] {
+		info.Unreadable = true
+		return info, nil
+	}
+
+	var secret *corev1.Secret
+	err := a.apiCall(ctx, "getting Secret "+name, func(ctx context.Context) error {
+		var err error
+		secret, err = a.client.Clientset().CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	switch {
+	case apierrors.IsForbidden(err):
+		forbidden["Secret"] = true
+		data.Warnings = append(data.Warnings, fmt.Sprintf("image pull secrets not checked: %v", err))
+		info.Unreadable = true
+		return info, nil
+	case apierrors.IsNotFound(err):
+		info.Missing = true
+		return info, nil
+	case err != nil:
+		return nil, err
+	}
+
+	info.Type = string(secret.Type)
+	info.Registries = dockerConfigRegistries(secret)
+	info.UpdatedAt = secret.CreationTimestamp.Time
+	for _, entry := range secret.ManagedFields {
+		if entry.Time != nil && entry.Time.After(info.UpdatedAt) {
+			info.UpdatedAt = entry.Time.Time
+		}
+	}
+	return info, nil
+}
+
+// dockerConfigRegistries returns the registries of a kubernetes.io/dockerconfigjson
+// or kubernetes.io/dockercfg secret, sorted; other secrets hold none
+func dockerConfigRegistries(secret *corev1.Secret) []string {
+	var auths map[string]json.RawMessage
+	switch secret.Type {
+	case corev1.SecretTypeDockerConfigJson:
+		var config struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config) != nil {
+			return nil
+		}
+		auths = config.Auths
+	case corev1.SecretTypeDockercfg:
+		if json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths) != nil {
+			return nil
+		}
+	}
+
+	seen := make(map[string]bool)
+	var registries []string
+	for key := range auths {
+		if registry := normalizeRegistry(key); !seen[registry] {
+			seen[registry] = true
+			registries = append(registries, registry)
+		}
+	}
+	sort.Strings(registries)
+	return registries
+}
+
+// containerPullPolicy returns the imagePullPolicy of the named container,
+// init container or ephemeral container
+func containerPullPolicy(pod *corev1.Pod, name string) corev1.PullPolicy {
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for _, c := range containers {
+			if c.Name == name {
+				return c.ImagePullPolicy
+			}
+		}
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		if c.Name == name {
+			return c.ImagePullPolicy
+		}
+	}
+	return ""
+}
+
+// pullEvents returns the kubelet's recent events about pulling image for
+// pod, newest first. Back-off events are kept too since they name the image.
+func pullEvents(events []corev1.Event, pod *corev1.Pod, image string) []PullEvent {
+	var out []PullEvent
+	for _, e := range events {
+		if e.InvolvedObject.Kind != "Pod" || e.InvolvedObject.Name != pod.Name {
+			continue
+		}
+		switch e.Reason {
+		case "Pulling", "Pulled", "Failed", "BackOff", "ErrImageNeverPull", "InspectFailed":
+		default:
+			continue
+		}
+		if !strings.Contains(e.Message, image) {
+			continue
+		}
+		node := e.Source.Host
+		if node == "" {
+			node = e.ReportingInstance
+		}
+		if node == "" {
+			node = pod.Spec.NodeName
+		}
+		last := e.LastTimestamp.Time
+		if last.IsZero() {
+			last = e.EventTime.Time
+		}
+		out = append(out, PullEvent{
+			Reason:        e.Reason,
+			Message:       e.Message,
+			Node:          node,
+			Count:         e.Count,
+			LastTimestamp: last,
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].LastTimestamp.After(out[j].LastTimestamp)
+	})
+	if len(out) > maxPullEvents {
+		out = out[:maxPullEvents]
+	}
+	return out
+}
@@ -0,0 +1,232 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultResync is how often an InformerCache re-lists what it watches, as
+// a safety net for missed watch events
+const DefaultResync = 10 * time.Minute
+
+// Snapshot serves the objects the Aggregator collects from a local copy of
+// the cluster state instead of LIST requests, so repeated diagnoses do not
+// load the apiserver. Resources a Snapshot does not hold are listed from
+// the API as usual.
+type Snapshot interface {
+	// List returns copies of the objects of resource, named like the
+	// listAll resources ("pods", "events.events.k8s.io", ...), in namespace
+	// (metav1.NamespaceAll: all namespaces) whose labels match selector.
+	// ok is false when the resource is not cached or not synced yet.
+	List(resource, namespace string, selector labels.Selector) (objects []runtime.Object, ok bool)
+}
+
+// informerResources are the resources an InformerCache can watch, keyed by
+// their Snapshot name. Secrets, custom resources and metrics are always
+// listed: they are sensitive, unbounded or not watchable.
+var informerResources = map[string]schema.GroupVersionResource{
+	"pods":                   corev1.SchemeGroupVersion.WithResource("pods"),
+	"events":                 corev1.SchemeGroupVersion.WithResource("events"),
+	"events.events.k8s.io":   eventsv1.SchemeGroupVersion.WithResource("events"),
+	"namespaces":             corev1.SchemeGroupVersion.WithResource("namespaces"),
+	"nodes":                  corev1.SchemeGroupVersion.WithResource("nodes"),
+	"services":               corev1.SchemeGroupVersion.WithResource("services"),
+	"persistentvolumeclaims": corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims"),
+	"resourcequotas":         corev1.SchemeGroupVersion.WithResource("resourcequotas"),
+	"limitranges":            corev1.SchemeGroupVersion.WithResource("limitranges"),
+	"deployments":            appsv1.SchemeGroupVersion.WithResource("deployments"),
+	"replicasets":            appsv1.SchemeGroupVersion.WithResource("replicasets"),
+	"statefulsets":           appsv1.SchemeGroupVersion.WithResource("statefulsets"),
+	"daemonsets":             appsv1.SchemeGroupVersion.WithResource("daemonsets"),
+	"endpointslices":         discoveryv1.SchemeGroupVersion.WithResource("endpointslices"),
+	"networkpolicies":        networkingv1.SchemeGroupVersion.WithResource("networkpolicies"),
+	"ingresses":              networkingv1.SchemeGroupVersion.WithResource("ingresses"),
+	"ingressclasses":         networkingv1.SchemeGroupVersion.WithResource("ingressclasses"),
+	"storageclasses":         storagev1.SchemeGroupVersion.WithResource("storageclasses"),
+}
+
+// InformerCache is a Snapshot of one cluster kept current by shared
+// informers over all namespaces. Its client should have no request timeout,
+// which would end the watch connections.
+type InformerCache struct {
+	client    *Client
+	factory   informers.SharedInformerFactory
+	informers map[string]cache.SharedIndexInformer
+}
+
+// NewInformerCache creates an informer cache of the cluster of client that
+// re-lists every resync (0: DefaultResync). Call Start to fill it.
+func NewInformerCache(client *Client, resync time.Duration) *InformerCache {
+	if resync <= 0 {
+		resync = DefaultResync
+	}
+	return &InformerCache{
+		client:    client,
+		factory:   informers.NewSharedInformerFactory(client.clientset, resync),
+		informers: make(map[string]cache.SharedIndexInformer),
+	}
+}
+
+// Start watches the resources the client may list and watch in all
+// namespaces and returns the others, which the Aggregator keeps listing.
+// Core events are only watched when the events.k8s.io API is not. Start does
+// not wait for the initial lists; resources are served once synced. The
+// informers stop with ctx.
+func (c *InformerCache) Start(ctx context.Context) (skipped []string, err error) {
+	var names []string
+	var perms []Permission
+	for name, gvr := range informerResources {
+		names = append(names, name)
+		perms = append(perms,
+			Permission{Verb: "list", Group: gvr.Group, Resource: gvr.Resource},
+			Permission{Verb: "watch", Group: gvr.Group, Resource: gvr.Resource})
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, DefaultAPITimeout)
+	defer cancel()
+	checks, err := c.client.CheckPermissions(checkCtx, perms)
+	if err != nil {
+		return nil, err
+	}
+	granted := make(map[Permission]bool)
+	for _, check := range checks {
+		granted[check.Permission] = check.Allowed
+	}
+	slices.Sort(names)
+
+	// Resources such as events.k8s.io or IngressClasses are missing on
+	// older clusters
+	served := make(map[string]bool)
+	allowed := func(gvr schema.GroupVersionResource) bool {
+		groupVersion := gvr.GroupVersion().String()
+		if _, checked := served[groupVersion]; !checked {
+			_, err := c.client.clientset.Discovery().ServerResourcesForGroupVersion(groupVersion)
+			served[groupVersion] = err == nil
+		}
+		return served[groupVersion] &&
+			granted[Permission{Verb: "list", Group: gvr.Group, Resource: gvr.Resource}] &&
+			granted[Permission{Verb: "watch", Group: gvr.Group, Resource: gvr.Resource}]
+	}
+	eventsV1 := allowed(informerResources["events.events.k8s.io"])
+
+	for _, name := range names {
+		gvr := informerResources[name]
+		if name == "events" && eventsV1 {
+			// The same events are watched through events.k8s.io
+			continue
+		}
+		if !allowed(gvr) {
+			skipped = append(skipped, name)
+			continue
+		}
+		informer, err := c.factory.ForResource(gvr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watch %s: %w", name, err)
+		}
+		c.informers[name] = informer.Informer()
+	}
+	c.factory.Start(ctx.Done())
+	go func() {
+		<-ctx.Done()
+		c.factory.Shutdown()
+	}()
+	return skipped, nil
+}
+
+// WaitForSync blocks until every watched resource is synced or ctx is done,
+// and reports whether all are
+func (c *InformerCache) WaitForSync(ctx context.Context) bool {
+	synced := make([]cache.InformerSynced, 0, len(c.informers))
+	for _, informer := range c.informers {
+		synced = append(synced, informer.HasSynced)
+	}
+	return cache.WaitForCacheSync(ctx.Done(), synced...)
+}
+
+// List implements Snapshot
+func (c *InformerCache) List(resource, namespace string, selector labels.Selector) ([]runtime.Object, bool) {
+	informer, ok := c.informers[resource]
+	if !ok || !informer.HasSynced() {
+		return nil, false
+	}
+
+	var items []any
+	if namespace == metav1.NamespaceAll {
+		items = informer.GetStore().List()
+	} else {
+		var err error
+		if items, err = informer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace); err != nil {
+			return nil, false
+		}
+	}
+
+	objects := make([]runtime.Object, 0, len(items))
+	for _, item := range items {
+		object, ok := item.(runtime.Object)
+		if !ok {
+			continue
+		}
+		if selector != nil && !selector.Empty() {
+			accessor, err := meta.Accessor(object)
+			if err != nil || !selector.Matches(labels.Set(accessor.GetLabels())) {
+				continue
+			}
+		}
+		// The cache is shared by concurrent diagnoses
+		objects = append(objects, object.DeepCopyObject())
+	}
+	return objects, true
+}
+
+// cachedList returns the objects of resource from the aggregator's Snapshot,
+// and false when there is none or it does not hold them
+func cachedList[T any](a *Aggregator, resource, namespace, labelSelector string) ([]T, bool) {
+	if a.opts.Snapshot == nil {
+		return nil, false
+	}
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, false
+	}
+	objects, ok := a.opts.Snapshot.List(resource, namespace, selector)
+	if !ok {
+		return nil, false
+	}
+	items := make([]T, 0, len(objects))
+	for _, object := range objects {
+		item, ok := any(object).(*T)
+		if !ok {
+			return nil, false
+		}
+		items = append(items, *item)
+	}
+	debugf("%s served from the informer cache (%d items)", resource, len(items))
+	return items, true
+}
+
+// listCached lists resource in namespace from the aggregator's Snapshot when
+// it holds it, else from the API with listAll. Field selectors are only
+// supported by the API.
+func listCached[T any](ctx context.Context, a *Aggregator, resource, namespace string, opts metav1.ListOptions, page listPageFunc[T]) ([]T, error) {
+	if opts.FieldSelector == "" {
+		if items, ok := cachedList[T](a, resource, namespace, opts.LabelSelector); ok {
+			return items, nil
+		}
+	}
+	return listAll(ctx, a, resource, opts, page)
+}
@@ -0,0 +1,655 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// defaultIngressClassAnnotation marks the default IngressClass
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+	// legacyIngressClassAnnotation selects a controller before ingressClassName
+	legacyIngressClassAnnotation = "kubernetes.io/ingress.class"
+)
+
+// httpRoutes is the Gateway API HTTPRoute resource, read with the dynamic
+// client since it is a CRD
+var httpRoutes = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+
+// IngressInfo summarizes an Ingress and what its rules route to
+type IngressInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	// Class is the ingressClassName or legacy class annotation, empty when
+	// the default class applies
+	Class      string        `json:"class,omitempty"`
+	Rules      []IngressRule `json:"rules,omitempty"`
+	TLSSecrets []string      `json:"tlsSecrets,omitempty"`
+	// Addresses are the load balancer IPs or hostnames in the status
+	Addresses []string `json:"addresses,omitempty"`
+	// Problems are short descriptions of what breaks routing, e.g.
+	// "backend Service web does not exist"
+	Problems []string `json:"problems,omitempty"`
+}
+
+// IngressRule is a host and path routed to a Service port. The default
+// backend has neither host nor path.
+type IngressRule struct {
+	Host    string `json:"host,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Service string `json:"service"`
+	Port    string `json:"port,omitempty"`
+}
+
+// HasIssues reports whether some of the Ingress's traffic cannot be routed
+func (i IngressInfo) HasIssues() bool {
+	return len(i.Problems) > 0
+}
+
+// RouteInfo summarizes a Gateway API HTTPRoute and its status per parent
+// Gateway
+type RouteInfo struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace,omitempty"` // set when collected cluster-wide
+	Hostnames []string `json:"hostnames,omitempty"`
+	// Parents are the referenced Gateways, e.g. "Gateway/infra/public"
+	Parents  []string       `json:"parents,omitempty"`
+	Backends []RouteBackend `json:"backends,omitempty"`
+	// Conditions are the status conditions reported by each parent's
+	// controller, e.g. Accepted and ResolvedRefs
+	Conditions []RouteCondition `json:"conditions,omitempty"`
+	Problems   []string         `json:"problems,omitempty"`
+}
+
+// RouteBackend is a backendRef of an HTTPRoute rule
+type RouteBackend struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"` // set when it differs from the route's
+	Name      string `json:"name"`
+	Port      int64  `json:"port,omitempty"`
+}
+
+// RouteCondition is a status condition a Gateway controller set on a route
+type RouteCondition struct {
+	Parent  string `json:"parent"`
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// HasIssues reports whether no Gateway has accepted the route or its
+// backends are not resolved
+func (r RouteInfo) HasIssues() bool {
+	return len(r.Problems) > 0
+}
+
+// collectIngresses records the Ingresses and Gateway API HTTPRoutes of the
+// namespace, checking that backend Services and ports, TLS Secrets and
+// ingress classes exist and reading the route status conditions. When pods
+// are filtered, only objects routing to the collected Services or named like
+// a workload are kept. Clusters without the Gateway API CRDs have no routes.
+func (a *Aggregator) collectIngresses(ctx context.Context, namespace string, workloads []string, data *DiagnosticData) error {
+	ingresses, err := listCached(ctx, a, "ingresses", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]networkingv1.Ingress, string, error) {
+		list, err := a.client.Clientset().NetworkingV1().Ingresses(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("ingresses not collected: %v", err))
+		ingresses = nil
+	} else if err != nil {
+		return err
+	}
+
+	routes, err := listAll(ctx, a, "httproutes", metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+		list, err := a.client.Dynamic().Resource(httpRoutes).Namespace(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.GetContinue(), nil
+	})
+	switch {
+	case apierrors.IsNotFound(err):
+		// Gateway API not installed
+		routes = nil
+	case apierrors.IsForbidden(err):
+		data.Warnings = append(data.Warnings, fmt.Sprintf("HTTPRoutes not collected: %v", err))
+		routes = nil
+	case err != nil:
+		return err
+	}
+
+	ingresses, routes = a.filterRoutes(workloads, ingresses, routes, data)
+	if len(ingresses) == 0 && len(routes) == 0 {
+		return nil
+	}
+
+	// Backends are checked against all Services, including the selector-less
+	// ones collectServices skips
+	services, err := listCached(ctx, a, "services", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Service, string, error) {
+		list, err := a.client.Clientset().CoreV1().Services(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	var backends *backendIndex
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("ingress backends not checked: %v", err))
+	} else if err != nil {
+		return err
+	} else {
+		backends = newBackendIndex(services, data.Services)
+	}
+
+	if len(ingresses) > 0 {
+		if err := a.checkIngresses(ctx, namespace, ingresses, backends, data); err != nil {
+			return err
+		}
+	}
+	for i := range routes {
+		info := routeInfo(&routes[i])
+		checkRoute(&info, backends)
+		data.HTTPRoutes = append(data.HTTPRoutes, info)
+		data.Findings = append(data.Findings, routeFindings(info)...)
+	}
+	return nil
+}
+
+// filterRoutes keeps, when pods are filtered, the Ingresses and routes that
+// send traffic to a collected Service or are named like a workload
+func (a *Aggregator) filterRoutes(workloads []string, ingresses []networkingv1.Ingress, routes []unstructured.Unstructured, data *DiagnosticData) ([]networkingv1.Ingress, []unstructured.Unstructured) {
+	if len(workloads) == 0 && a.opts.LabelSelector == "" {
+		return ingresses, routes
+	}
+	collected := make(map[string]bool)
+	for _, svc := range data.Services {
+		collected[svc.Name] = true
+	}
+
+	var keptIngresses []networkingv1.Ingress
+	for _, ing := range ingresses {
+		keep := matchesAnyWorkload("Ingress/"+ing.Name, workloads)
+		for _, rule := range ingressRules(&ing) {
+			keep = keep || collected[rule.Service]
+		}
+		if keep {
+			keptIngresses = append(keptIngresses, ing)
+		}
+	}
+
+	var keptRoutes []unstructured.Unstructured
+	for i := range routes {
+		keep := matchesAnyWorkload("HTTPRoute/"+routes[i].GetName(), workloads)
+		for _, b := range routeBackends(&routes[i]) {
+			keep = keep || (b.Kind == "Service" && b.Namespace == "" && collected[b.Name])
+		}
+		if keep {
+			keptRoutes = append(keptRoutes, routes[i])
+		}
+	}
+	return keptIngresses, keptRoutes
+}
+
+// backendIndex answers whether a Service and port exist and have ready
+// endpoints
+type backendIndex struct {
+	services map[string]*corev1.Service
+	// unready holds the collected Services without a ready endpoint
+	unready map[string]bool
+}
+
+func newBackendIndex(services []corev1.Service, collected []ServiceInfo) *backendIndex {
+	idx := &backendIndex{services: make(map[string]*corev1.Service), unready: make(map[string]bool)}
+	for i := range services {
+		idx.services[services[i].Name] = &services[i]
+	}
+	for _, svc := range collected {
+		if svc.HasIssues() {
+			idx.unready[svc.Name] = true
+		}
+	}
+	return idx
+}
+
+// problem describes why traffic to the Service port fails, or returns ""
+func (idx *backendIndex) problem(service, port string) string {
+	svc, ok := idx.services[service]
+	if !ok {
+		return fmt.Sprintf("backend Service %s does not exist", service)
+	}
+	if port != "" && svc.Spec.Type != corev1.ServiceTypeExternalName && !hasServicePort(svc, port) {
+		return fmt.Sprintf("backend Service %s has no port %s", service, port)
+	}
+	if idx.unready[service] {
+		return fmt.Sprintf("backend Service %s has no ready endpoints", service)
+	}
+	return ""
+}
+
+// hasServicePort reports whether the Service exposes port, given by name or
+// number
+func hasServicePort(svc *corev1.Service, port string) bool {
+	for _, p := range svc.Spec.Ports {
+		if p.Name == port || fmt.Sprint(p.Port) == port {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIngresses records the Ingresses with the problems of their class,
+// backends and TLS Secrets
+func (a *Aggregator) checkIngresses(ctx context.Context, namespace string, ingresses []networkingv1.Ingress, backends *backendIndex, data *DiagnosticData) error {
+	classes, err := a.ingressClasses(ctx)
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("ingress classes not checked: %v", err))
+		classes = nil
+	} else if err != nil {
+		return err
+	}
+
+	checkSecrets := true
+	for i := range ingresses {
+		ing := &ingresses[i]
+		info := IngressInfo{
+			Name:  ing.Name,
+			Rules: ingressRules(ing),
+		}
+		for _, lb := range ing.Status.LoadBalancer.Ingress {
+			if lb.IP != "" {
+				info.Addresses = append(info.Addresses, lb.IP)
+			} else if lb.Hostname != "" {
+				info.Addresses = append(info.Addresses, lb.Hostname)
+			}
+		}
+
+		var findings []Finding
+		object := "Ingress/" + ing.Name
+
+		legacy := ing.Annotations[legacyIngressClassAnnotation]
+		switch {
+		case ing.Spec.IngressClassName != nil:
+			info.Class = *ing.Spec.IngressClassName
+			if _, ok := classes[info.Class]; classes != nil && !ok {
+				info.Problems = append(info.Problems, fmt.Sprintf("IngressClass %s does not exist", info.Class))
+				findings = append(findings, Finding{
+					Rule:     "ingress-class-missing",
+					Severity: SeverityHigh,
+					Object:   object,
+					Message:  fmt.Sprintf("IngressClass %s does not exist, so no ingress controller serves this Ingress (available: %s)", info.Class, classNames(classes)),
+				})
+			}
+		case legacy != "":
+			info.Class = legacy
+		case classes != nil && defaultIngressClass(classes) == "":
+			info.Problems = append(info.Problems, "no ingress class and no default IngressClass")
+			findings = append(findings, Finding{
+				Rule:     "ingress-class-missing",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message:  fmt.Sprintf("the Ingress sets no ingressClassName and no IngressClass is marked default, so controllers may ignore it (available: %s)", classNames(classes)),
+			})
+		}
+
+		if backends != nil {
+			reported := make(map[string]bool)
+			for _, rule := range info.Rules {
+				problem := backends.problem(rule.Service, rule.Port)
+				if problem == "" || reported[problem] {
+					continue
+				}
+				reported[problem] = true
+				info.Problems = append(info.Problems, problem)
+				findings = append(findings, backendFinding("ingress", object, routeTarget(rule), problem))
+			}
+		}
+
+		for _, tls := range ing.Spec.TLS {
+			// Without a Secret the controller serves its default certificate
+			if tls.SecretName == "" {
+				continue
+			}
+			info.TLSSecrets = append(info.TLSSecrets, tls.SecretName)
+			if !checkSecrets {
+				continue
+			}
+			secret, err := a.getConfigObject(ctx, namespace, "Secret", tls.SecretName)
+			if apierrors.IsForbidden(err) {
+				data.Warnings = append(data.Warnings, fmt.Sprintf("ingress TLS secrets not checked: %v", err))
+				checkSecrets = false
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			hosts := "all hosts"
+			if len(tls.Hosts) > 0 {
+				hosts = strings.Join(tls.Hosts, ", ")
+			}
+			switch {
+			case secret == nil:
+				info.Problems = append(info.Problems, fmt.Sprintf("TLS Secret %s does not exist", tls.SecretName))
+				findings = append(findings, Finding{
+					Rule:     "ingress-tls-secret-missing",
+					Severity: SeverityHigh,
+					Object:   object,
+					Message:  fmt.Sprintf("TLS Secret %s does not exist; HTTPS for %s gets the controller's default certificate and fails validation (check the certificate issuer if the Secret is managed)", tls.SecretName, hosts),
+				})
+			case !secret.keys[corev1.TLSCertKey] || !secret.keys[corev1.TLSPrivateKeyKey]:
+				info.Problems = append(info.Problems, fmt.Sprintf("TLS Secret %s lacks %s or %s", tls.SecretName, corev1.TLSCertKey, corev1.TLSPrivateKeyKey))
+				findings = append(findings, Finding{
+					Rule:     "ingress-tls-secret-invalid",
+					Severity: SeverityHigh,
+					Object:   object,
+					Message:  fmt.Sprintf("TLS Secret %s has no %s and %s keys; HTTPS for %s gets the controller's default certificate", tls.SecretName, corev1.TLSCertKey, corev1.TLSPrivateKeyKey, hosts),
+				})
+			}
+		}
+
+		if len(info.Addresses) == 0 && len(info.Problems) == 0 {
+			findings = append(findings, Finding{
+				Rule:     "ingress-no-address",
+				Severity: SeverityLow,
+				Object:   object,
+				Message:  "no load balancer address is assigned; the ingress controller for this class may not be running",
+			})
+		}
+
+		data.Ingresses = append(data.Ingresses, info)
+		data.Findings = append(data.Findings, findings...)
+	}
+	return nil
+}
+
+// ingressClasses returns all IngressClasses by name
+func (a *Aggregator) ingressClasses(ctx context.Context) (map[string]networkingv1.IngressClass, error) {
+	items, err := listCached(ctx, a, "ingressclasses", metav1.NamespaceAll, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]networkingv1.IngressClass, string, error) {
+		list, err := a.client.Clientset().NetworkingV1().IngressClasses().List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	classes := make(map[string]networkingv1.IngressClass, len(items))
+	for _, class := range items {
+		classes[class.Name] = class
+	}
+	return classes, nil
+}
+
+// defaultIngressClass returns the name of the default IngressClass, or ""
+func defaultIngressClass(classes map[string]networkingv1.IngressClass) string {
+	for name, class := range classes {
+		if class.Annotations[defaultIngressClassAnnotation] == "true" {
+			return name
+		}
+	}
+	return ""
+}
+
+// ingressRules lists the Service backends of an Ingress: the default backend
+// first, then one per host and path
+func ingressRules(ing *networkingv1.Ingress) []IngressRule {
+	var rules []IngressRule
+	if b := ing.Spec.DefaultBackend; b != nil && b.Service != nil {
+		rules = append(rules, IngressRule{Service: b.Service.Name, Port: backendPort(b.Service.Port)})
+	}
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service == nil {
+				continue
+			}
+			rules = append(rules, IngressRule{
+				Host:    rule.Host,
+				Path:    path.Path,
+				Service: path.Backend.Service.Name,
+				Port:    backendPort(path.Backend.Service.Port),
+			})
+		}
+	}
+	return rules
+}
+
+// backendPort renders an Ingress backend port by name or number
+func backendPort(port networkingv1.ServiceBackendPort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	if port.Number != 0 {
+		return fmt.Sprint(port.Number)
+	}
+	return ""
+}
+
+// routeTarget renders where an Ingress rule matches, e.g. "shop.example.com/api"
+func routeTarget(rule IngressRule) string {
+	if rule.Host == "" && rule.Path == "" {
+		return "the default backend"
+	}
+	host := rule.Host
+	if host == "" {
+		host = "*"
+	}
+	return host + rule.Path
+}
+
+// backendFinding explains a broken backend of an Ingress or route; rules are
+// prefixed with "ingress" or "httproute"
+func backendFinding(prefix, object, target, problem string) Finding {
+	if strings.HasSuffix(problem, "no ready endpoints") {
+		return Finding{
+			Rule:     prefix + "-backend-unavailable",
+			Severity: SeverityHigh,
+			Object:   object,
+			Message:  fmt.Sprintf("%s: requests for %s get 503 until its pods are ready", problem, target),
+		}
+	}
+	return Finding{
+		Rule:     prefix + "-backend-missing",
+		Severity: SeverityHigh,
+		Object:   object,
+		Message:  fmt.Sprintf("%s: requests for %s fail", problem, target),
+	}
+}
+
+// routeInfo extracts the spec and parent status of an HTTPRoute
+func routeInfo(route *unstructured.Unstructured) RouteInfo {
+	info := RouteInfo{Name: route.GetName(), Backends: routeBackends(route)}
+	info.Hostnames, _, _ = unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+
+	parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	for _, p := range parents {
+		if ref, ok := p.(map[string]any); ok {
+			info.Parents = append(info.Parents, parentName(ref, route.GetNamespace()))
+		}
+	}
+
+	statuses, _, _ := unstructured.NestedSlice(route.Object, "status", "parents")
+	for _, s := range statuses {
+		status, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+		ref, _, _ := unstructured.NestedMap(status, "parentRef")
+		parent := parentName(ref, route.GetNamespace())
+		conditions, _, _ := unstructured.NestedSlice(status, "conditions")
+		for _, c := range conditions {
+			cond, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			info.Conditions = append(info.Conditions, RouteCondition{
+				Parent:  parent,
+				Type:    stringField(cond, "type"),
+				Status:  stringField(cond, "status"),
+				Reason:  stringField(cond, "reason"),
+				Message: stringField(cond, "message"),
+			})
+		}
+	}
+	return info
+}
+
+// routeBackends lists the backendRefs of all rules of an HTTPRoute
+func routeBackends(route *unstructured.Unstructured) []RouteBackend {
+	var backends []RouteBackend
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	for _, r := range rules {
+		rule, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		refs, _, _ := unstructured.NestedSlice(rule, "backendRefs")
+		for _, b := range refs {
+			ref, ok := b.(map[string]any)
+			if !ok {
+				continue
+			}
+			backend := RouteBackend{Kind: stringField(ref, "kind"), Name: stringField(ref, "name")}
+			if backend.Kind == "" {
+				backend.Kind = "Service"
+			}
+			if ns := stringField(ref, "namespace"); ns != route.GetNamespace() {
+				backend.Namespace = ns
+			}
+			backend.Port, _, _ = unstructured.NestedInt64(ref, "port")
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// parentName renders a parentRef, e.g. "Gateway/infra/public"; the namespace
+// defaults to the route's
+func parentName(ref map[string]any, namespace string) string {
+	kind := stringField(ref, "kind")
+	if kind == "" {
+		kind = "Gateway"
+	}
+	if ns := stringField(ref, "namespace"); ns != "" {
+		namespace = ns
+	}
+	name := kind + "/" + namespace + "/" + stringField(ref, "name")
+	if section := stringField(ref, "sectionName"); section != "" {
+		name += "#" + section
+	}
+	return name
+}
+
+// stringField returns a string field of an unstructured object, or ""
+func stringField(obj map[string]any, field string) string {
+	s, _, _ := unstructured.NestedString(obj, field)
+	return s
+}
+
+// checkRoute records the problems of a route: parents that have not
+// accepted it, unresolved references and backend Services in the route's
+// namespace that are missing or not ready
+func checkRoute(info *RouteInfo, backends *backendIndex) {
+	if len(info.Parents) > 0 && len(info.Conditions) == 0 {
+		info.Problems = append(info.Problems, "no Gateway reported status")
+	}
+	unresolved := false
+	for _, c := range info.Conditions {
+		if c.Status != string(metav1.ConditionFalse) {
+			continue
+		}
+		switch c.Type {
+		case "Accepted":
+			info.Problems = append(info.Problems, fmt.Sprintf("not accepted by %s (%s)", c.Parent, c.Reason))
+		case "ResolvedRefs":
+			unresolved = true
+			info.Problems = append(info.Problems, fmt.Sprintf("references not resolved for %s (%s)", c.Parent, c.Reason))
+		}
+	}
+	// Unresolved references already name the missing backends
+	if backends == nil || unresolved {
+		return
+	}
+	reported := make(map[string]bool)
+	for _, b := range info.Backends {
+		if b.Kind != "Service" || b.Namespace != "" {
+			continue
+		}
+		port := ""
+		if b.Port != 0 {
+			port = fmt.Sprint(b.Port)
+		}
+		if problem := backends.problem(b.Name, port); problem != "" && !reported[problem] {
+			reported[problem] = true
+			info.Problems = append(info.Problems, problem)
+		}
+	}
+}
+
+// routeFindings explains the problems checkRoute found
+func routeFindings(info RouteInfo) []Finding {
+	object := "HTTPRoute/" + info.Name
+	target := "the route"
+	if len(info.Hostnames) > 0 {
+		target = strings.Join(info.Hostnames, ", ")
+	}
+
+	var findings []Finding
+	if len(info.Parents) > 0 && len(info.Conditions) == 0 {
+		findings = append(findings, Finding{
+			Rule:     "httproute-not-attached",
+			Severity: SeverityHigh,
+			Object:   object,
+			Message:  fmt.Sprintf("no Gateway controller has reported status for the route; %s does not exist or its controller is not running", strings.Join(info.Parents, ", ")),
+		})
+	}
+	for _, c := range info.Conditions {
+		if c.Status != string(metav1.ConditionFalse) {
+			continue
+		}
+		switch c.Type {
+		case "Accepted":
+			findings = append(findings, Finding{
+				Rule:     "httproute-not-accepted",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  fmt.Sprintf("%s did not accept the route, so %s is not served: %s", c.Parent, target, conditionDetail(c)),
+			})
+		case "ResolvedRefs":
+			findings = append(findings, Finding{
+				Rule:     "httproute-refs-unresolved",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  fmt.Sprintf("backend references are not resolved for %s, so requests for %s get 500: %s", c.Parent, target, conditionDetail(c)),
+			})
+		}
+	}
+	for _, problem := range info.Problems {
+		if strings.HasPrefix(problem, "backend Service ") {
+			findings = append(findings, backendFinding("httproute", object, target, problem))
+		}
+	}
+	return findings
+}
+
+// conditionDetail renders the reason and message of a condition
+func conditionDetail(c RouteCondition) string {
+	if c.Message == "" {
+		return c.Reason
+	}
+	return c.Reason + ": " + c.Message
+}
@@ -0,0 +1,60 @@
+package k8s
+
+import "fmt"
+
+// InitDone reports whether an init container no longer holds up the pod:
+// it completed successfully, or it is a sidecar that has started
+func (cs ContainerStatus) InitDone() bool {
+	if cs.Sidecar {
+		return cs.State == "Running"
+	}
+	return cs.State == "Terminated" && cs.Termination != nil && cs.Termination.ExitCode == 0
+}
+
+// BlockingInit returns the first init container that has not finished, which
+// keeps the app containers from starting
+func (p PodInfo) BlockingInit() (ContainerStatus, bool) {
+	for _, cs := range p.InitContainerStatuses {
+		if !cs.InitDone() {
+			return cs, true
+		}
+	}
+	return ContainerStatus{}, false
+}
+
+// InitStatus describes a pod still initializing the way kubectl does, e.g.
+// "Init:CrashLoopBackOff" or "Init:1/3", or returns "" once all init
+// containers are done
+func (p PodInfo) InitStatus() string {
+	for i, cs := range p.InitContainerStatuses {
+		if cs.InitDone() {
+			continue
+		}
+		switch {
+		case cs.State == "Terminated" && cs.Reason != "":
+			return "Init:" + cs.Reason
+		case cs.State == "Terminated" && cs.Termination != nil:
+			return fmt.Sprintf("Init:ExitCode:%d", cs.Termination.ExitCode)
+		case cs.State == "Waiting" && cs.Reason != "" && cs.Reason != "PodInitializing":
+			return "Init:" + cs.Reason
+		}
+		return fmt.Sprintf("Init:%d/%d", i, len(p.InitContainerStatuses))
+	}
+	return ""
+}
+
+// IsInitContainer reports whether name is one of the pod's init containers
+func (p PodInfo) IsInitContainer(name string) bool {
+	for _, cs := range p.InitContainerStatuses {
+		if cs.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AllContainerStatuses returns the init container statuses followed by the
+// app container statuses, in the order the containers start
+func (p PodInfo) AllContainerStatuses() []ContainerStatus {
+	return append(append([]ContainerStatus{}, p.InitContainerStatuses...), p.ContainerStatuses...)
+}
@@ -0,0 +1,219 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultLogKeywords mark log lines that are likely to explain a failure
+var DefaultLogKeywords = []string{
+	"error", "exception", "fatal", "panic", "fail", "refused", "denied",
+	"timeout", "timed out", "oom", "killed", "traceback", "unable", "cannot",
+}
+
+// logFetchMultiplier controls how many more lines are fetched than kept, so
+// relevant lines that scrolled past the tail can still be selected
+const logFetchMultiplier = 5
+
+// ContainerLog holds recent log output for a single container
+type ContainerLog struct {
+	Pod       string    `json:"pod"`
+	Namespace string    `json:"namespace,omitempty"` // set when collected cluster-wide
+	Container string    `json:"container"`
+	Previous  bool      `json:"previous,omitempty"`
+	CrashedAt time.Time `json:"crashedAt,omitempty"` // when the logged instance terminated
+	Lines     []string  `json:"lines,omitempty"`
+	Omitted   int       `json:"omitted,omitempty"` // lines dropped by relevance selection
+	Note      string    `json:"note,omitempty"`    // why logs are missing or partial
+}
+
+// collectLogs fetches logs for unhealthy containers using a bounded worker
+// pool. Individual failures are recorded as notes on the result.
+func (a *Aggregator) collectLogs(ctx context.Context, namespace string, pods []PodInfo, start time.Time) []ContainerLog {
+	targets := logTargets(pods)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	workers := a.opts.LogConcurrency
+	if workers > len(targets) {
+		workers = len(targets)
+	}
+
+	jobs := make(chan int)
+	var done atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				a.fetchLog(ctx, namespace, &targets[i])
+				a.report("logs", int(done.Add(1)), len(targets), start)
+			}
+		}()
+	}
+
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return targets
+}
+
+// fetchLog retrieves a container's recent log into target, with a
+// per-request timeout, and keeps the most relevant lines
+func (a *Aggregator) fetchLog(ctx context.Context, namespace string, target *ContainerLog) {
+	ctx, cancel := context.WithTimeout(ctx, a.opts.LogTimeout)
+	defer cancel()
+
+	fetchLines := a.opts.LogTailLines * logFetchMultiplier
+	raw, err := a.client.Clientset().CoreV1().Pods(namespace).GetLogs(target.Pod, &corev1.PodLogOptions{
+		Container:  target.Container,
+		Previous:   target.Previous,
+		TailLines:  &fetchLines,
+		Timestamps: !target.CrashedAt.IsZero(),
+	}).DoRaw(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			target.Note = fmt.Sprintf("log request timed out after %s", a.opts.LogTimeout)
+		} else {
+			target.Note = fmt.Sprintf("failed to fetch logs: %v", err)
+		}
+		return
+	}
+
+	text := strings.TrimRight(string(raw), "\n")
+	if text == "" {
+		target.Note = "no log output"
+		return
+	}
+
+	lines := strings.Split(text, "\n")
+	if !target.CrashedAt.IsZero() {
+		lines = linesBefore(lines, target.CrashedAt)
+	}
+	target.Lines, target.Omitted = selectRelevantLines(lines, int(a.opts.LogTailLines), a.opts.LogKeywords)
+}
+
+// logTargets selects containers worth fetching logs for: not ready, not
+// running or restarted, and init containers that have not finished or
+// restarted. After a restart the previous instance's logs hold the crash,
+// unless the current instance has itself terminated.
+func logTargets(pods []PodInfo) []ContainerLog {
+	var targets []ContainerLog
+	for _, pod := range pods {
+		for _, cs := range pod.AllContainerStatuses() {
+			healthy := cs.Ready && cs.State == "Running"
+			if pod.IsInitContainer(cs.Name) {
+				healthy = cs.InitDone()
+			}
+			if healthy && cs.RestartCount == 0 {
+				continue
+			}
+
+			target := ContainerLog{Pod: pod.Name, Container: cs.Name}
+			switch {
+			case cs.State == "Terminated" && cs.Termination != nil:
+				target.CrashedAt = cs.Termination.FinishedAt
+			case cs.RestartCount > 0:
+				target.Previous = true
+				if cs.LastTermination != nil {
+					target.CrashedAt = cs.LastTermination.FinishedAt
+				}
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// linesBefore strips the RFC3339 timestamp prefix added by the API and drops
+// lines logged after the crash time
+func linesBefore(lines []string, crashedAt time.Time) []string {
+	var kept []string
+	for _, line := range lines {
+		ts, rest, found := strings.Cut(line, " ")
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if !found || err != nil {
+			kept = append(kept, line)
+			continue
+		}
+		if t.After(crashedAt.Add(time.Second)) {
+			continue
+		}
+		kept = append(kept, rest)
+	}
+	return kept
+}
+
+// selectRelevantLines keeps at most budget lines: the final half of the
+// budget as-is (the lead-up to the crash) and the remainder filled with the
+// latest earlier lines matching a keyword, then with further tail lines.
+// Gaps are marked in the output.
+// It returns the selected lines and the number of lines omitted.
+func selectRelevantLines(lines []string, budget int, keywords []string) ([]string, int) {
+	if budget <= 0 || len(lines) <= budget {
+		return lines, 0
+	}
+
+	tail := budget / 2
+	if tail < 1 {
+		tail = 1
+	}
+	keep := make([]bool, len(lines))
+	for i := len(lines) - tail; i < len(lines); i++ {
+		keep[i] = true
+	}
+
+	remaining := budget - tail
+	for i := len(lines) - tail - 1; i >= 0 && remaining > 0; i-- {
+		if matchesKeyword(lines[i], keywords) {
+			keep[i] = true
+			remaining--
+		}
+	}
+
+	// Without enough keyword matches, spend the rest of the budget on a longer tail
+	for i := len(lines) - tail - 1; i >= 0 && remaining > 0; i-- {
+		if !keep[i] {
+			keep[i] = true
+			remaining--
+		}
+	}
+
+	var selected []string
+	omitted, gap := 0, 0
+	for i, line := range lines {
+		if !keep[i] {
+			gap++
+			continue
+		}
+		if gap > 0 {
+			selected = append(selected, fmt.Sprintf("... (%d lines omitted) ...", gap))
+			omitted += gap
+			gap = 0
+		}
+		selected = append(selected, line)
+	}
+	return selected, omitted
+}
+
+func matchesKeyword(line string, keywords []string) bool {
+	lower := strings.ToLower(line)
+	for _, kw := range keywords {
+		if strings.Contains(lower, strings.ToLower(kw)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Pod and node metrics of metrics-server, read with the dynamic client so
+// clusters without it need no extra API types
+var (
+	podMetrics  = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+	nodeMetrics = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"}
+)
+
+// nearLimitPercent is the share of a limit from which current usage is
+// flagged as close to it
+const nearLimitPercent = 90
+
+// ContainerUsage compares a container's current usage, as reported by
+// metrics-server, with its requests and limits. CPU is in millicores and
+// memory in bytes; 0 means unset.
+type ContainerUsage struct {
+	CPU           int64 `json:"cpu"`
+	CPURequest    int64 `json:"cpuRequest,omitempty"`
+	CPULimit      int64 `json:"cpuLimit,omitempty"`
+	Memory        int64 `json:"memory"`
+	MemoryRequest int64 `json:"memoryRequest,omitempty"`
+	MemoryLimit   int64 `json:"memoryLimit,omitempty"`
+}
+
+// collectMetrics adds the current CPU and memory usage of the collected
+// containers and nodes from metrics-server. Clusters without metrics-server
+// are skipped silently; other failures only produce a warning, as usage is
+// supplementary. It returns the number of containers with usage.
+func (a *Aggregator) collectMetrics(ctx context.Context, namespace string, pods []corev1.Pod, data *DiagnosticData) int {
+	if len(data.Pods) == 0 {
+		return 0
+	}
+
+	items, err := listAll(ctx, a, "podmetrics", metav1.ListOptions{LabelSelector: a.opts.LabelSelector}, func(ctx context.Context, opts metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+		list, err := a.client.Dynamic().Resource(podMetrics).Namespace(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.GetContinue(), nil
+	})
+	if apierrors.IsNotFound(err) {
+		// metrics-server not installed
+		return 0
+	}
+	if err != nil {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("resource usage not collected from metrics-server: %v", err))
+		return 0
+	}
+
+	usage := make(map[string]map[string]corev1.ResourceList)
+	for _, item := range items {
+		containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+		byContainer := make(map[string]corev1.ResourceList)
+		for _, c := range containers {
+			container, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(container, "name")
+			byContainer[name] = usageList(container)
+		}
+		usage[item.GetName()] = byContainer
+	}
+
+	collected := 0
+	specs := make(map[string]*corev1.Pod)
+	for i := range pods {
+		specs[pods[i].Name] = &pods[i]
+	}
+	for i := range data.Pods {
+		pod := &data.Pods[i]
+		spec, ok := specs[pod.Name]
+		if !ok || usage[pod.Name] == nil {
+			continue
+		}
+		for j := range pod.ContainerStatuses {
+			cs := &pod.ContainerStatuses[j]
+			current, ok := usage[pod.Name][cs.Name]
+			if !ok {
+				continue
+			}
+			u := &ContainerUsage{CPU: current.Cpu().MilliValue(), Memory: current.Memory().Value()}
+			if c := specContainer(spec, cs.Name); c != nil {
+				u.CPURequest = c.Resources.Requests.Cpu().MilliValue()
+				u.CPULimit = c.Resources.Limits.Cpu().MilliValue()
+				u.MemoryRequest = c.Resources.Requests.Memory().Value()
+				u.MemoryLimit = c.Resources.Limits.Memory().Value()
+			}
+			cs.Usage = u
+			collected++
+			data.Findings = append(data.Findings, checkUsage(pod.Name, cs.Name, u)...)
+		}
+	}
+
+	if len(data.Nodes) > 0 {
+		a.collectNodeMetrics(ctx, data)
+	}
+	return collected
+}
+
+// collectNodeMetrics adds the current usage of the collected nodes
+func (a *Aggregator) collectNodeMetrics(ctx context.Context, data *DiagnosticData) {
+	items, err := listAll(ctx, a, "nodemetrics", metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+		list, err := a.client.Dynamic().Resource(nodeMetrics).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.GetContinue(), nil
+	})
+	if err != nil {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("node usage not collected from metrics-server: %v", err))
+		return
+	}
+
+	usage := make(map[string]corev1.ResourceList)
+	for _, item := range items {
+		usage[item.GetName()] = usageList(item.Object)
+	}
+	for i := range data.Nodes {
+		if current, ok := usage[data.Nodes[i].Name]; ok {
+			data.Nodes[i].UsedCPU = current.Cpu().MilliValue()
+			data.Nodes[i].UsedMemory = current.Memory().Value()
+		}
+	}
+}
+
+// usageList parses the "usage" map of a metrics object, skipping
+// unparseable quantities
+func usageList(obj map[string]any) corev1.ResourceList {
+	raw, _, _ := unstructured.NestedStringMap(obj, "usage")
+	list := make(corev1.ResourceList)
+	for name, value := range raw {
+		if q, err := resource.ParseQuantity(value); err == nil {
+			list[corev1.ResourceName(name)] = q
+		}
+	}
+	return list
+}
+
+// checkUsage flags containers using nearly all of their memory limit, which
+// are about to be OOMKilled, or of their CPU limit, which are throttled
+func checkUsage(pod, container string, u *ContainerUsage) []Finding {
+	object := fmt.Sprintf("Pod/%s/%s", pod, container)
+	var findings []Finding
+	if u.MemoryLimit > 0 && percent(u.Memory, u.MemoryLimit) >= nearLimitPercent {
+		findings = append(findings, Finding{
+			Rule:     "memory-near-limit",
+			Severity: SeverityMedium,
+			Object:   object,
+			Message: fmt.Sprintf("uses %s of its %s memory limit (%d%%); it is OOMKilled when it reaches the limit",
+				FormatMemory(u.Memory), FormatMemory(u.MemoryLimit), percent(u.Memory, u.MemoryLimit)),
+		})
+	}
+	if u.CPULimit > 0 && percent(u.CPU, u.CPULimit) >= nearLimitPercent {
+		findings = append(findings, Finding{
+			Rule:     "cpu-near-limit",
+			Severity: SeverityLow,
+			Object:   object,
+			Message: fmt.Sprintf("uses %s of its %s CPU limit (%d%%) and is likely being throttled, which slows responses and can fail liveness probes",
+				FormatCPU(u.CPU), FormatCPU(u.CPULimit), percent(u.CPU, u.CPULimit)),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,328 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AllNamespaces is the DiagnosticData.Namespace of a cluster-wide collection
+const AllNamespaces = "*"
+
+// DefaultNamespaceConcurrency bounds how many namespaces are collected at once
+const DefaultNamespaceConcurrency = 8
+
+// NamespaceSummary is the section of one namespace in a multi-namespace
+// collection, whose data is otherwise merged with each item carrying its
+// namespace
+type NamespaceSummary struct {
+	Name string `json:"name"`
+	Pods int    `json:"pods"`
+	// Unhealthy counts pods that are not running with all containers ready
+	Unhealthy int `json:"unhealthy"`
+	Findings  int `json:"findings"`
+	// Severity is that of the most severe finding
+	Severity Severity `json:"severity,omitempty"`
+	// Skipped is the error that kept the namespace from being collected
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// HasIssues reports whether the namespace has unhealthy pods or findings,
+// or could not be collected
+func (s NamespaceSummary) HasIssues() bool {
+	return s.Unhealthy > 0 || s.Findings > 0 || s.Skipped != ""
+}
+
+// SplitNamespaces parses a comma-separated namespace list, as given to -n,
+// dropping blanks and duplicates
+func SplitNamespaces(list string) []string {
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, ns := range strings.Split(list, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" && !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// NamespaceResult is the outcome of collecting one namespace
+type NamespaceResult struct {
+	Namespace string
+	Data      *DiagnosticData
+	Err       error
+}
+
+// Qualify prefixes name with its namespace when collected cluster-wide,
+// e.g. "payments/api-7d8f9b" or "payments/Pod/api-7d8f9b"
+func Qualify(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// CollectAllNamespaces collects every namespace with a bounded worker pool
+// and merges the results. Namespaces that fail, e.g. for missing RBAC, are
+// reported as warnings instead of aborting the run.
+func (a *Aggregator) CollectAllNamespaces(ctx context.Context, workloads []string) (*DiagnosticData, error) {
+	namespaces, err := a.listNamespaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	return a.collectMerged(ctx, AllNamespaces, namespaces, workloads)
+}
+
+// CollectNamespaceList collects the given namespaces like
+// CollectAllNamespaces, e.g. for -n payments,orders. The merged data's
+// Namespace is the comma-separated list.
+func (a *Aggregator) CollectNamespaceList(ctx context.Context, namespaces []string, workloads []string) (*DiagnosticData, error) {
+	return a.collectMerged(ctx, strings.Join(namespaces, ","), namespaces, workloads)
+}
+
+// collectMerged collects namespaces concurrently and merges them under the
+// namespace label
+func (a *Aggregator) collectMerged(ctx context.Context, label string, namespaces []string, workloads []string) (*DiagnosticData, error) {
+	// Nodes are shared by all namespaces, so they are collected once
+	inner := *a
+	inner.opts.CollectNodes = false
+	results := inner.CollectNamespaces(ctx, namespaces, workloads)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	merged := MergeNamespaceResults(label, results)
+	if a.opts.CollectNodes {
+		if err := a.collectNodes(ctx, merged); err != nil {
+			return nil, fmt.Errorf("failed to collect nodes: %w", err)
+		}
+		SortFindings(merged.Findings)
+	}
+	return merged, nil
+}
+
+// CollectNamespaces collects each namespace using up to NamespaceConcurrency
+// workers. Results are returned in the order of namespaces.
+func (a *Aggregator) CollectNamespaces(ctx context.Context, namespaces []string, workloads []string) []NamespaceResult {
+	results := make([]NamespaceResult, len(namespaces))
+	if len(namespaces) == 0 {
+		return results
+	}
+
+	// Per-namespace collectors report nothing; progress is counted in
+	// namespaces instead
+	inner := *a
+	inner.opts.Progress = nil
+
+	workers := a.opts.NamespaceConcurrency
+	if workers > len(namespaces) {
+		workers = len(namespaces)
+	}
+
+	start := time.Now()
+	jobs := make(chan int)
+	var done atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				ns := namespaces[i]
+				data, err := inner.CollectDiagnostics(ctx, ns, workloads)
+				results[i] = NamespaceResult{Namespace: ns, Data: data, Err: err}
+				a.report("namespaces", int(done.Add(1)), len(namespaces), start)
+			}
+		}()
+	}
+
+	for i := range namespaces {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range results {
+		if results[i].Namespace == "" {
+			results[i] = NamespaceResult{Namespace: namespaces[i], Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+// MergeNamespaceResults combines per-namespace data into one DiagnosticData
+// labeled namespace whose pods, controllers, Helm releases, volume claims,
+// services, ingresses, routes, custom resources, events, logs and findings
+// carry their namespace, with a summary section per namespace
+func MergeNamespaceResults(namespace string, results []NamespaceResult) *DiagnosticData {
+	merged := &DiagnosticData{
+		SchemaVersion: CurrentSchemaVersion,
+		Namespace:     namespace,
+		CollectedAt:   time.Now(),
+	}
+
+	seenWarnings := make(map[string]bool)
+	addWarning := func(w string) {
+		if !seenWarnings[w] {
+			seenWarnings[w] = true
+			merged.Warnings = append(merged.Warnings, w)
+		}
+	}
+
+	for _, r := range results {
+		if r.Err != nil {
+			addWarning(fmt.Sprintf("namespace %s was skipped: %v", r.Namespace, r.Err))
+			merged.Namespaces = append(merged.Namespaces, NamespaceSummary{Name: r.Namespace, Skipped: r.Err.Error()})
+			continue
+		}
+		data := r.Data
+		merged.Namespaces = append(merged.Namespaces, summarizeNamespace(r.Namespace, data))
+		if merged.ContextName == "" {
+			merged.ContextName = data.ContextName
+		}
+		merged.Workloads = data.Workloads
+		merged.EventsSince = data.EventsSince
+		if data.ClockSkew != 0 {
+			merged.ClockSkew = data.ClockSkew
+		}
+		for _, w := range data.Warnings {
+			addWarning(w)
+		}
+
+		for _, pod := range data.Pods {
+			pod.Namespace = r.Namespace
+			merged.Pods = append(merged.Pods, pod)
+		}
+		for _, c := range data.Controllers {
+			c.Namespace = r.Namespace
+			merged.Controllers = append(merged.Controllers, c)
+		}
+		for _, rel := range data.HelmReleases {
+			rel.Namespace = r.Namespace
+			merged.HelmReleases = append(merged.HelmReleases, rel)
+		}
+		for _, id := range data.Identities {
+			id.Namespace = r.Namespace
+			merged.Identities = append(merged.Identities, id)
+		}
+		for _, m := range data.Scheduling {
+			m.Namespace = r.Namespace
+			merged.Scheduling = append(merged.Scheduling, m)
+		}
+		for _, c := range data.VolumeClaims {
+			c.Namespace = r.Namespace
+			merged.VolumeClaims = append(merged.VolumeClaims, c)
+		}
+		for _, svc := range data.Services {
+			svc.Namespace = r.Namespace
+			merged.Services = append(merged.Services, svc)
+		}
+		for _, np := range data.NetworkPolicies {
+			np.Namespace = r.Namespace
+			merged.NetworkPolicies = append(merged.NetworkPolicies, np)
+		}
+		for _, check := range data.Connectivity {
+			check.Namespace = r.Namespace
+			merged.Connectivity = append(merged.Connectivity, check)
+		}
+		for _, ing := range data.Ingresses {
+			ing.Namespace = r.Namespace
+			merged.Ingresses = append(merged.Ingresses, ing)
+		}
+		for _, route := range data.HTTPRoutes {
+			route.Namespace = r.Namespace
+			merged.HTTPRoutes = append(merged.HTTPRoutes, route)
+		}
+		for _, q := range data.ResourceQuotas {
+			q.Namespace = r.Namespace
+			merged.ResourceQuotas = append(merged.ResourceQuotas, q)
+		}
+		for _, lr := range data.LimitRanges {
+			lr.Namespace = r.Namespace
+			merged.LimitRanges = append(merged.LimitRanges, lr)
+		}
+		for _, cr := range data.CustomResources {
+			cr.Namespace = r.Namespace
+			merged.CustomResources = append(merged.CustomResources, cr)
+		}
+		for _, event := range data.Events {
+			event.Namespace = r.Namespace
+			merged.Events = append(merged.Events, event)
+		}
+		for _, l := range data.Logs {
+			l.Namespace = r.Namespace
+			merged.Logs = append(merged.Logs, l)
+		}
+		for _, f := range data.Findings {
+			f.Namespace = r.Namespace
+			merged.Findings = append(merged.Findings, f)
+		}
+	}
+
+	SortFindings(merged.Findings)
+	return merged
+}
+
+// summarizeNamespace counts the unhealthy pods and findings of a namespace
+func summarizeNamespace(namespace string, data *DiagnosticData) NamespaceSummary {
+	summary := NamespaceSummary{Name: namespace, Pods: len(data.Pods), Findings: len(data.Findings)}
+	for _, pod := range data.Pods {
+		if pod.Unhealthy() {
+			summary.Unhealthy++
+		}
+	}
+	for _, f := range data.Findings {
+		if f.Severity.Rank() > summary.Severity.Rank() {
+			summary.Severity = f.Severity
+		}
+	}
+	return summary
+}
+
+// Unhealthy reports whether a pod is pending or failed, or running with a
+// container that is not ready
+func (p PodInfo) Unhealthy() bool {
+	switch p.Phase {
+	case string(corev1.PodSucceeded):
+		return false
+	case string(corev1.PodRunning):
+		for _, cs := range p.ContainerStatuses {
+			if !cs.Ready {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// listNamespaces returns the names of all namespaces in sorted order
+func (a *Aggregator) listNamespaces(ctx context.Context) ([]string, error) {
+	items, err := listCached(ctx, a, "namespaces", metav1.NamespaceAll, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Namespace, string, error) {
+		list, err := a.client.Clientset().CoreV1().Namespaces().List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(items))
+	for _, ns := range items {
+		names = append(names, ns.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
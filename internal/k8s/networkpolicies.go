@@ -0,0 +1,283 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Policy types of a NetworkPolicy
+const (
+	PolicyIngress = "Ingress"
+	PolicyEgress  = "Egress"
+)
+
+// NetworkPolicyInfo summarizes a NetworkPolicy selecting collected pods
+type NetworkPolicyInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	// PodSelector is the selector of the pods the policy applies to, e.g.
+	// "app=api", or "<all>" for every pod in the namespace
+	PodSelector string `json:"podSelector"`
+	// PolicyTypes are the directions the policy isolates, "Ingress" and/or
+	// "Egress"
+	PolicyTypes []string `json:"policyTypes"`
+	// Ingress and Egress are the allow rules, rendered as e.g.
+	// "from app=web on 8080/TCP" or "to 10.0.0.0/8 on all ports"; a policy
+	// type without rules denies all traffic in that direction
+	Ingress []string `json:"ingress,omitempty"`
+	Egress  []string `json:"egress,omitempty"`
+	// SelectedPods are the collected pods the policy applies to
+	SelectedPods []string `json:"selectedPods"`
+}
+
+// Isolates reports whether the policy isolates the selected pods in the
+// given direction
+func (p NetworkPolicyInfo) Isolates(policyType string) bool {
+	for _, t := range p.PolicyTypes {
+		if t == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+// collectNetworkPolicies records the NetworkPolicies selecting the collected
+// pods and flags pods whose policies deny all ingress or egress, or block
+// DNS lookups
+func (a *Aggregator) collectNetworkPolicies(ctx context.Context, namespace string, pods []corev1.Pod, data *DiagnosticData) error {
+	items, err := listCached(ctx, a, "networkpolicies", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]networkingv1.NetworkPolicy, string, error) {
+		list, err := a.client.Clientset().NetworkingV1().NetworkPolicies(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("network policies not collected: %v", err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var policies []NetworkPolicyInfo
+	for i := range items {
+		policy := &items[i]
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+		if err != nil {
+			data.Warnings = append(data.Warnings, fmt.Sprintf("NetworkPolicy %s has an invalid pod selector: %v", policy.Name, err))
+			continue
+		}
+		var selected []string
+		for j := range pods {
+			pod := &pods[j]
+			if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+				continue
+			}
+			if selector.Matches(labels.Set(pod.Labels)) {
+				selected = append(selected, pod.Name)
+			}
+		}
+		// Policies that apply to none of the collected pods cannot explain
+		// their failures
+		if len(selected) == 0 {
+			continue
+		}
+		policies = append(policies, networkPolicyInfo(policy, selected))
+	}
+
+	data.NetworkPolicies = append(data.NetworkPolicies, policies...)
+	data.Findings = append(data.Findings, checkNetworkPolicies(policies)...)
+	return nil
+}
+
+// networkPolicyInfo summarizes a NetworkPolicy and the pods it selects
+func networkPolicyInfo(policy *networkingv1.NetworkPolicy, selected []string) NetworkPolicyInfo {
+	info := NetworkPolicyInfo{
+		Name:         policy.Name,
+		PodSelector:  formatPeerSelector(&policy.Spec.PodSelector),
+		SelectedPods: selected,
+	}
+	for _, t := range policy.Spec.PolicyTypes {
+		info.PolicyTypes = append(info.PolicyTypes, string(t))
+	}
+	// Without explicit types a policy always isolates ingress, and egress
+	// only when it has egress rules
+	if len(info.PolicyTypes) == 0 {
+		info.PolicyTypes = []string{PolicyIngress}
+		if len(policy.Spec.Egress) > 0 {
+			info.PolicyTypes = append(info.PolicyTypes, PolicyEgress)
+		}
+	}
+
+	for _, rule := range policy.Spec.Ingress {
+		info.Ingress = append(info.Ingress, "from "+formatPeers(rule.From)+" on "+formatPolicyPorts(rule.Ports))
+	}
+	for _, rule := range policy.Spec.Egress {
+		info.Egress = append(info.Egress, "to "+formatPeers(rule.To)+" on "+formatPolicyPorts(rule.Ports))
+	}
+	return info
+}
+
+// formatPeers renders the peers of a rule, e.g. "app=web, namespace
+// team=a"; no peers allow any source or destination
+func formatPeers(peers []networkingv1.NetworkPolicyPeer) string {
+	if len(peers) == 0 {
+		return "anywhere"
+	}
+	var parts []string
+	for _, peer := range peers {
+		switch {
+		case peer.IPBlock != nil:
+			part := peer.IPBlock.CIDR
+			if len(peer.IPBlock.Except) > 0 {
+				part += " except " + strings.Join(peer.IPBlock.Except, ", ")
+			}
+			parts = append(parts, part)
+		case peer.NamespaceSelector != nil && peer.PodSelector != nil:
+			parts = append(parts, fmt.Sprintf("pods %s in namespaces %s",
+				formatPeerSelector(peer.PodSelector), formatPeerSelector(peer.NamespaceSelector)))
+		case peer.NamespaceSelector != nil:
+			parts = append(parts, "namespaces "+formatPeerSelector(peer.NamespaceSelector))
+		case peer.PodSelector != nil:
+			parts = append(parts, "pods "+formatPeerSelector(peer.PodSelector))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatPeerSelector renders a label selector, with "<all>" for the empty
+// selector that matches everything
+func formatPeerSelector(selector *metav1.LabelSelector) string {
+	if len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0 {
+		return "<all>"
+	}
+	return metav1.FormatLabelSelector(selector)
+}
+
+// formatPolicyPorts renders the ports of a rule, e.g. "8080/TCP, 53/UDP";
+// no ports allow all ports
+func formatPolicyPorts(ports []networkingv1.NetworkPolicyPort) string {
+	if len(ports) == 0 {
+		return "all ports"
+	}
+	var parts []string
+	for _, p := range ports {
+		protocol := corev1.ProtocolTCP
+		if p.Protocol != nil {
+			protocol = *p.Protocol
+		}
+		port := "*"
+		if p.Port != nil {
+			port = p.Port.String()
+			if p.EndPort != nil {
+				port += fmt.Sprintf("-%d", *p.EndPort)
+			}
+		}
+		parts = append(parts, port+"/"+string(protocol))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// allowsDNS reports whether an egress rule rendered by networkPolicyInfo
+// allows port 53, or all ports
+func allowsDNS(rule string) bool {
+	_, ports, _ := strings.Cut(rule, " on ")
+	if ports == "all ports" {
+		return true
+	}
+	for _, port := range strings.Split(ports, ", ") {
+		number, _, _ := strings.Cut(port, "/")
+		if number == "53" || number == "dns" || number == "dns-tcp" || number == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNetworkPolicies flags pods isolated by their NetworkPolicies without
+// any allow rule in a direction, so all their connections in that direction
+// time out, and pods whose egress rules leave out DNS. Policies are
+// additive, so a pod is only cut off when no policy selecting it allows
+// the traffic.
+func checkNetworkPolicies(policies []NetworkPolicyInfo) []Finding {
+	type podPolicies struct {
+		ingressIsolated, egressIsolated bool
+		ingressRules, egressRules       []string
+		names                           []string
+	}
+	var order []string
+	byPod := make(map[string]*podPolicies)
+	for _, p := range policies {
+		for _, pod := range p.SelectedPods {
+			pp, ok := byPod[pod]
+			if !ok {
+				pp = &podPolicies{}
+				byPod[pod] = pp
+				order = append(order, pod)
+			}
+			pp.names = append(pp.names, p.Name)
+			if p.Isolates(PolicyIngress) {
+				pp.ingressIsolated = true
+				pp.ingressRules = append(pp.ingressRules, p.Ingress...)
+			}
+			if p.Isolates(PolicyEgress) {
+				pp.egressIsolated = true
+				pp.egressRules = append(pp.egressRules, p.Egress...)
+			}
+		}
+	}
+
+	var findings []Finding
+	for _, pod := range order {
+		pp := byPod[pod]
+		object := "Pod/" + pod
+		names := strings.Join(pp.names, ", ")
+		if pp.ingressIsolated && len(pp.ingressRules) == 0 {
+			findings = append(findings, Finding{
+				Rule:     "network-policy-deny-ingress",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message: fmt.Sprintf("NetworkPolicies %s isolate the pod for ingress without any allow rule, so connections to it (including through Services) time out",
+					names),
+			})
+		}
+		if !pp.egressIsolated {
+			continue
+		}
+		if len(pp.egressRules) == 0 {
+			findings = append(findings, Finding{
+				Rule:     "network-policy-deny-egress",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message: fmt.Sprintf("NetworkPolicies %s isolate the pod for egress without any allow rule, so its outgoing connections and DNS lookups time out",
+					names),
+			})
+			continue
+		}
+		dns := false
+		for _, rule := range pp.egressRules {
+			if allowsDNS(rule) {
+				dns = true
+				break
+			}
+		}
+		if !dns {
+			findings = append(findings, Finding{
+				Rule:     "network-policy-dns-blocked",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message: fmt.Sprintf("NetworkPolicies %s restrict egress without allowing port 53, so DNS lookups time out and connections to Services by name fail",
+					names),
+			})
+		}
+	}
+	return findings
+}
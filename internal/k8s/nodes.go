@@ -0,0 +1,368 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	versioninfo "k8s.io/apimachinery/pkg/version"
+)
+
+// Node thresholds
+const (
+	// nodeFullPercent is the share of allocatable CPU or memory requested
+	// by pods above which a node is reported as full
+	nodeFullPercent = 90
+	// maxKubeletSkew is the number of minor versions a kubelet may lag the
+	// apiserver under the Kubernetes version skew policy
+	maxKubeletSkew = 3
+	// maxPendingNodes bounds how many nodes are listed for Pending pods;
+	// larger clusters only list the nodes with issues
+	maxPendingNodes = 50
+)
+
+// NodeInfo summarizes the health and capacity of a node. CPU is in
+// millicores and memory in bytes; requests are summed over all pods
+// scheduled on the node, not just the collected namespace.
+type NodeInfo struct {
+	Name          string `json:"name"`
+	Ready         string `json:"ready"` // Ready condition status: True, False or Unknown
+	Unschedulable bool   `json:"unschedulable,omitempty"`
+	// Conditions lists only abnormal conditions: Ready other than True and
+	// pressure or network conditions that are True
+	Conditions        []NodeCondition `json:"conditions,omitempty"`
+	Taints            []string        `json:"taints,omitempty"` // e.g. "dedicated=gpu:NoSchedule"
+	KubeletVersion    string          `json:"kubeletVersion,omitempty"`
+	AllocatableCPU    int64           `json:"allocatableCPU"`
+	RequestedCPU      int64           `json:"requestedCPU"`
+	AllocatableMemory int64           `json:"allocatableMemory"`
+	RequestedMemory   int64           `json:"requestedMemory"`
+	AllocatablePods   int64           `json:"allocatablePods"`
+	Pods              int64           `json:"pods"`
+	// UsedCPU and UsedMemory are the current usage from metrics-server,
+	// when installed
+	UsedCPU    int64 `json:"usedCPU,omitempty"`
+	UsedMemory int64 `json:"usedMemory,omitempty"`
+}
+
+// NodeCondition is a node status condition such as MemoryPressure
+type NodeCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// HasIssues reports whether the node is not ready, under pressure, cordoned
+// or nearly out of requestable CPU or memory
+func (n NodeInfo) HasIssues() bool {
+	return n.Ready != string(corev1.ConditionTrue) || n.Unschedulable || len(n.Conditions) > 0 || n.full()
+}
+
+// full reports whether pod requests use more than nodeFullPercent of the
+// node's allocatable CPU or memory
+func (n NodeInfo) full() bool {
+	return percent(n.RequestedCPU, n.AllocatableCPU) >= nodeFullPercent ||
+		percent(n.RequestedMemory, n.AllocatableMemory) >= nodeFullPercent
+}
+
+// percent returns part as a percentage of total, or 0 when total is unknown
+func percent(part, total int64) int64 {
+	if total <= 0 {
+		return 0
+	}
+	return part * 100 / total
+}
+
+// collectNodes records the nodes relevant to the collected pods: nodes
+// running them, nodes with issues and, while pods are Pending in a small
+// cluster, every node since any could be the scheduling target. Missing
+// RBAC for nodes becomes a warning.
+func (a *Aggregator) collectNodes(ctx context.Context, data *DiagnosticData) error {
+	nodes, err := listCached(ctx, a, "nodes", metav1.NamespaceAll, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Node, string, error) {
+		list, err := a.client.Clientset().CoreV1().Nodes().List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("nodes not collected: %v", err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Requests are summed over the pods of every namespace
+	requests, err := a.nodeRequests(ctx)
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("node requests not collected: %v", err))
+	} else if err != nil {
+		return err
+	}
+
+	hosting := make(map[string]bool)
+	pending := false
+	for _, pod := range data.Pods {
+		hosting[pod.NodeName] = true
+		if pod.Phase == string(corev1.PodPending) && pod.NodeName == "" {
+			pending = true
+		}
+	}
+
+	var infos []NodeInfo
+	for i := range nodes {
+		info := nodeInfo(&nodes[i], requests[nodes[i].Name])
+		if hosting[info.Name] || info.HasIssues() || (pending && len(nodes) <= maxPendingNodes) {
+			infos = append(infos, info)
+		}
+	}
+	data.Nodes = infos
+	data.Findings = append(data.Findings, checkNodes(infos)...)
+
+	serverVersion, err := a.serverVersion(ctx)
+	if err != nil {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("kubelet version skew not checked: %v", err))
+		return nil
+	}
+	data.Findings = append(data.Findings, checkKubeletSkew(serverVersion, nodes)...)
+	return nil
+}
+
+// nodeUsage is the resources requested by the pods on a node
+type nodeUsage struct {
+	cpu, memory, pods int64
+}
+
+// nodeRequests sums the CPU and memory requests of all non-terminated pods
+// by node
+func (a *Aggregator) nodeRequests(ctx context.Context) (map[string]nodeUsage, error) {
+	// The informer cache holds all pods; the API filters terminated ones
+	pods, cached := cachedList[corev1.Pod](a, "pods", metav1.NamespaceAll, "")
+	if !cached {
+		opts := metav1.ListOptions{FieldSelector: "status.phase!=Succeeded,status.phase!=Failed"}
+		var err error
+		pods, err = listAll(ctx, a, "pods", opts, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Pod, string, error) {
+			list, err := a.client.Clientset().CoreV1().Pods(metav1.NamespaceAll).List(ctx, opts)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	usage := make(map[string]nodeUsage)
+	for i := range pods {
+		node := pods[i].Spec.NodeName
+		if phase := pods[i].Status.Phase; node == "" || phase == corev1.PodSucceeded || phase == corev1.PodFailed {
+			continue
+		}
+		cpu, memory := podRequests(&pods[i])
+		u := usage[node]
+		u.cpu += cpu
+		u.memory += memory
+		u.pods++
+		usage[node] = u
+	}
+	return usage, nil
+}
+
+// podRequests returns the effective CPU (millicores) and memory requests of
+// a pod: the larger of the sum over its containers and its largest init
+// container, plus the pod overhead
+func podRequests(pod *corev1.Pod) (cpu, memory int64) {
+	for _, c := range pod.Spec.Containers {
+		cpu += c.Resources.Requests.Cpu().MilliValue()
+		memory += c.Resources.Requests.Memory().Value()
+	}
+	for _, c := range pod.Spec.InitContainers {
+		cpu = max(cpu, c.Resources.Requests.Cpu().MilliValue())
+		memory = max(memory, c.Resources.Requests.Memory().Value())
+	}
+	cpu += pod.Spec.Overhead.Cpu().MilliValue()
+	memory += pod.Spec.Overhead.Memory().Value()
+	return cpu, memory
+}
+
+// nodeInfo extracts the diagnostic view of a node
+func nodeInfo(node *corev1.Node, usage nodeUsage) NodeInfo {
+	info := NodeInfo{
+		Name:              node.Name,
+		Ready:             string(corev1.ConditionUnknown),
+		Unschedulable:     node.Spec.Unschedulable,
+		KubeletVersion:    node.Status.NodeInfo.KubeletVersion,
+		AllocatableCPU:    node.Status.Allocatable.Cpu().MilliValue(),
+		RequestedCPU:      usage.cpu,
+		AllocatableMemory: node.Status.Allocatable.Memory().Value(),
+		RequestedMemory:   usage.memory,
+		AllocatablePods:   node.Status.Allocatable.Pods().Value(),
+		Pods:              usage.pods,
+	}
+	for _, cond := range node.Status.Conditions {
+		abnormal := cond.Status == corev1.ConditionTrue
+		if cond.Type == corev1.NodeReady {
+			info.Ready = string(cond.Status)
+			abnormal = cond.Status != corev1.ConditionTrue
+		}
+		if abnormal {
+			info.Conditions = append(info.Conditions, NodeCondition{
+				Type:    string(cond.Type),
+				Status:  string(cond.Status),
+				Reason:  cond.Reason,
+				Message: cond.Message,
+			})
+		}
+	}
+	for _, t := range node.Spec.Taints {
+		taint := t.Key
+		if t.Value != "" {
+			taint += "=" + t.Value
+		}
+		info.Taints = append(info.Taints, taint+":"+string(t.Effect))
+	}
+	return info
+}
+
+// checkNodes flags nodes that are not ready, under pressure, cordoned or
+// full, since they explain Pending and evicted pods
+func checkNodes(nodes []NodeInfo) []Finding {
+	var findings []Finding
+	for _, n := range nodes {
+		object := "Node/" + n.Name
+		for _, cond := range n.Conditions {
+			switch {
+			case cond.Type == string(corev1.NodeReady):
+				findings = append(findings, Finding{
+					Rule:     "node-not-ready",
+					Severity: SeverityHigh,
+					Object:   object,
+					Message:  fmt.Sprintf("node is NotReady (Ready=%s, %s): %s; its pods are not running reliably and new pods are not scheduled there", cond.Status, cond.Reason, cond.Message),
+				})
+			case strings.HasSuffix(cond.Type, "Pressure"):
+				findings = append(findings, Finding{
+					Rule:     "node-pressure",
+					Severity: SeverityHigh,
+					Object:   object,
+					Message:  fmt.Sprintf("node reports %s: %s; the kubelet evicts pods and the scheduler avoids the node", cond.Type, cond.Message),
+				})
+			default:
+				findings = append(findings, Finding{
+					Rule:     "node-condition",
+					Severity: SeverityMedium,
+					Object:   object,
+					Message:  fmt.Sprintf("node reports %s=%s: %s", cond.Type, cond.Status, cond.Message),
+				})
+			}
+		}
+
+		if n.Unschedulable {
+			findings = append(findings, Finding{
+				Rule:     "node-cordoned",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message:  "node is cordoned (unschedulable); new pods are not placed on it",
+			})
+		}
+
+		if n.full() {
+			findings = append(findings, Finding{
+				Rule:     "node-full",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message: fmt.Sprintf("pod requests use %d%% of allocatable CPU (%s of %s cores) and %d%% of memory (%s of %s); new pods may not fit",
+					percent(n.RequestedCPU, n.AllocatableCPU), FormatCPU(n.RequestedCPU), FormatCPU(n.AllocatableCPU),
+					percent(n.RequestedMemory, n.AllocatableMemory), FormatMemory(n.RequestedMemory), FormatMemory(n.AllocatableMemory)),
+			})
+		}
+	}
+	return findings
+}
+
+// serverVersion queries the apiserver version
+func (a *Aggregator) serverVersion(ctx context.Context) (*version.Version, error) {
+	var info versioninfo.Info
+	err := a.apiCall(ctx, "querying server version", func(ctx context.Context) error {
+		raw, err := a.client.Clientset().Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, &info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return version.ParseGeneric(info.GitVersion)
+}
+
+// checkKubeletSkew flags kubelets newer than the apiserver or more than
+// maxKubeletSkew minor versions older, both unsupported by the Kubernetes
+// version skew policy. All nodes are checked, not only the listed ones.
+func checkKubeletSkew(server *version.Version, nodes []corev1.Node) []Finding {
+	// Group nodes by kubelet minor version so a large pool is reported once
+	byMinor := make(map[string][]string)
+	for i := range nodes {
+		kubelet, err := version.ParseGeneric(nodes[i].Status.NodeInfo.KubeletVersion)
+		if err != nil {
+			continue
+		}
+		minor := fmt.Sprintf("v%d.%d", kubelet.Major(), kubelet.Minor())
+		if kubelet.Major() != server.Major() {
+			continue
+		}
+		lag := int(server.Minor()) - int(kubelet.Minor())
+		if lag < 0 || lag > maxKubeletSkew {
+			byMinor[minor] = append(byMinor[minor], nodes[i].Name)
+		}
+	}
+
+	minors := make([]string, 0, len(byMinor))
+	for minor := range byMinor {
+		minors = append(minors, minor)
+	}
+	sort.Strings(minors)
+
+	serverMinor := fmt.Sprintf("v%d.%d", server.Major(), server.Minor())
+	var findings []Finding
+	for _, minor := range minors {
+		names := byMinor[minor]
+		sort.Strings(names)
+		findings = append(findings, Finding{
+			Rule:     "kubelet-version-skew",
+			Severity: SeverityMedium,
+			Object:   "Node/" + names[0],
+			Message: fmt.Sprintf("%d node(s) run kubelet %s against apiserver %s, outside the supported skew of up to %d minor versions older; upgrade the node pool",
+				len(names), minor, serverMinor, maxKubeletSkew),
+		})
+	}
+	return findings
+}
+
+// FormatCPU renders millicores as cores, e.g. "3.5" or "250m"
+func FormatCPU(millis int64) string {
+	if millis%1000 == 0 {
+		return fmt.Sprint(millis / 1000)
+	}
+	if millis < 1000 {
+		return fmt.Sprintf("%dm", millis)
+	}
+	return fmt.Sprintf("%.1f", float64(millis)/1000)
+}
+
+// FormatMemory renders bytes in binary units, e.g. "15.2Gi" or "512Mi"
+func FormatMemory(bytes int64) string {
+	const mi, gi = 1 << 20, 1 << 30
+	if bytes >= gi {
+		return fmt.Sprintf("%.1fGi", float64(bytes)/gi)
+	}
+	return fmt.Sprintf("%dMi", bytes/mi)
+}
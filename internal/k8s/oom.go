@@ -0,0 +1,49 @@
+package k8s
+
+import corev1 "k8s.io/api/core/v1"
+
+// exitCodeSIGKILL is the exit code of a container killed with SIGKILL, as
+// by the kernel OOM killer
+const exitCodeSIGKILL = 137
+
+// ContainerResources are the requests and limits of a container spec. CPU
+// is in millicores and memory in bytes; 0 means unset.
+type ContainerResources struct {
+	CPURequest    int64 `json:"cpuRequest,omitempty"`
+	CPULimit      int64 `json:"cpuLimit,omitempty"`
+	MemoryRequest int64 `json:"memoryRequest,omitempty"`
+	MemoryLimit   int64 `json:"memoryLimit,omitempty"`
+}
+
+// MemoryKill returns the termination of the current or, failing that, the
+// previous instance when it was OOMKilled or exited with code 137, else nil
+func (cs ContainerStatus) MemoryKill() *TerminationInfo {
+	for _, t := range []*TerminationInfo{cs.Termination, cs.LastTermination} {
+		if t != nil && t.OOMKilled() {
+			return t
+		}
+	}
+	for _, t := range []*TerminationInfo{cs.Termination, cs.LastTermination} {
+		if t != nil && t.ExitCode == exitCodeSIGKILL {
+			return t
+		}
+	}
+	return nil
+}
+
+// OOMKilled reports whether the kubelet says the instance was killed for
+// exceeding its memory limit. Exit code 137 alone may also be a failed
+// liveness probe or a child process killed by the OOM killer.
+func (t *TerminationInfo) OOMKilled() bool {
+	return t.Reason == "OOMKilled"
+}
+
+// containerResources returns the requests and limits of a container spec
+func containerResources(c *corev1.Container) *ContainerResources {
+	return &ContainerResources{
+		CPURequest:    c.Resources.Requests.Cpu().MilliValue(),
+		CPULimit:      c.Resources.Limits.Cpu().MilliValue(),
+		MemoryRequest: c.Resources.Requests.Memory().Value(),
+		MemoryLimit:   c.Resources.Limits.Memory().Value(),
+	}
+}
@@ -0,0 +1,31 @@
+package k8s
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podOwner resolves the workload that manages a pod from its controller
+// owner reference, e.g. "Deployment/api" or "StatefulSet/db". Pods owned
+// by a Deployment's ReplicaSet resolve to the Deployment, so pods from the
+// old and new ReplicaSets of a rollout share an owner. Returns "" for
+// unmanaged pods.
+func podOwner(pod *corev1.Pod) string {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return ""
+	}
+
+	if ref.Kind == "ReplicaSet" {
+		// Deployment ReplicaSets are named <deployment>-<pod-template-hash>;
+		// the hash is also on the pod, which avoids a ReplicaSet lookup
+		if hash := pod.Labels["pod-template-hash"]; hash != "" {
+			if name, ok := strings.CutSuffix(ref.Name, "-"+hash); ok {
+				return "Deployment/" + name
+			}
+		}
+	}
+	return ref.Kind + "/" + ref.Name
+}
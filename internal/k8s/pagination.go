@@ -0,0 +1,75 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// listPageSize is the number of items requested per list call
+	listPageSize = 500
+	// maxListRestarts bounds how often a list restarts after its continue
+	// token expired
+	maxListRestarts = 3
+)
+
+// listPageFunc fetches one page of a list and returns its items and the
+// continue token for the next page
+type listPageFunc[T any] func(ctx context.Context, opts metav1.ListOptions) ([]T, string, error)
+
+// listAll fetches every page of a list. Each page is bounded by APITimeout.
+// When the continue token expires mid-listing (410 Gone on a busy cluster),
+// the partial result is discarded and the list restarts from the first page
+// so the result is one consistent snapshot without duplicates.
+func listAll[T any](ctx context.Context, a *Aggregator, resource string, opts metav1.ListOptions, page listPageFunc[T]) ([]T, error) {
+	var err error
+	for attempt := 0; attempt <= maxListRestarts; attempt++ {
+		if attempt > 0 {
+			debugf("%s list expired while paginating, restarting (attempt %d/%d)", resource, attempt, maxListRestarts)
+		}
+
+		var items []T
+		items, err = listPages(ctx, a, resource, opts, page)
+		if !apierrors.IsResourceExpired(err) && !apierrors.IsGone(err) {
+			return items, err
+		}
+	}
+	return nil, fmt.Errorf("%s list expired %d times while paginating: %w", resource, maxListRestarts+1, err)
+}
+
+func listPages[T any](ctx context.Context, a *Aggregator, resource string, opts metav1.ListOptions, page listPageFunc[T]) ([]T, error) {
+	opts.Limit = listPageSize
+	opts.Continue = ""
+
+	var all []T
+	for {
+		var items []T
+		var next string
+		err := a.apiCall(ctx, "listing "+resource, func(ctx context.Context) error {
+			var err error
+			items, next, err = page(ctx, opts)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, items...)
+		if next == "" {
+			return all, nil
+		}
+		opts.Continue = next
+	}
+}
+
+// debugf logs diagnostic details when KUBEHELP_DEBUG is set
+func debugf(format string, args ...interface{}) {
+	if os.Getenv("KUBEHELP_DEBUG") != "" {
+		log.Printf("[debug] "+format, args...)
+	}
+}
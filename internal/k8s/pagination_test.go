@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// pagedPods serves five pods in pages of two from a fake clientset. The
+// second page fails with expired for the first failures attempts, as when
+// the continue token outlives the apiserver's compaction.
+type pagedPods struct {
+	expired    func() error
+	failures   int
+	firstPages int
+	limits     []int64
+}
+
+func (p *pagedPods) clientset() *fake.Clientset {
+	pods := make([]corev1.Pod, 5)
+	for i := range pods {
+		pods[i].Name = fmt.Sprintf("pod-%d", i)
+	}
+	client := fake.NewClientset()
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		opts := action.(k8stesting.ListActionImpl).GetListOptions()
+		p.limits = append(p.limits, opts.Limit)
+		switch opts.Continue {
+		case "":
+			p.firstPages++
+			return true, &corev1.PodList{ListMeta: metav1.ListMeta{Continue: "page-2"}, Items: pods[0:2]}, nil
+		case "page-2":
+			if p.failures > 0 {
+				p.failures--
+				return true, nil, p.expired()
+			}
+			return true, &corev1.PodList{ListMeta: metav1.ListMeta{Continue: "page-3"}, Items: pods[2:4]}, nil
+		case "page-3":
+			return true, &corev1.PodList{Items: pods[4:]}, nil
+		}
+		return true, nil, fmt.Errorf("unexpected continue token %q", opts.Continue)
+	})
+	return client
+}
+
+func listFakePods(ctx context.Context, client *fake.Clientset) ([]corev1.Pod, error) {
+	a := &Aggregator{opts: AggregatorOptions{APITimeout: time.Second}}
+	return listAll(ctx, a, "pods", metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Pod, string, error) {
+		list, err := client.CoreV1().Pods("default").List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+}
+
+var expiredErrors = map[string]func() error{
+	"ResourceExpired": func() error { return apierrors.NewResourceExpired("the provided continue parameter is too old") },
+	"Gone":            func() error { return apierrors.NewGone("continue token expired") },
+}
+
+func TestListAllRestartsWhenExpired(t *testing.T) {
+	for name, expired := range expiredErrors {
+		t.Run(name, func(t *testing.T) {
+			p := &pagedPods{expired: expired, failures: 2}
+			pods, err := listFakePods(context.Background(), p.clientset())
+			if err != nil {
+				t.Fatalf("listAll: %v", err)
+			}
+
+			var names []string
+			for _, pod := range pods {
+				names = append(names, pod.Name)
+			}
+			want := []string{"pod-0", "pod-1", "pod-2", "pod-3", "pod-4"}
+			if !slices.Equal(names, want) {
+				t.Errorf("pods = %v, want %v without duplicates", names, want)
+			}
+			if p.firstPages != 3 {
+				t.Errorf("first page fetched %d times, want 3 (two restarts)", p.firstPages)
+			}
+			for _, limit := range p.limits {
+				if limit != listPageSize {
+					t.Errorf("page requested with limit %d, want %d", limit, listPageSize)
+				}
+			}
+		})
+	}
+}
+
+func TestListAllStopsAfterMaxRestarts(t *testing.T) {
+	p := &pagedPods{expired: expiredErrors["ResourceExpired"], failures: 100}
+	pods, err := listFakePods(context.Background(), p.clientset())
+	if err == nil {
+		t.Fatalf("listAll succeeded with %d pods, want an error", len(pods))
+	}
+	if !apierrors.IsResourceExpired(err) {
+		t.Errorf("error %v does not wrap the expiry", err)
+	}
+	if pods != nil {
+		t.Errorf("partial result returned: %d pods", len(pods))
+	}
+	if want := maxListRestarts + 1; p.firstPages != want {
+		t.Errorf("list started %d times, want %d", p.firstPages, want)
+	}
+}
+
+func TestListAllReturnsOtherErrors(t *testing.T) {
+	forbidden := func() error {
+		return apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", fmt.Errorf("no RBAC"))
+	}
+	p := &pagedPods{expired: forbidden, failures: 1}
+	if _, err := listFakePods(context.Background(), p.clientset()); !apierrors.IsForbidden(err) {
+		t.Errorf("error = %v, want Forbidden", err)
+	}
+	if p.firstPages != 1 {
+		t.Errorf("list restarted %d times on a non-expiry error", p.firstPages-1)
+	}
+}
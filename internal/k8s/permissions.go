@@ -0,0 +1,224 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Permission is an API access collection needs
+type Permission struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group,omitempty"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	// Namespace is empty for cluster-scoped resources and for access to
+	// all namespaces
+	Namespace string `json:"namespace,omitempty"`
+	// ClusterScoped marks resources such as nodes that have no namespace
+	ClusterScoped bool `json:"clusterScoped,omitempty"`
+	// Required permissions abort collection when missing; without the
+	// others, collection skips what needs them with a warning
+	Required bool `json:"required,omitempty"`
+	// Purpose says what the permission is used for
+	Purpose string `json:"purpose"`
+}
+
+// String renders the permission like "kubectl auth can-i", e.g.
+// "list deployments.apps -n prod" or "get pods/log -n prod"
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource += "." + p.Group
+	}
+	if p.Subresource != "" {
+		resource += "/" + p.Subresource
+	}
+	switch {
+	case p.ClusterScoped:
+		return fmt.Sprintf("%s %s", p.Verb, resource)
+	case p.Namespace == "":
+		return fmt.Sprintf("%s %s -A", p.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s -n %s", p.Verb, resource, p.Namespace)
+}
+
+// PermissionCheck is the result of checking a Permission
+type PermissionCheck struct {
+	Permission
+	Allowed bool `json:"allowed"`
+	// Reason is the authorizer's explanation, if any
+	Reason string `json:"reason,omitempty"`
+}
+
+// MissingPermissionsError is returned by Preflight when required
+// permissions are denied
+type MissingPermissionsError struct {
+	Missing []PermissionCheck
+}
+
+func (e *MissingPermissionsError) Error() string {
+	missing := make([]string, len(e.Missing))
+	for i, check := range e.Missing {
+		missing[i] = check.String()
+	}
+	return fmt.Sprintf("missing required permissions: %s; run \"kubehelp permissions\" to see everything diagnose needs",
+		strings.Join(missing, ", "))
+}
+
+// Permissions lists the API access collecting namespace (empty: all
+// namespaces) needs with the aggregator's options, required ones first
+func (a *Aggregator) Permissions(namespace string) []Permission {
+	allNamespaces := namespace == ""
+	ns := func(verb, group, resource, purpose string) Permission {
+		return Permission{Verb: verb, Group: group, Resource: resource, Namespace: namespace, Purpose: purpose}
+	}
+	cluster := func(verb, group, resource, purpose string) Permission {
+		return Permission{Verb: verb, Group: group, Resource: resource, ClusterScoped: true, Purpose: purpose}
+	}
+
+	var perms []Permission
+	if allNamespaces {
+		namespaces := cluster("list", "", "namespaces", "find the namespaces to diagnose")
+		namespaces.Required = true
+		perms = append(perms, namespaces)
+	}
+	pods := ns("list", "", "pods", "pod and container status")
+	events := ns("list", "", "events", "Warning events explaining failures")
+	// Namespaces that cannot be read are skipped when collecting them all
+	pods.Required = !allNamespaces
+	events.Required = !allNamespaces
+	perms = append(perms, pods, events,
+		ns("list", "events.k8s.io", "events", "counts of repeated events; core events are read without it"),
+		ns("list", "apps", "deployments", "controller rollout status"),
+		ns("list", "apps", "replicasets", "controller rollout status"),
+		ns("list", "apps", "statefulsets", "controller rollout status"),
+		ns("list", "apps", "daemonsets", "controller rollout status"),
+		ns("get", "", "secrets", "Secret references of pods with config errors, image pull secrets and Ingress TLS"),
+		ns("get", "", "serviceaccounts", "image pull secrets and cloud identities of service accounts"),
+		ns("list", "", "secrets", "Helm release history"),
+		ns("get", "", "configmaps", "ConfigMap references of pods with config errors"),
+		ns("list", "metrics.k8s.io", "pods", "current usage from metrics-server"),
+		ns("list", "", "resourcequotas", "quota usage"),
+		ns("list", "", "limitranges", "LimitRange constraints"),
+		ns("list", "", "persistentvolumeclaims", "volume claims of Pending pods"),
+		cluster("list", "storage.k8s.io", "storageclasses", "volume binding modes"),
+		cluster("get", "", "persistentvolumes", "volumes behind failing claims"),
+		ns("list", "", "services", "Service endpoint checks"),
+		ns("list", "discovery.k8s.io", "endpointslices", "ready endpoints of Services"),
+		ns("list", "networking.k8s.io", "networkpolicies", "NetworkPolicies isolating pods"),
+		ns("list", "networking.k8s.io", "ingresses", "Ingress backend checks"),
+		cluster("list", "networking.k8s.io", "ingressclasses", "Ingress class checks"),
+		ns("list", "gateway.networking.k8s.io", "httproutes", "Gateway API route checks"),
+		cluster("list", "", "nodes", "node taints, labels and capacity Pending pods are checked against"),
+		Permission{Verb: "list", Resource: "pods", Purpose: "requested resources of all pods on the nodes"},
+	)
+	for _, gvr := range a.opts.CustomResources {
+		perms = append(perms, ns("list", gvr.Group, gvr.Resource, "status of "+customResourceName(gvr)))
+	}
+	if a.opts.CollectLogs {
+		logs := ns("get", "", "pods", "logs of unhealthy containers")
+		logs.Subresource = "log"
+		perms = append(perms, logs)
+	}
+	if a.opts.ProbeConnectivity {
+		perms = append(perms,
+			ns("create", "", "pods", "connectivity probe pod"),
+			ns("get", "", "pods", "status of the connectivity probe pod"),
+			ns("delete", "", "pods", "clean up the connectivity probe pod"),
+		)
+		if !a.opts.CollectLogs {
+			logs := ns("get", "", "pods", "output of the connectivity probe pod")
+			logs.Subresource = "log"
+			perms = append(perms, logs)
+		}
+	}
+	if a.opts.CollectNodes {
+		perms = append(perms, cluster("list", "metrics.k8s.io", "nodes", "current node usage from metrics-server"))
+	}
+	sort.SliceStable(perms, func(i, j int) bool { return perms[i].Required && !perms[j].Required })
+	return perms
+}
+
+// CheckPermissions asks the apiserver, with SelfSubjectAccessReviews,
+// whether the current identity has each permission
+func (c *Client) CheckPermissions(ctx context.Context, perms []Permission) ([]PermissionCheck, error) {
+	checks := make([]PermissionCheck, len(perms))
+	errs := make([]error, len(perms))
+	var wg sync.WaitGroup
+	for i, p := range perms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			review, err := c.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{
+						Namespace:   p.Namespace,
+						Verb:        p.Verb,
+						Group:       p.Group,
+						Resource:    p.Resource,
+						Subresource: p.Subresource,
+					},
+				},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to check %s: %w", p, err)
+				return
+			}
+			checks[i] = PermissionCheck{Permission: p, Allowed: review.Status.Allowed, Reason: review.Status.Reason}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return checks, nil
+}
+
+// Preflight checks the permissions collecting namespace (empty: all
+// namespaces) needs and returns a MissingPermissionsError naming the
+// required ones that are denied, rather than failing halfway through
+// collection. Clusters whose authorizer cannot be asked are not checked.
+func (a *Aggregator) Preflight(ctx context.Context, namespace string) error {
+	ctx, cancel := context.WithTimeout(ctx, a.opts.APITimeout)
+	defer cancel()
+
+	var required []Permission
+	for _, p := range a.Permissions(namespace) {
+		if p.Required {
+			required = append(required, p)
+		}
+	}
+	checks, err := a.client.CheckPermissions(ctx, required)
+	if err != nil {
+		return nil
+	}
+	var missing []PermissionCheck
+	for _, check := range checks {
+		if !check.Allowed {
+			missing = append(missing, check)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingPermissionsError{Missing: missing}
+	}
+	return nil
+}
+
+// Username returns the name the apiserver authenticates the client as. It
+// needs Kubernetes 1.28 or later.
+func (c *Client) Username(ctx context.Context) (string, error) {
+	review, err := c.clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the current user: %w", err)
+	}
+	return review.Status.UserInfo.Username, nil
+}
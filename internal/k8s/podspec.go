@@ -0,0 +1,343 @@
+package k8s
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxSpecEnvNames bounds the env var names listed per container; the rest
+// are counted
+const maxSpecEnvNames = 20
+
+// PodSpecSummary is the part of a pod spec that explains failures the
+// status alone does not, such as a nodeSelector no node matches, a
+// toleration missing for a tainted pool or a volume naming the wrong
+// Secret. Defaults and empty settings are left out; env values never
+// appear.
+type PodSpecSummary struct {
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// NodeSelector, e.g. "disktype=ssd"
+	NodeSelector []string `json:"nodeSelector,omitempty"`
+	// Affinity holds node and pod (anti-)affinity rules, e.g. "node
+	// required: topology.kubernetes.io/zone in (eu-1a)"
+	Affinity []string `json:"affinity,omitempty"`
+	// Tolerations, e.g. "dedicated=gpu:NoSchedule"; those added to every
+	// pod for not-ready and unreachable nodes are left out
+	Tolerations []string `json:"tolerations,omitempty"`
+	// TopologySpread, e.g. "maxSkew 1 per topology.kubernetes.io/zone
+	// (DoNotSchedule) of app=api"
+	TopologySpread []string `json:"topologySpread,omitempty"`
+	PriorityClass  string   `json:"priorityClass,omitempty"`
+	RuntimeClass   string   `json:"runtimeClass,omitempty"`
+	HostNetwork    bool     `json:"hostNetwork,omitempty"`
+	// SecurityContext is the pod security context, e.g. "runAsNonRoot",
+	// "fsGroup=2000"
+	SecurityContext []string `json:"securityContext,omitempty"`
+	// Volumes name each volume's source, e.g. "data: pvc data-db-0"
+	Volumes    []string               `json:"volumes,omitempty"`
+	Containers []ContainerSpecSummary `json:"containers,omitempty"`
+}
+
+// ContainerSpecSummary summarizes a container spec of a PodSpecSummary
+type ContainerSpecSummary struct {
+	Name string `json:"name"`
+	// Init marks init containers, including sidecars
+	Init bool `json:"init,omitempty"`
+	// Resources are the CPU and memory requests and limits, nil when none
+	// are set; ExtendedResources the others, e.g. "nvidia.com/gpu=1"
+	Resources         *ContainerResources `json:"resources,omitempty"`
+	ExtendedResources []string            `json:"extendedResources,omitempty"`
+	// Env holds env var names only, at most maxSpecEnvNames, then a count
+	Env     []string `json:"env,omitempty"`
+	EnvFrom []string `json:"envFrom,omitempty"`
+	// VolumeMounts, e.g. "data at /var/lib/data (ro)"
+	VolumeMounts []string `json:"volumeMounts,omitempty"`
+	// SecurityContext, e.g. "runAsUser=0", "privileged", "drop ALL"
+	SecurityContext []string `json:"securityContext,omitempty"`
+}
+
+// podSpecSummary summarizes the spec of a pod
+func podSpecSummary(pod *corev1.Pod) *PodSpecSummary {
+	spec := &pod.Spec
+	s := &PodSpecSummary{
+		ServiceAccount: spec.ServiceAccountName,
+		PriorityClass:  spec.PriorityClassName,
+		HostNetwork:    spec.HostNetwork,
+	}
+	if spec.RuntimeClassName != nil {
+		s.RuntimeClass = *spec.RuntimeClassName
+	}
+	for key, value := range spec.NodeSelector {
+		s.NodeSelector = append(s.NodeSelector, key+"="+value)
+	}
+	slices.Sort(s.NodeSelector)
+	s.Affinity = affinityRules(spec.Affinity)
+	for _, t := range spec.Tolerations {
+		if defaultToleration(t) {
+			continue
+		}
+		s.Tolerations = append(s.Tolerations, formatToleration(t))
+	}
+	for _, c := range spec.TopologySpreadConstraints {
+		rule := fmt.Sprintf("maxSkew %d per %s (%s)", c.MaxSkew, c.TopologyKey, c.WhenUnsatisfiable)
+		if c.LabelSelector != nil {
+			rule += " of " + metav1.FormatLabelSelector(c.LabelSelector)
+		}
+		s.TopologySpread = append(s.TopologySpread, rule)
+	}
+	s.SecurityContext = podSecurityContext(spec.SecurityContext)
+	for _, v := range spec.Volumes {
+		s.Volumes = append(s.Volumes, v.Name+": "+podVolumeSource(v.VolumeSource))
+	}
+	for i := range spec.InitContainers {
+		c := containerSpecSummary(&spec.InitContainers[i])
+		c.Init = true
+		s.Containers = append(s.Containers, c)
+	}
+	for i := range spec.Containers {
+		s.Containers = append(s.Containers, containerSpecSummary(&spec.Containers[i]))
+	}
+	return s
+}
+
+func containerSpecSummary(c *corev1.Container) ContainerSpecSummary {
+	s := ContainerSpecSummary{Name: c.Name}
+	if len(c.Resources.Requests)+len(c.Resources.Limits) > 0 {
+		if r := containerResources(c); *r != (ContainerResources{}) {
+			s.Resources = r
+		}
+	}
+	for name, quantity := range c.Resources.Requests {
+		if name != corev1.ResourceCPU && name != corev1.ResourceMemory {
+			s.ExtendedResources = append(s.ExtendedResources, fmt.Sprintf("%s=%s", name, quantity.String()))
+		}
+	}
+	for name, quantity := range c.Resources.Limits {
+		if _, requested := c.Resources.Requests[name]; !requested && name != corev1.ResourceCPU && name != corev1.ResourceMemory {
+			s.ExtendedResources = append(s.ExtendedResources, fmt.Sprintf("%s=%s (limit)", name, quantity.String()))
+		}
+	}
+	slices.Sort(s.ExtendedResources)
+	for i, env := range c.Env {
+		if i == maxSpecEnvNames {
+			s.Env = append(s.Env, fmt.Sprintf("... %d more", len(c.Env)-maxSpecEnvNames))
+			break
+		}
+		s.Env = append(s.Env, env.Name)
+	}
+	for _, from := range c.EnvFrom {
+		switch {
+		case from.ConfigMapRef != nil:
+			s.EnvFrom = append(s.EnvFrom, "configMap "+from.ConfigMapRef.Name)
+		case from.SecretRef != nil:
+			s.EnvFrom = append(s.EnvFrom, "secret "+from.SecretRef.Name)
+		}
+	}
+	for _, m := range c.VolumeMounts {
+		mount := m.Name + " at " + m.MountPath
+		if m.SubPath != "" {
+			mount += " (subPath " + m.SubPath + ")"
+		}
+		if m.ReadOnly {
+			mount += " (ro)"
+		}
+		s.VolumeMounts = append(s.VolumeMounts, mount)
+	}
+	s.SecurityContext = containerSecurityContext(c.SecurityContext)
+	return s
+}
+
+// affinityRules renders node affinity, pod affinity and pod anti-affinity
+func affinityRules(affinity *corev1.Affinity) []string {
+	if affinity == nil {
+		return nil
+	}
+	var rules []string
+	if na := affinity.NodeAffinity; na != nil {
+		if required := na.RequiredDuringSchedulingIgnoredDuringExecution; required != nil {
+			var terms []string
+			for _, term := range required.NodeSelectorTerms {
+				terms = append(terms, nodeSelectorTerm(term))
+			}
+			rules = append(rules, "node required: "+strings.Join(terms, " or "))
+		}
+		for _, preferred := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+			rules = append(rules, fmt.Sprintf("node preferred (weight %d): %s", preferred.Weight, nodeSelectorTerm(preferred.Preference)))
+		}
+	}
+	podRules := func(kind string, required []corev1.PodAffinityTerm, preferred []corev1.WeightedPodAffinityTerm) {
+		for _, term := range required {
+			rules = append(rules, fmt.Sprintf("%s required: %s", kind, podAffinityTerm(term)))
+		}
+		for _, term := range preferred {
+			rules = append(rules, fmt.Sprintf("%s preferred (weight %d): %s", kind, term.Weight, podAffinityTerm(term.PodAffinityTerm)))
+		}
+	}
+	if pa := affinity.PodAffinity; pa != nil {
+		podRules("pod affinity", pa.RequiredDuringSchedulingIgnoredDuringExecution, pa.PreferredDuringSchedulingIgnoredDuringExecution)
+	}
+	if paa := affinity.PodAntiAffinity; paa != nil {
+		podRules("pod anti-affinity", paa.RequiredDuringSchedulingIgnoredDuringExecution, paa.PreferredDuringSchedulingIgnoredDuringExecution)
+	}
+	return rules
+}
+
+// nodeSelectorTerm renders a term like "topology.kubernetes.io/zone in
+// (eu-1a,eu-1b), gpu exists"
+func nodeSelectorTerm(term corev1.NodeSelectorTerm) string {
+	var exprs []string
+	for _, e := range append(slices.Clone(term.MatchExpressions), term.MatchFields...) {
+		switch e.Operator {
+		case corev1.NodeSelectorOpExists, corev1.NodeSelectorOpDoesNotExist:
+			exprs = append(exprs, fmt.Sprintf("%s %s", e.Key, strings.ToLower(string(e.Operator))))
+		default:
+			exprs = append(exprs, fmt.Sprintf("%s %s (%s)", e.Key, strings.ToLower(string(e.Operator)), strings.Join(e.Values, ",")))
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// podAffinityTerm renders a term like "app=api per kubernetes.io/hostname"
+func podAffinityTerm(term corev1.PodAffinityTerm) string {
+	selector := "all pods"
+	if term.LabelSelector != nil {
+		selector = metav1.FormatLabelSelector(term.LabelSelector)
+	}
+	s := selector + " per " + term.TopologyKey
+	if len(term.Namespaces) > 0 {
+		s += " in " + strings.Join(term.Namespaces, ",")
+	}
+	return s
+}
+
+// defaultToleration reports whether the DefaultTolerationSeconds admission
+// plugin added the toleration, as it does to every pod
+func defaultToleration(t corev1.Toleration) bool {
+	return (t.Key == corev1.TaintNodeNotReady || t.Key == corev1.TaintNodeUnreachable) &&
+		t.Operator == corev1.TolerationOpExists && t.Effect == corev1.TaintEffectNoExecute &&
+		t.TolerationSeconds != nil && *t.TolerationSeconds == 300
+}
+
+// formatToleration renders a toleration like a taint, e.g.
+// "dedicated=gpu:NoSchedule", "gpu:NoSchedule" (exists) or "*" (all taints)
+func formatToleration(t corev1.Toleration) string {
+	s := t.Key
+	switch {
+	case s == "" && t.Operator == corev1.TolerationOpExists:
+		s = "*"
+	case t.Operator != corev1.TolerationOpExists:
+		s += "=" + t.Value
+	}
+	if t.Effect != "" {
+		s += ":" + string(t.Effect)
+	}
+	if t.TolerationSeconds != nil {
+		s += fmt.Sprintf(" for %ds", *t.TolerationSeconds)
+	}
+	return s
+}
+
+// podSecurityContext renders the settings of a pod security context
+func podSecurityContext(sc *corev1.PodSecurityContext) []string {
+	if sc == nil {
+		return nil
+	}
+	var settings []string
+	if sc.RunAsNonRoot != nil && *sc.RunAsNonRoot {
+		settings = append(settings, "runAsNonRoot")
+	}
+	if sc.RunAsUser != nil {
+		settings = append(settings, fmt.Sprintf("runAsUser=%d", *sc.RunAsUser))
+	}
+	if sc.RunAsGroup != nil {
+		settings = append(settings, fmt.Sprintf("runAsGroup=%d", *sc.RunAsGroup))
+	}
+	if sc.FSGroup != nil {
+		settings = append(settings, fmt.Sprintf("fsGroup=%d", *sc.FSGroup))
+	}
+	if sc.SeccompProfile != nil {
+		settings = append(settings, "seccomp="+string(sc.SeccompProfile.Type))
+	}
+	return settings
+}
+
+// containerSecurityContext renders the settings of a container security
+// context
+func containerSecurityContext(sc *corev1.SecurityContext) []string {
+	if sc == nil {
+		return nil
+	}
+	var settings []string
+	if sc.Privileged != nil && *sc.Privileged {
+		settings = append(settings, "privileged")
+	}
+	if sc.RunAsNonRoot != nil && *sc.RunAsNonRoot {
+		settings = append(settings, "runAsNonRoot")
+	}
+	if sc.RunAsUser != nil {
+		settings = append(settings, fmt.Sprintf("runAsUser=%d", *sc.RunAsUser))
+	}
+	if sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem {
+		settings = append(settings, "readOnlyRootFilesystem")
+	}
+	if sc.AllowPrivilegeEscalation != nil && !*sc.AllowPrivilegeEscalation {
+		settings = append(settings, "allowPrivilegeEscalation=false")
+	}
+	if caps := sc.Capabilities; caps != nil {
+		for _, c := range caps.Add {
+			settings = append(settings, "add "+string(c))
+		}
+		for _, c := range caps.Drop {
+			settings = append(settings, "drop "+string(c))
+		}
+	}
+	return settings
+}
+
+// podVolumeSource names the source of a pod volume, e.g. "pvc data-db-0",
+// "secret api-tls" or "emptyDir"
+func podVolumeSource(v corev1.VolumeSource) string {
+	switch {
+	case v.PersistentVolumeClaim != nil:
+		return "pvc " + v.PersistentVolumeClaim.ClaimName
+	case v.ConfigMap != nil:
+		return "configMap " + v.ConfigMap.Name
+	case v.Secret != nil:
+		return "secret " + v.Secret.SecretName
+	case v.EmptyDir != nil:
+		if v.EmptyDir.Medium == corev1.StorageMediumMemory {
+			return "emptyDir (memory)"
+		}
+		return "emptyDir"
+	case v.HostPath != nil:
+		return "hostPath " + v.HostPath.Path
+	case v.Projected != nil:
+		var sources []string
+		for _, p := range v.Projected.Sources {
+			switch {
+			case p.ConfigMap != nil:
+				sources = append(sources, "configMap "+p.ConfigMap.Name)
+			case p.Secret != nil:
+				sources = append(sources, "secret "+p.Secret.Name)
+			case p.ServiceAccountToken != nil:
+				sources = append(sources, "serviceAccountToken")
+			case p.DownwardAPI != nil:
+				sources = append(sources, "downwardAPI")
+			}
+		}
+		return "projected (" + strings.Join(sources, ", ") + ")"
+	case v.CSI != nil:
+		return "csi " + v.CSI.Driver
+	case v.Ephemeral != nil:
+		return "ephemeral pvc"
+	case v.DownwardAPI != nil:
+		return "downwardAPI"
+	case v.NFS != nil:
+		return fmt.Sprintf("nfs %s:%s", v.NFS.Server, v.NFS.Path)
+	}
+	return "other"
+}
@@ -0,0 +1,241 @@
+package k8s
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Probe kinds, as named in kubelet "Unhealthy" event messages
+const (
+	ProbeLiveness  = "Liveness"
+	ProbeReadiness = "Readiness"
+	ProbeStartup   = "Startup"
+)
+
+// ProbeInfo describes a container probe and how it has been failing
+type ProbeInfo struct {
+	Kind string `json:"kind"`
+	// Handler is what the probe checks, e.g. "HTTP GET :8080/health",
+	// "TCP :5432", "gRPC :9090" or "exec cat /tmp/ready"
+	Handler             string `json:"handler"`
+	InitialDelaySeconds int32  `json:"initialDelaySeconds,omitempty"`
+	TimeoutSeconds      int32  `json:"timeoutSeconds"`
+	PeriodSeconds       int32  `json:"periodSeconds"`
+	FailureThreshold    int32  `json:"failureThreshold"`
+	// Failures and LastFailure come from the kubelet's "Unhealthy" events
+	Failures    int32  `json:"failures,omitempty"`
+	LastFailure string `json:"lastFailure,omitempty"`
+	// Problem names a mismatch between the probe and the container spec,
+	// e.g. a port the container does not declare
+	Problem string `json:"problem,omitempty"`
+}
+
+// Spec summarizes the probe settings, e.g. "HTTP GET :8080/health (delay 0s,
+// timeout 1s, period 10s, failureThreshold 3)"
+func (p ProbeInfo) Spec() string {
+	return fmt.Sprintf("%s (delay %ds, timeout %ds, period %ds, failureThreshold %d)",
+		p.Handler, p.InitialDelaySeconds, p.TimeoutSeconds, p.PeriodSeconds, p.FailureThreshold)
+}
+
+// containerProbes describes the probes of a container and the ports it
+// declares, e.g. "8081/TCP (http)"
+func containerProbes(c *corev1.Container) ([]ProbeInfo, []string) {
+	var ports []string
+	for _, p := range c.Ports {
+		port := fmt.Sprintf("%d/%s", p.ContainerPort, p.Protocol)
+		if p.Name != "" {
+			port += " (" + p.Name + ")"
+		}
+		ports = append(ports, port)
+	}
+
+	var probes []ProbeInfo
+	for _, probe := range []struct {
+		kind string
+		spec *corev1.Probe
+	}{
+		{ProbeStartup, c.StartupProbe},
+		{ProbeLiveness, c.LivenessProbe},
+		{ProbeReadiness, c.ReadinessProbe},
+	} {
+		if probe.spec != nil {
+			probes = append(probes, probeInfo(probe.kind, probe.spec, c))
+		}
+	}
+	return probes, ports
+}
+
+// probeInfo describes a probe, applying the API defaults for unset settings
+func probeInfo(kind string, probe *corev1.Probe, c *corev1.Container) ProbeInfo {
+	info := ProbeInfo{
+		Kind:                kind,
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		TimeoutSeconds:      defaultInt32(probe.TimeoutSeconds, 1),
+		PeriodSeconds:       defaultInt32(probe.PeriodSeconds, 10),
+		FailureThreshold:    defaultInt32(probe.FailureThreshold, 3),
+	}
+
+	var port *intstr.IntOrString
+	switch h := probe.ProbeHandler; {
+	case h.HTTPGet != nil:
+		scheme := "HTTP"
+		if h.HTTPGet.Scheme == corev1.URISchemeHTTPS {
+			scheme = "HTTPS"
+		}
+		info.Handler = fmt.Sprintf("%s GET %s:%s%s", scheme, h.HTTPGet.Host, h.HTTPGet.Port.String(), h.HTTPGet.Path)
+		if h.HTTPGet.Host == "" {
+			port = &h.HTTPGet.Port
+		}
+	case h.TCPSocket != nil:
+		info.Handler = fmt.Sprintf("TCP %s:%s", h.TCPSocket.Host, h.TCPSocket.Port.String())
+		if h.TCPSocket.Host == "" {
+			port = &h.TCPSocket.Port
+		}
+	case h.GRPC != nil:
+		info.Handler = fmt.Sprintf("gRPC :%d", h.GRPC.Port)
+		grpcPort := intstr.FromInt32(h.GRPC.Port)
+		port = &grpcPort
+	case h.Exec != nil:
+		info.Handler = "exec " + strings.Join(h.Exec.Command, " ")
+	}
+	if port != nil {
+		info.Problem = probePortProblem(*port, c)
+	}
+	return info
+}
+
+// probePortProblem explains why a probe port does not match the ports the
+// container declares. Declaring ports is optional, so a numeric port is
+// only suspicious when the container declares others.
+func probePortProblem(port intstr.IntOrString, c *corev1.Container) string {
+	if port.Type == intstr.String {
+		for _, p := range c.Ports {
+			if p.Name == port.StrVal {
+				return ""
+			}
+		}
+		return fmt.Sprintf("named port %q is not declared by the container", port.StrVal)
+	}
+	if len(c.Ports) == 0 {
+		return ""
+	}
+	var declared []string
+	for _, p := range c.Ports {
+		if p.ContainerPort == port.IntVal {
+			return ""
+		}
+		declared = append(declared, strconv.Itoa(int(p.ContainerPort)))
+	}
+	return fmt.Sprintf("probe port %d is not among the container's declared ports (%s)", port.IntVal, strings.Join(declared, ", "))
+}
+
+func defaultInt32(v, def int32) int32 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// probeFieldPath extracts the container from an event's involved object
+// field path, e.g. "spec.containers{app}"
+var probeFieldPath = regexp.MustCompile(`^spec\.(?:initContainers|containers)\{(.+)\}$`)
+
+// correlateProbeFailures attaches the kubelet's "Unhealthy" events to the
+// probes of the failing containers and flags probes that fail or do not
+// match the container spec
+func correlateProbeFailures(pods []PodInfo, events []corev1.Event) []Finding {
+	index := make(map[string]*PodInfo, len(pods))
+	for i := range pods {
+		index[pods[i].Name] = &pods[i]
+	}
+
+	// Events are not sorted, so keep the message of the latest one
+	latest := make(map[*ProbeInfo]time.Time)
+	for i := range events {
+		e := &events[i]
+		if e.Reason != "Unhealthy" || e.InvolvedObject.Kind != "Pod" {
+			continue
+		}
+		pod, ok := index[e.InvolvedObject.Name]
+		if !ok {
+			continue
+		}
+		m := probeFieldPath.FindStringSubmatch(e.InvolvedObject.FieldPath)
+		if m == nil {
+			continue
+		}
+		probe := podProbe(pod, m[1], eventProbeKind(e.Message))
+		if probe == nil {
+			continue
+		}
+		probe.Failures += max(e.Count, 1)
+		if at := eventTime(*e); probe.LastFailure == "" || latest[probe].Before(at) {
+			probe.LastFailure = strings.TrimSpace(e.Message)
+			latest[probe] = at
+		}
+	}
+
+	var findings []Finding
+	for _, pod := range pods {
+		for _, cs := range pod.AllContainerStatuses() {
+			object := fmt.Sprintf("Pod/%s/%s", pod.Name, cs.Name)
+			for _, p := range cs.Probes {
+				switch {
+				case p.Failures > 0:
+					severity := SeverityHigh
+					if p.Kind == ProbeReadiness {
+						severity = SeverityMedium
+					}
+					message := fmt.Sprintf("%s probe %s failed %d times: %s",
+						strings.ToLower(p.Kind), p.Spec(), p.Failures, p.LastFailure)
+					if p.Problem != "" {
+						message += "; " + p.Problem
+					}
+					findings = append(findings, Finding{Rule: "probe-failing", Severity: severity, Object: object, Message: message})
+				case p.Problem != "":
+					findings = append(findings, Finding{
+						Rule:     "probe-port-mismatch",
+						Severity: SeverityMedium,
+						Object:   object,
+						Message:  fmt.Sprintf("%s probe %s: %s", strings.ToLower(p.Kind), p.Handler, p.Problem),
+					})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// eventProbeKind returns the probe kind an "Unhealthy" event message starts
+// with, e.g. "Readiness probe failed: ..."
+func eventProbeKind(message string) string {
+	for _, kind := range []string{ProbeLiveness, ProbeReadiness, ProbeStartup} {
+		if strings.HasPrefix(message, kind+" probe") {
+			return kind
+		}
+	}
+	return ""
+}
+
+// podProbe returns the named container's probe of kind, or nil
+func podProbe(p *PodInfo, container, kind string) *ProbeInfo {
+	for _, statuses := range [][]ContainerStatus{p.ContainerStatuses, p.InitContainerStatuses} {
+		for i := range statuses {
+			if statuses[i].Name != container {
+				continue
+			}
+			for j := range statuses[i].Probes {
+				if statuses[i].Probes[j].Kind == kind {
+					return &statuses[i].Probes[j]
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"kubehelp/internal/textutil"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// quotaNearlyFull is the fraction of a quota resource in use from which it
+// is shown in the prompt as nearly exhausted
+const quotaNearlyFull = 0.8
+
+// ResourceQuotaInfo summarizes a ResourceQuota and its usage
+type ResourceQuotaInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	// Scopes restrict the pods the quota counts, e.g. "BestEffort"
+	Scopes    []string        `json:"scopes,omitempty"`
+	Resources []QuotaResource `json:"resources"`
+}
+
+// QuotaResource is the usage of one resource a quota constrains
+type QuotaResource struct {
+	// Resource is e.g. "requests.cpu", "limits.memory" or "pods"
+	Resource string `json:"resource"`
+	Used     string `json:"used"`
+	Hard     string `json:"hard"`
+	// Fraction is Used divided by Hard, 1 or more when exhausted
+	Fraction float64 `json:"fraction"`
+}
+
+// Exhausted reports whether no more of the resource can be requested
+func (r QuotaResource) Exhausted() bool {
+	return r.Fraction >= 1
+}
+
+// NearlyFull reports whether the resource is at least 80% used
+func (r QuotaResource) NearlyFull() bool {
+	return r.Fraction >= quotaNearlyFull
+}
+
+// HasIssues reports whether a resource of the quota is at least 80% used
+func (q ResourceQuotaInfo) HasIssues() bool {
+	for _, r := range q.Resources {
+		if r.NearlyFull() {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitRangeInfo summarizes the constraints of a LimitRange
+type LimitRangeInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	// Limits are rendered per type and constraint, e.g.
+	// "Container max cpu=2" or "Container default memory=512Mi"
+	Limits []string `json:"limits"`
+}
+
+// collectQuotas records the ResourceQuotas and LimitRanges of the namespace
+// and flags exhausted quotas and pods the API rejected for exceeding a
+// quota or a LimitRange. Rejected pods are never created, so only the
+// FailedCreate events of their controllers show them. Missing RBAC becomes
+// a warning.
+func (a *Aggregator) collectQuotas(ctx context.Context, namespace string, workloads []string, events []corev1.Event, data *DiagnosticData) error {
+	quotas, err := listCached(ctx, a, "resourcequotas", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.ResourceQuota, string, error) {
+		list, err := a.client.Clientset().CoreV1().ResourceQuotas(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("resource quotas not collected: %v", err))
+	} else if err != nil {
+		return err
+	}
+	for i := range quotas {
+		data.ResourceQuotas = append(data.ResourceQuotas, resourceQuotaInfo(&quotas[i]))
+	}
+
+	limitRanges, err := listCached(ctx, a, "limitranges", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.LimitRange, string, error) {
+		list, err := a.client.Clientset().CoreV1().LimitRanges(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("limit ranges not collected: %v", err))
+	} else if err != nil {
+		return err
+	}
+	for i := range limitRanges {
+		data.LimitRanges = append(data.LimitRanges, limitRangeInfo(&limitRanges[i]))
+	}
+
+	data.Findings = append(data.Findings, checkQuotas(data.ResourceQuotas)...)
+	filtered := len(workloads) > 0 || a.opts.LabelSelector != ""
+	data.Findings = append(data.Findings, checkAdmissionRejections(events, filtered, workloads, data.Controllers, time.Now(), a.opts.EventsSince)...)
+	return nil
+}
+
+// resourceQuotaInfo extracts the usage of each resource a quota constrains,
+// sorted by resource name
+func resourceQuotaInfo(quota *corev1.ResourceQuota) ResourceQuotaInfo {
+	info := ResourceQuotaInfo{Name: quota.Name}
+	for _, scope := range quota.Spec.Scopes {
+		info.Scopes = append(info.Scopes, string(scope))
+	}
+	for name, hard := range quota.Status.Hard {
+		used := quota.Status.Used[name]
+		r := QuotaResource{Resource: string(name), Used: used.String(), Hard: hard.String()}
+		if hard.Sign() > 0 {
+			r.Fraction = used.AsApproximateFloat64() / hard.AsApproximateFloat64()
+		} else {
+			// A zero quota forbids the resource entirely
+			r.Fraction = 1
+		}
+		info.Resources = append(info.Resources, r)
+	}
+	sort.Slice(info.Resources, func(i, j int) bool { return info.Resources[i].Resource < info.Resources[j].Resource })
+	return info
+}
+
+// limitRangeInfo renders the constraints of a LimitRange, e.g.
+// "Container max cpu=2"
+func limitRangeInfo(lr *corev1.LimitRange) LimitRangeInfo {
+	info := LimitRangeInfo{Name: lr.Name}
+	for _, item := range lr.Spec.Limits {
+		for _, c := range []struct {
+			name   string
+			values corev1.ResourceList
+		}{
+			{"min", item.Min},
+			{"max", item.Max},
+			{"default", item.Default},
+			{"defaultRequest", item.DefaultRequest},
+			{"maxLimitRequestRatio", item.MaxLimitRequestRatio},
+		} {
+			if len(c.values) > 0 {
+				info.Limits = append(info.Limits, fmt.Sprintf("%s %s %s", item.Type, c.name, formatResourceList(c.values)))
+			}
+		}
+	}
+	return info
+}
+
+// formatResourceList renders resources sorted by name, e.g.
+// "cpu=500m memory=1Gi"
+func formatResourceList(list corev1.ResourceList) string {
+	var parts []string
+	for name, q := range list {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, q.String()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// checkQuotas flags quota resources that are used up, so new pods or
+// objects counting against them are rejected
+func checkQuotas(quotas []ResourceQuotaInfo) []Finding {
+	var findings []Finding
+	for _, q := range quotas {
+		var exhausted []string
+		for _, r := range q.Resources {
+			if r.Exhausted() {
+				exhausted = append(exhausted, fmt.Sprintf("%s %s/%s", r.Resource, r.Used, r.Hard))
+			}
+		}
+		if len(exhausted) == 0 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:     "quota-exhausted",
+			Severity: SeverityMedium,
+			Object:   "ResourceQuota/" + q.Name,
+			Message: fmt.Sprintf("quota is used up (%s); new objects needing these resources are rejected at admission, so such pods are never created rather than Pending",
+				strings.Join(exhausted, ", ")),
+		})
+	}
+	return findings
+}
+
+// checkAdmissionRejections flags controllers whose FailedCreate events
+// within window before now show pods rejected by a ResourceQuota or LimitRange. When pods are
+// filtered, only the collected controllers and the selected workloads are
+// checked.
+func checkAdmissionRejections(events []corev1.Event, filtered bool, workloads []string, controllers []ControllerStatus, now time.Time, window time.Duration) []Finding {
+	collected := make(map[string]bool)
+	for _, c := range controllers {
+		collected[c.Kind+"/"+c.Name] = true
+	}
+
+	latest := make(map[string]*corev1.Event)
+	var objects []string
+	for i := range events {
+		e := &events[i]
+		if e.Reason != "FailedCreate" || now.Sub(eventTime(*e)) > window || admissionRejection(e.Message) == "" {
+			continue
+		}
+		object := e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name
+		if filtered && !collected[object] && !matchesAnyWorkload(object, workloads) {
+			continue
+		}
+		if prev, ok := latest[object]; !ok {
+			objects = append(objects, object)
+		} else if !eventTime(*e).After(eventTime(*prev)) {
+			continue
+		}
+		latest[object] = e
+	}
+
+	var findings []Finding
+	for _, object := range objects {
+		e := latest[object]
+		rule := admissionRejection(e.Message)
+		cause := "a ResourceQuota"
+		if rule == "limitrange-rejected" {
+			cause = "a LimitRange"
+		}
+		findings = append(findings, Finding{
+			Rule:     rule,
+			Severity: SeverityHigh,
+			Object:   object,
+			Message: fmt.Sprintf("pods are rejected by %s, not by the scheduler, so they are never created: %s",
+				cause, textutil.Truncate(e.Message, 300)),
+		})
+	}
+	return findings
+}
+
+// admissionRejection classifies a FailedCreate message as a quota or
+// LimitRange rejection, returning the finding rule or ""
+func admissionRejection(message string) string {
+	switch {
+	case strings.Contains(message, "exceeded quota") || strings.Contains(message, "failed quota"):
+		return "quota-rejected"
+	case strings.Contains(message, "usage per Container") || strings.Contains(message, "usage per Pod") ||
+		strings.Contains(message, "limit to request ratio per"):
+		return "limitrange-rejected"
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// configRef is a reference from a pod to a Secret or ConfigMap, optionally
+// to a single key
+type configRef struct {
+	Kind   string // "Secret" or "ConfigMap"
+	Name   string
+	Key    string // empty for envFrom and whole-object volumes
+	Object string // referencing object, e.g. "Pod/api-7d8f9b/app"
+	Usage  string // e.g. "env DB_PASSWORD" or "volume config"
+}
+
+// configObject holds the keys of an existing Secret or ConfigMap; a nil
+// configObject means it does not exist
+type configObject struct {
+	keys map[string]bool
+}
+
+// checkReferences verifies that the Secrets and ConfigMaps the pods reference
+// exist and contain the referenced keys. Optional references are skipped.
+// Missing RBAC for reading Secrets or ConfigMaps becomes a warning.
+func (a *Aggregator) checkReferences(ctx context.Context, namespace string, pods []corev1.Pod, data *DiagnosticData) error {
+	objects := make(map[string]*configObject)
+	forbidden := make(map[string]bool)
+	// A missing object is reported once per referencing object, not per key
+	reported := make(map[string]bool)
+
+	seen := make(map[configRef]bool)
+	for i := range pods {
+		for _, ref := range podConfigRefs(&pods[i]) {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+
+			id := ref.Kind + "/" + ref.Name
+			obj, ok := objects[id]
+			if !ok {
+				if forbidden[ref.Kind] {
+					continue
+				}
+				var err error
+				obj, err = a.getConfigObject(ctx, namespace, ref.Kind, ref.Name)
+				if apierrors.IsForbidden(err) {
+					forbidden[ref.Kind] = true
+					data.Warnings = append(data.Warnings, fmt.Sprintf("%s references not checked: %v", ref.Kind, err))
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				objects[id] = obj
+			}
+
+			if obj == nil {
+				if reported[ref.Object+" "+id] {
+					continue
+				}
+				reported[ref.Object+" "+id] = true
+			}
+			if f, ok := missingReference(ref, obj); ok {
+				data.Findings = append(data.Findings, f)
+			}
+		}
+	}
+	return nil
+}
+
+// missingReference returns a finding when ref points at a missing object or key
+func missingReference(ref configRef, obj *configObject) (Finding, bool) {
+	switch {
+	case obj == nil:
+		return Finding{
+			Rule:     "missing-reference",
+			Severity: SeverityHigh,
+			Object:   ref.Object,
+			Message:  fmt.Sprintf("%s %s referenced by %s does not exist; the container cannot start (CreateContainerConfigError or stuck ContainerCreating)", ref.Kind, ref.Name, ref.Usage),
+		}, true
+	case ref.Key != "" && !obj.keys[ref.Key]:
+		return Finding{
+			Rule:     "missing-reference-key",
+			Severity: SeverityHigh,
+			Object:   ref.Object,
+			Message:  fmt.Sprintf("%s %s has no key %q referenced by %s", ref.Kind, ref.Name, ref.Key, ref.Usage),
+		}, true
+	}
+	return Finding{}, false
+}
+
+// getConfigObject fetches the key names of a Secret or ConfigMap. Values are
+// never kept.
+func (a *Aggregator) getConfigObject(ctx context.Context, namespace, kind, name string) (*configObject, error) {
+	obj := &configObject{keys: make(map[string]bool)}
+	err := a.apiCall(ctx, "getting "+kind+" "+name, func(ctx context.Context) error {
+		switch kind {
+		case "Secret":
+			secret, err := a.client.Clientset().CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			for key := range secret.Data {
+				obj.keys[key] = true
+			}
+			for key := range secret.StringData {
+				obj.keys[key] = true
+			}
+		default:
+			cm, err := a.client.Clientset().CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			for key := range cm.Data {
+				obj.keys[key] = true
+			}
+			for key := range cm.BinaryData {
+				obj.keys[key] = true
+			}
+		}
+		return nil
+	})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// podConfigRefs lists the required Secret and ConfigMap references of a pod's
+// containers (env, envFrom) and volumes. References are attributed to the
+// owning workload when there is one, so replicas are reported once.
+func podConfigRefs(pod *corev1.Pod) []configRef {
+	owner := podOwner(pod)
+	if owner == "" {
+		owner = "Pod/" + pod.Name
+	}
+
+	var refs []configRef
+	add := func(kind, name, key string, optional *bool, object, usage string) {
+		if name == "" || (optional != nil && *optional) {
+			return
+		}
+		refs = append(refs, configRef{Kind: kind, Name: name, Key: key, Object: object, Usage: usage})
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, c := range containers {
+		object := owner + "/" + c.Name
+		for _, e := range c.Env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			usage := "env " + e.Name
+			if ref := e.ValueFrom.SecretKeyRef; ref != nil {
+				add("Secret", ref.Name, ref.Key, ref.Optional, object, usage)
+			}
+			if ref := e.ValueFrom.ConfigMapKeyRef; ref != nil {
+				add("ConfigMap", ref.Name, ref.Key, ref.Optional, object, usage)
+			}
+		}
+		for _, src := range c.EnvFrom {
+			if ref := src.SecretRef; ref != nil {
+				add("Secret", ref.Name, "", ref.Optional, object, "envFrom")
+			}
+			if ref := src.ConfigMapRef; ref != nil {
+				add("ConfigMap", ref.Name, "", ref.Optional, object, "envFrom")
+			}
+		}
+	}
+
+	object := owner
+	for _, v := range pod.Spec.Volumes {
+		usage := "volume " + v.Name
+		if s := v.Secret; s != nil {
+			add("Secret", s.SecretName, "", s.Optional, object, usage)
+			for _, item := range s.Items {
+				add("Secret", s.SecretName, item.Key, s.Optional, object, usage)
+			}
+		}
+		if cm := v.ConfigMap; cm != nil {
+			add("ConfigMap", cm.Name, "", cm.Optional, object, usage)
+			for _, item := range cm.Items {
+				add("ConfigMap", cm.Name, item.Key, cm.Optional, object, usage)
+			}
+		}
+		if p := v.Projected; p != nil {
+			for _, src := range p.Sources {
+				if s := src.Secret; s != nil {
+					add("Secret", s.Name, "", s.Optional, object, usage)
+					for _, item := range s.Items {
+						add("Secret", s.Name, item.Key, s.Optional, object, usage)
+					}
+				}
+				if cm := src.ConfigMap; cm != nil {
+					add("ConfigMap", cm.Name, "", cm.Optional, object, usage)
+					for _, item := range cm.Items {
+						add("ConfigMap", cm.Name, item.Key, cm.Optional, object, usage)
+					}
+				}
+			}
+		}
+	}
+	return refs
+}
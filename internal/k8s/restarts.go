@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RestartBreakdownThreshold is the container restart count above which a
+// multi-container pod's summary lists restarts per container
+const RestartBreakdownThreshold int32 = 10
+
+// HasRestartBreakdown reports whether the pod has several containers and
+// one of them restarted more than RestartBreakdownThreshold times, so the
+// aggregate Restarts count alone would hide which container is flapping
+func (p PodInfo) HasRestartBreakdown() bool {
+	if len(p.ContainerStatuses) < 2 {
+		return false
+	}
+	for _, cs := range p.ContainerStatuses {
+		if cs.RestartCount > RestartBreakdownThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// RestartBreakdown lists restarts per container, e.g. "worker (312), sidecar (0)"
+func (p PodInfo) RestartBreakdown() string {
+	parts := make([]string, 0, len(p.ContainerStatuses))
+	for _, cs := range p.ContainerStatuses {
+		parts = append(parts, fmt.Sprintf("%s (%d)", cs.Name, cs.RestartCount))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DominantRestarter returns the container accounting for more than half of
+// the pod's restarts when the pod has a restart breakdown
+func (p PodInfo) DominantRestarter() (ContainerStatus, bool) {
+	if !p.HasRestartBreakdown() {
+		return ContainerStatus{}, false
+	}
+	var top ContainerStatus
+	var total int32
+	for _, cs := range p.ContainerStatuses {
+		total += cs.RestartCount
+		if cs.RestartCount > top.RestartCount {
+			top = cs
+		}
+	}
+	if top.RestartCount*2 <= total {
+		return ContainerStatus{}, false
+	}
+	return top, true
+}
+
+// checkRestarts flags the container responsible for most restarts of a
+// multi-container pod so instability is not attributed to the whole pod
+func checkRestarts(pods []PodInfo) []Finding {
+	var findings []Finding
+	for _, pod := range pods {
+		top, ok := pod.DominantRestarter()
+		if !ok {
+			continue
+		}
+		findings = append(findings, Finding{
+			Rule:     "container-restart-hotspot",
+			Severity: SeverityHigh,
+			Object:   fmt.Sprintf("Pod/%s/%s", pod.Name, top.Name),
+			Message: fmt.Sprintf("%d of the pod's %d restarts come from this container (%s); troubleshoot it rather than the whole pod",
+				top.RestartCount, pod.Restarts, pod.RestartBreakdown()),
+		})
+	}
+	return findings
+}
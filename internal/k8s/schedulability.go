@@ -0,0 +1,437 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// Scheduling matrix limits
+const (
+	// maxSchedulingMatrices bounds how many Pending workloads are checked
+	// against the nodes
+	maxSchedulingMatrices = 5
+	// maxMatrixNodes bounds the nodes listed per matrix; the nodes closest
+	// to fitting are kept and the rest only counted in Blockers
+	maxMatrixNodes = 20
+)
+
+// SchedulingChecks are the checks of a SchedulingMatrix in the order the
+// scheduler's filters run them
+var SchedulingChecks = []string{"ready", "taints", "selector", "affinity", "cpu", "memory", "pods", "extended"}
+
+// SchedulingMatrix explains why a Pending pod cannot be scheduled by
+// checking its tolerations, node selector, required node affinity and
+// requests against every node. Pod affinity, topology spread and volume
+// topology are not checked: when nodes pass every check, one of those is
+// the likely cause.
+type SchedulingMatrix struct {
+	Pod       string `json:"pod"`
+	Namespace string `json:"namespace,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	// Pending counts the Pending pods of Owner the matrix stands for
+	Pending int `json:"pending"`
+	// Reason is the scheduler's message, e.g. "0/3 nodes are available:
+	// 3 Insufficient cpu."
+	Reason        string   `json:"reason,omitempty"`
+	CPURequest    int64    `json:"cpuRequest"`
+	MemoryRequest int64    `json:"memoryRequest"`
+	NodeSelector  []string `json:"nodeSelector,omitempty"`
+	Affinity      []string `json:"affinity,omitempty"`
+	Tolerations   []string `json:"tolerations,omitempty"`
+	// Nodes holds the nodes closest to fitting first; OmittedNodes counts
+	// those left out
+	Nodes        []NodeFit `json:"nodes"`
+	OmittedNodes int       `json:"omittedNodes,omitempty"`
+	TotalNodes   int       `json:"totalNodes"`
+	// Fitting counts the nodes passing every check
+	Fitting int `json:"fitting"`
+	// Blockers counts by check the nodes failing it, over all nodes
+	Blockers map[string]int `json:"blockers,omitempty"`
+}
+
+// NodeFit is a row of a SchedulingMatrix
+type NodeFit struct {
+	Node string `json:"node"`
+	// Failed maps each failed check to why, e.g. "taints":
+	// "dedicated=gpu:NoSchedule" or "cpu": "250m free"
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// collectSchedulingMatrices checks the Pending pods the scheduler rejected
+// against every node, one pod per workload. Nodes are listed only when such
+// pods exist; missing RBAC for nodes becomes a warning.
+func (a *Aggregator) collectSchedulingMatrices(ctx context.Context, pods []corev1.Pod, events []corev1.Event, data *DiagnosticData) error {
+	var pending []*corev1.Pod
+	counts := make(map[string]int)
+	for i := range pods {
+		pod := &pods[i]
+		if !unschedulable(pod, events) {
+			continue
+		}
+		owner := podOwner(pod)
+		if owner == "" {
+			owner = "Pod/" + pod.Name
+		}
+		owner = Qualify(pod.Namespace, owner)
+		if counts[owner] == 0 {
+			pending = append(pending, pod)
+		}
+		counts[owner]++
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if len(pending) > maxSchedulingMatrices {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("scheduling checked for %d of %d Pending workloads", maxSchedulingMatrices, len(pending)))
+		pending = pending[:maxSchedulingMatrices]
+	}
+
+	nodes, err := listCached(ctx, a, "nodes", metav1.NamespaceAll, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Node, string, error) {
+		list, err := a.client.Clientset().CoreV1().Nodes().List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("scheduling of Pending pods not checked against nodes: %v", err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Without requests of other namespaces' pods, free resources are
+	// compared against allocatable
+	requests, err := a.nodeRequests(ctx)
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("node requests not collected, scheduling compared against allocatable resources: %v", err))
+	} else if err != nil {
+		return err
+	}
+
+	for _, pod := range pending {
+		owner := podOwner(pod)
+		key := owner
+		if key == "" {
+			key = "Pod/" + pod.Name
+		}
+		m := schedulingMatrix(pod, nodes, requests)
+		m.Owner = owner
+		m.Pending = counts[Qualify(pod.Namespace, key)]
+		m.Reason = unschedulableMessage(pod, events)
+		data.Scheduling = append(data.Scheduling, m)
+		data.Findings = append(data.Findings, checkSchedulingMatrix(m)...)
+	}
+	return nil
+}
+
+// unschedulable reports whether the scheduler rejected a Pending pod, by its
+// PodScheduled condition or a FailedScheduling event
+func unschedulable(pod *corev1.Pod, events []corev1.Event) bool {
+	if pod.Status.Phase != corev1.PodPending || pod.Spec.NodeName != "" {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			return true
+		}
+	}
+	return latestPodEvent(events, pod.Name, reasonFailedScheduling) != nil
+}
+
+// unschedulableMessage returns why the scheduler rejected a pod, from its
+// PodScheduled condition or else its latest FailedScheduling event
+func unschedulableMessage(pod *corev1.Pod, events []corev1.Event) string {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Message != "" {
+			return cond.Message
+		}
+	}
+	if e := latestPodEvent(events, pod.Name, reasonFailedScheduling); e != nil {
+		return e.Message
+	}
+	return ""
+}
+
+// schedulingMatrix checks a pod against each node
+func schedulingMatrix(pod *corev1.Pod, nodes []corev1.Node, requests map[string]nodeUsage) SchedulingMatrix {
+	cpu, memory := podRequests(pod)
+	m := SchedulingMatrix{
+		Pod:           pod.Name,
+		Namespace:     pod.Namespace,
+		CPURequest:    cpu,
+		MemoryRequest: memory,
+		TotalNodes:    len(nodes),
+		Blockers:      make(map[string]int),
+	}
+	for _, key := range slices.Sorted(maps.Keys(pod.Spec.NodeSelector)) {
+		m.NodeSelector = append(m.NodeSelector, key+"="+pod.Spec.NodeSelector[key])
+	}
+	if required := requiredNodeAffinity(pod); required != nil {
+		for _, term := range required.NodeSelectorTerms {
+			m.Affinity = append(m.Affinity, nodeSelectorTerm(term))
+		}
+	}
+	for _, t := range pod.Spec.Tolerations {
+		if !defaultToleration(t) {
+			m.Tolerations = append(m.Tolerations, formatToleration(t))
+		}
+	}
+
+	for i := range nodes {
+		fit := nodeFit(pod, &nodes[i], requests[nodes[i].Name], cpu, memory)
+		if len(fit.Failed) == 0 {
+			m.Fitting++
+		}
+		for check := range fit.Failed {
+			m.Blockers[check]++
+		}
+		m.Nodes = append(m.Nodes, fit)
+	}
+	sort.SliceStable(m.Nodes, func(i, j int) bool {
+		if len(m.Nodes[i].Failed) != len(m.Nodes[j].Failed) {
+			return len(m.Nodes[i].Failed) < len(m.Nodes[j].Failed)
+		}
+		return m.Nodes[i].Node < m.Nodes[j].Node
+	})
+	if len(m.Nodes) > maxMatrixNodes {
+		m.OmittedNodes = len(m.Nodes) - maxMatrixNodes
+		m.Nodes = m.Nodes[:maxMatrixNodes]
+	}
+	return m
+}
+
+// nodeFit runs the checks of a SchedulingMatrix for one node. A zero usage,
+// as when node requests were not collected, compares requests with
+// allocatable.
+func nodeFit(pod *corev1.Pod, node *corev1.Node, usage nodeUsage, cpu, memory int64) NodeFit {
+	fit := NodeFit{Node: node.Name, Failed: make(map[string]string)}
+
+	ready := corev1.ConditionUnknown
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			ready = cond.Status
+		}
+	}
+	if ready != corev1.ConditionTrue {
+		fit.Failed["ready"] = "Ready=" + string(ready)
+	}
+
+	var untolerated []string
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule || tolerated(pod.Spec.Tolerations, taint) {
+			continue
+		}
+		untolerated = append(untolerated, formatTaint(taint))
+	}
+	if len(untolerated) > 0 {
+		fit.Failed["taints"] = strings.Join(untolerated, ", ")
+	}
+
+	var mismatched []string
+	for _, key := range slices.Sorted(maps.Keys(pod.Spec.NodeSelector)) {
+		want := pod.Spec.NodeSelector[key]
+		if got, ok := node.Labels[key]; !ok {
+			mismatched = append(mismatched, fmt.Sprintf("%s=%s (unset)", key, want))
+		} else if got != want {
+			mismatched = append(mismatched, fmt.Sprintf("%s=%s (node: %s)", key, want, got))
+		}
+	}
+	if len(mismatched) > 0 {
+		fit.Failed["selector"] = strings.Join(mismatched, ", ")
+	}
+
+	if required := requiredNodeAffinity(pod); required != nil && !matchesNodeSelector(required, node) {
+		fit.Failed["affinity"] = "no required term matches"
+	}
+
+	allocCPU := node.Status.Allocatable.Cpu().MilliValue()
+	allocMemory := node.Status.Allocatable.Memory().Value()
+	if free := allocCPU - usage.cpu; cpu > free {
+		fit.Failed["cpu"] = FormatCPU(max(free, 0)) + " free"
+	}
+	if free := allocMemory - usage.memory; memory > free {
+		fit.Failed["memory"] = FormatMemory(max(free, 0)) + " free"
+	}
+	if allocPods := node.Status.Allocatable.Pods().Value(); usage.pods >= allocPods {
+		fit.Failed["pods"] = fmt.Sprintf("%d/%d pods", usage.pods, allocPods)
+	}
+
+	var missing []string
+	for name, request := range podExtendedRequests(pod) {
+		allocatable := node.Status.Allocatable[name]
+		if allocatable.Cmp(request) < 0 {
+			missing = append(missing, fmt.Sprintf("%s %s allocatable", name, allocatable.String()))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		fit.Failed["extended"] = strings.Join(missing, ", ")
+	}
+
+	if len(fit.Failed) == 0 {
+		fit.Failed = nil
+	}
+	return fit
+}
+
+// requiredNodeAffinity returns the node selector a pod must match, if any
+func requiredNodeAffinity(pod *corev1.Pod) *corev1.NodeSelector {
+	if a := pod.Spec.Affinity; a != nil && a.NodeAffinity != nil {
+		return a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	}
+	return nil
+}
+
+// tolerated reports whether any toleration tolerates taint
+func tolerated(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTaint renders a taint like NodeInfo.Taints, e.g.
+// "dedicated=gpu:NoSchedule"
+func formatTaint(t *corev1.Taint) string {
+	taint := t.Key
+	if t.Value != "" {
+		taint += "=" + t.Value
+	}
+	return taint + ":" + string(t.Effect)
+}
+
+// matchesNodeSelector reports whether a node matches any term of a required
+// node affinity; the terms are ORed and their expressions ANDed
+func matchesNodeSelector(selector *corev1.NodeSelector, node *corev1.Node) bool {
+	fields := labels.Set{"metadata.name": node.Name}
+	for _, term := range selector.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			// An empty term matches no objects
+			continue
+		}
+		if matchesRequirements(term.MatchExpressions, labels.Set(node.Labels)) && matchesRequirements(term.MatchFields, fields) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesRequirements reports whether set satisfies every node selector
+// requirement
+func matchesRequirements(requirements []corev1.NodeSelectorRequirement, set labels.Set) bool {
+	operators := map[corev1.NodeSelectorOperator]selection.Operator{
+		corev1.NodeSelectorOpIn:           selection.In,
+		corev1.NodeSelectorOpNotIn:        selection.NotIn,
+		corev1.NodeSelectorOpExists:       selection.Exists,
+		corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+		corev1.NodeSelectorOpGt:           selection.GreaterThan,
+		corev1.NodeSelectorOpLt:           selection.LessThan,
+	}
+	for _, r := range requirements {
+		op, ok := operators[r.Operator]
+		if !ok {
+			return false
+		}
+		requirement, err := labels.NewRequirement(r.Key, op, r.Values)
+		if err != nil || !requirement.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// podExtendedRequests returns the requests of a pod for resources other
+// than CPU, memory and ephemeral storage, such as nvidia.com/gpu or
+// hugepages, summed like podRequests
+func podExtendedRequests(pod *corev1.Pod) corev1.ResourceList {
+	extended := func(name corev1.ResourceName) bool {
+		return name != corev1.ResourceCPU && name != corev1.ResourceMemory && name != corev1.ResourceEphemeralStorage
+	}
+	requests := make(corev1.ResourceList)
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			if extended(name) {
+				sum := requests[name]
+				sum.Add(q)
+				requests[name] = sum
+			}
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, q := range c.Resources.Requests {
+			if sum := requests[name]; extended(name) && q.Cmp(sum) > 0 {
+				requests[name] = q
+			}
+		}
+	}
+	return requests
+}
+
+// checkSchedulingMatrix flags a constraint that rules out every node on its
+// own, and nodes passing every check, which point to a cause the matrix
+// does not cover
+func checkSchedulingMatrix(m SchedulingMatrix) []Finding {
+	if m.TotalNodes == 0 {
+		return nil
+	}
+	object := "Pod/" + m.Pod
+	if m.Fitting > 0 {
+		return []Finding{{
+			Rule:     "schedulable-nodes-available",
+			Severity: SeverityMedium,
+			Object:   object,
+			Message: fmt.Sprintf("%d of %d nodes meet the pod's tolerations, node selector, node affinity and requests; its rejection is due to pod (anti-)affinity, topology spread or volume zones, or capacity freed since",
+				m.Fitting, m.TotalNodes),
+		}}
+	}
+
+	var findings []Finding
+	for _, check := range SchedulingChecks {
+		if m.Blockers[check] < m.TotalNodes {
+			continue
+		}
+		var cause string
+		switch check {
+		case "ready":
+			cause = "no node is Ready"
+		case "taints":
+			cause = "every node has a taint the pod does not tolerate"
+			if len(m.Tolerations) > 0 {
+				cause += " (tolerations: " + strings.Join(m.Tolerations, ", ") + ")"
+			}
+		case "selector":
+			cause = "no node has the labels of its nodeSelector " + strings.Join(m.NodeSelector, ", ")
+		case "affinity":
+			cause = "no node matches its required node affinity " + strings.Join(m.Affinity, " or ")
+		case "cpu":
+			cause = fmt.Sprintf("no node has %s CPU cores free", FormatCPU(m.CPURequest))
+		case "memory":
+			cause = fmt.Sprintf("no node has %s memory free", FormatMemory(m.MemoryRequest))
+		case "pods":
+			cause = "every node runs its maximum number of pods"
+		case "extended":
+			cause = "no node offers the extended resources it requests"
+		}
+		findings = append(findings, Finding{
+			Rule:     "scheduling-constraint-unsatisfiable",
+			Severity: SeverityHigh,
+			Object:   object,
+			Message:  fmt.Sprintf("%s (%d nodes checked); the pod cannot schedule until this changes", cause, m.TotalNodes),
+		})
+	}
+	return findings
+}
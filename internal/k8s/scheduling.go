@@ -0,0 +1,138 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Event reasons emitted by the scheduler and cluster-autoscaler
+const (
+	reasonFailedScheduling  = "FailedScheduling"
+	reasonNotTriggerScaleUp = "NotTriggerScaleUp"
+	reasonTriggeredScaleUp  = "TriggeredScaleUp"
+)
+
+// checkScheduling explains why Pending pods are not scheduled by combining
+// the PodScheduled condition with scheduler and cluster-autoscaler events.
+// It distinguishes a full cluster that cannot scale up from one that is
+// scaling and from other causes such as taints or affinity.
+func checkScheduling(pods []PodInfo, events []corev1.Event) []Finding {
+	var findings []Finding
+
+	for _, pod := range pods {
+		if pod.Phase != string(corev1.PodPending) {
+			continue
+		}
+
+		failed := latestPodEvent(events, pod.Name, reasonFailedScheduling)
+		notScaled := latestPodEvent(events, pod.Name, reasonNotTriggerScaleUp)
+		scaled := latestPodEvent(events, pod.Name, reasonTriggeredScaleUp)
+
+		reason := unschedulableReason(pod)
+		if reason == "" && failed != nil {
+			reason = failed.Message
+		}
+		if reason == "" {
+			// Not a scheduling problem, e.g. pulling images on an assigned node
+			continue
+		}
+
+		object := "Pod/" + pod.Name
+		reason = strings.TrimSuffix(strings.TrimSpace(reason), ".")
+		pending := fmt.Sprintf("Pending for %s: %s", formatAge(pod.Age), reason)
+		insufficient := strings.Contains(reason, "Insufficient ")
+
+		switch {
+		case notScaled != nil && (scaled == nil || !eventTime(*scaled).After(eventTime(*notScaled))):
+			findings = append(findings, Finding{
+				Rule:     "scale-up-blocked",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  fmt.Sprintf("%s; cluster-autoscaler cannot add a node: %s", pending, notScaled.Message),
+			})
+		case scaled != nil:
+			findings = append(findings, Finding{
+				Rule:     "scale-up-in-progress",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message:  fmt.Sprintf("%s; waiting for cluster-autoscaler: %s", pending, scaled.Message),
+			})
+		case insufficient:
+			findings = append(findings, Finding{
+				Rule:     "insufficient-capacity",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  fmt.Sprintf("%s; no cluster-autoscaler activity seen, so the cluster may not autoscale", pending),
+			})
+		default:
+			findings = append(findings, Finding{
+				Rule:     "unschedulable",
+				Severity: SeverityMedium,
+				Object:   object,
+				Message:  pending,
+			})
+		}
+	}
+
+	return findings
+}
+
+// unschedulableReason returns the PodScheduled=False message, which lists
+// why each node was rejected, e.g. "0/3 nodes are available: 3 Insufficient cpu."
+func unschedulableReason(pod PodInfo) string {
+	for _, cond := range pod.Conditions {
+		if cond.Type == string(corev1.PodScheduled) && cond.Status == string(corev1.ConditionFalse) {
+			if cond.Message != "" {
+				return cond.Message
+			}
+			return cond.Reason
+		}
+	}
+	return ""
+}
+
+// latestPodEvent returns the most recent event with the given reason for a pod
+func latestPodEvent(events []corev1.Event, podName, reason string) *corev1.Event {
+	var latest *corev1.Event
+	for i := range events {
+		e := &events[i]
+		if e.Reason != reason || e.InvolvedObject.Kind != "Pod" || e.InvolvedObject.Name != podName {
+			continue
+		}
+		if latest == nil || eventTime(*e).After(eventTime(*latest)) {
+			latest = e
+		}
+	}
+	return latest
+}
+
+// eventTime returns when an event was last observed, falling back to the
+// events.k8s.io EventTime for events without legacy timestamps
+func eventTime(e corev1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time
+	case e.Series != nil && !e.Series.LastObservedTime.IsZero():
+		return e.Series.LastObservedTime.Time
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time
+	}
+	return e.FirstTimestamp.Time
+}
+
+// formatAge renders a duration like "2h15m" or "40s"
+func formatAge(d time.Duration) string {
+	if d >= time.Minute {
+		d = d.Round(time.Minute)
+	} else {
+		d = d.Round(time.Second)
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	return s
+}
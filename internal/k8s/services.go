@@ -0,0 +1,293 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// maxNearMisses bounds the pods named in a selector mismatch finding
+const maxNearMisses = 3
+
+// ServiceInfo summarizes a Service and the endpoints behind it
+type ServiceInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"` // set when collected cluster-wide
+	Type      string `json:"type"`
+	// Selector is the pod selector, e.g. "app=api,tier=web"
+	Selector string `json:"selector"`
+	// Ports are rendered as "port->targetPort/protocol", e.g. "80->http/TCP"
+	Ports []string `json:"ports,omitempty"`
+	// ReadyEndpoints and NotReadyEndpoints are counted from the Service's
+	// EndpointSlices
+	ReadyEndpoints    int `json:"readyEndpoints"`
+	NotReadyEndpoints int `json:"notReadyEndpoints"`
+	// MatchingPods is the number of collected pods the selector matches
+	MatchingPods int `json:"matchingPods"`
+}
+
+// HasIssues reports whether the Service has no ready endpoint, so requests
+// to it fail
+func (s ServiceInfo) HasIssues() bool {
+	return s.ReadyEndpoints == 0
+}
+
+// collectServices records the selector-based Services of the namespace with
+// their endpoint counts. When pods are filtered by workload or label
+// selector, only Services selecting the collected pods, nearly selecting
+// them (a likely typo) or named like a workload are kept. Without RBAC for
+// EndpointSlices, endpoints are estimated from pod readiness.
+func (a *Aggregator) collectServices(ctx context.Context, namespace string, workloads []string, pods []corev1.Pod, data *DiagnosticData) error {
+	filtered := len(workloads) > 0 || a.opts.LabelSelector != ""
+
+	items, err := listCached(ctx, a, "services", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.Service, string, error) {
+		list, err := a.client.Clientset().CoreV1().Services(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("services not collected: %v", err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var services []corev1.Service
+	for _, svc := range items {
+		// ExternalName and selector-less Services have no pods to check
+		if svc.Spec.Type == corev1.ServiceTypeExternalName || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		if filtered && !matchesAnyWorkload("Service/"+svc.Name, workloads) &&
+			len(matchingPods(svc.Spec.Selector, pods)) == 0 && len(nearMisses(svc.Spec.Selector, pods)) == 0 {
+			continue
+		}
+		services = append(services, svc)
+	}
+	if len(services) == 0 {
+		return nil
+	}
+
+	endpoints, err := a.endpointCounts(ctx, namespace)
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("endpoint slices not collected, endpoints are estimated from pod readiness: %v", err))
+		endpoints = nil
+	} else if err != nil {
+		return err
+	}
+
+	for i := range services {
+		svc := &services[i]
+		matching := matchingPods(svc.Spec.Selector, pods)
+		info := ServiceInfo{
+			Name:         svc.Name,
+			Type:         string(svc.Spec.Type),
+			Selector:     labels.FormatLabels(svc.Spec.Selector),
+			Ports:        servicePorts(svc),
+			MatchingPods: len(matching),
+		}
+		if endpoints != nil {
+			counts := endpoints[svc.Name]
+			info.ReadyEndpoints, info.NotReadyEndpoints = counts.ready, counts.notReady
+		} else {
+			for _, pod := range matching {
+				if podHealthy(pod) {
+					info.ReadyEndpoints++
+				} else {
+					info.NotReadyEndpoints++
+				}
+			}
+		}
+		data.Services = append(data.Services, info)
+		data.Findings = append(data.Findings, checkService(info, svc.Spec.Selector, pods)...)
+	}
+	return nil
+}
+
+// endpointCount is the number of ready and not-ready endpoints of a Service
+type endpointCount struct {
+	ready, notReady int
+}
+
+// endpointCounts counts the endpoints of every Service in the namespace from
+// its EndpointSlices. Endpoints without a Ready condition count as ready.
+func (a *Aggregator) endpointCounts(ctx context.Context, namespace string) (map[string]endpointCount, error) {
+	slices, err := listCached(ctx, a, "endpointslices", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]discoveryv1.EndpointSlice, string, error) {
+		list, err := a.client.Clientset().DiscoveryV1().EndpointSlices(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]endpointCount)
+	for _, slice := range slices {
+		service := slice.Labels[discoveryv1.LabelServiceName]
+		if service == "" {
+			continue
+		}
+		c := counts[service]
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready == nil || *ep.Conditions.Ready {
+				c.ready++
+			} else {
+				c.notReady++
+			}
+		}
+		counts[service] = c
+	}
+	return counts, nil
+}
+
+// matchingPods returns the non-terminated pods the selector matches
+func matchingPods(selector map[string]string, pods []corev1.Pod) []*corev1.Pod {
+	sel := labels.SelectorFromSet(selector)
+	var matched []*corev1.Pod
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if sel.Matches(labels.Set(pod.Labels)) {
+			matched = append(matched, pod)
+		}
+	}
+	return matched
+}
+
+// nearMiss is a pod that matches all but one key of a selector
+type nearMiss struct {
+	pod, key, want, got string
+}
+
+// nearMisses finds pods whose labels match every selector key but one, the
+// signature of a typo in the selector or the pod template labels. For a
+// single-key selector the pod's value must also be similar to the wanted one.
+func nearMisses(selector map[string]string, pods []corev1.Pod) []nearMiss {
+	if len(selector) == 0 {
+		return nil
+	}
+	var misses []nearMiss
+	for i := range pods {
+		var miss nearMiss
+		mismatches := 0
+		for key, want := range selector {
+			got, ok := pods[i].Labels[key]
+			if ok && got == want {
+				continue
+			}
+			mismatches++
+			if !ok {
+				got = "<unset>"
+			}
+			miss = nearMiss{pod: pods[i].Name, key: key, want: want, got: got}
+		}
+		if mismatches != 1 {
+			continue
+		}
+		if len(selector) == 1 && !similar(miss.got, miss.want) {
+			continue
+		}
+		misses = append(misses, miss)
+	}
+	sort.Slice(misses, func(i, j int) bool { return misses[i].pod < misses[j].pod })
+	return misses
+}
+
+// similar reports whether got is a likely typo of want: one edit apart, or
+// up to one edit per four characters of want, e.g. "api-sever" for
+// "api-server"
+func similar(got, want string) bool {
+	return editDistance(got, want) <= max(1, len(want)/4)
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// servicePorts renders the ports of a Service, e.g. "80->8080/TCP" or,
+// for NodePorts, "80:30080->8080/TCP"
+func servicePorts(svc *corev1.Service) []string {
+	var ports []string
+	for _, p := range svc.Spec.Ports {
+		port := fmt.Sprint(p.Port)
+		if p.NodePort != 0 {
+			port += fmt.Sprintf(":%d", p.NodePort)
+		}
+		target := p.TargetPort.String()
+		if target == "0" || target == "" {
+			target = fmt.Sprint(p.Port)
+		}
+		ports = append(ports, fmt.Sprintf("%s->%s/%s", port, target, p.Protocol))
+	}
+	return ports
+}
+
+// checkService flags Services without a ready endpoint, explaining whether
+// the selector matches no pod (naming near misses) or the matching pods are
+// not ready
+func checkService(s ServiceInfo, selector map[string]string, pods []corev1.Pod) []Finding {
+	if !s.HasIssues() {
+		return nil
+	}
+	object := "Service/" + s.Name
+
+	if s.MatchingPods == 0 {
+		message := fmt.Sprintf("selector %s matches no pod, so the Service has no endpoints and requests fail (503 or connection refused)", s.Selector)
+		if misses := nearMisses(selector, pods); len(misses) > 0 {
+			var hints []string
+			for i, m := range misses {
+				if i == maxNearMisses {
+					hints = append(hints, fmt.Sprintf("%d more", len(misses)-maxNearMisses))
+					break
+				}
+				hints = append(hints, fmt.Sprintf("%s has %s=%s instead of %s", m.pod, m.key, m.got, m.want))
+			}
+			message += "; likely a label typo: " + strings.Join(hints, ", ")
+		}
+		return []Finding{{
+			Rule:     "service-selector-mismatch",
+			Severity: SeverityHigh,
+			Object:   object,
+			Message:  message,
+		}}
+	}
+
+	return []Finding{{
+		Rule:     "service-no-ready-endpoints",
+		Severity: SeverityHigh,
+		Object:   object,
+		Message: fmt.Sprintf("%d pods match selector %s but no endpoint is ready (%d not ready); requests fail until a pod passes its readiness probe and exposes the target port",
+			s.MatchingPods, s.Selector, s.NotReadyEndpoints),
+	}}
+}
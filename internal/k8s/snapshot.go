@@ -0,0 +1,140 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Schema versions of serialized DiagnosticData. Files written before the
+// schemaVersion field existed carry no version and are treated as v1.
+//
+// Adding an optional field does not change the version: older files decode
+// with the field left zero, and older binaries ignore fields they do not
+// know. Renaming, removing or changing the type or meaning of a field needs
+// a new version and a migration step in MigrateDiagnosticData.
+const (
+	SchemaVersionV1 = "v1"
+	SchemaVersionV2 = "v2"
+
+	// CurrentSchemaVersion is the version written by this binary
+	CurrentSchemaVersion = SchemaVersionV2
+)
+
+// StdioPath is the path that makes SaveDiagnosticData write to stdout and
+// LoadDiagnosticData read from stdin
+const StdioPath = "-"
+
+// SaveDiagnosticData writes data as indented JSON to path
+func SaveDiagnosticData(path string, data *DiagnosticData) error {
+	if path == StdioPath {
+		return EncodeDiagnosticData(os.Stdout, data)
+	}
+
+	content, err := encodeDiagnosticData(data)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// EncodeDiagnosticData writes data as indented JSON to w, stamped with the
+// current schema version unless it carries one
+func EncodeDiagnosticData(w io.Writer, data *DiagnosticData) error {
+	content, err := encodeDiagnosticData(data)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(content, '\n')); err != nil {
+		return fmt.Errorf("failed to write diagnostic data: %w", err)
+	}
+	return nil
+}
+
+func encodeDiagnosticData(data *DiagnosticData) ([]byte, error) {
+	if data.SchemaVersion == "" {
+		data.SchemaVersion = CurrentSchemaVersion
+	}
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode diagnostic data: %w", err)
+	}
+	return content, nil
+}
+
+// LoadDiagnosticData reads a saved DiagnosticData file, or stdin for "-",
+// and migrates it to the current schema version
+func LoadDiagnosticData(path string) (*DiagnosticData, error) {
+	if path == StdioPath {
+		data, err := DecodeDiagnosticData(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stdin: %w", err)
+		}
+		return data, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	data, err := DecodeDiagnosticData(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// DecodeDiagnosticData decodes serialized DiagnosticData and migrates it to
+// the current schema version
+func DecodeDiagnosticData(r io.Reader) (*DiagnosticData, error) {
+	var data DiagnosticData
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid diagnostic data: %w", err)
+	}
+
+	if err := MigrateDiagnosticData(&data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// MigrateDiagnosticData upgrades data from an older schema version in place.
+// Data written by a newer kubehelp is rejected with an actionable error.
+func MigrateDiagnosticData(data *DiagnosticData) error {
+	version := data.SchemaVersion
+	if version == "" {
+		version = SchemaVersionV1
+	}
+
+	n, err := schemaVersionNumber(version)
+	if err != nil {
+		return err
+	}
+	current, _ := schemaVersionNumber(CurrentSchemaVersion)
+	if n > current {
+		return fmt.Errorf("diagnostic data schema %s is newer than supported %s; upgrade kubehelp to read it",
+			version, CurrentSchemaVersion)
+	}
+
+	// v1 -> v2: only the schemaVersion field was added; all other fields
+	// are unchanged so the data can be used as-is.
+	data.SchemaVersion = CurrentSchemaVersion
+	return nil
+}
+
+// schemaVersionNumber parses "vN" into N
+func schemaVersionNumber(version string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil || !strings.HasPrefix(version, "v") || n < 1 {
+		return 0, fmt.Errorf("unrecognized diagnostic data schema version %q", version)
+	}
+	return n, nil
+}
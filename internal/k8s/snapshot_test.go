@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDiagnosticDataMigratesV1(t *testing.T) {
+	// A v1 snapshot predates the schemaVersion field
+	v1 := `{
+  "namespace": "payments",
+  "pods": [{"name": "api-7d4b9", "phase": "Running", "ready": "0/1", "restarts": 12, "age": 3600000000000}],
+  "collectedAt": "2024-05-01T10:00:00Z"
+}`
+	data, err := DecodeDiagnosticData(strings.NewReader(v1))
+	if err != nil {
+		t.Fatalf("DecodeDiagnosticData: %v", err)
+	}
+	if data.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("SchemaVersion = %q, want %q", data.SchemaVersion, CurrentSchemaVersion)
+	}
+	if data.Namespace != "payments" || len(data.Pods) != 1 || data.Pods[0].Restarts != 12 {
+		t.Errorf("v1 fields not preserved: %+v", data)
+	}
+}
+
+func TestDecodeDiagnosticDataIgnoresUnknownFields(t *testing.T) {
+	// Fields added by later releases within the same version are optional
+	data, err := DecodeDiagnosticData(strings.NewReader(`{"schemaVersion": "v2", "namespace": "default", "addedLater": [1, 2]}`))
+	if err != nil {
+		t.Fatalf("DecodeDiagnosticData: %v", err)
+	}
+	if data.Namespace != "default" {
+		t.Errorf("Namespace = %q, want default", data.Namespace)
+	}
+}
+
+func TestDecodeDiagnosticDataRejectsVersions(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v3", "newer than supported"},
+		{"v10", "newer than supported"},
+		{"2", "unrecognized"},
+		{"vX", "unrecognized"},
+		{"v0", "unrecognized"},
+		{"v-1", "unrecognized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			_, err := DecodeDiagnosticData(strings.NewReader(`{"schemaVersion": "` + tt.version + `"}`))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeDiagnosticDataRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeDiagnosticData(&buf, &DiagnosticData{Namespace: "default"}); err != nil {
+		t.Fatalf("EncodeDiagnosticData: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"schemaVersion": "`+CurrentSchemaVersion+`"`) {
+		t.Errorf("encoded data is not stamped with %s:\n%s", CurrentSchemaVersion, buf.String())
+	}
+	data, err := DecodeDiagnosticData(&buf)
+	if err != nil {
+		t.Fatalf("DecodeDiagnosticData: %v", err)
+	}
+	if data.Namespace != "default" || data.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("round trip = %+v", data)
+	}
+}
@@ -0,0 +1,452 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxClaimEvents bounds the events kept per PersistentVolumeClaim
+const maxClaimEvents = 3
+
+// defaultClassAnnotation marks the default StorageClass
+const defaultClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// Event reasons of failed volume mounts and attachments on pods
+var mountFailureReasons = []string{"FailedMount", "FailedAttachVolume", "FailedMapVolume"}
+
+// VolumeClaimInfo describes a PersistentVolumeClaim and the volume bound to it
+type VolumeClaimInfo struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace,omitempty"` // set when collected cluster-wide
+	Phase        string `json:"phase"`
+	StorageClass string `json:"storageClass,omitempty"`
+	// BindingMode is the storage class volumeBindingMode, e.g. "WaitForFirstConsumer"
+	BindingMode string   `json:"bindingMode,omitempty"`
+	Requested   string   `json:"requested,omitempty"` // e.g. "10Gi"
+	Capacity    string   `json:"capacity,omitempty"`
+	AccessModes []string `json:"accessModes,omitempty"`
+	VolumeName  string   `json:"volumeName,omitempty"`
+	// Volume is the bound PersistentVolume; it is only fetched for claims
+	// that are not Bound or are used by unhealthy pods
+	Volume *VolumeInfo `json:"volume,omitempty"`
+	// Pods lists the collected pods using the claim
+	Pods []string `json:"pods,omitempty"`
+	// Events holds the latest claim events, e.g. "ProvisioningFailed: ...",
+	// including Normal events such as FailedBinding
+	Events []string `json:"events,omitempty"`
+}
+
+// VolumeInfo describes a PersistentVolume
+type VolumeInfo struct {
+	Name          string `json:"name"`
+	Phase         string `json:"phase"`
+	ReclaimPolicy string `json:"reclaimPolicy,omitempty"`
+	// Source is the CSI driver or volume plugin, e.g. "ebs.csi.aws.com" or "nfs"
+	Source  string `json:"source,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// HasIssues reports whether the claim is not Bound or its volume is not
+// Bound
+func (c VolumeClaimInfo) HasIssues() bool {
+	if c.Phase != string(corev1.ClaimBound) {
+		return true
+	}
+	return c.Volume != nil && c.Volume.Phase != string(corev1.VolumeBound)
+}
+
+// waitingForConsumer reports whether a Pending claim is expected to stay
+// Pending because its storage class delays binding until a pod uses it
+func (c VolumeClaimInfo) waitingForConsumer() bool {
+	return c.Phase == string(corev1.ClaimPending) &&
+		c.BindingMode == string(storagev1.VolumeBindingWaitForFirstConsumer) && len(c.Pods) == 0
+}
+
+// collectVolumeClaims records the PersistentVolumeClaims used by the pods
+// and, when pods are not filtered, every claim in the namespace, together
+// with their storage class, recent events and, for claims with problems,
+// the bound volume. Missing RBAC becomes a warning.
+func (a *Aggregator) collectVolumeClaims(ctx context.Context, namespace string, workloads []string, pods []corev1.Pod, events []corev1.Event, data *DiagnosticData) error {
+	filtered := len(workloads) > 0 || a.opts.LabelSelector != ""
+	users := podClaims(pods)
+	if filtered && len(users) == 0 {
+		return nil
+	}
+
+	items, err := listCached(ctx, a, "persistentvolumeclaims", namespace, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]corev1.PersistentVolumeClaim, string, error) {
+		list, err := a.client.Clientset().CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("volume claims not collected: %v", err))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]bool)
+	var claims []corev1.PersistentVolumeClaim
+	for _, claim := range items {
+		found[claim.Name] = true
+		if !filtered || len(users[claim.Name]) > 0 {
+			claims = append(claims, claim)
+		}
+	}
+	data.Findings = append(data.Findings, checkMissingClaims(users, found)...)
+	if len(claims) == 0 {
+		return nil
+	}
+
+	classes, err := a.storageClasses(ctx)
+	if apierrors.IsForbidden(err) {
+		data.Warnings = append(data.Warnings, fmt.Sprintf("storage classes not checked: %v", err))
+	} else if err != nil {
+		return err
+	}
+
+	unhealthy := make(map[string]bool)
+	for i := range pods {
+		if !podHealthy(&pods[i]) {
+			unhealthy[pods[i].Name] = true
+		}
+	}
+
+	volumesForbidden := false
+	for i := range claims {
+		info := volumeClaimInfo(&claims[i], users[claims[i].Name], events)
+		if class, ok := classes[info.StorageClass]; ok && class.VolumeBindingMode != nil {
+			info.BindingMode = string(*class.VolumeBindingMode)
+		}
+
+		needsVolume := info.Phase != string(corev1.ClaimBound)
+		for _, pod := range info.Pods {
+			needsVolume = needsVolume || unhealthy[pod]
+		}
+		if info.VolumeName != "" && needsVolume && !volumesForbidden {
+			volume, err := a.persistentVolume(ctx, info.VolumeName)
+			if apierrors.IsForbidden(err) {
+				volumesForbidden = true
+				data.Warnings = append(data.Warnings, fmt.Sprintf("persistent volumes not collected: %v", err))
+			} else if err != nil {
+				return err
+			}
+			info.Volume = volume
+		}
+		data.VolumeClaims = append(data.VolumeClaims, info)
+	}
+	data.Findings = append(data.Findings, checkVolumeClaims(data.VolumeClaims, classes)...)
+	return nil
+}
+
+// podClaims maps the name of each PersistentVolumeClaim the pods use,
+// including generic ephemeral volumes, to the names of those pods
+func podClaims(pods []corev1.Pod) map[string][]string {
+	users := make(map[string][]string)
+	for i := range pods {
+		pod := &pods[i]
+		for _, volume := range pod.Spec.Volumes {
+			var claim string
+			switch {
+			case volume.PersistentVolumeClaim != nil:
+				claim = volume.PersistentVolumeClaim.ClaimName
+			case volume.Ephemeral != nil:
+				claim = pod.Name + "-" + volume.Name
+			default:
+				continue
+			}
+			users[claim] = append(users[claim], pod.Name)
+		}
+	}
+	return users
+}
+
+// podHealthy reports whether a pod completed or runs with all containers ready
+func podHealthy(pod *corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded {
+		return true
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if !cs.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+func volumeClaimInfo(claim *corev1.PersistentVolumeClaim, pods []string, events []corev1.Event) VolumeClaimInfo {
+	info := VolumeClaimInfo{
+		Name:       claim.Name,
+		Phase:      string(claim.Status.Phase),
+		VolumeName: claim.Spec.VolumeName,
+		Pods:       pods,
+	}
+	if claim.Spec.StorageClassName != nil {
+		info.StorageClass = *claim.Spec.StorageClassName
+	}
+	if q, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		info.Requested = q.String()
+	}
+	if q, ok := claim.Status.Capacity[corev1.ResourceStorage]; ok {
+		info.Capacity = q.String()
+	}
+	for _, mode := range claim.Spec.AccessModes {
+		info.AccessModes = append(info.AccessModes, string(mode))
+	}
+	info.Events = claimEvents(events, claim.Name)
+	return info
+}
+
+// claimEvents returns the latest events of a claim as "Reason: message",
+// oldest first
+func claimEvents(events []corev1.Event, claim string) []string {
+	var matched []corev1.Event
+	for _, e := range events {
+		if e.InvolvedObject.Kind == "PersistentVolumeClaim" && e.InvolvedObject.Name == claim {
+			matched = append(matched, e)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return eventTime(matched[i]).Before(eventTime(matched[j]))
+	})
+	if len(matched) > maxClaimEvents {
+		matched = matched[len(matched)-maxClaimEvents:]
+	}
+
+	var out []string
+	for _, e := range matched {
+		out = append(out, fmt.Sprintf("%s: %s", e.Reason, strings.TrimSpace(e.Message)))
+	}
+	return out
+}
+
+// storageClasses returns all storage classes by name
+func (a *Aggregator) storageClasses(ctx context.Context) (map[string]storagev1.StorageClass, error) {
+	items, err := listCached(ctx, a, "storageclasses", metav1.NamespaceAll, metav1.ListOptions{}, func(ctx context.Context, opts metav1.ListOptions) ([]storagev1.StorageClass, string, error) {
+		list, err := a.client.Clientset().StorageV1().StorageClasses().List(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return list.Items, list.Continue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	classes := make(map[string]storagev1.StorageClass, len(items))
+	for _, class := range items {
+		classes[class.Name] = class
+	}
+	return classes, nil
+}
+
+// persistentVolume fetches a PersistentVolume; a missing volume is nil
+func (a *Aggregator) persistentVolume(ctx context.Context, name string) (*VolumeInfo, error) {
+	var pv *corev1.PersistentVolume
+	err := a.apiCall(ctx, "getting PersistentVolume "+name, func(ctx context.Context) error {
+		var err error
+		pv, err = a.client.Clientset().CoreV1().PersistentVolumes().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &VolumeInfo{
+		Name:          pv.Name,
+		Phase:         string(pv.Status.Phase),
+		ReclaimPolicy: string(pv.Spec.PersistentVolumeReclaimPolicy),
+		Source:        volumeSource(pv),
+		Reason:        pv.Status.Reason,
+		Message:       pv.Status.Message,
+	}, nil
+}
+
+// volumeSource names the CSI driver or the in-tree plugin of a volume
+func volumeSource(pv *corev1.PersistentVolume) string {
+	src := pv.Spec.PersistentVolumeSource
+	switch {
+	case src.CSI != nil:
+		return src.CSI.Driver
+	case src.NFS != nil:
+		return "nfs"
+	case src.HostPath != nil:
+		return "hostPath"
+	case src.Local != nil:
+		return "local"
+	case src.ISCSI != nil:
+		return "iscsi"
+	case src.FC != nil:
+		return "fc"
+	}
+	return ""
+}
+
+// checkMissingClaims flags pods that use a claim that does not exist; they
+// stay Pending with "persistentvolumeclaim not found"
+func checkMissingClaims(users map[string][]string, found map[string]bool) []Finding {
+	var missing []string
+	for claim := range users {
+		if !found[claim] {
+			missing = append(missing, claim)
+		}
+	}
+	sort.Strings(missing)
+
+	var findings []Finding
+	for _, claim := range missing {
+		findings = append(findings, Finding{
+			Rule:     "missing-volume-claim",
+			Severity: SeverityHigh,
+			Object:   "PersistentVolumeClaim/" + claim,
+			Message:  fmt.Sprintf("claim does not exist but is used by %s, which cannot be scheduled", strings.Join(users[claim], ", ")),
+		})
+	}
+	return findings
+}
+
+// checkVolumeClaims flags Lost and Pending claims, explaining pending ones
+// by a missing storage class or default class where possible, and volumes
+// that are Failed or Released. classes may be nil when they could not be
+// read.
+func checkVolumeClaims(claims []VolumeClaimInfo, classes map[string]storagev1.StorageClass) []Finding {
+	var findings []Finding
+	for _, c := range claims {
+		object := "PersistentVolumeClaim/" + c.Name
+		latest := ""
+		if len(c.Events) > 0 {
+			latest = "; latest event: " + c.Events[len(c.Events)-1]
+		}
+
+		switch {
+		case c.Phase == string(corev1.ClaimLost):
+			findings = append(findings, Finding{
+				Rule:     "pvc-lost",
+				Severity: SeverityCritical,
+				Object:   object,
+				Message:  fmt.Sprintf("claim lost its volume %s; pods using it cannot start and its data may be gone", c.VolumeName),
+			})
+		case c.Phase != string(corev1.ClaimPending) || c.waitingForConsumer():
+		case classes != nil && c.StorageClass != "" && !hasClass(classes, c.StorageClass):
+			findings = append(findings, Finding{
+				Rule:     "storage-class-missing",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  fmt.Sprintf("claim is Pending: storage class %q does not exist (available: %s)", c.StorageClass, classNames(classes)),
+			})
+		case classes != nil && c.StorageClass == "" && defaultClass(classes) == "":
+			findings = append(findings, Finding{
+				Rule:     "no-default-storage-class",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  fmt.Sprintf("claim is Pending: it names no storage class and the cluster has no default, so it waits for a matching pre-provisioned volume%s", latest),
+			})
+		default:
+			details := "storage class " + c.StorageClass
+			if c.StorageClass == "" {
+				details = "default storage class"
+			}
+			if c.Requested != "" {
+				details += ", " + c.Requested + " requested"
+			}
+			findings = append(findings, Finding{
+				Rule:     "pvc-pending",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  fmt.Sprintf("claim is Pending (%s), blocking the pods that use it%s", details, latest),
+			})
+		}
+
+		if v := c.Volume; v != nil && (v.Phase == string(corev1.VolumeFailed) || v.Phase == string(corev1.VolumeReleased)) {
+			message := fmt.Sprintf("volume %s is %s", v.Name, v.Phase)
+			if v.Message != "" {
+				message += ": " + v.Message
+			}
+			findings = append(findings, Finding{
+				Rule:     "pv-not-bound",
+				Severity: SeverityHigh,
+				Object:   object,
+				Message:  message,
+			})
+		}
+	}
+	return findings
+}
+
+// hasClass reports whether the named storage class exists
+func hasClass(classes map[string]storagev1.StorageClass, name string) bool {
+	_, ok := classes[name]
+	return ok
+}
+
+// defaultClass returns the name of the default storage class, if any
+func defaultClass(classes map[string]storagev1.StorageClass) string {
+	for name, class := range classes {
+		if class.Annotations[defaultClassAnnotation] == "true" {
+			return name
+		}
+	}
+	return ""
+}
+
+// classNames lists the storage or ingress classes in sorted order
+func classNames[T any](classes map[string]T) string {
+	if len(classes) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// checkMountFailures flags Pending pods whose volumes fail to attach or
+// mount, which keeps them in ContainerCreating
+func checkMountFailures(pods []PodInfo, events []corev1.Event) []Finding {
+	var findings []Finding
+	for _, pod := range pods {
+		if pod.Phase != string(corev1.PodPending) {
+			continue
+		}
+		var latest *corev1.Event
+		for _, reason := range mountFailureReasons {
+			e := latestPodEvent(events, pod.Name, reason)
+			if e != nil && (latest == nil || eventTime(*e).After(eventTime(*latest))) {
+				latest = e
+			}
+		}
+		if latest == nil {
+			continue
+		}
+		count := latest.Count
+		if count == 0 {
+			count = 1
+		}
+		findings = append(findings, Finding{
+			Rule:     "volume-mount-failed",
+			Severity: SeverityHigh,
+			Object:   "Pod/" + pod.Name,
+			Message:  fmt.Sprintf("volume cannot be attached or mounted (%s x%d): %s", latest.Reason, count, strings.TrimSpace(latest.Message)),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,43 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultAPITimeout bounds a single Kubernetes API call
+const DefaultAPITimeout = 30 * time.Second
+
+// APITimeoutError reports a Kubernetes API call that exceeded the per-call
+// timeout. It deliberately does not unwrap to context.DeadlineExceeded, so
+// callers can tell a slow apiserver from an expired overall deadline.
+type APITimeoutError struct {
+	Operation string
+	Timeout   time.Duration
+}
+
+func (e *APITimeoutError) Error() string {
+	return fmt.Sprintf("Kubernetes API timed out after %s %s", e.Timeout, e.Operation)
+}
+
+// IsAPITimeout reports whether err is or wraps an APITimeoutError
+func IsAPITimeout(err error) bool {
+	var timeoutErr *APITimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// apiCall runs call with a child context bounded by APITimeout. A timeout of
+// the child context, rather than of ctx itself, becomes an APITimeoutError.
+func (a *Aggregator) apiCall(ctx context.Context, operation string, call func(ctx context.Context) error) error {
+	callCtx, cancel := context.WithTimeout(ctx, a.opts.APITimeout)
+	defer cancel()
+
+	err := call(callCtx)
+	if err != nil && ctx.Err() == nil &&
+		(errors.Is(callCtx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded)) {
+		return &APITimeoutError{Operation: operation, Timeout: a.opts.APITimeout}
+	}
+	return err
+}
@@ -0,0 +1,245 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultWatchReasons are the container states that trigger a diagnosis in
+// watch mode
+var DefaultWatchReasons = []string{"CrashLoopBackOff", "ImagePullBackOff", "ErrImagePull", "OOMKilled"}
+
+// Trigger is a failure seen while watching that warrants a fresh diagnosis
+type Trigger struct {
+	// Reason is the failure, e.g. "CrashLoopBackOff"
+	Reason string
+	// Object is the failing pod or container, e.g. "Pod/api-7d8f9b/app"
+	Object string
+	// Message describes the failure, from the container state or the event
+	Message string
+}
+
+// WatchOptions configures Watch
+type WatchOptions struct {
+	// LabelSelector limits the watch to pods matching it
+	LabelSelector string
+	// Workloads limits the watch to pods of these workloads, matched like
+	// the diagnose workload filter
+	Workloads []string
+	// Reasons are the container waiting or termination reasons that
+	// trigger (default DefaultWatchReasons)
+	Reasons []string
+	// OnWarning, when set, receives problems that do not stop the watch,
+	// such as events that cannot be read
+	OnWarning func(string)
+}
+
+// Watch watches the pods and Warning events of namespace with informers and
+// calls onTrigger when a container enters one of the failure states. Pods
+// already failing when the watch starts trigger once; after that a failure
+// triggers again only once it has cleared, or for OOMKilled, on the next
+// kill. Watch blocks until ctx is done. The client should have no request
+// timeout, which would end the watch connections.
+func (c *Client) Watch(ctx context.Context, namespace string, opts WatchOptions, onTrigger func(Trigger)) error {
+	if len(opts.Reasons) == 0 {
+		opts.Reasons = DefaultWatchReasons
+	}
+
+	// Informers retry forbidden lists forever, so check access up front
+	if _, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: opts.LabelSelector, Limit: 1}); err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	watchEvents := true
+	if _, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{Limit: 1}); apierrors.IsForbidden(err) {
+		watchEvents = false
+		if opts.OnWarning != nil {
+			opts.OnWarning(fmt.Sprintf("events not watched, failures are detected from pod status only: %v", err))
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+
+	w := &podWatcher{opts: opts, onTrigger: onTrigger, started: time.Now(), active: make(map[string]map[string]bool)}
+
+	pods := informers.NewSharedInformerFactoryWithOptions(c.clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(lo *metav1.ListOptions) { lo.LabelSelector = opts.LabelSelector }))
+	if _, err := pods.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { w.podChanged(obj) },
+		UpdateFunc: func(_, obj any) { w.podChanged(obj) },
+		DeleteFunc: w.podDeleted,
+	}); err != nil {
+		return fmt.Errorf("failed to watch pods: %w", err)
+	}
+	pods.Start(ctx.Done())
+	defer pods.Shutdown()
+
+	if watchEvents {
+		events := informers.NewSharedInformerFactoryWithOptions(c.clientset, 0,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(lo *metav1.ListOptions) { lo.FieldSelector = "type=" + corev1.EventTypeWarning }))
+		if _, err := events.Core().V1().Events().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj any) { w.eventSeen(obj) },
+			UpdateFunc: func(_, obj any) { w.eventSeen(obj) },
+		}); err != nil {
+			return fmt.Errorf("failed to watch events: %w", err)
+		}
+		events.Start(ctx.Done())
+		defer events.Shutdown()
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// podWatcher tracks which failures of which pods already triggered
+type podWatcher struct {
+	opts      WatchOptions
+	onTrigger func(Trigger)
+	// started filters out events from before the watch
+	started time.Time
+
+	mu sync.Mutex
+	// active maps each watched pod to the trigger keys it currently shows
+	active map[string]map[string]bool
+}
+
+// podChanged triggers for failures the pod shows that it did not show
+// before, and forgets the ones it no longer shows
+func (w *podWatcher) podChanged(obj any) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	if len(w.opts.Workloads) > 0 {
+		owner := podOwner(pod)
+		if owner == "" {
+			owner = "Pod/" + pod.Name
+		}
+		if !matchesAnyWorkload(owner, w.opts.Workloads) {
+			return
+		}
+	}
+
+	current := make(map[string]bool)
+	var fire []Trigger
+	w.mu.Lock()
+	previous := w.active[pod.Name]
+	for key, t := range w.podTriggers(pod) {
+		current[key] = true
+		// A failure an event already announced does not trigger again
+		if !previous[key] && !previous["event#"+t.Reason] {
+			fire = append(fire, t)
+		}
+	}
+	// Event triggers stay until the pod status shows the failure
+	for key := range previous {
+		if reason, ok := strings.CutPrefix(key, "event#"); ok && !w.showsReason(current, reason) {
+			current[key] = true
+		}
+	}
+	w.active[pod.Name] = current
+	w.mu.Unlock()
+
+	for _, t := range fire {
+		w.onTrigger(t)
+	}
+}
+
+func (w *podWatcher) podDeleted(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if pod, ok := obj.(*corev1.Pod); ok {
+		w.mu.Lock()
+		delete(w.active, pod.Name)
+		w.mu.Unlock()
+	}
+}
+
+// podTriggers returns the failures the pod's containers currently show by
+// key. OOMKilled is keyed by restart count so every kill is a new failure.
+func (w *podWatcher) podTriggers(pod *corev1.Pod) map[string]Trigger {
+	triggers := make(map[string]Trigger)
+	statuses := append(slices.Clone(pod.Status.InitContainerStatuses), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		object := fmt.Sprintf("Pod/%s/%s", pod.Name, cs.Name)
+		if waiting := cs.State.Waiting; waiting != nil && slices.Contains(w.opts.Reasons, waiting.Reason) {
+			triggers[object+"#"+waiting.Reason] = Trigger{Reason: waiting.Reason, Object: object, Message: waiting.Message}
+		}
+		for _, terminated := range []*corev1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+			if terminated != nil && terminated.Reason == "OOMKilled" && slices.Contains(w.opts.Reasons, "OOMKilled") {
+				triggers[fmt.Sprintf("%s@%d#OOMKilled", object, cs.RestartCount)] = Trigger{
+					Reason:  "OOMKilled",
+					Object:  object,
+					Message: fmt.Sprintf("container %s was killed for exceeding its memory limit (%d restarts)", cs.Name, cs.RestartCount),
+				}
+				break
+			}
+		}
+	}
+	return triggers
+}
+
+// eventSeen triggers for new Warning events reporting a failure of a watched
+// pod, which often arrive before the pod status changes
+func (w *podWatcher) eventSeen(obj any) {
+	event, ok := obj.(*corev1.Event)
+	if !ok || event.InvolvedObject.Kind != "Pod" {
+		return
+	}
+	if eventTime(*event).Before(w.started) {
+		return
+	}
+	reason := eventFailure(event)
+	if reason == "" || !slices.Contains(w.opts.Reasons, reason) {
+		return
+	}
+
+	w.mu.Lock()
+	active, watched := w.active[event.InvolvedObject.Name]
+	key := "event#" + reason
+	fire := watched && !active[key] && !w.showsReason(active, reason)
+	if fire {
+		active[key] = true
+	}
+	w.mu.Unlock()
+
+	if fire {
+		w.onTrigger(Trigger{Reason: reason, Object: "Pod/" + event.InvolvedObject.Name, Message: event.Message})
+	}
+}
+
+// showsReason reports whether a pod's status already triggered for reason
+func (w *podWatcher) showsReason(active map[string]bool, reason string) bool {
+	for key := range active {
+		if strings.HasSuffix(key, "#"+reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventFailure maps a kubelet Warning event to the container state it
+// announces, or "" for other events
+func eventFailure(event *corev1.Event) string {
+	switch {
+	case event.Reason == "BackOff" && strings.Contains(event.Message, "restarting failed container"):
+		return "CrashLoopBackOff"
+	case event.Reason == "BackOff" && strings.Contains(event.Message, "pulling image"):
+		return "ImagePullBackOff"
+	case event.Reason == "Failed" && strings.Contains(event.Message, "ErrImagePull"):
+		return "ErrImagePull"
+	}
+	return ""
+}
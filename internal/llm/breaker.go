@@ -0,0 +1,256 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Circuit breaker defaults, overridable via KUBEHELP_CIRCUIT_THRESHOLD and
+// KUBEHELP_CIRCUIT_COOLDOWN
+const (
+	DefaultCircuitThreshold = 5
+	DefaultCircuitCooldown  = 30 * time.Second
+)
+
+// CircuitState is the state of a provider's circuit breaker
+type CircuitState string
+
+const (
+	// CircuitClosed lets calls through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails calls immediately until the cooldown has passed
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets one trial call through after the cooldown;
+	// its outcome closes or reopens the circuit
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitOpenError is returned instead of calling a provider whose circuit
+// is open
+type CircuitOpenError struct {
+	Provider string
+	// RetryAt is when the circuit lets a trial call through
+	RetryAt time.Time
+	// Err is the failure that opened the circuit
+	Err error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s is failing and not called until %s (last error: %v)",
+		e.Provider, e.RetryAt.Format(time.TimeOnly), e.Err)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.Err
+}
+
+// CircuitBreaker stops calls to a provider after Threshold consecutive
+// failures for Cooldown, so a provider that is down is not hammered by
+// every diagnosis and fallback chains move on at once. Failures are counted
+// after retries; client errors such as bad requests or unknown models do
+// not count, since the provider answered.
+type CircuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	lastErr  error
+	// trial is set while the half-open trial call runs
+	trial bool
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[string]*CircuitBreaker)
+)
+
+// Breaker returns the process-wide circuit breaker of the named provider,
+// configured from KUBEHELP_CIRCUIT_THRESHOLD (default 5, 0 disables the
+// breaker) and KUBEHELP_CIRCUIT_COOLDOWN (default 30s). It returns nil when
+// the breaker is disabled.
+func Breaker(name string) *CircuitBreaker {
+	threshold := DefaultCircuitThreshold
+	if n, err := strconv.Atoi(os.Getenv("KUBEHELP_CIRCUIT_THRESHOLD")); err == nil && n >= 0 {
+		threshold = n
+	}
+	if threshold == 0 {
+		return nil
+	}
+	cooldown := DefaultCircuitCooldown
+	if d, err := time.ParseDuration(os.Getenv("KUBEHELP_CIRCUIT_COOLDOWN")); err == nil && d > 0 {
+		cooldown = d
+	}
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = &CircuitBreaker{name: name, state: CircuitClosed}
+		breakers[name] = b
+	}
+	b.mu.Lock()
+	b.threshold, b.cooldown = threshold, cooldown
+	b.mu.Unlock()
+	return b
+}
+
+// BreakerState returns the circuit state of the named provider and, when
+// it is open, when it lets a trial call through
+func BreakerState(name string) (CircuitState, time.Time) {
+	breakersMu.Lock()
+	b, ok := breakers[name]
+	breakersMu.Unlock()
+	if !ok {
+		return CircuitClosed, time.Time{}
+	}
+	return b.State()
+}
+
+// State returns the state of the circuit and, when it is open, when it
+// lets a trial call through
+func (b *CircuitBreaker) State() (CircuitState, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen {
+		retryAt := b.openedAt.Add(b.cooldown)
+		if !time.Now().Before(retryAt) {
+			return CircuitHalfOpen, time.Time{}
+		}
+		return CircuitOpen, retryAt
+	}
+	return b.state, time.Time{}
+}
+
+// allow returns a CircuitOpenError unless a call may go through. Once the
+// cooldown has passed, a single trial call is let through.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		retryAt := b.openedAt.Add(b.cooldown)
+		if time.Now().Before(retryAt) {
+			return &CircuitOpenError{Provider: b.name, RetryAt: retryAt, Err: b.lastErr}
+		}
+		b.state = CircuitHalfOpen
+		b.trial = true
+	case CircuitHalfOpen:
+		if b.trial {
+			return &CircuitOpenError{Provider: b.name, RetryAt: time.Now().Add(b.cooldown), Err: b.lastErr}
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+// record counts the outcome of a call let through by allow
+func (b *CircuitBreaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if err != nil && ctx.Err() != nil {
+		// A cancelled call says nothing about the provider
+		return
+	}
+	if !breakerFailure(err) {
+		if b.state != CircuitClosed {
+			log.Printf("✅ %s is answering again; closed its circuit", b.name)
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.lastErr = err
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		if b.state != CircuitOpen {
+			log.Printf("⚠️  %s failed %d times in a row; not calling it for %s", b.name, b.failures, b.cooldown)
+		}
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// breakerFailure reports whether err means the provider is failing, as
+// opposed to a successful call or a request the provider rejected. Rate
+// limits and timeouts count as failures.
+func breakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var budgetErr *BudgetExceededError
+	var notPulled *ModelNotPulledError
+	if errors.As(err, &budgetErr) || errors.As(err, &notPulled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode == http.StatusRequestTimeout
+	}
+	return true
+}
+
+// CircuitBreakerProvider wraps a provider with its circuit breaker
+type CircuitBreakerProvider struct {
+	provider Provider
+	breaker  *CircuitBreaker
+}
+
+// WithCircuitBreaker wraps provider with the process-wide circuit breaker
+// of providerName. The provider is returned unchanged when breakers are
+// disabled.
+func WithCircuitBreaker(provider Provider, providerName string) Provider {
+	breaker := Breaker(providerName)
+	if breaker == nil {
+		return provider
+	}
+	return &CircuitBreakerProvider{provider: provider, breaker: breaker}
+}
+
+// Name returns the underlying provider name
+func (p *CircuitBreakerProvider) Name() string {
+	return p.provider.Name()
+}
+
+// Analyze delegates unless the circuit is open
+func (p *CircuitBreakerProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	if err := p.breaker.allow(); err != nil {
+		return "", err
+	}
+	analysis, err := p.provider.Analyze(ctx, prompt)
+	p.breaker.record(ctx, err)
+	return analysis, err
+}
+
+// AnalyzeStream delegates unless the circuit is open
+func (p *CircuitBreakerProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	if err := p.breaker.allow(); err != nil {
+		close(chunks)
+		return err
+	}
+	err := p.provider.AnalyzeStream(ctx, prompt, chunks)
+	p.breaker.record(ctx, err)
+	return err
+}
+
+// Chat delegates unless the circuit is open
+func (p *CircuitBreakerProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	if err := p.breaker.allow(); err != nil {
+		return "", err
+	}
+	reply, err := p.provider.Chat(ctx, messages)
+	p.breaker.record(ctx, err)
+	return reply, err
+}
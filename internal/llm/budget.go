@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultInputPrices lists approximate input prices in USD per million
+// tokens for common hosted models. Override with KUBEHELP_INPUT_COST_PER_MTOK
+// when the model is missing or prices change.
+var DefaultInputPrices = map[string]float64{
+	"gpt-4":            30,
+	"gpt-4-turbo":      10,
+	"gpt-4o":           2.5,
+	"gpt-4o-mini":      0.15,
+	"gemini-pro":       0.5,
+	"gemini-1.5-pro":   1.25,
+	"gemini-1.5-flash": 0.075,
+	"gemini-2.0-flash": 0.1,
+	"gemini-2.5-pro":   1.25,
+	"gemini-2.5-flash": 0.3,
+}
+
+// InputCostPerMillion returns the input price in USD per million tokens for
+// a provider's model. Local Ollama models are free.
+func InputCostPerMillion(provider, model string) (float64, bool) {
+	if value := os.Getenv("KUBEHELP_INPUT_COST_PER_MTOK"); value != "" {
+		if price, err := strconv.ParseFloat(value, 64); err == nil && price >= 0 {
+			return price, true
+		}
+	}
+	if provider == "ollama" {
+		return 0, true
+	}
+	price, ok := DefaultInputPrices[model]
+	return price, ok
+}
+
+// Budget limits the size of a single analysis request. Zero values disable
+// the corresponding limit.
+type Budget struct {
+	// MaxInputTokens caps the estimated prompt size
+	MaxInputTokens int
+	// MaxCost caps the estimated input cost in USD
+	MaxCost float64
+	// InputCostPerMillion is the input price used to estimate cost
+	InputCostPerMillion float64
+}
+
+// BudgetExceededError is returned when a prompt is estimated to exceed the budget
+type BudgetExceededError struct {
+	EstimatedTokens int
+	EstimatedCost   float64
+	Budget          Budget
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Budget.MaxInputTokens > 0 && e.EstimatedTokens > e.Budget.MaxInputTokens {
+		return fmt.Sprintf("prompt of ~%d tokens exceeds the input budget of %d tokens",
+			e.EstimatedTokens, e.Budget.MaxInputTokens)
+	}
+	return fmt.Sprintf("prompt of ~%d tokens costs an estimated $%.4f, exceeding the budget of $%.4f",
+		e.EstimatedTokens, e.EstimatedCost, e.Budget.MaxCost)
+}
+
+// BudgetProvider wraps a provider and refuses to call it when the prompt is
+// estimated to exceed the budget
+type BudgetProvider struct {
+	provider Provider
+	budget   Budget
+}
+
+// NewBudgetProvider creates a budget-enforcing wrapper around provider
+func NewBudgetProvider(provider Provider, budget Budget) *BudgetProvider {
+	return &BudgetProvider{
+		provider: provider,
+		budget:   budget,
+	}
+}
+
+// WithBudget wraps provider with the given limits, looking up the model's
+// input price when a cost limit is set. The provider is returned unchanged
+// when no limit is set.
+func WithBudget(provider Provider, providerName, model string, maxInputTokens int, maxCost float64) (Provider, error) {
+	if maxInputTokens <= 0 && maxCost <= 0 {
+		return provider, nil
+	}
+
+	budget := Budget{MaxInputTokens: maxInputTokens}
+	if maxCost > 0 {
+		price, ok := InputCostPerMillion(providerName, model)
+		if !ok {
+			return nil, fmt.Errorf("no input price known for model %q; set KUBEHELP_INPUT_COST_PER_MTOK to use a cost limit", model)
+		}
+		budget.MaxCost = maxCost
+		budget.InputCostPerMillion = price
+	}
+	return NewBudgetProvider(provider, budget), nil
+}
+
+// Analyze checks the prompt against the budget before delegating
+func (p *BudgetProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	if err := p.check(prompt); err != nil {
+		return "", err
+	}
+	return p.provider.Analyze(ctx, prompt)
+}
+
+// AnalyzeStream checks the prompt against the budget before delegating
+func (p *BudgetProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	if err := p.check(prompt); err != nil {
+		close(chunks)
+		return err
+	}
+	return p.provider.AnalyzeStream(ctx, prompt, chunks)
+}
+
+// Chat checks the whole conversation against the budget before delegating,
+// since every turn resends it
+func (p *BudgetProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	var sb strings.Builder
+	for _, m := range messages {
+		sb.WriteString(m.Content)
+	}
+	if err := p.check(sb.String()); err != nil {
+		return "", err
+	}
+	return p.provider.Chat(ctx, messages)
+}
+
+// check returns a BudgetExceededError when the prompt's estimated tokens or
+// cost exceed the budget
+func (p *BudgetProvider) check(prompt string) error {
+	tokens := EstimateTokens(prompt)
+	cost := float64(tokens) * p.budget.InputCostPerMillion / 1e6
+
+	overTokens := p.budget.MaxInputTokens > 0 && tokens > p.budget.MaxInputTokens
+	overCost := p.budget.MaxCost > 0 && cost > p.budget.MaxCost
+	if overTokens || overCost {
+		return &BudgetExceededError{
+			EstimatedTokens: tokens,
+			EstimatedCost:   cost,
+			Budget:          p.budget,
+		}
+	}
+	return nil
+}
+
+// Name returns the wrapped provider's name
+func (p *BudgetProvider) Name() string {
+	return p.provider.Name()
+}
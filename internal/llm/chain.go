@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/googleapi"
+)
+
+// ProviderFailure is the error of a provider the chain fell back from
+type ProviderFailure struct {
+	Provider string
+	Err      error
+}
+
+func (f ProviderFailure) String() string {
+	return fmt.Sprintf("%s failed: %v", f.Provider, f.Err)
+}
+
+// ChainProvider tries an ordered list of providers, falling back to the next
+// one when a provider fails transiently, e.g. when it is rate limited or
+// unreachable. Budget refusals and configuration or auth errors are
+// returned as is, so a refused prompt is not sent to another provider. A
+// provider that answers after a fallback is tried first on later calls.
+type ChainProvider struct {
+	mu        sync.Mutex
+	providers []Provider
+	// failures are those of the latest call
+	failures []ProviderFailure
+}
+
+// NewChainProvider creates a provider that tries providers in order
+func NewChainProvider(providers []Provider) (*ChainProvider, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("provider chain is empty")
+	}
+	return &ChainProvider{providers: providers}, nil
+}
+
+// Name returns the name of the provider tried first, which after a call is
+// the one that answered
+func (p *ChainProvider) Name() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.providers[0].Name()
+}
+
+// Names returns the names of the providers in the order they are tried
+func (p *ChainProvider) Names() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, len(p.providers))
+	for i, provider := range p.providers {
+		names[i] = provider.Name()
+	}
+	return names
+}
+
+// Failures returns the errors of the providers the latest call fell back
+// from, empty when the first provider answered
+func (p *ChainProvider) Failures() []ProviderFailure {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ProviderFailure(nil), p.failures...)
+}
+
+// Analyze sends the prompt to each provider in turn until one answers
+func (p *ChainProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	var analysis string
+	err := p.try(ctx, func(provider Provider) (bool, error) {
+		var err error
+		analysis, err = provider.Analyze(ctx, prompt)
+		return true, err
+	})
+	return analysis, err
+}
+
+// AnalyzeStream streams the prompt from each provider in turn until one
+// answers. A provider failing after it streamed output is not fallen back
+// from, as the output cannot be taken back.
+func (p *ChainProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	defer close(chunks)
+
+	return p.try(ctx, func(provider Provider) (bool, error) {
+		streamed, err := forwardStream(ctx, provider, prompt, chunks)
+		return !streamed, err
+	})
+}
+
+// Chat sends the conversation to each provider in turn until one answers
+func (p *ChainProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	var reply string
+	err := p.try(ctx, func(provider Provider) (bool, error) {
+		var err error
+		reply, err = provider.Chat(ctx, messages)
+		return true, err
+	})
+	return reply, err
+}
+
+// try calls fn with each provider until one succeeds, the context ends, the
+// error is not transient or fn reports that falling back is no longer
+// possible. The provider that succeeds moves to the front.
+func (p *ChainProvider) try(ctx context.Context, fn func(Provider) (retryable bool, err error)) error {
+	p.mu.Lock()
+	providers := append([]Provider(nil), p.providers...)
+	p.mu.Unlock()
+
+	var failures []ProviderFailure
+	var errs []error
+	for i, provider := range providers {
+		retryable, err := fn(provider)
+		if err == nil {
+			p.mu.Lock()
+			p.failures = failures
+			if i > 0 {
+				p.providers = append([]Provider{provider}, slices.Delete(providers, i, i+1)...)
+			}
+			p.mu.Unlock()
+			return nil
+		}
+		failures = append(failures, ProviderFailure{Provider: provider.Name(), Err: err})
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+		if ctx.Err() != nil || !retryable || !transient(err) {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	p.failures = failures
+	p.mu.Unlock()
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("all providers failed (%s): %w", joinNames(failures), errors.Join(errs...))
+}
+
+// transient reports whether err may not recur with another provider: rate
+// limits, timeouts and server errors, network errors and open circuits.
+// Budget refusals, rejected requests and auth errors are not.
+func transient(err error) bool {
+	var circuitErr *CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return true
+	}
+	var budgetErr *BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return transientStatus(apiErr.StatusCode)
+	}
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return transientStatus(gErr.Code)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// transientStatus reports whether an HTTP status is worth another provider
+func transientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+func joinNames(failures []ProviderFailure) string {
+	names := make([]string, len(failures))
+	for i, f := range failures {
+		names[i] = f.Provider
+	}
+	return strings.Join(names, ", ")
+}
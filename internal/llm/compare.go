@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/textutil"
+)
+
+// BuildComparePrompt creates a prompt asking why the target collection
+// behaves differently from the baseline. The structured diff leads, followed
+// by the full report sections of both sides.
+func BuildComparePrompt(baseline, target *k8s.DiagnosticData, diff *k8s.Comparison, opts PromptOptions) string {
+	if opts.DetailLevel == "" {
+		opts.DetailLevel = DetailIssuesOnly
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Kubernetes Comparison Report\n\n")
+	sb.WriteString(fmt.Sprintf("**Baseline (expected to work):** %s, collected %s\n",
+		diff.Baseline, baseline.CollectedAt.Format(time.RFC3339)))
+	sb.WriteString(fmt.Sprintf("**Target (misbehaving):** %s, collected %s\n\n",
+		diff.Target, target.CollectedAt.Format(time.RFC3339)))
+
+	writeComparison(&sb, diff)
+
+	sb.WriteString(fmt.Sprintf("# Baseline: %s\n\n", diff.Baseline))
+	writeDiagnosticSections(&sb, baseline, opts)
+	sb.WriteString(fmt.Sprintf("# Target: %s\n\n", diff.Target))
+	writeDiagnosticSections(&sb, target, opts)
+
+	sb.WriteString("# Analysis Request\n\n")
+	sb.WriteString("Please compare the target with the baseline and provide:\n\n")
+	sb.WriteString("1. **Summary**: How the target behaves differently from the baseline\n")
+	sb.WriteString("2. **Relevant Differences**: Which of the differences above explain it, and which are expected (e.g. replica counts or names)\n")
+	sb.WriteString("3. **Root Cause Analysis**: Explain the likely root causes in the target\n")
+	sb.WriteString("4. **Remediation Steps**: Provide specific steps to bring the target in line with the baseline\n")
+	sb.WriteString("5. **kubectl Commands**: Include relevant kubectl commands, with `-n` and `--context` for each side\n\n")
+	sb.WriteString("Focus on the differences that break the target first.\n")
+	return sb.String()
+}
+
+// BuildCompactComparePrompt is the token-minimal variant of
+// BuildComparePrompt for small-context models
+func BuildCompactComparePrompt(baseline, target *k8s.DiagnosticData, diff *k8s.Comparison) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("K8S COMPARE base=%s tgt=%s\n", diff.Baseline, diff.Target))
+	writeCompactComparison(&sb, diff)
+	sb.WriteString("BASE\n")
+	writeCompactSections(&sb, baseline)
+	sb.WriteString("TGT\n")
+	writeCompactSections(&sb, target)
+	sb.WriteString("TASK: why tgt fails but base works, relevant diffs, root cause, fix steps, kubectl cmds. Be brief.\n")
+	return sb.String()
+}
+
+// BuildDiffPrompt creates a prompt asking what changed between an earlier
+// diagnosis of a namespace and its current state, and which of the changes
+// explain the current failures. The structured diff leads, followed by the
+// report sections of the current state only, since the earlier one is
+// summarized by the diff.
+func BuildDiffPrompt(earlier, current *k8s.DiagnosticData, diff *k8s.Comparison, opts PromptOptions) string {
+	if opts.DetailLevel == "" {
+		opts.DetailLevel = DetailIssuesOnly
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Kubernetes Change Report\n\n")
+	sb.WriteString(fmt.Sprintf("**Earlier run (baseline):** %s, collected %s\n",
+		diff.Baseline, earlier.CollectedAt.Format(time.RFC3339)))
+	sb.WriteString(fmt.Sprintf("**Current state (target):** %s, collected %s\n\n",
+		diff.Target, current.CollectedAt.Format(time.RFC3339)))
+
+	writeComparison(&sb, diff)
+
+	sb.WriteString("# Current State\n\n")
+	writeDiagnosticSections(&sb, current, opts)
+
+	sb.WriteString("# Analysis Request\n\n")
+	sb.WriteString("Please reason about what changed since the earlier run and provide:\n\n")
+	sb.WriteString("1. **Summary**: What changed and whether the namespace got worse or better\n")
+	sb.WriteString("2. **Relevant Changes**: Which changes (images, replicas, node moves, new events, new findings) explain the current failures, and which are routine (e.g. pod restarts after a rollout)\n")
+	sb.WriteString("3. **Root Cause Analysis**: The likely root cause, tied to the change that introduced it\n")
+	sb.WriteString("4. **Remediation Steps**: Specific steps, including reverting the breaking change where that is the fastest fix\n")
+	sb.WriteString("5. **kubectl Commands**: Include relevant kubectl commands, e.g. `kubectl rollout undo`\n\n")
+	sb.WriteString("Focus on the changes that broke the namespace first.\n")
+	return sb.String()
+}
+
+// BuildCompactDiffPrompt is the token-minimal variant of BuildDiffPrompt
+// for small-context models
+func BuildCompactDiffPrompt(earlier, current *k8s.DiagnosticData, diff *k8s.Comparison) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("K8S CHANGES since=%s at=%s\n", diff.Baseline, earlier.CollectedAt.Format(time.RFC3339)))
+	writeCompactComparison(&sb, diff)
+	for _, e := range diff.NewEvents {
+		sb.WriteString(fmt.Sprintf("EV %s %s x%d %s\n", e.Reason, k8s.Qualify(e.Namespace, e.InvolvedObject), e.Count, textutil.Truncate(e.Message, 120)))
+	}
+	sb.WriteString("NOW\n")
+	writeCompactSections(&sb, current)
+	sb.WriteString("TASK: which changes since the earlier run cause the current failures, root cause, fix steps (incl. rollbacks), kubectl cmds. Be brief.\n")
+	return sb.String()
+}
+
+// ComparisonReport renders the structured diff as markdown, the report of
+// a comparison without an LLM
+func ComparisonReport(diff *k8s.Comparison) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Comparison of %s (baseline) and %s (target)\n\n", diff.Baseline, diff.Target))
+	writeComparison(&sb, diff)
+	if len(diff.Differences)+len(diff.NewFindings)+len(diff.ResolvedFindings)+len(diff.NewEvents) == 0 {
+		sb.WriteString("No differences found.\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// writeComparison writes the differences and the findings of one side only
+func writeComparison(sb *strings.Builder, diff *k8s.Comparison) {
+	if len(diff.Differences) > 0 {
+		sb.WriteString("## Differences\n\n")
+		sb.WriteString("| Object | Field | Baseline | Target |\n")
+		sb.WriteString("|--------|-------|----------|--------|\n")
+		for _, d := range diff.Differences {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+				d.Object, d.Field, textutil.Truncate(d.Baseline, 200), textutil.Truncate(d.Target, 200)))
+		}
+		sb.WriteString("\n")
+	}
+	if len(diff.NewFindings) > 0 {
+		sb.WriteString("## Findings Only in the Target\n\n")
+		for _, f := range diff.NewFindings {
+			sb.WriteString(fmt.Sprintf("- [%s] %s (%s): %s\n", f.Severity, k8s.Qualify(f.Namespace, f.Object), f.Rule, f.Message))
+		}
+		sb.WriteString("\n")
+	}
+	if len(diff.ResolvedFindings) > 0 {
+		sb.WriteString("## Findings Only in the Baseline\n\n")
+		for _, f := range diff.ResolvedFindings {
+			sb.WriteString(fmt.Sprintf("- [%s] %s (%s): %s\n", f.Severity, k8s.Qualify(f.Namespace, f.Object), f.Rule, f.Message))
+		}
+		sb.WriteString("\n")
+	}
+	if len(diff.NewEvents) > 0 {
+		sb.WriteString("## Warning Events Since the Baseline\n\n")
+		sb.WriteString("| Last Seen | Object | Reason | Count | Message |\n")
+		sb.WriteString("|-----------|--------|--------|-------|---------|\n")
+		for _, e := range diff.NewEvents {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %d | %s |\n", e.LastTimestamp.Format(time.RFC3339),
+				k8s.Qualify(e.Namespace, e.InvolvedObject), e.Reason, e.Count, textutil.Truncate(e.Message, 200)))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// writeCompactComparison writes the differences and one-sided findings of
+// a compact prompt
+func writeCompactComparison(sb *strings.Builder, diff *k8s.Comparison) {
+	for _, d := range diff.Differences {
+		sb.WriteString(fmt.Sprintf("DIFF %s %s: %s -> %s\n", d.Object, d.Field, textutil.Truncate(d.Baseline, 80), textutil.Truncate(d.Target, 80)))
+	}
+	for _, f := range diff.NewFindings {
+		sb.WriteString(fmt.Sprintf("NEW %s %s %s\n", f.Rule, k8s.Qualify(f.Namespace, f.Object), textutil.Truncate(f.Message, 160)))
+	}
+	for _, f := range diff.ResolvedFindings {
+		sb.WriteString(fmt.Sprintf("GONE %s %s\n", f.Rule, k8s.Qualify(f.Namespace, f.Object)))
+	}
+}
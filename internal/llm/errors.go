@@ -0,0 +1,44 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// APIError is returned when an LLM API responds with a non-success status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsModelNotFound reports whether err indicates that the requested model
+// does not exist (deprecated, typo'd or not pulled locally)
+func IsModelNotFound(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusNotFound || mentionsMissingModel(apiErr.Body)
+	}
+
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return gErr.Code == http.StatusNotFound
+	}
+
+	return false
+}
+
+// mentionsMissingModel detects model-not-found errors reported with a
+// non-404 status, e.g. OpenAI's "model_not_found" code
+func mentionsMissingModel(body string) bool {
+	body = strings.ToLower(body)
+	return strings.Contains(body, "model_not_found") ||
+		(strings.Contains(body, "model") && strings.Contains(body, "not found"))
+}
@@ -10,12 +10,26 @@ import (
 	"time"
 )
 
+func init() {
+	Register("gemini", Factory{
+		New: func(model string) (Provider, error) {
+			apiKey, err := APIKey("GEMINI_API_KEY")
+			if err != nil {
+				return nil, err
+			}
+			return NewGeminiProvider(apiKey, model), nil
+		},
+		DefaultModel: func() string { return envOr("GEMINI_MODEL", "gemini-pro") },
+		Description:  "Google Gemini API (GEMINI_API_KEY, GEMINI_MODEL)",
+	})
+}
+
 // GeminiProvider implements the Provider interface for Google Gemini
 type GeminiProvider struct {
 	apiKey  string
 	model   string
 	baseURL string
-	client  *http.Client
+	client  *retryClient
 }
 
 // NewGeminiProvider creates a new Google Gemini provider
@@ -27,9 +41,9 @@ func NewGeminiProvider(apiKey string, model string) *GeminiProvider {
 		apiKey:  apiKey,
 		model:   model,
 		baseURL: "https://generativelanguage.googleapis.com/v1beta",
-		client: &http.Client{
+		client: newRetryClient(&http.Client{
 			Timeout: 60 * time.Second,
-		},
+		}),
 	}
 }
 
@@ -40,36 +54,16 @@ func (p *GeminiProvider) Name() string {
 
 // Analyze sends a prompt to Google Gemini and returns the response
 func (p *GeminiProvider) Analyze(ctx context.Context, prompt string) (string, error) {
-	requestBody := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{
-						"text": fmt.Sprintf(`You are a Kubernetes troubleshooting expert. Analyze the provided diagnostic data and provide actionable insights.
-
-%s`, prompt),
-					},
-				},
-			},
-		},
-		"generationConfig": map[string]interface{}{
-			"temperature": 0.7,
-		},
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+	return p.Chat(ctx, userMessage(prompt))
+}
 
-	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s", p.baseURL, p.model, p.apiKey)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+// Chat sends a conversation to Google Gemini and returns the reply
+func (p *GeminiProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	req, err := p.newRequest(ctx, messages, "generateContent")
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
 	resp, err := p.client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
@@ -78,19 +72,10 @@ func (p *GeminiProvider) Analyze(ctx context.Context, prompt string) (string, er
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var result struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-		} `json:"candidates"`
+		return "", &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
+	var result geminiResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
@@ -98,6 +83,133 @@ func (p *GeminiProvider) Analyze(ctx context.Context, prompt string) (string, er
 	if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
 		return "", fmt.Errorf("no response from Gemini API")
 	}
+	p.recordUsage(ctx, result.UsageMetadata)
 
 	return result.Candidates[0].Content.Parts[0].Text, nil
 }
+
+// AnalyzeStream sends a prompt using streamGenerateContent and delivers
+// text chunks on chunks as they arrive. chunks is closed when it returns.
+func (p *GeminiProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	defer close(chunks)
+
+	req, err := p.newRequest(ctx, userMessage(prompt), "streamGenerateContent")
+	if err != nil {
+		return err
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// Each chunk reports the usage so far; the last one is the total
+	var usage *geminiUsage
+	defer func() { p.recordUsage(ctx, usage) }()
+
+	return readSSE(resp.Body, func(data string) error {
+		var event geminiResponse
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to decode stream event: %w", err)
+		}
+		if event.UsageMetadata != nil {
+			usage = event.UsageMetadata
+		}
+		if len(event.Candidates) == 0 {
+			return nil
+		}
+		for _, part := range event.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			if err := sendChunk(ctx, chunks, part.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// geminiResponse is the generateContent response, also sent for each
+// streamed chunk
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata *geminiUsage `json:"usageMetadata"`
+}
+
+// geminiUsage is the token usage of a generateContent response
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+}
+
+// recordUsage records the usage reported with a response, if any
+func (p *GeminiProvider) recordUsage(ctx context.Context, usage *geminiUsage) {
+	if usage != nil {
+		recordUsage(ctx, p.Name(), p.model, usage.PromptTokenCount, usage.CandidatesTokenCount)
+	}
+}
+
+// newRequest builds a request for the given model method, e.g.
+// "generateContent"; streaming methods respond with Server-Sent Events
+func (p *GeminiProvider) newRequest(ctx context.Context, messages []Message, method string) (*http.Request, error) {
+	var contents []map[string]interface{}
+	for _, m := range withSystemMessage(ctx, messages) {
+		// Gemini calls the assistant "model"
+		role := m.Role
+		if role == RoleAssistant {
+			role = "model"
+		}
+		contents = append(contents, map[string]interface{}{
+			"role":  role,
+			"parts": []map[string]string{{"text": m.Content}},
+		})
+	}
+
+	gen := GenerationFrom(ctx)
+	generationConfig := map[string]interface{}{
+		"temperature": gen.temperature(DefaultTemperature),
+	}
+	if gen.TopP != nil {
+		generationConfig["topP"] = *gen.TopP
+	}
+	if gen.MaxOutputTokens > 0 {
+		generationConfig["maxOutputTokens"] = gen.MaxOutputTokens
+	}
+	if jsonOutput(ctx) {
+		generationConfig["responseMimeType"] = "application/json"
+	}
+	requestBody := map[string]interface{}{
+		"contents":         contents,
+		"generationConfig": generationConfig,
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/models/%s:%s?key=%s", p.baseURL, p.model, method, p.apiKey)
+	if method == "streamGenerateContent" {
+		url += "&alt=sse"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// DefaultTemperature is the sampling temperature of providers that set one
+// when Generation leaves it unset
+const DefaultTemperature = 0.7
+
+// Generation tunes how providers sample a response. Unset fields keep the
+// provider's defaults: DefaultTemperature for OpenAI, Gemini and Vertex AI
+// and the model's own settings for Ollama.
+type Generation struct {
+	// Temperature controls randomness, from 0 (most deterministic) to 2; nil
+	// selects the default so that 0 can be requested explicitly
+	Temperature *float64 `json:"temperature,omitempty"`
+	// TopP restricts sampling to the most likely tokens whose probabilities
+	// add up to TopP, from 0 to 1
+	TopP *float64 `json:"topP,omitempty"`
+	// MaxOutputTokens limits the response length (0: provider default)
+	MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+}
+
+// Validate rejects values outside the ranges the providers accept
+func (g Generation) Validate() error {
+	if g.Temperature != nil && (*g.Temperature < 0 || *g.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if g.TopP != nil && (*g.TopP <= 0 || *g.TopP > 1) {
+		return fmt.Errorf("top-p must be greater than 0 and at most 1")
+	}
+	if g.MaxOutputTokens < 0 {
+		return fmt.Errorf("max output tokens must not be negative")
+	}
+	return nil
+}
+
+// String renders the settings for cache keys, e.g.
+// "temperature=0.2 top-p=default max-output-tokens=1024"
+func (g Generation) String() string {
+	format := func(value *float64) string {
+		if value == nil {
+			return "default"
+		}
+		return strconv.FormatFloat(*value, 'g', -1, 64)
+	}
+	return fmt.Sprintf("temperature=%s top-p=%s max-output-tokens=%d", format(g.Temperature), format(g.TopP), g.MaxOutputTokens)
+}
+
+// temperature returns the temperature to send, or fallback when unset
+func (g Generation) temperature(fallback float64) float64 {
+	if g.Temperature != nil {
+		return *g.Temperature
+	}
+	return fallback
+}
+
+type generationKey struct{}
+
+// WithGeneration returns a context whose requests use the sampling
+// settings of g. The settings travel with the request rather than the
+// provider because providers are built once per model and shared, while
+// profiles, flags and server requests choose settings per call.
+func WithGeneration(ctx context.Context, g Generation) context.Context {
+	return context.WithValue(ctx, generationKey{}, g)
+}
+
+// GenerationFrom returns the sampling settings of a request, for providers
+// to apply to the request they send
+func GenerationFrom(ctx context.Context) Generation {
+	g, _ := ctx.Value(generationKey{}).(Generation)
+	return g
+}
@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Provider health statuses
+const (
+	// HealthUp means the provider answered its health check
+	HealthUp = "up"
+	// HealthDown means the health check failed
+	HealthDown = "down"
+	// HealthUnconfigured means the provider cannot be created, e.g.
+	// because its API key is not set
+	HealthUnconfigured = "unconfigured"
+	// HealthUnknown means the provider has no health check
+	HealthUnknown = "unknown"
+)
+
+// Pinger is implemented by providers that can check that their API is
+// reachable and their model is available without generating anything
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ProviderHealth is the outcome of a provider's health check
+type ProviderHealth struct {
+	Name   string `json:"name"`
+	Model  string `json:"model,omitempty"`
+	Status string `json:"status"`
+	// LatencyMs is how long the health check took
+	LatencyMs int64  `json:"latencyMs,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Circuit is the state of the provider's circuit breaker; RetryAt is
+	// set while it is open
+	Circuit CircuitState `json:"circuit"`
+	RetryAt time.Time    `json:"retryAt,omitzero"`
+}
+
+// CheckHealth creates the named provider for its default model and pings
+// it, reporting its circuit breaker state alongside
+func CheckHealth(ctx context.Context, name string) ProviderHealth {
+	health := ProviderHealth{Name: name, Model: DefaultModel(name)}
+	health.Circuit, health.RetryAt = BreakerState(name)
+
+	factory, ok := Lookup(name)
+	if !ok {
+		health.Status = HealthUnconfigured
+		health.Error = "provider is not registered"
+		return health
+	}
+	provider, err := factory.New(health.Model)
+	if err != nil {
+		health.Status = HealthUnconfigured
+		health.Error = err.Error()
+		return health
+	}
+	pinger, ok := provider.(Pinger)
+	if !ok {
+		health.Status = HealthUnknown
+		return health
+	}
+
+	start := time.Now()
+	err = pinger.Ping(ctx)
+	health.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		health.Status = HealthDown
+		health.Error = err.Error()
+		return health
+	}
+	health.Status = HealthUp
+	return health
+}
+
+// Ping lists the local models and checks that the model has been pulled
+func (p *OllamaProvider) Ping(ctx context.Context) error {
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := ping(ctx, p.client.client, p.baseURL+"/api/tags", nil, &tags); err != nil {
+		return err
+	}
+	for _, m := range tags.Models {
+		// Models without a tag are pulled as "<model>:latest"
+		if m.Name == p.model || m.Name == p.model+":latest" {
+			return nil
+		}
+	}
+	return &ModelNotPulledError{Model: p.model}
+}
+
+// Ping looks up the model, which checks the API key without spending tokens
+func (p *OpenAIProvider) Ping(ctx context.Context) error {
+	header := http.Header{"Authorization": {"Bearer " + p.apiKey}}
+	return ping(ctx, p.client.client, p.baseURL+"/models/"+url.PathEscape(p.model), header, nil)
+}
+
+// Ping looks up the model, which checks the API key without spending tokens
+func (p *GeminiProvider) Ping(ctx context.Context) error {
+	header := http.Header{"x-goog-api-key": {p.apiKey}}
+	return ping(ctx, p.client.client, p.baseURL+"/models/"+url.PathEscape(p.model), header, nil)
+}
+
+// Ping looks up the publisher model, which checks the credentials and
+// endpoint without spending tokens
+func (p *VertexAIProvider) Ping(ctx context.Context) error {
+	if _, err := p.service.Publishers.Models.Get("publishers/google/models/" + p.model).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("Vertex AI API request failed: %w", err)
+	}
+	return nil
+}
+
+// ping sends a GET request with client, which should not retry, and
+// decodes the response into out, if set
+func ping(ctx context.Context, client *http.Client, target string, header http.Header, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &APIError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/textutil"
+)
+
+// formatIdentity renders the cloud identity of a ServiceAccount, e.g.
+// "aws-irsa arn:aws:iam::123456789012:role/api" or "none (node credentials)"
+func formatIdentity(id k8s.IdentityInfo) string {
+	switch {
+	case id.Provider == "":
+		return "none (node credentials)"
+	case id.Identity == "":
+		return id.Provider
+	}
+	return id.Provider + " " + id.Identity
+}
+
+// writeIdentities renders the "Cloud Identities" section: the identity
+// bindings of the ServiceAccounts of unhealthy pods, their problems and the
+// credential errors the pods report
+func writeIdentities(sb *strings.Builder, data *k8s.DiagnosticData) {
+	if len(data.Identities) == 0 {
+		return
+	}
+	sb.WriteString("## Cloud Identities\n\n")
+	for _, id := range data.Identities {
+		sb.WriteString(fmt.Sprintf("### ServiceAccount %s (pods: %s)\n\n", k8s.Qualify(id.Namespace, id.ServiceAccount), formatList(id.Pods)))
+		sb.WriteString(fmt.Sprintf("- **Identity:** %s\n", formatIdentity(id)))
+		if id.TokenAutomountDisabled {
+			sb.WriteString("- **Service Account Token:** not mounted (automountServiceAccountToken: false)\n")
+		}
+		for _, p := range id.Problems {
+			sb.WriteString(fmt.Sprintf("- **Problem:** %s\n", p))
+		}
+		for _, e := range id.Evidence {
+			sb.WriteString(fmt.Sprintf("- **Credential Error:** `%s`\n", e))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// writeCompactIdentities renders identities in the terse form of
+// BuildCompactPrompt, one IDENT line per ServiceAccount
+func writeCompactIdentities(sb *strings.Builder, data *k8s.DiagnosticData) {
+	for _, id := range data.Identities {
+		sb.WriteString(fmt.Sprintf("IDENT sa=%s id=%s", k8s.Qualify(id.Namespace, id.ServiceAccount), strings.ReplaceAll(formatIdentity(id), " ", "_")))
+		if id.TokenAutomountDisabled {
+			sb.WriteString(" token=off")
+		}
+		if len(id.Problems) > 0 {
+			sb.WriteString(" problems=" + textutil.Truncate(strings.Join(id.Problems, ";"), 200))
+		}
+		if len(id.Evidence) > 0 {
+			sb.WriteString(" err=" + textutil.Truncate(id.Evidence[0], 160))
+		}
+		sb.WriteString("\n")
+	}
+}
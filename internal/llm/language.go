@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Languages maps supported ISO 639-1 codes to the language names used in the
+// response instruction. Other values are passed through as language names.
+var Languages = map[string]string{
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"de": "German",
+	"it": "Italian",
+	"pt": "Portuguese",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"ru": "Russian",
+	"tr": "Turkish",
+	"ar": "Arabic",
+	"hi": "Hindi",
+	"ta": "Tamil",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"zh": "Chinese (Simplified)",
+}
+
+// LanguageName resolves a language code such as "es" or "pt-BR" to a name.
+// Unknown values are returned unchanged so any language can be requested.
+func LanguageName(lang string) string {
+	lang = strings.TrimSpace(lang)
+	code := strings.ToLower(lang)
+	if name, ok := Languages[code]; ok {
+		return name
+	}
+	if base, _, found := strings.Cut(code, "-"); found {
+		if name, ok := Languages[base]; ok {
+			return name
+		}
+	}
+	return lang
+}
+
+// DefaultLanguage returns the response language configured via LLM_LANGUAGE
+func DefaultLanguage() string {
+	return os.Getenv("LLM_LANGUAGE")
+}
+
+// WithLanguage appends an instruction asking for the analysis in lang. The
+// diagnostic data stays in English; empty or English lang leaves the prompt
+// unchanged.
+func WithLanguage(prompt, lang string) string {
+	name := LanguageName(lang)
+	if name == "" || name == "English" {
+		return prompt
+	}
+	return prompt + fmt.Sprintf("\nRespond in %s. Keep Kubernetes resource names, field names, log lines and kubectl commands unchanged.\n", name)
+}
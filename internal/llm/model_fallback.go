@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// DefaultFallbackModels lists known-good models per provider, tried in order
+// when the configured model is not found. Override per provider with the
+// <PROVIDER>_FALLBACK_MODELS environment variable (comma-separated).
+var DefaultFallbackModels = map[string][]string{
+	"openai":   {"gpt-4o", "gpt-4o-mini"},
+	"gemini":   {"gemini-2.5-flash", "gemini-2.0-flash"},
+	"vertexai": {"gemini-2.5-flash", "gemini-2.0-flash"},
+}
+
+// fallbackEnvVars maps provider names to the env var overriding their fallback list
+var fallbackEnvVars = map[string]string{
+	"openai":   "OPENAI_FALLBACK_MODELS",
+	"gemini":   "GEMINI_FALLBACK_MODELS",
+	"vertexai": "VERTEX_AI_FALLBACK_MODELS",
+	"ollama":   "OLLAMA_FALLBACK_MODELS",
+}
+
+// FallbackModels returns the fallback model list for a provider, preferring
+// the environment override over DefaultFallbackModels
+func FallbackModels(provider string) []string {
+	if env, ok := fallbackEnvVars[provider]; ok {
+		if value := os.Getenv(env); value != "" {
+			var models []string
+			for _, m := range strings.Split(value, ",") {
+				if m = strings.TrimSpace(m); m != "" {
+					models = append(models, m)
+				}
+			}
+			return models
+		}
+	}
+	return DefaultFallbackModels[provider]
+}
+
+// ModelFactory creates a provider instance for the given model
+type ModelFactory func(model string) (Provider, error)
+
+// ModelFallbackProvider wraps a provider and, when the configured model is
+// not found, retries the request with the provider's fallback models
+type ModelFallbackProvider struct {
+	primary   Provider
+	model     string
+	fallbacks []string
+	factory   ModelFactory
+}
+
+// NewModelFallbackProvider creates the primary provider for model and
+// prepares fallbacks to be created on demand
+func NewModelFallbackProvider(model string, fallbacks []string, factory ModelFactory) (*ModelFallbackProvider, error) {
+	primary, err := factory(model)
+	if err != nil {
+		return nil, err
+	}
+	return &ModelFallbackProvider{
+		primary:   primary,
+		model:     model,
+		fallbacks: fallbacks,
+		factory:   factory,
+	}, nil
+}
+
+// Name returns the underlying provider name
+func (p *ModelFallbackProvider) Name() string {
+	return p.primary.Name()
+}
+
+// Analyze sends the prompt using the primary model, switching to fallback
+// models only on model-not-found errors
+func (p *ModelFallbackProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	var analysis string
+	err := p.try(func(provider Provider) error {
+		var err error
+		analysis, err = provider.Analyze(ctx, prompt)
+		return err
+	})
+	return analysis, err
+}
+
+// AnalyzeStream streams the prompt using the primary model, switching to
+// fallback models only on model-not-found errors. Those are reported before
+// any output, so nothing is streamed twice.
+func (p *ModelFallbackProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	defer close(chunks)
+
+	return p.try(func(provider Provider) error {
+		_, err := forwardStream(ctx, provider, prompt, chunks)
+		return err
+	})
+}
+
+// Chat sends the conversation using the primary model, switching to
+// fallback models only on model-not-found errors
+func (p *ModelFallbackProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	var reply string
+	err := p.try(func(provider Provider) error {
+		var err error
+		reply, err = provider.Chat(ctx, messages)
+		return err
+	})
+	return reply, err
+}
+
+// try calls fn with the primary model and, while it fails with
+// model-not-found errors, with each fallback model. A fallback that works
+// becomes the primary model for later calls.
+func (p *ModelFallbackProvider) try(fn func(Provider) error) error {
+	err := fn(p.primary)
+	if err == nil || !IsModelNotFound(err) {
+		return err
+	}
+
+	firstErr := err
+	for _, model := range p.fallbacks {
+		if model == p.model {
+			continue
+		}
+
+		log.Printf("⚠️  %s model %q not found, falling back to %q", p.primary.Name(), p.model, model)
+
+		provider, err := p.factory(model)
+		if err != nil {
+			return fmt.Errorf("failed to create fallback model %s: %w", model, err)
+		}
+
+		err = fn(provider)
+		if err == nil {
+			p.primary, p.model = provider, model
+			return nil
+		}
+		if !IsModelNotFound(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("model %q not found and no fallback model succeeded: %w", p.model, firstErr)
+}
+
+// forwardStream streams from provider into chunks without closing it, so
+// that another provider can be tried afterwards. It reports whether any
+// chunk was forwarded.
+func forwardStream(ctx context.Context, provider Provider, prompt string, chunks chan<- string) (bool, error) {
+	inner := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- provider.AnalyzeStream(ctx, prompt, inner)
+	}()
+
+	streamed := false
+	for chunk := range inner {
+		if err := sendChunk(ctx, chunks, chunk); err != nil {
+			// Drain so the provider can finish and close inner
+			for range inner {
+			}
+			<-errc
+			return streamed, err
+		}
+		streamed = true
+	}
+	return streamed, <-errc
+}
@@ -7,14 +7,29 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
+func init() {
+	Register("ollama", Factory{
+		New: func(model string) (Provider, error) {
+			_, baseURL := OllamaEnvConfig()
+			return NewOllamaProvider(model, baseURL), nil
+		},
+		DefaultModel: func() string {
+			model, _ := OllamaEnvConfig()
+			return model
+		},
+		Description: "Local Ollama server (OLLAMA_BASE_URL, OLLAMA_MODEL)",
+	})
+}
+
 // OllamaProvider implements the Provider interface for Ollama
 type OllamaProvider struct {
 	model   string
 	baseURL string
-	client  *http.Client
+	client  *retryClient
 }
 
 // NewOllamaProvider creates a new Ollama provider
@@ -28,9 +43,9 @@ func NewOllamaProvider(model string, baseURL string) *OllamaProvider {
 	return &OllamaProvider{
 		model:   model,
 		baseURL: baseURL,
-		client: &http.Client{
+		client: newRetryClient(&http.Client{
 			Timeout: 120 * time.Second, // Longer timeout for local models
-		},
+		}),
 	}
 }
 
@@ -41,13 +56,98 @@ func (p *OllamaProvider) Name() string {
 
 // Analyze sends a prompt to Ollama and returns the response
 func (p *OllamaProvider) Analyze(ctx context.Context, prompt string) (string, error) {
-	requestBody := map[string]interface{}{
-		"model": p.model,
-		"prompt": fmt.Sprintf(`You are a Kubernetes troubleshooting expert. Analyze the provided diagnostic data and provide actionable insights.
+	req, err := p.newRequest(ctx, prompt, false)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", p.apiError(resp.StatusCode, body)
+	}
+
+	var result ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if result.Response == "" {
+		return "", fmt.Errorf("no response from Ollama")
+	}
+	p.recordUsage(ctx, result.ollamaUsage)
+
+	return result.Response, nil
+}
 
-%s`, prompt),
-		"stream":  false,
-		"options": map[string]int32{"num_ctx": 8192},
+// AnalyzeStream sends a prompt with streaming enabled and delivers tokens on
+// chunks as Ollama generates them. chunks is closed when it returns.
+func (p *OllamaProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	defer close(chunks)
+
+	req, err := p.newRequest(ctx, prompt, true)
+	if err != nil {
+		return err
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return p.apiError(resp.StatusCode, body)
+	}
+
+	// The stream is one JSON object per line
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var result ollamaResponse
+		if err := decoder.Decode(&result); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to decode stream: %w", err)
+		}
+		if result.Error != "" {
+			return fmt.Errorf("Ollama stream failed: %s", result.Error)
+		}
+		if result.Response != "" {
+			if err := sendChunk(ctx, chunks, result.Response); err != nil {
+				return err
+			}
+		}
+		if result.Done {
+			p.recordUsage(ctx, result.ollamaUsage)
+			return nil
+		}
+	}
+}
+
+// Chat sends a conversation to Ollama's /api/chat and returns the reply
+func (p *OllamaProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	var body []Message
+	if system := SystemPromptFrom(ctx); system != "" {
+		body = append(body, Message{Role: "system", Content: system})
+	}
+	body = append(body, messages...)
+
+	requestBody := map[string]interface{}{
+		"model":    p.model,
+		"messages": body,
+		"stream":   false,
+		"options":  ollamaOptions(ctx),
+	}
+	if jsonOutput(ctx) {
+		// Ollama constrains generation to the schema
+		requestBody["format"] = json.RawMessage(AnalysisSchema)
 	}
 
 	jsonData, err := json.Marshal(requestBody)
@@ -55,11 +155,10 @@ func (p *OllamaProvider) Analyze(ctx context.Context, prompt string) (string, er
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/generate", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/chat", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
-
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := p.client.Do(req)
@@ -70,21 +169,158 @@ func (p *OllamaProvider) Analyze(ctx context.Context, prompt string) (string, er
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return "", p.apiError(resp.StatusCode, body)
 	}
 
 	var result struct {
-		Response string `json:"response"`
-		Done     bool   `json:"done"`
+		Message Message `json:"message"`
+		ollamaUsage
 	}
-
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if result.Response == "" {
+	if result.Message.Content == "" {
 		return "", fmt.Errorf("no response from Ollama")
 	}
+	p.recordUsage(ctx, result.ollamaUsage)
 
-	return result.Response, nil
+	return result.Message.Content, nil
+}
+
+// ollamaResponse is the /api/generate response, also sent for each
+// streamed token
+type ollamaResponse struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error,omitempty"`
+	ollamaUsage
+}
+
+// ollamaUsage holds the token counts of a finished generation
+type ollamaUsage struct {
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// recordUsage records the token counts of a finished generation
+func (p *OllamaProvider) recordUsage(ctx context.Context, usage ollamaUsage) {
+	recordUsage(ctx, p.Name(), p.model, usage.PromptEvalCount, usage.EvalCount)
+}
+
+// ollamaOptions returns the model options of a request: the context window
+// and the sampling settings that are set, leaving the rest to the model
+func ollamaOptions(ctx context.Context) map[string]interface{} {
+	options := map[string]interface{}{"num_ctx": 8192}
+	gen := GenerationFrom(ctx)
+	if gen.Temperature != nil {
+		options["temperature"] = *gen.Temperature
+	}
+	if gen.TopP != nil {
+		options["top_p"] = *gen.TopP
+	}
+	if gen.MaxOutputTokens > 0 {
+		options["num_predict"] = gen.MaxOutputTokens
+	}
+	return options
+}
+
+// newRequest builds an /api/generate request for prompt
+func (p *OllamaProvider) newRequest(ctx context.Context, prompt string, stream bool) (*http.Request, error) {
+	requestBody := map[string]interface{}{
+		"model":   p.model,
+		"prompt":  withSystemPrompt(ctx, prompt),
+		"stream":  stream,
+		"options": ollamaOptions(ctx),
+	}
+	if jsonOutput(ctx) {
+		requestBody["format"] = json.RawMessage(AnalysisSchema)
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/generate", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// OllamaPreloadKeepAlive is how long a preloaded model stays in memory,
+// enough to cover collection before the real prompt is sent
+const OllamaPreloadKeepAlive = "10m"
+
+// Preload loads the model into memory without generating anything, so the
+// first real request does not pay the cold-start cost of loading the model
+func (p *OllamaProvider) Preload(ctx context.Context) error {
+	requestBody := map[string]interface{}{
+		"model":      p.model,
+		"keep_alive": OllamaPreloadKeepAlive,
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/generate", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to preload model: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return p.apiError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// apiError wraps model-not-found responses in ModelNotPulledError so the
+// user is told how to pull the model
+func (p *OllamaProvider) apiError(status int, body []byte) error {
+	err := &APIError{StatusCode: status, Body: string(body)}
+	if IsModelNotFound(err) {
+		return &ModelNotPulledError{Model: p.model, Err: err}
+	}
+	return err
+}
+
+// ModelNotPulledError is returned when an Ollama model has not been pulled
+type ModelNotPulledError struct {
+	Model string
+	// Available lists the pulled models, when known
+	Available []string
+	Err       error
+}
+
+func (e *ModelNotPulledError) Error() string {
+	msg := fmt.Sprintf("Ollama model %q is not available locally; pull it with \"kubehelp models pull %s\" or choose another model with --model or OLLAMA_MODEL",
+		e.Model, e.Model)
+	if len(e.Available) > 0 {
+		msg += fmt.Sprintf(" (pulled: %s)", strings.Join(e.Available, ", "))
+	}
+	return msg
+}
+
+func (e *ModelNotPulledError) Unwrap() error {
+	return e.Err
+}
+
+// OllamaEnvConfig reads the Ollama model and base URL from OLLAMA_MODEL and
+// OLLAMA_BASE_URL, defaulting to mistral on the local server
+func OllamaEnvConfig() (model, baseURL string) {
+	return envOr("OLLAMA_MODEL", "mistral"), envOr("OLLAMA_BASE_URL", "http://localhost:11434")
 }
@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OllamaModel is a model pulled to an Ollama server
+type OllamaModel struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+	// Family, ParameterSize and Quantization describe the model, e.g.
+	// "llama", "8.0B" and "Q4_K_M"
+	Family        string `json:"family,omitempty"`
+	ParameterSize string `json:"parameterSize,omitempty"`
+	Quantization  string `json:"quantization,omitempty"`
+}
+
+// PullProgress is a status update of PullModel. Total and Completed count
+// the bytes of the layer being downloaded, and are 0 for other steps such as
+// "pulling manifest" or "verifying sha256 digest".
+type PullProgress struct {
+	Status    string
+	Digest    string
+	Total     int64
+	Completed int64
+}
+
+// Model returns the model the provider sends requests to
+func (p *OllamaProvider) Model() string {
+	return p.model
+}
+
+// ListModels returns the models pulled to the Ollama server
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]OllamaModel, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Ollama at %s: %w", p.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var result struct {
+		Models []struct {
+			Name       string    `json:"name"`
+			Size       int64     `json:"size"`
+			ModifiedAt time.Time `json:"modified_at"`
+			Details    struct {
+				Family            string `json:"family"`
+				ParameterSize     string `json:"parameter_size"`
+				QuantizationLevel string `json:"quantization_level"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	models := make([]OllamaModel, 0, len(result.Models))
+	for _, m := range result.Models {
+		models = append(models, OllamaModel{
+			Name:          m.Name,
+			Size:          m.Size,
+			ModifiedAt:    m.ModifiedAt,
+			Family:        m.Details.Family,
+			ParameterSize: m.Details.ParameterSize,
+			Quantization:  m.Details.QuantizationLevel,
+		})
+	}
+	return models, nil
+}
+
+// CheckModel returns a ModelNotPulledError listing the pulled models when the
+// provider's model is not among them. Errors reaching Ollama are returned
+// as is.
+func (p *OllamaProvider) CheckModel(ctx context.Context) error {
+	models, err := p.ListModels(ctx)
+	if err != nil {
+		return err
+	}
+	var available []string
+	for _, m := range models {
+		if SameOllamaModel(m.Name, p.model) {
+			return nil
+		}
+		available = append(available, m.Name)
+	}
+	return &ModelNotPulledError{Model: p.model, Available: available}
+}
+
+// SameOllamaModel reports whether two model references name the same
+// model, where a reference without a tag means the "latest" tag
+func SameOllamaModel(a, b string) bool {
+	withTag := func(name string) string {
+		if !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+			return name + ":latest"
+		}
+		return name
+	}
+	return withTag(a) == withTag(b)
+}
+
+// PullModel downloads the provider's model to the Ollama server, calling
+// onProgress with each status update. Pulling a model that is already
+// present only checks it for updates.
+func (p *OllamaProvider) PullModel(ctx context.Context, onProgress func(PullProgress)) error {
+	jsonData, err := json.Marshal(map[string]interface{}{"model": p.model, "stream": true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/pull", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Downloads of several gigabytes outlast the provider's request
+	// timeout; the context bounds the pull instead
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Ollama at %s: %w", p.baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// The stream is one JSON object per line
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Status    string `json:"status"`
+			Digest    string `json:"digest"`
+			Total     int64  `json:"total"`
+			Completed int64  `json:"completed"`
+			Error     string `json:"error"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("Ollama ended the pull of %s without success", p.model)
+			}
+			return fmt.Errorf("failed to decode stream: %w", err)
+		}
+		if event.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", p.model, event.Error)
+		}
+		if onProgress != nil {
+			onProgress(PullProgress{Status: event.Status, Digest: event.Digest, Total: event.Total, Completed: event.Completed})
+		}
+		if event.Status == "success" {
+			return nil
+		}
+	}
+}
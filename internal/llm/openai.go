@@ -10,12 +10,26 @@ import (
 	"time"
 )
 
+func init() {
+	Register("openai", Factory{
+		New: func(model string) (Provider, error) {
+			apiKey, err := APIKey("OPENAI_API_KEY")
+			if err != nil {
+				return nil, err
+			}
+			return NewOpenAIProvider(apiKey, model), nil
+		},
+		DefaultModel: func() string { return "gpt-4" },
+		Description:  "OpenAI chat completions (OPENAI_API_KEY)",
+	})
+}
+
 // OpenAIProvider implements the Provider interface for OpenAI
 type OpenAIProvider struct {
 	apiKey  string
 	model   string
 	baseURL string
-	client  *http.Client
+	client  *retryClient
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
@@ -27,9 +41,9 @@ func NewOpenAIProvider(apiKey string, model string) *OpenAIProvider {
 		apiKey:  apiKey,
 		model:   model,
 		baseURL: "https://api.openai.com/v1",
-		client: &http.Client{
+		client: newRetryClient(&http.Client{
 			Timeout: 60 * time.Second,
-		},
+		}),
 	}
 }
 
@@ -40,34 +54,16 @@ func (p *OpenAIProvider) Name() string {
 
 // Analyze sends a prompt to OpenAI and returns the response
 func (p *OpenAIProvider) Analyze(ctx context.Context, prompt string) (string, error) {
-	requestBody := map[string]interface{}{
-		"model": p.model,
-		"messages": []map[string]string{
-			{
-				"role":    "system",
-				"content": "You are a Kubernetes troubleshooting expert. Analyze the provided diagnostic data and provide actionable insights.",
-			},
-			{
-				"role":    "user",
-				"content": prompt,
-			},
-		},
-		"temperature": 0.7,
-	}
-
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
-	}
+	return p.Chat(ctx, userMessage(prompt))
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+// Chat sends a conversation to OpenAI and returns the reply
+func (p *OpenAIProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	req, err := p.newRequest(ctx, messages, false)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-
 	resp, err := p.client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %w", err)
@@ -76,7 +72,7 @@ func (p *OpenAIProvider) Analyze(ctx context.Context, prompt string) (string, er
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return "", &APIError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var result struct {
@@ -85,6 +81,7 @@ func (p *OpenAIProvider) Analyze(ctx context.Context, prompt string) (string, er
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
@@ -94,6 +91,109 @@ func (p *OpenAIProvider) Analyze(ctx context.Context, prompt string) (string, er
 	if len(result.Choices) == 0 {
 		return "", fmt.Errorf("no response from API")
 	}
+	p.recordUsage(ctx, result.Usage)
 
 	return result.Choices[0].Message.Content, nil
 }
+
+// AnalyzeStream sends a prompt with stream enabled and delivers content
+// deltas on chunks as they arrive. chunks is closed when it returns.
+func (p *OpenAIProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	defer close(chunks)
+
+	req, err := p.newRequest(ctx, userMessage(prompt), true)
+	if err != nil {
+		return err
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return readSSE(resp.Body, func(data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			// Usage is only set on the last event, which has no choices
+			Usage *openAIUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to decode stream event: %w", err)
+		}
+		p.recordUsage(ctx, event.Usage)
+		if len(event.Choices) == 0 || event.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		return sendChunk(ctx, chunks, event.Choices[0].Delta.Content)
+	})
+}
+
+// openAIUsage is the token usage of a chat completion
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// recordUsage records the usage reported with a response, if any
+func (p *OpenAIProvider) recordUsage(ctx context.Context, usage *openAIUsage) {
+	if usage != nil {
+		recordUsage(ctx, p.Name(), p.model, usage.PromptTokens, usage.CompletionTokens)
+	}
+}
+
+// newRequest builds a chat completion request for messages
+func (p *OpenAIProvider) newRequest(ctx context.Context, messages []Message, stream bool) (*http.Request, error) {
+	var body []Message
+	if system := SystemPromptFrom(ctx); system != "" {
+		body = append(body, Message{Role: "system", Content: system})
+	}
+	body = append(body, messages...)
+
+	gen := GenerationFrom(ctx)
+	requestBody := map[string]interface{}{
+		"model":       p.model,
+		"messages":    body,
+		"temperature": gen.temperature(DefaultTemperature),
+	}
+	if gen.TopP != nil {
+		requestBody["top_p"] = *gen.TopP
+	}
+	if gen.MaxOutputTokens > 0 {
+		requestBody["max_tokens"] = gen.MaxOutputTokens
+	}
+	if stream {
+		requestBody["stream"] = true
+		requestBody["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	if jsonOutput(ctx) {
+		// JSON mode; needs a model that supports it, e.g. gpt-4o
+		requestBody["response_format"] = map[string]string{"type": "json_object"}
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	return req, nil
+}
@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/textutil"
+)
+
+// specGroup is a spec summary shared by unhealthy pods of one workload, so
+// replicas failing the same way show their spec once
+type specGroup struct {
+	workload string
+	pods     []string
+	spec     *k8s.PodSpecSummary
+}
+
+// groupPodSpecs groups the pods with a spec summary by workload and spec;
+// pods of a workload mid-rollout may have two
+func groupPodSpecs(pods []k8s.PodInfo) []*specGroup {
+	var groups []*specGroup
+	for _, pod := range pods {
+		if pod.Spec == nil {
+			continue
+		}
+		workload := pod.Owner
+		if workload == "" {
+			workload = "Pod/" + pod.Name
+		}
+		workload = k8s.Qualify(pod.Namespace, workload)
+		var group *specGroup
+		for _, g := range groups {
+			if g.workload == workload && reflect.DeepEqual(g.spec, pod.Spec) {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &specGroup{workload: workload, spec: pod.Spec}
+			groups = append(groups, group)
+		}
+		group.pods = append(group.pods, pod.Name)
+	}
+	return groups
+}
+
+// writePodSpecs renders the "Pod Specs" section of the spec summaries
+// collected for unhealthy pods
+func writePodSpecs(sb *strings.Builder, data *k8s.DiagnosticData) {
+	groups := groupPodSpecs(data.Pods)
+	if len(groups) == 0 {
+		return
+	}
+	sb.WriteString("## Pod Specs\n\n")
+	for _, g := range groups {
+		sb.WriteString(fmt.Sprintf("### %s (pods: %s)\n\n", g.workload, formatList(g.pods)))
+		s := g.spec
+		field := func(label string, values ...string) {
+			if len(values) > 0 && values[0] != "" {
+				sb.WriteString(fmt.Sprintf("- **%s:** %s\n", label, strings.Join(values, "; ")))
+			}
+		}
+		field("Service Account", s.ServiceAccount)
+		field("Node Selector", s.NodeSelector...)
+		field("Affinity", s.Affinity...)
+		field("Tolerations", s.Tolerations...)
+		field("Topology Spread", s.TopologySpread...)
+		field("Priority Class", s.PriorityClass)
+		field("Runtime Class", s.RuntimeClass)
+		if s.HostNetwork {
+			field("Host Network", "true")
+		}
+		field("Security Context", s.SecurityContext...)
+		field("Volumes", s.Volumes...)
+		for _, c := range s.Containers {
+			label := "Container " + c.Name
+			if c.Init {
+				label = "Init Container " + c.Name
+			}
+			field(label, formatContainerSpec(c))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// formatContainerSpec renders a container spec summary, e.g. "requests
+// cpu=100m memory=128Mi; limits memory=256Mi; env: DB_URL, LOG_LEVEL"
+func formatContainerSpec(c k8s.ContainerSpecSummary) string {
+	var parts []string
+	if r := c.Resources; r != nil {
+		parts = append(parts, fmt.Sprintf("requests cpu=%s memory=%s", formatLimit(k8s.FormatCPU, r.CPURequest), formatLimit(k8s.FormatMemory, r.MemoryRequest)),
+			fmt.Sprintf("limits cpu=%s memory=%s", formatLimit(k8s.FormatCPU, r.CPULimit), formatLimit(k8s.FormatMemory, r.MemoryLimit)))
+	} else {
+		parts = append(parts, "no requests or limits")
+	}
+	if len(c.ExtendedResources) > 0 {
+		parts = append(parts, strings.Join(c.ExtendedResources, ", "))
+	}
+	if len(c.Env) > 0 {
+		parts = append(parts, "env: "+strings.Join(c.Env, ", "))
+	}
+	if len(c.EnvFrom) > 0 {
+		parts = append(parts, "envFrom: "+strings.Join(c.EnvFrom, ", "))
+	}
+	if len(c.VolumeMounts) > 0 {
+		parts = append(parts, "mounts: "+strings.Join(c.VolumeMounts, ", "))
+	}
+	if len(c.SecurityContext) > 0 {
+		parts = append(parts, "security: "+strings.Join(c.SecurityContext, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// writeCompactPodSpecs renders spec summaries in the terse form of
+// BuildCompactPrompt, one SPEC line per workload and spec
+func writeCompactPodSpecs(sb *strings.Builder, data *k8s.DiagnosticData) {
+	for _, g := range groupPodSpecs(data.Pods) {
+		s := g.spec
+		sb.WriteString("SPEC " + g.workload)
+		field := func(key string, values []string) {
+			if len(values) > 0 {
+				sb.WriteString(fmt.Sprintf(" %s=%s", key, textutil.Truncate(strings.Join(values, ";"), 160)))
+			}
+		}
+		if s.ServiceAccount != "" {
+			sb.WriteString(" sa=" + s.ServiceAccount)
+		}
+		field("nodesel", s.NodeSelector)
+		field("aff", s.Affinity)
+		field("tol", s.Tolerations)
+		field("spread", s.TopologySpread)
+		field("sec", s.SecurityContext)
+		field("vol", s.Volumes)
+		sb.WriteString("\n")
+		for _, c := range s.Containers {
+			sb.WriteString(fmt.Sprintf(" c=%s %s\n", c.Name, textutil.Truncate(formatContainerSpec(c), 200)))
+		}
+	}
+}
@@ -3,21 +3,758 @@ package llm
 import (
 	"fmt"
 	"kubehelp/internal/k8s"
+	"kubehelp/internal/textutil"
 	"strings"
 	"time"
 )
 
+// DetailLevel controls how much per-container detail the verbose prompt includes
+type DetailLevel string
+
+const (
+	// DetailIssuesOnly shows container details only for pods with issues
+	DetailIssuesOnly DetailLevel = "issues-only"
+	// DetailAll shows container details for every pod, for full audits
+	DetailAll DetailLevel = "all"
+	// DetailMinimal drops container details, keeping the summary and events
+	DetailMinimal DetailLevel = "minimal"
+)
+
+// ParseDetailLevel validates a detail level name; empty selects issues-only
+func ParseDetailLevel(s string) (DetailLevel, error) {
+	switch level := DetailLevel(s); level {
+	case "":
+		return DetailIssuesOnly, nil
+	case DetailIssuesOnly, DetailAll, DetailMinimal:
+		return level, nil
+	}
+	return "", fmt.Errorf("invalid detail level %q (supported: issues-only, all, minimal)", s)
+}
+
+// PromptOptions configures the verbose prompt. Zero values select the defaults.
+type PromptOptions struct {
+	// DetailLevel defaults to DetailIssuesOnly
+	DetailLevel DetailLevel
+}
+
 // BuildDiagnosticPrompt creates a structured prompt from diagnostic data
 func BuildDiagnosticPrompt(data *k8s.DiagnosticData) string {
-	var sb strings.Builder
+	return BuildDiagnosticPromptWithOptions(data, PromptOptions{})
+}
+
+// BuildDiagnosticPromptWithOptions creates a structured prompt with custom
+// options, rendered from DefaultPromptTemplate
+func BuildDiagnosticPromptWithOptions(data *k8s.DiagnosticData, opts PromptOptions) string {
+	prompt, err := defaultPromptTemplate.Build(data, opts)
+	if err != nil {
+		// The default template only fails on a bug in it
+		panic(err)
+	}
+	return prompt
+}
+
+// compactLogLines is the number of trailing log lines kept per container in compact prompts
+const compactLogLines = 10
 
-	sb.WriteString("# Kubernetes Diagnostic Report\n\n")
-	sb.WriteString(fmt.Sprintf("**Cluster Context:** %s\n", data.ContextName))
-	sb.WriteString(fmt.Sprintf("**Namespace:** %s\n", data.Namespace))
-	sb.WriteString(fmt.Sprintf("**Collection Time:** %s\n\n", data.CollectedAt.Format(time.RFC3339)))
+// BuildCompactPrompt creates a terse, token-minimal prompt for small-context models.
+// Unlike BuildDiagnosticPrompt it avoids Markdown tables, abbreviates field
+// names and only lists unhealthy pods.
+func BuildCompactPrompt(data *k8s.DiagnosticData) string {
+	var sb strings.Builder
 
+	contextName := data.ContextName
+	if len(data.Clusters) > 0 {
+		contextName = strings.Join(clusterNames(data), ",")
+	}
+	sb.WriteString(fmt.Sprintf("K8S DIAG ctx=%s ns=%s t=%s\n",
+		contextName, namespaceLabel(data.Namespace), data.CollectedAt.Format(time.RFC3339)))
 	if len(data.Workloads) > 0 {
-		sb.WriteString(fmt.Sprintf("**Focused Workloads:** %s\n\n", strings.Join(data.Workloads, ", ")))
+		sb.WriteString(fmt.Sprintf("wl=%s\n", strings.Join(data.Workloads, ",")))
+	}
+
+	if len(data.Clusters) > 0 {
+		for _, w := range data.Warnings {
+			sb.WriteString(fmt.Sprintf("WARN %s\n", textutil.Truncate(w, 160)))
+		}
+		for _, cluster := range data.Clusters {
+			sb.WriteString(fmt.Sprintf("CLUSTER ctx=%s\n", cluster.ContextName))
+			writeCompactSections(&sb, &cluster)
+		}
+		sb.WriteString("TASK: list issues per cluster, differences between clusters, root cause, fix steps, kubectl cmds. Be brief.\n")
+		return sb.String()
+	}
+	writeCompactSections(&sb, data)
+
+	sb.WriteString("TASK: list issues, root cause, fix steps, kubectl cmds. Be brief.\n")
+
+	return sb.String()
+}
+
+// formatControllerStatus summarizes why a controller is not settled, e.g.
+// "Progressing=False (ProgressDeadlineExceeded: ...)" or "rolling out"
+func formatControllerStatus(c k8s.ControllerStatus) string {
+	var parts []string
+	if c.Paused {
+		parts = append(parts, "paused")
+	}
+	if c.CurrentRevision != c.UpdateRevision {
+		parts = append(parts, fmt.Sprintf("rolling out %s -> %s", c.CurrentRevision, c.UpdateRevision))
+	}
+	if c.Unscheduled > 0 {
+		parts = append(parts, fmt.Sprintf("%d nodes unscheduled", c.Unscheduled))
+	}
+	if c.Misscheduled > 0 {
+		parts = append(parts, fmt.Sprintf("%d nodes misscheduled", c.Misscheduled))
+	}
+	for _, cond := range c.Conditions {
+		if cond.Status == "True" && cond.Type != "ReplicaFailure" {
+			continue
+		}
+		part := fmt.Sprintf("%s=%s", cond.Type, cond.Status)
+		switch {
+		case cond.Reason != "" && cond.Message != "":
+			part += fmt.Sprintf(" (%s: %s)", cond.Reason, textutil.Truncate(cond.Message, 120))
+		case cond.Reason != "":
+			part += fmt.Sprintf(" (%s)", cond.Reason)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, "; ")
+	}
+
+	switch {
+	case c.Kind != "ReplicaSet" && c.Updated < c.Desired:
+		return "rolling out"
+	case c.Ready < c.Desired:
+		return "replicas not ready"
+	}
+	return "ok"
+}
+
+// releaseHasIssues reports whether a controller of the release has issues
+func releaseHasIssues(r k8s.HelmRelease, controllers []k8s.ControllerStatus) bool {
+	for _, c := range controllers {
+		if c.HelmRelease == r.Name && c.Namespace == r.Namespace && c.HasIssues() {
+			return true
+		}
+	}
+	return false
+}
+
+// formatHelmUpdated renders when a revision was deployed relative to
+// collection, e.g. "2h ago"
+func formatHelmUpdated(rev k8s.HelmRevision, now time.Time) string {
+	if rev.Updated.IsZero() {
+		return "-"
+	}
+	return formatDuration(now.Sub(rev.Updated)) + " ago"
+}
+
+// formatHelmRevision renders a history entry like "helm history", e.g.
+// "4 superseded api-1.4.1 (app 2.3.0), 3d ago: Upgrade complete"
+func formatHelmRevision(rev k8s.HelmRevision, now time.Time) string {
+	s := fmt.Sprintf("%d %s %s", rev.Revision, rev.Status, rev.Chart)
+	if rev.AppVersion != "" {
+		s += fmt.Sprintf(" (app %s)", rev.AppVersion)
+	}
+	s += ", " + formatHelmUpdated(rev, now)
+	if rev.Description != "" {
+		s += ": " + textutil.Truncate(rev.Description, 200)
+	}
+	return s
+}
+
+// formatCustomResourceConditions renders the failing conditions of a
+// custom resource, or all of them, e.g. "Ready=False (Failed): ..."
+func formatCustomResourceConditions(conditions []k8s.CustomResourceCondition, all bool) string {
+	var parts []string
+	for _, c := range conditions {
+		if !all && !c.Failing() {
+			continue
+		}
+		part := c.Type
+		if c.Status != "" {
+			part += "=" + c.Status
+		}
+		if c.Reason != "" {
+			part += " (" + c.Reason + ")"
+		}
+		if c.Message != "" {
+			part += ": " + textutil.Truncate(c.Message, 200)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// formatStorageClass renders a claim's storage class with a delayed binding
+// mode, e.g. "gp3 (WaitForFirstConsumer)"
+func formatStorageClass(c k8s.VolumeClaimInfo) string {
+	class := c.StorageClass
+	if class == "" {
+		class = "-"
+	}
+	if c.BindingMode != "" && c.BindingMode != "Immediate" {
+		class += fmt.Sprintf(" (%s)", c.BindingMode)
+	}
+	return class
+}
+
+// formatVolume renders the volume bound to a claim with its phase and
+// source when known, e.g. "pvc-1a2b (Released, ebs.csi.aws.com)"
+func formatVolume(c k8s.VolumeClaimInfo) string {
+	v := c.Volume
+	if v == nil {
+		if c.VolumeName == "" {
+			return "-"
+		}
+		return c.VolumeName
+	}
+	status := v.Phase
+	if v.Source != "" {
+		status += ", " + v.Source
+	}
+	if v.Message != "" {
+		status += ": " + textutil.Truncate(v.Message, 80)
+	}
+	return fmt.Sprintf("%s (%s)", v.Name, status)
+}
+
+// formatList joins names, or renders "-" for none
+func formatList(names []string) string {
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ", ")
+}
+
+// formatPolicyRules renders the allow rules of a NetworkPolicy in one
+// direction, "none (deny all)" when it isolates that direction without
+// rules, or "-" when it does not isolate it
+func formatPolicyRules(np k8s.NetworkPolicyInfo, policyType string, rules []string) string {
+	if !np.Isolates(policyType) {
+		return "-"
+	}
+	if len(rules) == 0 {
+		return "none (deny all)"
+	}
+	return strings.Join(rules, "; ")
+}
+
+// formatIngressRules renders Ingress rules as "host/path->service:port"
+func formatIngressRules(rules []k8s.IngressRule) string {
+	var parts []string
+	for _, r := range rules {
+		target := r.Service
+		if r.Port != "" {
+			target += ":" + r.Port
+		}
+		if r.Host == "" && r.Path == "" {
+			parts = append(parts, "default->"+target)
+			continue
+		}
+		host := r.Host
+		if host == "" {
+			host = "*"
+		}
+		parts = append(parts, host+r.Path+"->"+target)
+	}
+	return formatList(parts)
+}
+
+// formatRouteBackends renders route backends, e.g. "Service/api:8080"
+func formatRouteBackends(backends []k8s.RouteBackend) string {
+	var parts []string
+	for _, b := range backends {
+		name := b.Kind + "/" + k8s.Qualify(b.Namespace, b.Name)
+		if b.Port != 0 {
+			name += fmt.Sprintf(":%d", b.Port)
+		}
+		parts = append(parts, name)
+	}
+	return formatList(parts)
+}
+
+// formatRouteConditions renders route conditions per parent, e.g.
+// "Gateway/infra/public: Accepted=True, ResolvedRefs=False (BackendNotFound)"
+func formatRouteConditions(conditions []k8s.RouteCondition) string {
+	var parts []string
+	parent := ""
+	for _, c := range conditions {
+		part := c.Type + "=" + c.Status
+		if c.Status != "True" && c.Reason != "" {
+			part += " (" + c.Reason + ")"
+		}
+		if c.Parent != parent {
+			parent = c.Parent
+			part = parent + ": " + part
+		}
+		parts = append(parts, part)
+	}
+	return formatList(parts)
+}
+
+// formatNodeUsage renders requested of allocatable with a percentage, e.g.
+// "3.5/4 (87%)"
+func formatNodeUsage(requested, allocatable string, req, alloc int64) string {
+	if alloc <= 0 {
+		return requested
+	}
+	return fmt.Sprintf("%s/%s (%d%%)", requested, allocatable, req*100/alloc)
+}
+
+// formatNodeCurrentUsage renders a node's usage from metrics-server as a
+// share of allocatable, e.g. "cpu 2.5 (62%), mem 12.1Gi (80%)", or "-"
+func formatNodeCurrentUsage(n k8s.NodeInfo) string {
+	if n.UsedCPU == 0 && n.UsedMemory == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("cpu %s, mem %s",
+		formatNodeUsage(k8s.FormatCPU(n.UsedCPU), k8s.FormatCPU(n.AllocatableCPU), n.UsedCPU, n.AllocatableCPU),
+		formatNodeUsage(k8s.FormatMemory(n.UsedMemory), k8s.FormatMemory(n.AllocatableMemory), n.UsedMemory, n.AllocatableMemory))
+}
+
+// formatUsage renders a container's usage against its requests and limits,
+// e.g. "cpu 950m (request 500m, limit 1, 95% of limit), memory 480Mi
+// (request 256Mi, no limit)"
+func formatUsage(u *k8s.ContainerUsage) string {
+	return fmt.Sprintf("cpu %s, memory %s",
+		formatUsageOf(k8s.FormatCPU, u.CPU, u.CPURequest, u.CPULimit),
+		formatUsageOf(k8s.FormatMemory, u.Memory, u.MemoryRequest, u.MemoryLimit))
+}
+
+// formatResources renders a container's requests and limits, e.g. "memory
+// request 256Mi, limit 512Mi; cpu request 100m, no limit"
+func formatResources(r *k8s.ContainerResources) string {
+	return fmt.Sprintf("memory %s; cpu %s",
+		formatResourcesOf(k8s.FormatMemory, r.MemoryRequest, r.MemoryLimit),
+		formatResourcesOf(k8s.FormatCPU, r.CPURequest, r.CPULimit))
+}
+
+func formatResourcesOf(format func(int64) string, request, limit int64) string {
+	parts := []string{"no request"}
+	if request > 0 {
+		parts[0] = "request " + format(request)
+	}
+	if limit > 0 {
+		return strings.Join(append(parts, "limit "+format(limit)), ", ")
+	}
+	return strings.Join(append(parts, "no limit"), ", ")
+}
+
+func formatUsageOf(format func(int64) string, used, request, limit int64) string {
+	var parts []string
+	if request > 0 {
+		parts = append(parts, "request "+format(request))
+	}
+	if limit > 0 {
+		parts = append(parts, fmt.Sprintf("limit %s, %d%% of limit", format(limit), used*100/limit))
+	} else {
+		parts = append(parts, "no limit")
+	}
+	return fmt.Sprintf("%s (%s)", format(used), strings.Join(parts, ", "))
+}
+
+// formatLimit renders a limit, or "-" when unset
+func formatLimit(format func(int64) string, limit int64) string {
+	if limit <= 0 {
+		return "-"
+	}
+	return format(limit)
+}
+
+// formatNodeStatus lists a node's abnormal conditions, cordon and taints,
+// e.g. "MemoryPressure (KubeletHasInsufficientMemory); taints: gpu:NoSchedule"
+func formatNodeStatus(n k8s.NodeInfo) string {
+	var parts []string
+	for _, cond := range n.Conditions {
+		if cond.Type == "Ready" {
+			continue
+		}
+		part := cond.Type
+		if cond.Reason != "" {
+			part += fmt.Sprintf(" (%s)", cond.Reason)
+		}
+		parts = append(parts, part)
+	}
+	if n.Unschedulable {
+		parts = append(parts, "cordoned")
+	}
+	if len(n.Taints) > 0 {
+		parts = append(parts, "taints: "+strings.Join(n.Taints, ", "))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// hasContainerIssues reports whether any container in the pod is not ready,
+// not running or has restarted, or an init container has not finished or
+// has restarted
+func hasContainerIssues(pod k8s.PodInfo) bool {
+	for _, cs := range pod.ContainerStatuses {
+		if !cs.Ready || cs.State != "Running" || cs.RestartCount > 0 {
+			return true
+		}
+	}
+	for _, cs := range pod.InitContainerStatuses {
+		if !cs.InitDone() || cs.RestartCount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// formatPhase renders the pod phase, with the init status while init
+// containers hold up the pod, e.g. "Pending (Init:CrashLoopBackOff)"
+func formatPhase(pod k8s.PodInfo) string {
+	if status := pod.InitStatus(); status != "" {
+		return fmt.Sprintf("%s (%s)", pod.Phase, status)
+	}
+	return pod.Phase
+}
+
+// hasUnmetReadinessGates reports whether any readiness gate condition is
+// missing or not True
+func hasUnmetReadinessGates(pod k8s.PodInfo) bool {
+	for _, gate := range pod.ReadinessGates {
+		if !gate.Met() {
+			return true
+		}
+	}
+	return false
+}
+
+// isPodUnhealthy reports whether a pod needs attention: a non-running phase,
+// container issues, any reported condition or an unmet readiness gate
+func isPodUnhealthy(pod k8s.PodInfo) bool {
+	if pod.Phase != "Running" && pod.Phase != "Succeeded" {
+		return true
+	}
+	return hasContainerIssues(pod) || len(pod.Conditions) > 0 || hasUnmetReadinessGates(pod)
+}
+
+// formatGateStatus renders a readiness gate status, noting gates whose
+// condition has not been reported yet
+func formatGateStatus(gate k8s.ReadinessGateStatus) string {
+	if gate.Status == "" {
+		return "NotReported"
+	}
+	return gate.Status
+}
+
+// writeContainerDetails writes the status of one container under a label
+// such as "Container" or "Init Container"
+func writeContainerDetails(sb *strings.Builder, label string, cs k8s.ContainerStatus) {
+	sb.WriteString(fmt.Sprintf("**%s:** %s\n", label, cs.Name))
+	sb.WriteString(fmt.Sprintf("- Image: %s\n", cs.Image))
+	sb.WriteString(fmt.Sprintf("- State: %s\n", cs.State))
+	sb.WriteString(fmt.Sprintf("- Ready: %v\n", cs.Ready))
+	sb.WriteString(fmt.Sprintf("- Restart Count: %d\n", cs.RestartCount))
+	if cs.Reason != "" {
+		sb.WriteString(fmt.Sprintf("- Reason: %s\n", cs.Reason))
+	}
+	if cs.Message != "" {
+		sb.WriteString(fmt.Sprintf("- Message: %s\n", cs.Message))
+	}
+	if t := cs.Termination; t != nil {
+		sb.WriteString(fmt.Sprintf("- Terminated: %s\n", formatTermination(t)))
+	}
+	if t := cs.LastTermination; t != nil {
+		sb.WriteString(fmt.Sprintf("- Last Termination: %s\n", formatTermination(t)))
+	}
+	if len(cs.Ports) > 0 {
+		sb.WriteString(fmt.Sprintf("- Ports: %s\n", strings.Join(cs.Ports, ", ")))
+	}
+	for _, probe := range cs.Probes {
+		sb.WriteString(fmt.Sprintf("- %s Probe: %s", probe.Kind, probe.Spec()))
+		if probe.Failures > 0 {
+			sb.WriteString(fmt.Sprintf("; failed %d times, last: %s", probe.Failures, probe.LastFailure))
+		}
+		if probe.Problem != "" {
+			sb.WriteString("; " + probe.Problem)
+		}
+		sb.WriteString("\n")
+	}
+	if r := cs.Resources; r != nil {
+		sb.WriteString(fmt.Sprintf("- Resources: %s\n", formatResources(r)))
+	}
+	if cs.Usage != nil {
+		sb.WriteString(fmt.Sprintf("- Usage: %s\n", formatUsage(cs.Usage)))
+	}
+	if p := cs.ImagePull; p != nil {
+		sb.WriteString(fmt.Sprintf("- Image Pull: %s\n", formatImageRef(p)))
+		if len(p.PullSecrets) == 0 {
+			sb.WriteString("- Pull Secrets: none (pod and ServiceAccount have no imagePullSecrets)\n")
+		}
+		for _, secret := range p.PullSecrets {
+			sb.WriteString(fmt.Sprintf("- Pull Secret: %s\n", formatPullSecret(secret)))
+		}
+		for _, e := range p.Events {
+			sb.WriteString(fmt.Sprintf("- Pull Event: %s\n", formatPullEvent(e)))
+		}
+	}
+	if len(cs.Env) > 0 {
+		sb.WriteString(fmt.Sprintf("- Env: %s\n", formatEnv(cs.Env)))
+	}
+	if len(cs.EnvFrom) > 0 {
+		sb.WriteString(fmt.Sprintf("- Env From: %s\n", strings.Join(cs.EnvFrom, ", ")))
+	}
+	sb.WriteString("\n")
+}
+
+// writeCompactImagePull writes why the image of a container cannot be
+// pulled: the parsed reference, the pull secrets and the latest pull event
+func writeCompactImagePull(sb *strings.Builder, cs k8s.ContainerStatus) {
+	p := cs.ImagePull
+	if p == nil {
+		return
+	}
+	sb.WriteString("  pull=" + formatImageRef(p))
+	if len(p.PullSecrets) == 0 {
+		sb.WriteString(" secrets=none")
+	}
+	for _, secret := range p.PullSecrets {
+		sb.WriteString(" secret=" + formatPullSecret(secret))
+	}
+	if len(p.Events) > 0 {
+		sb.WriteString(" event=" + textutil.Truncate(formatPullEvent(p.Events[0]), 160))
+	}
+	sb.WriteString("\n")
+}
+
+// formatImageRef renders a parsed image reference as "registry R,
+// repository P, tag T", with the digest and pull policy when set
+func formatImageRef(p *k8s.ImagePullInfo) string {
+	parts := []string{"registry " + p.Registry, "repository " + p.Repository}
+	if p.Tag != "" {
+		parts = append(parts, "tag "+p.Tag)
+	}
+	if p.Digest != "" {
+		parts = append(parts, "digest "+p.Digest)
+	}
+	if p.PullPolicy != "" {
+		parts = append(parts, "policy "+p.PullPolicy)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatPullSecret renders a pull secret with where it comes from, whether
+// it exists and the registries it holds credentials for
+func formatPullSecret(s k8s.PullSecretInfo) string {
+	out := fmt.Sprintf("%s (from %s)", s.Name, s.Source)
+	switch {
+	case s.Missing:
+		return out + " does not exist"
+	case s.Unreadable:
+		return out + " could not be read"
+	}
+	if len(s.Registries) == 0 {
+		out += fmt.Sprintf(" type %s holds no registry credentials", s.Type)
+	} else {
+		out += " for " + strings.Join(s.Registries, ", ")
+		if s.MatchesRegistry {
+			out += " (matches the image registry)"
+		} else {
+			out += " (not the image registry)"
+		}
+	}
+	if !s.UpdatedAt.IsZero() {
+		out += ", updated " + formatDuration(time.Since(s.UpdatedAt)) + " ago"
+	}
+	return out
+}
+
+// formatPullEvent renders a kubelet pull event with its node and count
+func formatPullEvent(e k8s.PullEvent) string {
+	out := e.Reason
+	if e.Node != "" {
+		out += " on " + e.Node
+	}
+	if e.Count > 1 {
+		out += fmt.Sprintf(" (x%d)", e.Count)
+	}
+	return out + ": " + e.Message
+}
+
+// writeCompactProbes writes the failing or mismatched probes of a container,
+// with its declared ports, one per line
+func writeCompactProbes(sb *strings.Builder, cs k8s.ContainerStatus) {
+	for _, p := range cs.Probes {
+		if p.Failures == 0 && p.Problem == "" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("  probe=%s %s t=%ds p=%ds f=%d", strings.ToLower(p.Kind), p.Handler, p.TimeoutSeconds, p.PeriodSeconds, p.FailureThreshold))
+		if len(cs.Ports) > 0 {
+			sb.WriteString(" ports=" + strings.Join(cs.Ports, ","))
+		}
+		if p.Failures > 0 {
+			sb.WriteString(fmt.Sprintf(" fails=%d last=%s", p.Failures, textutil.Truncate(p.LastFailure, 120)))
+		}
+		if p.Problem != "" {
+			sb.WriteString(" problem=" + p.Problem)
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// formatTermination renders a container termination as "Reason (exit N) at time"
+func formatTermination(t *k8s.TerminationInfo) string {
+	s := fmt.Sprintf("%s (exit %d)", t.Reason, t.ExitCode)
+	if !t.FinishedAt.IsZero() {
+		s += " at " + t.FinishedAt.Format(time.RFC3339)
+		if !t.StartedAt.IsZero() {
+			s += " after running " + formatDuration(t.FinishedAt.Sub(t.StartedAt))
+		}
+	}
+	return s
+}
+
+// formatDuration converts a duration to a human-readable string
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	} else if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	} else if d < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	days := int(d.Hours() / 24)
+	return fmt.Sprintf("%dd", days)
+}
+
+// eventWindow names how far back events were collected, e.g. "Hour" or
+// "6h"; data from before the window was configurable covers an hour
+func eventWindow(since time.Duration) string {
+	if since == 0 || since == time.Hour {
+		return "Hour"
+	}
+	s := since.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// formatRestarts renders a pod's restart count; when one container of a
+// multi-container pod is flapping, the per-container breakdown and the
+// dominant contributor are added, e.g. "312 (mostly worker: worker (312), sidecar (0))"
+func formatRestarts(pod k8s.PodInfo) string {
+	if !pod.HasRestartBreakdown() {
+		return fmt.Sprintf("%d", pod.Restarts)
+	}
+	if top, ok := pod.DominantRestarter(); ok {
+		return fmt.Sprintf("%d (mostly %s: %s)", pod.Restarts, top.Name, pod.RestartBreakdown())
+	}
+	return fmt.Sprintf("%d (%s)", pod.Restarts, pod.RestartBreakdown())
+}
+
+// formatEnv renders env vars as NAME=value, or NAME (from <source>) for
+// referenced values, which are never collected
+func formatEnv(env []k8s.EnvVar) string {
+	parts := make([]string, 0, len(env))
+	for _, e := range env {
+		if e.Source != "" {
+			parts = append(parts, fmt.Sprintf("%s (from %s)", e.Name, e.Source))
+		} else {
+			parts = append(parts, e.Name+"="+e.Value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// namespaceLabel renders the collected namespace, spelling out cluster-wide
+// collection; multi-namespace collections are already a comma-separated list
+func namespaceLabel(namespace string) string {
+	if namespace == k8s.AllNamespaces {
+		return "all namespaces"
+	}
+	return namespace
+}
+
+// clusterNames returns the context names of a multi-cluster collection
+func clusterNames(data *k8s.DiagnosticData) []string {
+	names := make([]string, len(data.Clusters))
+	for i, cluster := range data.Clusters {
+		names[i] = cluster.ContextName
+	}
+	return names
+}
+
+// writeNamespaces writes the section of each namespace of a multi-namespace
+// collection that has issues, so the model can tell which namespaces are
+// affected; healthy namespaces are only counted
+func writeNamespaces(sb *strings.Builder, namespaces []k8s.NamespaceSummary) {
+	if len(namespaces) == 0 {
+		return
+	}
+	healthy := 0
+	sb.WriteString("## Namespaces\n\n")
+	for _, ns := range namespaces {
+		switch {
+		case ns.Skipped != "":
+			sb.WriteString(fmt.Sprintf("- **%s:** not collected (%s)\n", ns.Name, ns.Skipped))
+		case ns.HasIssues():
+			sb.WriteString(fmt.Sprintf("- **%s:** %d pods, %d unhealthy, %d findings", ns.Name, ns.Pods, ns.Unhealthy, ns.Findings))
+			if ns.Severity != "" {
+				sb.WriteString(fmt.Sprintf(" (most severe: %s)", ns.Severity))
+			}
+			sb.WriteString("\n")
+		default:
+			healthy++
+		}
+	}
+	if healthy > 0 {
+		sb.WriteString(fmt.Sprintf("- %d other namespaces have no unhealthy pods or findings\n", healthy))
+	}
+	sb.WriteString("\n")
+}
+
+// writeWarnings lists collection caveats, e.g. clock skew, so the model
+// does not misread gaps
+func writeWarnings(sb *strings.Builder, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	sb.WriteString("## Collection Warnings\n\n")
+	for _, w := range warnings {
+		sb.WriteString(fmt.Sprintf("- %s\n", w))
+	}
+	sb.WriteString("\n")
+}
+
+// writeDiagnosticSections writes the verbose report sections for the data of
+// a single cluster
+func writeDiagnosticSections(sb *strings.Builder, data *k8s.DiagnosticData, opts PromptOptions) {
+	writeWarnings(sb, data.Warnings)
+
+	// Data left out to fit the token budget, so the model knows it exists
+	if len(data.Omitted) > 0 {
+		sb.WriteString("## Omitted Data\n\n")
+		sb.WriteString("Collected but left out to keep this report within its size budget:\n\n")
+		for _, o := range data.Omitted {
+			sb.WriteString(fmt.Sprintf("- %s\n", o))
+		}
+		sb.WriteString("\n")
+	}
+
+	writeNamespaces(sb, data.Namespaces)
+
+	// Deterministic findings
+	if len(data.Findings) > 0 {
+		sb.WriteString("## Detected Findings\n\n")
+		for _, f := range data.Findings {
+			sb.WriteString(fmt.Sprintf("- [%s] %s (%s): %s\n", f.Severity, k8s.Qualify(f.Namespace, f.Object), f.Rule, f.Message))
+		}
+		sb.WriteString("\n")
 	}
 
 	// Pod Status Summary
@@ -29,47 +766,297 @@ func BuildDiagnosticPrompt(data *k8s.DiagnosticData) string {
 		sb.WriteString("|----------|-------|-------|----------|-----|------|\n")
 		for _, pod := range data.Pods {
 			age := formatDuration(pod.Age)
-			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %d | %s | %s |\n",
-				pod.Name, pod.Phase, pod.Ready, pod.Restarts, age, pod.NodeName))
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+				k8s.Qualify(pod.Namespace, pod.Name), formatPhase(pod), pod.Ready, formatRestarts(pod), age, pod.NodeName))
 		}
 		sb.WriteString("\n")
 	}
 
-	// Container Details
-	sb.WriteString("## Container Details\n\n")
-	for _, pod := range data.Pods {
-		if len(pod.ContainerStatuses) == 0 {
-			continue
+	// Workload Controllers, unless auditing everything only those with issues
+	var controllers []k8s.ControllerStatus
+	for _, c := range data.Controllers {
+		if opts.DetailLevel == DetailAll || c.HasIssues() {
+			controllers = append(controllers, c)
+		}
+	}
+	if len(controllers) > 0 {
+		sb.WriteString("## Workload Controllers\n\n")
+		sb.WriteString("| Controller | Desired | Ready | Updated | Available | Status |\n")
+		sb.WriteString("|------------|---------|-------|---------|-----------|--------|\n")
+		for _, c := range controllers {
+			updated := "-"
+			if c.Kind != "ReplicaSet" {
+				updated = fmt.Sprint(c.Updated)
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %d | %d | %s | %d | %s |\n",
+				k8s.Qualify(c.Namespace, c.Kind+"/"+c.Name), c.Desired, c.Ready, updated, c.Available, formatControllerStatus(c)))
 		}
+		sb.WriteString("\n")
+	}
 
-		// Only include pods with issues
-		hasIssues := false
-		for _, cs := range pod.ContainerStatuses {
-			if !cs.Ready || cs.State != "Running" || cs.RestartCount > 0 {
-				hasIssues = true
-				break
+	// Helm releases behind failing controllers, unless auditing everything
+	// only those with issues
+	var releases []k8s.HelmRelease
+	for _, r := range data.HelmReleases {
+		if opts.DetailLevel == DetailAll || r.HasIssues() || releaseHasIssues(r, data.Controllers) {
+			releases = append(releases, r)
+		}
+	}
+	if len(releases) > 0 {
+		sb.WriteString("## Helm Releases\n\n")
+		sb.WriteString("If a workload broke after a recent upgrade, suggest `helm rollback <release> <revision> -n <namespace>` to the last good revision alongside the fix.\n\n")
+		sb.WriteString("| Release | Revision | Status | Chart | App Version | Updated | Controllers |\n")
+		sb.WriteString("|---------|----------|--------|-------|-------------|---------|-------------|\n")
+		for _, r := range releases {
+			current := r.Current()
+			sb.WriteString(fmt.Sprintf("| %s | %d | %s | %s | %s | %s | %s |\n",
+				k8s.Qualify(r.Namespace, r.Name), current.Revision, current.Status, current.Chart,
+				current.AppVersion, formatHelmUpdated(current, data.CollectedAt), formatList(r.Controllers)))
+		}
+		sb.WriteString("\n")
+		for _, r := range releases {
+			if len(r.Revisions) < 2 {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("**History of %s:**\n", k8s.Qualify(r.Namespace, r.Name)))
+			for _, rev := range r.Revisions {
+				sb.WriteString(fmt.Sprintf("- %s\n", formatHelmRevision(rev, data.CollectedAt)))
 			}
+			sb.WriteString("\n")
 		}
+	}
 
-		if !hasIssues && len(pod.Conditions) == 0 {
-			continue
+	// Nodes behind scheduling failures and evictions
+	if len(data.Nodes) > 0 {
+		sb.WriteString("## Nodes\n\n")
+		sb.WriteString("| Node | Ready | CPU Requested | Memory Requested | Current Usage | Pods | Kubelet | Status |\n")
+		sb.WriteString("|------|-------|---------------|------------------|---------------|------|---------|--------|\n")
+		for _, n := range data.Nodes {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %d/%d | %s | %s |\n",
+				n.Name, n.Ready,
+				formatNodeUsage(k8s.FormatCPU(n.RequestedCPU), k8s.FormatCPU(n.AllocatableCPU), n.RequestedCPU, n.AllocatableCPU),
+				formatNodeUsage(k8s.FormatMemory(n.RequestedMemory), k8s.FormatMemory(n.AllocatableMemory), n.RequestedMemory, n.AllocatableMemory),
+				formatNodeCurrentUsage(n), n.Pods, n.AllocatablePods, n.KubeletVersion, formatNodeStatus(n)))
 		}
+		sb.WriteString("\n")
+	}
 
-		sb.WriteString(fmt.Sprintf("### Pod: %s\n\n", pod.Name))
-		for _, cs := range pod.ContainerStatuses {
-			sb.WriteString(fmt.Sprintf("**Container:** %s\n", cs.Name))
-			sb.WriteString(fmt.Sprintf("- Image: %s\n", cs.Image))
-			sb.WriteString(fmt.Sprintf("- State: %s\n", cs.State))
-			sb.WriteString(fmt.Sprintf("- Ready: %v\n", cs.Ready))
-			sb.WriteString(fmt.Sprintf("- Restart Count: %d\n", cs.RestartCount))
-			if cs.Reason != "" {
-				sb.WriteString(fmt.Sprintf("- Reason: %s\n", cs.Reason))
+	writeSchedulingMatrices(sb, data)
+
+	// Quotas close to their limit, unless auditing everything, and the
+	// limit ranges that set default and maximum container resources
+	var quotas []k8s.ResourceQuotaInfo
+	for _, q := range data.ResourceQuotas {
+		if opts.DetailLevel == DetailAll || q.HasIssues() {
+			quotas = append(quotas, q)
+		}
+	}
+	if len(quotas) > 0 || len(data.LimitRanges) > 0 {
+		sb.WriteString("## Resource Quotas and Limits\n\n")
+	}
+	if len(quotas) > 0 {
+		sb.WriteString("| Quota | Resource | Used | Hard |\n")
+		sb.WriteString("|-------|----------|------|------|\n")
+		for _, q := range quotas {
+			name := k8s.Qualify(q.Namespace, q.Name)
+			if len(q.Scopes) > 0 {
+				name += " (" + strings.Join(q.Scopes, ", ") + ")"
 			}
-			if cs.Message != "" {
-				sb.WriteString(fmt.Sprintf("- Message: %s\n", cs.Message))
+			for _, r := range q.Resources {
+				if opts.DetailLevel != DetailAll && !r.NearlyFull() {
+					continue
+				}
+				sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s (%.0f%%) |\n", name, r.Resource, r.Used, r.Hard, r.Fraction*100))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	for _, lr := range data.LimitRanges {
+		sb.WriteString(fmt.Sprintf("**LimitRange %s:** %s\n", k8s.Qualify(lr.Namespace, lr.Name), strings.Join(lr.Limits, "; ")))
+	}
+	if len(data.LimitRanges) > 0 {
+		sb.WriteString("\n")
+	}
+
+	// Volume claims behind Pending pods and mount failures, unless auditing
+	// everything only those with issues
+	var claims []k8s.VolumeClaimInfo
+	for _, c := range data.VolumeClaims {
+		if opts.DetailLevel == DetailAll || c.HasIssues() {
+			claims = append(claims, c)
+		}
+	}
+	if len(claims) > 0 {
+		sb.WriteString("## Storage\n\n")
+		sb.WriteString("| Claim | Status | Storage Class | Requested | Volume | Used By |\n")
+		sb.WriteString("|-------|--------|---------------|-----------|--------|---------|\n")
+		for _, c := range claims {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+				k8s.Qualify(c.Namespace, c.Name), c.Phase, formatStorageClass(c), c.Requested,
+				formatVolume(c), formatList(c.Pods)))
+		}
+		sb.WriteString("\n")
+		for _, c := range claims {
+			if len(c.Events) == 0 {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("**Claim events %s:**\n", k8s.Qualify(c.Namespace, c.Name)))
+			for _, e := range c.Events {
+				sb.WriteString(fmt.Sprintf("- %s\n", textutil.Truncate(e, 200)))
 			}
 			sb.WriteString("\n")
 		}
+	}
+
+	// Services without ready endpoints and broken Ingresses and routes,
+	// unless auditing everything
+	var services []k8s.ServiceInfo
+	for _, svc := range data.Services {
+		if opts.DetailLevel == DetailAll || svc.HasIssues() {
+			services = append(services, svc)
+		}
+	}
+	var ingresses []k8s.IngressInfo
+	for _, ing := range data.Ingresses {
+		if opts.DetailLevel == DetailAll || ing.HasIssues() {
+			ingresses = append(ingresses, ing)
+		}
+	}
+	var routes []k8s.RouteInfo
+	for _, route := range data.HTTPRoutes {
+		if opts.DetailLevel == DetailAll || route.HasIssues() {
+			routes = append(routes, route)
+		}
+	}
+	if len(services) > 0 || len(ingresses) > 0 || len(routes) > 0 {
+		sb.WriteString("## Networking\n\n")
+	}
+	if len(services) > 0 {
+		sb.WriteString("| Service | Type | Selector | Ports | Ready Endpoints | Not Ready | Matching Pods |\n")
+		sb.WriteString("|---------|------|----------|-------|-----------------|-----------|---------------|\n")
+		for _, svc := range services {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %d | %d | %d |\n",
+				k8s.Qualify(svc.Namespace, svc.Name), svc.Type, svc.Selector, formatList(svc.Ports),
+				svc.ReadyEndpoints, svc.NotReadyEndpoints, svc.MatchingPods))
+		}
+		sb.WriteString("\n")
+	}
+	if len(ingresses) > 0 {
+		sb.WriteString("| Ingress | Class | Rules | TLS Secrets | Address | Problems |\n")
+		sb.WriteString("|---------|-------|-------|-------------|---------|----------|\n")
+		for _, ing := range ingresses {
+			class := ing.Class
+			if class == "" {
+				class = "(default)"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+				k8s.Qualify(ing.Namespace, ing.Name), class, formatIngressRules(ing.Rules),
+				formatList(ing.TLSSecrets), formatList(ing.Addresses), formatList(ing.Problems)))
+		}
+		sb.WriteString("\n")
+	}
+	if len(routes) > 0 {
+		sb.WriteString("| HTTPRoute | Hostnames | Parents | Backends | Conditions | Problems |\n")
+		sb.WriteString("|-----------|-----------|---------|----------|------------|----------|\n")
+		for _, route := range routes {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+				k8s.Qualify(route.Namespace, route.Name), formatList(route.Hostnames), formatList(route.Parents),
+				formatRouteBackends(route.Backends), formatRouteConditions(route.Conditions), formatList(route.Problems)))
+		}
+		sb.WriteString("\n")
+	}
+
+	// NetworkPolicies are only collected when they select the collected
+	// pods, so they can explain timeouts between them
+	if len(data.NetworkPolicies) > 0 {
+		sb.WriteString("## Network Policies\n\n")
+		sb.WriteString("| NetworkPolicy | Pod Selector | Types | Ingress Allowed | Egress Allowed | Selected Pods |\n")
+		sb.WriteString("|---------------|--------------|-------|-----------------|----------------|---------------|\n")
+		for _, np := range data.NetworkPolicies {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+				k8s.Qualify(np.Namespace, np.Name), np.PodSelector, strings.Join(np.PolicyTypes, ", "),
+				formatPolicyRules(np, k8s.PolicyIngress, np.Ingress), formatPolicyRules(np, k8s.PolicyEgress, np.Egress),
+				textutil.Truncate(formatList(np.SelectedPods), 200)))
+		}
+		sb.WriteString("\n")
+	}
+
+	// DNS lookups and connections made from inside the namespace confirm
+	// or rule out network causes
+	if len(data.Connectivity) > 0 {
+		sb.WriteString("## Connectivity Checks\n\n")
+		sb.WriteString("Run from a short-lived probe pod in the namespace; NetworkPolicies selecting all pods of the namespace apply to it.\n\n")
+		sb.WriteString("| Check | Target | Result |\n")
+		sb.WriteString("|-------|--------|--------|\n")
+		for _, c := range data.Connectivity {
+			result := "ok"
+			if !c.OK {
+				result = "FAILED: " + textutil.Truncate(c.Error, 200)
+			} else if len(c.Addresses) > 0 {
+				result = "ok (" + strings.Join(c.Addresses, ", ") + ")"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s |\n", strings.ToUpper(c.Kind), c.Target, result))
+		}
+		sb.WriteString("\n")
+	}
+
+	// Operator-managed custom resources, unless auditing everything only
+	// those with failing conditions
+	var customResources []k8s.CustomResourceInfo
+	for _, r := range data.CustomResources {
+		if opts.DetailLevel == DetailAll || r.HasIssues() {
+			customResources = append(customResources, r)
+		}
+	}
+	if len(customResources) > 0 {
+		sb.WriteString("## Custom Resources\n\n")
+		sb.WriteString("| Resource | Type | Phase | Conditions |\n")
+		sb.WriteString("|----------|------|-------|------------|\n")
+		for _, r := range customResources {
+			phase := r.Phase
+			if phase == "" {
+				phase = "-"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n",
+				k8s.Qualify(r.Namespace, r.Kind+"/"+r.Name), r.Resource, phase,
+				formatCustomResourceConditions(r.Conditions, opts.DetailLevel == DetailAll)))
+		}
+		sb.WriteString("\n")
+	}
+
+	// Container Details
+	if opts.DetailLevel != DetailMinimal {
+		sb.WriteString("## Container Details\n\n")
+	}
+	for _, pod := range data.Pods {
+		if opts.DetailLevel == DetailMinimal || len(pod.ContainerStatuses)+len(pod.InitContainerStatuses) == 0 {
+			continue
+		}
+
+		// Unless auditing everything, only include pods with issues
+		if opts.DetailLevel == DetailIssuesOnly && !hasContainerIssues(pod) && len(pod.Conditions) == 0 && !hasUnmetReadinessGates(pod) {
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf("### Pod: %s\n\n", k8s.Qualify(pod.Namespace, pod.Name)))
+		if pod.Owner != "" {
+			sb.WriteString(fmt.Sprintf("**Owner:** %s\n\n", pod.Owner))
+		}
+		// Init containers run first, so a failing one explains app
+		// containers stuck in PodInitializing
+		for _, cs := range pod.InitContainerStatuses {
+			label := "Init Container"
+			if cs.Sidecar {
+				label = "Sidecar Init Container"
+			}
+			writeContainerDetails(sb, label, cs)
+		}
+		for _, cs := range pod.ContainerStatuses {
+			writeContainerDetails(sb, "Container", cs)
+		}
+		for _, cs := range pod.EphemeralContainerStatuses {
+			writeContainerDetails(sb, "Ephemeral Container", cs)
+		}
 
 		// Add pod conditions if any
 		if len(pod.Conditions) > 0 {
@@ -86,49 +1073,378 @@ func BuildDiagnosticPrompt(data *k8s.DiagnosticData) string {
 			}
 			sb.WriteString("\n")
 		}
+
+		// Readiness gates explain pods that are NotReady with all
+		// containers ready
+		if len(pod.ReadinessGates) > 0 {
+			sb.WriteString("**Readiness Gates:**\n")
+			for _, gate := range pod.ReadinessGates {
+				sb.WriteString(fmt.Sprintf("- %s: %s", gate.ConditionType, formatGateStatus(gate)))
+				if gate.Reason != "" {
+					sb.WriteString(fmt.Sprintf(" (Reason: %s)", gate.Reason))
+				}
+				if gate.Message != "" {
+					sb.WriteString(fmt.Sprintf(" - %s", gate.Message))
+				}
+				sb.WriteString("\n")
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	if opts.DetailLevel != DetailMinimal {
+		writePodSpecs(sb, data)
 	}
+	writeIdentities(sb, data)
 
 	// Recent Events
-	sb.WriteString("## Recent Events (Last Hour)\n\n")
+	window := eventWindow(data.EventsSince)
+	sb.WriteString(fmt.Sprintf("## Recent Events (Last %s)\n\n", window))
 	if len(data.Events) == 0 {
-		sb.WriteString("No warning or error events in the last hour.\n\n")
+		sb.WriteString(fmt.Sprintf("No warning or error events in the last %s.\n\n", strings.ToLower(window)))
 	} else {
 		sb.WriteString("| Type | Reason | Object | Count | Message |\n")
 		sb.WriteString("|------|--------|--------|-------|----------|\n")
 		for _, event := range data.Events {
-			// Truncate long messages
-			msg := event.Message
-			if len(msg) > 80 {
-				msg = msg[:77] + "..."
-			}
 			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %d | %s |\n",
-				event.Type, event.Reason, event.InvolvedObject, event.Count, msg))
+				event.Type, event.Reason, k8s.Qualify(event.Namespace, event.InvolvedObject), event.Count, textutil.Truncate(event.Message, 80)))
 		}
 		sb.WriteString("\n")
 	}
 
-	// Request analysis
-	sb.WriteString("## Analysis Request\n\n")
-	sb.WriteString("Please analyze the above diagnostic data and provide:\n\n")
-	sb.WriteString("1. **Summary of Issues**: Identify the main problems affecting this namespace\n")
-	sb.WriteString("2. **Root Cause Analysis**: Explain the likely root causes\n")
-	sb.WriteString("3. **Remediation Steps**: Provide specific, actionable steps to resolve the issues\n")
-	sb.WriteString("4. **kubectl Commands**: Include relevant kubectl commands that might help\n")
-	sb.WriteString("5. **Prevention**: Suggest how to prevent similar issues in the future\n\n")
-	sb.WriteString("Focus on the most critical issues first.\n")
-
-	return sb.String()
+	// Container logs
+	if len(data.Logs) > 0 {
+		sb.WriteString("## Container Logs\n\n")
+		for _, l := range data.Logs {
+			title := fmt.Sprintf("%s/%s", k8s.Qualify(l.Namespace, l.Pod), l.Container)
+			if l.Previous {
+				title += " (previous instance)"
+			}
+			sb.WriteString(fmt.Sprintf("### %s\n\n", title))
+			if !l.CrashedAt.IsZero() {
+				sb.WriteString(fmt.Sprintf("Terminated at %s; showing lines leading up to it.\n", l.CrashedAt.Format(time.RFC3339)))
+			}
+			if l.Omitted > 0 {
+				sb.WriteString(fmt.Sprintf("%d less relevant lines omitted.\n", l.Omitted))
+			}
+			if l.Note != "" {
+				sb.WriteString(fmt.Sprintf("_%s_\n\n", l.Note))
+			}
+			if len(l.Lines) > 0 {
+				sb.WriteString("```\n")
+				sb.WriteString(strings.Join(l.Lines, "\n"))
+				sb.WriteString("\n```\n\n")
+			}
+		}
+	}
 }
 
-// formatDuration converts a duration to a human-readable string
-func formatDuration(d time.Duration) string {
-	if d < time.Minute {
-		return fmt.Sprintf("%ds", int(d.Seconds()))
-	} else if d < time.Hour {
-		return fmt.Sprintf("%dm", int(d.Minutes()))
-	} else if d < 24*time.Hour {
-		return fmt.Sprintf("%dh", int(d.Hours()))
+// writeCompactSections writes the compact prompt lines for the data of a
+// single cluster
+func writeCompactSections(sb *strings.Builder, data *k8s.DiagnosticData) {
+	for _, w := range data.Warnings {
+		sb.WriteString(fmt.Sprintf("WARN %s\n", textutil.Truncate(w, 160)))
+	}
+	for _, o := range data.Omitted {
+		sb.WriteString(fmt.Sprintf("OMIT %s\n", textutil.Truncate(o, 160)))
+	}
+	for _, ns := range data.Namespaces {
+		if !ns.HasIssues() {
+			continue
+		}
+		if ns.Skipped != "" {
+			sb.WriteString(fmt.Sprintf("NS %s skipped\n", ns.Name))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("NS %s pods=%d bad=%d find=%d", ns.Name, ns.Pods, ns.Unhealthy, ns.Findings))
+		if ns.Severity != "" {
+			sb.WriteString(" sev=" + string(ns.Severity))
+		}
+		sb.WriteString("\n")
+	}
+	for _, f := range data.Findings {
+		sb.WriteString(fmt.Sprintf("FIND %s %s %s: %s\n", f.Severity, f.Rule, k8s.Qualify(f.Namespace, f.Object), textutil.Truncate(f.Message, 120)))
+	}
+
+	var unhealthy []k8s.PodInfo
+	for _, pod := range data.Pods {
+		if isPodUnhealthy(pod) {
+			unhealthy = append(unhealthy, pod)
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("PODS total=%d bad=%d\n", len(data.Pods), len(unhealthy)))
+	for _, pod := range unhealthy {
+		sb.WriteString(fmt.Sprintf("%s %s r=%s rs=%d", k8s.Qualify(pod.Namespace, pod.Name), pod.Phase, pod.Ready, pod.Restarts))
+		if status := pod.InitStatus(); status != "" {
+			sb.WriteString(" " + status)
+		}
+		if top, ok := pod.DominantRestarter(); ok {
+			sb.WriteString(fmt.Sprintf("(mostly %s)", top.Name))
+		}
+		sb.WriteString(fmt.Sprintf(" age=%s\n", formatDuration(pod.Age)))
+		for _, cs := range pod.InitContainerStatuses {
+			if cs.InitDone() && cs.RestartCount == 0 {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf(" ic=%s %s", cs.Name, cs.State))
+			if cs.Reason != "" {
+				sb.WriteString("/" + cs.Reason)
+			}
+			sb.WriteString(fmt.Sprintf(" rs=%d img=%s", cs.RestartCount, cs.Image))
+			if t := cs.Termination; t != nil {
+				sb.WriteString(fmt.Sprintf(" exit=%d", t.ExitCode))
+			} else if t := cs.LastTermination; t != nil {
+				sb.WriteString(fmt.Sprintf(" lastexit=%d", t.ExitCode))
+			}
+			if cs.Message != "" {
+				sb.WriteString(" msg=" + textutil.Truncate(cs.Message, 120))
+			}
+			sb.WriteString("\n")
+			writeCompactImagePull(sb, cs)
+			writeCompactProbes(sb, cs)
+		}
+		for _, cs := range pod.ContainerStatuses {
+			if cs.Ready && cs.State == "Running" && cs.RestartCount == 0 {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf(" c=%s %s", cs.Name, cs.State))
+			if cs.Reason != "" {
+				sb.WriteString("/" + cs.Reason)
+			}
+			sb.WriteString(fmt.Sprintf(" rs=%d img=%s", cs.RestartCount, cs.Image))
+			if t := cs.MemoryKill(); t != nil {
+				sb.WriteString(fmt.Sprintf(" killed=%s/%d", t.Reason, t.ExitCode))
+				if !t.FinishedAt.IsZero() {
+					sb.WriteString("@" + t.FinishedAt.Format(time.RFC3339))
+				}
+			}
+			if r := cs.Resources; r != nil && cs.Usage == nil {
+				// Request and limit of containers killed for memory
+				sb.WriteString(fmt.Sprintf(" res=mem:%s/%s", formatLimit(k8s.FormatMemory, r.MemoryRequest), formatLimit(k8s.FormatMemory, r.MemoryLimit)))
+			}
+			if u := cs.Usage; u != nil {
+				sb.WriteString(fmt.Sprintf(" use=cpu:%s/%s mem:%s/%s", k8s.FormatCPU(u.CPU), formatLimit(k8s.FormatCPU, u.CPULimit),
+					k8s.FormatMemory(u.Memory), formatLimit(k8s.FormatMemory, u.MemoryLimit)))
+			}
+			if cs.Message != "" {
+				sb.WriteString(" msg=" + textutil.Truncate(cs.Message, 120))
+			}
+			sb.WriteString("\n")
+			writeCompactImagePull(sb, cs)
+			writeCompactProbes(sb, cs)
+		}
+		for _, cond := range pod.Conditions {
+			sb.WriteString(fmt.Sprintf(" cond=%s:%s", cond.Type, cond.Status))
+			if cond.Reason != "" {
+				sb.WriteString(" " + cond.Reason)
+			}
+			if cond.Message != "" {
+				sb.WriteString(" msg=" + textutil.Truncate(cond.Message, 120))
+			}
+			sb.WriteString("\n")
+		}
+		for _, gate := range pod.ReadinessGates {
+			if gate.Met() {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf(" gate=%s:%s", gate.ConditionType, formatGateStatus(gate)))
+			if gate.Reason != "" {
+				sb.WriteString(" " + gate.Reason)
+			}
+			if gate.Message != "" {
+				sb.WriteString(" msg=" + textutil.Truncate(gate.Message, 120))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	writeCompactPodSpecs(sb, data)
+
+	var badControllers []k8s.ControllerStatus
+	for _, c := range data.Controllers {
+		if c.HasIssues() {
+			badControllers = append(badControllers, c)
+		}
+	}
+	if len(badControllers) > 0 {
+		sb.WriteString(fmt.Sprintf("CTRL total=%d bad=%d\n", len(data.Controllers), len(badControllers)))
+		for _, c := range badControllers {
+			sb.WriteString(fmt.Sprintf("%s want=%d r=%d", k8s.Qualify(c.Namespace, c.Kind+"/"+c.Name), c.Desired, c.Ready))
+			if c.Kind != "ReplicaSet" {
+				sb.WriteString(fmt.Sprintf(" upd=%d", c.Updated))
+			}
+			sb.WriteString(fmt.Sprintf(" %s\n", textutil.Truncate(formatControllerStatus(c), 160)))
+		}
+	}
+
+	for _, r := range data.HelmReleases {
+		if !r.HasIssues() && !releaseHasIssues(r, data.Controllers) {
+			continue
+		}
+		current := r.Current()
+		sb.WriteString(fmt.Sprintf("HELM %s rev=%d %s chart=%s upd=%s", k8s.Qualify(r.Namespace, r.Name),
+			current.Revision, current.Status, current.Chart, formatHelmUpdated(current, data.CollectedAt)))
+		if target, ok := r.RollbackTarget(); ok {
+			sb.WriteString(fmt.Sprintf(" good=%d:%s", target.Revision, target.Chart))
+		}
+		sb.WriteString("\n")
+	}
+
+	for _, r := range data.CustomResources {
+		if !r.HasIssues() {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("CR %s", k8s.Qualify(r.Namespace, r.Kind+"/"+r.Name)))
+		if r.Phase != "" {
+			sb.WriteString(" phase=" + r.Phase)
+		}
+		sb.WriteString(fmt.Sprintf(" %s\n", textutil.Truncate(formatCustomResourceConditions(r.Conditions, false), 160)))
+	}
+
+	var badNodes []k8s.NodeInfo
+	for _, n := range data.Nodes {
+		if n.HasIssues() {
+			badNodes = append(badNodes, n)
+		}
+	}
+	if len(badNodes) > 0 {
+		sb.WriteString(fmt.Sprintf("NODES total=%d bad=%d\n", len(data.Nodes), len(badNodes)))
+		for _, n := range badNodes {
+			sb.WriteString(fmt.Sprintf("%s ready=%s cpu=%s/%s mem=%s/%s", n.Name, n.Ready,
+				k8s.FormatCPU(n.RequestedCPU), k8s.FormatCPU(n.AllocatableCPU),
+				k8s.FormatMemory(n.RequestedMemory), k8s.FormatMemory(n.AllocatableMemory)))
+			if n.UsedCPU > 0 || n.UsedMemory > 0 {
+				sb.WriteString(fmt.Sprintf(" use=cpu:%s mem:%s", k8s.FormatCPU(n.UsedCPU), k8s.FormatMemory(n.UsedMemory)))
+			}
+			sb.WriteString(" " + textutil.Truncate(formatNodeStatus(n), 160) + "\n")
+		}
+	}
+
+	writeCompactSchedulingMatrices(sb, data)
+	writeCompactIdentities(sb, data)
+
+	for _, q := range data.ResourceQuotas {
+		var full []string
+		for _, r := range q.Resources {
+			if r.NearlyFull() {
+				full = append(full, fmt.Sprintf("%s=%s/%s", r.Resource, r.Used, r.Hard))
+			}
+		}
+		if len(full) > 0 {
+			sb.WriteString(fmt.Sprintf("QUOTA %s %s\n", k8s.Qualify(q.Namespace, q.Name), strings.Join(full, " ")))
+		}
+	}
+	for _, lr := range data.LimitRanges {
+		sb.WriteString(fmt.Sprintf("LIMITS %s %s\n", k8s.Qualify(lr.Namespace, lr.Name), textutil.Truncate(strings.Join(lr.Limits, "; "), 160)))
+	}
+
+	var badClaims []k8s.VolumeClaimInfo
+	for _, c := range data.VolumeClaims {
+		if c.HasIssues() {
+			badClaims = append(badClaims, c)
+		}
+	}
+	if len(badClaims) > 0 {
+		sb.WriteString(fmt.Sprintf("PVC total=%d bad=%d\n", len(data.VolumeClaims), len(badClaims)))
+		for _, c := range badClaims {
+			sb.WriteString(fmt.Sprintf("%s %s sc=%s req=%s vol=%s", k8s.Qualify(c.Namespace, c.Name), c.Phase,
+				formatStorageClass(c), c.Requested, formatVolume(c)))
+			if len(c.Events) > 0 {
+				sb.WriteString(" ev=" + textutil.Truncate(c.Events[len(c.Events)-1], 120))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	var badServices []k8s.ServiceInfo
+	for _, svc := range data.Services {
+		if svc.HasIssues() {
+			badServices = append(badServices, svc)
+		}
+	}
+	if len(badServices) > 0 {
+		sb.WriteString(fmt.Sprintf("SVC total=%d bad=%d\n", len(data.Services), len(badServices)))
+		for _, svc := range badServices {
+			sb.WriteString(fmt.Sprintf("%s sel=%s ep=%d/%d pods=%d\n", k8s.Qualify(svc.Namespace, svc.Name), svc.Selector,
+				svc.ReadyEndpoints, svc.ReadyEndpoints+svc.NotReadyEndpoints, svc.MatchingPods))
+		}
+	}
+
+	if len(data.NetworkPolicies) > 0 {
+		sb.WriteString(fmt.Sprintf("NETPOL total=%d\n", len(data.NetworkPolicies)))
+		for _, np := range data.NetworkPolicies {
+			sb.WriteString(fmt.Sprintf("%s sel=%s pods=%d", k8s.Qualify(np.Namespace, np.Name), np.PodSelector, len(np.SelectedPods)))
+			if np.Isolates(k8s.PolicyIngress) {
+				sb.WriteString(" in=" + textutil.Truncate(formatPolicyRules(np, k8s.PolicyIngress, np.Ingress), 120))
+			}
+			if np.Isolates(k8s.PolicyEgress) {
+				sb.WriteString(" eg=" + textutil.Truncate(formatPolicyRules(np, k8s.PolicyEgress, np.Egress), 120))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	var failedChecks []k8s.ConnectivityCheck
+	for _, c := range data.Connectivity {
+		if !c.OK {
+			failedChecks = append(failedChecks, c)
+		}
+	}
+	if len(data.Connectivity) > 0 {
+		sb.WriteString(fmt.Sprintf("NET checks=%d failed=%d\n", len(data.Connectivity), len(failedChecks)))
+		for _, c := range failedChecks {
+			sb.WriteString(fmt.Sprintf("%s %s err=%s\n", c.Kind, c.Target, textutil.Truncate(c.Error, 120)))
+		}
+	}
+
+	var badIngresses []k8s.IngressInfo
+	for _, ing := range data.Ingresses {
+		if ing.HasIssues() {
+			badIngresses = append(badIngresses, ing)
+		}
+	}
+	if len(badIngresses) > 0 {
+		sb.WriteString(fmt.Sprintf("ING total=%d bad=%d\n", len(data.Ingresses), len(badIngresses)))
+		for _, ing := range badIngresses {
+			sb.WriteString(fmt.Sprintf("%s %s\n", k8s.Qualify(ing.Namespace, ing.Name), textutil.Truncate(strings.Join(ing.Problems, "; "), 160)))
+		}
+	}
+
+	var badRoutes []k8s.RouteInfo
+	for _, route := range data.HTTPRoutes {
+		if route.HasIssues() {
+			badRoutes = append(badRoutes, route)
+		}
+	}
+	if len(badRoutes) > 0 {
+		sb.WriteString(fmt.Sprintf("ROUTE total=%d bad=%d\n", len(data.HTTPRoutes), len(badRoutes)))
+		for _, route := range badRoutes {
+			sb.WriteString(fmt.Sprintf("%s %s\n", k8s.Qualify(route.Namespace, route.Name), textutil.Truncate(strings.Join(route.Problems, "; "), 160)))
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("EVENTS n=%d\n", len(data.Events)))
+	for _, event := range data.Events {
+		sb.WriteString(fmt.Sprintf("%s %s %s x%d: %s\n",
+			textutil.Truncate(event.Type, 1), event.Reason, k8s.Qualify(event.Namespace, event.InvolvedObject), event.Count, textutil.Truncate(event.Message, 100)))
+	}
+
+	for _, l := range data.Logs {
+		if len(l.Lines) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("LOG %s/%s", k8s.Qualify(l.Namespace, l.Pod), l.Container))
+		if l.Previous {
+			sb.WriteString(" prev")
+		}
+		sb.WriteString("\n")
+		lines := l.Lines
+		if len(lines) > compactLogLines {
+			lines = lines[len(lines)-compactLogLines:]
+		}
+		for _, line := range lines {
+			sb.WriteString(textutil.Truncate(line, 160) + "\n")
+		}
 	}
-	days := int(d.Hours() / 24)
-	return fmt.Sprintf("%dd", days)
 }
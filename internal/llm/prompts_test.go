@@ -0,0 +1,95 @@
+package llm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"kubehelp/internal/k8s"
+)
+
+// namespaceFixture is a namespace with 23 pods, 3 of them crash-looping,
+// and 8 warning events, the example measured in the README
+func namespaceFixture() *k8s.DiagnosticData {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	data := &k8s.DiagnosticData{
+		Namespace:   "shop",
+		ContextName: "prod",
+		CollectedAt: now,
+	}
+	for i := 0; i < 20; i++ {
+		data.Pods = append(data.Pods, k8s.PodInfo{
+			Name:     fmt.Sprintf("web-7d8f9b-%05d", i),
+			Owner:    "Deployment/web",
+			Phase:    "Running",
+			Ready:    "1/1",
+			Age:      72 * time.Hour,
+			NodeName: fmt.Sprintf("node-%d", i%4),
+			ContainerStatuses: []k8s.ContainerStatus{{
+				Name: "web", Ready: true, State: "Running", Image: "registry.example.com/shop/web:1.42.0",
+			}},
+		})
+	}
+	for i := 0; i < 3; i++ {
+		pod := fmt.Sprintf("checkout-5c6d7e-%05d", i)
+		data.Pods = append(data.Pods, k8s.PodInfo{
+			Name:     pod,
+			Owner:    "Deployment/checkout",
+			Phase:    "Running",
+			Ready:    "0/1",
+			Restarts: 14,
+			Age:      2 * time.Hour,
+			NodeName: fmt.Sprintf("node-%d", i),
+			ContainerStatuses: []k8s.ContainerStatus{{
+				Name:         "checkout",
+				State:        "Waiting",
+				Reason:       "CrashLoopBackOff",
+				Message:      "back-off 5m0s restarting failed container=checkout",
+				Image:        "registry.example.com/shop/checkout:2.3.1",
+				RestartCount: 14,
+				LastTermination: &k8s.TerminationInfo{
+					Reason: "Error", ExitCode: 1,
+					StartedAt: now.Add(-6 * time.Minute), FinishedAt: now.Add(-5 * time.Minute),
+				},
+			}},
+		})
+		data.Logs = append(data.Logs, k8s.ContainerLog{
+			Pod: pod, Container: "checkout", Previous: true, CrashedAt: now.Add(-5 * time.Minute),
+			Lines: []string{
+				"2024-05-01T09:54:58Z INFO starting checkout service version=2.3.1",
+				"2024-05-01T09:54:59Z INFO connecting to postgres host=orders-db port=5432",
+				"2024-05-01T09:55:00Z ERROR failed to connect to database: dial tcp 10.0.12.7:5432: connect: connection refused",
+				"2024-05-01T09:55:00Z FATAL cannot start without a database connection",
+			},
+		})
+		data.Events = append(data.Events,
+			k8s.EventInfo{Type: "Warning", Reason: "BackOff", Message: "Back-off restarting failed container checkout in pod " + pod,
+				InvolvedObject: "Pod/" + pod, Count: 42, LastTimestamp: now.Add(-time.Minute)},
+			k8s.EventInfo{Type: "Warning", Reason: "Unhealthy", Message: "Readiness probe failed: Get \"http://10.0.3.4:8080/healthz\": dial tcp 10.0.3.4:8080: connect: connection refused",
+				InvolvedObject: "Pod/" + pod, Count: 9, LastTimestamp: now.Add(-2 * time.Minute)},
+		)
+	}
+	data.Events = append(data.Events,
+		k8s.EventInfo{Type: "Warning", Reason: "FailedGetScale", Message: "deployments/scale.apps \"checkout\" not found",
+			InvolvedObject: "HorizontalPodAutoscaler/checkout", Count: 3, LastTimestamp: now.Add(-10 * time.Minute)},
+		k8s.EventInfo{Type: "Warning", Reason: "FailedMount", Message: "MountVolume.SetUp failed for volume \"tls\" : secret \"checkout-tls\" not found",
+			InvolvedObject: "Pod/checkout-5c6d7e-00000", Count: 2, LastTimestamp: now.Add(-30 * time.Minute)},
+	)
+	data.Findings = []k8s.Finding{
+		{Rule: "crash-loop", Severity: k8s.SeverityHigh, Object: "Deployment/checkout", Message: "3 of 3 pods are in CrashLoopBackOff with exit code 1"},
+		{Rule: "missing-limits", Severity: k8s.SeverityLow, Object: "Deployment/web", Message: "container web has no memory limit"},
+	}
+	return data
+}
+
+// TestCompactPromptIsSmaller keeps the README comparison of prompt modes
+// honest: run with -v to see the estimates it documents
+func TestCompactPromptIsSmaller(t *testing.T) {
+	data := namespaceFixture()
+	verbose := EstimateTokens(BuildDiagnosticPrompt(data))
+	compact := EstimateTokens(BuildCompactPrompt(data))
+	t.Logf("estimated tokens: verbose %d, compact %d", verbose, compact)
+	if compact >= verbose {
+		t.Errorf("compact prompt estimated at %d tokens, not smaller than the verbose %d", compact, verbose)
+	}
+}
@@ -8,14 +8,29 @@ import (
 type Provider interface {
 	// Analyze sends diagnostic data to the LLM and returns insights
 	Analyze(ctx context.Context, prompt string) (string, error)
+	// AnalyzeStream is like Analyze but delivers the response on chunks as
+	// it is generated. chunks is closed when it returns.
+	AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error
+	// Chat sends a conversation, oldest message first, and returns the
+	// assistant's reply. The system prompt is applied as for Analyze.
+	Chat(ctx context.Context, messages []Message) (string, error)
 	// Name returns the provider name
 	Name() string
 }
 
-// Config holds LLM provider configuration
-type Config struct {
-	Provider string
-	APIKey   string
-	Model    string
-	BaseURL  string
+// Message roles
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation
+type Message struct {
+	Role    string `json:"role"` // RoleUser or RoleAssistant
+	Content string `json:"content"`
+}
+
+// userMessage wraps a single prompt as a conversation
+func userMessage(prompt string) []Message {
+	return []Message{{Role: RoleUser, Content: prompt}}
 }
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Factory builds the providers of one kind. Providers register a Factory
+// under their name with Register, usually from an init function, so forks
+// and plugins can add providers without touching the commands.
+type Factory struct {
+	// New creates a provider for model, reading credentials and endpoints
+	// from the environment. It fails when they are missing.
+	New ModelFactory
+	// DefaultModel returns the model used without an override, typically
+	// from an environment variable
+	DefaultModel func() string
+	// Description is shown by "kubehelp providers list", e.g. "OpenAI
+	// chat completions (OPENAI_API_KEY)"
+	Description string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a provider available under name, e.g. for --llm name. It
+// panics when name is empty, already registered or factory.New is nil.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || factory.New == nil {
+		panic("llm: Register of provider " + name + " without a name or factory")
+	}
+	if _, dup := registry[name]; dup {
+		panic("llm: Register called twice for provider " + name)
+	}
+	registry[name] = factory
+}
+
+// Lookup returns the factory registered under name
+func Lookup(name string) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	factory, ok := registry[name]
+	return factory, ok
+}
+
+// Providers lists the registered provider names, sorted
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultModel returns the model the named provider uses without an
+// override, or "" when it is not registered or has no default
+func DefaultModel(name string) string {
+	factory, ok := Lookup(name)
+	if !ok || factory.DefaultModel == nil {
+		return ""
+	}
+	return factory.DefaultModel()
+}
+
+// APIKey returns KUBEHELP_API_KEY, else the provider-specific variable
+// envVar, e.g. OPENAI_API_KEY
+func APIKey(envVar string) (string, error) {
+	if key := os.Getenv("KUBEHELP_API_KEY"); key != "" {
+		return key, nil
+	}
+	if key := os.Getenv(envVar); key != "" {
+		return key, nil
+	}
+	return "", fmt.Errorf("API key not found. Set KUBEHELP_API_KEY or %s environment variable", envVar)
+}
+
+// envOr returns the named environment variable, or fallback when it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
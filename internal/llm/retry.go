@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Retry defaults, overridable via KUBEHELP_LLM_MAX_RETRIES,
+// KUBEHELP_LLM_RETRY_DELAY and KUBEHELP_LLM_RETRY_MAX_DELAY
+const (
+	DefaultMaxRetries    = 3
+	DefaultRetryDelay    = time.Second
+	DefaultRetryMaxDelay = 30 * time.Second
+)
+
+// RetryPolicy controls how transient LLM API failures are retried
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt; 0
+	// disables retries
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry, doubled for each
+	// further retry up to MaxDelay; each wait is jittered
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// RetryPolicyFromEnv reads KUBEHELP_LLM_MAX_RETRIES (default 3),
+// KUBEHELP_LLM_RETRY_DELAY (default 1s) and KUBEHELP_LLM_RETRY_MAX_DELAY
+// (default 30s)
+func RetryPolicyFromEnv() RetryPolicy {
+	policy := RetryPolicy{
+		MaxRetries: DefaultMaxRetries,
+		BaseDelay:  DefaultRetryDelay,
+		MaxDelay:   DefaultRetryMaxDelay,
+	}
+	if n, err := strconv.Atoi(os.Getenv("KUBEHELP_LLM_MAX_RETRIES")); err == nil && n >= 0 {
+		policy.MaxRetries = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("KUBEHELP_LLM_RETRY_DELAY")); err == nil && d > 0 {
+		policy.BaseDelay = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("KUBEHELP_LLM_RETRY_MAX_DELAY")); err == nil && d > 0 {
+		policy.MaxDelay = d
+	}
+	if policy.MaxDelay < policy.BaseDelay {
+		policy.MaxDelay = policy.BaseDelay
+	}
+	return policy
+}
+
+// backoff returns the wait before the given retry (1 for the first): an
+// exponential backoff, randomized over its upper half so clients rate
+// limited together do not retry together
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	limit := p.MaxDelay
+	if shift := retry - 1; shift < 30 {
+		if d := p.BaseDelay << shift; d > 0 && d < limit {
+			limit = d
+		}
+	}
+	return limit/2 + rand.N(limit/2+1)
+}
+
+// retryClient sends LLM API requests, retrying connection failures and
+// transient statuses (429, 500, 502, 503, 504) per RetryPolicyFromEnv. It is
+// shared by the HTTP providers, so a rate-limited or briefly unavailable
+// API does not fail a whole diagnosis.
+type retryClient struct {
+	client *http.Client
+}
+
+// newRetryClient wraps client; the policy is read from the environment on
+// each request, so it follows settings applied after startup
+func newRetryClient(client *http.Client) *retryClient {
+	return &retryClient{client: client}
+}
+
+// Do sends req like http.Client.Do, retrying transient failures. A
+// Retry-After header on a 429 or 503 response sets the wait instead of the
+// backoff; one longer than the policy's MaxDelay is not waited for and the
+// response is returned. Request bodies are replayed through req.GetBody,
+// which http.NewRequest sets for in-memory bodies. Streaming responses are
+// only retried before their body is read, so no output is repeated.
+func (c *retryClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	policy := RetryPolicyFromEnv()
+	for retry := 0; ; retry++ {
+		attempt := req
+		if retry > 0 {
+			if req.Body != nil && req.GetBody == nil {
+				return nil, fmt.Errorf("cannot retry request to %s: body cannot be replayed", req.URL.Host)
+			}
+			attempt = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attempt.Body = body
+			}
+		}
+
+		resp, err := c.client.Do(attempt)
+		if retry >= policy.MaxRetries || !retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		wait := policy.backoff(retry + 1)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				if after > policy.MaxDelay {
+					return resp, err
+				}
+				wait = after
+			}
+			// Drain a little so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			log.Printf("⚠️  %s returned %s, retrying in %s (%d/%d)", req.URL.Host, resp.Status, wait.Round(time.Millisecond), retry+1, policy.MaxRetries)
+		} else {
+			log.Printf("⚠️  Request to %s failed: %v; retrying in %s (%d/%d)", req.URL.Host, err, wait.Round(time.Millisecond), retry+1, policy.MaxRetries)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether an attempt failed transiently: a connection
+// error or timeout of the attempt itself, or a rate limit or server error
+// status. Cancellation of the request's context is not retried.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, context.Canceled)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header of a 429 or 503 response, given
+// in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
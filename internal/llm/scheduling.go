@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/textutil"
+)
+
+// schedulingColumns are the column headers of the scheduling checks
+var schedulingColumns = map[string]string{
+	"ready":    "Ready",
+	"taints":   "Taints",
+	"selector": "Node Selector",
+	"affinity": "Node Affinity",
+	"cpu":      "CPU",
+	"memory":   "Memory",
+	"pods":     "Pod Count",
+	"extended": "Extended Resources",
+}
+
+// blockingChecks returns the checks failed by at least one node, in
+// k8s.SchedulingChecks order
+func blockingChecks(m k8s.SchedulingMatrix) []string {
+	var checks []string
+	for _, check := range k8s.SchedulingChecks {
+		if m.Blockers[check] > 0 {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// formatBlockers renders how many nodes each check rules out, e.g.
+// "taints 3, cpu 2"
+func formatBlockers(m k8s.SchedulingMatrix) string {
+	var parts []string
+	for _, check := range blockingChecks(m) {
+		parts = append(parts, fmt.Sprintf("%s %d", check, m.Blockers[check]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// writeSchedulingMatrices renders the "Scheduling Matrix" section: for each
+// Pending workload, a table of the nodes against the checks that rule any
+// of them out
+func writeSchedulingMatrices(sb *strings.Builder, data *k8s.DiagnosticData) {
+	if len(data.Scheduling) == 0 {
+		return
+	}
+	sb.WriteString("## Scheduling Matrix\n\n")
+	sb.WriteString("Pending pods checked against every node; ✗ marks what rules a node out. Pod affinity, topology spread and volume zones are not checked.\n\n")
+	for _, m := range data.Scheduling {
+		title := k8s.Qualify(m.Namespace, m.Pod)
+		if m.Owner != "" {
+			title += fmt.Sprintf(" (%s, %d pending)", m.Owner, m.Pending)
+		}
+		sb.WriteString(fmt.Sprintf("### %s\n\n", title))
+		if m.Reason != "" {
+			sb.WriteString(fmt.Sprintf("- **Scheduler:** %s\n", m.Reason))
+		}
+		sb.WriteString(fmt.Sprintf("- **Requests:** cpu=%s memory=%s\n", k8s.FormatCPU(m.CPURequest), k8s.FormatMemory(m.MemoryRequest)))
+		if len(m.NodeSelector) > 0 {
+			sb.WriteString(fmt.Sprintf("- **Node Selector:** %s\n", strings.Join(m.NodeSelector, ", ")))
+		}
+		if len(m.Affinity) > 0 {
+			sb.WriteString(fmt.Sprintf("- **Required Node Affinity:** %s\n", strings.Join(m.Affinity, " OR ")))
+		}
+		if len(m.Tolerations) > 0 {
+			sb.WriteString(fmt.Sprintf("- **Tolerations:** %s\n", strings.Join(m.Tolerations, ", ")))
+		}
+		sb.WriteString(fmt.Sprintf("- **Nodes Fitting:** %d of %d", m.Fitting, m.TotalNodes))
+		if blockers := formatBlockers(m); blockers != "" {
+			sb.WriteString(" (ruled out by " + blockers + ")")
+		}
+		sb.WriteString("\n\n")
+
+		checks := blockingChecks(m)
+		if len(checks) == 0 || len(m.Nodes) == 0 {
+			continue
+		}
+		sb.WriteString("| Node |")
+		separator := "|------|"
+		for _, check := range checks {
+			sb.WriteString(" " + schedulingColumns[check] + " |")
+			separator += strings.Repeat("-", len(schedulingColumns[check])+2) + "|"
+		}
+		sb.WriteString("\n" + separator + "\n")
+		for _, fit := range m.Nodes {
+			sb.WriteString("| " + fit.Node + " |")
+			for _, check := range checks {
+				cell := "✓"
+				if why, failed := fit.Failed[check]; failed {
+					cell = "✗ " + why
+				}
+				sb.WriteString(" " + cell + " |")
+			}
+			sb.WriteString("\n")
+		}
+		if m.OmittedNodes > 0 {
+			sb.WriteString(fmt.Sprintf("\n%d more nodes, further from fitting, are counted above but not listed.\n", m.OmittedNodes))
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// writeCompactSchedulingMatrices renders scheduling matrices in the terse
+// form of BuildCompactPrompt: a SCHED line per Pending workload and the
+// nodes closest to fitting
+func writeCompactSchedulingMatrices(sb *strings.Builder, data *k8s.DiagnosticData) {
+	for _, m := range data.Scheduling {
+		sb.WriteString(fmt.Sprintf("SCHED %s pending=%d req=cpu:%s,mem:%s fit=%d/%d", k8s.Qualify(m.Namespace, m.Pod), m.Pending,
+			k8s.FormatCPU(m.CPURequest), k8s.FormatMemory(m.MemoryRequest), m.Fitting, m.TotalNodes))
+		for _, check := range blockingChecks(m) {
+			sb.WriteString(fmt.Sprintf(" %s=%d", check, m.Blockers[check]))
+		}
+		sb.WriteString("\n")
+		for i, fit := range m.Nodes {
+			if i == 5 || len(fit.Failed) == 0 {
+				break
+			}
+			var failed []string
+			for _, check := range k8s.SchedulingChecks {
+				if why, ok := fit.Failed[check]; ok {
+					failed = append(failed, check+"="+why)
+				}
+			}
+			sb.WriteString(fmt.Sprintf(" n=%s %s\n", fit.Node, textutil.Truncate(strings.Join(failed, ";"), 160)))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// streamClient sends streaming requests. It has no overall timeout, since a
+// long analysis may legitimately stream for minutes; the request context
+// bounds it instead. Failures are retried until the response arrives.
+var streamClient = newRetryClient(&http.Client{})
+
+// StreamAnalysis runs provider.AnalyzeStream, calling onChunk for each chunk
+// as it arrives, and returns the complete analysis
+func StreamAnalysis(ctx context.Context, provider Provider, prompt string, onChunk func(string)) (string, error) {
+	chunks := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- provider.AnalyzeStream(ctx, prompt, chunks)
+	}()
+
+	var sb strings.Builder
+	for chunk := range chunks {
+		sb.WriteString(chunk)
+		if onChunk != nil {
+			onChunk(chunk)
+		}
+	}
+	if err := <-errc; err != nil {
+		return "", err
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("no response from %s", provider.Name())
+	}
+	return sb.String(), nil
+}
+
+// sendChunk delivers text on chunks unless ctx is done first, so a provider
+// never blocks on a reader that went away
+func sendChunk(ctx context.Context, chunks chan<- string, text string) error {
+	select {
+	case chunks <- text:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readSSE calls fn with the data of each Server-Sent Event in body
+func readSSE(body io.Reader, fn func(data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
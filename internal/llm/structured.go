@@ -0,0 +1,218 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"kubehelp/internal/k8s"
+)
+
+// StructuredAnalysis is the machine-readable form of an analysis, requested
+// with AnalyzeStructured
+type StructuredAnalysis struct {
+	Summary string  `json:"summary"`
+	Issues  []Issue `json:"issues"`
+}
+
+// Issue is one problem found by the LLM, with its cause and fix
+type Issue struct {
+	Title    string       `json:"title"`
+	Severity k8s.Severity `json:"severity"`
+	// Resource is the affected object, e.g. "Deployment/api"
+	Resource        string     `json:"resource,omitempty"`
+	RootCause       string     `json:"rootCause"`
+	Remediation     stringList `json:"remediation"`
+	KubectlCommands stringList `json:"kubectlCommands,omitempty"`
+}
+
+// AnalysisSchema is the JSON schema of StructuredAnalysis. Ollama enforces
+// it while generating; the other providers are asked for JSON and the reply
+// is validated against it.
+const AnalysisSchema = `{
+  "type": "object",
+  "properties": {
+    "summary": {"type": "string"},
+    "issues": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "title": {"type": "string"},
+          "severity": {"type": "string", "enum": ["critical", "high", "medium", "low"]},
+          "resource": {"type": "string"},
+          "rootCause": {"type": "string"},
+          "remediation": {"type": "array", "items": {"type": "string"}},
+          "kubectlCommands": {"type": "array", "items": {"type": "string"}}
+        },
+        "required": ["title", "severity", "rootCause", "remediation"]
+      }
+    }
+  },
+  "required": ["summary", "issues"]
+}`
+
+// structuredInstructions are appended to the prompt of AnalyzeStructured
+const structuredInstructions = `
+Respond with a single JSON object and nothing else: no markdown, no code fences. It must match this JSON schema:
+%s
+List one issue per distinct problem, most severe first, naming the affected resource as Kind/name. remediation lists the steps to fix it; kubectlCommands lists commands to verify or apply the fix, without a leading $. Keep the property names in English. If nothing is wrong, return an empty issues array.
+`
+
+// maxStructuredRepairs is how often a reply that does not match the schema
+// is sent back to the LLM to be corrected
+const maxStructuredRepairs = 1
+
+type jsonOutputKey struct{}
+
+// withJSONOutput returns a context whose requests ask the provider for JSON,
+// using its JSON mode where it has one
+func withJSONOutput(ctx context.Context) context.Context {
+	return context.WithValue(ctx, jsonOutputKey{}, true)
+}
+
+// jsonOutput reports whether requests should ask for JSON
+func jsonOutput(ctx context.Context) bool {
+	on, _ := ctx.Value(jsonOutputKey{}).(bool)
+	return on
+}
+
+// AnalyzeStructured asks provider for the analysis of prompt as JSON
+// matching AnalysisSchema, using the provider's JSON mode where supported.
+// A reply that does not match is sent back once to be corrected. It returns
+// the parsed analysis and the raw reply.
+func AnalyzeStructured(ctx context.Context, provider Provider, prompt string) (*StructuredAnalysis, string, error) {
+	ctx = withJSONOutput(ctx)
+	messages := userMessage(prompt + fmt.Sprintf(structuredInstructions, AnalysisSchema))
+
+	reply, err := provider.Chat(ctx, messages)
+	if err != nil {
+		return nil, "", err
+	}
+	for attempt := 0; ; attempt++ {
+		analysis, err := ParseStructuredAnalysis(reply)
+		if err == nil {
+			return analysis, reply, nil
+		}
+		if attempt == maxStructuredRepairs {
+			return nil, reply, err
+		}
+		messages = append(messages,
+			Message{Role: RoleAssistant, Content: reply},
+			Message{Role: RoleUser, Content: fmt.Sprintf("That reply is invalid: %v. Respond with only the corrected JSON object.", err)})
+		if reply, err = provider.Chat(ctx, messages); err != nil {
+			return nil, "", err
+		}
+	}
+}
+
+// SchemaError lists how a reply violates AnalysisSchema
+type SchemaError struct {
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return "analysis does not match the schema: " + strings.Join(e.Problems, "; ")
+}
+
+// ParseStructuredAnalysis parses and validates a JSON analysis. Code fences
+// and text around the object are ignored, and severities are lowercased.
+func ParseStructuredAnalysis(text string) (*StructuredAnalysis, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, &SchemaError{Problems: []string{"no JSON object found"}}
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text[start:end+1]), &raw); err != nil {
+		return nil, &SchemaError{Problems: []string{fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	var analysis StructuredAnalysis
+	if err := json.Unmarshal([]byte(text[start:end+1]), &analysis); err != nil {
+		return nil, &SchemaError{Problems: []string{fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	var problems []string
+	if _, ok := raw["issues"]; !ok {
+		problems = append(problems, "issues is required")
+	}
+	if strings.TrimSpace(analysis.Summary) == "" {
+		problems = append(problems, "summary is required")
+	}
+	for i := range analysis.Issues {
+		issue := &analysis.Issues[i]
+		issue.Severity = k8s.Severity(strings.ToLower(strings.TrimSpace(string(issue.Severity))))
+		if strings.TrimSpace(issue.Title) == "" {
+			problems = append(problems, fmt.Sprintf("issues[%d].title is required", i))
+		}
+		if issue.Severity.Rank() == 0 {
+			problems = append(problems, fmt.Sprintf("issues[%d].severity must be critical, high, medium or low", i))
+		}
+		if strings.TrimSpace(issue.RootCause) == "" {
+			problems = append(problems, fmt.Sprintf("issues[%d].rootCause is required", i))
+		}
+		if len(issue.Remediation) == 0 {
+			problems = append(problems, fmt.Sprintf("issues[%d].remediation needs at least one step", i))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &SchemaError{Problems: problems}
+	}
+	if analysis.Issues == nil {
+		analysis.Issues = []Issue{}
+	}
+	return &analysis, nil
+}
+
+// stringList is a list of strings that also accepts a single string, as
+// models sometimes return one step instead of an array
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Markdown renders the analysis like a freeform one, for terminals and
+// clients that only show text
+func (a *StructuredAnalysis) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## Summary\n\n")
+	sb.WriteString(strings.TrimSpace(a.Summary))
+	sb.WriteString("\n")
+	if len(a.Issues) == 0 {
+		sb.WriteString("\nNo issues found.\n")
+		return sb.String()
+	}
+
+	sb.WriteString("\n## Issues\n")
+	for i, issue := range a.Issues {
+		sb.WriteString(fmt.Sprintf("\n### %d. [%s] %s\n\n", i+1, strings.ToUpper(string(issue.Severity)), issue.Title))
+		if issue.Resource != "" {
+			sb.WriteString(fmt.Sprintf("**Resource:** %s\n\n", issue.Resource))
+		}
+		sb.WriteString(fmt.Sprintf("**Root cause:** %s\n\n", issue.RootCause))
+		sb.WriteString("**Remediation:**\n")
+		for j, step := range issue.Remediation {
+			sb.WriteString(fmt.Sprintf("%d. %s\n", j+1, step))
+		}
+		if len(issue.KubectlCommands) > 0 {
+			sb.WriteString("\n```bash\n")
+			for _, command := range issue.KubectlCommands {
+				sb.WriteString(command + "\n")
+			}
+			sb.WriteString("```\n")
+		}
+	}
+	return sb.String()
+}
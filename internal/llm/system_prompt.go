@@ -0,0 +1,42 @@
+package llm
+
+import "context"
+
+// DefaultSystemPrompt frames every request as Kubernetes troubleshooting
+const DefaultSystemPrompt = "You are a Kubernetes troubleshooting expert. Analyze the provided diagnostic data and provide actionable insights."
+
+type systemPromptKey struct{}
+
+// WithSystemPrompt returns a context whose requests use the given system
+// prompt instead of DefaultSystemPrompt; an empty prompt sends none
+func WithSystemPrompt(ctx context.Context, prompt string) context.Context {
+	return context.WithValue(ctx, systemPromptKey{}, prompt)
+}
+
+// SystemPromptFrom returns the system prompt of a request, for providers to
+// send with a system role or prepend to the prompt; "" means none
+func SystemPromptFrom(ctx context.Context) string {
+	if prompt, ok := ctx.Value(systemPromptKey{}).(string); ok {
+		return prompt
+	}
+	return DefaultSystemPrompt
+}
+
+// withSystemPrompt prefixes prompt with the system prompt for providers
+// without a separate system role
+func withSystemPrompt(ctx context.Context, prompt string) string {
+	if system := SystemPromptFrom(ctx); system != "" {
+		return system + "\n\n" + prompt
+	}
+	return prompt
+}
+
+// withSystemMessage returns a copy of messages whose first message is
+// prefixed with the system prompt, for providers without a system role
+func withSystemMessage(ctx context.Context, messages []Message) []Message {
+	out := append([]Message(nil), messages...)
+	if len(out) > 0 {
+		out[0].Content = withSystemPrompt(ctx, out[0].Content)
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/textutil"
+)
+
+// DefaultPromptTemplate renders the verbose diagnostic prompt of
+// BuildDiagnosticPromptWithOptions. It is the starting point for custom
+// templates, which are executed on the DiagnosticData the same way.
+const DefaultPromptTemplate = `# Kubernetes Diagnostic Report
+
+{{if .Clusters -}}
+**Clusters:** {{join (clusterNames .) ", "}}
+{{else -}}
+**Cluster Context:** {{.ContextName}}
+{{end -}}
+**Namespace:** {{namespaceLabel .Namespace}}
+**Collection Time:** {{rfc3339 .CollectedAt}}
+
+{{if .Workloads -}}
+**Focused Workloads:** {{join .Workloads ", "}}
+
+{{end -}}
+{{if .Clusters -}}
+{{warnings .Warnings}}
+{{- range .Clusters}}# Cluster: {{.ContextName}}
+
+{{sections .}}
+{{- end}}# Analysis Request
+
+Please analyze the above diagnostic data and provide:
+
+1. **Summary of Issues**: Identify the main problems in each cluster
+2. **Cluster Comparison**: Point out differences between the clusters (images, replicas, findings, events) that explain why they behave differently
+3. **Root Cause Analysis**: Explain the likely root causes
+4. **Remediation Steps**: Provide specific, actionable steps, naming the cluster each applies to
+5. **kubectl Commands**: Include relevant kubectl commands with ` + "`--context`" + `
+6. **Prevention**: Suggest how to prevent similar issues in the future
+
+Focus on the most critical issues first.
+{{else -}}
+{{sections .}}## Analysis Request
+
+Please analyze the above diagnostic data and provide:
+
+{{if .Namespaces -}}
+1. **Summary of Issues**: Identify the main problems, grouped by namespace
+{{else -}}
+1. **Summary of Issues**: Identify the main problems affecting this namespace
+{{end -}}
+2. **Root Cause Analysis**: Explain the likely root causes
+3. **Remediation Steps**: Provide specific, actionable steps to resolve the issues
+4. **kubectl Commands**: Include relevant kubectl commands that might help
+5. **Prevention**: Suggest how to prevent similar issues in the future
+
+Focus on the most critical issues first.
+{{end -}}
+`
+
+// defaultPromptTemplate is DefaultPromptTemplate, parsed once
+var defaultPromptTemplate = mustParsePromptTemplate("default", DefaultPromptTemplate)
+
+// PromptTemplate is a Go text/template rendering the diagnostic prompt from
+// the DiagnosticData, so teams can impose their runbook structure and
+// wording. Besides the text/template builtins it can call:
+//
+//	sections DATA         the report sections of BuildDiagnosticPrompt
+//	                      (pods, events, logs, findings, ...) for one cluster
+//	compactSections DATA  the same in the terse form of BuildCompactPrompt
+//	warnings LIST         the "Collection Warnings" section
+//	clusterNames DATA     the contexts of a multi-cluster collection
+//	namespaceLabel NS     the namespace, or "all namespaces"
+//	rfc3339 TIME          the time in RFC 3339 format
+//	join LIST SEP         strings.Join
+//	truncate S N          S cut to N characters
+//	lower S, upper S      change case
+//	json VALUE            VALUE encoded as indented JSON
+type PromptTemplate struct {
+	tmpl   *template.Template
+	source string
+}
+
+// ParsePromptTemplate parses a prompt template named name, e.g. its file
+func ParsePromptTemplate(name, text string) (*PromptTemplate, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs(PromptOptions{})).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %w", err)
+	}
+	return &PromptTemplate{tmpl: tmpl, source: text}, nil
+}
+
+// Source returns the text the template was parsed from
+func (t *PromptTemplate) Source() string {
+	return t.source
+}
+
+// LoadPromptTemplate reads and parses the prompt template at path
+func LoadPromptTemplate(path string) (*PromptTemplate, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template: %w", err)
+	}
+	return ParsePromptTemplate(filepath.Base(path), string(text))
+}
+
+func mustParsePromptTemplate(name, text string) *PromptTemplate {
+	t, err := ParsePromptTemplate(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Build renders the prompt for data; the sections function renders at the
+// detail level of opts
+func (t *PromptTemplate) Build(data *k8s.DiagnosticData, opts PromptOptions) (string, error) {
+	if opts.DetailLevel == "" {
+		opts.DetailLevel = DetailIssuesOnly
+	}
+	// Clone so that concurrent builds with different options do not share
+	// their functions
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Funcs(templateFuncs(opts)).Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// templateFuncs returns the functions of prompt templates, see PromptTemplate
+func templateFuncs(opts PromptOptions) template.FuncMap {
+	return template.FuncMap{
+		"sections": func(data any) (string, error) {
+			d, err := templateData(data)
+			if err != nil {
+				return "", err
+			}
+			var sb strings.Builder
+			writeDiagnosticSections(&sb, d, opts)
+			return sb.String(), nil
+		},
+		"compactSections": func(data any) (string, error) {
+			d, err := templateData(data)
+			if err != nil {
+				return "", err
+			}
+			var sb strings.Builder
+			writeCompactSections(&sb, d)
+			return sb.String(), nil
+		},
+		"warnings": func(warnings []string) string {
+			var sb strings.Builder
+			writeWarnings(&sb, warnings)
+			return sb.String()
+		},
+		"clusterNames": func(data any) ([]string, error) {
+			d, err := templateData(data)
+			if err != nil {
+				return nil, err
+			}
+			return clusterNames(d), nil
+		},
+		"namespaceLabel": namespaceLabel,
+		"rfc3339":        func(t time.Time) string { return t.Format(time.RFC3339) },
+		"join":           strings.Join,
+		"truncate":       textutil.Truncate,
+		"lower":          strings.ToLower,
+		"upper":          strings.ToUpper,
+		"json": func(v any) (string, error) {
+			out, err := json.MarshalIndent(v, "", "  ")
+			return string(out), err
+		},
+	}
+}
+
+// templateData accepts the DiagnosticData templates see: a pointer at the
+// top level, a value when ranging over .Clusters
+func templateData(data any) (*k8s.DiagnosticData, error) {
+	switch d := data.(type) {
+	case *k8s.DiagnosticData:
+		return d, nil
+	case k8s.DiagnosticData:
+		return &d, nil
+	}
+	return nil, fmt.Errorf("expected diagnostic data, got %T", data)
+}
@@ -0,0 +1,14 @@
+package llm
+
+// charsPerToken is a rough average for English text and Markdown across
+// common tokenizers (GPT, Gemini, Llama). It intentionally errs on the
+// side of over-estimating token usage.
+const charsPerToken = 4
+
+// EstimateTokens returns an approximate token count for the given text
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
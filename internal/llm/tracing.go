@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+
+	"kubehelp/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedProvider wraps a provider and records each call as an OpenTelemetry
+// span with the provider, model and token usage
+type TracedProvider struct {
+	provider Provider
+	system   string
+	model    string
+}
+
+// Traced wraps the providers factory creates so that their calls are traced.
+// Wrapping the factory rather than the provider gives each model a
+// ModelFallbackProvider tries its own span.
+func Traced(providerName string, factory ModelFactory) ModelFactory {
+	return func(model string) (Provider, error) {
+		provider, err := factory(model)
+		if err != nil {
+			return nil, err
+		}
+		return &TracedProvider{provider: provider, system: providerName, model: model}, nil
+	}
+}
+
+// Analyze delegates in an "llm.analyze" span
+func (p *TracedProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	ctx, span := p.start(ctx, "llm.analyze", prompt)
+	analysis, err := p.provider.Analyze(ctx, prompt)
+	tracing.End(span, err)
+	return analysis, err
+}
+
+// AnalyzeStream delegates in an "llm.analyze_stream" span that ends when
+// the stream does
+func (p *TracedProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	ctx, span := p.start(ctx, "llm.analyze_stream", prompt)
+	err := p.provider.AnalyzeStream(ctx, prompt, chunks)
+	tracing.End(span, err)
+	return err
+}
+
+// Chat delegates in an "llm.chat" span
+func (p *TracedProvider) Chat(ctx context.Context, messages []Message) (string, error) {
+	var size int
+	for _, m := range messages {
+		size += EstimateTokens(m.Content)
+	}
+	ctx, span := tracing.Start(ctx, "llm.chat", p.attributes(size)...)
+	span.SetAttributes(attribute.Int("gen_ai.request.messages", len(messages)))
+	reply, err := p.provider.Chat(ctx, messages)
+	tracing.End(span, err)
+	return reply, err
+}
+
+// Name returns the wrapped provider's name
+func (p *TracedProvider) Name() string {
+	return p.provider.Name()
+}
+
+func (p *TracedProvider) start(ctx context.Context, name, prompt string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, p.attributes(EstimateTokens(prompt))...)
+}
+
+// attributes describe the call with the GenAI semantic conventions
+func (p *TracedProvider) attributes(estimatedTokens int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("gen_ai.system", p.system),
+		attribute.String("gen_ai.request.model", p.model),
+		attribute.Int("kubehelp.prompt.estimated_tokens", estimatedTokens),
+	}
+}
+
+// traceUsage adds the token counts a provider reported to the call's span
+func traceUsage(ctx context.Context, promptTokens, completionTokens int) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("gen_ai.usage.input_tokens", promptTokens),
+		attribute.Int("gen_ai.usage.output_tokens", completionTokens),
+	)
+}
@@ -0,0 +1,375 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"kubehelp/internal/k8s"
+)
+
+// Truncation reports how FitPrompt shrank a prompt to its token budget
+type Truncation struct {
+	// OriginalTokens and Tokens are the estimated prompt sizes before and
+	// after truncation
+	OriginalTokens int
+	Tokens         int
+	// Omitted summarizes the data left out, as listed in the prompt
+	Omitted []string
+}
+
+// Truncated reports whether any data was left out
+func (t Truncation) Truncated() bool {
+	return len(t.Omitted) > 0
+}
+
+// truncationStage shrinks the data of one cluster, tallying what it leaves
+// out in o
+type truncationStage func(d *k8s.DiagnosticData, o *omissions)
+
+// truncationStages shrink the data in order of increasing importance:
+// healthy pods are summarized first, while unhealthy pods, their events and
+// high-severity findings are cut last
+var truncationStages = []truncationStage{
+	omitHealthyPods,
+	func(d *k8s.DiagnosticData, o *omissions) { trimLogs(d, o, 20) },
+	func(d *k8s.DiagnosticData, o *omissions) { trimEvents(d, o, 50) },
+	func(d *k8s.DiagnosticData, o *omissions) { trimLogs(d, o, 5) },
+	func(d *k8s.DiagnosticData, o *omissions) { trimEvents(d, o, 20) },
+	dropLogs,
+	dropPodSpecs,
+	func(d *k8s.DiagnosticData, o *omissions) { trimUnhealthyPods(d, o, 50) },
+	func(d *k8s.DiagnosticData, o *omissions) { dropFindings(d, o, k8s.SeverityLow) },
+	func(d *k8s.DiagnosticData, o *omissions) { trimUnhealthyPods(d, o, 20) },
+	func(d *k8s.DiagnosticData, o *omissions) { trimEvents(d, o, 5) },
+	func(d *k8s.DiagnosticData, o *omissions) { dropFindings(d, o, k8s.SeverityMedium) },
+}
+
+// FitPrompt renders data with build and, while the prompt is estimated to
+// exceed maxTokens, renders it again from a copy of data shrunk by each
+// truncation stage in turn. The prompt summarizes what was left out, so the
+// model knows it exists. A prompt still too large after the last stage is
+// returned as is; maxTokens <= 0 disables truncation.
+func FitPrompt(data *k8s.DiagnosticData, maxTokens int, build func(*k8s.DiagnosticData) string) (string, Truncation, error) {
+	prompt := build(data)
+	t := Truncation{OriginalTokens: EstimateTokens(prompt)}
+	t.Tokens = t.OriginalTokens
+	if maxTokens <= 0 || t.Tokens <= maxTokens {
+		return prompt, t, nil
+	}
+
+	fitted, err := cloneData(data)
+	if err != nil {
+		return "", t, err
+	}
+	clusters := fitted.ClusterData()
+	tallies := make([]*omissions, len(clusters))
+	for i := range tallies {
+		tallies[i] = &omissions{}
+	}
+
+	for _, stage := range truncationStages {
+		changed := false
+		for i, cluster := range clusters {
+			before := tallies[i].version
+			stage(cluster, tallies[i])
+			if tallies[i].version != before {
+				cluster.Omitted = tallies[i].lines()
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		prompt = build(fitted)
+		t.Tokens = EstimateTokens(prompt)
+		if t.Tokens <= maxTokens {
+			break
+		}
+	}
+
+	for i, cluster := range clusters {
+		for _, line := range tallies[i].lines() {
+			if len(clusters) > 1 {
+				line = cluster.ContextName + ": " + line
+			}
+			t.Omitted = append(t.Omitted, line)
+		}
+	}
+	return prompt, t, nil
+}
+
+// cloneData deep-copies data so that truncation leaves the original intact
+func cloneData(data *k8s.DiagnosticData) (*k8s.DiagnosticData, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy diagnostic data: %w", err)
+	}
+	var out k8s.DiagnosticData
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("failed to copy diagnostic data: %w", err)
+	}
+	return &out, nil
+}
+
+// omissions tallies the data of one cluster left out of the prompt
+type omissions struct {
+	kinds []*omission
+	// version changes with every addition, so stages that leave nothing
+	// out are detected
+	version int
+}
+
+// omission is the left-out data of one kind, e.g. healthy pods counted
+// by owner, or a fixed note such as how far logs were cut
+type omission struct {
+	what  string
+	count int
+	by    map[string]int
+	note  string
+}
+
+func (o *omissions) get(what string) *omission {
+	for _, kind := range o.kinds {
+		if kind.what == what {
+			return kind
+		}
+	}
+	kind := &omission{what: what, by: make(map[string]int)}
+	o.kinds = append(o.kinds, kind)
+	return kind
+}
+
+// add counts one left-out item of a kind under key, e.g. its owner
+func (o *omissions) add(what, key string) {
+	kind := o.get(what)
+	kind.count++
+	kind.by[key]++
+	o.version++
+}
+
+// set replaces the note of a kind
+func (o *omissions) set(what, note string) {
+	o.get(what).note = note
+	o.version++
+}
+
+// lines renders each kind, e.g. "480 healthy pods (Deployment/web ×400,
+// StatefulSet/db ×3)", listing its five largest groups
+func (o *omissions) lines() []string {
+	var lines []string
+	for _, kind := range o.kinds {
+		if kind.note != "" {
+			lines = append(lines, kind.note)
+			continue
+		}
+		keys := make([]string, 0, len(kind.by))
+		for key := range kind.by {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if kind.by[keys[i]] != kind.by[keys[j]] {
+				return kind.by[keys[i]] > kind.by[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		groups := make([]string, 0, 5)
+		for i, key := range keys {
+			if i == 5 {
+				groups = append(groups, "...")
+				break
+			}
+			groups = append(groups, fmt.Sprintf("%s ×%d", key, kind.by[key]))
+		}
+		lines = append(lines, fmt.Sprintf("%d %s (%s)", kind.count, kind.what, strings.Join(groups, ", ")))
+	}
+	return lines
+}
+
+// omitHealthyPods leaves out running, ready pods, counted by owner
+func omitHealthyPods(d *k8s.DiagnosticData, o *omissions) {
+	kept := d.Pods[:0]
+	for _, pod := range d.Pods {
+		if isPodUnhealthy(pod) {
+			kept = append(kept, pod)
+			continue
+		}
+		owner := pod.Owner
+		if owner == "" {
+			owner = "no owner"
+		}
+		o.add("healthy pods", k8s.Qualify(pod.Namespace, owner))
+	}
+	d.Pods = kept
+}
+
+// trimLogs keeps the last lines of each container log
+func trimLogs(d *k8s.DiagnosticData, o *omissions, lines int) {
+	trimmed := false
+	for i := range d.Logs {
+		l := &d.Logs[i]
+		if cut := len(l.Lines) - lines; cut > 0 {
+			l.Lines = l.Lines[cut:]
+			l.Omitted += cut
+			trimmed = true
+		}
+	}
+	if trimmed {
+		o.set("logs", fmt.Sprintf("container log lines before the last %d", lines))
+	}
+}
+
+// dropLogs leaves out all container logs
+func dropLogs(d *k8s.DiagnosticData, o *omissions) {
+	if len(d.Logs) == 0 {
+		return
+	}
+	o.set("logs", fmt.Sprintf("the logs of %d containers", len(d.Logs)))
+	d.Logs = nil
+}
+
+// dropPodSpecs leaves out the spec summaries of unhealthy pods
+func dropPodSpecs(d *k8s.DiagnosticData, o *omissions) {
+	dropped := 0
+	for i := range d.Pods {
+		if d.Pods[i].Spec != nil {
+			d.Pods[i].Spec = nil
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		o.set("pod specs", fmt.Sprintf("the spec summaries of %d pods", dropped))
+	}
+}
+
+// trimEvents keeps at most max events, preferring those about objects still
+// in the prompt, then the most recent ones. Left-out events are counted by
+// reason.
+func trimEvents(d *k8s.DiagnosticData, o *omissions, max int) {
+	if len(d.Events) <= max {
+		return
+	}
+	pods := make(map[string]bool)
+	for _, pod := range d.Pods {
+		pods[k8s.Qualify(pod.Namespace, "Pod/"+pod.Name)] = true
+	}
+	// Events about pods left out of the prompt matter least
+	relevant := func(e k8s.EventInfo) bool {
+		return !strings.HasPrefix(e.InvolvedObject, "Pod/") || pods[k8s.Qualify(e.Namespace, e.InvolvedObject)]
+	}
+
+	order := make([]int, len(d.Events))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := d.Events[order[i]], d.Events[order[j]]
+		if relevant(a) != relevant(b) {
+			return relevant(a)
+		}
+		return a.LastTimestamp.After(b.LastTimestamp)
+	})
+	keep := make(map[int]bool, max)
+	for _, i := range order[:max] {
+		keep[i] = true
+	}
+
+	kept := make([]k8s.EventInfo, 0, max)
+	for i, e := range d.Events {
+		if keep[i] {
+			kept = append(kept, e)
+		} else {
+			o.add("less relevant events", e.Reason)
+		}
+	}
+	d.Events = kept
+}
+
+// trimUnhealthyPods keeps at most max pods, preferring failing containers
+// over Pending pods and pods with more restarts, and drops the logs of the
+// others. Left-out pods are counted by reason.
+func trimUnhealthyPods(d *k8s.DiagnosticData, o *omissions, max int) {
+	if len(d.Pods) <= max {
+		return
+	}
+	order := make([]int, len(d.Pods))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := d.Pods[order[i]], d.Pods[order[j]]
+		if podRank(a) != podRank(b) {
+			return podRank(a) < podRank(b)
+		}
+		return a.Restarts > b.Restarts
+	})
+	keep := make(map[int]bool, max)
+	for _, i := range order[:max] {
+		keep[i] = true
+	}
+
+	kept := make([]k8s.PodInfo, 0, max)
+	dropped := make(map[string]bool)
+	for i, pod := range d.Pods {
+		if keep[i] {
+			kept = append(kept, pod)
+			continue
+		}
+		dropped[k8s.Qualify(pod.Namespace, pod.Name)] = true
+		o.add("more unhealthy pods", podReason(pod))
+	}
+	d.Pods = kept
+
+	logs := d.Logs[:0]
+	for _, l := range d.Logs {
+		if !dropped[k8s.Qualify(l.Namespace, l.Pod)] {
+			logs = append(logs, l)
+		}
+	}
+	d.Logs = logs
+}
+
+// podRank orders unhealthy pods by how much they explain: failing
+// containers first, then pods that are not running, then the rest
+func podRank(pod k8s.PodInfo) int {
+	for _, cs := range pod.AllContainerStatuses() {
+		if cs.Reason != "" && cs.Reason != "Completed" {
+			return 0
+		}
+	}
+	if pod.Phase != "Running" && pod.Phase != "Succeeded" {
+		return 1
+	}
+	return 2
+}
+
+// podReason names why a pod is unhealthy, e.g. "CrashLoopBackOff" or
+// "Pending"
+func podReason(pod k8s.PodInfo) string {
+	if status := pod.InitStatus(); status != "" {
+		return status
+	}
+	for _, cs := range pod.ContainerStatuses {
+		if cs.Reason != "" && cs.Reason != "Completed" {
+			return cs.Reason
+		}
+	}
+	if pod.Reason != "" {
+		return pod.Reason
+	}
+	return pod.Phase
+}
+
+// dropFindings leaves out findings of severity or lower, counted by rule
+func dropFindings(d *k8s.DiagnosticData, o *omissions, severity k8s.Severity) {
+	kept := d.Findings[:0]
+	for _, f := range d.Findings {
+		if f.Severity.Rank() > severity.Rank() {
+			kept = append(kept, f)
+			continue
+		}
+		o.add(fmt.Sprintf("%s-severity findings", f.Severity), f.Rule)
+	}
+	d.Findings = kept
+}
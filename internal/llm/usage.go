@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// DefaultOutputPrices lists approximate output prices in USD per million
+// tokens for the models of DefaultInputPrices. Override with
+// KUBEHELP_OUTPUT_COST_PER_MTOK when the model is missing or prices change.
+var DefaultOutputPrices = map[string]float64{
+	"gpt-4":            60,
+	"gpt-4-turbo":      30,
+	"gpt-4o":           10,
+	"gpt-4o-mini":      0.6,
+	"gemini-pro":       1.5,
+	"gemini-1.5-pro":   5,
+	"gemini-1.5-flash": 0.3,
+	"gemini-2.0-flash": 0.4,
+	"gemini-2.5-pro":   10,
+	"gemini-2.5-flash": 2.5,
+}
+
+// OutputCostPerMillion returns the output price in USD per million tokens
+// for a provider's model. Local Ollama models are free.
+func OutputCostPerMillion(provider, model string) (float64, bool) {
+	if value := os.Getenv("KUBEHELP_OUTPUT_COST_PER_MTOK"); value != "" {
+		if price, err := strconv.ParseFloat(value, 64); err == nil && price >= 0 {
+			return price, true
+		}
+	}
+	if provider == "ollama" {
+		return 0, true
+	}
+	price, ok := DefaultOutputPrices[model]
+	return price, ok
+}
+
+// EstimateCost returns the cost in USD of a call with the given token
+// counts, or false when the model's input or output price is unknown
+func EstimateCost(provider, model string, promptTokens, completionTokens int) (float64, bool) {
+	input, ok := InputCostPerMillion(provider, model)
+	if !ok {
+		return 0, false
+	}
+	output, ok := OutputCostPerMillion(provider, model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*input + float64(completionTokens)*output) / 1e6, true
+}
+
+// Usage counts the tokens of the LLM calls made with one provider and model,
+// as reported by the provider
+type Usage struct {
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	Calls            int    `json:"calls"`
+	PromptTokens     int    `json:"promptTokens"`
+	CompletionTokens int    `json:"completionTokens"`
+	// Cost is the estimated cost in USD, nil when no price is known for
+	// the model
+	Cost *float64 `json:"costUsd,omitempty"`
+}
+
+// TotalTokens returns the prompt plus completion tokens
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// String summarizes the usage, e.g.
+// "openai/gpt-4o: 1200 prompt + 350 completion tokens, ~$0.0065"
+func (u Usage) String() string {
+	s := fmt.Sprintf("%d prompt + %d completion tokens", u.PromptTokens, u.CompletionTokens)
+	if u.Provider != "" {
+		s = fmt.Sprintf("%s/%s: %s", u.Provider, u.Model, s)
+	}
+	if u.Cost != nil {
+		return s + fmt.Sprintf(", ~$%.4f", *u.Cost)
+	}
+	return s + ", cost unknown (set KUBEHELP_INPUT_COST_PER_MTOK and KUBEHELP_OUTPUT_COST_PER_MTOK)"
+}
+
+// TotalUsage sums usages across providers. The cost is nil when any of them
+// has an unknown cost.
+func TotalUsage(usages []Usage) Usage {
+	var total Usage
+	cost, known := 0.0, true
+	for _, u := range usages {
+		total.Calls += u.Calls
+		total.PromptTokens += u.PromptTokens
+		total.CompletionTokens += u.CompletionTokens
+		if u.Cost == nil {
+			known = false
+		} else {
+			cost += *u.Cost
+		}
+	}
+	if known {
+		total.Cost = &cost
+	}
+	return total
+}
+
+// UsageTracker collects the token usage of the LLM calls made with a
+// context returned by WithUsageTracker. It is safe for concurrent use.
+type UsageTracker struct {
+	mu     sync.Mutex
+	usages []Usage
+}
+
+type usageTrackerKey struct{}
+
+// WithUsageTracker returns a context whose LLM calls record their token
+// usage in the returned tracker, including calls made by fallback providers
+func WithUsageTracker(ctx context.Context) (context.Context, *UsageTracker) {
+	tracker := &UsageTracker{}
+	return context.WithValue(ctx, usageTrackerKey{}, tracker), tracker
+}
+
+// Usage returns the usage per provider and model, in order of first use
+func (t *UsageTracker) Usage() []Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Usage, len(t.usages))
+	for i, u := range t.usages {
+		if u.Cost != nil {
+			cost := *u.Cost
+			u.Cost = &cost
+		}
+		out[i] = u
+	}
+	return out
+}
+
+// add records one call
+func (t *UsageTracker) add(provider, model string, promptTokens, completionTokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	i := 0
+	for i < len(t.usages) && (t.usages[i].Provider != provider || t.usages[i].Model != model) {
+		i++
+	}
+	if i == len(t.usages) {
+		t.usages = append(t.usages, Usage{Provider: provider, Model: model})
+	}
+	u := &t.usages[i]
+	u.Calls++
+	u.PromptTokens += promptTokens
+	u.CompletionTokens += completionTokens
+	if cost, ok := EstimateCost(provider, model, u.PromptTokens, u.CompletionTokens); ok {
+		u.Cost = &cost
+	}
+}
+
+// recordUsage adds the token counts a provider reported for a call to the
+// context's tracker, if any, and to the call's trace span
+func recordUsage(ctx context.Context, provider, model string, promptTokens, completionTokens int) {
+	traceUsage(ctx, promptTokens, completionTokens)
+	if tracker, ok := ctx.Value(usageTrackerKey{}).(*UsageTracker); ok {
+		tracker.add(provider, model, promptTokens, completionTokens)
+	}
+}
@@ -1,31 +1,74 @@
 package llm
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	aiplatform "google.golang.org/api/aiplatform/v1"
 	"google.golang.org/api/option"
 )
 
+func init() {
+	Register("vertexai", Factory{
+		New: func(model string) (Provider, error) {
+			projectID, location, _ := VertexAIEnvConfig()
+			provider, err := NewVertexAIProviderWithOptions(projectID, location, model, VertexAIOptionsFromEnv())
+			if err != nil {
+				return nil, fmt.Errorf("failed to create Vertex AI provider: %w", err)
+			}
+			return provider, nil
+		},
+		DefaultModel: func() string {
+			_, _, model := VertexAIEnvConfig()
+			return model
+		},
+		Description: "Google Vertex AI with Application Default Credentials (VERTEX_AI_PROJECT_ID, VERTEX_AI_LOCATION, VERTEX_AI_MODEL)",
+	})
+}
+
+// defaultVertexMaxOutputTokens is the response length limit of Vertex AI
+// without VertexAIOptions.MaxOutputTokens
+const defaultVertexMaxOutputTokens = 2048
+
 // VertexAIProvider implements the Provider interface for Google Vertex AI
 type VertexAIProvider struct {
 	projectID string
 	location  string
 	model     string
+	baseURL   string
+	opts      VertexAIOptions
 	service   *aiplatform.Service
+	// client is the authenticated HTTP client used for streaming requests
+	client *retryClient
+}
+
+// VertexAIOptions configures generation. Zero values select the defaults.
+type VertexAIOptions struct {
+	// Temperature controls randomness (default 0.7); nil selects the default
+	// so that 0 can be requested explicitly
+	Temperature *float64
+	// MaxOutputTokens limits the response length (default 2048)
+	MaxOutputTokens int64
 }
 
 // NewVertexAIProvider creates a new Vertex AI provider
 func NewVertexAIProvider(projectID, location, model string) (*VertexAIProvider, error) {
+	return NewVertexAIProviderWithOptions(projectID, location, model, VertexAIOptions{})
+}
 
-	if projectID == "" {
-		return nil, fmt.Errorf("project ID not specified and could not be determined from gcloud config")
-	}
-
+// NewVertexAIProviderWithOptions creates a Vertex AI provider with custom
+// generation options. Requests go to the regional endpoint of location.
+func NewVertexAIProviderWithOptions(projectID, location, model string, opts VertexAIOptions) (*VertexAIProvider, error) {
 	if location == "" {
 		location = "us-central1"
 	}
@@ -34,6 +77,14 @@ func NewVertexAIProvider(projectID, location, model string) (*VertexAIProvider,
 		model = "gemini-pro"
 	}
 
+	if opts.Temperature == nil {
+		temperature := DefaultTemperature
+		opts.Temperature = &temperature
+	}
+	if opts.MaxOutputTokens <= 0 {
+		opts.MaxOutputTokens = defaultVertexMaxOutputTokens
+	}
+
 	ctx := context.Background()
 
 	// Use Application Default Credentials
@@ -42,7 +93,17 @@ func NewVertexAIProvider(projectID, location, model string) (*VertexAIProvider,
 		return nil, fmt.Errorf("failed to find default credentials: %w (run 'gcloud auth application-default login')", err)
 	}
 
-	service, err := aiplatform.NewService(ctx, option.WithCredentials(creds))
+	// Fall back to the project ADC knows about, so that
+	// 'gcloud auth application-default login' is enough
+	if projectID == "" {
+		projectID = credentialsProject(creds)
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("project ID not specified and could not be determined from Application Default Credentials; set VERTEX_AI_PROJECT_ID or run 'gcloud auth application-default set-quota-project <project>'")
+	}
+
+	baseURL := vertexEndpoint(location)
+	service, err := aiplatform.NewService(ctx, option.WithCredentials(creds), option.WithEndpoint(baseURL))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Vertex AI service: %w", err)
 	}
@@ -51,58 +112,240 @@ func NewVertexAIProvider(projectID, location, model string) (*VertexAIProvider,
 		projectID: projectID,
 		location:  location,
 		model:     model,
+		baseURL:   baseURL,
+		opts:      opts,
 		service:   service,
+		client:    newRetryClient(oauth2.NewClient(ctx, creds.TokenSource)),
 	}, nil
 }
 
+// credentialsProject returns the project of Application Default
+// Credentials: the service account or metadata server project, or the quota
+// project of user credentials from 'gcloud auth application-default login'
+func credentialsProject(creds *google.Credentials) string {
+	if creds.ProjectID != "" {
+		return creds.ProjectID
+	}
+	var file struct {
+		QuotaProjectID string `json:"quota_project_id"`
+	}
+	if len(creds.JSON) > 0 && json.Unmarshal(creds.JSON, &file) == nil {
+		return file.QuotaProjectID
+	}
+	return ""
+}
+
+// vertexEndpoint returns the regional endpoint for location, e.g.
+// https://europe-west4-aiplatform.googleapis.com/, or the global endpoint
+func vertexEndpoint(location string) string {
+	if location == "global" {
+		return "https://aiplatform.googleapis.com/"
+	}
+	return fmt.Sprintf("https://%s-aiplatform.googleapis.com/", location)
+}
+
 // Name returns the provider name
 func (p *VertexAIProvider) Name() string {
 	return "vertexai"
 }
 
-// Analyze sends a prompt to Vertex AI and returns the response
-func (p *VertexAIProvider) Analyze(ctx context.Context, prompt string) (string, error) {
-	endpoint := fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s",
+// modelPath returns the publisher model resource name
+func (p *VertexAIProvider) modelPath() string {
+	return fmt.Sprintf("projects/%s/locations/%s/publishers/google/models/%s",
 		p.projectID, p.location, p.model)
+}
 
-	systemInstruction := "You are a Kubernetes troubleshooting expert. Analyze the provided diagnostic data and provide actionable insights."
-
-	request := &aiplatform.GoogleCloudAiplatformV1GenerateContentRequest{
-		Contents: []*aiplatform.GoogleCloudAiplatformV1Content{
-			{
-				Role: "user",
-				Parts: []*aiplatform.GoogleCloudAiplatformV1Part{
-					{
-						Text: fmt.Sprintf("%s\n\n%s", systemInstruction, prompt),
-					},
-				},
-			},
-		},
-		GenerationConfig: &aiplatform.GoogleCloudAiplatformV1GenerationConfig{
-			Temperature:     0.7,
-			MaxOutputTokens: 2048,
-		},
+func (p *VertexAIProvider) request(ctx context.Context, messages []Message) *aiplatform.GoogleCloudAiplatformV1GenerateContentRequest {
+	var contents []*aiplatform.GoogleCloudAiplatformV1Content
+	for _, m := range withSystemMessage(ctx, messages) {
+		// Vertex AI calls the assistant "model"
+		role := m.Role
+		if role == RoleAssistant {
+			role = "model"
+		}
+		contents = append(contents, &aiplatform.GoogleCloudAiplatformV1Content{
+			Role:  role,
+			Parts: []*aiplatform.GoogleCloudAiplatformV1Part{{Text: m.Content}},
+		})
 	}
 
+	// Request settings override the provider's options
+	gen := GenerationFrom(ctx)
+	config := &aiplatform.GoogleCloudAiplatformV1GenerationConfig{
+		Temperature:     gen.temperature(*p.opts.Temperature),
+		MaxOutputTokens: p.opts.MaxOutputTokens,
+		// Send an explicit 0 rather than omitting it
+		ForceSendFields: []string{"Temperature"},
+	}
+	if gen.TopP != nil {
+		config.TopP = *gen.TopP
+		config.ForceSendFields = append(config.ForceSendFields, "TopP")
+	}
+	if gen.MaxOutputTokens > 0 {
+		config.MaxOutputTokens = int64(gen.MaxOutputTokens)
+	}
+	if jsonOutput(ctx) {
+		config.ResponseMimeType = "application/json"
+	}
+
+	return &aiplatform.GoogleCloudAiplatformV1GenerateContentRequest{
+		Contents:         contents,
+		GenerationConfig: config,
+	}
+}
+
+// Analyze sends a prompt to Vertex AI and returns the response
+func (p *VertexAIProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	return p.Chat(ctx, userMessage(prompt))
+}
+
+// Chat sends a conversation to Vertex AI and returns the reply
+func (p *VertexAIProvider) Chat(ctx context.Context, messages []Message) (string, error) {
 	// Set timeout
 	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
-	resp, err := p.service.Projects.Locations.Publishers.Models.GenerateContent(endpoint, request).Context(ctx).Do()
+	req := p.request(ctx, messages)
+	resp, err := p.service.Projects.Locations.Publishers.Models.GenerateContent(p.modelPath(), req).Context(ctx).Do()
 	if err != nil {
 		return "", fmt.Errorf("Vertex AI API request failed: %w", err)
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+	text, finishReason, err := vertexCandidate(resp)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
 		return "", fmt.Errorf("no response from Vertex AI")
 	}
+	p.recordUsage(ctx, resp.UsageMetadata)
+	return text + truncationNote(ctx, finishReason, req.GenerationConfig.MaxOutputTokens), nil
+}
+
+// AnalyzeStream sends a prompt using streamGenerateContent and delivers
+// text chunks on chunks as they arrive. chunks is closed when it returns.
+// Long analyses are not cut off by the 60s timeout used by Analyze.
+func (p *VertexAIProvider) AnalyzeStream(ctx context.Context, prompt string, chunks chan<- string) error {
+	defer close(chunks)
+
+	request := p.request(ctx, userMessage(prompt))
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%sv1/%s:streamGenerateContent?alt=sse", p.baseURL, p.modelPath())
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Vertex AI API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// Each chunk reports the usage so far; the last one is the total
+	var finishReason string
+	var usage *aiplatform.GoogleCloudAiplatformV1GenerateContentResponseUsageMetadata
+	defer func() { p.recordUsage(ctx, usage) }()
+	err = readSSE(resp.Body, func(data string) error {
+		var event aiplatform.GoogleCloudAiplatformV1GenerateContentResponse
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to decode stream event: %w", err)
+		}
+		if event.UsageMetadata != nil {
+			usage = event.UsageMetadata
+		}
+		text, reason, err := vertexCandidate(&event)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			finishReason = reason
+		}
+		if text == "" {
+			return nil
+		}
+		return sendChunk(ctx, chunks, text)
+	})
+	if err != nil {
+		return err
+	}
+
+	if note := truncationNote(ctx, finishReason, request.GenerationConfig.MaxOutputTokens); note != "" {
+		return sendChunk(ctx, chunks, note)
+	}
+	return nil
+}
+
+// vertexCandidate returns the text and finish reason of the first candidate.
+// Prompts or responses blocked by safety filters become errors instead of
+// an empty analysis.
+func vertexCandidate(resp *aiplatform.GoogleCloudAiplatformV1GenerateContentResponse) (string, string, error) {
+	if fb := resp.PromptFeedback; fb != nil && fb.BlockReason != "" {
+		msg := fb.BlockReasonMessage
+		if msg == "" {
+			msg = fb.BlockReason
+		}
+		return "", "", fmt.Errorf("Vertex AI blocked the prompt: %s", msg)
+	}
+	if len(resp.Candidates) == 0 {
+		return "", "", nil
+	}
 
-	return resp.Candidates[0].Content.Parts[0].Text, nil
+	candidate := resp.Candidates[0]
+	switch candidate.FinishReason {
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "", "", fmt.Errorf("Vertex AI stopped the response (finishReason %s); try --anonymize or a narrower workload selection", candidate.FinishReason)
+	}
+
+	var sb strings.Builder
+	if candidate.Content != nil {
+		for _, part := range candidate.Content.Parts {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String(), candidate.FinishReason, nil
+}
+
+// recordUsage records the usage reported with a response, if any
+func (p *VertexAIProvider) recordUsage(ctx context.Context, usage *aiplatform.GoogleCloudAiplatformV1GenerateContentResponseUsageMetadata) {
+	if usage != nil {
+		recordUsage(ctx, p.Name(), p.model, int(usage.PromptTokenCount), int(usage.CandidatesTokenCount))
+	}
+}
+
+// truncationNote explains a response cut off at limit, the max output tokens
+// of the request, naming the setting it came from: --max-output-tokens when
+// the request set one, else VERTEX_AI_MAX_OUTPUT_TOKENS
+func truncationNote(ctx context.Context, finishReason string, limit int64) string {
+	if finishReason != "MAX_TOKENS" {
+		return ""
+	}
+	setting := "VERTEX_AI_MAX_OUTPUT_TOKENS"
+	if GenerationFrom(ctx).MaxOutputTokens > 0 {
+		setting = "--max-output-tokens"
+	}
+	return fmt.Sprintf("\n\n[Response truncated at %d output tokens; raise %s for the full analysis]", limit, setting)
 }
 
 // Helper function to get Vertex AI provider from environment
 func NewVertexAIProviderFromEnv() (*VertexAIProvider, error) {
-	projectID := os.Getenv("VERTEX_AI_PROJECT_ID")
+	projectID, location, model := VertexAIEnvConfig()
+	return NewVertexAIProviderWithOptions(projectID, location, model, VertexAIOptionsFromEnv())
+}
+
+// VertexAIEnvConfig reads the Vertex AI project, location and model from the environment
+func VertexAIEnvConfig() (projectID, location, model string) {
+	projectID = os.Getenv("VERTEX_AI_PROJECT_ID")
 	if projectID == "" {
 		projectID = os.Getenv("GCP_PROJECT")
 	}
@@ -110,15 +353,28 @@ func NewVertexAIProviderFromEnv() (*VertexAIProvider, error) {
 		projectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
 	}
 
-	location := os.Getenv("VERTEX_AI_LOCATION")
+	location = os.Getenv("VERTEX_AI_LOCATION")
 	if location == "" {
 		location = "us-central1"
 	}
 
-	model := os.Getenv("VERTEX_AI_MODEL")
+	model = os.Getenv("VERTEX_AI_MODEL")
 	if model == "" {
 		model = "gemini-pro"
 	}
 
-	return NewVertexAIProvider(projectID, location, model)
+	return projectID, location, model
+}
+
+// VertexAIOptionsFromEnv reads VERTEX_AI_TEMPERATURE and
+// VERTEX_AI_MAX_OUTPUT_TOKENS; unset or invalid values select the defaults
+func VertexAIOptionsFromEnv() VertexAIOptions {
+	var opts VertexAIOptions
+	if value, err := strconv.ParseFloat(os.Getenv("VERTEX_AI_TEMPERATURE"), 64); err == nil {
+		opts.Temperature = &value
+	}
+	if value, err := strconv.ParseInt(os.Getenv("VERTEX_AI_MAX_OUTPUT_TOKENS"), 10, 64); err == nil {
+		opts.MaxOutputTokens = value
+	}
+	return opts
 }
@@ -0,0 +1,220 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"kubehelp/internal/k8s"
+)
+
+// Level controls how aggressively diagnostic data is redacted
+type Level string
+
+const (
+	// LevelOff sends diagnostic data unchanged
+	LevelOff Level = "off"
+	// LevelDefault removes credential-like values: key=value secrets,
+	// authorization headers, URL credentials, tokens, registry auth and
+	// private keys
+	LevelDefault Level = "default"
+	// LevelStrict additionally removes all literal env var values, email
+	// addresses and long hex or base64 strings that may be keys
+	LevelStrict Level = "strict"
+)
+
+// Levels lists the valid redaction levels
+var Levels = []Level{LevelOff, LevelDefault, LevelStrict}
+
+// ParseLevel parses a redaction level; the empty string means LevelDefault
+func ParseLevel(s string) (Level, error) {
+	if s == "" {
+		return LevelDefault, nil
+	}
+	for _, level := range Levels {
+		if strings.EqualFold(s, string(level)) {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("invalid redaction level %q (valid: off, default, strict)", s)
+}
+
+// strictPatterns are only applied at LevelStrict since they also match
+// harmless values such as commit hashes
+var strictPatterns = []*regexp.Regexp{
+	// Email addresses
+	regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	// Long hex strings (API keys, HMAC secrets)
+	regexp.MustCompile(`\b[0-9a-fA-F]{32,}\b`),
+	// Long base64 strings
+	regexp.MustCompile(`\b[A-Za-z0-9+/]{40,}={0,2}`),
+}
+
+// Redactor scrubs secret material from diagnostic data before it is put
+// into a prompt
+type Redactor struct {
+	level    Level
+	patterns []*regexp.Regexp
+}
+
+// New creates a Redactor for level. Extra patterns are regular expressions
+// whose matches are redacted too; as with the built-in patterns, a pattern
+// with capture groups keeps the first group and redacts the rest of the
+// match, e.g. `(session=)\S+`.
+func New(level Level, extraPatterns []string) (*Redactor, error) {
+	r := &Redactor{level: level}
+	if level == LevelOff {
+		return r, nil
+	}
+	r.patterns = append(r.patterns, secretPatterns...)
+	if level == LevelStrict {
+		r.patterns = append(r.patterns, strictPatterns...)
+	}
+	for _, pattern := range extraPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Level returns the redaction level
+func (r *Redactor) Level() Level {
+	return r.level
+}
+
+// String scrubs s according to the redaction level and extra patterns
+func (r *Redactor) String(s string) string {
+	return replaceAll(s, r.patterns)
+}
+
+// Apply returns a redacted copy of data; the original is not modified.
+// Messages, env values, events, log lines, findings and warnings are
+// scrubbed; names, images and counts are kept so the analysis still works.
+// At LevelStrict every literal env var value is replaced.
+func (r *Redactor) Apply(data *k8s.DiagnosticData) (*k8s.DiagnosticData, error) {
+	if r.level == LevelOff {
+		return data, nil
+	}
+	out, err := deepCopy(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range out.Clusters {
+		cluster, err := r.Apply(&out.Clusters[i])
+		if err != nil {
+			return nil, err
+		}
+		out.Clusters[i] = *cluster
+	}
+
+	for i := range out.Pods {
+		pod := &out.Pods[i]
+		pod.Message = r.String(pod.Message)
+		for _, statuses := range [][]k8s.ContainerStatus{pod.ContainerStatuses, pod.InitContainerStatuses, pod.EphemeralContainerStatuses} {
+			for j := range statuses {
+				cs := &statuses[j]
+				cs.Message = r.String(cs.Message)
+				for k := range cs.Probes {
+					cs.Probes[k].LastFailure = r.String(cs.Probes[k].LastFailure)
+				}
+				if p := cs.ImagePull; p != nil {
+					for k := range p.Events {
+						p.Events[k].Message = r.String(p.Events[k].Message)
+					}
+				}
+				for k := range cs.Env {
+					env := &cs.Env[k]
+					if env.Value == "" || env.Value == k8s.RedactedEnvValue {
+						continue
+					}
+					if r.level == LevelStrict {
+						env.Value = Placeholder
+					} else {
+						env.Value = r.String(env.Value)
+					}
+				}
+			}
+		}
+		for j := range pod.Conditions {
+			pod.Conditions[j].Message = r.String(pod.Conditions[j].Message)
+		}
+		for j := range pod.ReadinessGates {
+			pod.ReadinessGates[j].Message = r.String(pod.ReadinessGates[j].Message)
+		}
+	}
+	for i := range out.Controllers {
+		for j := range out.Controllers[i].Conditions {
+			cond := &out.Controllers[i].Conditions[j]
+			cond.Message = r.String(cond.Message)
+		}
+	}
+	for i := range out.Nodes {
+		for j := range out.Nodes[i].Conditions {
+			cond := &out.Nodes[i].Conditions[j]
+			cond.Message = r.String(cond.Message)
+		}
+	}
+	for i := range out.VolumeClaims {
+		c := &out.VolumeClaims[i]
+		for j := range c.Events {
+			c.Events[j] = r.String(c.Events[j])
+		}
+		if c.Volume != nil {
+			c.Volume.Message = r.String(c.Volume.Message)
+		}
+	}
+	for i := range out.Ingresses {
+		for j := range out.Ingresses[i].Problems {
+			out.Ingresses[i].Problems[j] = r.String(out.Ingresses[i].Problems[j])
+		}
+	}
+	for i := range out.HTTPRoutes {
+		route := &out.HTTPRoutes[i]
+		for j := range route.Conditions {
+			route.Conditions[j].Message = r.String(route.Conditions[j].Message)
+		}
+		for j := range route.Problems {
+			route.Problems[j] = r.String(route.Problems[j])
+		}
+	}
+	for i := range out.Events {
+		out.Events[i].Message = r.String(out.Events[i].Message)
+	}
+	for i := range out.Logs {
+		out.Logs[i].Note = r.String(out.Logs[i].Note)
+		for j := range out.Logs[i].Lines {
+			out.Logs[i].Lines[j] = r.String(out.Logs[i].Lines[j])
+		}
+	}
+	for i := range out.Connectivity {
+		out.Connectivity[i].Error = r.String(out.Connectivity[i].Error)
+	}
+	for i := range out.Findings {
+		out.Findings[i].Message = r.String(out.Findings[i].Message)
+	}
+	for i := range out.Warnings {
+		out.Warnings[i] = r.String(out.Warnings[i])
+	}
+	for i := range out.Namespaces {
+		out.Namespaces[i].Skipped = r.String(out.Namespaces[i].Skipped)
+	}
+
+	return out, nil
+}
+
+func deepCopy(data *k8s.DiagnosticData) (*k8s.DiagnosticData, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy diagnostic data: %w", err)
+	}
+	var out k8s.DiagnosticData
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("failed to copy diagnostic data: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,176 @@
+package share
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Uploader publishes a report and returns a shareable URL
+type Uploader interface {
+	Upload(ctx context.Context, title, content string) (string, error)
+	// Name returns the backend name
+	Name() string
+}
+
+// NewUploaderFromEnv creates the uploader selected by KUBEHELP_SHARE_BACKEND:
+//   - "gist" (default): GitHub Gist using KUBEHELP_GIST_TOKEN or GITHUB_TOKEN
+//   - "http": POST to KUBEHELP_SHARE_URL with optional KUBEHELP_SHARE_TOKEN
+func NewUploaderFromEnv() (Uploader, error) {
+	switch backend := os.Getenv("KUBEHELP_SHARE_BACKEND"); backend {
+	case "", "gist":
+		token := os.Getenv("KUBEHELP_GIST_TOKEN")
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+		if token == "" {
+			return nil, fmt.Errorf("gist sharing requires KUBEHELP_GIST_TOKEN or GITHUB_TOKEN (token with gist scope)")
+		}
+		return NewGistUploader(token, os.Getenv("KUBEHELP_GIST_PUBLIC") == "true"), nil
+	case "http":
+		endpoint := os.Getenv("KUBEHELP_SHARE_URL")
+		if endpoint == "" {
+			return nil, fmt.Errorf("http sharing requires KUBEHELP_SHARE_URL")
+		}
+		return NewHTTPUploader(endpoint, os.Getenv("KUBEHELP_SHARE_TOKEN")), nil
+	default:
+		return nil, fmt.Errorf("unsupported KUBEHELP_SHARE_BACKEND %q (supported: gist, http)", backend)
+	}
+}
+
+// GistUploader uploads reports as GitHub Gists
+type GistUploader struct {
+	token   string
+	public  bool
+	baseURL string
+	client  *http.Client
+}
+
+// NewGistUploader creates a GitHub Gist uploader. Gists are secret
+// (unlisted) unless public is set.
+func NewGistUploader(token string, public bool) *GistUploader {
+	return &GistUploader{
+		token:   token,
+		public:  public,
+		baseURL: "https://api.github.com",
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name returns the backend name
+func (u *GistUploader) Name() string {
+	return "gist"
+}
+
+// Upload creates a gist containing the report as a Markdown file
+func (u *GistUploader) Upload(ctx context.Context, title, content string) (string, error) {
+	requestBody := map[string]interface{}{
+		"description": title,
+		"public":      u.public,
+		"files": map[string]interface{}{
+			"kubehelp-report.md": map[string]string{"content": content},
+		},
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.baseURL+"/gists", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+u.token)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("gist upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.HTMLURL, nil
+}
+
+// HTTPUploader posts reports to a generic paste endpoint. The URL is read
+// from a JSON "url" field, the Location header or a plain-text body.
+type HTTPUploader struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// NewHTTPUploader creates a generic HTTP paste uploader
+func NewHTTPUploader(endpoint, token string) *HTTPUploader {
+	return &HTTPUploader{
+		endpoint: endpoint,
+		token:    token,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name returns the backend name
+func (u *HTTPUploader) Name() string {
+	return "http"
+}
+
+// Upload posts the report as text/markdown
+func (u *HTTPUploader) Upload(ctx context.Context, title, content string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", u.endpoint, strings.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/markdown; charset=utf-8")
+	req.Header.Set("X-Title", title)
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		URL string `json:"url"`
+	}
+	if json.Unmarshal(body, &result) == nil && result.URL != "" {
+		return result.URL, nil
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		return location, nil
+	}
+	if text := strings.TrimSpace(string(body)); strings.HasPrefix(text, "http") {
+		return text, nil
+	}
+	return "", fmt.Errorf("upload succeeded but no URL was returned")
+}
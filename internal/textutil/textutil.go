@@ -0,0 +1,26 @@
+// Package textutil holds string helpers shared by collection and prompt
+// building.
+package textutil
+
+import "unicode/utf8"
+
+// Truncate shortens s to at most max bytes, adding an ellipsis when cut.
+// It cuts on a rune boundary so multi-byte characters, e.g. in localized
+// messages or log lines, are never split into invalid UTF-8.
+func Truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	if max <= 3 {
+		return s[:runeBoundary(s, max)]
+	}
+	return s[:runeBoundary(s, max-3)] + "..."
+}
+
+// runeBoundary returns the largest index not after n that starts a rune of s
+func runeBoundary(s string, n int) int {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
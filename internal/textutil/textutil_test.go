@@ -0,0 +1,39 @@
+package textutil
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"short", "OOMKilled", 20, "OOMKilled"},
+		{"exact", "OOMKilled", 9, "OOMKilled"},
+		{"ascii", "back-off restarting failed container", 12, "back-off ..."},
+		{"tiny max", "CrashLoopBackOff", 3, "Cra"},
+		{"two-byte runes", "Zeitüberschreitung", 9, "Zeitü..."},
+		{"cut inside a rune", "Zeitüberschreitung", 8, "Zeit..."},
+		{"three-byte runes", "容器重启失败", 8, "容..."},
+		{"four-byte runes", "🔥🔥🔥", 9, "🔥..."},
+		{"tiny max inside a rune", "容器", 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Truncate(tt.s, tt.max)
+			if got != tt.want {
+				t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("Truncate(%q, %d) = %q is not valid UTF-8", tt.s, tt.max, got)
+			}
+			if len(got) > tt.max {
+				t.Errorf("Truncate(%q, %d) is %d bytes long", tt.s, tt.max, len(got))
+			}
+		})
+	}
+}
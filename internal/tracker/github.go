@@ -0,0 +1,85 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+)
+
+// githubBodyLimit is the maximum length of a GitHub issue body
+const githubBodyLimit = 65536
+
+// GitHub files issues in a GitHub repository. GitHub has no attachment API,
+// so the snapshot is embedded in a collapsed block of the body, truncated
+// to fit the body limit.
+type GitHub struct {
+	baseURL string
+	repo    string
+	token   string
+	client  *http.Client
+}
+
+// Name returns the backend name
+func (t *GitHub) Name() string {
+	return "github"
+}
+
+// Create opens an issue with the labels of issue, which GitHub creates in
+// the repository when missing
+func (t *GitHub) Create(ctx context.Context, issue Issue) (string, error) {
+	requestBody := map[string]interface{}{
+		"title":  issue.Title,
+		"body":   embedSnapshot(issue.Body, issue.Snapshot, githubBodyLimit),
+		"labels": issue.Labels,
+	}
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.baseURL+"/repos/"+t.repo+"/issues", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	body, err := do(t.client, req, "github")
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.HTMLURL, nil
+}
+
+// embedSnapshot appends snapshot to body as a collapsed JSON block, cut
+// short with a note when the result would exceed limit characters
+func embedSnapshot(body string, snapshot []byte, limit int) string {
+	const (
+		open = "\n<details><summary>" + SnapshotName + "</summary>\n\n```json\n"
+		end  = "\n```\n</details>\n"
+		cut  = "\n... (truncated; collect again with kubehelp diagnose --save)"
+	)
+	if len(snapshot) == 0 {
+		return body
+	}
+	room := limit - utf8.RuneCountInString(body) - len(open) - len(end)
+	if room <= len(cut) {
+		return body
+	}
+	content := string(snapshot)
+	if utf8.RuneCountInString(content) > room {
+		runes := []rune(content)
+		content = string(runes[:room-len(cut)]) + cut
+	}
+	return body + open + content + end
+}
@@ -0,0 +1,107 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitLab files issues in a GitLab project, with the snapshot uploaded to
+// the project and linked from the description
+type GitLab struct {
+	baseURL string
+	// project is a numeric ID or a path such as group/project
+	project string
+	token   string
+	client  *http.Client
+}
+
+// Name returns the backend name
+func (t *GitLab) Name() string {
+	return "gitlab"
+}
+
+// Create uploads the snapshot and opens an issue linking it
+func (t *GitLab) Create(ctx context.Context, issue Issue) (string, error) {
+	description := issue.Body
+	if len(issue.Snapshot) > 0 {
+		link, err := t.upload(ctx, issue.Snapshot)
+		if err != nil {
+			return "", fmt.Errorf("failed to upload snapshot: %w", err)
+		}
+		description += "\n" + link + "\n"
+	}
+
+	requestBody := map[string]interface{}{
+		"title":       issue.Title,
+		"description": description,
+		"labels":      strings.Join(issue.Labels, ","),
+	}
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.projectURL()+"/issues", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", t.token)
+
+	body, err := do(t.client, req, "gitlab")
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		WebURL string `json:"web_url"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.WebURL, nil
+}
+
+// upload stores snapshot as a project upload and returns its Markdown link
+func (t *GitLab) upload(ctx context.Context, snapshot []byte) (string, error) {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	part, err := form.CreateFormFile("file", SnapshotName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(snapshot); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.projectURL()+"/uploads", &buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("PRIVATE-TOKEN", t.token)
+
+	body, err := do(t.client, req, "gitlab")
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Markdown string `json:"markdown"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Markdown, nil
+}
+
+// projectURL returns the API URL of the project
+func (t *GitLab) projectURL() string {
+	return t.baseURL + "/api/v4/projects/" + url.PathEscape(t.project)
+}
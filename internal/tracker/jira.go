@@ -0,0 +1,112 @@
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// Jira files issues in a Jira project through the REST API v2, with the
+// snapshot attached to the issue
+type Jira struct {
+	baseURL   string
+	project   string
+	issueType string
+	// user selects basic authentication with an API token (Jira Cloud);
+	// without it the token is sent as a personal access token (Data Center)
+	user   string
+	token  string
+	client *http.Client
+}
+
+// Name returns the backend name
+func (t *Jira) Name() string {
+	return "jira"
+}
+
+// Create opens an issue and attaches the snapshot. Jira labels cannot
+// contain spaces, so spaces in labels become dashes.
+func (t *Jira) Create(ctx context.Context, issue Issue) (string, error) {
+	labels := make([]string, len(issue.Labels))
+	for i, label := range issue.Labels {
+		labels[i] = strings.ReplaceAll(label, " ", "-")
+	}
+	requestBody := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": t.project},
+			"issuetype":   map[string]string{"name": t.issueType},
+			"summary":     issue.Title,
+			"description": issue.Body,
+			"labels":      labels,
+		},
+	}
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.baseURL+"/rest/api/2/issue", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	t.authorize(req)
+
+	body, err := do(t.client, req, "jira")
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	issueURL := t.baseURL + "/browse/" + result.Key
+
+	if len(issue.Snapshot) > 0 {
+		if err := t.attach(ctx, result.Key, issue.Snapshot); err != nil {
+			return issueURL, fmt.Errorf("created %s but failed to attach snapshot: %w", result.Key, err)
+		}
+	}
+	return issueURL, nil
+}
+
+// attach adds snapshot to the issue key as an attachment
+func (t *Jira) attach(ctx context.Context, key string, snapshot []byte) error {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	part, err := form.CreateFormFile("file", SnapshotName)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(snapshot); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.baseURL+"/rest/api/2/issue/"+key+"/attachments", &buf)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-Atlassian-Token", "no-check")
+	t.authorize(req)
+
+	_, err = do(t.client, req, "jira")
+	return err
+}
+
+// authorize sets the credentials of req
+func (t *Jira) authorize(req *http.Request) {
+	if t.user != "" {
+		req.SetBasicAuth(t.user, t.token)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+}
@@ -0,0 +1,191 @@
+// Package tracker files diagnoses as issues in an issue tracker such as
+// GitHub, GitLab or Jira, with the collected data attached as a snapshot
+// that kubehelp diagnose --from-file can replay.
+package tracker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"kubehelp/internal/analyzer"
+	"kubehelp/internal/i18n"
+	"kubehelp/internal/k8s"
+	"kubehelp/internal/redact"
+)
+
+// SnapshotName is the file name of the snapshot attached to issues
+const SnapshotName = "kubehelp-snapshot.json"
+
+// maxIssueFindings bounds the findings listed in an issue body
+const maxIssueFindings = 20
+
+// Tracker files issues in an issue tracker
+type Tracker interface {
+	// Create files issue and returns its URL
+	Create(ctx context.Context, issue Issue) (string, error)
+	// Name returns the backend name
+	Name() string
+}
+
+// Issue is an issue to file
+type Issue struct {
+	Title string
+	// Body is Markdown; Jira shows it as plain text
+	Body   string
+	Labels []string
+	// Snapshot is the diagnostic data as JSON, attached where the tracker
+	// supports attachments and else appended to the body
+	Snapshot []byte
+}
+
+// NewFromEnv creates the tracker selected by KUBEHELP_ISSUE_TRACKER:
+//   - "github": KUBEHELP_GITHUB_REPO (owner/repo) with KUBEHELP_GITHUB_TOKEN
+//     or GITHUB_TOKEN; KUBEHELP_GITHUB_URL for GitHub Enterprise
+//   - "gitlab": KUBEHELP_GITLAB_PROJECT (ID or group/project) with
+//     KUBEHELP_GITLAB_TOKEN; KUBEHELP_GITLAB_URL for self-managed GitLab
+//   - "jira": KUBEHELP_JIRA_URL and KUBEHELP_JIRA_PROJECT (key) with
+//     KUBEHELP_JIRA_TOKEN, and KUBEHELP_JIRA_USER for Jira Cloud API tokens;
+//     KUBEHELP_JIRA_ISSUE_TYPE defaults to Bug
+func NewFromEnv() (Tracker, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch backend := os.Getenv("KUBEHELP_ISSUE_TRACKER"); backend {
+	case "github":
+		token := os.Getenv("KUBEHELP_GITHUB_TOKEN")
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+		repo := os.Getenv("KUBEHELP_GITHUB_REPO")
+		if token == "" || strings.Count(repo, "/") != 1 {
+			return nil, fmt.Errorf("github issues require KUBEHELP_GITHUB_REPO (owner/repo) and KUBEHELP_GITHUB_TOKEN or GITHUB_TOKEN")
+		}
+		return &GitHub{baseURL: envOr("KUBEHELP_GITHUB_URL", "https://api.github.com"), repo: repo, token: token, client: client}, nil
+	case "gitlab":
+		project, token := os.Getenv("KUBEHELP_GITLAB_PROJECT"), os.Getenv("KUBEHELP_GITLAB_TOKEN")
+		if project == "" || token == "" {
+			return nil, fmt.Errorf("gitlab issues require KUBEHELP_GITLAB_PROJECT and KUBEHELP_GITLAB_TOKEN")
+		}
+		return &GitLab{baseURL: envOr("KUBEHELP_GITLAB_URL", "https://gitlab.com"), project: project, token: token, client: client}, nil
+	case "jira":
+		baseURL, project, token := os.Getenv("KUBEHELP_JIRA_URL"), os.Getenv("KUBEHELP_JIRA_PROJECT"), os.Getenv("KUBEHELP_JIRA_TOKEN")
+		if baseURL == "" || project == "" || token == "" {
+			return nil, fmt.Errorf("jira issues require KUBEHELP_JIRA_URL, KUBEHELP_JIRA_PROJECT and KUBEHELP_JIRA_TOKEN")
+		}
+		return &Jira{
+			baseURL:   baseURL,
+			project:   project,
+			issueType: envOr("KUBEHELP_JIRA_ISSUE_TYPE", "Bug"),
+			user:      os.Getenv("KUBEHELP_JIRA_USER"),
+			token:     token,
+			client:    client,
+		}, nil
+	case "":
+		return nil, fmt.Errorf("no issue tracker configured: set KUBEHELP_ISSUE_TRACKER to github, gitlab or jira")
+	default:
+		return nil, fmt.Errorf("unsupported KUBEHELP_ISSUE_TRACKER %q (supported: github, gitlab, jira)", backend)
+	}
+}
+
+// envOr returns the value of the environment variable key without a
+// trailing slash, or fallback when it is unset
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return strings.TrimSuffix(value, "/")
+	}
+	return fallback
+}
+
+// Report is a diagnosis to file as an issue
+type Report struct {
+	Data     *k8s.DiagnosticData
+	Analysis string
+	Provider string
+	Status   analyzer.Status
+	Messages i18n.Messages
+}
+
+// NewIssue builds the issue of a diagnosis: its severity, findings and
+// analysis, labeled "kubehelp", "severity:<status>" and the comma-separated
+// KUBEHELP_ISSUE_LABELS. Body and snapshot are scrubbed of credentials.
+func NewIssue(r Report) (Issue, error) {
+	data, msg := r.Data, r.Messages
+	where := data.Namespace
+	if where == "" {
+		where = "all namespaces"
+	}
+	if data.ContextName != "" {
+		where = data.ContextName + "/" + where
+	}
+
+	var findings []k8s.Finding
+	for _, cluster := range data.ClusterData() {
+		findings = append(findings, cluster.Findings...)
+	}
+	k8s.SortFindings(findings)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n|---|---|---|---|\n", msg.Severity, msg.Context, msg.Collected, msg.Provider))
+	sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s |\n\n", r.Status, orDash(data.ContextName), data.CollectedAt.Format(time.RFC3339), orDash(r.Provider)))
+	if len(findings) > 0 {
+		sb.WriteString("## " + msg.Findings + "\n\n")
+		for i, f := range findings {
+			if i == maxIssueFindings {
+				sb.WriteString(fmt.Sprintf("- ... %d more\n", len(findings)-maxIssueFindings))
+				break
+			}
+			sb.WriteString(fmt.Sprintf("- **%s** `%s` %s: %s\n", f.Severity, k8s.Qualify(f.Namespace, f.Object), f.Rule, f.Message))
+		}
+		sb.WriteString("\n")
+	}
+	if r.Analysis != "" {
+		sb.WriteString("## " + msg.Analysis + "\n\n")
+		sb.WriteString(strings.TrimSpace(r.Analysis) + "\n\n")
+	}
+	sb.WriteString(fmt.Sprintf("---\nThe collected data is attached as `%s`; replay it with `kubehelp diagnose --from-file %s`.\n", SnapshotName, SnapshotName))
+
+	var snapshot bytes.Buffer
+	if err := k8s.EncodeDiagnosticData(&snapshot, data); err != nil {
+		return Issue{}, err
+	}
+
+	labels := []string{"kubehelp", "severity:" + string(r.Status)}
+	for _, label := range strings.Split(os.Getenv("KUBEHELP_ISSUE_LABELS"), ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return Issue{
+		Title:    fmt.Sprintf("[%s] %s", r.Status, fmt.Sprintf(msg.ReportTitle, where)),
+		Body:     redact.String(sb.String()),
+		Labels:   labels,
+		Snapshot: []byte(redact.String(snapshot.String())),
+	}, nil
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// do sends req and returns the body of a successful response, or an error
+// naming the tracker with the status and body of a failed one
+func do(client *http.Client, req *http.Request, tracker string) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s returned status %d: %s", tracker, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,10 @@
+// Package web holds the server's static UI, embedded in the binary so it is
+// served regardless of the working directory.
+package web
+
+import "embed"
+
+// Files holds the UI files, rooted at this directory
+//
+//go:embed index.html
+var Files embed.FS